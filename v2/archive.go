@@ -0,0 +1,435 @@
+package toolkit
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrArchiveTooLarge is returned when an archive expands to more than Tools.MaxArchiveSize bytes.
+	ErrArchiveTooLarge = errors.New("the archive is too big once extracted")
+	// ErrArchiveTooManyFiles is returned when an archive contains more than Tools.MaxArchiveFiles entries.
+	ErrArchiveTooManyFiles = errors.New("the archive contains too many files")
+	// ErrArchiveIllegalPath is returned when an archive entry would be extracted outside of the destination directory.
+	ErrArchiveIllegalPath = errors.New("the archive contains an illegal file path")
+	// ErrArchiveNested is returned by uploads refused because an archive contains other archives.
+	ErrArchiveNested = errors.New("the archive contains other archives")
+	// ErrNotArchive is returned by InspectArchive for files which aren't zip, tar or tar.gz archives.
+	ErrNotArchive = errors.New("the file is not a zip, tar or tar.gz archive")
+)
+
+// CreateZip writes a zip archive of every file and directory in root to dst.
+func (t *Tools) CreateZip(dst io.Writer, root fs.FS) error {
+	zw := zip.NewWriter(dst)
+
+	err := fs.WalkDir(root, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+
+		entry, err := zw.CreateHeader(header)
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return copyFileFromFS(entry, root, name)
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// CreateTarGz writes a gzip compressed tar archive of every file and directory in root to dst.
+func (t *Tools) CreateTarGz(dst io.Writer, root fs.FS) error {
+	gw := gzip.NewWriter(dst)
+	tw := tar.NewWriter(gw)
+
+	err := fs.WalkDir(root, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err = tw.WriteHeader(header); err != nil || info.IsDir() {
+			return err
+		}
+		return copyFileFromFS(tw, root, name)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// copyFileFromFS copies the content of the file at name in fsys to w.
+func copyFileFromFS(w io.Writer, fsys fs.FS, name string) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// ExtractZip extracts the zip archive read from src into the directory dst, creating it if needed.
+// Entries which would end up outside of dst are rejected (zip slip), as are archives which expand
+// beyond Tools.MaxArchiveSize, or are larger than that to begin with, or contain more than
+// Tools.MaxArchiveFiles entries. Symlinks and other special files are skipped.
+func (t *Tools) ExtractZip(src io.Reader, dst string) error {
+	// zip files are read from the end, so the archive has to be spooled somewhere we can seek
+	tmp, err := os.CreateTemp("", "toolkit-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, io.LimitReader(src, t.maxArchiveSize()+1))
+	if err != nil {
+		return err
+	}
+	if size > t.maxArchiveSize() {
+		return ErrArchiveTooLarge
+	}
+
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+
+	if len(zr.File) > t.maxArchiveFiles() {
+		return ErrArchiveTooManyFiles
+	}
+
+	if err = t.CreateDirIfNotExist(dst); err != nil {
+		return err
+	}
+
+	extractor := archiveExtractor{tools: t, dst: dst}
+	for _, file := range zr.File {
+		if err = func() error {
+			mode := file.Mode()
+			if !mode.IsDir() && !mode.IsRegular() {
+				return nil
+			}
+
+			rc, err := file.Open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+
+			return extractor.extract(file.Name, mode.IsDir(), rc)
+		}(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExtractTarGz extracts the gzip compressed tar archive read from src into the directory dst, creating it if needed.
+// The same protections as for ExtractZip apply.
+func (t *Tools) ExtractTarGz(src io.Reader, dst string) error {
+	gr, err := gzip.NewReader(src)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	if err = t.CreateDirIfNotExist(dst); err != nil {
+		return err
+	}
+
+	extractor := archiveExtractor{tools: t, dst: dst}
+	tr := tar.NewReader(gr)
+	for files := 0; ; files++ {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if files >= t.maxArchiveFiles() {
+			return ErrArchiveTooManyFiles
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = extractor.extract(header.Name, true, nil)
+		case tar.TypeReg:
+			err = extractor.extract(header.Name, false, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// maxArchiveSize returns the maximum number of bytes an archive may expand to.
+func (t *Tools) maxArchiveSize() int64 {
+	if t.MaxArchiveSize == 0 {
+		return 1024 * 1024 * 1024 // 1GB
+	}
+	return t.MaxArchiveSize
+}
+
+// maxArchiveFiles returns the maximum number of entries an archive may contain.
+func (t *Tools) maxArchiveFiles() int {
+	if t.MaxArchiveFiles == 0 {
+		return 10000
+	}
+	return t.MaxArchiveFiles
+}
+
+// archiveExtractor writes archive entries below dst, keeping track of the total size extracted.
+type archiveExtractor struct {
+	tools   *Tools
+	dst     string
+	written int64
+}
+
+// extract creates the directory, or the file with the content read from r, for the archive entry called name.
+func (e *archiveExtractor) extract(name string, isDir bool, r io.Reader) error {
+	target, err := archiveTarget(e.dst, name)
+	if err != nil {
+		return err
+	}
+
+	if isDir {
+		return e.tools.CreateDirIfNotExist(target)
+	}
+
+	if err = e.tools.CreateDirIfNotExist(filepath.Dir(target)); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, e.tools.filePerm(0644))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// never trust the sizes recorded in the archive; count what is actually written instead
+	remaining := e.tools.maxArchiveSize() - e.written
+	n, err := io.Copy(out, io.LimitReader(r, remaining+1))
+	e.written += n
+	if err != nil {
+		return err
+	}
+	if n > remaining {
+		return ErrArchiveTooLarge
+	}
+
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return e.tools.applyFileMode(target, false)
+}
+
+// archiveTarget returns the path an archive entry called name should be extracted to,
+// or ErrArchiveIllegalPath if that would be outside of dst.
+func archiveTarget(dst, name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	cleaned := path.Clean(name)
+
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") || filepath.VolumeName(cleaned) != "" {
+		return "", fmt.Errorf("%w: %s", ErrArchiveIllegalPath, name)
+	}
+
+	return filepath.Join(dst, filepath.FromSlash(cleaned)), nil
+}
+
+// ArchiveInfo describes an archive inspected by InspectArchive.
+type ArchiveInfo struct {
+	// Format is "zip", "tar" or "tar.gz".
+	Format string
+	// Files is the number of entries, directories included.
+	Files int
+	// Size is the total size of the entries once extracted, as counted by reading them.
+	Size int64
+	// Nested lists the entries which are archives themselves, or compressed files.
+	Nested []string
+	// IllegalPaths lists the entries which would be extracted outside of the destination directory.
+	IllegalPaths []string
+}
+
+// archiveFormat returns the format of the archive starting with header, or "" if it isn't one.
+func archiveFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return "zip"
+	case bytes.HasPrefix(header, []byte("\x1f\x8b")):
+		return "tar.gz"
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return "tar"
+	}
+	return ""
+}
+
+// isNestedArchive reports whether an entry starting with header is an archive or compressed file,
+// which could hide a zip bomb one level down.
+func isNestedArchive(header []byte) bool {
+	if archiveFormat(header) != "" {
+		return true
+	}
+	for _, magic := range [][]byte{
+		[]byte("Rar!\x1a\x07"),       // rar
+		[]byte("7z\xbc\xaf\x27\x1c"), // 7z
+		[]byte("BZh"),                // bzip2
+		[]byte("\xfd7zXZ\x00"),       // xz
+		[]byte("\x28\xb5\x2f\xfd"),   // zstd
+	} {
+		if bytes.HasPrefix(header, magic) {
+			return true
+		}
+	}
+	return false
+}
+
+// InspectArchive reads the zip, tar or tar.gz archive in r, of size bytes, without extracting it,
+// and reports its entries. Every entry is decompressed and counted, rather than trusting the sizes the
+// archive records, so zip bombs are found before extraction; reading stops with ErrArchiveTooManyFiles
+// or ErrArchiveTooLarge, along with what was found so far, once Tools.MaxArchiveFiles or
+// Tools.MaxArchiveSize is exceeded.
+func (t *Tools) InspectArchive(r io.ReaderAt, size int64) (*ArchiveInfo, error) {
+	header := make([]byte, 512)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	info := &ArchiveInfo{Format: archiveFormat(header[:n])}
+	switch info.Format {
+	case "zip":
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range zr.File {
+			if err = func() error {
+				rc, err := file.Open()
+				if err != nil {
+					return err
+				}
+				defer rc.Close()
+				return t.inspectArchiveEntry(info, file.Name, rc)
+			}(); err != nil {
+				return info, err
+			}
+		}
+		return info, nil
+
+	case "tar", "tar.gz":
+		var src io.Reader = io.NewSectionReader(r, 0, size)
+		if info.Format == "tar.gz" {
+			gr, err := gzip.NewReader(src)
+			if err != nil {
+				return nil, err
+			}
+			defer gr.Close()
+			src = gr
+		}
+
+		tr := tar.NewReader(src)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return info, nil
+			}
+			if err != nil {
+				return info, err
+			}
+			if err = t.inspectArchiveEntry(info, header.Name, tr); err != nil {
+				return info, err
+			}
+		}
+	}
+
+	return nil, ErrNotArchive
+}
+
+// inspectArchiveEntry adds the entry called name, whose content is read from r, to info.
+func (t *Tools) inspectArchiveEntry(info *ArchiveInfo, name string, r io.Reader) error {
+	info.Files++
+	if info.Files > t.maxArchiveFiles() {
+		return ErrArchiveTooManyFiles
+	}
+	if _, err := archiveTarget(".", name); err != nil {
+		info.IllegalPaths = append(info.IllegalPaths, name)
+	}
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if isNestedArchive(header[:n]) {
+		info.Nested = append(info.Nested, name)
+	}
+
+	remaining := t.maxArchiveSize() - info.Size - int64(n)
+	rest, err := io.Copy(io.Discard, io.LimitReader(r, remaining+1))
+	info.Size += int64(n) + rest
+	if err != nil {
+		return err
+	}
+	if rest > remaining {
+		return ErrArchiveTooLarge
+	}
+	return nil
+}
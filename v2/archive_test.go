@@ -0,0 +1,233 @@
+package toolkit
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var archiveFS = fstest.MapFS{
+	"readme.txt":         &fstest.MapFile{Data: []byte("hello")},
+	"docs/guide.txt":     &fstest.MapFile{Data: []byte("a guide")},
+	"docs/deep/note.txt": &fstest.MapFile{Data: []byte("a note")},
+}
+
+// checkExtracted makes sure every file of archiveFS was extracted to dir.
+func checkExtracted(t *testing.T, dir string) {
+	t.Helper()
+	for name, file := range archiveFS {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s not extracted: %s", name, err)
+			continue
+		}
+		if !bytes.Equal(content, file.Data) {
+			t.Errorf("%s: wrong content %q", name, content)
+		}
+	}
+}
+
+func TestTools_CreateAndExtractZip(t *testing.T) {
+	var testTool Tools
+
+	var buf bytes.Buffer
+	if err := testTool.CreateZip(&buf, archiveFS); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "out")
+	if err := testTool.ExtractZip(&buf, dir); err != nil {
+		t.Fatal(err)
+	}
+	checkExtracted(t, dir)
+}
+
+func TestTools_CreateAndExtractTarGz(t *testing.T) {
+	var testTool Tools
+
+	var buf bytes.Buffer
+	if err := testTool.CreateTarGz(&buf, archiveFS); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "out")
+	if err := testTool.ExtractTarGz(&buf, dir); err != nil {
+		t.Fatal(err)
+	}
+	checkExtracted(t, dir)
+}
+
+// makeZip builds a zip archive in memory with the given entries.
+func makeZip(t *testing.T, entries map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// makeTarGz builds a gzip compressed tar archive in memory with the given entries.
+func makeTarGz(t *testing.T, entries map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+var extractTests = []struct {
+	name          string
+	entries       map[string]string
+	maxSize       int64
+	maxFiles      int
+	expectedError error
+}{
+	{name: "valid", entries: map[string]string{"a.txt": "a", "b/c.txt": "c"}},
+	{name: "zip slip", entries: map[string]string{"../../evil.txt": "evil"}, expectedError: ErrArchiveIllegalPath},
+	{name: "absolute path", entries: map[string]string{"/etc/evil.txt": "evil"}, expectedError: ErrArchiveIllegalPath},
+	{name: "backslash zip slip", entries: map[string]string{`..\evil.txt`: "evil"}, expectedError: ErrArchiveIllegalPath},
+	{name: "too large", entries: map[string]string{"big.txt": strings.Repeat("x", 100)}, maxSize: 50, expectedError: ErrArchiveTooLarge},
+	{name: "too many files", entries: map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c"}, maxFiles: 2, expectedError: ErrArchiveTooManyFiles},
+}
+
+func TestTools_ExtractLimits(t *testing.T) {
+	for _, test := range extractTests {
+		testTool := Tools{MaxArchiveSize: test.maxSize, MaxArchiveFiles: test.maxFiles}
+
+		err := testTool.ExtractZip(makeZip(t, test.entries), filepath.Join(t.TempDir(), "zip"))
+		if !errors.Is(err, test.expectedError) {
+			t.Errorf("%s (zip): expected error %v but got %v", test.name, test.expectedError, err)
+		}
+
+		err = testTool.ExtractTarGz(makeTarGz(t, test.entries), filepath.Join(t.TempDir(), "tar"))
+		if !errors.Is(err, test.expectedError) {
+			t.Errorf("%s (tar.gz): expected error %v but got %v", test.name, test.expectedError, err)
+		}
+	}
+}
+
+// endlessReader reads zeros forever, counting them.
+type endlessReader struct{ read int64 }
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	r.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestTools_ExtractZipSpoolLimit(t *testing.T) {
+	testTools := Tools{MaxArchiveSize: 1024 * 1024}
+	src := &endlessReader{}
+	if err := testTools.ExtractZip(src, t.TempDir()); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Error("expected ErrArchiveTooLarge, got", err)
+	}
+	if src.read > 2*1024*1024 {
+		t.Errorf("expected the spooling to stop past MaxArchiveSize, read %d bytes", src.read)
+	}
+}
+
+var inspectArchiveTests = []struct {
+	name          string
+	entries       map[string]string
+	maxSize       int64
+	maxFiles      int
+	files         int
+	size          int64
+	nested        int
+	illegal       int
+	expectedError error
+}{
+	{name: "valid", entries: map[string]string{"a.txt": "a", "b/c.txt": "cc"}, files: 2, size: 3},
+	{name: "zip slip", entries: map[string]string{"../../evil.txt": "evil"}, files: 1, size: 4, illegal: 1},
+	{name: "nested zip", entries: map[string]string{"inner.zip": "PK\x03\x04rest", "a.txt": "a"}, files: 2, size: 9, nested: 1},
+	{name: "nested gzip", entries: map[string]string{"inner.gz": "\x1f\x8b\x08"}, files: 1, size: 3, nested: 1},
+	{name: "bomb", entries: map[string]string{"big.txt": strings.Repeat("x", 10000)}, maxSize: 1000, files: 1, size: 1001, expectedError: ErrArchiveTooLarge},
+	{name: "too many files", entries: map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c"}, maxFiles: 2, files: 3, expectedError: ErrArchiveTooManyFiles},
+}
+
+func TestTools_InspectArchive(t *testing.T) {
+	for _, test := range inspectArchiveTests {
+		testTool := Tools{MaxArchiveSize: test.maxSize, MaxArchiveFiles: test.maxFiles}
+
+		for format, archive := range map[string]*bytes.Buffer{"zip": makeZip(t, test.entries), "tar.gz": makeTarGz(t, test.entries)} {
+			info, err := testTool.InspectArchive(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("%s (%s): expected error %v but got %v", test.name, format, test.expectedError, err)
+				continue
+			}
+			if info.Format != format || info.Files != test.files || len(info.Nested) != test.nested || len(info.IllegalPaths) != test.illegal {
+				t.Errorf("%s (%s): wrong info %+v", test.name, format, info)
+			}
+			if test.size != 0 && info.Size != test.size {
+				t.Errorf("%s (%s): expected size %d, got %d", test.name, format, test.size, info.Size)
+			}
+		}
+	}
+
+	var testTool Tools
+	if _, err := testTool.InspectArchive(strings.NewReader("just text"), 9); !errors.Is(err, ErrNotArchive) {
+		t.Error("expected ErrNotArchive, got", err)
+	}
+}
+
+func TestTools_UploadFilesInspectArchives(t *testing.T) {
+	for _, e := range []struct {
+		entries map[string]string
+		errorIs error
+	}{
+		{entries: map[string]string{"a.txt": "a"}},
+		{entries: map[string]string{"inner.zip": "PK\x03\x04"}, errorIs: ErrArchiveNested},
+		{entries: map[string]string{"../evil.txt": "evil"}, errorIs: ErrArchiveIllegalPath},
+		{entries: map[string]string{"big.txt": strings.Repeat("x", 5000)}, errorIs: ErrArchiveTooLarge},
+	} {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, _ := writer.CreateFormFile("file", "upload.zip")
+		_, _ = part.Write(makeZip(t, e.entries).Bytes())
+		_ = writer.Close()
+
+		request := httptest.NewRequest("POST", "/", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+
+		testTools := Tools{InspectArchives: true, MaxArchiveSize: 1000, AllowedFileTypes: []string{"application/zip"}}
+		if _, err := testTools.UploadFiles(request, t.TempDir()); !errors.Is(err, e.errorIs) {
+			t.Errorf("%v: expected %v, got %v", e.entries, e.errorIs, err)
+		}
+	}
+}
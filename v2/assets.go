@@ -0,0 +1,150 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// AssetManifest maps the static files of a directory to fingerprinted names, which include a hash of
+// their content, such as app.3f9c2a1b.css for app.css, so that they can be cached forever: a new
+// version of a file gets a new name. It serves the files under those names, and its Funcs give
+// templates their URLs.
+type AssetManifest struct {
+	fsys   fs.FS
+	prefix string
+	// hashed maps the names of the files to their fingerprinted names, and names the other way round;
+	// etags holds the ETag of each file.
+	hashed map[string]string
+	names  map[string]string
+	etags  map[string]string
+}
+
+// NewAssetManifest hashes the files of fsys, such as os.DirFS("static") or an embed.FS, skipping
+// dotfiles, for URLs starting with prefix, such as /static/.
+func (t *Tools) NewAssetManifest(fsys fs.FS, prefix string) (*AssetManifest, error) {
+	m := &AssetManifest{
+		fsys:   fsys,
+		prefix: "/" + strings.Trim(prefix, "/") + "/",
+		hashed: make(map[string]string),
+		names:  make(map[string]string),
+		etags:  make(map[string]string),
+	}
+	if m.prefix == "//" {
+		m.prefix = "/"
+	}
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != "." {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		f, err := fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err = io.Copy(h, f); err != nil {
+			return err
+		}
+		sum := hex.EncodeToString(h.Sum(nil))
+
+		ext := path.Ext(p)
+		hashed := strings.TrimSuffix(p, ext) + "." + sum[:8] + ext
+		m.hashed[p] = hashed
+		m.names[hashed] = p
+		m.etags[p] = `"` + sum[:16] + `"`
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Path returns the URL of the file name, such as /static/css/app.3f9c2a1b.css for css/app.css, or its
+// URL without a fingerprint if it is not in the manifest.
+func (m *AssetManifest) Path(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if hashed, ok := m.hashed[name]; ok {
+		return m.prefix + hashed
+	}
+	return m.prefix + name
+}
+
+// Funcs returns the template function assetPath, which is Path, for RendererOptions.Funcs:
+//
+//	<link rel="stylesheet" href="{{assetPath "app.css"}}">
+func (m *AssetManifest) Funcs() map[string]any {
+	return map[string]any{"assetPath": m.Path}
+}
+
+// ServeHTTP implements http.Handler, serving the files of the manifest under their URLs. Fingerprinted
+// names are sent with headers letting clients cache them forever; the original names are still served,
+// for files referenced without Path, but must be revalidated.
+func (m *AssetManifest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, m.prefix) {
+		http.NotFound(w, r)
+		return
+	}
+
+	requested := strings.TrimPrefix(r.URL.Path, m.prefix)
+	name, immutable := m.names[requested]
+	if !immutable {
+		if _, ok := m.hashed[requested]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		name = requested
+	}
+
+	f, err := m.fsys.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+
+	if immutable {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("ETag", m.etags[name])
+	http.ServeContent(w, r, path.Base(name), info.ModTime(), content)
+}
@@ -0,0 +1,80 @@
+package toolkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssetManifest(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.css":       {Data: []byte("body{}")},
+		"js/app.min.js": {Data: []byte("alert(1)")},
+		".env":          {Data: []byte("SECRET=1")},
+		".git/config":   {Data: []byte("[core]")},
+	}
+	sum := sha256.Sum256([]byte("body{}"))
+	hashedCSS := "/static/app." + hex.EncodeToString(sum[:])[:8] + ".css"
+
+	var testTools Tools
+	manifest, err := testTools.NewAssetManifest(fsys, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p := manifest.Path("app.css"); p != hashedCSS {
+		t.Errorf("expected %s, got %s", hashedCSS, p)
+	}
+	if p := manifest.Path("/js/app.min.js"); !strings.HasPrefix(p, "/static/js/app.min.") || !strings.HasSuffix(p, ".js") || len(p) != len("/static/js/app.min.js")+9 {
+		t.Error("wrong path", p)
+	}
+	if p := manifest.Path("missing.png"); p != "/static/missing.png" {
+		t.Error("wrong path", p)
+	}
+
+	tests := []struct {
+		path         string
+		status       int
+		cacheControl string
+	}{
+		{path: hashedCSS, status: http.StatusOK, cacheControl: "public, max-age=31536000, immutable"},
+		{path: "/static/app.css", status: http.StatusOK, cacheControl: "no-cache"},
+		{path: "/static/app.00000000.css", status: http.StatusNotFound},
+		{path: "/static/.env", status: http.StatusNotFound},
+		{path: "/static/.git/config", status: http.StatusNotFound},
+		{path: "/other/app.css", status: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		rr := httptest.NewRecorder()
+		manifest.ServeHTTP(rr, httptest.NewRequest("GET", test.path, nil))
+		if rr.Code != test.status || rr.Header().Get("Cache-Control") != test.cacheControl {
+			t.Errorf("%s: wrong response %d %q", test.path, rr.Code, rr.Header().Get("Cache-Control"))
+		}
+		if test.status == http.StatusOK && (rr.Body.String() != "body{}" || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/css")) {
+			t.Errorf("%s: wrong body %q", test.path, rr.Body.String())
+		}
+	}
+
+	// clients revalidating get a 304
+	rr := httptest.NewRecorder()
+	manifest.ServeHTTP(rr, httptest.NewRequest("GET", hashedCSS, nil))
+	request := httptest.NewRequest("GET", "/static/app.css", nil)
+	request.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	manifest.ServeHTTP(rr, request)
+	if rr.Code != http.StatusNotModified {
+		t.Error("expected 304, got", rr.Code)
+	}
+
+	renderer, err := testTools.NewRenderer(fstest.MapFS{"page.html": {Data: []byte(`<link href="{{assetPath "app.css"}}">`)}}, RendererOptions{Funcs: manifest.Funcs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := renderer.RenderString("page", nil); err != nil || body != `<link href="`+hashedCSS+`">` {
+		t.Errorf("wrong page %q %v", body, err)
+	}
+}
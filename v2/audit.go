@@ -0,0 +1,130 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEvent is a record of who did what to which resource.
+type AuditEvent struct {
+	Time      time.Time      `json:"time"`
+	Actor     string         `json:"actor"`
+	Action    string         `json:"action"`
+	Resource  string         `json:"resource,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+	IP        string         `json:"ip,omitempty"`
+}
+
+// AuditSink is the interface implemented by the destinations of audit events.
+type AuditSink interface {
+	WriteAuditEvent(ctx context.Context, event AuditEvent) error
+}
+
+// AuditSinkFunc is an adapter to use a function, such as one inserting events into a database, as an AuditSink.
+type AuditSinkFunc func(ctx context.Context, event AuditEvent) error
+
+// WriteAuditEvent calls f(ctx, event).
+func (f AuditSinkFunc) WriteAuditEvent(ctx context.Context, event AuditEvent) error {
+	return f(ctx, event)
+}
+
+// FileAuditSink is an AuditSink appending events to a file, one JSON object per line.
+type FileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditSink returns a FileAuditSink appending to the file at path, which is created if needed.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditSink{file: file}, nil
+}
+
+// WriteAuditEvent appends event to the file.
+func (s *FileAuditSink) WriteAuditEvent(ctx context.Context, event AuditEvent) error {
+	out, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(out, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (s *FileAuditSink) Close() error {
+	return s.file.Close()
+}
+
+// HTTPAuditSink returns an AuditSink posting each event as JSON to url, with PushJSONToRemote.
+// The optional client is passed on to PushJSONToRemote.
+func (t *Tools) HTTPAuditSink(url string, client ...*http.Client) AuditSink {
+	return AuditSinkFunc(func(ctx context.Context, event AuditEvent) error {
+		_, status, err := t.PushJSONToRemote(url, event, client...)
+		if err != nil {
+			return err
+		}
+		if status >= 300 {
+			return fmt.Errorf("audit endpoint returned status %d", status)
+		}
+		return nil
+	})
+}
+
+// AuditLogger records audit events to a sink.
+type AuditLogger struct {
+	tools *Tools
+	sink  AuditSink
+}
+
+// NewAuditLogger returns an AuditLogger recording events to sink.
+func (t *Tools) NewAuditLogger(sink AuditSink) *AuditLogger {
+	return &AuditLogger{tools: t, sink: sink}
+}
+
+// Log records event, setting its time to now if it isn't set. The fields of the metadata values tagged
+// with redact are blanked, as by Redact. Failures are logged as well as returned, so that callers which
+// can't do anything about them may ignore them.
+func (a *AuditLogger) Log(ctx context.Context, event AuditEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	event.Metadata = Redact(event.Metadata).(map[string]any)
+
+	if err := a.sink.WriteAuditEvent(ctx, event); err != nil {
+		a.tools.logger().Error("audit event lost", "action", event.Action, "actor", event.Actor, "err", err)
+		return err
+	}
+	return nil
+}
+
+// LogRequest records that action was done to resource while handling r. The request id, client IP address
+// (found by RealIP) and, if actor is empty, the subject of the JWT claims set by AuthMiddleware
+// are filled in from the request.
+func (a *AuditLogger) LogRequest(r *http.Request, actor, action, resource string, metadata map[string]any) error {
+	if actor == "" {
+		if claims, ok := JWTClaimsFromContext(r.Context()); ok {
+			actor = claims.Subject()
+		}
+	}
+
+	return a.Log(r.Context(), AuditEvent{
+		Actor:     actor,
+		Action:    action,
+		Resource:  resource,
+		Metadata:  metadata,
+		RequestID: RequestIDFromContext(r.Context()),
+		IP:        a.tools.RealIP(r),
+	})
+}
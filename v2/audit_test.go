@@ -0,0 +1,112 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLogger_LogRequest(t *testing.T) {
+	var events []AuditEvent
+	testTools := Tools{JWTKeys: []JWTKey{{Algorithm: HS256, Secret: []byte("secret")}}}
+	audit := testTools.NewAuditLogger(AuditSinkFunc(func(ctx context.Context, event AuditEvent) error {
+		events = append(events, event)
+		return nil
+	}))
+
+	token, _ := testTools.GenerateJWT(JWTClaims{"sub": "user-42"}, time.Minute)
+
+	handler := testTools.RequestID(testTools.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = audit.LogRequest(r, "", "invoice.delete", "invoices/7", map[string]any{"reason": "duplicate"})
+	})))
+
+	req := httptest.NewRequest("DELETE", "/invoices/7", nil)
+	req.RemoteAddr = "203.0.113.9:5555"
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Request-ID", "req-123")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(events) != 1 {
+		t.Fatal("expected one event, got", len(events))
+	}
+	event := events[0]
+	if event.Actor != "user-42" || event.Action != "invoice.delete" || event.Resource != "invoices/7" {
+		t.Errorf("wrong event %+v", event)
+	}
+	if event.RequestID != "req-123" || event.IP != "203.0.113.9" || event.Metadata["reason"] != "duplicate" || event.Time.IsZero() {
+		t.Errorf("wrong request details %+v", event)
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileAuditSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testTools Tools
+	audit := testTools.NewAuditLogger(sink)
+	_ = audit.Log(context.Background(), AuditEvent{Actor: "admin", Action: "login"})
+	_ = audit.Log(context.Background(), AuditEvent{Actor: "admin", Action: "logout"})
+	_ = sink.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var actions []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		actions = append(actions, event.Action)
+	}
+	if strings.Join(actions, ",") != "login,logout" {
+		t.Error("wrong events in file", actions)
+	}
+}
+
+func TestTools_HTTPAuditSink(t *testing.T) {
+	var received AuditEvent
+	status := http.StatusAccepted
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		_ = json.NewDecoder(req.Body).Decode(&received)
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header)}
+	})
+
+	testTools := Tools{Logger: &recordingLogger{}}
+	audit := testTools.NewAuditLogger(testTools.HTTPAuditSink("http://audit.example.com/events", client))
+
+	if err := audit.Log(context.Background(), AuditEvent{Actor: "svc", Action: "export"}); err != nil {
+		t.Fatal(err)
+	}
+	if received.Action != "export" {
+		t.Errorf("wrong event posted %+v", received)
+	}
+
+	status = http.StatusInternalServerError
+	if err := audit.Log(context.Background(), AuditEvent{Action: "export"}); err == nil {
+		t.Error("expected an error for a failing endpoint")
+	}
+	if !testTools.Logger.(*recordingLogger).contains("ERROR audit event lost") {
+		t.Error("expected the lost event to be logged")
+	}
+
+	if err := (AuditSinkFunc(func(ctx context.Context, e AuditEvent) error { return errors.New("db down") })).WriteAuditEvent(context.Background(), AuditEvent{}); err == nil {
+		t.Error("expected the function's error")
+	}
+}
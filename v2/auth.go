@@ -0,0 +1,132 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const apiKeyContextKey contextKey = "apiKey"
+
+// BasicAuthOptions is the type used to configure the BasicAuth middleware.
+type BasicAuthOptions struct {
+	// Realm is sent to clients in the WWW-Authenticate header. Defaults to "Restricted".
+	Realm string
+	// Users maps user names to their passwords.
+	Users map[string]string
+	// Validate, if set, is used instead of Users to check credentials.
+	Validate func(user, password string) bool
+}
+
+// BasicAuth returns middleware which requires HTTP Basic authentication, with a user and password
+// from opts.Users (compared in constant time) or accepted by opts.Validate.
+// Other requests are refused with a 401 JSON error.
+func (t *Tools) BasicAuth(opts BasicAuthOptions) func(http.Handler) http.Handler {
+	realm := opts.Realm
+	if realm == "" {
+		realm = "Restricted"
+	}
+
+	validate := opts.Validate
+	if validate == nil {
+		validate = func(user, password string) bool {
+			expected, ok := opts.Users[user]
+			// compare anyway when the user doesn't exist, so that timing doesn't reveal which users do
+			match := secureCompare(password, expected)
+			return ok && match
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, password, ok := r.BasicAuth()
+			if !ok || !validate(user, password) {
+				t.logger().Debug("basic authentication failed", "path", r.URL.Path, "user", user)
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, realm))
+				_ = t.ErrorJSON(w, errors.New("invalid credentials"), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// APIKeyOptions is the type used to configure the APIKey middleware.
+type APIKeyOptions struct {
+	// Header is the request header holding the key. Defaults to X-API-Key.
+	Header string
+	// QueryParam, if set, is a query string parameter checked for the key when the header is missing.
+	QueryParam string
+	// Validate reports whether key is valid. It may return an error if the check itself failed. It is
+	// required.
+	Validate func(ctx context.Context, key string) (bool, error)
+}
+
+// APIKey returns middleware which requires an API key, checked by opts.Validate. The key is stored in the
+// request context, where APIKeyFromContext finds it. Requests without a valid key are refused with a
+// 401 JSON error, and a failing validation with a 500 one. It panics if opts.Validate is not set.
+func (t *Tools) APIKey(opts APIKeyOptions) func(http.Handler) http.Handler {
+	if opts.Validate == nil {
+		panic("toolkit: APIKey requires APIKeyOptions.Validate")
+	}
+	header := opts.Header
+	if header == "" {
+		header = "X-API-Key"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(header)
+			if key == "" && opts.QueryParam != "" {
+				key = r.URL.Query().Get(opts.QueryParam)
+			}
+			if key == "" {
+				_ = t.ErrorJSON(w, errors.New("missing API key"), http.StatusUnauthorized)
+				return
+			}
+
+			valid, err := opts.Validate(r.Context(), key)
+			if err != nil {
+				t.logger().Error("API key validation failed", "path", r.URL.Path, "err", err)
+				_ = t.ErrorJSON(w, errors.New(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError)
+				return
+			}
+			if !valid {
+				t.logger().Debug("invalid API key", "path", r.URL.Path)
+				_ = t.ErrorJSON(w, errors.New("invalid API key"), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, key)))
+		})
+	}
+}
+
+// APIKeyFromContext returns the API key stored in ctx by the APIKey middleware, or an empty string if there is none.
+func APIKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(apiKeyContextKey).(string)
+	return key
+}
+
+// StaticAPIKeys returns an APIKeyOptions.Validate function accepting any of keys, compared in constant time.
+func StaticAPIKeys(keys ...string) func(ctx context.Context, key string) (bool, error) {
+	return func(ctx context.Context, key string) (bool, error) {
+		valid := false
+		for _, k := range keys {
+			if secureCompare(key, k) {
+				valid = true
+			}
+		}
+		return valid, nil
+	}
+}
+
+// secureCompare reports whether a and b are equal, in constant time. Both are hashed first,
+// so that not even their lengths can be learned from timing.
+func secureCompare(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
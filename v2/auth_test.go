@@ -0,0 +1,102 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var basicAuthTests = []struct {
+	name           string
+	user           string
+	password       string
+	expectedStatus int
+}{
+	{name: "valid", user: "admin", password: "secret", expectedStatus: http.StatusOK},
+	{name: "wrong password", user: "admin", password: "guess", expectedStatus: http.StatusUnauthorized},
+	{name: "unknown user", user: "nobody", password: "secret", expectedStatus: http.StatusUnauthorized},
+	{name: "no credentials", expectedStatus: http.StatusUnauthorized},
+}
+
+func TestTools_BasicAuth(t *testing.T) {
+	var testTools Tools
+
+	handler := testTools.BasicAuth(BasicAuthOptions{Realm: "admin area", Users: map[string]string{"admin": "secret"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, test := range basicAuthTests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.password)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != test.expectedStatus {
+			t.Errorf("%s: wrong status code; expected %d but got %d", test.name, test.expectedStatus, rr.Code)
+		}
+		if test.expectedStatus == http.StatusUnauthorized && !strings.Contains(rr.Header().Get("WWW-Authenticate"), `realm="admin area"`) {
+			t.Errorf("%s: wrong WWW-Authenticate header %q", test.name, rr.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+var apiKeyTests = []struct {
+	name           string
+	header         string
+	query          string
+	expectedStatus int
+}{
+	{name: "header", header: "key-1", expectedStatus: http.StatusOK},
+	{name: "query", query: "key-2", expectedStatus: http.StatusOK},
+	{name: "invalid", header: "key-3", expectedStatus: http.StatusUnauthorized},
+	{name: "missing", expectedStatus: http.StatusUnauthorized},
+	{name: "validation error", header: "broken", expectedStatus: http.StatusInternalServerError},
+}
+
+func TestTools_APIKey(t *testing.T) {
+	testTools := Tools{ErrorLog: discardLog}
+
+	validate := func(ctx context.Context, key string) (bool, error) {
+		if key == "broken" {
+			return false, errors.New("database down")
+		}
+		return StaticAPIKeys("key-1", "key-2")(ctx, key)
+	}
+
+	for _, test := range apiKeyTests {
+		var fromContext string
+		handler := testTools.APIKey(APIKeyOptions{QueryParam: "api_key", Validate: validate})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fromContext = APIKeyFromContext(r.Context())
+		}))
+
+		target := "/"
+		if test.query != "" {
+			target += "?api_key=" + test.query
+		}
+		req := httptest.NewRequest("GET", target, nil)
+		if test.header != "" {
+			req.Header.Set("X-API-Key", test.header)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != test.expectedStatus {
+			t.Errorf("%s: wrong status code; expected %d but got %d", test.name, test.expectedStatus, rr.Code)
+		}
+		if test.expectedStatus == http.StatusOK && fromContext != test.header+test.query {
+			t.Errorf("%s: wrong key in context %q", test.name, fromContext)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected APIKey to panic without Validate")
+		}
+	}()
+	testTools.APIKey(APIKeyOptions{})
+}
@@ -0,0 +1,192 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// BatchOptions is the type used to configure a BatchHandler.
+type BatchOptions struct {
+	// MaxRequests is the largest number of requests in a batch. Defaults to 20.
+	MaxRequests int
+	// Concurrency is the number of requests of a batch run at once. Defaults to 4.
+	Concurrency int
+	// MaxResponseSize is the largest body, in bytes, of the response to each request of a batch;
+	// larger ones are replaced by a 500 error. Defaults to Tools.MaxJSONSize, or 1MB.
+	MaxResponseSize int64
+}
+
+const batchContextKey contextKey = "batch"
+
+// BatchRequest is a request of a batch.
+type BatchRequest struct {
+	// ID, if set, is copied to the response, to match them up.
+	ID     string `json:"id,omitempty"`
+	Method string `json:"method"`
+	// Path is the path, with the query string, such as /users/1?fields=name.
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResponse is the response to a request of a batch. Bodies which are not JSON are sent as strings.
+type BatchResponse struct {
+	ID      string            `json:"id,omitempty"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchHandler returns a handler, for POST requests, which runs the array of BatchRequest in their body
+// against handler, usually the application's mux, and responds with the array of their BatchResponse, in
+// the same order, so that clients can send several requests in a single round trip. The requests of a
+// batch inherit the headers of the batch request, such as Authorization, and its context. Batches can't
+// be nested.
+func (t *Tools) BatchHandler(handler http.Handler, opts ...BatchOptions) http.Handler {
+	var options BatchOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.MaxRequests <= 0 {
+		options.MaxRequests = 20
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 4
+	}
+	if options.MaxResponseSize <= 0 {
+		options.MaxResponseSize = t.maxJSONSize()
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a batch reaching the handler through another path than its own
+		if r.Context().Value(batchContextKey) != nil {
+			_ = t.ErrorJSON(w, errors.New("batches can't be nested"))
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			_ = t.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var requests []BatchRequest
+		if err := t.ReadJSON(w, r, &requests); err != nil {
+			_ = t.ErrorJSON(w, err)
+			return
+		}
+		if len(requests) > options.MaxRequests {
+			_ = t.ErrorJSON(w, fmt.Errorf("a batch can hold at most %d requests", options.MaxRequests))
+			return
+		}
+
+		responses := make([]BatchResponse, len(requests))
+		slots := make(chan struct{}, options.Concurrency)
+		var wg sync.WaitGroup
+		for i := range requests {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(i int) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				responses[i] = t.runBatchRequest(handler, r, requests[i], options.MaxResponseSize)
+			}(i)
+		}
+		wg.Wait()
+
+		_ = t.WriteJSON(w, http.StatusOK, responses)
+	})
+}
+
+// runBatchRequest runs the request of a batch sent in batch against handler, with a response of at
+// most maxSize bytes.
+func (t *Tools) runBatchRequest(handler http.Handler, batch *http.Request, request BatchRequest, maxSize int64) BatchResponse {
+	response := BatchResponse{ID: request.ID}
+	fail := func(status int, message string) BatchResponse {
+		response.Status = status
+		response.Body, _ = json.Marshal(JSONResponse{Error: true, Message: message})
+		return response
+	}
+
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if !strings.HasPrefix(request.Path, "/") || strings.HasPrefix(request.Path, "//") {
+		return fail(http.StatusBadRequest, "the path of a batch request must start with /")
+	}
+
+	ctx := context.WithValue(batch.Context(), batchContextKey, true)
+	sub, err := http.NewRequestWithContext(ctx, method, request.Path, bytes.NewReader(request.Body))
+	if err != nil {
+		return fail(http.StatusBadRequest, err.Error())
+	}
+	if nestedBatch(sub.URL.Path, batch.URL.Path) {
+		return fail(http.StatusBadRequest, "batches can't be nested")
+	}
+	for name, values := range batch.Header {
+		if name != "Content-Length" {
+			sub.Header[name] = values
+		}
+	}
+	for name, value := range request.Headers {
+		sub.Header.Set(name, value)
+	}
+	if len(request.Body) > 0 {
+		sub.Header.Set("Content-Type", "application/json")
+	}
+	sub.Host = batch.Host
+	sub.RemoteAddr = batch.RemoteAddr
+
+	// requests run in their own goroutines, where a panic would not reach the Recover middleware
+	rec := &recordedResponse{header: make(http.Header), limit: maxSize}
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				t.logger().Error("panic in batch request", "method", method, "path", request.Path, "panic", p)
+				rec.status = http.StatusInternalServerError
+				rec.body.Reset()
+				rec.body.WriteString(`{"error":true,"message":"internal server error"}`)
+			}
+		}()
+		handler.ServeHTTP(rec, sub)
+	}()
+
+	if rec.exceeded {
+		t.logger().Warn("batch response too large", "method", method, "path", request.Path, "limit", maxSize)
+		return fail(http.StatusInternalServerError, "the response is too large for a batch")
+	}
+	response.Status = rec.status
+	if response.Status == 0 {
+		response.Status = http.StatusOK
+	}
+	for name := range rec.header {
+		if response.Headers == nil {
+			response.Headers = make(map[string]string)
+		}
+		response.Headers[name] = rec.header.Get(name)
+	}
+	if body := rec.body.Bytes(); len(body) > 0 {
+		if json.Valid(body) {
+			response.Body = append(json.RawMessage(nil), bytes.TrimSpace(body)...)
+		} else {
+			response.Body, _ = json.Marshal(string(body))
+		}
+	}
+	return response
+}
+
+// nestedBatch reports whether p, the path of a request of a batch, leads to the batch handler at
+// batchPath, or below it, once both are cleaned and lowercased, as in /Batch, /batch/ or /a/../batch.
+func nestedBatch(p, batchPath string) bool {
+	p, batchPath = strings.ToLower(path.Clean(p)), strings.ToLower(path.Clean(batchPath))
+	return p == batchPath || strings.HasPrefix(p, strings.TrimSuffix(batchPath, "/")+"/")
+}
@@ -0,0 +1,153 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTools_BatchHandler(t *testing.T) {
+	var testTools Tools
+	var running, most atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		if n := running.Add(1); n > most.Load() {
+			most.Store(n)
+		}
+		defer running.Add(-1)
+
+		if r.Header.Get("Authorization") != "Bearer token" {
+			_ = testTools.ErrorJSON(w, ErrUnauthorized, http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodPost {
+			var input map[string]string
+			if err := testTools.ReadJSON(w, r, &input); err != nil {
+				_ = testTools.ErrorJSON(w, err)
+				return
+			}
+			_ = testTools.WriteJSON(w, http.StatusCreated, input)
+			return
+		}
+		_ = testTools.WriteJSON(w, http.StatusOK, map[string]string{"id": strings.TrimPrefix(r.URL.Path, "/users/"), "lang": r.Header.Get("Accept-Language")})
+	})
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "plain")
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	batch := testTools.BatchHandler(mux, BatchOptions{MaxRequests: 11, Concurrency: 2})
+	mux.Handle("/batch", batch)
+
+	body := `[
+		{"id": "a", "method": "GET", "path": "/users/1"},
+		{"id": "b", "method": "post", "path": "/users/", "body": {"name": "Ann"}},
+		{"id": "c", "path": "/users/2", "headers": {"Accept-Language": "fr"}},
+		{"id": "d", "path": "/users/3", "headers": {"Authorization": ""}},
+		{"id": "e", "path": "/text"},
+		{"id": "f", "path": "/panic"},
+		{"id": "g", "path": "/batch"},
+		{"id": "h", "path": "http://example.com/users/1"},
+		{"id": "i", "path": "/Batch/"},
+		{"id": "j", "path": "/users/../batch?x=1"},
+		{"id": "k", "path": "/%62atch"}
+	]`
+	request := httptest.NewRequest("POST", "/batch", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer token")
+	request.Header.Set("Accept-Language", "en")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, request)
+	if rr.Code != http.StatusOK {
+		t.Fatal("wrong status", rr.Code, rr.Body.String())
+	}
+
+	var responses []BatchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &responses); err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		id     string
+		status int
+		body   string
+	}{
+		{id: "a", status: http.StatusOK, body: `{"id":"1","lang":"en"}`},
+		{id: "b", status: http.StatusCreated, body: `{"name":"Ann"}`},
+		{id: "c", status: http.StatusOK, body: `{"id":"2","lang":"fr"}`},
+		{id: "d", status: http.StatusUnauthorized, body: `{"error":true,"message":"unauthorized"}`},
+		{id: "e", status: http.StatusOK, body: `"plain"`},
+		{id: "f", status: http.StatusInternalServerError, body: `{"error":true,"message":"internal server error"}`},
+		{id: "g", status: http.StatusBadRequest, body: `{"error":true,"message":"batches can't be nested"}`},
+		{id: "h", status: http.StatusBadRequest, body: `{"error":true,"message":"the path of a batch request must start with /"}`},
+		{id: "i", status: http.StatusBadRequest, body: `{"error":true,"message":"batches can't be nested"}`},
+		{id: "j", status: http.StatusBadRequest, body: `{"error":true,"message":"batches can't be nested"}`},
+		{id: "k", status: http.StatusBadRequest, body: `{"error":true,"message":"batches can't be nested"}`},
+	}
+	if len(responses) != len(expected) {
+		t.Fatalf("expected %d responses, got %d", len(expected), len(responses))
+	}
+	for i, e := range expected {
+		response := responses[i]
+		if response.ID != e.id || response.Status != e.status || string(response.Body) != e.body {
+			t.Errorf("%s: expected %d %s, got %s %d %s", e.id, e.status, e.body, response.ID, response.Status, response.Body)
+		}
+	}
+	if responses[0].Headers["Content-Type"] != "application/json" {
+		t.Errorf("expected the headers of the response, got %v", responses[0].Headers)
+	}
+	if most.Load() > 2 {
+		t.Errorf("expected at most 2 requests at once, got %d", most.Load())
+	}
+
+	request = httptest.NewRequest("POST", "/batch", strings.NewReader(`[{},{},{},{},{},{},{},{},{},{},{},{}]`))
+	rr = httptest.NewRecorder()
+	batch.ServeHTTP(rr, request)
+	if rr.Code != http.StatusBadRequest {
+		t.Error("expected 400 for too many requests, got", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	batch.ServeHTTP(rr, httptest.NewRequest("GET", "/batch", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Error("expected 405, got", rr.Code)
+	}
+
+	// a batch mounted under another path is refused all the same
+	mux.Handle("/v1/batch", batch)
+	rr = httptest.NewRecorder()
+	batch.ServeHTTP(rr, httptest.NewRequest("POST", "/batch", strings.NewReader(`[{"path": "/v1/batch"}]`)))
+	if err := json.Unmarshal(rr.Body.Bytes(), &responses); err != nil || responses[0].Status != http.StatusBadRequest {
+		t.Errorf("expected the nested batch to be refused, got %s", rr.Body.String())
+	}
+}
+
+func TestTools_BatchHandler_MaxResponseSize(t *testing.T) {
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSON(w, http.StatusOK, strings.Repeat("x", 100))
+	})
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSON(w, http.StatusOK, "x")
+	})
+	batch := testTools.BatchHandler(mux, BatchOptions{MaxResponseSize: 50})
+
+	rr := httptest.NewRecorder()
+	batch.ServeHTTP(rr, httptest.NewRequest("POST", "/batch", strings.NewReader(`[{"path": "/big"}, {"path": "/small"}]`)))
+	var responses []BatchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &responses); err != nil || len(responses) != 2 {
+		t.Fatal("wrong responses", rr.Body.String(), err)
+	}
+	if responses[0].Status != http.StatusInternalServerError || responses[1].Status != http.StatusOK {
+		t.Errorf("expected only the large response to be refused, got %d and %d", responses[0].Status, responses[1].Status)
+	}
+	if !logger.contains("WARN batch response too large") {
+		t.Error("expected the large response to be logged")
+	}
+}
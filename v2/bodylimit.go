@@ -0,0 +1,100 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrBodyTooLarge is matched, with errors.Is, by the errors returned when a request body is larger than
+// allowed, by ReadJSON, UploadFiles or the BodyLimit middleware. ErrorJSON sends them with a 413 status code.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// bodyTooLargeError is the error returned for a body larger than limit bytes.
+type bodyTooLargeError struct {
+	limit int64
+}
+
+func (e *bodyTooLargeError) Error() string {
+	return fmt.Sprintf("body must not be larger than %d bytes", e.limit)
+}
+
+func (e *bodyTooLargeError) Is(target error) bool {
+	return target == ErrBodyTooLarge
+}
+
+// asBodyTooLarge returns err as a bodyTooLargeError if it comes from reading past an http.MaxBytesReader,
+// or nil otherwise.
+func asBodyTooLarge(err error) error {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return &bodyTooLargeError{limit: maxBytesError.Limit}
+	}
+	return nil
+}
+
+// BodyLimitOptions is the type used to configure the BodyLimit middleware.
+type BodyLimitOptions struct {
+	// Limit is the largest request body, in bytes. Defaults to 1MB.
+	Limit int64
+	// Routes overrides Limit for some routes, keyed by path prefix, such as "/uploads/", optionally after
+	// a method, as in "POST /uploads/". The longest matching prefix wins. A negative limit means no limit.
+	Routes map[string]int64
+}
+
+// BodyLimit returns middleware which limits the size of request bodies, whatever their content type.
+// Requests whose Content-Length is over the limit are refused at once with a 413 JSON error; reading
+// past the limit of other bodies fails with an error matching ErrBodyTooLarge once it comes through
+// ReadJSON or UploadFiles, and http.MaxBytesError otherwise.
+func (t *Tools) BodyLimit(opts BodyLimitOptions) func(http.Handler) http.Handler {
+	if opts.Limit == 0 {
+		opts.Limit = 1024 * 1024 // 1MB
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := opts.routeLimit(r)
+			if limit < 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > limit {
+				t.logger().Debug("request body too large", "method", r.Method, "path", r.URL.Path,
+					"size", r.ContentLength, "limit", limit)
+				w.Header().Set("Connection", "close")
+				_ = t.ErrorJSON(w, &bodyTooLargeError{limit: limit})
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// routeLimit returns the body limit of r.
+func (opts BodyLimitOptions) routeLimit(r *http.Request) int64 {
+	limit, longest := opts.Limit, -1
+	for route, routeLimit := range opts.Routes {
+		if score, ok := matchRoute(r, route); ok && score > longest {
+			limit, longest = routeLimit, score
+		}
+	}
+	return limit
+}
+
+// matchRoute reports whether r is for route, a path prefix optionally after a method, as in
+// "POST /uploads/", and how specific the match is: longer prefixes score higher, and a route naming
+// the method wins over one with the same prefix for any method.
+func matchRoute(r *http.Request, route string) (score int, ok bool) {
+	prefix := route
+	if method, path, found := strings.Cut(route, " "); found {
+		if !strings.EqualFold(method, r.Method) {
+			return 0, false
+		}
+		prefix, score = strings.TrimSpace(path), 1
+	}
+	return score + 2*len(prefix), strings.HasPrefix(r.URL.Path, prefix)
+}
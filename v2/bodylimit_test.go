@@ -0,0 +1,114 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var bodyLimitTests = []struct {
+	name   string
+	method string
+	path   string
+	size   int
+	chunk  bool
+	status int
+}{
+	{name: "within the limit", method: "POST", path: "/notes", size: 10, status: http.StatusOK},
+	{name: "content length over the limit", method: "POST", path: "/notes", size: 20, status: http.StatusRequestEntityTooLarge},
+	{name: "chunked over the limit", method: "POST", path: "/notes", size: 20, chunk: true, status: http.StatusRequestEntityTooLarge},
+	{name: "route override", method: "POST", path: "/uploads/avatar", size: 50, status: http.StatusOK},
+	{name: "route override exceeded", method: "POST", path: "/uploads/avatar", size: 150, status: http.StatusRequestEntityTooLarge},
+	{name: "method specific route", method: "PUT", path: "/uploads/avatar", size: 150, status: http.StatusOK},
+	{name: "longer prefix wins", method: "POST", path: "/uploads/small/a", size: 8, status: http.StatusRequestEntityTooLarge},
+	{name: "unlimited", method: "POST", path: "/import", size: 5000, status: http.StatusOK},
+}
+
+func TestTools_BodyLimit(t *testing.T) {
+	var testTools Tools
+	handler := testTools.BodyLimit(BodyLimitOptions{
+		Limit: 16,
+		Routes: map[string]int64{
+			"/uploads/":       100,
+			"/uploads/small/": 4,
+			"PUT /uploads/":   200,
+			"/import":         -1,
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			_ = testTools.ErrorJSON(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, test := range bodyLimitTests {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(strings.Repeat("a", test.size)))
+		if test.chunk {
+			req.ContentLength = -1
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", test.name, test.status, rr.Code)
+		}
+		var payload JSONResponse
+		if test.status == http.StatusRequestEntityTooLarge && (json.Unmarshal(rr.Body.Bytes(), &payload) != nil || !payload.Error) {
+			t.Errorf("%s: expected a JSON error, got %s", test.name, rr.Body.String())
+		}
+	}
+}
+
+func TestTools_BodyLimit_ReadJSON(t *testing.T) {
+	var testTools Tools
+
+	var readErr error
+	handler := testTools.BodyLimit(BodyLimitOptions{Limit: 10})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]string
+		readErr = testTools.ReadJSON(w, r, &data)
+		_ = testTools.ErrorJSON(w, readErr)
+	}))
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"a rather long name"}`))
+	req.ContentLength = -1
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if !errors.Is(readErr, ErrBodyTooLarge) || readErr.Error() != "body must not be larger than 10 bytes" {
+		t.Error("expected ErrBodyTooLarge with the middleware's limit, got", readErr)
+	}
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Error("expected ErrorJSON to send a 413, got", rr.Code)
+	}
+}
+
+func TestTools_BodyLimit_UploadFiles(t *testing.T) {
+	testTools := Tools{AllowedFileTypes: []string{"text/plain; charset=utf-8"}}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", "notes.txt")
+	_, _ = part.Write(bytes.Repeat([]byte("a"), 4096))
+	_ = writer.Close()
+
+	var uploadErr error
+	handler := testTools.BodyLimit(BodyLimitOptions{Limit: 1024})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, uploadErr = testTools.UploadFiles(r, t.TempDir())
+	}))
+
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.ContentLength = -1
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !errors.Is(uploadErr, ErrBodyTooLarge) {
+		t.Error("expected ErrBodyTooLarge, got", uploadErr)
+	}
+}
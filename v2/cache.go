@@ -0,0 +1,245 @@
+package toolkit
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCacheMiss is returned by Cache.Get when there is no value for a key.
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache is the interface implemented by the caches the toolkit can use. The in-memory MemoryCache
+// suits a single server; a shared cache, such as Redis, lets several servers use the same entries.
+type Cache interface {
+	// Get returns the value stored under key, or ErrCacheMiss if there is none, or it has expired.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value under key for ttl. A zero ttl means the value doesn't expire.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the value stored under key, if any.
+	Delete(ctx context.Context, key string) error
+	// Flush removes every value.
+	Flush(ctx context.Context) error
+}
+
+// CounterCache is a Cache which can also increment counters atomically. The rate limiter can keep
+// its counters in any CounterCache.
+type CounterCache interface {
+	Cache
+	// Increment adds one to the counter stored under key, creating it with a value of one, expiring
+	// after ttl, if it doesn't exist, and returns the new value.
+	Increment(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
+
+// MemoryCache is a CounterCache which keeps up to a maximum number of entries in memory,
+// evicting the least recently used entry to make room for new ones.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    *list.List
+	items      map[string]*list.Element
+	now        func() time.Time
+}
+
+// memoryCacheEntry is a value held by a MemoryCache.
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache returns an empty MemoryCache holding up to maxEntries entries. Zero means no limit.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    list.New(),
+		items:      make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// Get returns the value stored under key, or ErrCacheMiss if there is none, or it has expired.
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.lookup(key)
+	if entry == nil {
+		return nil, ErrCacheMiss
+	}
+	return append([]byte(nil), entry.value...), nil
+}
+
+// Set stores value under key for ttl. A zero ttl means the value doesn't expire.
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.store(key, append([]byte(nil), value...), ttl)
+	return nil
+}
+
+// Delete removes the value stored under key, if any.
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+	return nil
+}
+
+// Flush removes every value.
+func (c *MemoryCache) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries.Init()
+	c.items = make(map[string]*list.Element)
+	return nil
+}
+
+// Increment adds one to the counter stored under key, creating it with a value of one, expiring
+// after ttl, if it doesn't exist, and returns the new value.
+func (c *MemoryCache) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.lookup(key)
+	if entry == nil {
+		c.store(key, []byte("1"), ttl)
+		return 1, nil
+	}
+
+	n, err := strconv.ParseInt(string(entry.value), 10, 64)
+	if err != nil {
+		return 0, errors.New("cached value is not a counter")
+	}
+	n++
+	entry.value = strconv.AppendInt(entry.value[:0], n, 10)
+	return n, nil
+}
+
+// Len returns the number of entries in the cache, including expired ones which haven't been removed yet.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries.Len()
+}
+
+// lookup returns the live entry for key, marking it as recently used, or nil.
+func (c *MemoryCache) lookup(key string) *memoryCacheEntry {
+	elem, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+
+	entry := elem.Value.(*memoryCacheEntry)
+	if !entry.expires.IsZero() && !c.now().Before(entry.expires) {
+		c.remove(elem)
+		return nil
+	}
+
+	c.entries.MoveToFront(elem)
+	return entry
+}
+
+// store sets the entry for key, evicting the least recently used entries if the cache is full.
+func (c *MemoryCache) store(key string, value []byte, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*memoryCacheEntry)
+		entry.value, entry.expires = value, expires
+		c.entries.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.entries.PushFront(&memoryCacheEntry{key: key, value: value, expires: expires})
+	for c.maxEntries > 0 && c.entries.Len() > c.maxEntries {
+		c.remove(c.entries.Back())
+	}
+}
+
+// remove deletes the entry held by elem.
+func (c *MemoryCache) remove(elem *list.Element) {
+	c.entries.Remove(elem)
+	delete(c.items, elem.Value.(*memoryCacheEntry).key)
+}
+
+// cache returns Tools.Cache, setting it to a MemoryCache of 1000 entries if it is nil.
+func (t *Tools) cache() Cache {
+	t.cacheMu.Lock()
+	defer t.cacheMu.Unlock()
+
+	if t.Cache == nil {
+		t.Cache = NewMemoryCache(1000)
+	}
+	return t.Cache
+}
+
+// WriteJSONCached writes the JSON encoding of the data returned by load with a 200 status code,
+// caching the encoded response in Tools.Cache under key for ttl, so that load is only called
+// when the cache doesn't hold the response already. The response carries an ETag, and requests
+// whose If-None-Match matches it get a 304 Not Modified. Errors returned by load are returned as is,
+// without writing anything, so that the caller can send them with ErrorJSON.
+func (t *Tools) WriteJSONCached(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration, load func() (any, error)) error {
+	cache := t.cache()
+
+	cacheStatus := "HIT"
+	out, err := cache.Get(r.Context(), key)
+	if err != nil {
+		if !errors.Is(err, ErrCacheMiss) {
+			t.logger().Warn("cache error", "key", key, "err", err)
+		}
+
+		data, err := load()
+		if err != nil {
+			return err
+		}
+		if out, err = json.Marshal(data); err != nil {
+			return err
+		}
+		if err = cache.Set(r.Context(), key, out, ttl); err != nil {
+			t.logger().Warn("cache error", "key", key, "err", err)
+		}
+		cacheStatus = "MISS"
+	}
+
+	sum := sha256.Sum256(out)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Cache", cacheStatus)
+
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == "*" || headerContainsETag(match, etag)) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(out)
+	return err
+}
+
+// headerContainsETag reports whether the If-None-Match header value lists etag, compared weakly.
+func headerContainsETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
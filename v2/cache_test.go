@@ -0,0 +1,137 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewMemoryCache(2)
+	cache.now = func() time.Time { return now }
+
+	_ = cache.Set(ctx, "a", []byte("1"), time.Minute)
+	_ = cache.Set(ctx, "b", []byte("2"), 0)
+
+	// reading a makes b the least recently used entry, so adding c evicts b
+	if v, err := cache.Get(ctx, "a"); err != nil || string(v) != "1" {
+		t.Errorf("wrong value for a: %q %v", v, err)
+	}
+	_ = cache.Set(ctx, "c", []byte("3"), 0)
+	if _, err := cache.Get(ctx, "b"); !errors.Is(err, ErrCacheMiss) {
+		t.Error("expected b to be evicted, got", err)
+	}
+	if cache.Len() != 2 {
+		t.Error("wrong number of entries", cache.Len())
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := cache.Get(ctx, "a"); !errors.Is(err, ErrCacheMiss) {
+		t.Error("expected a to have expired, got", err)
+	}
+
+	_ = cache.Delete(ctx, "c")
+	if _, err := cache.Get(ctx, "c"); !errors.Is(err, ErrCacheMiss) {
+		t.Error("expected c to be deleted, got", err)
+	}
+
+	_ = cache.Set(ctx, "d", []byte("4"), 0)
+	_ = cache.Flush(ctx)
+	if cache.Len() != 0 {
+		t.Error("expected an empty cache after Flush, got", cache.Len())
+	}
+}
+
+func TestMemoryCache_Increment(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewMemoryCache(0)
+	cache.now = func() time.Time { return now }
+
+	for i := int64(1); i <= 3; i++ {
+		if n, err := cache.Increment(ctx, "hits", time.Minute); err != nil || n != i {
+			t.Errorf("expected %d, got %d %v", i, n, err)
+		}
+	}
+	if v, _ := cache.Get(ctx, "hits"); string(v) != "3" {
+		t.Errorf("wrong stored counter %q", v)
+	}
+
+	now = now.Add(time.Minute)
+	if n, _ := cache.Increment(ctx, "hits", time.Minute); n != 1 {
+		t.Error("expected the counter to start over once expired, got", n)
+	}
+
+	_ = cache.Set(ctx, "name", []byte("gopher"), 0)
+	if _, err := cache.Increment(ctx, "name", 0); err == nil {
+		t.Error("expected an error incrementing a value which isn't a counter")
+	}
+}
+
+func TestTools_WriteJSONCached(t *testing.T) {
+	var testTools Tools
+
+	loads := 0
+	load := func() (any, error) {
+		loads++
+		return map[string]int{"users": 42}, nil
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/stats", nil)
+	if err := testTools.WriteJSONCached(rr, req, "stats", time.Minute, load); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Body.String() != `{"users":42}` || rr.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("wrong first response %q %s", rr.Body.String(), rr.Header().Get("X-Cache"))
+	}
+	etag := rr.Header().Get("ETag")
+
+	rr = httptest.NewRecorder()
+	if err := testTools.WriteJSONCached(rr, req, "stats", time.Minute, load); err != nil {
+		t.Fatal(err)
+	}
+	if loads != 1 || rr.Header().Get("X-Cache") != "HIT" || rr.Body.String() != `{"users":42}` {
+		t.Errorf("expected a cached response, got %d loads and %q", loads, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	req.Header.Set("If-None-Match", etag)
+	_ = testTools.WriteJSONCached(rr, req, "stats", time.Minute, load)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("expected 304 with no body, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	failure := errors.New("database unavailable")
+	err := testTools.WriteJSONCached(rr, req, "other", time.Minute, func() (any, error) { return nil, failure })
+	if !errors.Is(err, failure) || rr.Body.Len() != 0 {
+		t.Error("expected the load error to be returned without writing, got", err)
+	}
+}
+
+func TestCacheRateLimitStore(t *testing.T) {
+	testTools := Tools{Cache: NewMemoryCache(100)}
+
+	handler := testTools.RateLimit(RateLimitOptions{Requests: 2, Window: time.Minute, KeyFunc: RateLimitByIP})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	codes := []int{}
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		codes = append(codes, rr.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Error("wrong status codes", codes)
+	}
+
+	if testTools.Cache.(*MemoryCache).Len() != 1 {
+		t.Error("expected the counter to be kept in Tools.Cache")
+	}
+}
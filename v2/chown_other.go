@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package toolkit
+
+// chown does nothing on this platform, where files don't have a Unix owner.
+func chown(path string, uid, gid int) error {
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build linux || darwin || freebsd
+
+package toolkit
+
+import "os"
+
+// chown changes the owner of the file at path.
+func chown(path string, uid, gid int) error {
+	return os.Chown(path, uid, gid)
+}
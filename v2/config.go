@@ -0,0 +1,609 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigOptions is the type used to configure LoadConfig.
+type ConfigOptions struct {
+	// Files are JSON (.json) or YAML (.yaml, .yml) files to read, in order; later files override earlier ones.
+	// Missing files are an error.
+	Files []string
+	// EnvFiles are .env files to read, in order. Defaults to ".env"; missing .env files are ignored.
+	EnvFiles []string
+	// EnvPrefix is prepended to the names in env tags, such as "MYAPP_".
+	EnvPrefix string
+}
+
+// LoadConfig populates the struct pointed to by cfg. Values come, from lowest to highest precedence, from:
+// the default tag, the configuration files, the .env files, and the environment variables named in env tags.
+// File keys match fields by their yaml or json tag, or by name ignoring case, and nested structs are
+// nested objects. Fields tagged required:"true" must end up with a non-zero value.
+//
+//	type Config struct {
+//		Addr    string        `env:"ADDR" default:":8080"`
+//		Timeout time.Duration `env:"TIMEOUT" default:"5s"`
+//		DSN     string        `env:"DATABASE_URL" required:"true"`
+//	}
+func LoadConfig(cfg any, opts ...ConfigOptions) error {
+	var options ConfigOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("config must be a pointer to a struct")
+	}
+	v = v.Elem()
+
+	if err := applyConfigDefaults(v); err != nil {
+		return err
+	}
+
+	for _, file := range options.Files {
+		values, err := readConfigFile(file)
+		if err != nil {
+			return err
+		}
+		if err = applyConfigMap(v, values, ""); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	envFiles := options.EnvFiles
+	if envFiles == nil {
+		envFiles = []string{".env"}
+	}
+	dotenv := make(map[string]string)
+	for _, file := range envFiles {
+		values, err := ReadEnvFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for k, val := range values {
+			dotenv[k] = val
+		}
+	}
+
+	if err := applyConfigEnv(v, options.EnvPrefix, dotenv); err != nil {
+		return err
+	}
+
+	var missing []string
+	checkRequiredConfig(v, "", &missing)
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required configuration: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// ReadEnvFile parses the .env file at path: KEY=VALUE lines, optionally preceded by export, with # comments.
+// Double quoted values may contain escapes (\n, \", \\) and span several lines; single quoted values are literal.
+func ReadEnvFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("%s:%d: invalid line", path, i+1)
+		}
+		value = strings.TrimSpace(value)
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			// keep reading lines until the closing quote
+			for !closedDoubleQuote(value) && i+1 < len(lines) {
+				i++
+				value += "\n" + lines[i]
+			}
+			if !closedDoubleQuote(value) {
+				return nil, fmt.Errorf("%s:%d: unterminated quoted value", path, i+1)
+			}
+			end := strings.LastIndex(value, `"`)
+			value = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value[1:end])
+		case strings.HasPrefix(value, "'"):
+			end := strings.LastIndex(value, "'")
+			if end == 0 {
+				return nil, fmt.Errorf("%s:%d: unterminated quoted value", path, i+1)
+			}
+			value = value[1:end]
+		default:
+			if idx := strings.Index(value, " #"); idx >= 0 {
+				value = strings.TrimSpace(value[:idx])
+			}
+		}
+
+		values[key] = value
+	}
+	return values, nil
+}
+
+// closedDoubleQuote reports whether the double quoted value s contains its closing quote.
+func closedDoubleQuote(s string) bool {
+	return closingQuote(s, '"', '\\') > 0
+}
+
+// readConfigFile reads the JSON or YAML file at path into a map.
+func readConfigFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&values)
+	case ".yaml", ".yml":
+		var parsed any
+		parsed, err = parseYAML(data)
+		if err == nil {
+			var ok bool
+			if values, ok = parsed.(map[string]any); !ok && parsed != nil {
+				err = errors.New("the document is not a mapping")
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported configuration file type", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+// applyConfigDefaults sets the fields of v which have a default tag.
+func applyConfigDefaults(v reflect.Value) error {
+	return walkConfigFields(v, "", func(field reflect.Value, sf reflect.StructField, name string) error {
+		if def, ok := sf.Tag.Lookup("default"); ok {
+			if err := setConfigValue(field, def); err != nil {
+				return fmt.Errorf("default for %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// applyConfigEnv sets the fields of v with an env tag from the environment, or from the .env values.
+func applyConfigEnv(v reflect.Value, prefix string, dotenv map[string]string) error {
+	return walkConfigFields(v, "", func(field reflect.Value, sf reflect.StructField, name string) error {
+		key := sf.Tag.Get("env")
+		if key == "" || key == "-" {
+			return nil
+		}
+		key = prefix + key
+
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			value, ok = dotenv[key]
+		}
+		if !ok {
+			return nil
+		}
+		if err := setConfigValue(field, value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", key, err)
+		}
+		return nil
+	})
+}
+
+// checkRequiredConfig appends the names of required fields of v which are still zero to missing.
+func checkRequiredConfig(v reflect.Value, path string, missing *[]string) {
+	_ = walkConfigFields(v, path, func(field reflect.Value, sf reflect.StructField, name string) error {
+		if sf.Tag.Get("required") == "true" && field.IsZero() {
+			if env := sf.Tag.Get("env"); env != "" {
+				name += " (" + env + ")"
+			}
+			*missing = append(*missing, name)
+		}
+		return nil
+	})
+}
+
+// walkConfigFields calls fn for every exported field of the struct v which isn't itself a nested struct,
+// with its dotted path for messages.
+func walkConfigFields(v reflect.Value, path string, fn func(field reflect.Value, sf reflect.StructField, name string) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		field := v.Field(i)
+		name := path + sf.Name
+
+		if isConfigStruct(field) {
+			if err := walkConfigFields(field, name+".", fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(field, sf, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isConfigStruct reports whether field is a nested configuration struct, rather than a value such as a time.Time.
+func isConfigStruct(field reflect.Value) bool {
+	if field.Kind() != reflect.Struct {
+		return false
+	}
+	_, isText := field.Addr().Interface().(encoding.TextUnmarshaler)
+	return !isText
+}
+
+// applyConfigMap sets the fields of v from the values read from a configuration file.
+func applyConfigMap(v reflect.Value, values map[string]any, path string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		raw, ok := lookupConfigKey(values, sf)
+		if !ok || raw == nil {
+			continue
+		}
+		field := v.Field(i)
+		name := path + sf.Name
+
+		if isConfigStruct(field) {
+			nested, ok := raw.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: expected an object", name)
+			}
+			if err := applyConfigMap(field, nested, name+"."); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if list, ok := raw.([]any); ok {
+			if field.Kind() != reflect.Slice {
+				return fmt.Errorf("%s: unexpected list", name)
+			}
+			slice := reflect.MakeSlice(field.Type(), len(list), len(list))
+			for j, item := range list {
+				if err := setConfigValue(slice.Index(j), fmt.Sprint(item)); err != nil {
+					return fmt.Errorf("%s[%d]: %w", name, j, err)
+				}
+			}
+			field.Set(slice)
+			continue
+		}
+
+		if _, ok := raw.(map[string]any); ok {
+			return fmt.Errorf("%s: unexpected object", name)
+		}
+		if err := setConfigValue(field, fmt.Sprint(raw)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// lookupConfigKey returns the value for the field sf: under its yaml or json tag name if it has one,
+// or its name compared without regard to case.
+func lookupConfigKey(values map[string]any, sf reflect.StructField) (any, bool) {
+	for _, tag := range []string{"yaml", "json"} {
+		if name, _, _ := strings.Cut(sf.Tag.Get(tag), ","); name != "" {
+			if name == "-" {
+				return nil, false
+			}
+			v, ok := values[name]
+			return v, ok
+		}
+	}
+
+	for k, v := range values {
+		if strings.EqualFold(k, sf.Name) || strings.EqualFold(strings.ReplaceAll(k, "_", ""), sf.Name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setConfigValue converts s to the type of field, and sets it. Slices are comma separated.
+func setConfigValue(field reflect.Value, s string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.Uint8 {
+			field.SetBytes([]byte(s))
+			return nil
+		}
+		var parts []string
+		if s != "" {
+			parts = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(field.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setConfigValue(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// yamlLine is a significant line of a YAML document.
+type yamlLine struct {
+	indent int
+	text   string
+	number int
+}
+
+// parseYAML parses the subset of YAML used by configuration files: nested mappings, lists, scalars
+// (plain, single or double quoted), flow lists such as [a, b], and comments. Anchors, multi-line
+// strings and multiple documents are not supported.
+func parseYAML(data []byte) (any, error) {
+	var lines []yamlLine
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		raw := strings.TrimRight(scanner.Text(), " \t\r")
+		text := strings.TrimLeft(raw, " ")
+		if text == "" || strings.HasPrefix(text, "#") || text == "---" {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", n)
+		}
+		lines = append(lines, yamlLine{indent: len(raw) - len(text), text: text, number: n})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	value, next, err := parseYAMLBlock(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[next].number)
+	}
+	return value, nil
+}
+
+// parseYAMLBlock parses the mapping or list starting at lines[i], whose lines are indented by indent.
+func parseYAMLBlock(lines []yamlLine, i, indent int) (any, int, error) {
+	if strings.HasPrefix(lines[i].text, "- ") || lines[i].text == "-" {
+		var list []any
+		for i < len(lines) && lines[i].indent == indent && (strings.HasPrefix(lines[i].text, "- ") || lines[i].text == "-") {
+			item := strings.TrimSpace(strings.TrimPrefix(lines[i].text, "-"))
+			if item == "" || (strings.Contains(item, ": ") || strings.HasSuffix(item, ":")) && !isQuoted(item) {
+				return nil, i, fmt.Errorf("line %d: only lists of scalars are supported", lines[i].number)
+			}
+			value, err := parseYAMLScalar(item)
+			if err != nil {
+				return nil, i, fmt.Errorf("line %d: %w", lines[i].number, err)
+			}
+			list = append(list, value)
+			i++
+		}
+		return list, i, nil
+	}
+
+	mapping := make(map[string]any)
+	for i < len(lines) && lines[i].indent == indent {
+		line := lines[i]
+		key, rest, found := cutYAMLKey(line.text)
+		if !found {
+			return nil, i, fmt.Errorf("line %d: expected key: value", line.number)
+		}
+		i++
+
+		if rest != "" {
+			value, err := parseYAMLScalar(rest)
+			if err != nil {
+				return nil, i, fmt.Errorf("line %d: %w", line.number, err)
+			}
+			mapping[key] = value
+			continue
+		}
+
+		// the value is the more indented block which follows, if any; lists may also sit at the key's indentation
+		if i < len(lines) && (lines[i].indent > indent || lines[i].indent == indent && strings.HasPrefix(lines[i].text, "- ")) {
+			value, next, err := parseYAMLBlock(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, next, err
+			}
+			mapping[key] = value
+			i = next
+		} else {
+			mapping[key] = nil
+		}
+	}
+
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, i, fmt.Errorf("line %d: unexpected indentation", lines[i].number)
+	}
+	return mapping, i, nil
+}
+
+// cutYAMLKey splits a "key: value" line, where key may be quoted.
+func cutYAMLKey(text string) (key, rest string, found bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 || !strings.HasPrefix(text[end+2:], ":") {
+			return "", "", false
+		}
+		return text[1 : end+1], stripYAMLComment(strings.TrimSpace(text[end+3:])), true
+	}
+
+	idx := strings.Index(text, ": ")
+	if idx < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false
+		}
+		idx = len(text) - 1
+	}
+	return strings.TrimSpace(text[:idx]), stripYAMLComment(strings.TrimSpace(text[idx+1:])), true
+}
+
+// stripYAMLComment removes a trailing comment from a value.
+func stripYAMLComment(s string) string {
+	end := -1
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end = closingQuote(s, '"', '\\')
+	case strings.HasPrefix(s, "'"):
+		end = closingQuote(s, '\'', '\'')
+	case strings.HasPrefix(s, "["):
+		end = strings.LastIndex(s, "]")
+	}
+	if end > 0 {
+		if rest := strings.TrimSpace(s[end+1:]); rest == "" || strings.HasPrefix(rest, "#") {
+			return s[:end+1]
+		}
+		return s
+	}
+
+	if strings.HasPrefix(s, "#") {
+		return ""
+	}
+	if idx := strings.Index(s, " #"); idx >= 0 {
+		return strings.TrimSpace(s[:idx])
+	}
+	return s
+}
+
+// closingQuote returns the index of the quote closing the string starting at s[0], or -1.
+// A quote preceded by escape (or, for single quotes, doubled) doesn't close the string.
+func closingQuote(s string, quote, escape byte) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == escape && quote != escape:
+			i++
+		case s[i] == quote && quote == escape && i+1 < len(s) && s[i+1] == quote:
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// isQuoted reports whether s starts with a quote.
+func isQuoted(s string) bool {
+	return strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'")
+}
+
+// parseYAMLScalar parses a scalar or flow list value.
+func parseYAMLScalar(s string) (any, error) {
+	s = stripYAMLComment(s)
+
+	switch {
+	case strings.HasPrefix(s, `"`):
+		var out string
+		if err := json.Unmarshal([]byte(s), &out); err != nil {
+			return nil, fmt.Errorf("invalid double quoted string %s", s)
+		}
+		return out, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("invalid single quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("invalid flow list %s", s)
+		}
+		list := []any{}
+		inner := strings.TrimSpace(s[1 : len(s)-1])
+		if inner == "" {
+			return list, nil
+		}
+		for _, item := range strings.Split(inner, ",") {
+			value, err := parseYAMLScalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case s == "~" || s == "null" || s == "":
+		return nil, nil
+	case s == "true" || s == "false":
+		return s == "true", nil
+	default:
+		return s, nil
+	}
+}
@@ -0,0 +1,184 @@
+package toolkit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Addr     string        `env:"ADDR" default:":8080"`
+	Timeout  time.Duration `env:"TIMEOUT" default:"5s"`
+	Debug    bool          `env:"DEBUG"`
+	Origins  []string      `env:"ORIGINS"`
+	MaxSize  int64         `yaml:"max_size" json:"max_size"`
+	Secret   string        `env:"SECRET" required:"true"`
+	Database struct {
+		DSN      string `env:"DATABASE_URL" required:"true"`
+		MaxConns int    `yaml:"max_conns" json:"max_conns" default:"10"`
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"config.yaml": `# application settings
+addr: ":9000"   # overridden by the environment
+timeout: 30s
+max_size: 1048576
+origins:
+  - https://example.com
+  - "https://admin.example.com"
+database:
+  dsn: postgres://localhost/app
+  max_conns: 20
+`,
+		"local.json": `{"max_size": 2048, "database": {"max_conns": 5}}`,
+		".env": `# secrets
+export APP_SECRET="multi
+line \"secret\""
+APP_DEBUG=true # inline comment
+APP_ADDR='ignored, the real environment wins'
+DEBUG=false
+`,
+	})
+
+	t.Setenv("APP_ADDR", ":7000")
+
+	var cfg testConfig
+	err := LoadConfig(&cfg, ConfigOptions{
+		Files:     []string{filepath.Join(dir, "config.yaml"), filepath.Join(dir, "local.json")},
+		EnvFiles:  []string{filepath.Join(dir, ".env")},
+		EnvPrefix: "APP_",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Addr != ":7000" {
+		t.Error("wrong addr", cfg.Addr)
+	}
+	if cfg.Timeout != 30*time.Second || cfg.MaxSize != 2048 || cfg.Database.MaxConns != 5 {
+		t.Errorf("wrong values from files %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.Origins, []string{"https://example.com", "https://admin.example.com"}) {
+		t.Error("wrong origins", cfg.Origins)
+	}
+	if cfg.Database.DSN != "postgres://localhost/app" {
+		t.Error("wrong dsn", cfg.Database.DSN)
+	}
+	if !cfg.Debug {
+		// DEBUG=false in the .env file isn't prefixed, so it doesn't apply
+		t.Error("wrong debug", cfg.Debug)
+	}
+	if cfg.Secret != "multi\nline \"secret\"" {
+		t.Errorf("wrong secret %q", cfg.Secret)
+	}
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"config.json": `{"addr": ":9000", "secret": "from-file", "database": {"dsn": "from-file"}}`,
+		".env":        "ADDR=:9100\nSECRET=from-dotenv\nORIGINS=https://a.com, https://b.com\n",
+	})
+	t.Setenv("ADDR", ":9200")
+	t.Setenv("DATABASE_URL", "from-env")
+
+	var cfg testConfig
+	err := LoadConfig(&cfg, ConfigOptions{
+		Files:    []string{filepath.Join(dir, "config.json")},
+		EnvFiles: []string{filepath.Join(dir, ".env")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Addr != ":9200" || cfg.Secret != "from-dotenv" || cfg.Database.DSN != "from-env" {
+		t.Errorf("wrong precedence %+v", cfg)
+	}
+	if cfg.Timeout != 5*time.Second || cfg.Database.MaxConns != 10 {
+		t.Errorf("defaults not applied %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.Origins, []string{"https://a.com", "https://b.com"}) {
+		t.Error("wrong origins", cfg.Origins)
+	}
+}
+
+var loadConfigErrorTests = []struct {
+	name    string
+	files   map[string]string
+	env     map[string]string
+	message string
+}{
+	{name: "missing required", message: "missing required configuration: Secret (SECRET), Database.DSN (DATABASE_URL)"},
+	{name: "bad env value", env: map[string]string{"TIMEOUT": "soon", "SECRET": "s", "DATABASE_URL": "d"}, message: "environment variable TIMEOUT"},
+	{name: "bad file value", files: map[string]string{"config.yaml": "max_size: big\n"}, message: "Max"},
+	{name: "bad yaml", files: map[string]string{"config.yaml": "addr: a\n   timeout: 5s\n"}, message: "unexpected indentation"},
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	for _, e := range loadConfigErrorTests {
+		t.Run(e.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFiles(t, dir, e.files)
+			for k, v := range e.env {
+				t.Setenv(k, v)
+			}
+
+			var files []string
+			if len(e.files) > 0 {
+				files = []string{filepath.Join(dir, "config.yaml")}
+			}
+
+			var cfg testConfig
+			err := LoadConfig(&cfg, ConfigOptions{Files: files, EnvFiles: []string{filepath.Join(dir, ".env")}})
+			if err == nil || !strings.Contains(err.Error(), e.message) {
+				t.Errorf("expected an error containing %q, got %v", e.message, err)
+			}
+		})
+	}
+
+	if err := LoadConfig(testConfig{}); err == nil {
+		t.Error("expected an error for a non-pointer config")
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	doc := `
+server:
+  host: 'it''s here'
+  ports: [80, 443]
+  tags:
+  - a
+  - "b # not a comment"
+empty:
+enabled: true
+`
+	value, err := parseYAML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"server": map[string]any{
+			"host":  "it's here",
+			"ports": []any{"80", "443"},
+			"tags":  []any{"a", "b # not a comment"},
+		},
+		"empty":   nil,
+		"enabled": true,
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("wrong document\n got %#v\nwant %#v", value, expected)
+	}
+}
+
+func TestReadEnvFile_Missing(t *testing.T) {
+	if _, err := ReadEnvFile(filepath.Join(t.TempDir(), ".env")); !os.IsNotExist(err) {
+		t.Error("expected a not exist error, got", err)
+	}
+}
@@ -0,0 +1,130 @@
+package toolkit
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions is the type used to configure the CORS middleware.
+type CORSOptions struct {
+	// AllowedOrigins lists the origins permitted to make cross-origin requests. An origin may contain
+	// a single * wildcard, as in https://*.example.com, and "*" on its own allows every origin.
+	AllowedOrigins []string
+	// AllowOriginFunc, if set, is consulted for origins which are not in AllowedOrigins.
+	AllowOriginFunc func(origin string) bool
+	// AllowedMethods lists the methods permitted in cross-origin requests. Defaults to GET, HEAD, POST, PUT, PATCH and DELETE.
+	AllowedMethods []string
+	// AllowedHeaders lists the request headers permitted in cross-origin requests, with "*" permitting any header.
+	// Defaults to Accept, Authorization, Content-Type and X-Request-ID.
+	AllowedHeaders []string
+	// ExposedHeaders lists the response headers which scripts are allowed to read.
+	ExposedHeaders []string
+	// AllowCredentials permits requests carrying cookies or HTTP authentication.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the result of a preflight request.
+	MaxAge time.Duration
+}
+
+// CORS returns middleware which implements Cross-Origin Resource Sharing according to opts.
+// Preflight requests are answered directly, without calling the next handler.
+func (t *Tools) CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	headers := opts.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Accept", "Authorization", "Content-Type", "X-Request-ID"}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if origin == "" || !opts.originAllowed(origin) {
+				if origin != "" {
+					t.logger().Debug("CORS origin not allowed", "origin", origin, "path", r.URL.Path)
+				}
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if opts.AllowCredentials || !containsFold(opts.AllowedOrigins, "*") {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+			if opts.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if len(opts.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			if !containsFold(methods, r.Header.Get("Access-Control-Request-Method")) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+			if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				for _, header := range strings.Split(requested, ",") {
+					if header = strings.TrimSpace(header); !containsFold(headers, "*") && !containsFold(headers, header) {
+						w.WriteHeader(http.StatusNoContent)
+						return
+					}
+				}
+				w.Header().Set("Access-Control-Allow-Headers", requested)
+			}
+
+			if opts.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// originAllowed reports whether origin may make cross-origin requests.
+func (opts CORSOptions) originAllowed(origin string) bool {
+	for _, allowed := range opts.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if prefix, suffix, found := strings.Cut(strings.ToLower(allowed), "*"); found {
+			o := strings.ToLower(origin)
+			if len(o) > len(prefix)+len(suffix) && strings.HasPrefix(o, prefix) && strings.HasSuffix(o, suffix) {
+				return true
+			}
+		}
+	}
+	return opts.AllowOriginFunc != nil && opts.AllowOriginFunc(origin)
+}
+
+// containsFold reports whether list contains s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
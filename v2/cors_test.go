@@ -0,0 +1,174 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var corsTests = []struct {
+	name                string
+	options             CORSOptions
+	method              string
+	headers             map[string]string
+	expectedStatus      int
+	expectedOrigin      string
+	expectedCredentials bool
+	expectNext          bool
+}{
+	{
+		name:           "no origin",
+		options:        CORSOptions{AllowedOrigins: []string{"https://example.com"}},
+		method:         "GET",
+		expectedStatus: http.StatusOK,
+		expectNext:     true,
+	},
+	{
+		name:           "allowed origin",
+		options:        CORSOptions{AllowedOrigins: []string{"https://example.com"}},
+		method:         "GET",
+		headers:        map[string]string{"Origin": "https://example.com"},
+		expectedStatus: http.StatusOK,
+		expectedOrigin: "https://example.com",
+		expectNext:     true,
+	},
+	{
+		name:           "disallowed origin",
+		options:        CORSOptions{AllowedOrigins: []string{"https://example.com"}},
+		method:         "GET",
+		headers:        map[string]string{"Origin": "https://evil.com"},
+		expectedStatus: http.StatusOK,
+		expectNext:     true,
+	},
+	{
+		name:           "wildcard subdomain",
+		options:        CORSOptions{AllowedOrigins: []string{"https://*.example.com"}},
+		method:         "GET",
+		headers:        map[string]string{"Origin": "https://api.example.com"},
+		expectedStatus: http.StatusOK,
+		expectedOrigin: "https://api.example.com",
+		expectNext:     true,
+	},
+	{
+		name:           "wildcard does not match suffix trick",
+		options:        CORSOptions{AllowedOrigins: []string{"https://*.example.com"}},
+		method:         "GET",
+		headers:        map[string]string{"Origin": "https://example.com.evil.com"},
+		expectedStatus: http.StatusOK,
+		expectNext:     true,
+	},
+	{
+		name:           "any origin",
+		options:        CORSOptions{AllowedOrigins: []string{"*"}},
+		method:         "GET",
+		headers:        map[string]string{"Origin": "https://anything.com"},
+		expectedStatus: http.StatusOK,
+		expectedOrigin: "*",
+		expectNext:     true,
+	},
+	{
+		name:                "any origin with credentials",
+		options:             CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		method:              "GET",
+		headers:             map[string]string{"Origin": "https://anything.com"},
+		expectedStatus:      http.StatusOK,
+		expectedOrigin:      "https://anything.com",
+		expectedCredentials: true,
+		expectNext:          true,
+	},
+	{
+		name:           "origin callback",
+		options:        CORSOptions{AllowOriginFunc: func(origin string) bool { return strings.HasSuffix(origin, ".test") }},
+		method:         "GET",
+		headers:        map[string]string{"Origin": "http://app.test"},
+		expectedStatus: http.StatusOK,
+		expectedOrigin: "http://app.test",
+		expectNext:     true,
+	},
+	{
+		name:           "preflight",
+		options:        CORSOptions{AllowedOrigins: []string{"https://example.com"}},
+		method:         "OPTIONS",
+		headers:        map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "PUT", "Access-Control-Request-Headers": "content-type"},
+		expectedStatus: http.StatusNoContent,
+		expectedOrigin: "https://example.com",
+	},
+	{
+		name:           "preflight disallowed header",
+		options:        CORSOptions{AllowedOrigins: []string{"https://example.com"}},
+		method:         "OPTIONS",
+		headers:        map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "PUT", "Access-Control-Request-Headers": "x-secret"},
+		expectedStatus: http.StatusNoContent,
+		expectedOrigin: "https://example.com",
+	},
+}
+
+func TestTools_CORS(t *testing.T) {
+	var testTools Tools
+
+	for _, test := range corsTests {
+		called := false
+		handler := testTools.CORS(test.options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+
+		req := httptest.NewRequest(test.method, "/", nil)
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != test.expectedStatus {
+			t.Errorf("%s: wrong status code; expected %d but got %d", test.name, test.expectedStatus, rr.Code)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != test.expectedOrigin {
+			t.Errorf("%s: wrong allowed origin; expected %q but got %q", test.name, test.expectedOrigin, got)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Credentials") == "true"; got != test.expectedCredentials {
+			t.Errorf("%s: wrong allow credentials; expected %t", test.name, test.expectedCredentials)
+		}
+		if called != test.expectNext {
+			t.Errorf("%s: expected next handler called to be %t", test.name, test.expectNext)
+		}
+	}
+}
+
+func TestTools_CORSPreflightHeaders(t *testing.T) {
+	var testTools Tools
+
+	handler := testTools.CORS(CORSOptions{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedMethods: []string{"GET", "PUT"},
+		MaxAge:         10 * time.Minute,
+	})(http.NotFoundHandler())
+
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type, Authorization")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Access-Control-Allow-Methods"); got != "GET, PUT" {
+		t.Error("wrong allowed methods", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, Authorization" {
+		t.Error("wrong allowed headers", got)
+	}
+	if got := rr.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Error("wrong max age", got)
+	}
+
+	// a method which is not allowed gets no CORS approval
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Error("expected no allowed methods for a disallowed method")
+	}
+}
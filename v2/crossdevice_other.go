@@ -0,0 +1,13 @@
+//go:build !windows && !plan9
+
+package toolkit
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isCrossDevice reports whether err is the error of renaming a file to another device.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,8 @@
+//go:build plan9
+
+package toolkit
+
+// isCrossDevice reports false, as renames on this platform fail the same way for any other directory.
+func isCrossDevice(err error) bool {
+	return false
+}
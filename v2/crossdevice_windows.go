@@ -0,0 +1,16 @@
+//go:build windows
+
+package toolkit
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errorNotSameDevice is the ERROR_NOT_SAME_DEVICE error of MoveFileEx.
+const errorNotSameDevice syscall.Errno = 17
+
+// isCrossDevice reports whether err is the error of renaming a file to another volume.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
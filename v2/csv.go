@@ -0,0 +1,356 @@
+package toolkit
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidCSV is returned by ImportCSV for files which can't be imported at all, such as when
+	// they are badly formed or lack a required column.
+	ErrInvalidCSV = errors.New("invalid CSV file")
+	// ErrCSVTooManyRows is returned by ImportCSV for files with more rows than CSVOptions.MaxRows.
+	ErrCSVTooManyRows = errors.New("the CSV file has too many rows")
+)
+
+// CSVOptions is the type used to configure ImportCSV.
+type CSVOptions struct {
+	// Comma is the field delimiter. Defaults to a comma.
+	Comma rune
+	// MaxRows is the largest number of rows imported, the header excluded. Defaults to 10000.
+	MaxRows int
+	// Location is the time zone of times without one. Defaults to UTC.
+	Location *time.Location
+	// DisallowUnknownColumns makes columns which match no field an error.
+	DisallowUnknownColumns bool
+	// Validate, if set, is called with a pointer to each row once decoded. ValidationErrors it returns
+	// are reported by field, which is matched to its column; other errors are reported for the row.
+	Validate func(row any) error
+}
+
+// CSVRowError is an error found in one row of a CSV file by ImportCSV.
+type CSVRowError struct {
+	// Row is the line of the file, counting the header as row 1, as spreadsheets do.
+	Row int `json:"row"`
+	// Column is the header of the column the error is about, if any.
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// CSVImportReport is the outcome of ImportCSV, which may be sent to the client with WriteJSON.
+type CSVImportReport struct {
+	// Rows is the number of rows read, the header excluded.
+	Rows int `json:"rows"`
+	// Imported is the number of rows without errors, added to the slice.
+	Imported int           `json:"imported"`
+	Errors   []CSVRowError `json:"errors,omitempty"`
+}
+
+// csvColumn is a column of a CSV file mapped to a field of the row struct.
+type csvColumn struct {
+	header   string
+	field    int
+	required bool
+}
+
+// ImportCSV reads the CSV file in r, whose first row is a header, into dst, a pointer to a slice of
+// structs (or of pointers to structs). Columns match fields by their csv tag, as in `csv:"email"`, or
+// by name ignoring case; `csv:"email,required"` makes the column, and a value in it, required, and
+// `csv:"-"` skips a field. Values are converted to the type of their field: strings, numbers, bools,
+// durations, times (as ParseTimeFlexible reads them), pointers, which are left nil when empty, and
+// encoding.TextUnmarshaler implementations.
+//
+// Rows which can't be converted, or fail CSVOptions.Validate, are left out of dst and listed in the
+// report, so that the whole file can be checked at once; the error is only set when the file can't be
+// imported at all.
+func ImportCSV(r io.Reader, dst any, opts ...CSVOptions) (*CSVImportReport, error) {
+	var options CSVOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.MaxRows == 0 {
+		options.MaxRows = 10000
+	}
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+
+	slice, elemType, isPointer, err := structSlice(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	cr := csv.NewReader(r)
+	if options.Comma != 0 {
+		cr.Comma = options.Comma
+	}
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	row := 0
+	return importRecords(func() (int, []string, error) {
+		record, err := cr.Read()
+		if err != nil && err != io.EOF {
+			err = fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+		}
+		row++
+		return row, record, err
+	}, slice, elemType, isPointer, options)
+}
+
+// importRecords imports the records returned by next, along with their row number, until it returns
+// io.EOF, into slice, whose elements are elemType structs, or pointers to them; the first record is
+// the header.
+func importRecords(next func() (int, []string, error), slice reflect.Value, elemType reflect.Type, isPointer bool, options CSVOptions) (*CSVImportReport, error) {
+	_, header, err := next()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidCSV)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	columns, err := mapCSVColumns(header, elemType, options.DisallowUnknownColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CSVImportReport{}
+	for {
+		row, record, err := next()
+		if err == io.EOF {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+
+		report.Rows++
+		if report.Rows > options.MaxRows {
+			return report, ErrCSVTooManyRows
+		}
+
+		item := reflect.New(elemType)
+		rowErrors := decodeCSVRow(item.Elem(), record, columns, row, options.Location)
+		if len(rowErrors) == 0 && options.Validate != nil {
+			rowErrors = csvValidationErrors(options.Validate(item.Interface()), row, elemType, columns)
+		}
+		if len(rowErrors) > 0 {
+			report.Errors = append(report.Errors, rowErrors...)
+			continue
+		}
+
+		if !isPointer {
+			item = item.Elem()
+		}
+		slice.Set(reflect.Append(slice, item))
+		report.Imported++
+	}
+}
+
+// structSlice returns the slice dst points to, the struct type of its elements, and whether they are
+// pointers to it.
+func structSlice(dst any) (slice reflect.Value, elemType reflect.Type, isPointer bool, err error) {
+	slice = reflect.ValueOf(dst)
+	if slice.Kind() != reflect.Pointer || slice.Elem().Kind() != reflect.Slice {
+		return slice, nil, false, errors.New("dst must be a pointer to a slice of structs")
+	}
+	slice = slice.Elem()
+	elemType = slice.Type().Elem()
+	if elemType.Kind() == reflect.Pointer {
+		elemType, isPointer = elemType.Elem(), true
+	}
+	if elemType.Kind() != reflect.Struct {
+		return slice, nil, false, errors.New("dst must be a pointer to a slice of structs")
+	}
+	return slice, elemType, isPointer, nil
+}
+
+// mapCSVColumns maps the columns named in header to the fields of the struct type t.
+func mapCSVColumns(header []string, t reflect.Type, disallowUnknown bool) ([]*csvColumn, error) {
+	columns := make([]*csvColumn, len(header))
+	var missing []string
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, flags, _ := strings.Cut(sf.Tag.Get("csv"), ",")
+		if !sf.IsExported() || name == "-" {
+			continue
+		}
+
+		found := false
+		for j, h := range header {
+			h = strings.TrimSpace(h)
+			if (name != "" && h == name) || (name == "" && strings.EqualFold(h, sf.Name)) {
+				columns[j] = &csvColumn{header: h, field: i, required: flags == "required"}
+				found = true
+				break
+			}
+		}
+		if !found && flags == "required" {
+			if name == "" {
+				name = sf.Name
+			}
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: missing required columns %s", ErrInvalidCSV, strings.Join(missing, ", "))
+	}
+	if disallowUnknown {
+		for j, column := range columns {
+			if column == nil {
+				return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidCSV, header[j])
+			}
+		}
+	}
+	return columns, nil
+}
+
+// csvFields returns the headers of the columns of the struct type t, named by the csv tags of its fields,
+// or their names, and the indexes of the fields.
+func csvFields(t reflect.Type) (headers []string, fields []int) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("csv"), ",")
+		if !sf.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		headers = append(headers, name)
+		fields = append(fields, i)
+	}
+	return headers, fields
+}
+
+// csvValues returns the values of fields of item, a struct or a pointer to one, nil pointers being nil.
+func csvValues(item reflect.Value, fields []int) []any {
+	item = reflect.Indirect(item)
+	values := make([]any, len(fields))
+	if !item.IsValid() {
+		return values
+	}
+	for j, field := range fields {
+		value := item.Field(field)
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		values[j] = value.Interface()
+	}
+	return values
+}
+
+// decodeCSVRow sets the fields of item from record, returning the errors found in row.
+func decodeCSVRow(item reflect.Value, record []string, columns []*csvColumn, row int, loc *time.Location) []CSVRowError {
+	var errs []CSVRowError
+	for j, column := range columns {
+		if column == nil {
+			continue
+		}
+		value := ""
+		if j < len(record) {
+			value = strings.TrimSpace(record[j])
+		}
+		if value == "" {
+			if column.required {
+				errs = append(errs, CSVRowError{Row: row, Column: column.header, Message: "is required"})
+			}
+			continue
+		}
+		if err := setCSVValue(item.Field(column.field), value, loc); err != nil {
+			errs = append(errs, CSVRowError{Row: row, Column: column.header, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// setCSVValue sets field from the cell value s.
+func setCSVValue(field reflect.Value, s string, loc *time.Location) error {
+	if field.Kind() == reflect.Pointer {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setCSVValue(ptr.Elem(), s, loc); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	switch {
+	case field.Type() == reflect.TypeOf(time.Time{}):
+		t, err := ParseTimeFlexible(s, loc)
+		if err != nil {
+			return errors.New("must be a valid date or time")
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	case field.Kind() == reflect.Bool:
+		switch strings.ToLower(s) {
+		case "1", "true", "yes", "y", "on":
+			field.SetBool(true)
+		case "0", "false", "no", "n", "off":
+			field.SetBool(false)
+		default:
+			return errors.New("must be true or false")
+		}
+		return nil
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	if err := setConfigValue(field, s); err != nil {
+		var numError *strconv.NumError
+		switch {
+		case errors.As(err, &numError) && errors.Is(err, strconv.ErrRange):
+			return errors.New("is out of range")
+		case errors.As(err, &numError):
+			return errors.New("must be a number")
+		}
+		return err
+	}
+	return nil
+}
+
+// csvValidationErrors turns the error returned by CSVOptions.Validate for row into row errors,
+// naming the column of the fields of ValidationErrors.
+func csvValidationErrors(err error, row int, t reflect.Type, columns []*csvColumn) []CSVRowError {
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []CSVRowError{{Row: row, Message: err.Error()}}
+	}
+
+	var errs []CSVRowError
+	for field, messages := range validationErrors {
+		column := field
+		for _, c := range columns {
+			if c != nil && (strings.EqualFold(t.Field(c.field).Name, field) || c.header == field) {
+				column = c.header
+				break
+			}
+		}
+		for _, message := range messages {
+			errs = append(errs, CSVRowError{Row: row, Column: column, Message: message})
+		}
+	}
+	// by column, so that reports are stable
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Column < errs[j].Column })
+	return errs
+}
@@ -0,0 +1,124 @@
+package toolkit
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type csvContact struct {
+	Email    string    `csv:"email,required"`
+	Name     string    `csv:"full name"`
+	Age      int       `csv:"age"`
+	Active   bool      `csv:"active"`
+	Joined   time.Time `csv:"joined"`
+	Score    *float64  `csv:"score"`
+	Notes    string    `csv:"-"`
+	Country  string
+	Reminder *time.Time `csv:"reminder"`
+}
+
+func TestImportCSV(t *testing.T) {
+	data := "\ufeffemail,full name,age,active,joined,score,country,ignored\n" +
+		"jane@example.com,Jane Doe,34,yes,2024-03-01,9.5,FR,x\n" +
+		",No Email,20,no,2024-03-01,,US,\n" +
+		"bob@example.com,Bob,old,maybe,someday,1,UK,\n" +
+		"ann@example.com,Ann,99999999999999999999,1,2024-03-02T10:00:00+02:00,,DE,\n" +
+		"\"quoted@example.com\",\"Smith, John\",40,false,2024-01-31,,,\n"
+
+	var contacts []csvContact
+	report, err := ImportCSV(strings.NewReader(data), &contacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Rows != 5 || report.Imported != 2 || len(contacts) != 2 {
+		t.Fatalf("wrong report %+v, %d contacts", report, len(contacts))
+	}
+	jane := contacts[0]
+	if jane.Email != "jane@example.com" || jane.Name != "Jane Doe" || jane.Age != 34 || !jane.Active ||
+		!jane.Joined.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) || jane.Score == nil || *jane.Score != 9.5 ||
+		jane.Country != "FR" || jane.Reminder != nil {
+		t.Errorf("wrong contact %+v", jane)
+	}
+	if contacts[1].Name != "Smith, John" || contacts[1].Score != nil {
+		t.Errorf("wrong contact %+v", contacts[1])
+	}
+
+	expected := []CSVRowError{
+		{Row: 3, Column: "email", Message: "is required"},
+		{Row: 4, Column: "age", Message: "must be a number"},
+		{Row: 4, Column: "active", Message: "must be true or false"},
+		{Row: 4, Column: "joined", Message: "must be a valid date or time"},
+		{Row: 5, Column: "age", Message: "is out of range"},
+	}
+	if !reflect.DeepEqual(report.Errors, expected) {
+		t.Errorf("expected %+v, got %+v", expected, report.Errors)
+	}
+}
+
+func TestImportCSV_Validate(t *testing.T) {
+	data := "email,age\njane@example.com,34\nnot-an-email,12\nbob@example.com,200\n"
+
+	var contacts []*csvContact
+	report, err := ImportCSV(strings.NewReader(data), &contacts, CSVOptions{
+		Validate: func(row any) error {
+			c := row.(*csvContact)
+			errs := ValidationErrors{}
+			if !IsValidEmail(c.Email) {
+				errs.Add("Email", "invalid email address")
+			}
+			if c.Age < 18 {
+				errs.Add("age", "must be an adult")
+			}
+			if c.Age > 150 {
+				return errors.New("this row looks wrong")
+			}
+			if len(errs) > 0 {
+				return errs
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []CSVRowError{
+		{Row: 3, Column: "age", Message: "must be an adult"},
+		{Row: 3, Column: "email", Message: "invalid email address"},
+		{Row: 4, Message: "this row looks wrong"},
+	}
+	if len(contacts) != 1 || contacts[0].Email != "jane@example.com" || !reflect.DeepEqual(report.Errors, expected) {
+		t.Errorf("wrong import %v, expected %+v, got %+v", contacts, expected, report.Errors)
+	}
+}
+
+func TestImportCSV_Errors(t *testing.T) {
+	var contacts []csvContact
+
+	tests := []struct {
+		name    string
+		data    string
+		options CSVOptions
+		errorIs error
+	}{
+		{name: "missing required column", data: "name,age\nJane,3\n", errorIs: ErrInvalidCSV},
+		{name: "unknown column", data: "email,shoe size\njane@example.com,38\n", options: CSVOptions{DisallowUnknownColumns: true}, errorIs: ErrInvalidCSV},
+		{name: "badly formed", data: "email\n\"jane@example.com\n", errorIs: ErrInvalidCSV},
+		{name: "empty", data: "", errorIs: ErrInvalidCSV},
+		{name: "too many rows", data: "email\na@example.com\nb@example.com\nc@example.com\n", options: CSVOptions{MaxRows: 2}, errorIs: ErrCSVTooManyRows},
+		{name: "semicolons", data: "email;age\njane@example.com;34\n", options: CSVOptions{Comma: ';'}},
+	}
+	for _, test := range tests {
+		if _, err := ImportCSV(strings.NewReader(test.data), &contacts, test.options); !errors.Is(err, test.errorIs) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.errorIs, err)
+		}
+	}
+
+	if _, err := ImportCSV(strings.NewReader("email\n"), contacts); err == nil {
+		t.Error("expected an error for a slice which isn't a pointer")
+	}
+}
@@ -0,0 +1,143 @@
+// Package db holds the database/sql boilerplate applications otherwise all write: opening a database
+// which may not be up yet, running functions in transactions, nullable columns which encode to JSON
+// as a value or null, and applying SQL migrations.
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// retryDelay is the delay before the second attempt of OpenWithRetry, doubled after each attempt.
+var retryDelay = time.Second
+
+// maxRetryDelay caps the delay between attempts of OpenWithRetry.
+const maxRetryDelay = 30 * time.Second
+
+// OpenWithRetry opens the database dsn with driver, and pings it, up to attempts times, waiting one
+// second before the second attempt, then twice as long after each one, up to 30 seconds. This lets an
+// application start alongside its database, as containers often do, instead of failing right away.
+func OpenWithRetry(driver, dsn string, attempts int) (*sql.DB, error) {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return db, nil
+		}
+		if attempt == attempts {
+			break
+		}
+
+		time.Sleep(delay)
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+
+	_ = db.Close()
+	return nil, fmt.Errorf("database unreachable after %d attempts: %w", attempts, err)
+}
+
+// WithTx runs fn in a transaction, which is committed if fn returns nil, and rolled back if it returns
+// an error or panics, the panic being raised again once the transaction is rolled back.
+func WithTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// jsonNull is the JSON encoding of null values.
+var jsonNull = []byte("null")
+
+// NullString is a sql.NullString encoded to JSON as a string, or null when it isn't valid.
+type NullString struct {
+	sql.NullString
+}
+
+// NewNullString returns a valid NullString holding s.
+func NewNullString(s string) NullString {
+	return NullString{sql.NullString{String: s, Valid: true}}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (ns NullString) MarshalJSON() ([]byte, error) {
+	if !ns.Valid {
+		return jsonNull, nil
+	}
+	return json.Marshal(ns.String)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (ns *NullString) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, jsonNull) {
+		*ns = NullString{}
+		return nil
+	}
+	if err := json.Unmarshal(data, &ns.String); err != nil {
+		return err
+	}
+	ns.Valid = true
+	return nil
+}
+
+// NullTime is a sql.NullTime encoded to JSON as an RFC 3339 time, or null when it isn't valid.
+type NullTime struct {
+	sql.NullTime
+}
+
+// NewNullTime returns a valid NullTime holding t.
+func NewNullTime(t time.Time) NullTime {
+	return NullTime{sql.NullTime{Time: t, Valid: true}}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (nt NullTime) MarshalJSON() ([]byte, error) {
+	if !nt.Valid {
+		return jsonNull, nil
+	}
+	return json.Marshal(nt.Time)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (nt *NullTime) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, jsonNull) {
+		*nt = NullTime{}
+		return nil
+	}
+	if err := json.Unmarshal(data, &nt.Time); err != nil {
+		return err
+	}
+	nt.Valid = true
+	return nil
+}
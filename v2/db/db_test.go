@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDriver is a database/sql driver recording the statements run, other than those on the migrations
+// tables, whose state it keeps. Its connections fail to open until failures reaches 0.
+type fakeDriver struct {
+	mu       sync.Mutex
+	failures int
+	log      []string
+	versions map[int64]bool
+	lockedAt int64
+}
+
+func (d *fakeDriver) record(event string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, event)
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.failures > 0 {
+		d.failures--
+		return nil, errors.New("connection refused")
+	}
+	return &fakeConn{driver: d}, nil
+}
+
+// exec runs query, which fails if it contains FAIL.
+func (d *fakeDriver) exec(query string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var n int64
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations_lock"):
+		if d.lockedAt != 0 {
+			return errors.New("duplicate key")
+		}
+		_, _ = fmt.Sscanf(query, "INSERT INTO schema_migrations_lock (id, locked_at) VALUES (1, %d)", &d.lockedAt)
+	case query == "DELETE FROM schema_migrations_lock WHERE id = 1":
+		d.lockedAt = 0
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations_lock WHERE locked_at < "):
+		_, _ = fmt.Sscanf(query, "DELETE FROM schema_migrations_lock WHERE locked_at < %d", &n)
+		if d.lockedAt < n {
+			d.lockedAt = 0
+		}
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations (version)"):
+		_, _ = fmt.Sscanf(query, "INSERT INTO schema_migrations (version) VALUES (%d)", &n)
+		d.versions[n] = true
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations WHERE version"):
+		_, _ = fmt.Sscanf(query, "DELETE FROM schema_migrations WHERE version = %d", &n)
+		delete(d.versions, n)
+	case strings.Contains(query, "FAIL"):
+		return errors.New("syntax error")
+	default:
+		d.log = append(d.log, strings.TrimSpace(query))
+	}
+	return nil
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.driver.record("begin")
+	return &fakeTx{conn: c}, nil
+}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (tx *fakeTx) Commit() error   { tx.conn.driver.record("commit"); return nil }
+func (tx *fakeTx) Rollback() error { tx.conn.driver.record("rollback"); return nil }
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.conn.driver.exec(s.query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// Query only supports reading the versions of the migrations table.
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.query != "SELECT version FROM schema_migrations" {
+		return nil, errors.New("not supported")
+	}
+	d := s.conn.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rows := &fakeRows{}
+	for version := range d.versions {
+		rows.versions = append(rows.versions, version)
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	versions []int64
+}
+
+func (r *fakeRows) Columns() []string { return []string{"version"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.versions) == 0 {
+		return io.EOF
+	}
+	dest[0], r.versions = r.versions[0], r.versions[1:]
+	return nil
+}
+
+var (
+	registerOnce sync.Once
+	testDriver   = &fakeDriver{}
+)
+
+// openTestDB returns a database of testDriver, whose connections fail to open failures times.
+func openTestDB(failures int) (*sql.DB, error) {
+	registerOnce.Do(func() { sql.Register("fake", testDriver) })
+	testDriver.mu.Lock()
+	testDriver.failures, testDriver.log, testDriver.versions, testDriver.lockedAt = failures, nil, make(map[int64]bool), 0
+	testDriver.mu.Unlock()
+
+	retryDelay = time.Millisecond
+	return OpenWithRetry("fake", "test", 3)
+}
+
+func TestOpenWithRetry(t *testing.T) {
+	db, err := openTestDB(2)
+	if err != nil {
+		t.Fatal("expected the third attempt to succeed, got", err)
+	}
+	_ = db.Close()
+
+	if _, err = openTestDB(3); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Error("expected the last error after 3 attempts, got", err)
+	}
+
+	if _, err = OpenWithRetry("missing", "test", 3); err == nil {
+		t.Error("expected an error for an unknown driver")
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	db, err := openTestDB(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	err = WithTx(ctx, db, func(tx *sql.Tx) error {
+		_, err := tx.Exec("insert 1")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("out of stock")
+	err = WithTx(ctx, db, func(tx *sql.Tx) error {
+		_, _ = tx.Exec("insert 2")
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Error("expected the error of fn, got", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic to be raised again")
+			}
+		}()
+		_ = WithTx(ctx, db, func(tx *sql.Tx) error {
+			panic("boom")
+		})
+	}()
+
+	expected := "begin,insert 1,commit,begin,insert 2,rollback,begin,rollback"
+	if log := strings.Join(testDriver.log, ","); log != expected {
+		t.Errorf("expected %s, got %s", expected, log)
+	}
+}
+
+func TestNullJSON(t *testing.T) {
+	joined := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	type user struct {
+		Nickname NullString `json:"nickname"`
+		Deleted  NullTime   `json:"deleted"`
+	}
+
+	tests := []struct {
+		value    user
+		expected string
+	}{
+		{value: user{}, expected: `{"nickname":null,"deleted":null}`},
+		{value: user{Nickname: NewNullString(""), Deleted: NewNullTime(joined)}, expected: `{"nickname":"","deleted":"2024-03-01T10:00:00Z"}`},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(test.value)
+		if err != nil || string(data) != test.expected {
+			t.Errorf("expected %s, got %s (%v)", test.expected, data, err)
+		}
+
+		var decoded user
+		if err = json.Unmarshal(data, &decoded); err != nil || decoded.Nickname != test.value.Nickname ||
+			decoded.Deleted.Valid != test.value.Deleted.Valid || !decoded.Deleted.Time.Equal(test.value.Deleted.Time) {
+			t.Errorf("expected %+v, got %+v (%v)", test.value, decoded, err)
+		}
+	}
+
+	var u user
+	if err := json.Unmarshal([]byte(`{"nickname":12}`), &u); err == nil {
+		t.Error("expected an error for a number")
+	}
+}
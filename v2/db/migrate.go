@@ -0,0 +1,298 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMissingDownMigration is returned by Migrations.Down for versions without a .down.sql file.
+var ErrMissingDownMigration = errors.New("missing down migration")
+
+// Migrations applies the SQL migrations held in an fs.FS, typically embedded with go:embed, and records
+// those applied in a table, schema_migrations by default.
+//
+// Migrations are files named after their version, a number, followed by a description, such as
+// 0001_create_users.up.sql, which is applied by Up, and 0001_create_users.down.sql, which reverts it in
+// Down; a file ending with .sql only is an up migration. Each migration runs in a transaction, along with
+// the update of the table, so the driver must accept several statements in one Exec if a file holds
+// several, and databases which commit DDL statements implicitly, such as MySQL, may leave a failed
+// migration half applied.
+type Migrations struct {
+	FS fs.FS
+	// Table is the table recording the versions applied. Defaults to schema_migrations.
+	Table string
+	// Lock, if set, acquires a lock held on conn while migrations run, such as an advisory lock of
+	// PostgreSQL or MySQL, so that instances starting together don't apply the same migrations. The
+	// default is a row of the table Table + "_lock", which is deemed stale after StaleLock.
+	Lock func(ctx context.Context, conn *sql.Conn) (unlock func() error, err error)
+	// StaleLock is how long the default lock may be held before it is deemed left over by a process
+	// which crashed. Defaults to 15 minutes.
+	StaleLock time.Duration
+}
+
+// migration is a migration file, either up or down.
+type migration struct {
+	version int64
+	name    string
+}
+
+// migrationName matches the names of migration files: a version, an optional description, and .up.sql,
+// .down.sql or .sql.
+var migrationName = regexp.MustCompile(`^(\d+)([^/]*?)(\.up|\.down)?\.sql$`)
+
+// identifier matches the table names Migrations accepts, as they can't be passed as query arguments.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// files returns the up and down migrations of m.FS, by version, in order of version.
+func (m *Migrations) files() (up, down map[int64]migration, versions []int64, err error) {
+	entries, err := fs.ReadDir(m.FS, ".")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	up, down = make(map[int64]migration), make(map[int64]migration)
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid migration version %s", entry.Name())
+		}
+
+		files := up
+		if match[3] == ".down" {
+			files = down
+		}
+		if other, ok := files[version]; ok {
+			return nil, nil, nil, fmt.Errorf("migrations %s and %s have the same version", other.name, entry.Name())
+		}
+		files[version] = migration{version: version, name: entry.Name()}
+	}
+
+	for version := range up {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return up, down, versions, nil
+}
+
+func (m *Migrations) table() (string, error) {
+	table := m.Table
+	if table == "" {
+		table = "schema_migrations"
+	}
+	if !identifier.MatchString(table) {
+		return "", fmt.Errorf("invalid migrations table %q", table)
+	}
+	return table, nil
+}
+
+// Up applies the migrations not applied yet, in order of version, and returns the names of their files.
+func (m *Migrations) Up(ctx context.Context, db *sql.DB) (applied []string, err error) {
+	up, _, versions, err := m.files()
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.locked(ctx, db, func(conn *sql.Conn, table string, done map[int64]bool) error {
+		for _, version := range versions {
+			if done[version] {
+				continue
+			}
+			record := fmt.Sprintf("INSERT INTO %s (version) VALUES (%d)", table, version)
+			if err := m.apply(ctx, conn, up[version], record); err != nil {
+				return err
+			}
+			applied = append(applied, up[version].name)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps migrations applied, in reverse order of version, and returns the names of
+// the files run.
+func (m *Migrations) Down(ctx context.Context, db *sql.DB, steps int) (reverted []string, err error) {
+	_, down, _, err := m.files()
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.locked(ctx, db, func(conn *sql.Conn, table string, done map[int64]bool) error {
+		var versions []int64
+		for version := range done {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for i := 0; i < steps && i < len(versions); i++ {
+			file, ok := down[versions[i]]
+			if !ok {
+				return fmt.Errorf("%w for version %d", ErrMissingDownMigration, versions[i])
+			}
+			record := fmt.Sprintf("DELETE FROM %s WHERE version = %d", table, versions[i])
+			if err := m.apply(ctx, conn, file, record); err != nil {
+				return err
+			}
+			reverted = append(reverted, file.name)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Version returns the highest version applied, or 0 if none is.
+func (m *Migrations) Version(ctx context.Context, db *sql.DB) (int64, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	table, err := m.table()
+	if err != nil {
+		return 0, err
+	}
+	done, err := appliedVersions(ctx, conn, table)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int64
+	for v := range done {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// locked runs fn on a connection holding the lock, with the versions applied.
+func (m *Migrations) locked(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn, table string, done map[int64]bool) error) (err error) {
+	table, err := m.table()
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version BIGINT NOT NULL PRIMARY KEY)", table)); err != nil {
+		return err
+	}
+
+	lock := m.Lock
+	if lock == nil {
+		lock = m.tableLock(table + "_lock")
+	}
+	unlock, err := lock(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("migrations lock: %w", err)
+	}
+	defer func() {
+		if unlockErr := unlock(); err == nil && unlockErr != nil {
+			err = fmt.Errorf("migrations unlock: %w", unlockErr)
+		}
+	}()
+
+	done, err := appliedVersions(ctx, conn, table)
+	if err != nil {
+		return err
+	}
+	return fn(conn, table, done)
+}
+
+// tableLock returns the default lock, a row of table, waiting for it to be released, or to be stale.
+func (m *Migrations) tableLock(table string) func(ctx context.Context, conn *sql.Conn) (func() error, error) {
+	stale := m.StaleLock
+	if stale <= 0 {
+		stale = 15 * time.Minute
+	}
+
+	return func(ctx context.Context, conn *sql.Conn) (func() error, error) {
+		create := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INTEGER NOT NULL PRIMARY KEY, locked_at BIGINT NOT NULL)", table)
+		if _, err := conn.ExecContext(ctx, create); err != nil {
+			return nil, err
+		}
+
+		for {
+			now := time.Now().Unix()
+			if _, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE locked_at < %d", table, now-int64(stale.Seconds()))); err != nil {
+				return nil, err
+			}
+			// the insert fails on the primary key while the lock is held elsewhere
+			_, err := conn.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id, locked_at) VALUES (1, %d)", table, now))
+			if err == nil {
+				return func() error {
+					_, err := conn.ExecContext(context.Background(), fmt.Sprintf("DELETE FROM %s WHERE id = 1", table))
+					return err
+				}, nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("%w (%v)", ctx.Err(), err)
+			case <-time.After(lockRetryDelay):
+			}
+		}
+	}
+}
+
+// lockRetryDelay is how long the default lock of Migrations waits before trying again to acquire it.
+var lockRetryDelay = 500 * time.Millisecond
+
+// appliedVersions returns the versions recorded in table.
+func appliedVersions(ctx context.Context, conn *sql.Conn, table string) (map[int64]bool, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version FROM %s", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		done[version] = true
+	}
+	return done, rows.Err()
+}
+
+// apply runs the migration file, then the statement record updating the migrations table, in a transaction.
+func (m *Migrations) apply(ctx context.Context, conn *sql.Conn, file migration, record string) error {
+	content, err := fs.ReadFile(m.FS, file.name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(content)) != "" {
+		if _, err = tx.ExecContext(ctx, string(content)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %s: %w", file.name, err)
+		}
+	}
+	if _, err = tx.ExecContext(ctx, record); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("migration %s: %w", file.name, err)
+	}
+	return tx.Commit()
+}
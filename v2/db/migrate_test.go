@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var testMigrations = fstest.MapFS{
+	"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users")},
+	"0001_create_users.down.sql": {Data: []byte("DROP TABLE users")},
+	"0002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email")},
+	"0002_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP email")},
+	"10_seed.sql":                {Data: []byte("INSERT INTO users")},
+	"readme.md":                  {Data: []byte("not a migration")},
+}
+
+func TestMigrations(t *testing.T) {
+	db, err := openTestDB(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	m := &Migrations{FS: testMigrations}
+
+	applied, err := m.Up(ctx, db)
+	expected := "0001_create_users.up.sql,0002_add_email.up.sql,10_seed.sql"
+	if err != nil || strings.Join(applied, ",") != expected {
+		t.Fatalf("expected %s, got %v (%v)", expected, applied, err)
+	}
+	if version, _ := m.Version(ctx, db); version != 10 {
+		t.Errorf("expected version 10, got %d", version)
+	}
+
+	if applied, err = m.Up(ctx, db); err != nil || len(applied) != 0 {
+		t.Errorf("expected nothing to apply, got %v (%v)", applied, err)
+	}
+
+	if _, err = m.Down(ctx, db, 1); !errors.Is(err, ErrMissingDownMigration) {
+		t.Error("expected ErrMissingDownMigration for 10_seed.sql, got", err)
+	}
+
+	testDriver.versions = map[int64]bool{1: true, 2: true}
+	reverted, err := m.Down(ctx, db, 5)
+	if err != nil || strings.Join(reverted, ",") != "0002_add_email.down.sql,0001_create_users.down.sql" {
+		t.Errorf("wrong down migrations %v (%v)", reverted, err)
+	}
+	if version, _ := m.Version(ctx, db); version != 0 {
+		t.Errorf("expected version 0, got %d", version)
+	}
+	if testDriver.lockedAt != 0 {
+		t.Error("expected the lock to be released")
+	}
+
+	statements := strings.Join(testDriver.log, ",")
+	expectedStatements := "begin,CREATE TABLE users,commit,begin,ALTER TABLE users ADD email,commit,begin,INSERT INTO users,commit," +
+		"begin,ALTER TABLE users DROP email,commit,begin,DROP TABLE users,commit"
+	if statements != expectedStatements {
+		t.Errorf("expected %s, got %s", expectedStatements, statements)
+	}
+}
+
+func TestMigrations_Failure(t *testing.T) {
+	db, err := openTestDB(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m := &Migrations{FS: fstest.MapFS{
+		"1_ok.sql":     {Data: []byte("CREATE TABLE a")},
+		"2_broken.sql": {Data: []byte("FAIL")},
+		"3_later.sql":  {Data: []byte("CREATE TABLE c")},
+	}}
+	applied, err := m.Up(context.Background(), db)
+	if err == nil || !strings.Contains(err.Error(), "2_broken.sql") || len(applied) != 1 {
+		t.Errorf("expected the second migration to fail, got %v (%v)", applied, err)
+	}
+	if !testDriver.versions[1] || testDriver.versions[2] || testDriver.versions[3] {
+		t.Errorf("wrong versions recorded %v", testDriver.versions)
+	}
+
+	duplicates := &Migrations{FS: fstest.MapFS{"1_a.sql": {}, "01_b.up.sql": {}}}
+	if _, err = duplicates.Up(context.Background(), db); err == nil {
+		t.Error("expected an error for two migrations of the same version")
+	}
+
+	badTable := &Migrations{FS: testMigrations, Table: "users; DROP TABLE users"}
+	if _, err = badTable.Up(context.Background(), db); err == nil {
+		t.Error("expected an error for an invalid table name")
+	}
+}
+
+func TestMigrations_Lock(t *testing.T) {
+	db, err := openTestDB(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	lockRetryDelay = time.Millisecond
+
+	// held by another instance
+	testDriver.lockedAt = time.Now().Unix()
+	m := &Migrations{FS: testMigrations}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = m.Up(ctx, db); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected the lock to be waited for, got", err)
+	}
+
+	// left over by a crash
+	testDriver.lockedAt = time.Now().Add(-time.Hour).Unix()
+	if _, err = m.Up(context.Background(), db); err != nil {
+		t.Error("expected a stale lock to be taken over, got", err)
+	}
+
+	custom := &Migrations{FS: testMigrations, Lock: func(ctx context.Context, conn *sql.Conn) (func() error, error) {
+		return nil, errors.New("advisory lock unavailable")
+	}}
+	if _, err = custom.Up(context.Background(), db); err == nil || !strings.Contains(err.Error(), "advisory lock unavailable") {
+		t.Error("expected the error of the custom lock, got", err)
+	}
+}
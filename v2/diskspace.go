@@ -0,0 +1,34 @@
+package toolkit
+
+import "errors"
+
+// ErrInsufficientStorage is returned by UploadFiles when writing a file would leave less than
+// Tools.MinFreeDiskSpace bytes available. Handlers should respond with http.StatusInsufficientStorage (507).
+var ErrInsufficientStorage = errors.New("insufficient storage")
+
+// errDiskSpaceUnsupported is returned by freeDiskSpace on platforms where free space can't be determined.
+var errDiskSpaceUnsupported = errors.New("free disk space can not be determined on this platform")
+
+// checkFreeDiskSpace makes sure that writing size bytes to dir leaves at least MinFreeDiskSpace bytes available.
+// The check is skipped when MinFreeDiskSpace is not set, or when the platform can't report free space.
+func (t *Tools) checkFreeDiskSpace(dir string, size int64) error {
+	if t.MinFreeDiskSpace <= 0 {
+		return nil
+	}
+
+	free, err := freeDiskSpace(dir)
+	if errors.Is(err, errDiskSpaceUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if size < 0 {
+		size = 0
+	}
+	if free < uint64(size) || free-uint64(size) < uint64(t.MinFreeDiskSpace) {
+		return ErrInsufficientStorage
+	}
+	return nil
+}
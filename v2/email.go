@@ -0,0 +1,119 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// emailMXCacheTTL is how long CheckEmailMX remembers whether a domain can receive mail.
+const emailMXCacheTTL = time.Hour
+
+// lookupMX looks up the MX records of a domain; tests replace it.
+var lookupMX = net.DefaultResolver.LookupMX
+
+// lookupHost looks up the addresses of a domain, used when it has no MX records; tests replace it.
+var lookupHost = net.DefaultResolver.LookupHost
+
+// IsValidEmail reports whether email is a syntactically valid email address, with a domain which has
+// at least two labels.
+func IsValidEmail(email string) bool {
+	at := strings.LastIndexByte(email, '@')
+	return len(email) <= 254 && at >= 0 && at <= 64 && emailRegex.MatchString(email)
+}
+
+// NormalizeEmailOptions is the type used to choose how NormalizeEmail rewrites addresses.
+type NormalizeEmailOptions struct {
+	// StripPlusTags removes the tag after a "+" in the local part, as in "jane+news@example.com".
+	StripPlusTags bool
+	// StripGmailDots removes the dots from the local part of Gmail addresses, which Gmail ignores, and
+	// lowercases it. googlemail.com addresses become gmail.com ones.
+	StripGmailDots bool
+}
+
+// NormalizeEmail trims email and lowercases its domain, so that addresses can be compared and stored
+// consistently. With opts, it can also remove what mail providers ignore, so that one inbox isn't
+// signed up under several addresses.
+func NormalizeEmail(email string, opts ...NormalizeEmailOptions) string {
+	var o NormalizeEmailOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	email = strings.TrimSpace(email)
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], strings.ToLower(strings.TrimSuffix(email[at+1:], "."))
+
+	if o.StripPlusTags {
+		if i := strings.IndexByte(local, '+'); i > 0 {
+			local = local[:i]
+		}
+	}
+	if o.StripGmailDots && (domain == "gmail.com" || domain == "googlemail.com") {
+		local = strings.ToLower(strings.ReplaceAll(local, ".", ""))
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+// CheckEmailMX reports whether the domain of email can receive mail: it has MX records or, failing
+// that, an address, as RFC 5321 allows. Results are cached in Tools.Cache for an hour. An error is
+// returned when the lookup itself fails, such as on a timeout, rather than the domain being unknown;
+// callers usually let the address through then.
+func (t *Tools) CheckEmailMX(ctx context.Context, email string) (bool, error) {
+	if !IsValidEmail(email) {
+		return false, nil
+	}
+	domain := strings.ToLower(email[strings.LastIndexByte(email, '@')+1:])
+
+	key := "mx:" + domain
+	if cached, err := t.cache().Get(ctx, key); err == nil {
+		return string(cached) == "1", nil
+	}
+
+	ok, err := lookupMailDomain(ctx, domain)
+	if err != nil {
+		return false, err
+	}
+
+	value := []byte("0")
+	if ok {
+		value = []byte("1")
+	}
+	if err := t.cache().Set(ctx, key, value, emailMXCacheTTL); err != nil {
+		t.logger().Warn("could not cache MX lookup", "domain", domain, "error", err)
+	}
+	return ok, nil
+}
+
+// lookupMailDomain reports whether domain has MX records, or an address.
+func lookupMailDomain(ctx context.Context, domain string) (bool, error) {
+	records, err := lookupMX(ctx, domain)
+	if err == nil && len(records) > 0 {
+		// a single "." record is a null MX (RFC 7505): the domain accepts no mail
+		return !(len(records) == 1 && records[0].Host == "."), nil
+	}
+	if err != nil && !isNotFound(err) {
+		return false, err
+	}
+
+	addrs, err := lookupHost(ctx, domain)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return len(addrs) > 0, nil
+}
+
+// isNotFound reports whether err is a DNS error for a name which doesn't exist, or has no such records.
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,134 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var isValidEmailTests = []struct {
+	email    string
+	expected bool
+}{
+	{"jane@example.com", true},
+	{"jane.doe+news@mail.example.co.uk", true},
+	{"jane@localhost", false},
+	{"jane@@example.com", false},
+	{"@example.com", false},
+	{"jane@-example.com", false},
+	{strings.Repeat("a", 65) + "@example.com", false},
+	{"jane@" + strings.Repeat("a", 250) + ".com", false},
+}
+
+func TestIsValidEmail(t *testing.T) {
+	for _, e := range isValidEmailTests {
+		if IsValidEmail(e.email) != e.expected {
+			t.Errorf("%s: expected %t", e.email, e.expected)
+		}
+	}
+}
+
+var normalizeEmailTests = []struct {
+	email    string
+	opts     NormalizeEmailOptions
+	expected string
+}{
+	{email: " Jane.Doe@Example.COM ", expected: "Jane.Doe@example.com"},
+	{email: "jane+news@example.com", expected: "jane+news@example.com"},
+	{email: "jane+news@example.com", opts: NormalizeEmailOptions{StripPlusTags: true}, expected: "jane@example.com"},
+	{email: "Jane.Doe+x@GoogleMail.com", opts: NormalizeEmailOptions{StripPlusTags: true, StripGmailDots: true}, expected: "janedoe@gmail.com"},
+	{email: "jane.doe@example.com", opts: NormalizeEmailOptions{StripGmailDots: true}, expected: "jane.doe@example.com"},
+	{email: "not an email", expected: "not an email"},
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	for _, e := range normalizeEmailTests {
+		if out := NormalizeEmail(e.email, e.opts); out != e.expected {
+			t.Errorf("%q: expected %q, got %q", e.email, e.expected, out)
+		}
+	}
+}
+
+// stubMailDNS replaces the DNS lookups of CheckEmailMX for the duration of a test.
+func stubMailDNS(t *testing.T, mx map[string][]*net.MX, hosts map[string][]string, lookups *int) {
+	t.Helper()
+	oldMX, oldHost := lookupMX, lookupHost
+
+	lookupMX = func(ctx context.Context, name string) ([]*net.MX, error) {
+		*lookups++
+		if name == "timeout.example" {
+			return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+		}
+		if records, ok := mx[name]; ok {
+			return records, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	lookupHost = func(ctx context.Context, name string) ([]string, error) {
+		if addrs, ok := hosts[name]; ok {
+			return addrs, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	t.Cleanup(func() {
+		lookupMX, lookupHost = oldMX, oldHost
+	})
+}
+
+func TestTools_CheckEmailMX(t *testing.T) {
+	lookups := 0
+	stubMailDNS(t, map[string][]*net.MX{
+		"example.com":  {{Host: "mx.example.com.", Pref: 10}},
+		"null.example": {{Host: "."}},
+	}, map[string][]string{"a-only.example": {"192.0.2.1"}}, &lookups)
+
+	var testTools Tools
+	ctx := context.Background()
+
+	for email, expected := range map[string]bool{
+		"jane@example.com":     true,
+		"jane@a-only.example":  true,
+		"jane@null.example":    false,
+		"jane@nowhere.example": false,
+		"not an email":         false,
+	} {
+		ok, err := testTools.CheckEmailMX(ctx, email)
+		if err != nil || ok != expected {
+			t.Errorf("%s: expected %t, got %t (%v)", email, expected, ok, err)
+		}
+	}
+
+	lookups = 0
+	if ok, _ := testTools.CheckEmailMX(ctx, "john@EXAMPLE.com"); !ok || lookups != 0 {
+		t.Error("expected the cached result, without a lookup", ok, lookups)
+	}
+
+	var dnsErr *net.DNSError
+	if _, err := testTools.CheckEmailMX(ctx, "jane@timeout.example"); !errors.As(err, &dnsErr) {
+		t.Error("expected the lookup error, got", err)
+	}
+}
+
+func TestValidator_IsDeliverableEmail(t *testing.T) {
+	lookups := 0
+	stubMailDNS(t, map[string][]*net.MX{"example.com": {{Host: "mx.example.com."}}}, nil, &lookups)
+
+	var testTools Tools
+	v := NewValidatorFromValues(url.Values{
+		"ok":      {"jane@example.com"},
+		"invalid": {"jane@"},
+		"nomail":  {"jane@nowhere.example"},
+		"timeout": {"jane@timeout.example"},
+	})
+	for _, field := range []string{"ok", "invalid", "nomail", "timeout", "empty"} {
+		v.IsDeliverableEmail(context.Background(), &testTools, field)
+	}
+
+	if len(v.Errors) != 2 || v.Errors.Get("invalid") != "invalid email address" || v.Errors.Get("nomail") == "" {
+		t.Error("wrong errors", v.Errors)
+	}
+}
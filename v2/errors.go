@@ -0,0 +1,130 @@
+package toolkit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+)
+
+// Errors handlers can return, wrapped or not, for HandleError to send with the matching status code.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrConflict     = errors.New("conflict")
+)
+
+// errorMapping is a status code, and public message, for the errors matched by match.
+type errorMapping struct {
+	match   func(err error) bool
+	status  int
+	message string
+}
+
+// defaultErrorMappings are the mappings of HandleError for the errors of the toolkit and the standard
+// library, checked after those registered.
+var defaultErrorMappings = []errorMapping{
+	{match: isError(ErrNotFound), status: http.StatusNotFound},
+	{match: isError(sql.ErrNoRows), status: http.StatusNotFound, message: "not found"},
+	{match: isError(ErrUnauthorized), status: http.StatusUnauthorized},
+	{match: isError(ErrInvalidToken), status: http.StatusUnauthorized},
+	{match: isError(ErrTokenExpired), status: http.StatusUnauthorized},
+	{match: isError(ErrForbidden), status: http.StatusForbidden},
+	{match: isError(ErrConflict), status: http.StatusConflict},
+	{match: func(err error) bool {
+		var validationErrors ValidationErrors
+		return errors.As(err, &validationErrors)
+	}, status: http.StatusUnprocessableEntity},
+	{match: func(err error) bool {
+		return errors.Is(err, ErrBodyTooLarge) || asBodyTooLarge(err) != nil
+	}, status: http.StatusRequestEntityTooLarge},
+	{match: isError(ErrEmptyFile), status: http.StatusBadRequest},
+	{match: isError(ErrInvalidContentRange), status: http.StatusBadRequest},
+	{match: isError(ErrUploadOffsetMismatch), status: http.StatusConflict},
+	{match: isError(ErrUploadInProgress), status: http.StatusConflict},
+	{match: isError(ErrInvalidPatch), status: http.StatusUnprocessableEntity},
+	{match: isError(ErrPatchTestFailed), status: http.StatusConflict},
+	{match: isError(ErrUnsupportedPatch), status: http.StatusUnsupportedMediaType},
+	{match: isError(ErrPrivateAddress), status: http.StatusUnprocessableEntity},
+	{match: isError(ErrURLNotAllowed), status: http.StatusUnprocessableEntity},
+	{match: isError(ErrInvalidShortLink), status: http.StatusUnprocessableEntity},
+	{match: isError(ErrInsufficientStorage), status: http.StatusInsufficientStorage},
+	{match: isError(ErrOverloaded), status: http.StatusServiceUnavailable},
+	{match: isError(context.DeadlineExceeded), status: http.StatusGatewayTimeout, message: "the request timed out"},
+}
+
+// isError returns a function reporting whether an error is, or wraps, target.
+func isError(target error) func(err error) bool {
+	return func(err error) bool {
+		return errors.Is(err, target)
+	}
+}
+
+// RegisterError makes HandleError respond to errors which are, or wrap, target, with status and the
+// public message, if given, instead of the message of the error. Errors registered later take
+// precedence, also over the toolkit's own mappings, such as ErrNotFound to 404.
+func (t *Tools) RegisterError(target error, status int, message ...string) {
+	t.RegisterErrorFunc(isError(target), status, message...)
+}
+
+// RegisterErrorFunc is like RegisterError, for the errors match returns true for, such as those of a
+// type, found with errors.As.
+func (t *Tools) RegisterErrorFunc(match func(err error) bool, status int, message ...string) {
+	mapping := errorMapping{match: match, status: status}
+	if len(message) > 0 {
+		mapping.message = message[0]
+	}
+
+	t.errorMu.Lock()
+	defer t.errorMu.Unlock()
+	t.errorMappings = append(t.errorMappings, mapping)
+}
+
+// ErrorStatus returns the status code, and public message, HandleError responds to err with: those of
+// the latest mapping registered for it, or else of the toolkit's own, or 500 and its status text for
+// errors nothing is registered for, so that their details don't leak out.
+func (t *Tools) ErrorStatus(err error) (int, string) {
+	t.errorMu.RLock()
+	defer t.errorMu.RUnlock()
+
+	for i := len(t.errorMappings) - 1; i >= 0; i-- {
+		if mapping := t.errorMappings[i]; mapping.match(err) {
+			return mapping.status, mapping.messageFor(err)
+		}
+	}
+	for _, mapping := range defaultErrorMappings {
+		if mapping.match(err) {
+			return mapping.status, mapping.messageFor(err)
+		}
+	}
+	return http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+}
+
+// messageFor returns the public message of the mapping for err.
+func (m errorMapping) messageFor(err error) string {
+	if m.message != "" {
+		return m.message
+	}
+	return err.Error()
+}
+
+// HandleError sends err to the client with ErrorJSON, with the status code and public message given by
+// ErrorStatus, so that handlers can return their errors as they are. Errors sent with a 5xx status code
+// are logged, as they usually need looking into. A nil err writes nothing.
+func (t *Tools) HandleError(w http.ResponseWriter, err error) error {
+	if err == nil {
+		return nil
+	}
+	status, message := t.ErrorStatus(err)
+	if status >= 500 {
+		t.logger().Error("request failed", "status", status, "err", err)
+	}
+
+	// errors sent with their own message are passed on as they are, so that ErrorJSON sends validation
+	// errors per field
+	if message != err.Error() {
+		err = errors.New(message)
+	}
+	return t.ErrorJSON(w, err, status)
+}
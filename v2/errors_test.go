@@ -0,0 +1,72 @@
+package toolkit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// quotaError is an error type registered with RegisterErrorFunc.
+type quotaError struct {
+	limit int
+}
+
+func (e quotaError) Error() string {
+	return fmt.Sprintf("quota of %d exceeded", e.limit)
+}
+
+func TestTools_HandleError(t *testing.T) {
+	errPaymentDeclined := errors.New("card declined by bank 1234")
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+	testTools.RegisterError(errPaymentDeclined, http.StatusPaymentRequired, "the payment was declined")
+	testTools.RegisterErrorFunc(func(err error) bool {
+		var quota quotaError
+		return errors.As(err, &quota)
+	}, http.StatusTooManyRequests)
+	// registered mappings take precedence over the default ones
+	testTools.RegisterError(ErrConflict, http.StatusPreconditionFailed, "version mismatch")
+
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		message string
+	}{
+		{name: "not found", err: fmt.Errorf("user 7: %w", ErrNotFound), status: http.StatusNotFound, message: "user 7: not found"},
+		{name: "no rows", err: fmt.Errorf("loading user: %w", sql.ErrNoRows), status: http.StatusNotFound, message: "not found"},
+		{name: "forbidden", err: ErrForbidden, status: http.StatusForbidden, message: "forbidden"},
+		{name: "expired token", err: ErrTokenExpired, status: http.StatusUnauthorized, message: "token has expired"},
+		{name: "validation", err: ValidationErrors{"email": {"is required"}}, status: http.StatusUnprocessableEntity, message: "validation failed"},
+		{name: "registered", err: fmt.Errorf("charging: %w", errPaymentDeclined), status: http.StatusPaymentRequired, message: "the payment was declined"},
+		{name: "registered type", err: quotaError{limit: 10}, status: http.StatusTooManyRequests, message: "quota of 10 exceeded"},
+		{name: "overridden", err: ErrConflict, status: http.StatusPreconditionFailed, message: "version mismatch"},
+		{name: "unknown", err: errors.New("pq: connection refused"), status: http.StatusInternalServerError, message: "Internal Server Error"},
+	}
+
+	for _, test := range tests {
+		rr := httptest.NewRecorder()
+		if err := testTools.HandleError(rr, test.err); err != nil {
+			t.Fatal(err)
+		}
+
+		var payload JSONResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &payload)
+		if rr.Code != test.status || payload.Message != test.message || !payload.Error {
+			t.Errorf("%s: expected %d %q, got %d %q", test.name, test.status, test.message, rr.Code, payload.Message)
+		}
+	}
+
+	if !logger.contains("ERROR request failed") {
+		t.Error("expected the unknown error to be logged")
+	}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.HandleError(rr, nil); err != nil || rr.Body.Len() != 0 || rr.Code != http.StatusOK {
+		t.Errorf("expected nothing to be written for a nil error, got %d %q", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,602 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrExportQueueFull is returned by Exporter.Export when the queue has no room left.
+	ErrExportQueueFull = errors.New("export queue is full")
+	// ErrExportNotFound is returned for exports which don't exist, or were forgotten after Exporter.Retention.
+	ErrExportNotFound = errors.New("export not found")
+)
+
+// Storage is the interface implemented by the places files are kept, such as a directory with
+// DirStorage, or an object store. Names are slash-separated, as for fs.FS.
+type Storage interface {
+	// Create creates, or truncates, the file called name, to be written to.
+	Create(ctx context.Context, name string) (io.WriteCloser, error)
+	// Open opens the file called name. Files which also implement io.Seeker are served with range requests.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	Remove(ctx context.Context, name string) error
+}
+
+// DirStorage is a Storage keeping files in a local directory.
+type DirStorage string
+
+// path returns the path of the file called name, which must be a valid fs.FS path.
+func (d DirStorage) path(name string) (string, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	return filepath.Join(string(d), filepath.FromSlash(name)), nil
+}
+
+// Create implements Storage, creating the directories the file is in.
+func (d DirStorage) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	path, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+// Open implements Storage.
+func (d DirStorage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	path, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Remove implements Storage.
+func (d DirStorage) Remove(ctx context.Context, name string) error {
+	path, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// ExportFormat is the file format of an export.
+type ExportFormat string
+
+// the formats of exports
+const (
+	ExportCSV  ExportFormat = "csv"
+	ExportJSON ExportFormat = "json"
+	ExportXLSX ExportFormat = "xlsx"
+)
+
+// ExportStatus is where an export job is at.
+type ExportStatus string
+
+// the statuses of export jobs
+const (
+	ExportQueued  ExportStatus = "queued"
+	ExportRunning ExportStatus = "running"
+	ExportDone    ExportStatus = "done"
+	ExportFailed  ExportStatus = "failed"
+)
+
+// ExportFunc produces the rows of an export, calling write with each of them, and stopping when it returns
+// an error. For CSV and XLSX exports, rows are structs, or pointers to structs, whose columns are named
+// as for ImportCSV; JSON exports take any value json.Marshal can encode.
+type ExportFunc func(ctx context.Context, write func(row any) error) error
+
+// ExportJob is an export, as reported by Exporter.Job and Exporter.StatusHandler.
+type ExportJob struct {
+	ID string `json:"id"`
+	// Name is the name of the file, as downloaded.
+	Name   string       `json:"name"`
+	Format ExportFormat `json:"format"`
+	Status ExportStatus `json:"status"`
+	// Rows is the number of rows written so far.
+	Rows int `json:"rows"`
+	// Error is why the export failed. The actual error is logged, but isn't sent to clients.
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// URL is the signed link the file can be downloaded from, once done.
+	URL string `json:"url,omitempty"`
+}
+
+// Exporter runs large exports, as CSV, JSON or XLSX files, in the background, so that clients request an
+// export, poll its status, then download the file once it is ready, instead of holding a request open.
+// Files are written to a Storage, and downloaded from links signed with Tools.CookieKey.
+type Exporter struct {
+	// DownloadURL is the URL of the download route, to which the ID of jobs is appended, such as
+	// "https://example.com/exports/" for a DownloadHandler served at /exports/{id}.
+	DownloadURL string
+	// LinkTTL is how long download links are valid. Defaults to 15 minutes.
+	LinkTTL time.Duration
+	// Retention is how long finished jobs, and their files, are kept. Defaults to 24 hours.
+	Retention time.Duration
+	// Timeout limits how long an export may run. Defaults to an hour.
+	Timeout time.Duration
+
+	tools   *Tools
+	storage Storage
+
+	mu    sync.Mutex
+	jobs  map[string]*ExportJob
+	queue chan exportTask
+	wg    sync.WaitGroup
+}
+
+// exportTask is a job waiting in the queue, along with the function producing its rows.
+type exportTask struct {
+	id string
+	fn ExportFunc
+}
+
+// NewExporter returns an Exporter writing files to storage.
+func (t *Tools) NewExporter(storage Storage, downloadURL string) *Exporter {
+	return &Exporter{DownloadURL: downloadURL, tools: t, storage: storage, jobs: make(map[string]*ExportJob)}
+}
+
+// Start starts workers goroutines running the exports added with Export, which can hold up to queueSize
+// exports waiting to run.
+func (e *Exporter) Start(workers, queueSize int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.queue != nil {
+		return
+	}
+
+	e.queue = make(chan exportTask, queueSize)
+	for i := 0; i < workers; i++ {
+		e.wg.Add(1)
+		go func(queue chan exportTask) {
+			defer e.wg.Done()
+			for task := range queue {
+				e.run(task)
+			}
+		}(e.queue)
+	}
+}
+
+// Stop stops accepting exports, and waits for the queued ones to finish, or for ctx to be done.
+func (e *Exporter) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	if e.queue != nil {
+		close(e.queue)
+		e.queue = nil
+	}
+	e.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Export queues an export in format, whose rows are produced by fn, to be downloaded as name, to which
+// the extension of the format is added. It returns the queued job, whose ID is used to follow it.
+func (e *Exporter) Export(name string, format ExportFormat, fn ExportFunc) (*ExportJob, error) {
+	switch format {
+	case ExportCSV, ExportJSON, ExportXLSX:
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+
+	e.forgetExpired()
+
+	job := &ExportJob{ID: NewULID(), Name: name + "." + string(format), Format: format, Status: ExportQueued, Created: time.Now()}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.queue == nil {
+		return nil, errors.New("the exporter has not been started")
+	}
+
+	select {
+	case e.queue <- exportTask{id: job.ID, fn: fn}:
+		e.jobs[job.ID] = job
+		copied := *job
+		return &copied, nil
+	default:
+		return nil, ErrExportQueueFull
+	}
+}
+
+// Job returns the export with the given id, with a download link if it is done, or ErrExportNotFound.
+func (e *Exporter) Job(id string) (*ExportJob, error) {
+	e.forgetExpired()
+
+	e.mu.Lock()
+	job, ok := e.jobs[id]
+	var copied ExportJob
+	if ok {
+		copied = *job
+	}
+	e.mu.Unlock()
+	if !ok {
+		return nil, ErrExportNotFound
+	}
+
+	if copied.Status == ExportDone {
+		url, err := e.signedURL(id, time.Now().Add(e.linkTTL()))
+		if err != nil {
+			return nil, err
+		}
+		copied.URL = url
+	}
+	return &copied, nil
+}
+
+// StatusHandler returns a handler sending, as JSON, the ExportJob whose ID is the route parameter "id",
+// read with Tools.RouteParam.
+func (e *Exporter) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		job, err := e.Job(e.tools.RouteParam(r, "id"))
+		if errors.Is(err, ErrExportNotFound) {
+			_ = e.tools.ErrorJSON(w, err, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			e.tools.logger().Error("export link could not be signed", "err", err)
+			_ = e.tools.ErrorJSON(w, errors.New("internal server error"), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		_ = e.tools.WriteJSON(w, http.StatusOK, job)
+	})
+}
+
+// DownloadHandler returns a handler serving the file of the export whose ID is the route parameter "id",
+// read with Tools.RouteParam, to the requests bearing a valid signed link.
+func (e *Exporter) DownloadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := e.tools.RouteParam(r, "id")
+		if !e.validLink(id, r.URL.Query().Get("expires"), r.URL.Query().Get("signature")) {
+			_ = e.tools.ErrorJSON(w, errors.New("invalid or expired download link"), http.StatusForbidden)
+			return
+		}
+
+		job, err := e.Job(id)
+		if err != nil || job.Status != ExportDone {
+			_ = e.tools.ErrorJSON(w, ErrExportNotFound, http.StatusNotFound)
+			return
+		}
+
+		f, err := e.storage.Open(r.Context(), exportFileName(job))
+		if err != nil {
+			e.tools.logger().Error("export file could not be opened", "id", id, "err", err)
+			_ = e.tools.ErrorJSON(w, ErrExportNotFound, http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+
+		if rs, ok := f.(io.ReadSeeker); ok {
+			e.tools.ServeContentFrom(w, r, job.Name, *job.Finished, rs, job.Name)
+			return
+		}
+		w.Header().Set("Content-Disposition", contentDisposition("attachment", job.Name))
+		w.Header().Set("Content-Type", exportContentTypes[job.Format])
+		_, _ = io.Copy(w, f)
+	})
+}
+
+// exportContentTypes are the content types of the formats of exports.
+var exportContentTypes = map[ExportFormat]string{
+	ExportCSV:  "text/csv; charset=utf-8",
+	ExportJSON: "application/json",
+	ExportXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportFileName is the name of the file of job in the Storage.
+func exportFileName(job *ExportJob) string {
+	return "exports/" + job.ID + "." + string(job.Format)
+}
+
+func (e *Exporter) linkTTL() time.Duration {
+	if e.LinkTTL > 0 {
+		return e.LinkTTL
+	}
+	return 15 * time.Minute
+}
+
+// signedURL returns the download link of the export id, valid until expires.
+func (e *Exporter) signedURL(id string, expires time.Time) (string, error) {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	signature, err := e.signature(id, exp)
+	if err != nil {
+		return "", err
+	}
+	return AddQueryParams(e.DownloadURL+id, map[string]string{"expires": exp, "signature": signature})
+}
+
+// signature returns the signature of the download link of the export id, expiring at exp.
+func (e *Exporter) signature(id, exp string) (string, error) {
+	key, err := e.tools.cookieSubkey("export")
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "\n" + exp))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// validLink reports whether signature and exp are those of an unexpired download link of the export id.
+func (e *Exporter) validLink(id, exp, signature string) bool {
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	expected, err := e.signature(id, exp)
+	return err == nil && hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// run runs the export task, recording its progress in its job.
+func (e *Exporter) run(task exportTask) {
+	e.mu.Lock()
+	job := e.jobs[task.id]
+	job.Status = ExportRunning
+	copied := *job
+	e.mu.Unlock()
+
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = time.Hour
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	rows, err := e.write(ctx, &copied, task.fn)
+
+	now := time.Now()
+	e.mu.Lock()
+	job.Rows, job.Finished = rows, &now
+	if err != nil {
+		job.Status, job.Error = ExportFailed, "the export failed"
+	} else {
+		job.Status = ExportDone
+	}
+	e.mu.Unlock()
+
+	if err != nil {
+		e.tools.logger().Error("export failed", "id", task.id, "format", string(copied.Format), "err", err)
+		return
+	}
+	e.tools.logger().Info("export done", "id", task.id, "format", string(copied.Format), "rows", rows, "duration", time.Since(start))
+}
+
+// write writes the file of job, with the rows produced by fn, returning their number. The file is
+// removed if the export fails.
+func (e *Exporter) write(ctx context.Context, job *ExportJob, fn ExportFunc) (rows int, err error) {
+	f, err := e.storage.Create(ctx, exportFileName(job))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = e.storage.Remove(context.Background(), exportFileName(job))
+		}
+	}()
+
+	bw := bufio.NewWriter(f)
+	var encoder exportEncoder
+	switch job.Format {
+	case ExportCSV:
+		encoder = &csvExportEncoder{w: csv.NewWriter(bw)}
+	case ExportJSON:
+		encoder = &jsonExportEncoder{w: bw}
+	default:
+		encoder = &xlsxExportEncoder{w: bw, name: job.Name}
+	}
+
+	err = fn(ctx, func(row any) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := encoder.write(row); err != nil {
+			return err
+		}
+		rows++
+		if rows%1000 == 0 {
+			e.mu.Lock()
+			e.jobs[job.ID].Rows = rows
+			e.mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return rows, err
+	}
+	if err = encoder.close(); err != nil {
+		return rows, err
+	}
+	return rows, bw.Flush()
+}
+
+// forgetExpired forgets the jobs finished longer than Exporter.Retention ago, and removes their files.
+func (e *Exporter) forgetExpired() {
+	retention := e.Retention
+	if retention <= 0 {
+		retention = 24 * time.Hour
+	}
+
+	e.mu.Lock()
+	var expired []*ExportJob
+	for id, job := range e.jobs {
+		if job.Finished != nil && time.Since(*job.Finished) > retention {
+			expired = append(expired, job)
+			delete(e.jobs, id)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, job := range expired {
+		if job.Status == ExportDone {
+			if err := e.storage.Remove(context.Background(), exportFileName(job)); err != nil {
+				e.tools.logger().Warn("export file could not be removed", "id", job.ID, "err", err)
+			}
+		}
+	}
+}
+
+// exportEncoder writes the rows of an export in its format.
+type exportEncoder interface {
+	write(row any) error
+	close() error
+}
+
+// exportFields returns the headers and fields of the columns of row, a struct or a pointer to one, whose
+// type must be t, unless t is nil, for the first row.
+func exportFields(row any, t *reflect.Type, headers *[]string, fields *[]int) error {
+	rt := reflect.TypeOf(row)
+	if rt != nil && rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if rt == nil || rt.Kind() != reflect.Struct {
+		return fmt.Errorf("rows must be structs, not %T", row)
+	}
+	if *t == nil {
+		*t = rt
+		*headers, *fields = csvFields(rt)
+	} else if rt != *t {
+		return fmt.Errorf("rows must all be of the same type, not %s and %s", *t, rt)
+	}
+	return nil
+}
+
+// csvExportEncoder writes CSV files, with a header row.
+type csvExportEncoder struct {
+	w       *csv.Writer
+	t       reflect.Type
+	headers []string
+	fields  []int
+	record  []string
+}
+
+func (c *csvExportEncoder) write(row any) error {
+	first := c.t == nil
+	if err := exportFields(row, &c.t, &c.headers, &c.fields); err != nil {
+		return err
+	}
+	if first {
+		if err := c.w.Write(c.headers); err != nil {
+			return err
+		}
+		c.record = make([]string, len(c.fields))
+	}
+
+	for i, value := range csvValues(reflect.ValueOf(row), c.fields) {
+		c.record[i] = csvCell(value)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvExportEncoder) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvCell formats value as a CSV cell. Text starting with a character spreadsheets read as the start of
+// a formula is prefixed with a quote, so that a value such as =HYPERLINK(…) isn't run when the file is opened.
+func csvCell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// jsonExportEncoder writes JSON files holding an array of the rows.
+type jsonExportEncoder struct {
+	w    *bufio.Writer
+	rows int
+}
+
+func (j *jsonExportEncoder) write(row any) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if j.rows == 0 {
+		j.w.WriteString("[\n")
+	} else {
+		j.w.WriteString(",\n")
+	}
+	j.rows++
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonExportEncoder) close() error {
+	if j.rows == 0 {
+		_, err := j.w.WriteString("[]\n")
+		return err
+	}
+	_, err := j.w.WriteString("\n]\n")
+	return err
+}
+
+// xlsxExportEncoder writes XLSX files, with a header row. Unlike other formats, the rows are kept in memory
+// until the end, as WriteXLSX needs them all.
+type xlsxExportEncoder struct {
+	w      io.Writer
+	name   string
+	t      reflect.Type
+	sheet  XLSXSheet
+	fields []int
+}
+
+func (x *xlsxExportEncoder) write(row any) error {
+	if err := exportFields(row, &x.t, &x.sheet.Header, &x.fields); err != nil {
+		return err
+	}
+	x.sheet.Rows = append(x.sheet.Rows, csvValues(reflect.ValueOf(row), x.fields))
+	return nil
+}
+
+func (x *xlsxExportEncoder) close() error {
+	x.sheet.Name = strings.TrimSuffix(x.name, ".xlsx")
+	return WriteXLSX(x.w, []XLSXSheet{x.sheet})
+}
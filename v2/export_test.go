@@ -0,0 +1,206 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestExporter returns a started Exporter writing to a temporary directory, whose routes take the
+// export ID as the last path segment.
+func newTestExporter(t *testing.T, logger Logger) *Exporter {
+	testTools := &Tools{
+		CookieKey: []byte("0123456789abcdef0123456789abcdef"),
+		Logger:    logger,
+		RouteParams: func(r *http.Request, name string) string {
+			return r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		},
+	}
+	exporter := testTools.NewExporter(DirStorage(t.TempDir()), "http://example.com/exports/")
+	exporter.Start(2, 10)
+	return exporter
+}
+
+// exportContacts returns an ExportFunc writing contacts.
+func exportContacts(contacts ...csvContact) ExportFunc {
+	return func(ctx context.Context, write func(row any) error) error {
+		for _, c := range contacts {
+			if err := write(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestExporter(t *testing.T) {
+	logger := &recordingLogger{}
+	exporter := newTestExporter(t, logger)
+
+	job, err := exporter.Export("contacts", ExportCSV, exportContacts(
+		csvContact{Email: "jane@example.com", Name: "Jane", Age: 34, Joined: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		csvContact{Email: "bob@example.com", Name: "=cmd()", Country: "UK"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != ExportQueued || job.Name != "contacts.csv" {
+		t.Errorf("wrong job %+v", job)
+	}
+	if err = exporter.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	exporter.StatusHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/exports/"+job.ID, nil))
+	var status ExportJob
+	if err = json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != ExportDone || status.Rows != 2 || !strings.HasPrefix(status.URL, "http://example.com/exports/"+job.ID+"?") {
+		t.Fatalf("wrong status %+v", status)
+	}
+	if !logger.contains("INFO export done") {
+		t.Error("expected the export to be logged")
+	}
+
+	rr = httptest.NewRecorder()
+	exporter.DownloadHandler().ServeHTTP(rr, httptest.NewRequest("GET", status.URL, nil))
+	expected := "email,full name,age,active,joined,score,Country,reminder\n" +
+		"jane@example.com,Jane,34,false,2024-03-01T00:00:00Z,,,\n" +
+		"bob@example.com,'=cmd(),0,false,,,UK,\n"
+	if rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Errorf("expected %q, got %d %q", expected, rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Header().Get("Content-Disposition"), "contacts.csv") {
+		t.Error("wrong content disposition", rr.Header().Get("Content-Disposition"))
+	}
+
+	for _, url := range []string{
+		strings.Replace(status.URL, "signature=", "signature=x", 1),
+		strings.Replace(status.URL, job.ID, NewULID(), 1),
+		"/exports/" + job.ID,
+	} {
+		rr = httptest.NewRecorder()
+		exporter.DownloadHandler().ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", url, rr.Code)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	exporter.StatusHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/exports/unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown export, got %d", rr.Code)
+	}
+}
+
+func TestExporter_Formats(t *testing.T) {
+	exporter := newTestExporter(t, nil)
+
+	contacts := []csvContact{{Email: "jane@example.com", Age: 34}, {Email: "bob@example.com", Active: true}}
+	jsonJob, _ := exporter.Export("contacts", ExportJSON, exportContacts(contacts...))
+	xlsxJob, _ := exporter.Export("contacts", ExportXLSX, exportContacts(contacts...))
+	emptyJob, _ := exporter.Export("nothing", ExportJSON, exportContacts())
+	_ = exporter.Stop(context.Background())
+
+	download := func(id string) []byte {
+		job, err := exporter.Job(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		exporter.DownloadHandler().ServeHTTP(rr, httptest.NewRequest("GET", job.URL, nil))
+		return rr.Body.Bytes()
+	}
+
+	var decoded []csvContact
+	if err := json.Unmarshal(download(jsonJob.ID), &decoded); err != nil || len(decoded) != 2 || decoded[1].Email != "bob@example.com" {
+		t.Errorf("wrong JSON export %+v (%v)", decoded, err)
+	}
+	if data := download(emptyJob.ID); strings.TrimSpace(string(data)) != "[]" {
+		t.Errorf("expected an empty array, got %q", data)
+	}
+
+	data := download(xlsxJob.ID)
+	var imported []csvContact
+	report, err := ImportXLSX(bytes.NewReader(data), int64(len(data)), &imported)
+	if err != nil || report.Imported != 2 || imported[0].Age != 34 || !imported[1].Active {
+		t.Errorf("wrong XLSX export %+v (%v)", imported, err)
+	}
+}
+
+func TestExporter_Failures(t *testing.T) {
+	logger := &recordingLogger{}
+	exporter := newTestExporter(t, logger)
+
+	failed, _ := exporter.Export("contacts", ExportCSV, func(ctx context.Context, write func(row any) error) error {
+		_ = write(csvContact{Email: "jane@example.com"})
+		return errors.New("database is down")
+	})
+	mixed, _ := exporter.Export("contacts", ExportCSV, func(ctx context.Context, write func(row any) error) error {
+		if err := write(csvContact{}); err != nil {
+			return err
+		}
+		return write(struct{ Name string }{"Jane"})
+	})
+	if _, err := exporter.Export("contacts", "pdf", exportContacts()); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+	_ = exporter.Stop(context.Background())
+
+	for _, id := range []string{failed.ID, mixed.ID} {
+		job, err := exporter.Job(id)
+		if err != nil || job.Status != ExportFailed || job.URL != "" || job.Error == "" || strings.Contains(job.Error, "database") {
+			t.Errorf("wrong failed job %+v (%v)", job, err)
+		}
+		if _, err = exporter.storage.Open(context.Background(), exportFileName(job)); err == nil {
+			t.Error("expected the file of a failed export to be removed")
+		}
+	}
+	if !logger.contains("ERROR export failed") {
+		t.Error("expected the failure to be logged")
+	}
+
+	if _, err := exporter.Export("contacts", ExportCSV, exportContacts()); err == nil {
+		t.Error("expected an error from a stopped exporter")
+	}
+}
+
+func TestDirStorage(t *testing.T) {
+	storage := DirStorage(t.TempDir())
+	ctx := context.Background()
+
+	w, err := storage.Create(ctx, "a/b/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(w, "hello")
+	_ = w.Close()
+
+	r, err := storage.Open(ctx, "a/b/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(data) != "hello" {
+		t.Errorf("expected hello, got %q", data)
+	}
+
+	if err = storage.Remove(ctx, "a/b/file.txt"); err != nil {
+		t.Error(err)
+	}
+	for _, name := range []string{"../escape.txt", "/etc/passwd", "."} {
+		if _, err = storage.Create(ctx, name); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
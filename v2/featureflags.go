@@ -0,0 +1,245 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const featureFlagsContextKey contextKey = "featureFlags"
+
+// Flag is the definition of a feature flag. A flag is on for a user if it is Enabled, if the user is
+// listed in Users, or if the user falls in the Percentage of users it is rolled out to.
+type Flag struct {
+	Enabled bool `json:"enabled"`
+	// Percentage, from 0 to 100, turns the flag on for that share of users. Users are put in buckets by a
+	// hash of their ID and the flag's name, so a user keeps the same state as long as Percentage doesn't
+	// decrease, and different flags reach different users.
+	Percentage float64 `json:"percentage,omitempty"`
+	// Users are the IDs of the users the flag is on for, such as testers.
+	Users []string `json:"users,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, also accepting a bool as a shorthand for {"enabled": bool}.
+func (f *Flag) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*f = Flag{Enabled: enabled}
+		return nil
+	}
+
+	type flag Flag
+	return json.Unmarshal(data, (*flag)(f))
+}
+
+// FeatureFlags holds a set of feature flags, which can be loaded from the environment, JSON documents,
+// or a remote endpoint polled in the background, and replaced while they are in use.
+type FeatureFlags struct {
+	tools *Tools
+
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+// NewFeatureFlags returns FeatureFlags holding flags, by name.
+func (t *Tools) NewFeatureFlags(flags map[string]Flag) *FeatureFlags {
+	f := &FeatureFlags{tools: t}
+	f.Replace(flags)
+	return f
+}
+
+// Set adds, or replaces, the flag called name.
+func (f *FeatureFlags) Set(name string, flag Flag) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flags[name] = flag
+}
+
+// Replace replaces all the flags with flags.
+func (f *FeatureFlags) Replace(flags map[string]Flag) {
+	copied := make(map[string]Flag, len(flags))
+	for name, flag := range flags {
+		copied[name] = flag
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flags = copied
+}
+
+// LoadJSON adds the flags of the JSON object read from r, keyed by name, whose values are either a Flag
+// object or a bool, as in {"new-checkout": {"percentage": 25}, "dark-mode": true}.
+func (f *FeatureFlags) LoadJSON(r io.Reader) error {
+	var flags map[string]Flag
+	if err := json.NewDecoder(r).Decode(&flags); err != nil {
+		return fmt.Errorf("invalid feature flags: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name, flag := range flags {
+		f.flags[name] = flag
+	}
+	return nil
+}
+
+// LoadEnv adds the flags of the environment variables starting with prefix, such as FEATURE_. The
+// rest of the variable's name, in lower case, is the name of the flag, and its value is either a bool,
+// or a percentage, as in FEATURE_NEW_CHECKOUT=25%, which sets the flag new_checkout.
+func (f *FeatureFlags) LoadEnv(prefix string) error {
+	flags := make(map[string]Flag)
+	for _, variable := range os.Environ() {
+		key, value, _ := strings.Cut(variable, "=")
+		if !strings.HasPrefix(key, prefix) || key == prefix {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, prefix))
+
+		value = strings.TrimSpace(value)
+		if strings.HasSuffix(value, "%") {
+			p, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "%")), 64)
+			if err != nil || p < 0 || p > 100 {
+				return fmt.Errorf("%s must be a bool or a percentage", key)
+			}
+			flags[name] = Flag{Percentage: p}
+			continue
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a bool or a percentage", key)
+		}
+		flags[name] = Flag{Enabled: enabled}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name, flag := range flags {
+		f.flags[name] = flag
+	}
+	return nil
+}
+
+// Poll replaces the flags with those of the JSON object at uri, in the format LoadJSON reads, every
+// interval until ctx is done, fetching it with GetJSONFromRemote, so that responses are cached and
+// revalidated as their headers allow. The first fetch happens before Poll returns, and its error, if
+// any, is returned; polling goes on regardless, and later errors are logged, the flags being kept.
+// An interval which is not positive returns an error, without fetching anything.
+func (f *FeatureFlags) Poll(ctx context.Context, uri string, interval time.Duration, client ...*http.Client) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid polling interval %v", interval)
+	}
+	err := f.fetch(uri, client...)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := f.fetch(uri, client...); err != nil {
+					f.tools.logger().Warn("feature flags not refreshed", "uri", uri, "err", err)
+				}
+			}
+		}
+	}()
+
+	return err
+}
+
+// fetch replaces the flags with those at uri.
+func (f *FeatureFlags) fetch(uri string, client ...*http.Client) error {
+	var flags map[string]Flag
+	status, err := f.tools.GetJSONFromRemote(uri, &flags, client...)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status > 299 {
+		return fmt.Errorf("feature flags endpoint returned status %d", status)
+	}
+	f.Replace(flags)
+	return nil
+}
+
+// Enabled reports whether the flag called name is on for the user with the given ID, which may be
+// empty for anonymous users, who only get the flags which are Enabled. Unknown flags are off.
+func (f *FeatureFlags) Enabled(name, user string) bool {
+	f.mu.RLock()
+	flag, ok := f.flags[name]
+	f.mu.RUnlock()
+	return ok && flag.enabledFor(name, user)
+}
+
+// All returns the state of every flag for the user with the given ID.
+func (f *FeatureFlags) All(user string) map[string]bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	states := make(map[string]bool, len(f.flags))
+	for name, flag := range f.flags {
+		states[name] = flag.enabledFor(name, user)
+	}
+	return states
+}
+
+// enabledFor reports whether the flag called name is on for user.
+func (f Flag) enabledFor(name, user string) bool {
+	if f.Enabled {
+		return true
+	}
+	if user == "" {
+		return false
+	}
+	for _, u := range f.Users {
+		if u == user {
+			return true
+		}
+	}
+	return f.Percentage > 0 && flagBucket(name, user) < f.Percentage
+}
+
+// flagBucket returns the bucket of user for the flag called name, from 0 to 100, with two decimals.
+func flagBucket(name, user string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(name + "\x00" + user))
+	return float64(binary.BigEndian.Uint64(h.Sum(nil))%10000) / 100
+}
+
+// Middleware returns middleware storing the state of every flag, for the user whose ID is returned by
+// user, in the request context, to be read with FeatureEnabled or FeatureFlagsFromContext. A nil user
+// makes every request anonymous.
+func (f *FeatureFlags) Middleware(user func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := ""
+			if user != nil {
+				id = user(r)
+			}
+			states := f.All(id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), featureFlagsContextKey, states)))
+		})
+	}
+}
+
+// FeatureFlagsFromContext returns the state of every flag stored in ctx by FeatureFlags.Middleware.
+func FeatureFlagsFromContext(ctx context.Context) (map[string]bool, bool) {
+	states, ok := ctx.Value(featureFlagsContextKey).(map[string]bool)
+	return states, ok
+}
+
+// FeatureEnabled reports whether the flag called name is on, according to the states stored in ctx
+// by FeatureFlags.Middleware.
+func FeatureEnabled(ctx context.Context, name string) bool {
+	states, _ := ctx.Value(featureFlagsContextKey).(map[string]bool)
+	return states[name]
+}
@@ -0,0 +1,155 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	var testTools Tools
+	flags := testTools.NewFeatureFlags(map[string]Flag{
+		"dark-mode": {Enabled: true},
+		"beta":      {Users: []string{"alice"}},
+		"checkout":  {Percentage: 30},
+	})
+
+	tests := []struct {
+		name, user string
+		expected   bool
+	}{
+		{name: "dark-mode", user: "", expected: true},
+		{name: "beta", user: "alice", expected: true},
+		{name: "beta", user: "bob", expected: false},
+		{name: "beta", user: "", expected: false},
+		{name: "missing", user: "alice", expected: false},
+	}
+	for _, test := range tests {
+		if enabled := flags.Enabled(test.name, test.user); enabled != test.expected {
+			t.Errorf("%s for %q: expected %v, got %v", test.name, test.user, test.expected, enabled)
+		}
+	}
+
+	// about 30% of users get the rollout, always the same ones, which it keeps when it widens
+	on := 0
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user%d", i)
+		if flags.Enabled("checkout", user) {
+			on++
+			if !flags.Enabled("checkout", user) {
+				t.Fatal("expected the same state for the same user")
+			}
+			flags.Set("checkout", Flag{Percentage: 60})
+			if !flags.Enabled("checkout", user) {
+				t.Fatal("expected a user to keep the flag when the rollout widens")
+			}
+			flags.Set("checkout", Flag{Percentage: 30})
+		}
+	}
+	if on < 250 || on > 350 {
+		t.Errorf("expected about 300 users, got %d", on)
+	}
+	if flags.Enabled("checkout", "") {
+		t.Error("expected anonymous users not to be in a rollout")
+	}
+}
+
+func TestFeatureFlags_Load(t *testing.T) {
+	var testTools Tools
+	flags := testTools.NewFeatureFlags(nil)
+
+	err := flags.LoadJSON(strings.NewReader(`{"dark-mode": true, "beta": {"users": ["alice"]}, "off": false}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !flags.Enabled("dark-mode", "") || !flags.Enabled("beta", "alice") || flags.Enabled("off", "alice") {
+		t.Errorf("wrong flags %v", flags.All("alice"))
+	}
+	if err = flags.LoadJSON(strings.NewReader(`{"beta": "yes"}`)); err == nil {
+		t.Error("expected an error for an invalid flag")
+	}
+
+	t.Setenv("TESTFLAG_NEW_CHECKOUT", "100%")
+	t.Setenv("TESTFLAG_DARK_MODE", "false")
+	if err = flags.LoadEnv("TESTFLAG_"); err != nil {
+		t.Fatal(err)
+	}
+	if !flags.Enabled("new_checkout", "bob") || flags.Enabled("dark_mode", "bob") {
+		t.Errorf("wrong flags %v", flags.All("bob"))
+	}
+
+	t.Setenv("TESTFLAG_BROKEN", "maybe")
+	if err = flags.LoadEnv("TESTFLAG_"); err == nil {
+		t.Error("expected an error for an invalid value")
+	}
+}
+
+func TestFeatureFlags_Poll(t *testing.T) {
+	var version atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"new-ui": %v}`, version.Load() > 0)
+	}))
+	defer server.Close()
+
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+	flags := testTools.NewFeatureFlags(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := flags.Poll(ctx, server.URL, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if flags.Enabled("new-ui", "") {
+		t.Fatal("expected new-ui to be off")
+	}
+
+	version.Store(1)
+	deadline := time.Now().Add(2 * time.Second)
+	for !flags.Enabled("new-ui", "") {
+		if time.Now().After(deadline) {
+			t.Fatal("expected new-ui to be turned on by polling")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := flags.Poll(ctx, "http://127.0.0.1:1/flags", time.Hour); err == nil {
+		t.Error("expected the error of the first fetch")
+	}
+	if err := flags.Poll(ctx, server.URL, 0); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+}
+
+func TestFeatureFlags_Middleware(t *testing.T) {
+	var testTools Tools
+	flags := testTools.NewFeatureFlags(map[string]Flag{"beta": {Users: []string{"alice"}}})
+
+	var enabled bool
+	handler := flags.Middleware(func(r *http.Request) string { return r.Header.Get("X-User") })(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			enabled = FeatureEnabled(r.Context(), "beta")
+			if states, ok := FeatureFlagsFromContext(r.Context()); !ok || len(states) != 1 {
+				t.Errorf("wrong states %v", states)
+			}
+		}))
+
+	for user, expected := range map[string]bool{"alice": true, "bob": false} {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("X-User", user)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+		if enabled != expected {
+			t.Errorf("%s: expected %v, got %v", user, expected, enabled)
+		}
+	}
+
+	if FeatureEnabled(context.Background(), "beta") {
+		t.Error("expected flags to be off without the middleware")
+	}
+}
@@ -0,0 +1,235 @@
+package toolkit
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FeedItem is an entry of a Feed, such as a blog post.
+type FeedItem struct {
+	// ID identifies the item for good. Defaults to Link.
+	ID          string
+	Title       string
+	Link        string
+	Description string
+	// Content, if set, is the full HTML content of the item, Description being its summary.
+	Content   string
+	Author    string
+	Published time.Time
+	// Updated, if set, is when the item last changed. Defaults to Published.
+	Updated time.Time
+}
+
+// Feed builds an RSS 2.0 or Atom feed of items, such as the latest posts of a blog. The text of the feed
+// and its items is escaped, HTML included, so that it can be anything.
+type Feed struct {
+	Title       string
+	Link        string
+	Description string
+	Author      string
+	// FeedURL, if set, is the URL the feed is served at, linked from the feed itself.
+	FeedURL string
+	// Updated is when the feed last changed. Defaults to the latest update of its items.
+	Updated time.Time
+	Items   []FeedItem
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr,omitempty"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      *atomLink `xml:"atom:link,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link,omitempty"`
+	Description string   `xml:"description,omitempty"`
+	Author      string   `xml:"author,omitempty"`
+	GUID        *rssGUID `xml:"guid,omitempty"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type atomDocument struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Link      *atomLink   `xml:"link,omitempty"`
+	Published string      `xml:"published,omitempty"`
+	Updated   string      `xml:"updated"`
+	Author    *atomAuthor `xml:"author,omitempty"`
+	Summary   *atomText   `xml:"summary,omitempty"`
+	Content   *atomText   `xml:"content,omitempty"`
+}
+
+// updated returns when the feed last changed.
+func (f *Feed) updated() time.Time {
+	updated := f.Updated
+	if updated.IsZero() {
+		for _, item := range f.Items {
+			if itemUpdated := item.updated(); itemUpdated.After(updated) {
+				updated = itemUpdated
+			}
+		}
+	}
+	return updated
+}
+
+// updated returns when the item last changed.
+func (item FeedItem) updated() time.Time {
+	if item.Updated.IsZero() {
+		return item.Published
+	}
+	return item.Updated
+}
+
+// WriteRSS writes the feed to w as RSS 2.0.
+func (f *Feed) WriteRSS(w io.Writer) error {
+	doc := rssDocument{
+		Version: "2.0",
+		Channel: rssChannel{Title: f.Title, Link: f.Link, Description: f.Description},
+	}
+	if f.FeedURL != "" {
+		doc.Atom = "http://www.w3.org/2005/Atom"
+		doc.Channel.AtomLink = &atomLink{Href: f.FeedURL, Rel: "self", Type: "application/rss+xml"}
+	}
+	if updated := f.updated(); !updated.IsZero() {
+		doc.Channel.LastBuildDate = updated.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, item := range f.Items {
+		entry := rssItem{Title: item.Title, Link: item.Link, Description: item.Description, Author: item.Author}
+		if entry.Description == "" {
+			entry.Description = item.Content
+		}
+		if item.ID != "" {
+			entry.GUID = &rssGUID{Value: item.ID, IsPermaLink: item.ID == item.Link}
+		} else if item.Link != "" {
+			entry.GUID = &rssGUID{Value: item.Link, IsPermaLink: true}
+		}
+		if !item.Published.IsZero() {
+			entry.PubDate = item.Published.UTC().Format(time.RFC1123Z)
+		}
+		doc.Channel.Items = append(doc.Channel.Items, entry)
+	}
+	return writeFeedXML(w, doc)
+}
+
+// WriteAtom writes the feed to w as Atom (RFC 4287).
+func (f *Feed) WriteAtom(w io.Writer) error {
+	doc := atomDocument{
+		Title:   f.Title,
+		ID:      f.Link,
+		Updated: f.updated().UTC().Format(time.RFC3339),
+		Links:   []atomLink{{Href: f.Link, Rel: "alternate"}},
+	}
+	if f.FeedURL != "" {
+		doc.ID = f.FeedURL
+		doc.Links = append(doc.Links, atomLink{Href: f.FeedURL, Rel: "self", Type: "application/atom+xml"})
+	}
+	if f.Author != "" {
+		doc.Author = &atomAuthor{Name: f.Author}
+	}
+
+	for _, item := range f.Items {
+		entry := atomEntry{
+			Title:   item.Title,
+			ID:      item.ID,
+			Updated: item.updated().UTC().Format(time.RFC3339),
+		}
+		if entry.ID == "" {
+			entry.ID = item.Link
+		}
+		if item.Link != "" {
+			entry.Link = &atomLink{Href: item.Link, Rel: "alternate"}
+		}
+		if !item.Published.IsZero() {
+			entry.Published = item.Published.UTC().Format(time.RFC3339)
+		}
+		if item.Author != "" {
+			entry.Author = &atomAuthor{Name: item.Author}
+		}
+		if item.Description != "" {
+			entry.Summary = &atomText{Type: "html", Value: item.Description}
+		}
+		if item.Content != "" {
+			entry.Content = &atomText{Type: "html", Value: item.Content}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return writeFeedXML(w, doc)
+}
+
+// writeFeedXML writes the XML document doc to w, after the XML declaration.
+func writeFeedXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(doc)
+}
+
+// ServeHTTP implements http.Handler, sending the feed as Atom to clients preferring it in their Accept
+// header, or for paths ending with .atom, and as RSS otherwise.
+func (f *Feed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept")
+
+	atom := strings.HasSuffix(r.URL.Path, ".atom")
+	if !strings.HasSuffix(r.URL.Path, ".rss") && !atom {
+		// media types are weighted in Accept as languages are in Accept-Language
+		for _, mediaType := range parseAcceptLanguage(r.Header.Get("Accept")) {
+			if mediaType == "application/atom+xml" || mediaType == "application/rss+xml" {
+				atom = mediaType == "application/atom+xml"
+				break
+			}
+		}
+	}
+
+	if atom {
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		_ = f.WriteAtom(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	_ = f.WriteRSS(w)
+}
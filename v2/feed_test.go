@@ -0,0 +1,99 @@
+package toolkit
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFeed() *Feed {
+	return &Feed{
+		Title:       "Tom & Jerry's <blog>",
+		Link:        "https://example.com/",
+		Description: "Posts",
+		Author:      "Tom",
+		FeedURL:     "https://example.com/feed",
+		Items: []FeedItem{
+			{
+				Title:       "Hello <world>",
+				Link:        "https://example.com/posts/hello",
+				Description: "<p>A & B</p>",
+				Published:   time.Date(2024, time.March, 5, 10, 0, 0, 0, time.UTC),
+			},
+			{
+				ID:        "urn:post:2",
+				Title:     "Second",
+				Link:      "https://example.com/posts/second",
+				Content:   "<p>Full</p>",
+				Published: time.Date(2024, time.March, 6, 10, 0, 0, 0, time.UTC),
+				Updated:   time.Date(2024, time.March, 7, 10, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+}
+
+func TestFeed_WriteRSS(t *testing.T) {
+	var b strings.Builder
+	if err := testFeed().WriteRSS(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel>`,
+		`<title>Tom &amp; Jerry&#39;s &lt;blog&gt;</title>`,
+		`<atom:link href="https://example.com/feed" rel="self" type="application/rss+xml"></atom:link>`,
+		`<lastBuildDate>Thu, 07 Mar 2024 10:00:00 +0000</lastBuildDate>`,
+		`<item><title>Hello &lt;world&gt;</title><link>https://example.com/posts/hello</link><description>&lt;p&gt;A &amp; B&lt;/p&gt;</description><guid isPermaLink="true">https://example.com/posts/hello</guid><pubDate>Tue, 05 Mar 2024 10:00:00 +0000</pubDate></item>`,
+		`<description>&lt;p&gt;Full&lt;/p&gt;</description><guid isPermaLink="false">urn:post:2</guid>`,
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("expected %s in\n%s", expected, b.String())
+		}
+	}
+}
+
+func TestFeed_WriteAtom(t *testing.T) {
+	var b strings.Builder
+	if err := testFeed().WriteAtom(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom"><title>Tom &amp; Jerry&#39;s &lt;blog&gt;</title><id>https://example.com/feed</id><updated>2024-03-07T10:00:00Z</updated>`,
+		`<link href="https://example.com/feed" rel="self" type="application/atom+xml"></link>`,
+		`<author><name>Tom</name></author>`,
+		`<entry><title>Hello &lt;world&gt;</title><id>https://example.com/posts/hello</id><link href="https://example.com/posts/hello" rel="alternate"></link><published>2024-03-05T10:00:00Z</published><updated>2024-03-05T10:00:00Z</updated><summary type="html">&lt;p&gt;A &amp; B&lt;/p&gt;</summary></entry>`,
+		`<id>urn:post:2</id>`,
+		`<content type="html">&lt;p&gt;Full&lt;/p&gt;</content>`,
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("expected %s in\n%s", expected, b.String())
+		}
+	}
+}
+
+func TestFeed_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		path, accept, expected string
+	}{
+		{path: "/feed", expected: "application/rss+xml; charset=utf-8"},
+		{path: "/feed", accept: "application/atom+xml", expected: "application/atom+xml; charset=utf-8"},
+		{path: "/feed", accept: "application/rss+xml;q=0.5, application/atom+xml", expected: "application/atom+xml; charset=utf-8"},
+		{path: "/feed", accept: "application/atom+xml;q=0.5, application/rss+xml", expected: "application/rss+xml; charset=utf-8"},
+		{path: "/feed.atom", expected: "application/atom+xml; charset=utf-8"},
+		{path: "/feed.rss", accept: "application/atom+xml", expected: "application/rss+xml; charset=utf-8"},
+	}
+	feed := testFeed()
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", test.path, nil)
+		if test.accept != "" {
+			request.Header.Set("Accept", test.accept)
+		}
+		rr := httptest.NewRecorder()
+		feed.ServeHTTP(rr, request)
+		if rr.Header().Get("Content-Type") != test.expected || rr.Header().Get("Vary") != "Accept" {
+			t.Errorf("%s %q: expected %s, got %s", test.path, test.accept, test.expected, rr.Header().Get("Content-Type"))
+		}
+	}
+}
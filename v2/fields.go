@@ -0,0 +1,115 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// WriteJSONFiltered is WriteJSON sending only the top-level fields of data named in fields, a comma
+// separated list such as the fields query parameter of ?fields=id,name,created_at, to cut the size of
+// responses for clients which need few fields. Each object of an array is filtered the same way; other
+// values, and all fields when fields is empty, are sent as they are. Unknown names are ignored. The Data
+// of a JSONResponse or a PaginatedResponse is filtered rather than the envelope, which is sent as
+// WriteJSON would send it, with its message translated and its pagination in the meta.
+func (t *Tools) WriteJSONFiltered(w http.ResponseWriter, status int, data any, fields string, headers ...http.Header) error {
+	wanted := make(map[string]bool)
+	for _, field := range strings.Split(fields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			wanted[field] = true
+		}
+	}
+	if len(wanted) == 0 {
+		return t.WriteJSON(w, status, data, headers...)
+	}
+
+	var err error
+	switch payload := data.(type) {
+	case JSONResponse:
+		payload.Data, err = filterJSON(payload.Data, wanted)
+		data = payload
+	case *JSONResponse:
+		if payload != nil {
+			filtered := *payload
+			filtered.Data, err = filterJSON(payload.Data, wanted)
+			data = filtered
+		}
+	case PaginatedResponse:
+		payload.Data, err = filterJSON(payload.Data, wanted)
+		data = payload
+	case *PaginatedResponse:
+		if payload != nil {
+			filtered := *payload
+			filtered.Data, err = filterJSON(payload.Data, wanted)
+			data = filtered
+		}
+	default:
+		data, err = filterJSON(data, wanted)
+	}
+	if err != nil {
+		return err
+	}
+	return t.WriteJSON(w, status, data, headers...)
+}
+
+// filterJSON returns the JSON encoding of data with only the fields in wanted, in each object of an
+// array if data is one, or nil if data is nil.
+func filterJSON(data any, wanted map[string]bool) (any, error) {
+	if data == nil {
+		return nil, nil
+	}
+	out, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if filtered, ok := filterJSONObject(out, wanted); ok {
+		return json.RawMessage(filtered), nil
+	}
+
+	var items []json.RawMessage
+	if err = json.Unmarshal(out, &items); err == nil {
+		for i, item := range items {
+			if filtered, ok := filterJSONObject(item, wanted); ok {
+				items[i] = filtered
+			}
+		}
+		return items, nil
+	}
+	return json.RawMessage(out), nil
+}
+
+// filterJSONObject returns the JSON object raw with only the fields in wanted, in their original order,
+// and false if raw is not an object.
+func filterJSONObject(raw []byte, wanted map[string]bool) ([]byte, bool) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if token, err := dec.Token(); err != nil || token != json.Delim('{') {
+		return nil, false
+	}
+
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		key, _ := token.(string)
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, false
+		}
+		if !wanted[key] {
+			continue
+		}
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		encodedKey, _ := json.Marshal(key)
+		out.Write(encodedKey)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), true
+}
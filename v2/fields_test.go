@@ -0,0 +1,81 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_WriteJSONFiltered(t *testing.T) {
+	type user struct {
+		ID        int       `json:"id"`
+		Name      string    `json:"name"`
+		Email     string    `json:"email"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	created := time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)
+	ann := user{ID: 1, Name: "Ann", Email: "ann@example.com", CreatedAt: created}
+
+	tests := []struct {
+		name     string
+		data     any
+		fields   string
+		expected string
+	}{
+		{name: "object", data: ann, fields: "created_at,id", expected: `{"id":1,"created_at":"2024-03-05T00:00:00Z"}`},
+		{name: "spaces and unknown", data: ann, fields: " name , missing,", expected: `{"name":"Ann"}`},
+		{name: "array", data: []user{ann, {ID: 2, Name: "Bob"}}, fields: "id", expected: `[{"id":1},{"id":2}]`},
+		{name: "no fields", data: map[string]int{"a": 1}, fields: "", expected: `{"a":1}`},
+		{name: "not an object", data: []int{1, 2}, fields: "id", expected: `[1,2]`},
+		{name: "scalar", data: "text", fields: "id", expected: `"text"`},
+	}
+
+	var testTools Tools
+	for _, test := range tests {
+		rr := httptest.NewRecorder()
+		if err := testTools.WriteJSONFiltered(rr, http.StatusOK, test.data, test.fields); err != nil {
+			t.Fatal(test.name, err)
+		}
+		if rr.Body.String() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, rr.Body.String())
+		}
+		if rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: wrong content type %s", test.name, rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestTools_WriteJSONFiltered_Envelopes(t *testing.T) {
+	messages := NewMessages("fr")
+	messages.Add("fr", map[string]string{"users.found": "Utilisateurs trouvés"})
+	testTools := Tools{Messages: messages, ResponseMeta: map[string]MetaFunc{"pagination": MetaPagination}}
+	users := []map[string]any{{"id": 1, "name": "Ann", "email": "ann@example.com"}, {"id": 2, "name": "Bob"}}
+
+	request := httptest.NewRequest("GET", "/users?fields=id", nil)
+	rr := httptest.NewRecorder()
+	handler := testTools.MetaMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := JSONResponse{Message: "users found", Code: "users.found", Data: users}
+		if err := testTools.WriteJSONFiltered(w, http.StatusOK, response, r.URL.Query().Get("fields")); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	handler.ServeHTTP(rr, request)
+	expected := `{"error":false,"message":"Utilisateurs trouvés","code":"users.found","data":[{"id":1},{"id":2}]}`
+	if rr.Body.String() != expected {
+		t.Errorf("expected %s, got %s", expected, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler = testTools.MetaMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := &PaginatedResponse{Data: users, Pagination: Pagination{Page: 2, PerPage: 2, Total: 4}}
+		if err := testTools.WriteJSONFiltered(w, http.StatusOK, response, "name"); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/users", nil))
+	if !strings.Contains(rr.Body.String(), `"data":[{"name":"Ann"},{"name":"Bob"}]`) || !strings.Contains(rr.Body.String(), `"meta":{"pagination":{`) {
+		t.Errorf("expected the data to be filtered and the pagination kept, got %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,226 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FileCache is a CounterCache and Locker kept in a single JSON file, so that values survive restarts and
+// are shared by the processes of a machine when Redis isn't available: it can back the rate limiter, with
+// NewCacheRateLimitStore, Tools.Cache, and so idempotency keys and remote responses, or a Scheduler's locks.
+//
+// Each operation locks the file, with an advisory lock of the operating system, reads it, and replaces it
+// when it changes, so FileCache suits a few thousand small entries, not large or busy data sets. On
+// platforms without file locks, only the goroutines of one process are kept from racing.
+type FileCache struct {
+	path string
+	mu   sync.Mutex
+	now  func() time.Time
+}
+
+// fileCacheEntry is a value held by a FileCache.
+type fileCacheEntry struct {
+	Value []byte `json:"v"`
+	// Expires is when the entry expires, in Unix milliseconds, or 0 if it doesn't.
+	Expires int64 `json:"e,omitempty"`
+}
+
+// NewFileCache returns a FileCache kept in the file at path, which is created, along with its directory,
+// if it doesn't exist. A lock file is created next to it, with the .lock extension added.
+func NewFileCache(path string) (*FileCache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	c := &FileCache{path: path, now: time.Now}
+	// opening the file now makes errors, such as a lack of permission, show up early
+	if err := c.update(func(entries map[string]*fileCacheEntry) bool { return false }); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get returns the value stored under key, or ErrCacheMiss if there is none, or it has expired.
+func (c *FileCache) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	found := false
+	err := c.update(func(entries map[string]*fileCacheEntry) bool {
+		if entry, ok := entries[key]; ok {
+			value, found = entry.Value, true
+		}
+		return false
+	})
+	if err == nil && !found {
+		err = ErrCacheMiss
+	}
+	return value, err
+}
+
+// Set stores value under key for ttl. A zero ttl means the value doesn't expire.
+func (c *FileCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.update(func(entries map[string]*fileCacheEntry) bool {
+		entries[key] = &fileCacheEntry{Value: append([]byte{}, value...), Expires: c.expires(ttl)}
+		return true
+	})
+}
+
+// Delete removes the value stored under key, if any.
+func (c *FileCache) Delete(ctx context.Context, key string) error {
+	return c.update(func(entries map[string]*fileCacheEntry) bool {
+		_, ok := entries[key]
+		delete(entries, key)
+		return ok
+	})
+}
+
+// Flush removes every value.
+func (c *FileCache) Flush(ctx context.Context) error {
+	return c.update(func(entries map[string]*fileCacheEntry) bool {
+		for key := range entries {
+			delete(entries, key)
+		}
+		return true
+	})
+}
+
+// Increment adds one to the counter stored under key, creating it with a value of one, expiring
+// after ttl, if it doesn't exist, and returns the new value.
+func (c *FileCache) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	var n int64
+	var incrementErr error
+	err := c.update(func(entries map[string]*fileCacheEntry) bool {
+		entry, ok := entries[key]
+		if !ok {
+			n = 1
+			entries[key] = &fileCacheEntry{Value: []byte("1"), Expires: c.expires(ttl)}
+			return true
+		}
+
+		if n, incrementErr = strconv.ParseInt(string(entry.Value), 10, 64); incrementErr != nil {
+			incrementErr = errors.New("cached value is not a counter")
+			return false
+		}
+		n++
+		entry.Value = strconv.AppendInt(nil, n, 10)
+		return true
+	})
+	if err == nil {
+		err = incrementErr
+	}
+	return n, err
+}
+
+// TryLock acquires the lock called key for ttl, or returns ErrLockNotAcquired if it is held elsewhere.
+// The returned function releases the lock; otherwise, it expires after ttl.
+func (c *FileCache) TryLock(ctx context.Context, key string, ttl time.Duration) (func() error, error) {
+	var token [16]byte
+	if _, err := rand.Read(token[:]); err != nil {
+		return nil, err
+	}
+	value := []byte(hex.EncodeToString(token[:]))
+	lockKey := "lock:" + key
+
+	acquired := false
+	err := c.update(func(entries map[string]*fileCacheEntry) bool {
+		if _, held := entries[lockKey]; held {
+			return false
+		}
+		entries[lockKey] = &fileCacheEntry{Value: value, Expires: c.expires(ttl)}
+		acquired = true
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrLockNotAcquired
+	}
+
+	return func() error {
+		return c.update(func(entries map[string]*fileCacheEntry) bool {
+			// the lock may have expired, and been acquired by someone else since
+			if entry, ok := entries[lockKey]; ok && string(entry.Value) == string(value) {
+				delete(entries, lockKey)
+				return true
+			}
+			return false
+		})
+	}, nil
+}
+
+// expires returns the expiry of an entry stored now for ttl.
+func (c *FileCache) expires(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return c.now().Add(ttl).UnixMilli()
+}
+
+// update calls fn with the live entries of the file, holding its lock, and writes them back if fn
+// reports that it changed them. Expired entries are dropped whenever the file is written.
+func (c *FileCache) update(fn func(entries map[string]*fileCacheEntry) (changed bool)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lock, err := os.OpenFile(c.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err = lockFile(lock); err != nil {
+		return err
+	}
+	defer func() { _ = unlockFile(lock) }()
+
+	entries := make(map[string]*fileCacheEntry)
+	data, err := os.ReadFile(c.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &entries); err != nil {
+			return err
+		}
+	}
+
+	now := c.now().UnixMilli()
+	expired := false
+	for key, entry := range entries {
+		if entry.Expires != 0 && entry.Expires <= now {
+			delete(entries, key)
+			expired = true
+		}
+	}
+
+	if !fn(entries) && !expired {
+		return nil
+	}
+
+	if data, err = json.Marshal(entries); err != nil {
+		return err
+	}
+	// the file is replaced, rather than rewritten in place, so that a crash can't leave it truncated
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
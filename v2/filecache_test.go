@@ -0,0 +1,128 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileCache(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache", "kv.json")
+	cache, err := NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// entries are pruned by the real clock when a FileCache is opened, so the test clock starts now
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	_ = cache.Set(ctx, "a", []byte("1"), time.Minute)
+	_ = cache.Set(ctx, "b", []byte("2"), 0)
+	_ = cache.Set(ctx, "empty", []byte{}, 0)
+
+	// a new instance, as after a restart, reads the same file
+	reopened, err := NewFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.now = cache.now
+	if v, err := reopened.Get(ctx, "a"); err != nil || string(v) != "1" {
+		t.Errorf("wrong value for a: %q %v", v, err)
+	}
+	if v, err := reopened.Get(ctx, "empty"); err != nil || len(v) != 0 {
+		t.Errorf("wrong value for empty: %q %v", v, err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := cache.Get(ctx, "a"); !errors.Is(err, ErrCacheMiss) {
+		t.Error("expected a to have expired, got", err)
+	}
+
+	_ = cache.Delete(ctx, "b")
+	if _, err := cache.Get(ctx, "b"); !errors.Is(err, ErrCacheMiss) {
+		t.Error("expected b to be deleted, got", err)
+	}
+
+	_ = cache.Set(ctx, "c", []byte("3"), 0)
+	_ = cache.Flush(ctx)
+	if _, err := cache.Get(ctx, "c"); !errors.Is(err, ErrCacheMiss) {
+		t.Error("expected an empty cache after Flush, got", err)
+	}
+
+	_ = cache.Set(ctx, "text", []byte("x"), 0)
+	if _, err := cache.Increment(ctx, "text", 0); err == nil {
+		t.Error("expected an error when incrementing a value which isn't a counter")
+	}
+}
+
+func TestFileCache_Concurrency(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.json")
+
+	// two instances stand for two processes sharing the file
+	var caches []*FileCache
+	for i := 0; i < 2; i++ {
+		cache, err := NewFileCache(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		caches = append(caches, cache)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(cache *FileCache) {
+			defer wg.Done()
+			if _, err := cache.Increment(ctx, "hits", time.Minute); err != nil {
+				t.Error(err)
+			}
+		}(caches[i%2])
+	}
+	wg.Wait()
+
+	if n, err := caches[0].Increment(ctx, "hits", time.Minute); err != nil || n != 41 {
+		t.Errorf("expected 41, got %d (%v)", n, err)
+	}
+
+	unlock, err := caches[0].TryLock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = caches[1].TryLock(ctx, "job", time.Minute); !errors.Is(err, ErrLockNotAcquired) {
+		t.Error("expected ErrLockNotAcquired, got", err)
+	}
+	if err = unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = caches[1].TryLock(ctx, "job", time.Minute); err != nil {
+		t.Error("expected the released lock to be acquired, got", err)
+	}
+}
+
+func TestFileCache_RateLimit(t *testing.T) {
+	cache, err := NewFileCache(filepath.Join(t.TempDir(), "kv.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testTools := Tools{Cache: cache}
+
+	handler := testTools.RateLimit(RateLimitOptions{Requests: 1, Window: time.Minute, KeyFunc: RateLimitByIP})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	codes := []int{}
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		codes = append(codes, rr.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Error("wrong status codes", codes)
+	}
+}
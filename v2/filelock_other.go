@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package toolkit
+
+import "os"
+
+// lockFile is not implemented on this platform, so FileCache only locks out the goroutines of its process.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile is not implemented on this platform.
+func unlockFile(f *os.File) error {
+	return nil
+}
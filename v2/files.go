@@ -0,0 +1,163 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// CopyDir recursively copies the directory src, and everything in it, to dst.
+// File permissions are preserved; symlinks and other special files are skipped.
+// The copy stops as soon as ctx is cancelled.
+func (t *Tools) CopyDir(ctx context.Context, src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("source is not a directory")
+	}
+
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode().IsRegular():
+			return copyFile(ctx, path, target, info.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+}
+
+// MoveFile moves the file src to dst. Unlike os.Rename, it also works when src and dst are on
+// different devices or volumes, by copying the file and then removing the original.
+func (t *Tools) MoveFile(ctx context.Context, src, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	// rename can't cross devices, so fall back to copying a regular file there, and only there
+	if !isCrossDevice(err) {
+		return err
+	}
+	info, statErr := os.Stat(src)
+	if statErr != nil || !info.Mode().IsRegular() {
+		return err
+	}
+
+	_, statErr = os.Lstat(dst)
+	if err = copyFile(ctx, src, dst, info.Mode().Perm()); err != nil {
+		// remove what the copy created, but not what was there before
+		if os.IsNotExist(statErr) {
+			os.Remove(dst)
+		}
+		return err
+	}
+	return os.Remove(src)
+}
+
+// RemoveContents deletes everything inside the directory dir, but leaves dir itself in place.
+func (t *Tools) RemoveContents(ctx context.Context, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DirSize returns the total size, in bytes, of all the regular files in dir and its subdirectories.
+func (t *Tools) DirSize(ctx context.Context, dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// copyFile copies the regular file src to dst, which is created with the given permissions.
+func copyFile(ctx context.Context, src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err = io.Copy(out, contextReader{ctx: ctx, r: in}); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// contextReader is an io.Reader which stops reading once its context is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read reads from the underlying reader, unless the context has been cancelled.
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
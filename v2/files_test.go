@@ -0,0 +1,134 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestFiles creates the given files, relative to dir.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var testDirFiles = map[string]string{
+	"a.txt":       "aaaa",
+	"sub/b.txt":   "bb",
+	"sub/c/d.txt": "dddddd",
+}
+
+func TestTools_CopyDir(t *testing.T) {
+	var testTool Tools
+
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "copy")
+	writeTestFiles(t, src, testDirFiles)
+
+	if err := testTool.CopyDir(context.Background(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range testDirFiles {
+		content, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s not copied: %s", name, err)
+			continue
+		}
+		if string(content) != expected {
+			t.Errorf("%s: wrong content %q", name, content)
+		}
+	}
+
+	// a cancelled context stops the copy
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := testTool.CopyDir(ctx, src, filepath.Join(t.TempDir(), "cancelled")); !errors.Is(err, context.Canceled) {
+		t.Error("expected context.Canceled, but got", err)
+	}
+}
+
+func TestTools_MoveFile(t *testing.T) {
+	var testTool Tools
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"from.txt": "move me"})
+
+	src, dst := filepath.Join(dir, "from.txt"), filepath.Join(dir, "to.txt")
+	if err := testTool.MoveFile(context.Background(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("expected source to be gone")
+	}
+	if content, _ := os.ReadFile(dst); string(content) != "move me" {
+		t.Errorf("wrong content moved %q", content)
+	}
+
+	if err := testTool.MoveFile(context.Background(), src, dst); err == nil {
+		t.Error("error expected when moving a missing file, but none received")
+	}
+
+	// errors other than crossing devices are returned as they are, and leave dst alone
+	emptyDir := filepath.Join(dir, "empty")
+	if err := os.Mkdir(emptyDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var linkErr *os.LinkError
+	if err := testTool.MoveFile(context.Background(), dst, emptyDir); !errors.As(err, &linkErr) {
+		t.Error("expected the error of the rename, got", err)
+	}
+	if info, err := os.Stat(emptyDir); err != nil || !info.IsDir() {
+		t.Error("expected the directory at dst to be kept, got", err)
+	}
+	if err := testTool.MoveFile(context.Background(), dst, filepath.Join(dir, "missing", "to.txt")); !errors.As(err, &linkErr) || !os.IsNotExist(err) {
+		t.Error("expected the rename to fail for a missing directory, got", err)
+	}
+	if _, err := os.Stat(dst); err != nil {
+		t.Error("expected the file to stay where it was, got", err)
+	}
+}
+
+func TestTools_RemoveContents(t *testing.T) {
+	var testTool Tools
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, testDirFiles)
+
+	if err := testTool.RemoveContents(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal("directory itself should still exist", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected directory to be empty, but it has %d entries", len(entries))
+	}
+}
+
+func TestTools_DirSize(t *testing.T) {
+	var testTool Tools
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, testDirFiles)
+
+	size, err := testTool.DirSize(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 12 {
+		t.Errorf("wrong size; expected 12 but got %d", size)
+	}
+}
@@ -0,0 +1,205 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileServerOptions is the type used to configure the handler returned by FileServer.
+type FileServerOptions struct {
+	// AllowDotFiles permits serving files and directories whose name starts with a dot, such as .env or .git.
+	AllowDotFiles bool
+	// AllowedDirs, if not empty, restricts the server to files within these directories (relative to root).
+	AllowedDirs []string
+	// DisableDirectoryListing stops directories without an index.html from being listed.
+	DisableDirectoryListing bool
+	// CacheMaxAge, if set, adds a Cache-Control header allowing clients to cache files for this long.
+	CacheMaxAge time.Duration
+	// SPAFallback serves root/index.html for requests which don't match a file and have no file extension,
+	// so that client side routes of single page applications work on reload.
+	SPAFallback bool
+}
+
+// FileServer returns a handler which serves the static files found in root.
+// Unlike http.FileServer, it denies dotfiles, refuses path traversal (including through symlinks pointing
+// outside of root), and can optionally restrict serving to some directories, disable directory listings,
+// add cache headers and serve an index.html fallback for single page applications.
+func (t *Tools) FileServer(root string, opts ...FileServerOptions) http.Handler {
+	var options FileServerOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	fsys := &restrictedFS{root: root, options: options}
+	fileServer := http.FileServer(fsys)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		// reject traversal attempts outright, rather than silently cleaning them away
+		for _, segment := range strings.Split(r.URL.Path, "/") {
+			if segment == ".." || strings.ContainsAny(segment, "\\\x00") {
+				http.Error(w, "invalid URL path", http.StatusBadRequest)
+				return
+			}
+		}
+
+		upath := path.Clean("/" + r.URL.Path)
+
+		f, err := fsys.Open(upath)
+		if err != nil {
+			if options.SPAFallback && errors.Is(err, fs.ErrNotExist) && path.Ext(upath) == "" && fsys.allowed("/index.html") {
+				t.serveSPAIndex(w, r, fsys)
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+		f.Close()
+
+		if options.CacheMaxAge > 0 {
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(options.CacheMaxAge.Seconds())))
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// serveSPAIndex serves the root index.html of fsys, which must not be cached so that new deployments are picked up.
+func (t *Tools) serveSPAIndex(w http.ResponseWriter, r *http.Request, fsys *restrictedFS) {
+	f, err := fsys.Open("/index.html")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// restrictedFS is an http.FileSystem which applies FileServerOptions to every file it opens.
+type restrictedFS struct {
+	root    string
+	options FileServerOptions
+}
+
+// Open opens the file at name, provided it is permitted by the options and resolves to a location within root.
+func (rfs *restrictedFS) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	if !rfs.allowed(name) {
+		return nil, fs.ErrNotExist
+	}
+
+	f, err := http.Dir(rfs.root).Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// symlinks must not lead outside of root
+	if !rfs.withinRoot(name) {
+		f.Close()
+		return nil, fs.ErrNotExist
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if info.IsDir() && rfs.options.DisableDirectoryListing {
+		if _, err := os.Stat(filepath.Join(rfs.root, filepath.FromSlash(name), "index.html")); err != nil {
+			f.Close()
+			return nil, fs.ErrNotExist
+		}
+	}
+
+	return restrictedFile{File: f, fs: rfs, name: name}, nil
+}
+
+// allowed reports whether the cleaned, slash separated name may be served at all.
+func (rfs *restrictedFS) allowed(name string) bool {
+	if !rfs.options.AllowDotFiles {
+		for _, segment := range strings.Split(name, "/") {
+			if strings.HasPrefix(segment, ".") {
+				return false
+			}
+		}
+	}
+
+	if len(rfs.options.AllowedDirs) == 0 {
+		return true
+	}
+
+	for _, dir := range rfs.options.AllowedDirs {
+		dir = path.Clean("/" + filepath.ToSlash(dir))
+		// the root itself, and the path to each allowed directory, must be reachable too
+		if name == dir || strings.HasPrefix(name, strings.TrimSuffix(dir, "/")+"/") || strings.HasPrefix(dir, strings.TrimSuffix(name, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// withinRoot reports whether name, once all symlinks are resolved, is still located inside root.
+func (rfs *restrictedFS) withinRoot(name string) bool {
+	root, err := filepath.EvalSymlinks(rfs.root)
+	if err != nil {
+		return false
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(rfs.root, filepath.FromSlash(name)))
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, resolved)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// restrictedFile is an http.File which hides entries that may not be served from directory listings.
+type restrictedFile struct {
+	http.File
+	fs   *restrictedFS
+	name string
+}
+
+// Readdir returns the directory entries, leaving out dotfiles and directories which are not allowed.
+// With n > 0, it reads on until it has n visible entries, or the end of the directory, where it
+// returns io.EOF if it has none, as os.File.Readdir does.
+func (f restrictedFile) Readdir(n int) ([]fs.FileInfo, error) {
+	var visible []fs.FileInfo
+	for {
+		entries, err := f.File.Readdir(n - len(visible))
+		if n > 0 && len(entries) == 0 && err == nil {
+			err = io.EOF
+		}
+		for _, entry := range entries {
+			if f.fs.allowed(path.Join(f.name, entry.Name())) {
+				visible = append(visible, entry)
+			}
+		}
+		if n <= 0 || len(visible) == n || err != nil {
+			if n > 0 && len(visible) > 0 && err == io.EOF {
+				err = nil
+			}
+			return visible, err
+		}
+	}
+}
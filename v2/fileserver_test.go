@@ -0,0 +1,147 @@
+package toolkit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createFileServerRoot builds a small static site in a temporary directory, along with a secret file outside of it.
+func createFileServerRoot(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "public")
+
+	files := map[string]string{
+		"public/index.html":         "<html>index</html>",
+		"public/app.js":             "console.log('app')",
+		"public/.env":               "SECRET=1",
+		"public/assets/logo.txt":    "logo",
+		"public/private/secret.txt": "secret",
+		"public/empty/.keep":        "",
+		"outside.txt":               "outside",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink(filepath.Join(dir, "outside.txt"), filepath.Join(root, "escape.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
+
+var fileServerTests = []struct {
+	name           string
+	options        FileServerOptions
+	method         string
+	path           string
+	expectedStatus int
+	expectedBody   string
+}{
+	{name: "file", path: "/app.js", expectedStatus: http.StatusOK, expectedBody: "console.log('app')"},
+	{name: "nested file", path: "/assets/logo.txt", expectedStatus: http.StatusOK, expectedBody: "logo"},
+	{name: "index", path: "/", expectedStatus: http.StatusOK, expectedBody: "<html>index</html>"},
+	{name: "dotfile", path: "/.env", expectedStatus: http.StatusNotFound},
+	{name: "dotfile allowed", options: FileServerOptions{AllowDotFiles: true}, path: "/.env", expectedStatus: http.StatusOK, expectedBody: "SECRET=1"},
+	{name: "traversal", path: "/assets/../../outside.txt", expectedStatus: http.StatusBadRequest},
+	{name: "encoded traversal", path: "/assets/%2e%2e/%2e%2e/outside.txt", expectedStatus: http.StatusBadRequest},
+	{name: "symlink escape", path: "/escape.txt", expectedStatus: http.StatusNotFound},
+	{name: "missing", path: "/missing.txt", expectedStatus: http.StatusNotFound},
+	{name: "method not allowed", method: http.MethodPost, path: "/app.js", expectedStatus: http.StatusMethodNotAllowed},
+	{name: "allowed dir", options: FileServerOptions{AllowedDirs: []string{"assets"}}, path: "/assets/logo.txt", expectedStatus: http.StatusOK, expectedBody: "logo"},
+	{name: "outside allowed dir", options: FileServerOptions{AllowedDirs: []string{"assets"}}, path: "/private/secret.txt", expectedStatus: http.StatusNotFound},
+	{name: "directory listing", path: "/private/", expectedStatus: http.StatusOK, expectedBody: "secret.txt"},
+	{name: "directory listing disabled", options: FileServerOptions{DisableDirectoryListing: true}, path: "/private/", expectedStatus: http.StatusNotFound},
+	{name: "spa fallback", options: FileServerOptions{SPAFallback: true}, path: "/users/42", expectedStatus: http.StatusOK, expectedBody: "<html>index</html>"},
+	{name: "spa fallback skips assets", options: FileServerOptions{SPAFallback: true}, path: "/missing.js", expectedStatus: http.StatusNotFound},
+}
+
+func TestTools_FileServer(t *testing.T) {
+	root := createFileServerRoot(t)
+
+	var testTool Tools
+	for _, test := range fileServerTests {
+		method := test.method
+		if method == "" {
+			method = http.MethodGet
+		}
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, test.path, nil)
+		testTool.FileServer(root, test.options).ServeHTTP(rec, req)
+
+		if rec.Code != test.expectedStatus {
+			t.Errorf("%s: wrong status code; expected %d but got %d", test.name, test.expectedStatus, rec.Code)
+		}
+		if test.expectedBody != "" && !strings.Contains(rec.Body.String(), test.expectedBody) {
+			t.Errorf("%s: expected body to contain %q but got %q", test.name, test.expectedBody, rec.Body.String())
+		}
+	}
+}
+
+func TestTools_FileServerDirectoryListingHidesDotFiles(t *testing.T) {
+	root := createFileServerRoot(t)
+
+	var testTool Tools
+	rec := httptest.NewRecorder()
+	testTool.FileServer(root).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/empty/", nil))
+
+	if strings.Contains(rec.Body.String(), ".keep") {
+		t.Error("dotfile shown in directory listing")
+	}
+
+	// reading a few entries at a time skips the hidden ones, rather than returning none before the end
+	fsys := &restrictedFS{root: root}
+	dir, err := fsys.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+	var names []string
+	for {
+		entries, err := dir.Readdir(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("expected one entry, got %d, %v", len(entries), err)
+		}
+		names = append(names, entries[0].Name())
+	}
+	if len(names) != 6 || strings.Contains(strings.Join(names, ","), ".env") {
+		t.Errorf("wrong entries %v", names)
+	}
+}
+
+func TestTools_FileServerCacheHeaders(t *testing.T) {
+	root := createFileServerRoot(t)
+
+	var testTool Tools
+	handler := testTool.FileServer(root, FileServerOptions{CacheMaxAge: time.Hour, SPAFallback: true})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/app.js", nil))
+	if rec.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Error("wrong cache control header", rec.Header().Get("Cache-Control"))
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/some/route", nil))
+	if rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Error("wrong cache control header for spa fallback", rec.Header().Get("Cache-Control"))
+	}
+}
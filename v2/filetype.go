@@ -0,0 +1,207 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// fileSignature is a magic number found at offset in files of type mime.
+type fileSignature struct {
+	offset int
+	magic  []byte
+	mime   string
+}
+
+// fileSignatures are the formats http.DetectContentType doesn't know, or mistakes for others.
+var fileSignatures = []fileSignature{
+	{0, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), "application/x-ole-storage"}, // doc, xls, ppt
+	{0, []byte(`{\rtf`), "application/rtf"},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "application/x-7z-compressed"},
+	{0, []byte("Rar!\x1a\x07"), "application/vnd.rar"},
+	{0, []byte("\xfd7zXZ\x00"), "application/x-xz"},
+	{0, []byte("\x28\xb5\x2f\xfd"), "application/zstd"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+
+	{0, []byte("fLaC"), "audio/flac"},
+	{0, []byte("#!AMR"), "audio/amr"},
+	{0, []byte("\xff\xfb"), "audio/mpeg"},
+	{0, []byte("\xff\xf3"), "audio/mpeg"},
+	{0, []byte("\xff\xf2"), "audio/mpeg"},
+	{0, []byte("\xff\xf1"), "audio/aac"},
+	{0, []byte("\xff\xf9"), "audio/aac"},
+	{28, []byte("OpusHead"), "audio/ogg"},
+	{28, []byte("\x01vorbis"), "audio/ogg"},
+	{28, []byte("\x80theora"), "video/ogg"},
+
+	{0, []byte("FLV\x01"), "video/x-flv"},
+	{0, []byte("\x00\x00\x01\xba"), "video/mpeg"},
+	{0, []byte("\x00\x00\x01\xb3"), "video/mpeg"},
+
+	{0, []byte("ttcf"), "font/collection"},
+
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{0, []byte("8BPS"), "image/vnd.adobe.photoshop"},
+	{0, []byte("\xff\x0a"), "image/jxl"},
+	{0, []byte("\x00\x00\x00\x0cJXL \x0d\x0a\x87\x0a"), "image/jxl"},
+}
+
+// ftypBrands are the content types of ISO base media files (mp4, mov, heic…) by their major brand.
+var ftypBrands = map[string]string{
+	"M4A ": "audio/mp4",
+	"M4B ": "audio/mp4",
+	"M4V ": "video/x-m4v",
+	"qt  ": "video/quicktime",
+	"3gp4": "video/3gpp",
+	"3gp5": "video/3gpp",
+	"3gp6": "video/3gpp",
+	"3g2a": "video/3gpp2",
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif",
+	"avif": "image/avif",
+	"avis": "image/avif",
+	"crx ": "image/x-canon-cr3",
+}
+
+// officeDirectories are the content types of Office Open XML documents by the directory of their parts.
+var officeDirectories = map[string]string{
+	"word/": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"xl/":   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"ppt/":  "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+}
+
+// DetectFileType returns the content type of the file in r, of size bytes, as http.DetectContentType
+// does, but knowing more formats: office documents, which are zip archives whose entries are looked
+// at to tell them apart (docx, xlsx, pptx, OpenDocument, EPUB), as well as common audio, video, font,
+// image and archive formats, from tables of magic numbers.
+func DetectFileType(r io.ReaderAt, size int64) (string, error) {
+	header := make([]byte, 512)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	header = header[:n]
+
+	for _, signature := range fileSignatures {
+		if len(header) >= signature.offset+len(signature.magic) &&
+			bytes.Equal(header[signature.offset:signature.offset+len(signature.magic)], signature.magic) {
+			return signature.mime, nil
+		}
+	}
+
+	switch {
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		if fileType, ok := ftypBrands[string(header[8:12])]; ok {
+			return fileType, nil
+		}
+		return "video/mp4", nil
+	case bytes.HasPrefix(header, []byte("\x1a\x45\xdf\xa3")) && bytes.Contains(header, []byte("matroska")):
+		return "video/x-matroska", nil
+	case len(header) >= 4 && string(header[:3]) == "BZh" && header[3] >= '1' && header[3] <= '9':
+		return "application/x-bzip2", nil
+	case len(header) > 376 && header[0] == 0x47 && header[188] == 0x47 && header[376] == 0x47:
+		return "video/mp2t", nil
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		if fileType := zipFileType(r, size); fileType != "" {
+			return fileType, nil
+		}
+	}
+
+	return http.DetectContentType(header), nil
+}
+
+// zipFileType returns the content type of the document in the zip archive r, or "" if it isn't one.
+func zipFileType(r io.ReaderAt, size int64) string {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return ""
+	}
+
+	for _, file := range zr.File {
+		// OpenDocument and EPUB files name their content type in a first, uncompressed, entry, which is
+		// only believed for those types, since whoever made the archive can write anything there
+		if file.Name == "mimetype" {
+			rc, err := file.Open()
+			if err != nil {
+				return ""
+			}
+			content, _ := io.ReadAll(io.LimitReader(rc, 128))
+			rc.Close()
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(string(content)))
+			if err == nil && (strings.HasPrefix(mediaType, "application/vnd.oasis.opendocument.") || mediaType == "application/epub+zip") {
+				return mediaType
+			}
+			return ""
+		}
+		for dir, fileType := range officeDirectories {
+			if strings.HasPrefix(file.Name, dir) {
+				return fileType
+			}
+		}
+	}
+	return ""
+}
+
+// fileTypeAliases are the friendly names AllowedFileTypes may use for groups of content types.
+var fileTypeAliases = map[string][]string{
+	"image": {"image/*"},
+	"video": {"video/*"},
+	"audio": {"audio/*"},
+	"font":  {"font/*"},
+	// other text types, such as text/html, are scripts once served back
+	"text": {"text/plain", "text/csv"},
+	"document": {
+		"application/pdf",
+		"application/rtf",
+		"application/x-ole-storage",
+		"application/vnd.openxmlformats-officedocument.*",
+		"application/vnd.oasis.opendocument.*",
+		"text/plain",
+	},
+	"archive": {
+		"application/zip",
+		"application/x-gzip",
+		"application/x-tar",
+		"application/x-7z-compressed",
+		"application/vnd.rar",
+		"application/x-bzip2",
+		"application/x-xz",
+		"application/zstd",
+	},
+}
+
+// fileTypeAllowed reports whether fileType, as found by DetectFileType, matches any of allowed: a content
+// type, with or without parameters, a wildcard such as video/* or application/vnd.oasis.opendocument.*,
+// or one of the aliases image, video, audio, font, text, document and archive.
+func fileTypeAllowed(fileType string, allowed []string) bool {
+	mediaType, _, _ := strings.Cut(fileType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	for _, pattern := range allowed {
+		if strings.EqualFold(fileType, pattern) {
+			return true
+		}
+		patterns := []string{pattern}
+		if alias, ok := fileTypeAliases[strings.ToLower(pattern)]; ok {
+			patterns = alias
+		}
+		for _, p := range patterns {
+			p = strings.ToLower(strings.TrimSpace(p))
+			if strings.HasSuffix(p, "*") {
+				if strings.HasPrefix(mediaType, p[:len(p)-1]) {
+					return true
+				}
+			} else if mediaType == p {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// makeDocument builds a zip archive in memory with the given entries, in order, the first one stored.
+func makeDocument(t *testing.T, names []string, contents []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i, name := range names {
+		method := zip.Deflate
+		if i == 0 {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(contents[i]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectFileType(t *testing.T) {
+	mpegTS := make([]byte, 512)
+	mpegTS[0], mpegTS[188], mpegTS[376] = 0x47, 0x47, 0x47
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{name: "docx", data: makeDocument(t, []string{"[Content_Types].xml", "_rels/.rels", "word/document.xml"}, []string{"<Types/>", "<Relationships/>", "<w:document/>"}), expected: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{name: "xlsx", data: makeDocument(t, []string{"[Content_Types].xml", "xl/workbook.xml"}, []string{"<Types/>", "<workbook/>"}), expected: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{name: "pptx", data: makeDocument(t, []string{"[Content_Types].xml", "ppt/presentation.xml"}, []string{"<Types/>", "<p/>"}), expected: "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+		{name: "odt", data: makeDocument(t, []string{"mimetype", "content.xml"}, []string{"application/vnd.oasis.opendocument.text", "<office/>"}), expected: "application/vnd.oasis.opendocument.text"},
+		{name: "epub", data: makeDocument(t, []string{"mimetype", "META-INF/container.xml"}, []string{"application/epub+zip", "<container/>"}), expected: "application/epub+zip"},
+		{name: "spoofed mimetype", data: makeDocument(t, []string{"mimetype", "image.png"}, []string{"image/png", "\x89PNG"}), expected: "application/zip"},
+		{name: "plain zip", data: makeDocument(t, []string{"a.txt"}, []string{"a"}), expected: "application/zip"},
+		{name: "doc", data: []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1\x00\x00"), expected: "application/x-ole-storage"},
+		{name: "mp4", data: []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00"), expected: "video/mp4"},
+		{name: "mov", data: []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x02\x00"), expected: "video/quicktime"},
+		{name: "m4a", data: []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x02\x00"), expected: "audio/mp4"},
+		{name: "heic", data: []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), expected: "image/heic"},
+		{name: "mkv", data: []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x88matroska"), expected: "video/x-matroska"},
+		{name: "webm", data: []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm"), expected: "video/webm"},
+		{name: "mpeg-ts", data: mpegTS, expected: "video/mp2t"},
+		{name: "flac", data: []byte("fLaC\x00\x00\x00\x22"), expected: "audio/flac"},
+		{name: "mp3 without id3", data: []byte("\xff\xfb\x90\x64\x00"), expected: "audio/mpeg"},
+		{name: "opus", data: append([]byte("OggS\x00\x02"+strings.Repeat("\x00", 22)), "OpusHead"...), expected: "audio/ogg"},
+		{name: "flv", data: []byte("FLV\x01\x05"), expected: "video/x-flv"},
+		{name: "woff2", data: []byte("wOF2\x00\x01\x00\x00"), expected: "font/woff2"},
+		{name: "tiff", data: []byte("II*\x00\x08\x00"), expected: "image/tiff"},
+		{name: "7z", data: []byte("7z\xbc\xaf\x27\x1c\x00\x04"), expected: "application/x-7z-compressed"},
+		{name: "bzip2", data: []byte("BZh91AY&SY"), expected: "application/x-bzip2"},
+		{name: "text starting like bzip2", data: []byte("BZhello"), expected: "text/plain; charset=utf-8"},
+		{name: "png", data: []byte("\x89PNG\r\n\x1a\n"), expected: "image/png"},
+		{name: "text", data: []byte("hello"), expected: "text/plain; charset=utf-8"},
+	}
+	for _, test := range tests {
+		fileType, err := DetectFileType(bytes.NewReader(test.data), int64(len(test.data)))
+		if err != nil || fileType != test.expected {
+			t.Errorf("%s: expected %s, got %s (%v)", test.name, test.expected, fileType, err)
+		}
+	}
+}
+
+var fileTypeAllowedTests = []struct {
+	fileType string
+	allowed  []string
+	expected bool
+}{
+	{fileType: "image/png", allowed: []string{"image/png"}, expected: true},
+	{fileType: "image/png", allowed: []string{"IMAGE/PNG"}, expected: true},
+	{fileType: "image/png", allowed: []string{"image"}, expected: true},
+	{fileType: "image/png", allowed: []string{"image/*"}, expected: true},
+	{fileType: "image/png", allowed: []string{"video/*", "audio"}, expected: false},
+	{fileType: "video/quicktime", allowed: []string{"video"}, expected: true},
+	{fileType: "text/plain; charset=utf-8", allowed: []string{"text/plain; charset=utf-8"}, expected: true},
+	{fileType: "text/plain; charset=utf-8", allowed: []string{"text/plain"}, expected: true},
+	{fileType: "text/plain; charset=utf-16le", allowed: []string{"text/plain; charset=utf-8"}, expected: false},
+	{fileType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", allowed: []string{"document"}, expected: true},
+	{fileType: "application/zip", allowed: []string{"document"}, expected: false},
+	{fileType: "application/zip", allowed: []string{"archive"}, expected: true},
+	{fileType: "application/x-imagemagick", allowed: []string{"image"}, expected: false},
+	{fileType: "text/csv", allowed: []string{"text"}, expected: true},
+	{fileType: "text/html; charset=utf-8", allowed: []string{"text"}, expected: false},
+	{fileType: "text/xml; charset=utf-8", allowed: []string{"text"}, expected: false},
+}
+
+func TestFileTypeAllowed(t *testing.T) {
+	for _, test := range fileTypeAllowedTests {
+		if got := fileTypeAllowed(test.fileType, test.allowed); got != test.expected {
+			t.Errorf("%s %v: expected %t, got %t", test.fileType, test.allowed, test.expected, got)
+		}
+	}
+}
+
+func TestTools_UploadFilesDetectsOfficeDocuments(t *testing.T) {
+	docx := makeDocument(t, []string{"[Content_Types].xml", "word/document.xml"}, []string{"<Types/>", "<w:document/>"})
+
+	for _, e := range []struct {
+		allowed []string
+		errored bool
+	}{
+		{allowed: []string{"document"}},
+		{allowed: []string{"application/zip"}, errored: true},
+	} {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, _ := writer.CreateFormFile("file", "report.docx")
+		_, _ = part.Write(docx)
+		_ = writer.Close()
+
+		request := httptest.NewRequest("POST", "/", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+
+		testTools := Tools{AllowedFileTypes: e.allowed}
+		_, err := testTools.UploadFiles(request, t.TempDir())
+		if (err != nil) != e.errored {
+			t.Errorf("%v: expected an error to be %t, got %v", e.allowed, e.errored, err)
+		}
+	}
+}
+
+func TestTools_UploadFilesRefusesSpoofedMimetype(t *testing.T) {
+	spoofed := makeDocument(t, []string{"mimetype", "payload.html"}, []string{"image/png", "<script></script>"})
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", "photo.png")
+	_, _ = part.Write(spoofed)
+	_ = writer.Close()
+
+	request := httptest.NewRequest("POST", "/", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	testTools := Tools{AllowedFileTypes: []string{"image"}}
+	if _, err := testTools.UploadFiles(request, t.TempDir()); err == nil {
+		t.Error("expected a zip claiming to be an image to be refused")
+	}
+}
@@ -0,0 +1,163 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const geoLocationContextKey contextKey = "geoLocation"
+
+// GeoLocation is where an IP address is, as far as a GeoIP knows.
+type GeoLocation struct {
+	// Country is the ISO 3166-1 code of the country, such as FR.
+	Country     string `json:"country"`
+	CountryName string `json:"country_name,omitempty"`
+	// Region is the ISO 3166-2 code of the region, without the country, such as IDF.
+	Region     string  `json:"region,omitempty"`
+	RegionName string  `json:"region_name,omitempty"`
+	City       string  `json:"city,omitempty"`
+	PostalCode string  `json:"postal_code,omitempty"`
+	Latitude   float64 `json:"latitude,omitempty"`
+	Longitude  float64 `json:"longitude,omitempty"`
+	// TimeZone is the IANA time zone, such as Europe/Paris.
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// GeoIP is the interface implemented by the ways to locate IP addresses, such as an MMDB file or a
+// remote API.
+type GeoIP interface {
+	// Lookup returns the location of ip, or an error wrapping ErrNotFound if it is unknown.
+	Lookup(ctx context.Context, ip string) (*GeoLocation, error)
+}
+
+// GeoIPFunc is an adapter to use a function as a GeoIP.
+type GeoIPFunc func(ctx context.Context, ip string) (*GeoLocation, error)
+
+// Lookup calls f(ctx, ip).
+func (f GeoIPFunc) Lookup(ctx context.Context, ip string) (*GeoLocation, error) {
+	return f(ctx, ip)
+}
+
+// FallbackGeoIP returns a GeoIP asking each of geoips in turn, until one knows the address, such as a
+// local MMDB file first, and a remote API for the addresses missing from it. Other errors are
+// returned at once.
+func FallbackGeoIP(geoips ...GeoIP) GeoIP {
+	return GeoIPFunc(func(ctx context.Context, ip string) (*GeoLocation, error) {
+		err := fmt.Errorf("IP address %s: %w", ip, ErrNotFound)
+		for _, geoip := range geoips {
+			var location *GeoLocation
+			if location, err = geoip.Lookup(ctx, ip); !errors.Is(err, ErrNotFound) {
+				return location, err
+			}
+		}
+		return nil, err
+	})
+}
+
+// RemoteGeoIPOptions is the type used to configure RemoteGeoIP.
+type RemoteGeoIPOptions struct {
+	// URL is the URL of the API, where {ip} is replaced by the address, such as https://ipapi.co/{ip}/json/.
+	URL string
+	// Decode returns the location described by a response of the API. Defaults to decoding it into
+	// a GeoLocation, by the JSON names of its fields.
+	Decode func(body json.RawMessage) (*GeoLocation, error)
+	// Client, if set, is the client used to call the API.
+	Client *http.Client
+	// Timeout is how long a lookup may take, retries included, within the deadline of its context.
+	// Defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// RemoteGeoIP returns a GeoIP calling a remote API with GetJSONFromRemote, so that responses are
+// cached in Tools.Cache for as long as the API allows, and failed calls are retried according to
+// Tools.RemoteRetry. A 404 response, or a location without a country, is reported as ErrNotFound.
+// Lookups end with their context, such as when the client of the request being located goes away.
+func (t *Tools) RemoteGeoIP(opts RemoteGeoIPOptions) GeoIP {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	return GeoIPFunc(func(ctx context.Context, ip string) (*GeoLocation, error) {
+		ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+		uri := strings.ReplaceAll(opts.URL, "{ip}", url.PathEscape(ip))
+		var clients []*http.Client
+		if opts.Client != nil {
+			clients = append(clients, opts.Client)
+		}
+
+		var body json.RawMessage
+		status, err := t.getJSONFromRemote(ctx, uri, &body, clients)
+		if status == http.StatusNotFound {
+			return nil, fmt.Errorf("IP address %s: %w", ip, ErrNotFound)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if status < 200 || status > 299 {
+			return nil, fmt.Errorf("geoip lookup of %s: status %d", ip, status)
+		}
+
+		location := &GeoLocation{}
+		if opts.Decode != nil {
+			location, err = opts.Decode(body)
+		} else {
+			err = json.Unmarshal(body, location)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if location == nil || location.Country == "" {
+			return nil, fmt.Errorf("IP address %s: %w", ip, ErrNotFound)
+		}
+		return location, nil
+	})
+}
+
+// GeoLocate is middleware locating the client of each request, at the address found by RealIP, with
+// geoip, and storing its location in the request context, where GeoLocationFromContext finds it, such
+// as to pick a currency or a default locale, or to rate limit by country with RateLimitByCountry.
+// Private addresses, unknown addresses and failed lookups leave the request without a location.
+func (t *Tools) GeoLocate(geoip GeoIP) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := t.RealIP(r)
+			if IsPrivateIP(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			location, err := geoip.Lookup(r.Context(), ip)
+			if err != nil {
+				if !errors.Is(err, ErrNotFound) {
+					t.logger().Warn("geoip lookup failed", "ip", ip, "err", err)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), geoLocationContextKey, location)))
+		})
+	}
+}
+
+// GeoLocationFromContext returns the location stored in ctx by the GeoLocate middleware, or nil if
+// there is none.
+func GeoLocationFromContext(ctx context.Context) *GeoLocation {
+	location, _ := ctx.Value(geoLocationContextKey).(*GeoLocation)
+	return location
+}
+
+// RateLimitByCountry is a RateLimitOptions.KeyFunc which counts requests per country of the client,
+// as found by the GeoLocate middleware, falling back to the client IP address when the country is
+// unknown.
+func RateLimitByCountry(r *http.Request) string {
+	if location := GeoLocationFromContext(r.Context()); location != nil && location.Country != "" {
+		return "country:" + location.Country
+	}
+	return RateLimitByIP(r)
+}
@@ -0,0 +1,199 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTools_RemoteGeoIP(t *testing.T) {
+	var paths []string
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		paths = append(paths, req.URL.Path)
+		status, body := http.StatusOK, `{"country_code":"FR","city":"Paris","timezone":"Europe/Paris"}`
+		switch req.URL.Path {
+		case "/8.8.8.8/json":
+			body = `{"country":"US","city":"Mountain View"}`
+		case "/10.0.0.1/json":
+			status, body = http.StatusNotFound, `{"error":true}`
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewBufferString(body)),
+		}
+	})
+
+	var testTools Tools
+	geoip := testTools.RemoteGeoIP(RemoteGeoIPOptions{URL: "https://geo.example.com/{ip}/json", Client: client})
+	location, err := geoip.Lookup(context.Background(), "8.8.8.8")
+	if err != nil || location.Country != "US" || location.City != "Mountain View" {
+		t.Errorf("expected Mountain View, got %+v, %v", location, err)
+	}
+	if _, err = geoip.Lookup(context.Background(), "10.0.0.1"); !errors.Is(err, ErrNotFound) {
+		t.Error("expected ErrNotFound for a 404, got", err)
+	}
+	// the default decoding finds no country in the fields of another API
+	if _, err = geoip.Lookup(context.Background(), "1.1.1.1"); !errors.Is(err, ErrNotFound) {
+		t.Error("expected ErrNotFound without a country, got", err)
+	}
+
+	geoip = testTools.RemoteGeoIP(RemoteGeoIPOptions{
+		URL:    "https://geo.example.com/{ip}/json",
+		Client: client,
+		Decode: func(body json.RawMessage) (*GeoLocation, error) {
+			var response struct {
+				CountryCode string `json:"country_code"`
+				City        string `json:"city"`
+				TimeZone    string `json:"timezone"`
+			}
+			err := json.Unmarshal(body, &response)
+			return &GeoLocation{Country: response.CountryCode, City: response.City, TimeZone: response.TimeZone}, err
+		},
+	})
+	location, err = geoip.Lookup(context.Background(), "2a02:ec0::1")
+	if err != nil || location.Country != "FR" || location.TimeZone != "Europe/Paris" {
+		t.Errorf("expected Paris, got %+v, %v", location, err)
+	}
+	if paths[len(paths)-1] != "/2a02:ec0::1/json" {
+		t.Errorf("wrong path %s", paths[len(paths)-1])
+	}
+}
+
+func TestTools_RemoteGeoIP_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	var testTools Tools
+	geoip := testTools.RemoteGeoIP(RemoteGeoIPOptions{URL: server.URL + "/{ip}", Timeout: 50 * time.Millisecond})
+	start := time.Now()
+	if _, err := geoip.Lookup(context.Background(), "8.8.8.8"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected the lookup to time out, got", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the lookup to end after its timeout, took %v", elapsed)
+	}
+
+	// the context of the request ends the lookup before the timeout
+	geoip = testTools.RemoteGeoIP(RemoteGeoIPOptions{URL: server.URL + "/{ip}"})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start = time.Now()
+	if _, err := geoip.Lookup(ctx, "8.8.8.8"); !errors.Is(err, context.Canceled) {
+		t.Error("expected the lookup to be canceled, got", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the lookup to end with its context, took %v", elapsed)
+	}
+}
+
+func TestFallbackGeoIP(t *testing.T) {
+	local, err := NewMMDB(testMMDB(t, 24))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var remoteCalls int
+	remote := GeoIPFunc(func(ctx context.Context, ip string) (*GeoLocation, error) {
+		remoteCalls++
+		if ip == "9.9.9.9" {
+			return &GeoLocation{Country: "CH"}, nil
+		}
+		return nil, ErrNotFound
+	})
+
+	geoip := FallbackGeoIP(local, remote)
+	tests := []struct {
+		ip      string
+		country string
+		calls   int
+	}{
+		{ip: "81.2.69.160", country: "GB", calls: 0},
+		{ip: "9.9.9.9", country: "CH", calls: 1},
+		{ip: "1.2.3.4", calls: 2},
+	}
+	for _, test := range tests {
+		location, err := geoip.Lookup(context.Background(), test.ip)
+		if test.country == "" {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s: expected ErrNotFound, got %v", test.ip, err)
+			}
+		} else if err != nil || location.Country != test.country {
+			t.Errorf("%s: expected %s, got %+v, %v", test.ip, test.country, location, err)
+		}
+		if remoteCalls != test.calls {
+			t.Errorf("%s: expected %d remote calls, got %d", test.ip, test.calls, remoteCalls)
+		}
+	}
+
+	failing := GeoIPFunc(func(ctx context.Context, ip string) (*GeoLocation, error) {
+		return nil, errors.New("unavailable")
+	})
+	if _, err = FallbackGeoIP(failing, remote).Lookup(context.Background(), "9.9.9.9"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Error("expected the error of the first GeoIP, got", err)
+	}
+}
+
+func TestTools_GeoLocate(t *testing.T) {
+	db, err := NewMMDB(testMMDB(t, 24))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger, TrustedProxies: []string{"10.0.0.0/8"}}
+
+	var location *GeoLocation
+	var key string
+	handler := testTools.GeoLocate(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		location = GeoLocationFromContext(r.Context())
+		key = RateLimitByCountry(r)
+	}))
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		country   string
+		key       string
+	}{
+		{name: "direct", remote: "81.2.69.160:4000", country: "GB", key: "country:GB"},
+		{name: "behind a proxy", remote: "10.0.0.2:4000", forwarded: "81.2.69.1", country: "GB", key: "country:GB"},
+		{name: "unknown", remote: "8.8.8.8:4000", key: "8.8.8.8"},
+		{name: "private", remote: "192.168.1.10:4000", key: "192.168.1.10"},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.RemoteAddr = test.remote
+		if test.forwarded != "" {
+			request.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		if test.country == "" && location != nil {
+			t.Errorf("%s: expected no location, got %+v", test.name, location)
+		}
+		if test.country != "" && (location == nil || location.Country != test.country) {
+			t.Errorf("%s: expected %s, got %+v", test.name, test.country, location)
+		}
+		if key != test.key {
+			t.Errorf("%s: expected rate limit key %q, got %q", test.name, test.key, key)
+		}
+	}
+
+	handler = testTools.GeoLocate(GeoIPFunc(func(ctx context.Context, ip string) (*GeoLocation, error) {
+		return nil, errors.New("database closed")
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := httptest.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "8.8.8.8:4000"
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if !logger.contains("WARN geoip lookup failed") {
+		t.Error("expected the failed lookup to be logged")
+	}
+}
@@ -0,0 +1,127 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthChecker is a registry of named health checks, such as pinging a database, a cache or a remote API.
+type HealthChecker struct {
+	// Timeout is how long each check may take before it counts as failed. Defaults to 5 seconds.
+	Timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]func(ctx context.Context) error
+}
+
+// HealthReport is the structured result of running all the health checks.
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// HealthCheckResult is the result of a single health check.
+type HealthCheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// NewHealthChecker returns an empty HealthChecker.
+func NewHealthChecker() *HealthChecker {
+	return &HealthChecker{checks: make(map[string]func(ctx context.Context) error)}
+}
+
+// Register adds the check called name, replacing any check registered under the same name.
+// A check reports a problem by returning an error, and should give up when ctx is done.
+func (h *HealthChecker) Register(name string, check func(ctx context.Context) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// Check runs every registered check concurrently, each with its own timeout, and reports the results.
+// The overall status is "ok" only if every check passed.
+func (h *HealthChecker) Check(ctx context.Context) HealthReport {
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]func(ctx context.Context) error, len(names))
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.mu.RUnlock()
+
+	results := make([]HealthCheckResult, len(names))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = h.run(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: "ok", Checks: make(map[string]HealthCheckResult, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != "ok" {
+			report.Status = "unavailable"
+		}
+	}
+	return report
+}
+
+// run runs a single check, giving up once its timeout has passed, even if the check ignores its context.
+func (h *HealthChecker) run(ctx context.Context, check func(ctx context.Context) error) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, durationOr(h.Timeout, 5*time.Second))
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := HealthCheckResult{Status: "ok", Duration: time.Since(start).Round(time.Millisecond).String()}
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// HealthzHandler returns a liveness handler, for /healthz, which reports that the process is up and serving.
+func (t *Tools) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = t.WriteJSON(w, http.StatusOK, HealthReport{Status: "ok"})
+	})
+}
+
+// ReadyzHandler returns a readiness handler, for /readyz, which runs the checks registered with checker.
+// It responds with 200 when all of them pass, and 503 otherwise, with the result of each check as JSON.
+func (t *Tools) ReadyzHandler(checker *HealthChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Check(r.Context())
+
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		_ = t.WriteJSON(w, status, report)
+	})
+}
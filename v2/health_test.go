@@ -0,0 +1,87 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthChecker_Check(t *testing.T) {
+	checker := NewHealthChecker()
+	checker.Timeout = 50 * time.Millisecond
+
+	checker.Register("database", func(ctx context.Context) error { return nil })
+	checker.Register("cache", func(ctx context.Context) error { return errors.New("connection refused") })
+	checker.Register("remote", func(ctx context.Context) error {
+		// a check which ignores its context still times out
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	report := checker.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("checks did not run concurrently with timeouts; took %s", elapsed)
+	}
+
+	if report.Status != "unavailable" {
+		t.Error("wrong overall status", report.Status)
+	}
+	if report.Checks["database"].Status != "ok" {
+		t.Errorf("wrong database result %+v", report.Checks["database"])
+	}
+	if report.Checks["cache"].Error != "connection refused" {
+		t.Errorf("wrong cache result %+v", report.Checks["cache"])
+	}
+	if report.Checks["remote"].Status != "failed" {
+		t.Errorf("wrong remote result %+v", report.Checks["remote"])
+	}
+}
+
+func TestTools_ReadyzHandler(t *testing.T) {
+	var testTools Tools
+
+	checker := NewHealthChecker()
+	healthy := true
+	checker.Register("database", func(ctx context.Context) error {
+		if !healthy {
+			return errors.New("down")
+		}
+		return nil
+	})
+
+	rr := httptest.NewRecorder()
+	testTools.ReadyzHandler(checker).ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("wrong status code; expected 200 but got %d", rr.Code)
+	}
+
+	healthy = false
+	rr = httptest.NewRecorder()
+	testTools.ReadyzHandler(checker).ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("wrong status code; expected 503 but got %d", rr.Code)
+	}
+
+	var report HealthReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Checks["database"].Error != "down" {
+		t.Errorf("wrong report %+v", report)
+	}
+}
+
+func TestTools_HealthzHandler(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	testTools.HealthzHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"status":"ok"}` {
+		t.Errorf("wrong response %d %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,142 @@
+package toolkit
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteSizeUnits are the units of ByteSize, each 1024 times the previous one, as MaxFileSize is counted.
+var byteSizeUnits = []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+
+// ByteSize returns a size in bytes as people read it, such as "512 B", "1 KB" or "1.4 MB", with a kilobyte
+// being 1024 bytes.
+func ByteSize(size int64) string {
+	sign := ""
+	value := float64(size)
+	if size < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	unit := 0
+	for value >= 1024 && unit < len(byteSizeUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return sign + strconv.FormatFloat(value, 'f', 0, 64) + " B"
+	}
+
+	// round first, so that 1023.96 KB shows as 1 MB rather than 1024 KB
+	if value = float64(int64(value*10+0.5)) / 10; value >= 1024 && unit < len(byteSizeUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	return sign + strings.TrimSuffix(strconv.FormatFloat(value, 'f', 1, 64), ".0") + " " + byteSizeUnits[unit]
+}
+
+// durationUnits are the units of HumanDuration, largest first.
+var durationUnits = []struct {
+	name string
+	size time.Duration
+}{
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+	{"second", time.Second},
+}
+
+// HumanDuration returns d as people read it, in its two largest units, such as "3 days 4 hours",
+// "1 hour 5 minutes" or "12 seconds". Durations under a second are given in milliseconds.
+func HumanDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	if d < time.Second {
+		return plural(int64(d/time.Millisecond), "millisecond")
+	}
+
+	var parts []string
+	for _, unit := range durationUnits {
+		if n := d / unit.size; n > 0 {
+			parts = append(parts, plural(int64(n), unit.name))
+			d -= n * unit.size
+		} else if len(parts) > 0 {
+			break
+		}
+		if len(parts) == 2 {
+			break
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// RelativeTime returns how long ago t was, or how long until it is, such as "3 hours ago", "in 2 days"
+// or "just now", in the largest unit which fits, rounded down.
+func RelativeTime(t time.Time) string {
+	return relativeTime(t, time.Now())
+}
+
+// relativeTime returns the time from now to t, as RelativeTime does.
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	var s string
+	switch {
+	case d < 45*time.Second:
+		return "just now"
+	case d < 2*time.Minute:
+		s = "1 minute"
+	case d < time.Hour:
+		s = plural(int64(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		s = plural(int64(d/time.Hour), "hour")
+	case d < 30*24*time.Hour:
+		s = plural(int64(d/(24*time.Hour)), "day")
+	case d < 365*24*time.Hour:
+		s = plural(int64(d/(30*24*time.Hour)), "month")
+	default:
+		s = plural(int64(d/(365*24*time.Hour)), "year")
+	}
+
+	if future {
+		return "in " + s
+	}
+	return s + " ago"
+}
+
+// Ordinal returns n followed by its English ordinal suffix, such as "1st", "2nd", "3rd", "11th" or "22nd".
+func Ordinal(n int) string {
+	abs := n
+	if abs < 0 {
+		abs = -abs
+	}
+
+	suffix := "th"
+	switch abs % 100 {
+	case 11, 12, 13:
+	default:
+		switch abs % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// plural returns n followed by unit, with an s unless n is 1.
+func plural(n int64, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return strconv.FormatInt(n, 10) + " " + unit + "s"
+}
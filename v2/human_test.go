@@ -0,0 +1,88 @@
+package toolkit
+
+import (
+	"testing"
+	"time"
+)
+
+var byteSizeTests = []struct {
+	size     int64
+	expected string
+}{
+	{0, "0 B"},
+	{512, "512 B"},
+	{1024, "1 KB"},
+	{1536, "1.5 KB"},
+	{1468006, "1.4 MB"},
+	{1048575, "1 MB"},
+	{5 * 1024 * 1024 * 1024, "5 GB"},
+	{-2048, "-2 KB"},
+	{1<<63 - 1, "8 EB"},
+}
+
+func TestByteSize(t *testing.T) {
+	for _, e := range byteSizeTests {
+		if out := ByteSize(e.size); out != e.expected {
+			t.Errorf("%d: expected %q, got %q", e.size, e.expected, out)
+		}
+	}
+}
+
+var humanDurationTests = []struct {
+	d        time.Duration
+	expected string
+}{
+	{0, "0 milliseconds"},
+	{350 * time.Millisecond, "350 milliseconds"},
+	{time.Second, "1 second"},
+	{12*time.Second + 400*time.Millisecond, "12 seconds"},
+	{time.Hour + 5*time.Minute + 3*time.Second, "1 hour 5 minutes"},
+	{time.Hour + 5*time.Second, "1 hour"},
+	{76 * time.Hour, "3 days 4 hours"},
+	{-90 * time.Second, "1 minute 30 seconds"},
+}
+
+func TestHumanDuration(t *testing.T) {
+	for _, e := range humanDurationTests {
+		if out := HumanDuration(e.d); out != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.d, e.expected, out)
+		}
+	}
+}
+
+var relativeTimeTests = []struct {
+	ago      time.Duration
+	expected string
+}{
+	{10 * time.Second, "just now"},
+	{-10 * time.Second, "just now"},
+	{50 * time.Second, "1 minute ago"},
+	{5 * time.Minute, "5 minutes ago"},
+	{3*time.Hour + 40*time.Minute, "3 hours ago"},
+	{-3 * time.Hour, "in 3 hours"},
+	{24 * time.Hour, "1 day ago"},
+	{65 * 24 * time.Hour, "2 months ago"},
+	{-800 * 24 * time.Hour, "in 2 years"},
+}
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, e := range relativeTimeTests {
+		if out := relativeTime(now.Add(-e.ago), now); out != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.ago, e.expected, out)
+		}
+	}
+
+	if out := RelativeTime(time.Now().Add(-2 * time.Hour)); out != "2 hours ago" {
+		t.Error("wrong relative time", out)
+	}
+}
+
+func TestOrdinal(t *testing.T) {
+	for n, expected := range map[int]string{0: "0th", 1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th",
+		13: "13th", 21: "21st", 22: "22nd", 101: "101st", 111: "111th", 112: "112th", -1: "-1st"} {
+		if out := Ordinal(n); out != expected {
+			t.Errorf("%d: expected %q, got %q", n, expected, out)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const localeContextKey contextKey = "locale"
+
+// CodedError is an error with a stable code, such as "order.not_found", which ErrorJSON sends to clients
+// along with its message, translated from Tools.Messages to the locale of the response.
+type CodedError struct {
+	Code string
+	// Message is the message sent when there is no translation for Code.
+	Message string
+	// Params replace the {name} placeholders of the message and its translations.
+	Params map[string]any
+	// Err is the error wrapped, if any, such as ErrNotFound, for HandleError to find its status code.
+	Err error
+}
+
+func (e *CodedError) Error() string {
+	if e.Message != "" {
+		return replaceParams(e.Message, e.Params)
+	}
+	return e.Code
+}
+
+func (e *CodedError) Unwrap() error {
+	return e.Err
+}
+
+// Messages holds catalogs of messages, by locale and code, such as the translations of the codes of
+// CodedError. Locales are language tags, such as en, fr or pt-BR, compared regardless of case.
+type Messages struct {
+	// DefaultLocale is used for clients accepting none of the locales there is a catalog for.
+	DefaultLocale string
+
+	mu       sync.RWMutex
+	catalogs map[string]map[string]string
+	locales  []string
+}
+
+// NewMessages returns Messages without any catalog, defaulting to defaultLocale.
+func NewMessages(defaultLocale string) *Messages {
+	return &Messages{DefaultLocale: defaultLocale, catalogs: make(map[string]map[string]string)}
+}
+
+// Add adds messages, by code, to the catalog of locale.
+func (m *Messages) Add(locale string, messages map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := strings.ToLower(locale)
+	catalog, ok := m.catalogs[key]
+	if !ok {
+		catalog = make(map[string]string, len(messages))
+		m.catalogs[key] = catalog
+		m.locales = append(m.locales, locale)
+	}
+	for code, message := range messages {
+		catalog[code] = message
+	}
+}
+
+// Load adds the catalogs of the .json and .toml files at the root of fsys, such as an embed.FS, named
+// after their locale, such as fr.json or pt-BR.toml. JSON files hold an object of messages by code,
+// which may be nested, the keys being joined with dots; TOML files hold key = "message" pairs, under
+// [sections] joined the same way.
+func (m *Messages) Load(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || ext != ".json" && ext != ".toml" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return err
+		}
+
+		messages := make(map[string]string)
+		if ext == ".json" {
+			var tree map[string]any
+			if err = json.Unmarshal(data, &tree); err == nil {
+				err = flattenMessages("", tree, messages)
+			}
+		} else {
+			err = parseTOMLMessages(string(data), messages)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		m.Add(strings.TrimSuffix(entry.Name(), ext), messages)
+	}
+	return nil
+}
+
+// flattenMessages adds the messages of tree to messages, the keys of nested objects being joined with dots.
+func flattenMessages(prefix string, tree map[string]any, messages map[string]string) error {
+	for key, value := range tree {
+		switch value := value.(type) {
+		case string:
+			messages[prefix+key] = value
+		case map[string]any:
+			if err := flattenMessages(prefix+key+".", value, messages); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("the message %s%s isn't a string", prefix, key)
+		}
+	}
+	return nil
+}
+
+// parseTOMLMessages adds to messages the key = "message" pairs of a TOML document, the keys under a
+// [section] being prefixed with its name and a dot. Only strings are supported.
+func parseTOMLMessages(doc string, messages map[string]string) error {
+	section := ""
+	for i, line := range strings.Split(doc, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(strings.TrimSpace(line[1:len(line)-1]), `"`) + "."
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		key, value = strings.Trim(strings.TrimSpace(key), `"`), strings.TrimSpace(value)
+		if !found || key == "" {
+			return fmt.Errorf("line %d: expected key = \"message\"", i+1)
+		}
+
+		var message string
+		var err error
+		switch {
+		case strings.HasPrefix(value, `"`):
+			// basic strings escape like Go strings, as far as messages go; a trailing comment is cut
+			end := closingQuote(value, '"', '\\')
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated string", i+1)
+			}
+			message, err = strconv.Unquote(value[:end+1])
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated string", i+1)
+			}
+			message = value[1 : end+1]
+		default:
+			err = errors.New("only strings are supported")
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		messages[section+key] = message
+	}
+	return nil
+}
+
+// Locales returns the locales there is a catalog for, in the order they were added.
+func (m *Messages) Locales() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.locales...)
+}
+
+// Translate returns the message for code in locale, with its {name} placeholders replaced by params.
+// Messages missing from the catalog of a regional locale, such as fr-CA, are looked for in that of its
+// language, fr, then in that of DefaultLocale. The boolean is false if none of them has the message.
+func (m *Messages) Translate(locale, code string, params map[string]any) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	locale = strings.ToLower(locale)
+	language, _, _ := strings.Cut(locale, "-")
+	for _, candidate := range []string{locale, language, strings.ToLower(m.DefaultLocale)} {
+		if message, ok := m.catalogs[candidate][code]; ok {
+			return replaceParams(message, params), true
+		}
+	}
+	return "", false
+}
+
+// Negotiate returns the locale, among those there is a catalog for, best matching the Accept-Language
+// header value acceptLanguage, such as "fr-CH, fr;q=0.9, en;q=0.8", or DefaultLocale if none matches.
+// A language also matches the regional locales of that language, and a regional locale the language.
+func (m *Messages) Negotiate(acceptLanguage string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if tag == "*" {
+			break
+		}
+		if _, ok := m.catalogs[tag]; ok {
+			return m.canonicalLocale(tag)
+		}
+		language, _, _ := strings.Cut(tag, "-")
+		if _, ok := m.catalogs[language]; ok {
+			return m.canonicalLocale(language)
+		}
+		for _, locale := range m.locales {
+			if strings.HasPrefix(strings.ToLower(locale), language+"-") {
+				return locale
+			}
+		}
+	}
+	return m.DefaultLocale
+}
+
+// canonicalLocale returns the locale whose lower case form is key, as it was added.
+func (m *Messages) canonicalLocale(key string) string {
+	for _, locale := range m.locales {
+		if strings.ToLower(locale) == key {
+			return locale
+		}
+	}
+	return key
+}
+
+// parseAcceptLanguage returns the lower case language tags of an Accept-Language header value, by
+// decreasing quality, leaving out those with a quality of 0.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		quality := 1.0
+		if name, value, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(name) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				quality = q
+			}
+		}
+		if quality > 0 {
+			tags = append(tags, weighted{tag: strings.ReplaceAll(tag, "_", "-"), quality: quality})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].quality > tags[j].quality })
+	out := make([]string, len(tags))
+	for i, tag := range tags {
+		out[i] = tag.tag
+	}
+	return out
+}
+
+// replaceParams replaces the {name} placeholders of message with the values of params.
+func replaceParams(message string, params map[string]any) string {
+	if len(params) == 0 || !strings.Contains(message, "{") {
+		return message
+	}
+	replacements := make([]string, 0, len(params)*2)
+	for name, value := range params {
+		replacements = append(replacements, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(replacements...).Replace(message)
+}
+
+// Locale is middleware picking the locale of each request among those of Tools.Messages, from its
+// Accept-Language header, with Messages.Negotiate. The locale is stored in the request context, where
+// LocaleFromContext finds it, and set as the Content-Language of the response, where ErrorJSON and
+// WriteJSON pick it up to translate messages.
+func (t *Tools) Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t.Messages == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		locale := t.Messages.Negotiate(r.Header.Get("Accept-Language"))
+		w.Header().Add("Vary", "Accept-Language")
+		if locale != "" {
+			w.Header().Set("Content-Language", locale)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), localeContextKey, locale)))
+	})
+}
+
+// LocaleFromContext returns the locale stored in ctx by the Locale middleware, or an empty string if
+// there is none.
+func LocaleFromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(localeContextKey).(string)
+	return locale
+}
+
+// translateResponse translates the message of payload, if it has a code, to the Content-Language of
+// the response of w.
+func (t *Tools) translateResponse(w http.ResponseWriter, payload *JSONResponse, params map[string]any) {
+	if t.Messages == nil || payload.Code == "" {
+		return
+	}
+	locale := w.Header().Get("Content-Language")
+	if locale == "" {
+		locale = t.Messages.DefaultLocale
+	}
+	if message, ok := t.Messages.Translate(locale, payload.Code, params); ok {
+		payload.Message = message
+	}
+}
@@ -0,0 +1,111 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func testMessages(t *testing.T) *Messages {
+	messages := NewMessages("en")
+	err := messages.Load(fstest.MapFS{
+		"en.json":    {Data: []byte(`{"order": {"not_found": "Order {id} not found"}, "hello": "Hello"}`)},
+		"fr.json":    {Data: []byte(`{"order": {"not_found": "Commande {id} introuvable"}}`)},
+		"pt-BR.toml": {Data: []byte("# Brazilian Portuguese\nhello = 'Olá'\n\n[order]\nnot_found = \"Pedido {id} não encontrado\" # trailing comment\n")},
+		"readme.md":  {Data: []byte("not a catalog")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+func TestMessages_Negotiate(t *testing.T) {
+	messages := testMessages(t)
+
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{header: "", expected: "en"},
+		{header: "fr-CH, fr;q=0.9, en;q=0.8", expected: "fr"},
+		{header: "de, en;q=0.5, fr;q=0.7", expected: "fr"},
+		{header: "pt", expected: "pt-BR"},
+		{header: "PT-br", expected: "pt-BR"},
+		{header: "fr;q=0, de", expected: "en"},
+		{header: "*", expected: "en"},
+	}
+	for _, test := range tests {
+		if locale := messages.Negotiate(test.header); locale != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.header, test.expected, locale)
+		}
+	}
+}
+
+func TestMessages_Translate(t *testing.T) {
+	messages := testMessages(t)
+	params := map[string]any{"id": 42}
+
+	tests := []struct {
+		locale, code, expected string
+	}{
+		{locale: "fr", code: "order.not_found", expected: "Commande 42 introuvable"},
+		{locale: "fr-CA", code: "order.not_found", expected: "Commande 42 introuvable"},
+		{locale: "pt-BR", code: "order.not_found", expected: "Pedido 42 não encontrado"},
+		{locale: "pt-BR", code: "hello", expected: "Olá"},
+		{locale: "fr", code: "hello", expected: "Hello"},
+	}
+	for _, test := range tests {
+		if message, _ := messages.Translate(test.locale, test.code, params); message != test.expected {
+			t.Errorf("%s %s: expected %q, got %q", test.locale, test.code, test.expected, message)
+		}
+	}
+	if _, ok := messages.Translate("fr", "missing", nil); ok {
+		t.Error("expected no message for an unknown code")
+	}
+
+	for _, doc := range []string{"count = 3", "broken", `unterminated = "abc`} {
+		if err := messages.Load(fstest.MapFS{"de.toml": {Data: []byte(doc)}}); err == nil {
+			t.Errorf("%q: expected an error", doc)
+		}
+	}
+}
+
+func TestTools_Locale(t *testing.T) {
+	testTools := Tools{Messages: testMessages(t)}
+	handler := testTools.Locale(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if LocaleFromContext(r.Context()) != "fr" {
+			t.Error("wrong locale in context", LocaleFromContext(r.Context()))
+		}
+		err := &CodedError{Code: "order.not_found", Message: "order {id} not found", Params: map[string]any{"id": 7}, Err: ErrNotFound}
+		_ = testTools.HandleError(w, err)
+	}))
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept-Language", "fr-FR,fr;q=0.9")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, request)
+
+	var payload JSONResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &payload)
+	if rr.Code != http.StatusNotFound || payload.Code != "order.not_found" || payload.Message != "Commande 7 introuvable" {
+		t.Errorf("wrong response %d %+v", rr.Code, payload)
+	}
+	if rr.Header().Get("Content-Language") != "fr" || rr.Header().Get("Vary") != "Accept-Language" {
+		t.Errorf("wrong headers %v", rr.Header())
+	}
+
+	// WriteJSON translates responses with a code, in the default locale without the middleware
+	rr = httptest.NewRecorder()
+	_ = testTools.WriteJSON(rr, http.StatusOK, JSONResponse{Code: "hello", Message: "hi"})
+	_ = json.Unmarshal(rr.Body.Bytes(), &payload)
+	if payload.Message != "Hello" || payload.Code != "hello" {
+		t.Errorf("wrong payload %+v", payload)
+	}
+
+	if err := (&CodedError{Code: "order.not_found", Message: "order {id} not found", Params: map[string]any{"id": 7}}); err.Error() != "order 7 not found" {
+		t.Error("wrong error message", err.Error())
+	}
+}
@@ -0,0 +1,366 @@
+// Package images resizes, crops, watermarks and converts images, using only the standard library.
+// It can be used on its own, or through the ImageProcessing option of the toolkit's uploads.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Format is an image format, named like the formats registered with the image package.
+type Format string
+
+// The formats the package knows about. WebP is encoded losslessly, with EncodeWebP, unless another
+// encoder is registered with RegisterEncoder, and decoded once a decoder is registered, such as by
+// importing golang.org/x/image/webp.
+const (
+	PNG  Format = "png"
+	JPEG Format = "jpeg"
+	GIF  Format = "gif"
+	WebP Format = "webp"
+)
+
+// DefaultJPEGQuality is the quality used to encode JPEG images when none is given.
+const DefaultJPEGQuality = 85
+
+// DefaultMaxPixels is the largest number of pixels Process decodes when Options.MaxPixels isn't set.
+const DefaultMaxPixels = 50_000_000
+
+var (
+	// ErrUnsupportedFormat is returned for unknown formats, and when encoding to a format without an
+	// encoder, see CanEncode.
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrTooManyPixels is returned for images whose dimensions exceed the limit, before they are decoded.
+	ErrTooManyPixels = errors.New("the image has too many pixels")
+)
+
+// EncodeFunc encodes img to w. quality, from 1 to 100, only matters to lossy formats.
+type EncodeFunc func(w io.Writer, img image.Image, quality int) error
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[Format]EncodeFunc{
+		PNG: func(w io.Writer, img image.Image, quality int) error {
+			return png.Encode(w, img)
+		},
+		JPEG: func(w io.Writer, img image.Image, quality int) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+		},
+		GIF: func(w io.Writer, img image.Image, quality int) error {
+			return gif.Encode(w, img, nil)
+		},
+		WebP: func(w io.Writer, img image.Image, quality int) error {
+			return EncodeWebP(w, img)
+		},
+	}
+)
+
+// RegisterEncoder registers the encoder used for format, such as a lossy WebP encoder from a third party package.
+// Decoders are registered with image.RegisterFormat, usually by importing their package.
+func RegisterEncoder(format Format, encode EncodeFunc) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[format] = encode
+}
+
+// CanEncode reports whether images can be encoded in format, which is true of PNG, JPEG, GIF and WebP,
+// and of the formats registered with RegisterEncoder.
+func CanEncode(format Format) bool {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	_, ok := encoders[format]
+	return ok
+}
+
+// ParseFormat returns the Format for a name or file extension, such as "jpg", ".png" or "image/webp".
+func ParseFormat(name string) (Format, error) {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(name, "image/"), "."))
+	switch name {
+	case "png":
+		return PNG, nil
+	case "jpg", "jpeg":
+		return JPEG, nil
+	case "gif":
+		return GIF, nil
+	case "webp":
+		return WebP, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, name)
+}
+
+// Extension returns the usual file extension for f, including the dot.
+func (f Format) Extension() string {
+	if f == JPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+// Decode decodes an image from r, and returns it with its format.
+func Decode(r io.Reader) (image.Image, Format, error) {
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", err
+	}
+	return img, Format(format), nil
+}
+
+// CheckPixels reads the header of the image in r and returns ErrTooManyPixels if its width times its height
+// is more than maxPixels, without decoding the image. This protects against decompression bombs: small
+// files declaring huge dimensions, which would take gigabytes of memory to decode.
+func CheckPixels(r io.Reader, maxPixels int64) (image.Config, Format, error) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return config, "", err
+	}
+	if int64(config.Width)*int64(config.Height) > maxPixels {
+		return config, Format(format), fmt.Errorf("%w: %dx%d", ErrTooManyPixels, config.Width, config.Height)
+	}
+	return config, Format(format), nil
+}
+
+// Encode encodes img to w in format. A zero quality means DefaultJPEGQuality.
+func Encode(w io.Writer, img image.Image, format Format, quality int) error {
+	encodersMu.RLock()
+	encode, ok := encoders[format]
+	encodersMu.RUnlock()
+	if !ok {
+		return noEncoderError(format)
+	}
+
+	if quality <= 0 || quality > 100 {
+		quality = DefaultJPEGQuality
+	}
+	return encode(w, img, quality)
+}
+
+// noEncoderError returns the error of encoding to format, which has no encoder.
+func noEncoderError(format Format) error {
+	return fmt.Errorf("%w: no encoder for %s, register one with RegisterEncoder", ErrUnsupportedFormat, format)
+}
+
+// Resize returns img scaled to width by height pixels. If either is zero, it is computed from the other,
+// keeping the aspect ratio. Each pixel is the average of the pixels it covers in img, so that
+// shrinking images doesn't produce aliasing artifacts.
+func Resize(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW == 0 || srcH == 0 || (width <= 0 && height <= 0) {
+		return img
+	}
+
+	if width <= 0 {
+		width = int(math.Round(float64(srcW) * float64(height) / float64(srcH)))
+	}
+	if height <= 0 {
+		height = int(math.Round(float64(srcH) * float64(width) / float64(srcW)))
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	scaleX, scaleY := float64(srcW)/float64(width), float64(srcH)/float64(height)
+
+	for y := 0; y < height; y++ {
+		y0, y1 := sourceSpan(y, scaleY, srcH)
+		for x := 0; x < width; x++ {
+			x0, x1 := sourceSpan(x, scaleX, srcW)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(img.At(bounds.Min.X+sx, bounds.Min.Y+sy)).(color.NRGBA64)
+					// weigh colors by their alpha, so that transparent pixels don't darken the edges
+					r += uint64(c.R) * uint64(c.A)
+					g += uint64(c.G) * uint64(c.A)
+					b += uint64(c.B) * uint64(c.A)
+					a += uint64(c.A)
+					n++
+				}
+			}
+
+			var c color.NRGBA
+			if a > 0 {
+				c = color.NRGBA{R: uint8(r / a >> 8), G: uint8(g / a >> 8), B: uint8(b / a >> 8), A: uint8(a / n >> 8)}
+			}
+			dst.SetNRGBA(x, y, c)
+		}
+	}
+	return dst
+}
+
+// sourceSpan returns the range of source pixels covered by the destination pixel i, scaled by scale.
+func sourceSpan(i int, scale float64, size int) (int, int) {
+	start := int(float64(i) * scale)
+	end := int(math.Ceil(float64(i+1) * scale))
+	if end > size {
+		end = size
+	}
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+// Fit returns img scaled down, keeping its aspect ratio, to fit within maxWidth by maxHeight pixels.
+// Images which already fit are returned as they are. A zero maximum means no limit on that side.
+func Fit(img image.Image, maxWidth, maxHeight int) image.Image {
+	bounds := img.Bounds()
+	scale := 1.0
+	if maxWidth > 0 && bounds.Dx() > maxWidth {
+		scale = float64(maxWidth) / float64(bounds.Dx())
+	}
+	if maxHeight > 0 && bounds.Dy() > maxHeight {
+		scale = math.Min(scale, float64(maxHeight)/float64(bounds.Dy()))
+	}
+	if scale == 1 {
+		return img
+	}
+	return Resize(img, int(math.Max(1, math.Round(float64(bounds.Dx())*scale))), int(math.Max(1, math.Round(float64(bounds.Dy())*scale))))
+}
+
+// Crop returns the part of img within rect, relative to the top left corner of img.
+// The rectangle is clipped to the image.
+func Crop(img image.Image, rect image.Rectangle) image.Image {
+	bounds := img.Bounds()
+	rect = rect.Add(bounds.Min).Intersect(bounds)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+// Position is where a watermark is placed on an image.
+type Position int
+
+const (
+	BottomRight Position = iota
+	BottomLeft
+	TopRight
+	TopLeft
+	Center
+)
+
+// WatermarkOptions is the type used to configure Watermark.
+type WatermarkOptions struct {
+	// Position defaults to BottomRight.
+	Position Position
+	// Margin is the space, in pixels, between the watermark and the edges of the image.
+	Margin int
+	// Opacity, from 0 to 1, defaults to 1. The watermark's own transparency is kept.
+	Opacity float64
+}
+
+// Watermark returns a copy of img with mark drawn over it.
+func Watermark(img, mark image.Image, opts ...WatermarkOptions) image.Image {
+	var options WatermarkOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.Opacity <= 0 || options.Opacity > 1 {
+		options.Opacity = 1
+	}
+
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	size := mark.Bounds().Size()
+	margin := options.Margin
+	var at image.Point
+	switch options.Position {
+	case TopLeft:
+		at = image.Pt(margin, margin)
+	case TopRight:
+		at = image.Pt(bounds.Dx()-size.X-margin, margin)
+	case BottomLeft:
+		at = image.Pt(margin, bounds.Dy()-size.Y-margin)
+	case Center:
+		at = image.Pt((bounds.Dx()-size.X)/2, (bounds.Dy()-size.Y)/2)
+	default:
+		at = image.Pt(bounds.Dx()-size.X-margin, bounds.Dy()-size.Y-margin)
+	}
+
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(options.Opacity * 255))})
+	draw.DrawMask(dst, image.Rectangle{Min: at, Max: at.Add(size)}, mark, mark.Bounds().Min, mask, image.Point{}, draw.Over)
+	return dst
+}
+
+// Options describes the processing done by Process. The steps are done in the order of the fields.
+type Options struct {
+	// Crop, if not empty, is the part of the image kept.
+	Crop image.Rectangle
+	// Width and Height, if either is set, resize the image, as Resize does, or as Fit does if Fit is set.
+	Width  int
+	Height int
+	Fit    bool
+	// Watermark, if set, is drawn over the image.
+	Watermark        image.Image
+	WatermarkOptions WatermarkOptions
+	// Format is the format the image is written in. Defaults to the format it was read in. It must have
+	// an encoder, which WebP only has once one is registered with RegisterEncoder.
+	Format Format
+	// Quality is the quality of lossy formats, from 1 to 100. Defaults to DefaultJPEGQuality.
+	Quality int
+	// MaxPixels is the largest width times height of the images read. Larger images are refused with
+	// ErrTooManyPixels before being decoded. Defaults to DefaultMaxPixels.
+	MaxPixels int64
+}
+
+// Process reads an image from r, transforms it as described by opts, and writes it to w.
+// It returns the format the image was written in, or ErrUnsupportedFormat, before reading anything, if
+// opts.Format has no encoder.
+func Process(r io.Reader, w io.Writer, opts Options) (Format, error) {
+	if opts.Format != "" && !CanEncode(opts.Format) {
+		return "", noEncoderError(opts.Format)
+	}
+	maxPixels := opts.MaxPixels
+	if maxPixels <= 0 {
+		maxPixels = DefaultMaxPixels
+	}
+
+	// keep the header read by CheckPixels, to decode the whole image afterwards
+	var header bytes.Buffer
+	if _, _, err := CheckPixels(io.TeeReader(r, &header), maxPixels); err != nil {
+		return "", err
+	}
+
+	img, format, err := Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return "", err
+	}
+
+	if !opts.Crop.Empty() {
+		img = Crop(img, opts.Crop)
+	}
+	if opts.Width > 0 || opts.Height > 0 {
+		if opts.Fit {
+			img = Fit(img, opts.Width, opts.Height)
+		} else {
+			img = Resize(img, opts.Width, opts.Height)
+		}
+	}
+	if opts.Watermark != nil {
+		img = Watermark(img, opts.Watermark, opts.WatermarkOptions)
+	}
+
+	if opts.Format != "" {
+		format = opts.Format
+	}
+	return format, Encode(w, img, format, opts.Quality)
+}
@@ -0,0 +1,199 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// solid returns a width by height image filled with c.
+func solid(width, height int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+var resizeTests = []struct {
+	name           string
+	width, height  int
+	expectedWidth  int
+	expectedHeight int
+}{
+	{name: "both", width: 50, height: 10, expectedWidth: 50, expectedHeight: 10},
+	{name: "width only", width: 100, expectedWidth: 100, expectedHeight: 50},
+	{name: "height only", height: 25, expectedWidth: 50, expectedHeight: 25},
+	{name: "enlarge", width: 400, expectedWidth: 400, expectedHeight: 200},
+}
+
+func TestResize(t *testing.T) {
+	src := solid(200, 100, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+
+	for _, e := range resizeTests {
+		img := Resize(src, e.width, e.height)
+		if img.Bounds().Dx() != e.expectedWidth || img.Bounds().Dy() != e.expectedHeight {
+			t.Errorf("%s: wrong size %v", e.name, img.Bounds())
+		}
+		if c := color.NRGBAModel.Convert(img.At(1, 1)).(color.NRGBA); c != (color.NRGBA{R: 200, G: 100, B: 50, A: 255}) {
+			t.Errorf("%s: wrong color %v", e.name, c)
+		}
+	}
+
+	// shrinking averages the pixels
+	stripes := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	stripes.Set(0, 0, color.White)
+	stripes.Set(1, 0, color.Black)
+	if c := color.GrayModel.Convert(Resize(stripes, 1, 1).At(0, 0)).(color.Gray); c.Y < 126 || c.Y > 128 {
+		t.Error("expected grey, got", c)
+	}
+}
+
+func TestFit(t *testing.T) {
+	src := solid(200, 100, color.White)
+
+	if img := Fit(src, 100, 100); img.Bounds().Dx() != 100 || img.Bounds().Dy() != 50 {
+		t.Error("wrong size", img.Bounds())
+	}
+	if img := Fit(src, 400, 0); img != image.Image(src) {
+		t.Error("images which fit must not be resized")
+	}
+}
+
+func TestCrop(t *testing.T) {
+	src := solid(100, 100, color.White)
+	src.Set(10, 20, color.Black)
+
+	img := Crop(src, image.Rect(10, 20, 40, 60))
+	if img.Bounds() != image.Rect(0, 0, 30, 40) {
+		t.Error("wrong bounds", img.Bounds())
+	}
+	if c := color.GrayModel.Convert(img.At(0, 0)).(color.Gray); c.Y != 0 {
+		t.Error("wrong origin", c)
+	}
+
+	if img = Crop(src, image.Rect(90, 90, 200, 200)); img.Bounds() != image.Rect(0, 0, 10, 10) {
+		t.Error("the crop must be clipped to the image, got", img.Bounds())
+	}
+}
+
+func TestWatermark(t *testing.T) {
+	src := solid(100, 100, color.White)
+	mark := solid(10, 10, color.Black)
+
+	img := Watermark(src, mark, WatermarkOptions{Margin: 5, Opacity: 0.5})
+	if c := color.GrayModel.Convert(img.At(90, 90)).(color.Gray); c.Y < 126 || c.Y > 128 {
+		t.Error("expected a half transparent watermark in the bottom right corner, got", c)
+	}
+	if c := color.GrayModel.Convert(img.At(95, 95)).(color.Gray); c.Y != 255 {
+		t.Error("the margin must be left untouched, got", c)
+	}
+	if c := color.GrayModel.Convert(src.At(90, 90)).(color.Gray); c.Y != 255 {
+		t.Error("the source image must not be modified")
+	}
+
+	img = Watermark(src, mark, WatermarkOptions{Position: TopLeft})
+	if c := color.GrayModel.Convert(img.At(0, 0)).(color.Gray); c.Y != 0 {
+		t.Error("expected the watermark in the top left corner, got", c)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	in, err := os.Open("../testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	var out bytes.Buffer
+	format, err := Process(in, &out, Options{Width: 20, Height: 20, Fit: true, Format: JPEG, Quality: 70})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != JPEG {
+		t.Error("wrong format", format)
+	}
+
+	img, decoded, err := Decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != JPEG || img.Bounds().Dx() > 20 || img.Bounds().Dy() > 20 {
+		t.Error("wrong output", decoded, img.Bounds())
+	}
+}
+
+// bombGIF returns a tiny GIF declaring width by height pixels.
+func bombGIF(t *testing.T, width, height uint16) []byte {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, solid(1, 1, color.White), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint16(data[6:], width)
+	binary.LittleEndian.PutUint16(data[8:], height)
+	return data
+}
+
+func TestCheckPixels(t *testing.T) {
+	bomb := bombGIF(t, 60000, 60000)
+
+	if _, _, err := CheckPixels(bytes.NewReader(bomb), 1000); !errors.Is(err, ErrTooManyPixels) {
+		t.Error("expected ErrTooManyPixels, got", err)
+	}
+	if _, err := Process(bytes.NewReader(bomb), io.Discard, Options{}); !errors.Is(err, ErrTooManyPixels) {
+		t.Error("expected Process to refuse the image before decoding it, got", err)
+	}
+
+	config, format, err := CheckPixels(bytes.NewReader(bombGIF(t, 10, 10)), 100)
+	if err != nil || format != GIF || config.Width != 10 {
+		t.Error("wrong result", config, format, err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	img := solid(4, 4, color.White)
+	const avif Format = "avif"
+
+	if err := Encode(io.Discard, img, avif, 0); !errors.Is(err, ErrUnsupportedFormat) || !strings.Contains(err.Error(), "RegisterEncoder") {
+		t.Error("expected ErrUnsupportedFormat, got", err)
+	}
+	if CanEncode(avif) || !CanEncode(PNG) || !CanEncode(WebP) {
+		t.Error("expected only the built in formats to have encoders")
+	}
+	if _, err := Process(strings.NewReader("not read"), io.Discard, Options{Format: avif}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Error("expected Process to refuse a format without an encoder, got", err)
+	}
+
+	RegisterEncoder(avif, func(w io.Writer, img image.Image, quality int) error {
+		if quality != DefaultJPEGQuality {
+			t.Error("wrong default quality", quality)
+		}
+		return png.Encode(w, img)
+	})
+	defer func() {
+		encodersMu.Lock()
+		delete(encoders, avif)
+		encodersMu.Unlock()
+	}()
+	if err := Encode(io.Discard, img, avif, 0); err != nil || !CanEncode(avif) {
+		t.Error("the registered encoder was not used:", err)
+	}
+
+	if f, err := ParseFormat(".JPG"); err != nil || f != JPEG || f.Extension() != ".jpg" {
+		t.Error("wrong format", f, err)
+	}
+	if _, err := ParseFormat("bmp"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Error("expected ErrUnsupportedFormat, got", err)
+	}
+}
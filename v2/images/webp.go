@@ -0,0 +1,336 @@
+package images
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// webpMaxSize is the largest width or height of a lossless WebP image.
+const webpMaxSize = 1 << 14
+
+// webpMaxCodeLength is the longest prefix code VP8L allows.
+const webpMaxCodeLength = 15
+
+// webpCodeLengthOrder is the order in which the lengths of the code length code are written.
+var webpCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// EncodeWebP encodes img to w as a lossless WebP image (VP8L). It applies the subtract green transform
+// and a prefix code per channel, without backward references, so files are larger than those of
+// libwebp, but every pixel, alpha included, is kept exactly.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > webpMaxSize || height > webpMaxSize {
+		return fmt.Errorf("webp: cannot encode a %dx%d image", width, height)
+	}
+
+	// the pixels, as green, red minus green, blue minus green and alpha
+	pixels := make([][4]uint8, 0, width*height)
+	var histograms [4][256]int
+	opaque := true
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			pixel := [4]uint8{c.G, c.R - c.G, c.B - c.G, c.A}
+			for i, v := range pixel {
+				histograms[i][v]++
+			}
+			opaque = opaque && c.A == 0xff
+			pixels = append(pixels, pixel)
+		}
+	}
+
+	var bw webpBitWriter
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if opaque {
+		bw.write(0, 1)
+	} else {
+		bw.write(1, 1)
+	}
+	bw.write(0, 3) // version
+
+	bw.write(1, 1) // a transform follows
+	bw.write(2, 2) // subtract green
+	bw.write(0, 1) // no more transforms
+	bw.write(0, 1) // no color cache
+	bw.write(0, 1) // a single group of prefix codes
+
+	// green, red, blue, alpha and distance, green having 24 more symbols for backward reference lengths
+	var codes [4]webpPrefixCode
+	for i := range codes {
+		size := 256
+		if i == 0 {
+			size += 24
+		}
+		codes[i] = newWebPPrefixCode(histograms[i][:], size)
+		codes[i].writeTo(&bw)
+	}
+	bw.write(1, 1) // a simple code for distances,
+	bw.write(0, 1) // of one symbol,
+	bw.write(0, 1) // written on one bit,
+	bw.write(0, 1) // which is 0
+
+	for _, pixel := range pixels {
+		for i, v := range pixel {
+			codes[i].writeSymbol(&bw, int(v))
+		}
+	}
+	data := bw.flush()
+
+	// the RIFF container, padded to an even size
+	header := make([]byte, 20)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(data)+len(data)%2))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// webpBitWriter packs bits least significant first, as VP8L reads them.
+type webpBitWriter struct {
+	buf   []byte
+	bits  uint64
+	nbits uint
+}
+
+// write writes the n low bits of v.
+func (bw *webpBitWriter) write(v uint32, n uint) {
+	bw.bits |= uint64(v) << bw.nbits
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+		bw.bits >>= 8
+		bw.nbits -= 8
+	}
+}
+
+// flush returns the bytes written, the last one padded with zeros.
+func (bw *webpBitWriter) flush() []byte {
+	if bw.nbits > 0 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+		bw.bits, bw.nbits = 0, 0
+	}
+	return bw.buf
+}
+
+// webpPrefixCode is the canonical prefix code of an alphabet, by the lengths of its symbols.
+type webpPrefixCode struct {
+	lengths []int
+	codes   []uint32 // reversed, to be written least significant bit first
+	used    []int    // the symbols used, when there are at most 2 of them, written with a simple code
+}
+
+// newWebPPrefixCode returns the prefix code of an alphabet of size symbols, which occur as often as histogram says.
+func newWebPPrefixCode(histogram []int, size int) webpPrefixCode {
+	var used []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	code := webpPrefixCode{lengths: make([]int, size)}
+	switch len(used) {
+	case 0:
+		code.used = []int{0}
+		return code
+	case 1:
+		code.used = used
+		return code
+	case 2:
+		// one bit each, 0 for the first symbol and 1 for the second
+		code.used = used
+		code.lengths[used[0]], code.lengths[used[1]] = 1, 1
+		code.codes = make([]uint32, size)
+		code.codes[used[1]] = 1
+		return code
+	}
+
+	copy(code.lengths, webpCodeLengths(histogram, webpMaxCodeLength))
+	code.codes = webpCanonicalCodes(code.lengths)
+	return code
+}
+
+// writeSymbol writes the code of symbol. A code with one symbol takes no bits.
+func (c *webpPrefixCode) writeSymbol(bw *webpBitWriter, symbol int) {
+	if c.codes != nil {
+		bw.write(c.codes[symbol], uint(c.lengths[symbol]))
+	}
+}
+
+// writeTo writes the lengths of the code, from which the reader rebuilds it.
+func (c *webpPrefixCode) writeTo(bw *webpBitWriter) {
+	if c.used != nil {
+		bw.write(1, 1) // simple code
+		bw.write(uint32(len(c.used)-1), 1)
+		if c.used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(c.used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(c.used[0]), 8)
+		}
+		if len(c.used) == 2 {
+			bw.write(uint32(c.used[1]), 8)
+		}
+		return
+	}
+
+	// the lengths are themselves written with a prefix code, of lengths 0 to 15, and of 17 and 18
+	// for runs of zeros
+	type token struct{ symbol, extra, extraBits int }
+	var tokens []token
+	var histogram [19]int
+	for i := 0; i < len(c.lengths); {
+		run := 1
+		for i+run < len(c.lengths) && c.lengths[i+run] == c.lengths[i] {
+			run++
+		}
+		if c.lengths[i] != 0 || run < 3 {
+			tokens = append(tokens, token{symbol: c.lengths[i]})
+			histogram[c.lengths[i]]++
+			i++
+			continue
+		}
+		if run > 138 {
+			run = 138
+		}
+		if run <= 10 {
+			tokens = append(tokens, token{symbol: 17, extra: run - 3, extraBits: 3})
+			histogram[17]++
+		} else {
+			tokens = append(tokens, token{symbol: 18, extra: run - 11, extraBits: 7})
+			histogram[18]++
+		}
+		i += run
+	}
+	// a code of one symbol takes no bits, which readers don't all agree on, so there are always two
+	if used := webpUsedSymbols(histogram[:]); used < 2 {
+		if histogram[0] == 0 {
+			histogram[0] = 1
+		} else {
+			histogram[1] = 1
+		}
+	}
+	lengths := webpCodeLengths(histogram[:], 7)
+	codes := webpCanonicalCodes(lengths)
+
+	count := len(webpCodeLengthOrder)
+	for count > 4 && lengths[webpCodeLengthOrder[count-1]] == 0 {
+		count--
+	}
+	bw.write(0, 1) // normal code
+	bw.write(uint32(count-4), 4)
+	for _, symbol := range webpCodeLengthOrder[:count] {
+		bw.write(uint32(lengths[symbol]), 3)
+	}
+	bw.write(0, 1) // every length is written
+	for _, t := range tokens {
+		bw.write(codes[t.symbol], uint(lengths[t.symbol]))
+		if t.extraBits > 0 {
+			bw.write(uint32(t.extra), uint(t.extraBits))
+		}
+	}
+}
+
+// webpUsedSymbols returns how many symbols occur in histogram.
+func webpUsedSymbols(histogram []int) int {
+	used := 0
+	for _, count := range histogram {
+		if count > 0 {
+			used++
+		}
+	}
+	return used
+}
+
+// webpCodeLengths returns the lengths of a Huffman code for histogram, none longer than maxLength.
+// When the code is too long, rare symbols are counted as more frequent, until it fits.
+func webpCodeLengths(histogram []int, maxLength int) []int {
+	type node struct {
+		count       int
+		symbol      int // -1 for inner nodes
+		left, right *node
+	}
+
+	for minCount := 1; ; minCount *= 2 {
+		var nodes []*node
+		for symbol, count := range histogram {
+			if count > 0 {
+				if count < minCount {
+					count = minCount
+				}
+				nodes = append(nodes, &node{count: count, symbol: symbol})
+			}
+		}
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].count < nodes[j].count })
+
+		// nodes stays sorted, as merged nodes are inserted after those of the same count
+		for len(nodes) > 1 {
+			merged := &node{count: nodes[0].count + nodes[1].count, symbol: -1, left: nodes[0], right: nodes[1]}
+			nodes = nodes[2:]
+			i := sort.Search(len(nodes), func(i int) bool { return nodes[i].count > merged.count })
+			nodes = append(nodes, nil)
+			copy(nodes[i+1:], nodes[i:])
+			nodes[i] = merged
+		}
+
+		lengths := make([]int, len(histogram))
+		tooLong := false
+		var walk func(n *node, depth int)
+		walk = func(n *node, depth int) {
+			if n.symbol >= 0 {
+				lengths[n.symbol] = depth
+				tooLong = tooLong || depth > maxLength
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk(nodes[0], 0)
+		if !tooLong {
+			return lengths
+		}
+	}
+}
+
+// webpCanonicalCodes returns the canonical codes of lengths, bit reversed to be written least
+// significant bit first.
+func webpCanonicalCodes(lengths []int) []uint32 {
+	var counts [webpMaxCodeLength + 1]uint32
+	for _, length := range lengths {
+		counts[length]++
+	}
+	counts[0] = 0
+	var next [webpMaxCodeLength + 2]uint32
+	for length := 1; length <= webpMaxCodeLength; length++ {
+		next[length+1] = (next[length] + counts[length]) << 1
+	}
+
+	codes := make([]uint32, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		code := next[length]
+		next[length]++
+		var reversed uint32
+		for i := 0; i < length; i++ {
+			reversed = reversed<<1 | code>>i&1
+		}
+		codes[symbol] = reversed
+	}
+	return codes
+}
@@ -0,0 +1,273 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// webpBitReader reads bits least significant first, as VP8L writes them.
+type webpBitReader struct {
+	data []byte
+	pos  int // in bits
+}
+
+func (br *webpBitReader) read(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if br.pos/8 >= len(br.data) {
+			panic("webp: unexpected end of data")
+		}
+		v |= uint32(br.data[br.pos/8]>>(br.pos%8)&1) << i
+		br.pos++
+	}
+	return v
+}
+
+// webpReaderCode decodes symbols by their canonical codes, read one bit at a time.
+type webpReaderCode struct {
+	single  int // the symbol of a code taking no bits, or -1
+	symbols map[[2]uint32]int
+}
+
+func newWebPReaderCode(lengths []int) webpReaderCode {
+	code := webpReaderCode{single: -1, symbols: map[[2]uint32]int{}}
+	var used []int
+	for symbol, length := range lengths {
+		if length > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) == 1 {
+		code.single = used[0]
+		return code
+	}
+	next := uint32(0)
+	for length := 1; length <= webpMaxCodeLength; length++ {
+		for symbol, l := range lengths {
+			if l == length {
+				code.symbols[[2]uint32{uint32(length), next}] = symbol
+				next++
+			}
+		}
+		next <<= 1
+	}
+	return code
+}
+
+func (c webpReaderCode) read(br *webpBitReader) int {
+	if c.single >= 0 {
+		return c.single
+	}
+	var code uint32
+	for length := uint32(1); length <= webpMaxCodeLength; length++ {
+		code = code<<1 | br.read(1)
+		if symbol, ok := c.symbols[[2]uint32{length, code}]; ok {
+			return symbol
+		}
+	}
+	panic("webp: invalid code")
+}
+
+// readWebPCode reads a prefix code of an alphabet of size symbols, following the VP8L specification.
+func readWebPCode(br *webpBitReader, size int) webpReaderCode {
+	lengths := make([]int, size)
+	if br.read(1) == 1 {
+		count := br.read(1) + 1
+		first := br.read(1 + 7*int(br.read(1)))
+		lengths[first] = 1
+		if count == 2 {
+			lengths[br.read(8)] = 1
+		}
+		return newWebPReaderCode(lengths)
+	}
+
+	var codeLengthLengths [19]int
+	count := int(br.read(4)) + 4
+	for _, symbol := range webpCodeLengthOrder[:count] {
+		codeLengthLengths[symbol] = int(br.read(3))
+	}
+	codeLengths := newWebPReaderCode(codeLengthLengths[:])
+	maxSymbol := size
+	if br.read(1) == 1 {
+		maxSymbol = 2 + int(br.read(2+2*int(br.read(3))))
+	}
+	previous := 8
+	for symbol := 0; symbol < size && maxSymbol > 0; maxSymbol-- {
+		length := codeLengths.read(br)
+		if length < 16 {
+			lengths[symbol] = length
+			symbol++
+			if length != 0 {
+				previous = length
+			}
+			continue
+		}
+		repeat, value := 0, 0
+		switch length {
+		case 16:
+			repeat, value = int(br.read(2))+3, previous
+		case 17:
+			repeat = int(br.read(3)) + 3
+		case 18:
+			repeat = int(br.read(7)) + 11
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[symbol] = value
+			symbol++
+		}
+	}
+	return newWebPReaderCode(lengths)
+}
+
+// decodeWebPLossless decodes the lossless WebP images EncodeWebP writes: with the subtract green
+// transform only, no color cache and no backward references.
+func decodeWebPLossless(t *testing.T, data []byte) *image.NRGBA {
+	t.Helper()
+	if len(data) < 21 || string(data[:4]) != "RIFF" || string(data[8:16]) != "WEBPVP8L" || len(data)%2 != 0 {
+		t.Fatal("not a lossless WebP file")
+	}
+	if size := binary.LittleEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+		t.Fatalf("wrong RIFF size %d for %d bytes", size, len(data))
+	}
+	size := binary.LittleEndian.Uint32(data[16:])
+	br := &webpBitReader{data: data[20 : 20+size]}
+
+	if br.read(8) != 0x2f {
+		t.Fatal("wrong VP8L signature")
+	}
+	width, height := int(br.read(14))+1, int(br.read(14))+1
+	br.read(1) // alpha hint
+	if version := br.read(3); version != 0 {
+		t.Fatal("wrong version", version)
+	}
+	subtractGreen := false
+	for br.read(1) == 1 {
+		if transform := br.read(2); transform != 2 {
+			t.Fatal("unexpected transform", transform)
+		}
+		subtractGreen = true
+	}
+	if br.read(1) != 0 || br.read(1) != 0 {
+		t.Fatal("unexpected color cache or meta prefix codes")
+	}
+	green, red, blue, alpha := readWebPCode(br, 280), readWebPCode(br, 256), readWebPCode(br, 256), readWebPCode(br, 256)
+	readWebPCode(br, 40)
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			g := green.read(br)
+			if g >= 256 {
+				t.Fatal("unexpected backward reference")
+			}
+			c := color.NRGBA{R: uint8(red.read(br)), G: uint8(g), B: uint8(blue.read(br)), A: uint8(alpha.read(br))}
+			if subtractGreen {
+				c.R += c.G
+				c.B += c.G
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	if (br.pos+7)/8 != len(br.data) {
+		t.Errorf("%d bytes left after the pixels", len(br.data)-(br.pos+7)/8)
+	}
+	return img
+}
+
+func TestEncodeWebP(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	noise := image.NewNRGBA(image.Rect(0, 0, 37, 23))
+	random.Read(noise.Pix)
+	// mostly one color, so that rare values get long codes
+	skewed := solid(300, 200, color.NRGBA{R: 10, G: 200, B: 30, A: 255})
+	for i := 0; i < 40; i++ {
+		skewed.Set(i*7, i*5, color.NRGBA{R: uint8(i), G: uint8(3 * i), B: uint8(5 * i), A: uint8(255 - i)})
+	}
+	gradient := image.NewRGBA(image.Rect(10, 10, 74, 42))
+	for y := 10; y < 42; y++ {
+		for x := 10; x < 74; x++ {
+			gradient.Set(x, y, color.RGBA{R: uint8(x * 3), G: uint8(y * 7), B: 0x80, A: 0xff})
+		}
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{name: "one pixel", img: solid(1, 1, color.Transparent)},
+		{name: "solid", img: solid(16, 9, color.White)},
+		{name: "two colors", img: checkerboard(8, 8)},
+		{name: "noise", img: noise},
+		{name: "skewed", img: skewed},
+		{name: "offset bounds", img: gradient},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := Encode(&buf, test.img, WebP, 0); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		decoded := decodeWebPLossless(t, buf.Bytes())
+
+		bounds := test.img.Bounds()
+		if decoded.Bounds().Dx() != bounds.Dx() || decoded.Bounds().Dy() != bounds.Dy() {
+			t.Fatalf("%s: wrong size %v", test.name, decoded.Bounds())
+		}
+		for y := 0; y < bounds.Dy(); y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				expected := color.NRGBAModel.Convert(test.img.At(bounds.Min.X+x, bounds.Min.Y+y))
+				if got := decoded.NRGBAAt(x, y); got != expected {
+					t.Fatalf("%s: pixel %d,%d is %v, expected %v", test.name, x, y, got, expected)
+				}
+			}
+		}
+	}
+
+	// counts following the Fibonacci sequence make the deepest Huffman trees, of one more level per symbol
+	fibonacci := []int{1, 1}
+	for len(fibonacci) < 30 {
+		fibonacci = append(fibonacci, fibonacci[len(fibonacci)-1]+fibonacci[len(fibonacci)-2])
+	}
+	lengths := webpCodeLengths(fibonacci, webpMaxCodeLength)
+	kraft := 0
+	for _, length := range lengths {
+		if length < 1 || length > webpMaxCodeLength {
+			t.Fatalf("wrong code length %d in %v", length, lengths)
+		}
+		kraft += 1 << (webpMaxCodeLength - length)
+	}
+	if kraft != 1<<webpMaxCodeLength {
+		t.Errorf("expected a complete code, got lengths %v", lengths)
+	}
+
+	if err := EncodeWebP(&bytes.Buffer{}, image.NewNRGBA(image.Rect(0, 0, webpMaxSize+1, 1))); err == nil || !strings.Contains(err.Error(), "cannot encode") {
+		t.Error("expected images larger than WebP allows to be refused, got", err)
+	}
+	if err := EncodeWebP(failingWriter{}, solid(1, 1, color.White)); !errors.Is(err, errWriteFailed) {
+		t.Error("expected the error of the writer, got", err)
+	}
+}
+
+// checkerboard returns a width by height image of black and white pixels.
+func checkerboard(width, height int) *image.NRGBA {
+	img := solid(width, height, color.White)
+	for y := 0; y < height; y++ {
+		for x := (y % 2); x < width; x += 2 {
+			img.Set(x, y, color.Black)
+		}
+	}
+	return img
+}
+
+var errWriteFailed = errors.New("write failed")
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errWriteFailed
+}
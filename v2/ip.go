@@ -0,0 +1,124 @@
+package toolkit
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIP returns the IP address of the client which made r. Forwarding headers (Forwarded, X-Forwarded-For
+// and X-Real-IP, in that order of preference) are only believed when the request comes from one of
+// Tools.TrustedProxies; otherwise the address of the connection is used, since anybody can set these headers.
+// When several proxies are chained, the rightmost address which is not a trusted proxy is the client.
+func (t *Tools) RealIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	trusted := parseCIDRs(t.TrustedProxies)
+	if !ipInNets(remote, trusted) {
+		return remote
+	}
+
+	var chain []string
+	if forwarded := r.Header.Values("Forwarded"); len(forwarded) > 0 {
+		chain = parseForwarded(forwarded)
+	} else if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		for _, header := range xff {
+			for _, addr := range strings.Split(header, ",") {
+				chain = append(chain, stripPort(strings.TrimSpace(addr)))
+			}
+		}
+	} else if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		chain = []string{stripPort(realIP)}
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		if net.ParseIP(chain[i]) == nil {
+			// a malformed entry can't be trusted, nor anything to the left of it
+			break
+		}
+		if !ipInNets(chain[i], trusted) || i == 0 {
+			return chain[i]
+		}
+	}
+
+	return remote
+}
+
+// IsPrivateIP reports whether ip is not a public internet address: a private (RFC 1918, RFC 4193),
+// loopback, link-local or unspecified address. Invalid addresses are reported as not private.
+func IsPrivateIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	return parsed.IsPrivate() || parsed.IsLoopback() || parsed.IsLinkLocalUnicast() ||
+		parsed.IsLinkLocalMulticast() || parsed.IsUnspecified()
+}
+
+// CIDRMatch reports whether ip is within any of cidrs. Each entry may be a CIDR block, such as 10.0.0.0/8,
+// or a single address. Entries which can't be parsed are ignored.
+func CIDRMatch(ip string, cidrs ...string) bool {
+	return ipInNets(ip, parseCIDRs(cidrs))
+}
+
+// parseCIDRs parses CIDR blocks and single addresses, skipping invalid entries.
+func parseCIDRs(cidrs []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+			continue
+		}
+		if _, n, err := net.ParseCIDR(cidr); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+// ipInNets reports whether ip is within any of nets.
+func ipInNets(ip string, nets []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseForwarded returns the for= addresses of RFC 7239 Forwarded headers, in order.
+func parseForwarded(headers []string) []string {
+	var addrs []string
+	for _, header := range headers {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(key, "for") {
+					addrs = append(addrs, stripPort(strings.Trim(value, `"`)))
+				}
+			}
+		}
+	}
+	return addrs
+}
+
+// stripPort removes the port, and the brackets around IPv6 addresses, from addr.
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
@@ -0,0 +1,77 @@
+package toolkit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+var realIPTests = []struct {
+	name       string
+	remoteAddr string
+	headers    map[string]string
+	trusted    []string
+	expected   string
+}{
+	{name: "no proxy", remoteAddr: "203.0.113.7:5555", expected: "203.0.113.7"},
+	{name: "untrusted proxy headers ignored", remoteAddr: "203.0.113.7:5555", headers: map[string]string{"X-Forwarded-For": "1.2.3.4"}, expected: "203.0.113.7"},
+	{name: "x-forwarded-for", remoteAddr: "10.0.0.2:80", trusted: []string{"10.0.0.0/8"}, headers: map[string]string{"X-Forwarded-For": "198.51.100.9"}, expected: "198.51.100.9"},
+	{name: "spoofed x-forwarded-for", remoteAddr: "10.0.0.2:80", trusted: []string{"10.0.0.0/8"}, headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.9"}, expected: "198.51.100.9"},
+	{name: "chained proxies", remoteAddr: "10.0.0.2:80", trusted: []string{"10.0.0.0/8"}, headers: map[string]string{"X-Forwarded-For": "198.51.100.9, 10.0.0.5"}, expected: "198.51.100.9"},
+	{name: "x-real-ip", remoteAddr: "10.0.0.2:80", trusted: []string{"10.0.0.2"}, headers: map[string]string{"X-Real-IP": "198.51.100.9"}, expected: "198.51.100.9"},
+	{name: "forwarded", remoteAddr: "10.0.0.2:80", trusted: []string{"10.0.0.0/8"}, headers: map[string]string{"Forwarded": `for=192.0.2.60;proto=http;by=203.0.113.43`}, expected: "192.0.2.60"},
+	{name: "forwarded ipv6", remoteAddr: "[::1]:80", trusted: []string{"::1"}, headers: map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711"`}, expected: "2001:db8:cafe::17"},
+	{name: "forwarded preferred", remoteAddr: "10.0.0.2:80", trusted: []string{"10.0.0.0/8"}, headers: map[string]string{"Forwarded": "for=192.0.2.60", "X-Forwarded-For": "198.51.100.9"}, expected: "192.0.2.60"},
+	{name: "garbage", remoteAddr: "10.0.0.2:80", trusted: []string{"10.0.0.0/8"}, headers: map[string]string{"X-Forwarded-For": "not-an-ip"}, expected: "10.0.0.2"},
+}
+
+func TestTools_RealIP(t *testing.T) {
+	for _, test := range realIPTests {
+		testTools := Tools{TrustedProxies: test.trusted}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+
+		if got := testTools.RealIP(req); got != test.expected {
+			t.Errorf("%s: expected %s but got %s", test.name, test.expected, got)
+		}
+	}
+}
+
+var privateIPTests = []struct {
+	ip       string
+	expected bool
+}{
+	{ip: "10.1.2.3", expected: true},
+	{ip: "172.16.0.1", expected: true},
+	{ip: "192.168.1.1", expected: true},
+	{ip: "127.0.0.1", expected: true},
+	{ip: "169.254.169.254", expected: true},
+	{ip: "fd00::1", expected: true},
+	{ip: "::1", expected: true},
+	{ip: "8.8.8.8", expected: false},
+	{ip: "2001:4860:4860::8888", expected: false},
+	{ip: "nonsense", expected: false},
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	for _, test := range privateIPTests {
+		if got := IsPrivateIP(test.ip); got != test.expected {
+			t.Errorf("%s: expected %t but got %t", test.ip, test.expected, got)
+		}
+	}
+}
+
+func TestCIDRMatch(t *testing.T) {
+	if !CIDRMatch("192.168.1.20", "10.0.0.0/8", "192.168.1.0/24") {
+		t.Error("expected 192.168.1.20 to match")
+	}
+	if !CIDRMatch("203.0.113.7", "203.0.113.7") {
+		t.Error("expected a single address to match itself")
+	}
+	if CIDRMatch("192.168.2.20", "192.168.1.0/24", "invalid") {
+		t.Error("expected 192.168.2.20 not to match")
+	}
+}
@@ -0,0 +1,290 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned by ParseJWT when a token is malformed, or its signature can't be verified.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned by ParseJWT when a token's exp claim is in the past.
+	ErrTokenExpired = errors.New("token has expired")
+)
+
+const jwtClaimsContextKey contextKey = "jwtClaims"
+
+// The signing algorithms supported for JSON Web Tokens.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// JWTKey is a key used to sign and verify JSON Web Tokens.
+// HS256 keys need a Secret. RS256 and EdDSA keys need a PrivateKey (*rsa.PrivateKey or ed25519.PrivateKey)
+// to sign tokens; a key with only a PublicKey (*rsa.PublicKey or ed25519.PublicKey) can still verify them.
+type JWTKey struct {
+	ID         string
+	Algorithm  string
+	Secret     []byte
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// JWTClaims holds the claims of a JSON Web Token.
+type JWTClaims map[string]any
+
+// Subject returns the sub claim, or an empty string if there is none.
+func (c JWTClaims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// ExpiresAt returns the time held in the exp claim, or the zero time if there is none.
+func (c JWTClaims) ExpiresAt() time.Time {
+	if exp, ok := numericClaim(c["exp"]); ok {
+		return time.Unix(exp, 0)
+	}
+	return time.Time{}
+}
+
+// GenerateJWT returns a signed JSON Web Token holding claims, which expires after ttl (if ttl is not zero).
+// The iat claim, and the iss claim if Tools.JWTIssuer is set, are added automatically.
+// Tokens are always signed with the first key in Tools.JWTKeys; the others are only used to verify tokens,
+// which allows keys to be rotated without invalidating tokens that are still in use.
+func (t *Tools) GenerateJWT(claims JWTClaims, ttl time.Duration) (string, error) {
+	if len(t.JWTKeys) == 0 {
+		return "", errors.New("no JWT keys set")
+	}
+	key := t.JWTKeys[0]
+
+	now := time.Now()
+	payload := make(JWTClaims, len(claims)+3)
+	for k, v := range claims {
+		payload[k] = v
+	}
+	payload["iat"] = now.Unix()
+	if ttl > 0 {
+		payload["exp"] = now.Add(ttl).Unix()
+	}
+	if _, ok := payload["iss"]; !ok && t.JWTIssuer != "" {
+		payload["iss"] = t.JWTIssuer
+	}
+
+	header := map[string]string{"alg": key.Algorithm, "typ": "JWT"}
+	if key.ID != "" {
+		header["kid"] = key.ID
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
+
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ParseJWT verifies the signature of token against Tools.JWTKeys, checks its exp and nbf claims,
+// and its iss claim if Tools.JWTIssuer is set, and returns its claims.
+func (t *Tools) ParseJWT(token string) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err = json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// the algorithm in the header must match the key's, so that a token can't pick a weaker algorithm for itself
+	signingInput := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range t.JWTKeys {
+		if key.Algorithm != header.Algorithm || (header.KeyID != "" && key.ID != header.KeyID) {
+			continue
+		}
+		if key.verify(signingInput, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidToken
+	}
+
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims JWTClaims
+	dec := json.NewDecoder(bytes.NewReader(payloadJSON))
+	dec.UseNumber()
+	if err = dec.Decode(&claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// exp and nbf may be left out, but a token whose validity can't be read isn't valid
+	now := time.Now().Unix()
+	if v, present := claims["exp"]; present {
+		exp, ok := numericClaim(v)
+		if !ok {
+			return nil, fmt.Errorf("%w: malformed exp claim", ErrInvalidToken)
+		}
+		if now >= exp {
+			return nil, ErrTokenExpired
+		}
+	}
+	if v, present := claims["nbf"]; present {
+		nbf, ok := numericClaim(v)
+		if !ok {
+			return nil, fmt.Errorf("%w: malformed nbf claim", ErrInvalidToken)
+		}
+		if now < nbf {
+			return nil, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+		}
+	}
+	if t.JWTIssuer != "" && claims["iss"] != t.JWTIssuer {
+		return nil, fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// AuthMiddleware is middleware which requires a valid bearer token in the Authorization header.
+// The token's claims are stored in the request context, and can be retrieved with JWTClaimsFromContext.
+// Requests without a valid token are refused with a 401 JSON error.
+func (t *Tools) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			_ = t.ErrorJSON(w, errors.New("missing bearer token"), http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := t.ParseJWT(strings.TrimSpace(token))
+		if err != nil {
+			t.logger().Debug("invalid bearer token", "path", r.URL.Path, "err", err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			_ = t.ErrorJSON(w, err, http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), jwtClaimsContextKey, claims)))
+	})
+}
+
+// JWTClaimsFromContext returns the claims stored in ctx by AuthMiddleware.
+func JWTClaimsFromContext(ctx context.Context) (JWTClaims, bool) {
+	claims, ok := ctx.Value(jwtClaimsContextKey).(JWTClaims)
+	return claims, ok
+}
+
+// sign returns the signature of input using the key.
+func (k JWTKey) sign(input []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case HS256:
+		if len(k.Secret) == 0 {
+			return nil, errors.New("HS256 key has no secret")
+		}
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case RS256:
+		priv, ok := k.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("RS256 key has no RSA private key")
+		}
+		hash := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, hash[:])
+	case EdDSA:
+		priv, ok := k.PrivateKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("EdDSA key has no ed25519 private key")
+		}
+		return ed25519.Sign(priv, input), nil
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", k.Algorithm)
+	}
+}
+
+// verify reports whether signature is a valid signature of input for the key.
+func (k JWTKey) verify(input, signature []byte) bool {
+	public := k.PublicKey
+	if public == nil && k.PrivateKey != nil {
+		public = k.PrivateKey.Public()
+	}
+
+	switch k.Algorithm {
+	case HS256:
+		expected, err := k.sign(input)
+		return err == nil && hmac.Equal(signature, expected)
+	case RS256:
+		pub, ok := public.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		hash := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature) == nil
+	case EdDSA:
+		pub, ok := public.(ed25519.PublicKey)
+		return ok && ed25519.Verify(pub, input, signature)
+	default:
+		return false
+	}
+}
+
+// numericClaim converts the value of a NumericDate claim to seconds since the epoch.
+func numericClaim(v any) (int64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return int64(f), err == nil
+	case float64:
+		return int64(n), true
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,159 @@
+package toolkit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_GenerateAndParseJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []JWTKey{
+		{ID: "hs", Algorithm: HS256, Secret: []byte("a very secret key")},
+		{ID: "rs", Algorithm: RS256, PrivateKey: rsaKey},
+		{ID: "ed", Algorithm: EdDSA, PrivateKey: edKey},
+	}
+
+	for _, key := range keys {
+		testTools := Tools{JWTKeys: []JWTKey{key}, JWTIssuer: "toolkit"}
+
+		token, err := testTools.GenerateJWT(JWTClaims{"sub": "42", "role": "admin"}, time.Minute)
+		if err != nil {
+			t.Fatalf("%s: %s", key.Algorithm, err)
+		}
+
+		claims, err := testTools.ParseJWT(token)
+		if err != nil {
+			t.Fatalf("%s: %s", key.Algorithm, err)
+		}
+		if claims.Subject() != "42" || claims["role"] != "admin" || claims["iss"] != "toolkit" {
+			t.Errorf("%s: wrong claims %v", key.Algorithm, claims)
+		}
+		if claims.ExpiresAt().Before(time.Now()) {
+			t.Errorf("%s: wrong expiry %s", key.Algorithm, claims.ExpiresAt())
+		}
+
+		// a token signed by another key of the same type is refused
+		other := Tools{JWTKeys: []JWTKey{{ID: key.ID, Algorithm: HS256, Secret: []byte("another key")}}}
+		if _, err = other.ParseJWT(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, but got %v", key.Algorithm, err)
+		}
+	}
+}
+
+func TestTools_ParseJWTRotation(t *testing.T) {
+	oldKey := JWTKey{ID: "2022-01", Algorithm: HS256, Secret: []byte("old secret")}
+	newKey := JWTKey{ID: "2022-10", Algorithm: HS256, Secret: []byte("new secret")}
+
+	oldTools := Tools{JWTKeys: []JWTKey{oldKey}}
+	token, err := oldTools.GenerateJWT(JWTClaims{"sub": "1"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := Tools{JWTKeys: []JWTKey{newKey, oldKey}}
+	if _, err = rotated.ParseJWT(token); err != nil {
+		t.Error("token signed with the previous key should still be valid:", err)
+	}
+
+	retired := Tools{JWTKeys: []JWTKey{newKey}}
+	if _, err = retired.ParseJWT(token); !errors.Is(err, ErrInvalidToken) {
+		t.Error("expected ErrInvalidToken once the old key is retired, but got", err)
+	}
+}
+
+func TestTools_ParseJWTInvalid(t *testing.T) {
+	testTools := Tools{JWTKeys: []JWTKey{{Algorithm: HS256, Secret: []byte("secret")}}}
+
+	expired, _ := testTools.GenerateJWT(JWTClaims{"exp": time.Now().Add(-time.Minute).Unix()}, 0)
+	if _, err := testTools.ParseJWT(expired); !errors.Is(err, ErrTokenExpired) {
+		t.Error("expected ErrTokenExpired, but got", err)
+	}
+
+	valid, _ := testTools.GenerateJWT(JWTClaims{"sub": "1"}, time.Minute)
+	parts := strings.Split(valid, ".")
+
+	invalid := []string{
+		"",
+		"not.a.token",
+		parts[0] + "." + parts[1],
+		// alg none
+		"eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + parts[1] + ".",
+		// payload swapped for another one
+		parts[0] + ".eyJzdWIiOiIyIn0." + parts[2],
+	}
+	for _, token := range invalid {
+		if _, err := testTools.ParseJWT(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected ErrInvalidToken for %q, but got %v", token, err)
+		}
+	}
+
+	for _, claims := range []JWTClaims{{"exp": "2020-01-01"}, {"exp": nil}, {"nbf": true}} {
+		token, err := testTools.GenerateJWT(claims, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = testTools.ParseJWT(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected ErrInvalidToken for %v, but got %v", claims, err)
+		}
+	}
+
+	issuer := Tools{JWTKeys: testTools.JWTKeys, JWTIssuer: "someone else"}
+	if _, err := issuer.ParseJWT(valid); !errors.Is(err, ErrInvalidToken) {
+		t.Error("expected ErrInvalidToken for the wrong issuer, but got", err)
+	}
+}
+
+func TestTools_AuthMiddleware(t *testing.T) {
+	testTools := Tools{JWTKeys: []JWTKey{{Algorithm: HS256, Secret: []byte("secret")}}}
+	token, _ := testTools.GenerateJWT(JWTClaims{"sub": "42"}, time.Minute)
+
+	handler := testTools.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := JWTClaimsFromContext(r.Context())
+		if !ok || claims.Subject() != "42" {
+			t.Error("claims not found in context")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	var authTests = []struct {
+		name           string
+		header         string
+		expectedStatus int
+	}{
+		{name: "valid", header: "Bearer " + token, expectedStatus: http.StatusNoContent},
+		{name: "missing", header: "", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong scheme", header: "Basic " + token, expectedStatus: http.StatusUnauthorized},
+		{name: "invalid", header: "Bearer nonsense", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, test := range authTests {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != test.expectedStatus {
+			t.Errorf("%s: wrong status code; expected %d but got %d", test.name, test.expectedStatus, rr.Code)
+		}
+		if test.expectedStatus == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header", test.name)
+		}
+	}
+}
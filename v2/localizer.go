@@ -0,0 +1,243 @@
+package toolkit
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateStyle is how FormatDate writes dates.
+type DateStyle int
+
+// The styles of FormatDate.
+const (
+	// DateShort writes dates with digits, such as 1/2/2006 in American English or 02.01.2006 in German.
+	DateShort DateStyle = iota
+	// DateLong writes dates with the name of the month, such as January 2, 2006 or 2 janvier 2006.
+	DateLong
+)
+
+// dateFormat is how dates are written in a locale: patterns with the placeholders {d}, {dd}, {m}, {mm},
+// {month} and {yyyy}, and the names of the months.
+type dateFormat struct {
+	short, long string
+	months      []string
+}
+
+// dateFormats are the date formats known to FormatDate, by locale or language.
+var dateFormats = map[string]dateFormat{
+	"en":    {short: "{m}/{d}/{yyyy}", long: "{month} {d}, {yyyy}", months: []string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}},
+	"en-gb": {short: "{dd}/{mm}/{yyyy}", long: "{d} {month} {yyyy}", months: []string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}},
+	"fr":    {short: "{dd}/{mm}/{yyyy}", long: "{d} {month} {yyyy}", months: []string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"}},
+	"de":    {short: "{dd}.{mm}.{yyyy}", long: "{d}. {month} {yyyy}", months: []string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"}},
+	"es":    {short: "{dd}/{mm}/{yyyy}", long: "{d} de {month} de {yyyy}", months: []string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"}},
+	"it":    {short: "{dd}/{mm}/{yyyy}", long: "{d} {month} {yyyy}", months: []string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"}},
+	"pt":    {short: "{dd}/{mm}/{yyyy}", long: "{d} de {month} de {yyyy}", months: []string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"}},
+	"nl":    {short: "{dd}-{mm}-{yyyy}", long: "{d} {month} {yyyy}", months: []string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"}},
+	"id":    {short: "{dd}/{mm}/{yyyy}", long: "{d} {month} {yyyy}", months: []string{"Januari", "Februari", "Maret", "April", "Mei", "Juni", "Juli", "Agustus", "September", "Oktober", "November", "Desember"}},
+	"ja":    {short: "{yyyy}/{mm}/{dd}", long: "{yyyy}年{m}月{d}日"},
+}
+
+// Localizer translates messages, picking their plural form, and formats numbers and dates, for a
+// locale, such as the one picked by the Locale middleware. Its Funcs make it available to templates.
+type Localizer struct {
+	// Messages holds the translations. Plural forms of a message are found under its code followed by
+	// the CLDR plural category, such as cart.items.one and cart.items.other.
+	Messages *Messages
+}
+
+// NewLocalizer returns a Localizer translating messages from messages.
+func NewLocalizer(messages *Messages) *Localizer {
+	return &Localizer{Messages: messages}
+}
+
+// T returns the message for code in locale, with the {name} placeholders replaced by params, if any,
+// or code itself when there is no translation, so that missing messages stand out.
+func (l *Localizer) T(locale, code string, params ...map[string]any) string {
+	var p map[string]any
+	if len(params) > 0 {
+		p = params[0]
+	}
+	if l.Messages != nil {
+		if message, ok := l.Messages.Translate(locale, code, p); ok {
+			return message
+		}
+	}
+	return code
+}
+
+// Plural returns the plural form of the message for code fitting count in locale, the message for code
+// followed by the plural category of count, such as cart.items.few, or else by other. The placeholder
+// {count} is replaced by count, formatted for locale, along with those of params.
+func (l *Localizer) Plural(locale, code string, count int, params ...map[string]any) string {
+	p := map[string]any{"count": l.FormatNumber(locale, float64(count), 0)}
+	if len(params) > 0 {
+		for name, value := range params[0] {
+			p[name] = value
+		}
+	}
+
+	if l.Messages != nil {
+		for _, category := range []string{PluralCategory(locale, count), "other"} {
+			if message, ok := l.Messages.Translate(locale, code+"."+category, p); ok {
+				return message
+			}
+		}
+	}
+	return code
+}
+
+// PluralCategory returns the CLDR plural category of the integer n in locale: zero, one, two, few, many
+// or other. Languages without plural forms, such as Japanese, always get other; unknown languages get
+// one for 1 and other for the rest, as in English.
+func PluralCategory(locale string, n int) string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	language, _, _ := strings.Cut(locale, "-")
+	if n < 0 {
+		n = -n
+	}
+	mod10, mod100 := n%10, n%100
+
+	switch language {
+	case "ja", "zh", "ko", "id", "ms", "th", "vi":
+		return "other"
+	case "fr":
+		if n == 0 || n == 1 {
+			return "one"
+		}
+	case "pt":
+		if n == 1 || n == 0 && locale != "pt-pt" {
+			return "one"
+		}
+	case "ru", "uk", "be":
+		switch {
+		case mod10 == 1 && mod100 != 11:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	case "pl":
+		switch {
+		case n == 1:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	case "cs", "sk":
+		switch {
+		case n == 1:
+			return "one"
+		case n >= 2 && n <= 4:
+			return "few"
+		}
+	case "ar":
+		switch {
+		case n == 0:
+			return "zero"
+		case n == 1:
+			return "one"
+		case n == 2:
+			return "two"
+		case mod100 >= 3 && mod100 <= 10:
+			return "few"
+		case mod100 >= 11:
+			return "many"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
+
+// FormatNumber returns n with the given number of decimals, and the decimal and group separators of
+// locale, as Money.Format uses them, such as 1,234.5 in English or 1.234,5 in German.
+func (l *Localizer) FormatNumber(locale string, n float64, decimals int) string {
+	loc := findMoneyLocale([]string{locale})
+	digits := strconv.FormatFloat(n, 'f', decimals, 64)
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if fraction == "" {
+		return sign + groupThousands(whole, loc.group)
+	}
+	return sign + groupThousands(whole, loc.group) + loc.decimal + fraction
+}
+
+// FormatDate returns the date of t as it is written in locale, in the given style, or as 2006-01-02 for
+// locales it doesn't know.
+func (l *Localizer) FormatDate(locale string, t time.Time, style DateStyle) string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	format, ok := dateFormats[locale]
+	if !ok {
+		language, _, _ := strings.Cut(locale, "-")
+		if format, ok = dateFormats[language]; !ok {
+			return t.Format("2006-01-02")
+		}
+	}
+
+	pattern := format.short
+	if style == DateLong {
+		pattern = format.long
+	}
+	month := ""
+	if len(format.months) == 12 {
+		month = format.months[t.Month()-1]
+	}
+	return strings.NewReplacer(
+		"{dd}", t.Format("02"), "{d}", strconv.Itoa(t.Day()),
+		"{mm}", t.Format("01"), "{m}", strconv.Itoa(int(t.Month())),
+		"{month}", month, "{yyyy}", strconv.Itoa(t.Year()),
+	).Replace(pattern)
+}
+
+// Funcs returns template functions using l, taking the locale as their first argument, for
+// RendererOptions.Funcs:
+//
+//	{{t .Locale "welcome" }}
+//	{{tn .Locale "cart.items" .Count}}
+//	{{number .Locale .Total 2}}
+//	{{date .Locale .Created "long"}}
+//
+// with the locale passed in the data, such as from LocaleFromContext.
+func (l *Localizer) Funcs() map[string]any {
+	return map[string]any{
+		"t": func(locale, code string, params ...map[string]any) string {
+			return l.T(locale, code, params...)
+		},
+		"tn": func(locale, code string, count int, params ...map[string]any) string {
+			return l.Plural(locale, code, count, params...)
+		},
+		"number": func(locale string, n any, decimals ...int) (string, error) {
+			d := 0
+			if len(decimals) > 0 {
+				d = decimals[0]
+			}
+			v := reflect.ValueOf(n)
+			switch v.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return l.FormatNumber(locale, float64(v.Int()), d), nil
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				return l.FormatNumber(locale, float64(v.Uint()), d), nil
+			case reflect.Float32, reflect.Float64:
+				return l.FormatNumber(locale, v.Float(), d), nil
+			}
+			return "", fmt.Errorf("number: %T is not a number", n)
+		},
+		"date": func(locale string, t time.Time, style ...string) string {
+			if len(style) > 0 && style[0] == "long" {
+				return l.FormatDate(locale, t, DateLong)
+			}
+			return l.FormatDate(locale, t, DateShort)
+		},
+	}
+}
@@ -0,0 +1,160 @@
+package toolkit
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func testLocalizer() *Localizer {
+	messages := NewMessages("en")
+	messages.Add("en", map[string]string{
+		"welcome":          "Welcome, {name}",
+		"cart.items.one":   "{count} item",
+		"cart.items.other": "{count} items",
+	})
+	messages.Add("ru", map[string]string{
+		"cart.items.one":  "{count} товар",
+		"cart.items.few":  "{count} товара",
+		"cart.items.many": "{count} товаров",
+	})
+	messages.Add("ja", map[string]string{"cart.items.other": "{count}個の商品"})
+	return NewLocalizer(messages)
+}
+
+func TestPluralCategory(t *testing.T) {
+	tests := []struct {
+		locale   string
+		n        int
+		expected string
+	}{
+		{locale: "en", n: 1, expected: "one"},
+		{locale: "en-US", n: 0, expected: "other"},
+		{locale: "en", n: 2, expected: "other"},
+		{locale: "fr", n: 0, expected: "one"},
+		{locale: "fr", n: 2, expected: "other"},
+		{locale: "pt-BR", n: 0, expected: "one"},
+		{locale: "pt-PT", n: 0, expected: "other"},
+		{locale: "ja", n: 1, expected: "other"},
+		{locale: "ru", n: 21, expected: "one"},
+		{locale: "ru", n: 11, expected: "many"},
+		{locale: "ru", n: 3, expected: "few"},
+		{locale: "ru", n: 13, expected: "many"},
+		{locale: "pl", n: 1, expected: "one"},
+		{locale: "pl", n: 22, expected: "few"},
+		{locale: "pl", n: 21, expected: "many"},
+		{locale: "cs", n: 4, expected: "few"},
+		{locale: "cs", n: 5, expected: "other"},
+		{locale: "ar", n: 0, expected: "zero"},
+		{locale: "ar", n: 2, expected: "two"},
+		{locale: "ar", n: 105, expected: "few"},
+		{locale: "ar", n: 11, expected: "many"},
+		{locale: "ar", n: 100, expected: "other"},
+		{locale: "xx", n: 1, expected: "one"},
+	}
+	for _, test := range tests {
+		if category := PluralCategory(test.locale, test.n); category != test.expected {
+			t.Errorf("%s %d: expected %s, got %s", test.locale, test.n, test.expected, category)
+		}
+	}
+}
+
+func TestLocalizer(t *testing.T) {
+	localizer := testLocalizer()
+
+	if message := localizer.T("en", "welcome", map[string]any{"name": "Ann"}); message != "Welcome, Ann" {
+		t.Error("wrong message", message)
+	}
+	if message := localizer.T("en", "missing"); message != "missing" {
+		t.Error("expected the code of a missing message, got", message)
+	}
+
+	tests := []struct {
+		locale   string
+		count    int
+		expected string
+	}{
+		{locale: "en", count: 1, expected: "1 item"},
+		{locale: "en", count: 1500, expected: "1,500 items"},
+		{locale: "ru", count: 1, expected: "1 товар"},
+		{locale: "ru", count: 2, expected: "2 товара"},
+		{locale: "ru", count: 5, expected: "5 товаров"},
+		{locale: "ja", count: 1, expected: "1個の商品"},
+		// a missing plural form falls back to other
+		{locale: "ar", count: 2, expected: "2 items"},
+	}
+	for _, test := range tests {
+		if message := localizer.Plural(test.locale, "cart.items", test.count); message != test.expected {
+			t.Errorf("%s %d: expected %q, got %q", test.locale, test.count, test.expected, message)
+		}
+	}
+}
+
+func TestLocalizer_Format(t *testing.T) {
+	localizer := testLocalizer()
+
+	numbers := []struct {
+		locale   string
+		n        float64
+		decimals int
+		expected string
+	}{
+		{locale: "en", n: 1234567.891, decimals: 2, expected: "1,234,567.89"},
+		{locale: "de-DE", n: 1234567.891, decimals: 2, expected: "1.234.567,89"},
+		{locale: "en", n: -1234, decimals: 0, expected: "-1,234"},
+		{locale: "en", n: 12.5, decimals: 0, expected: "12"},
+	}
+	for _, test := range numbers {
+		if formatted := localizer.FormatNumber(test.locale, test.n, test.decimals); formatted != test.expected {
+			t.Errorf("%s %v: expected %s, got %s", test.locale, test.n, test.expected, formatted)
+		}
+	}
+
+	date := time.Date(2024, time.March, 5, 10, 0, 0, 0, time.UTC)
+	dates := []struct {
+		locale   string
+		style    DateStyle
+		expected string
+	}{
+		{locale: "en-US", style: DateShort, expected: "3/5/2024"},
+		{locale: "en-GB", style: DateShort, expected: "05/03/2024"},
+		{locale: "de", style: DateShort, expected: "05.03.2024"},
+		{locale: "ja", style: DateShort, expected: "2024/03/05"},
+		{locale: "xx", style: DateShort, expected: "2024-03-05"},
+		{locale: "en", style: DateLong, expected: "March 5, 2024"},
+		{locale: "de-AT", style: DateLong, expected: "5. März 2024"},
+		{locale: "es", style: DateLong, expected: "5 de marzo de 2024"},
+		{locale: "ja", style: DateLong, expected: "2024年3月5日"},
+	}
+	for _, test := range dates {
+		if formatted := localizer.FormatDate(test.locale, date, test.style); formatted != test.expected {
+			t.Errorf("%s %d: expected %s, got %s", test.locale, test.style, test.expected, formatted)
+		}
+	}
+}
+
+func TestLocalizer_Funcs(t *testing.T) {
+	templates := fstest.MapFS{
+		"cart.html": {Data: []byte(`{{t .Locale "welcome" .Params}}: {{tn .Locale "cart.items" .Count}}, {{number .Locale .Total 2}} ({{date .Locale .Date "long"}})`)},
+	}
+
+	var testTools Tools
+	renderer, err := testTools.NewRenderer(templates, RendererOptions{Funcs: testLocalizer().Funcs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := renderer.RenderString("cart", map[string]any{
+		"Locale": "en",
+		"Params": map[string]any{"name": "Ann"},
+		"Count":  3,
+		"Total":  1999,
+		"Date":   time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "Welcome, Ann: 3 items, 1,999.00 (March 5, 2024)" {
+		t.Error("wrong body", body)
+	}
+}
@@ -0,0 +1,81 @@
+package toolkit
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Logger is the interface used by the toolkit to log what it does, with a message followed by alternating
+// keys and values, such as Warn("upload failed", "dir", dir, "err", err). It matches the methods of
+// *slog.Logger, so one can be used directly, as can adapters for zap, zerolog and the like.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// stdLogger is a Logger writing lines such as `WARN upload failed dir=/tmp err="disk full"` to a *log.Logger.
+type stdLogger struct {
+	log   *log.Logger
+	debug bool
+}
+
+// NewStdLogger returns a Logger writing to l, as logfmt style lines. Debug messages are dropped unless debug is set.
+func NewStdLogger(l *log.Logger, debug bool) Logger {
+	return &stdLogger{log: l, debug: debug}
+}
+
+func (l *stdLogger) Debug(msg string, args ...any) {
+	if l.debug {
+		l.output("DEBUG", msg, args)
+	}
+}
+
+func (l *stdLogger) Info(msg string, args ...any)  { l.output("INFO", msg, args) }
+func (l *stdLogger) Warn(msg string, args ...any)  { l.output("WARN", msg, args) }
+func (l *stdLogger) Error(msg string, args ...any) { l.output("ERROR", msg, args) }
+
+// output writes a line with level, msg and the key value pairs in args.
+func (l *stdLogger) output(level, msg string, args []any) {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteByte(' ')
+	b.WriteString(msg)
+
+	for i := 0; i < len(args); i += 2 {
+		key, value := "!BADKEY", args[i]
+		if i+1 < len(args) {
+			key, value = fmt.Sprint(args[i]), args[i+1]
+		}
+
+		s := fmt.Sprint(value)
+		if s == "" || strings.ContainsAny(s, " =\"\n\t") {
+			s = strconv.Quote(s)
+		}
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(s)
+	}
+
+	_ = l.log.Output(3, b.String())
+}
+
+// logger returns Tools.Logger, or a Logger writing to the error log if it isn't set.
+func (t *Tools) logger() Logger {
+	if t.Logger != nil {
+		return t.Logger
+	}
+	return NewStdLogger(t.errorLog(), false)
+}
+
+// errorLog returns the *log.Logger errors should be written to.
+func (t *Tools) errorLog() *log.Logger {
+	if t.ErrorLog != nil {
+		return t.ErrorLog
+	}
+	return log.Default()
+}
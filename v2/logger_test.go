@@ -0,0 +1,101 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingLogger is a Logger keeping every message, as "LEVEL msg", for tests to check.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) record(level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, level+" "+msg)
+}
+
+func (l *recordingLogger) Debug(msg string, args ...any) { l.record("DEBUG", msg) }
+func (l *recordingLogger) Info(msg string, args ...any)  { l.record("INFO", msg) }
+func (l *recordingLogger) Warn(msg string, args ...any)  { l.record("WARN", msg) }
+func (l *recordingLogger) Error(msg string, args ...any) { l.record("ERROR", msg) }
+
+func (l *recordingLogger) contains(message string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range l.messages {
+		if m == message {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStdLogger(log.New(&buf, "", 0), false)
+
+	logger.Debug("not shown")
+	logger.Warn("upload failed", "dir", "/tmp/uploads", "err", errors.New("disk full"), "size", 42, "odd")
+
+	expected := "WARN upload failed dir=/tmp/uploads err=\"disk full\" size=42 !BADKEY=odd\n"
+	if buf.String() != expected {
+		t.Errorf("wrong output\n got %q\nwant %q", buf.String(), expected)
+	}
+
+	buf.Reset()
+	NewStdLogger(log.New(&buf, "", 0), true).Debug("shown", "empty", "")
+	if buf.String() != "DEBUG shown empty=\"\"\n" {
+		t.Errorf("wrong debug output %q", buf.String())
+	}
+}
+
+func TestTools_Logger(t *testing.T) {
+	logger := &recordingLogger{}
+	testTools := Tools{
+		Logger:      logger,
+		RemoteRetry: &RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond},
+	}
+
+	// a failed ReadJSON
+	var data struct{}
+	req := httptest.NewRequest("POST", "/", strings.NewReader("{bad json"))
+	_ = testTools.ReadJSON(httptest.NewRecorder(), req, &data)
+
+	// a failed upload
+	req = httptest.NewRequest("POST", "/upload", strings.NewReader("not multipart"))
+	_, _ = testTools.UploadFiles(req, t.TempDir())
+
+	// a retried remote call
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusBadGateway, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header)}
+	})
+	_, _, _ = testTools.PushJSONToRemote("http://example.com", data, client)
+
+	// a panic
+	testTools.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(fmt.Sprint("boom"))
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	for _, message := range []string{
+		"DEBUG invalid JSON body",
+		"WARN upload failed",
+		"WARN retrying remote call",
+		"ERROR panic serving request",
+	} {
+		if !logger.contains(message) {
+			t.Errorf("expected %q to be logged, got %q", message, logger.messages)
+		}
+	}
+}
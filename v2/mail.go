@@ -0,0 +1,792 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+var (
+	// ErrMailQueueFull is returned by Mailer.Enqueue when the queue has no room left.
+	ErrMailQueueFull = errors.New("mail queue is full")
+	// ErrInvalidMailHeader is returned for messages whose Headers have a name which is not a valid
+	// header name, or a value spanning several lines, which could add headers of its own.
+	ErrInvalidMailHeader = errors.New("invalid mail header")
+)
+
+// Message is an email. Addresses may include a display name, as in "Jane Doe <jane@example.com>".
+type Message struct {
+	From    string
+	To      []string
+	Cc      []string
+	Bcc     []string
+	ReplyTo string
+	Subject string
+	// Text and HTML are the plain text and HTML bodies. Either or both may be set.
+	Text string
+	HTML string
+	// Template, if set, renders the bodies from the Mailer's templates, with Data.
+	Template    string
+	Data        any
+	Attachments []MailAttachment
+	// Headers holds additional headers, such as List-Unsubscribe. Values must fit on a single line.
+	Headers map[string]string
+}
+
+// checkHeaders returns ErrInvalidMailHeader if a name of msg.Headers isn't made of printable ASCII
+// characters other than a colon, or if a value holds a line break.
+func (msg *Message) checkHeaders() error {
+	for name, value := range msg.Headers {
+		if name == "" || strings.IndexFunc(name, func(r rune) bool { return r <= ' ' || r > '~' || r == ':' }) >= 0 {
+			return fmt.Errorf("%w: name %q", ErrInvalidMailHeader, name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%w: value of %s", ErrInvalidMailHeader, name)
+		}
+	}
+	return nil
+}
+
+// MailAttachment is a file attached to a Message.
+type MailAttachment struct {
+	Filename string
+	// ContentType defaults to one guessed from the file name's extension.
+	ContentType string
+	Data        []byte
+}
+
+// MailProvider is the interface implemented by the services which deliver messages.
+type MailProvider interface {
+	SendMail(ctx context.Context, msg *Message) error
+}
+
+// toolsMailProvider is implemented by the providers calling remote APIs, which a Mailer has send their
+// requests with its Tools.
+type toolsMailProvider interface {
+	sendMail(ctx context.Context, t *Tools, msg *Message) error
+}
+
+// MailProviderFunc is an adapter to use a function as a MailProvider.
+type MailProviderFunc func(ctx context.Context, msg *Message) error
+
+// SendMail calls f(ctx, msg).
+func (f MailProviderFunc) SendMail(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+// Mailer sends email through a MailProvider, either right away with Send, or in the background with Enqueue.
+type Mailer struct {
+	// From is the sender of messages which don't set one.
+	From string
+	// Templates holds the message templates: for a Message.Template of "welcome", "welcome.html" is an
+	// html/template and "welcome.txt" a text/template, either of which may be missing. A template may
+	// define a "subject" block, used when the message has no subject.
+	Templates fs.FS
+	// Retry is how queued messages are retried. Defaults to 3 attempts.
+	Retry RetryPolicy
+
+	tools    *Tools
+	provider MailProvider
+
+	mu    sync.Mutex
+	queue chan Message
+	wg    sync.WaitGroup
+}
+
+// NewMailer returns a Mailer delivering messages through provider.
+func (t *Tools) NewMailer(provider MailProvider) *Mailer {
+	return &Mailer{tools: t, provider: provider}
+}
+
+// Send renders msg if it uses a template, checks it, and delivers it.
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	if err := m.prepare(&msg); err != nil {
+		return err
+	}
+	return m.deliver(ctx, &msg)
+}
+
+// deliver sends msg through the provider of m, with the Tools of m for the providers calling remote APIs.
+func (m *Mailer) deliver(ctx context.Context, msg *Message) error {
+	if provider, ok := m.provider.(toolsMailProvider); ok {
+		return provider.sendMail(ctx, m.tools, msg)
+	}
+	return m.provider.SendMail(ctx, msg)
+}
+
+// Start starts workers goroutines sending the messages added with Enqueue, which can hold up to queueSize
+// messages waiting to be sent.
+func (m *Mailer) Start(workers, queueSize int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.queue != nil {
+		return
+	}
+
+	m.queue = make(chan Message, queueSize)
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go func(queue chan Message) {
+			defer m.wg.Done()
+			for msg := range queue {
+				m.sendQueued(msg)
+			}
+		}(m.queue)
+	}
+}
+
+// Enqueue renders and checks msg, then adds it to the queue to be sent in the background by the workers
+// started with Start. Messages which still fail after the retries of Mailer.Retry are logged.
+func (m *Mailer) Enqueue(msg Message) error {
+	if err := m.prepare(&msg); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.queue == nil {
+		return errors.New("the mailer has not been started")
+	}
+
+	select {
+	case m.queue <- msg:
+		return nil
+	default:
+		return ErrMailQueueFull
+	}
+}
+
+// Stop stops accepting messages, and waits for the queued ones to be sent, or for ctx to be done.
+func (m *Mailer) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	if m.queue != nil {
+		close(m.queue)
+		m.queue = nil
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sendQueued sends a queued message, with retries.
+func (m *Mailer) sendQueued(msg Message) {
+	policy := m.Retry
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		m.tools.logger().Warn("retrying email", "subject", msg.Subject, "attempt", attempt, "err", err)
+	}
+
+	err := Retry(context.Background(), policy, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		return m.deliver(ctx, &msg)
+	})
+	if err != nil {
+		m.tools.logger().Error("email could not be sent", "to", strings.Join(msg.To, ","), "subject", msg.Subject, "err", err)
+	}
+}
+
+// prepare sets the default sender, renders the message's template, and checks the message can be sent.
+func (m *Mailer) prepare(msg *Message) error {
+	if msg.From == "" {
+		msg.From = m.From
+	}
+
+	if msg.Template != "" {
+		if err := m.render(msg); err != nil {
+			return err
+		}
+	}
+
+	if msg.From == "" {
+		return errors.New("the message has no sender")
+	}
+	if len(msg.To)+len(msg.Cc)+len(msg.Bcc) == 0 {
+		return errors.New("the message has no recipients")
+	}
+	for _, addr := range append(append(append([]string{msg.From}, msg.To...), msg.Cc...), msg.Bcc...) {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("invalid address %q", addr)
+		}
+	}
+	if msg.Text == "" && msg.HTML == "" {
+		return errors.New("the message has no body")
+	}
+	return nil
+}
+
+// render executes the templates of msg into its bodies, and subject if it has none.
+func (m *Mailer) render(msg *Message) error {
+	if m.Templates == nil {
+		return errors.New("the mailer has no templates")
+	}
+
+	found := false
+	subject := ""
+
+	if src, err := fs.ReadFile(m.Templates, msg.Template+".html"); err == nil {
+		tmpl, err := htmltemplate.New(msg.Template).Parse(string(src))
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err = tmpl.Execute(&buf, msg.Data); err != nil {
+			return err
+		}
+		msg.HTML = buf.String()
+		if s := tmpl.Lookup("subject"); s != nil {
+			buf.Reset()
+			if err = s.Execute(&buf, msg.Data); err != nil {
+				return err
+			}
+			subject = buf.String()
+		}
+		found = true
+	}
+
+	if src, err := fs.ReadFile(m.Templates, msg.Template+".txt"); err == nil {
+		tmpl, err := texttemplate.New(msg.Template).Parse(string(src))
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err = tmpl.Execute(&buf, msg.Data); err != nil {
+			return err
+		}
+		msg.Text = buf.String()
+		if s := tmpl.Lookup("subject"); s != nil {
+			buf.Reset()
+			if err = s.Execute(&buf, msg.Data); err != nil {
+				return err
+			}
+			subject = buf.String()
+		}
+		found = true
+	}
+
+	if !found {
+		return fmt.Errorf("no template called %q", msg.Template)
+	}
+	if msg.Subject == "" {
+		msg.Subject = strings.TrimSpace(subject)
+	}
+	return nil
+}
+
+// Bytes returns the message in MIME format, as sent over SMTP. Bcc recipients are left out.
+func (msg *Message) Bytes() ([]byte, error) {
+	if err := msg.checkHeaders(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+
+	header("From", formatAddress(msg.From))
+	if len(msg.To) > 0 {
+		header("To", formatAddressList(msg.To))
+	}
+	if len(msg.Cc) > 0 {
+		header("Cc", formatAddressList(msg.Cc))
+	}
+	if msg.ReplyTo != "" {
+		header("Reply-To", formatAddress(msg.ReplyTo))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+NewULID()+"@"+messageIDHost(msg.From)+">")
+	for name, value := range msg.Headers {
+		header(textproto.CanonicalMIMEHeaderKey(name), mime.QEncoding.Encode("utf-8", value))
+	}
+	header("MIME-Version", "1.0")
+
+	if len(msg.Attachments) == 0 {
+		err := writeMailBody(func(h textproto.MIMEHeader) (io.Writer, error) {
+			for _, name := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+				if value := h.Get(name); value != "" {
+					header(name, value)
+				}
+			}
+			buf.WriteString("\r\n")
+			return &buf, nil
+		}, msg)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	buf.WriteString("\r\n")
+
+	if err := writeMailBody(mixed.CreatePart, msg); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range msg.Attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(strings.ToLower(filepath.Ext(attachment.Filename)))
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeBase64Lines(part, attachment.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeMailBody writes the text and HTML bodies of msg, as a multipart/alternative if there are both.
+// createPart writes the given content headers, and returns where the content goes.
+func writeMailBody(createPart func(textproto.MIMEHeader) (io.Writer, error), msg *Message) error {
+	if msg.Text == "" || msg.HTML == "" {
+		contentType, body := "text/plain; charset=utf-8", msg.Text
+		if msg.HTML != "" {
+			contentType, body = "text/html; charset=utf-8", msg.HTML
+		}
+		w, err := createPart(textproto.MIMEHeader{"Content-Type": {contentType}, "Content-Transfer-Encoding": {"quoted-printable"}})
+		if err != nil {
+			return err
+		}
+		return writeQuotedPrintable(w, body)
+	}
+
+	var buf bytes.Buffer
+	alternative := multipart.NewWriter(&buf)
+	for _, body := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {body.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+		if err = writeQuotedPrintable(part, body.content); err != nil {
+			return err
+		}
+	}
+	if err := alternative.Close(); err != nil {
+		return err
+	}
+
+	w, err := createPart(textproto.MIMEHeader{"Content-Type": {"multipart/alternative; boundary=" + alternative.Boundary()}})
+	if err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// writeQuotedPrintable writes s to w, quoted-printable encoded.
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, s); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64Lines writes data to w base64 encoded, in lines of 76 characters.
+func writeBase64Lines(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := 76
+		if len(encoded) < n {
+			n = len(encoded)
+		}
+		if _, err := io.WriteString(w, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// formatAddress formats addr for a header, encoding the display name if needed.
+func formatAddress(addr string) string {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return addr
+	}
+	return parsed.String()
+}
+
+// formatAddressList formats addrs for a header.
+func formatAddressList(addrs []string) string {
+	formatted := make([]string, len(addrs))
+	for i, addr := range addrs {
+		formatted[i] = formatAddress(addr)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// bareAddress returns the email address in addr, without its display name.
+func bareAddress(addr string) string {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return addr
+	}
+	return parsed.Address
+}
+
+// messageIDHost returns the domain used in Message-IDs: the sender's, or this host's name.
+func messageIDHost(from string) string {
+	if _, domain, found := strings.Cut(bareAddress(from), "@"); found && domain != "" {
+		return domain
+	}
+	if host, err := os.Hostname(); err == nil {
+		return host
+	}
+	return "localhost"
+}
+
+// SMTPProvider delivers messages through an SMTP server.
+type SMTPProvider struct {
+	Host string
+	// Port defaults to 587, or 465 with ImplicitTLS.
+	Port     int
+	Username string
+	Password string
+	// ImplicitTLS connects over TLS from the start (SMTPS), rather than upgrading the connection with STARTTLS.
+	ImplicitTLS bool
+	// TLSConfig, if set, is used for TLS connections.
+	TLSConfig *tls.Config
+	// LocalName is the name sent with EHLO. Defaults to localhost.
+	LocalName string
+}
+
+// SendMail delivers msg. The connection is upgraded with STARTTLS when the server supports it.
+func (p *SMTPProvider) SendMail(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	port := p.Port
+	if port == 0 {
+		port = 587
+		if p.ImplicitTLS {
+			port = 465
+		}
+	}
+	tlsConfig := p.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: p.Host}
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(p.Host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Minute)
+	}
+	if err = conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	if p.ImplicitTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, p.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	localName := p.LocalName
+	if localName == "" {
+		localName = "localhost"
+	}
+	if err = client.Hello(localName); err != nil {
+		return err
+	}
+
+	if !p.ImplicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err = client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", p.Username, p.Password, p.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(bareAddress(msg.From)); err != nil {
+		return err
+	}
+	for _, rcpt := range append(append(append([]string(nil), msg.To...), msg.Cc...), msg.Bcc...) {
+		if err = client.Rcpt(bareAddress(rcpt)); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// SendGridProvider delivers messages through the SendGrid v3 API. Through a Mailer, its requests are
+// checked against Tools.OutboundPolicy, retried according to Tools.RemoteRetry and recorded in Tools.Metrics.
+type SendGridProvider struct {
+	APIKey string
+	// Endpoint defaults to https://api.sendgrid.com/v3/mail/send.
+	Endpoint string
+	// Client defaults to an http.Client with a 30 second timeout, which follows Tools.OutboundPolicy.
+	Client *http.Client
+}
+
+// sendGridAddress is an address in a SendGrid request.
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// SendMail delivers msg, posting it as JSON.
+func (p *SendGridProvider) SendMail(ctx context.Context, msg *Message) error {
+	return p.sendMail(ctx, &Tools{}, msg)
+}
+
+// sendMail delivers msg, sending the request with t.
+func (p *SendGridProvider) sendMail(ctx context.Context, t *Tools, msg *Message) error {
+	if err := msg.checkHeaders(); err != nil {
+		return err
+	}
+	addresses := func(addrs []string) []sendGridAddress {
+		var out []sendGridAddress
+		for _, addr := range addrs {
+			parsed, err := mail.ParseAddress(addr)
+			if err != nil {
+				out = append(out, sendGridAddress{Email: addr})
+				continue
+			}
+			out = append(out, sendGridAddress{Email: parsed.Address, Name: parsed.Name})
+		}
+		return out
+	}
+
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	type attachment struct {
+		Content  string `json:"content"`
+		Filename string `json:"filename"`
+		Type     string `json:"type,omitempty"`
+	}
+	payload := struct {
+		Personalizations []map[string][]sendGridAddress `json:"personalizations"`
+		From             sendGridAddress                `json:"from"`
+		ReplyTo          *sendGridAddress               `json:"reply_to,omitempty"`
+		Subject          string                         `json:"subject"`
+		Content          []content                      `json:"content"`
+		Attachments      []attachment                   `json:"attachments,omitempty"`
+		Headers          map[string]string              `json:"headers,omitempty"`
+	}{
+		From:    addresses([]string{msg.From})[0],
+		Subject: msg.Subject,
+		Headers: msg.Headers,
+	}
+
+	personalization := map[string][]sendGridAddress{}
+	for name, addrs := range map[string][]string{"to": msg.To, "cc": msg.Cc, "bcc": msg.Bcc} {
+		if len(addrs) > 0 {
+			personalization[name] = addresses(addrs)
+		}
+	}
+	payload.Personalizations = append(payload.Personalizations, personalization)
+
+	if msg.ReplyTo != "" {
+		replyTo := addresses([]string{msg.ReplyTo})[0]
+		payload.ReplyTo = &replyTo
+	}
+	if msg.Text != "" {
+		payload.Content = append(payload.Content, content{Type: "text/plain", Value: msg.Text})
+	}
+	if msg.HTML != "" {
+		payload.Content = append(payload.Content, content{Type: "text/html", Value: msg.HTML})
+	}
+	for _, a := range msg.Attachments {
+		payload.Attachments = append(payload.Attachments, attachment{
+			Content:  base64.StdEncoding.EncodeToString(a.Data),
+			Filename: a.Filename,
+			Type:     a.ContentType,
+		})
+	}
+
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.sendgrid.com/v3/mail/send"
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := p.Client
+	if client == nil {
+		client = t.timeoutClient(30 * time.Second)
+	}
+	res, err := t.sendRemote(ctx, endpoint, []*http.Client{client}, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("sendgrid returned status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// MailgunProvider delivers messages through the Mailgun API, sending them in MIME format. Through a
+// Mailer, its requests are checked against Tools.OutboundPolicy, retried according to Tools.RemoteRetry
+// and recorded in Tools.Metrics.
+type MailgunProvider struct {
+	Domain string
+	APIKey string
+	// BaseURL defaults to https://api.mailgun.net; use https://api.eu.mailgun.net for the EU region.
+	BaseURL string
+	// Client defaults to an http.Client with a 30 second timeout, which follows Tools.OutboundPolicy.
+	Client *http.Client
+}
+
+// SendMail delivers msg.
+func (p *MailgunProvider) SendMail(ctx context.Context, msg *Message) error {
+	return p.sendMail(ctx, &Tools{}, msg)
+}
+
+// sendMail delivers msg, sending the request with t.
+func (p *MailgunProvider) sendMail(ctx context.Context, t *Tools, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, rcpt := range append(append(append([]string(nil), msg.To...), msg.Cc...), msg.Bcc...) {
+		if err = form.WriteField("to", rcpt); err != nil {
+			return err
+		}
+	}
+	part, err := form.CreateFormFile("message", "message.mime")
+	if err != nil {
+		return err
+	}
+	if _, err = part.Write(data); err != nil {
+		return err
+	}
+	if err = form.Close(); err != nil {
+		return err
+	}
+
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.mailgun.net"
+	}
+
+	endpoint := strings.TrimSuffix(baseURL, "/") + "/v3/" + p.Domain + "/messages.mime"
+	client := p.Client
+	if client == nil {
+		client = t.timeoutClient(30 * time.Second)
+	}
+	res, err := t.sendRemote(ctx, endpoint, []*http.Client{client}, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.SetBasicAuth("api", p.APIKey)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("mailgun returned status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,418 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMessage_Bytes(t *testing.T) {
+	msg := Message{
+		From:        "Jane Doe <jane@example.com>",
+		To:          []string{"bob@example.com"},
+		Bcc:         []string{"hidden@example.com"},
+		Subject:     "Héllo",
+		Text:        "plain body",
+		HTML:        "<p>html body</p>",
+		Attachments: []MailAttachment{{Filename: "report.pdf", Data: []byte("%PDF-1.4")}},
+	}
+
+	data, err := msg.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); subject != "Héllo" {
+		t.Error("wrong subject", subject)
+	}
+	if strings.Contains(string(data), "hidden@example.com") {
+		t.Error("Bcc recipients must not appear in the message")
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if mediaType != "multipart/mixed" {
+		t.Fatal("wrong content type", mediaType)
+	}
+
+	var parts []string
+	mixed := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		part, err := mixed.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		mediaType, params, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts = append(parts, mediaType)
+
+		if mediaType == "multipart/alternative" {
+			alternative := multipart.NewReader(part, params["boundary"])
+			for {
+				sub, err := alternative.NextPart()
+				if err != nil {
+					break
+				}
+				body, _ := io.ReadAll(sub)
+				parts = append(parts, sub.Header.Get("Content-Type")+" "+string(body))
+			}
+		}
+		if part.FileName() == "report.pdf" {
+			body, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+			if string(body) != "%PDF-1.4" {
+				t.Errorf("wrong attachment %q", body)
+			}
+		}
+	}
+
+	expected := []string{
+		"multipart/alternative",
+		"text/plain; charset=utf-8 plain body",
+		"text/html; charset=utf-8 <p>html body</p>",
+		"application/pdf",
+	}
+	if strings.Join(parts, "|") != strings.Join(expected, "|") {
+		t.Errorf("wrong parts\n got %q\nwant %q", parts, expected)
+	}
+}
+
+// fakeSMTPServer accepts a single message, without TLS or authentication.
+type fakeSMTPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	from     string
+	rcpts    []string
+	data     string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &fakeSMTPServer{listener: listener}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = line
+			s.mu.Unlock()
+			reply("250 OK")
+		case "RCPT":
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, line)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPProvider(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+
+	var testTools Tools
+	mailer := testTools.NewMailer(&SMTPProvider{Host: host, Port: portNumber})
+	mailer.From = "noreply@example.com"
+	mailer.Templates = fstest.MapFS{
+		"welcome.html": {Data: []byte(`{{define "subject"}}Welcome, {{.Name}}{{end}}<p>Hello {{.Name}}</p>`)},
+		"welcome.txt":  {Data: []byte(`Hello {{.Name}}`)},
+	}
+
+	err := mailer.Send(context.Background(), Message{
+		To:       []string{"Bob <bob@example.com>"},
+		Bcc:      []string{"audit@example.com"},
+		Template: "welcome",
+		Data:     map[string]string{"Name": "Bob"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.from != "MAIL FROM:<noreply@example.com> BODY=8BITMIME" && server.from != "MAIL FROM:<noreply@example.com>" {
+		t.Error("wrong sender", server.from)
+	}
+	if strings.Join(server.rcpts, ",") != "RCPT TO:<bob@example.com>,RCPT TO:<audit@example.com>" {
+		t.Error("wrong recipients", server.rcpts)
+	}
+	for _, expected := range []string{"Subject: Welcome, Bob", "Hello Bob", "<p>Hello Bob</p>"} {
+		if !strings.Contains(server.data, expected) {
+			t.Errorf("expected %q in the message:\n%s", expected, server.data)
+		}
+	}
+}
+
+var mailerPrepareTests = []struct {
+	name string
+	msg  Message
+}{
+	{name: "no recipients", msg: Message{From: "a@example.com", Text: "hi"}},
+	{name: "no body", msg: Message{From: "a@example.com", To: []string{"b@example.com"}}},
+	{name: "bad address", msg: Message{From: "a@example.com", To: []string{"not an address"}, Text: "hi"}},
+	{name: "missing template", msg: Message{From: "a@example.com", To: []string{"b@example.com"}, Template: "missing"}},
+}
+
+func TestMailer_Send(t *testing.T) {
+	var testTools Tools
+	mailer := testTools.NewMailer(MailProviderFunc(func(ctx context.Context, msg *Message) error {
+		t.Error("invalid messages must not be sent")
+		return nil
+	}))
+	mailer.Templates = fstest.MapFS{}
+
+	for _, e := range mailerPrepareTests {
+		if err := mailer.Send(context.Background(), e.msg); err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+func TestSendGridProvider(t *testing.T) {
+	var payload map[string]any
+	var requestCtx context.Context
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		requestCtx = req.Context()
+		if req.Header.Get("Authorization") != "Bearer key" {
+			t.Error("wrong authorization", req.Header.Get("Authorization"))
+		}
+		_ = json.NewDecoder(req.Body).Decode(&payload)
+		return &http.Response{StatusCode: http.StatusAccepted, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header)}
+	})
+
+	provider := &SendGridProvider{APIKey: "key", Client: client}
+	err := provider.SendMail(context.Background(), &Message{
+		From:    "Jane <jane@example.com>",
+		To:      []string{"bob@example.com"},
+		Subject: "Hi",
+		Text:    "plain",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, _ := payload["from"].(map[string]any)
+	if from["email"] != "jane@example.com" || from["name"] != "Jane" {
+		t.Error("wrong sender", payload["from"])
+	}
+	personalizations, _ := payload["personalizations"].([]any)
+	if len(personalizations) != 1 {
+		t.Fatal("wrong personalizations", payload["personalizations"])
+	}
+	if to := personalizations[0].(map[string]any)["to"].([]any); len(to) != 1 {
+		t.Error("wrong recipients", to)
+	}
+
+	ctx := context.WithValue(context.Background(), contextKey("mail"), "sendgrid")
+	if err = provider.SendMail(ctx, &Message{From: "jane@example.com", To: []string{"bob@example.com"}}); err != nil || requestCtx.Value(contextKey("mail")) != "sendgrid" {
+		t.Error("expected the request to be sent with the context of SendMail", err)
+	}
+}
+
+func TestMessage_Headers(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		valid   bool
+	}{
+		{name: "valid", headers: map[string]string{"List-Unsubscribe": "<https://example.com/unsubscribe>"}, valid: true},
+		{name: "value with a line break", headers: map[string]string{"X-Campaign": "spring\r\nBcc: victim@example.com"}},
+		{name: "value with a newline", headers: map[string]string{"X-Campaign": "spring\nBcc: victim@example.com"}},
+		{name: "name with a line break", headers: map[string]string{"X-Campaign: a\r\nBcc": "victim@example.com"}},
+		{name: "name with a space", headers: map[string]string{"X Campaign": "spring"}},
+	}
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusAccepted, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header)}
+	})
+	for _, test := range tests {
+		msg := &Message{From: "jane@example.com", To: []string{"bob@example.com"}, Text: "hi", Headers: test.headers}
+		_, err := msg.Bytes()
+		sendErr := (&SendGridProvider{APIKey: "key", Client: client}).SendMail(context.Background(), msg)
+		if test.valid && (err != nil || sendErr != nil) {
+			t.Errorf("%s: expected no error, got %v, %v", test.name, err, sendErr)
+		}
+		if !test.valid && (!errors.Is(err, ErrInvalidMailHeader) || !errors.Is(sendErr, ErrInvalidMailHeader)) {
+			t.Errorf("%s: expected ErrInvalidMailHeader, got %v, %v", test.name, err, sendErr)
+		}
+	}
+}
+
+func TestMailgunProvider(t *testing.T) {
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		user, password, _ := req.BasicAuth()
+		if user != "api" || password != "key" {
+			t.Error("wrong credentials", user, password)
+		}
+		if req.URL.String() != "https://api.mailgun.net/v3/mg.example.com/messages.mime" {
+			t.Error("wrong URL", req.URL)
+		}
+		_ = req.ParseMultipartForm(1 << 20)
+		if strings.Join(req.MultipartForm.Value["to"], ",") != "bob@example.com,carol@example.com" {
+			t.Error("wrong recipients", req.MultipartForm.Value["to"])
+		}
+		if len(req.MultipartForm.File["message"]) != 1 {
+			t.Error("missing message")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header)}
+	})
+
+	provider := &MailgunProvider{Domain: "mg.example.com", APIKey: "key", Client: client}
+	err := provider.SendMail(context.Background(), &Message{
+		From: "jane@example.com",
+		To:   []string{"bob@example.com"},
+		Bcc:  []string{"carol@example.com"},
+		Text: "plain",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMailer_RemoteProviders(t *testing.T) {
+	var requests int
+	var bodies []string
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		requests++
+		body, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+		status := http.StatusAccepted
+		if requests == 1 {
+			status = http.StatusServiceUnavailable
+		}
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header)}
+	})
+
+	testTools := Tools{Logger: &recordingLogger{}, Metrics: NewMetrics(), RemoteRetry: &RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond}}
+	msg := Message{From: "jane@example.com", To: []string{"bob@example.com"}, Subject: "Hi", Text: "plain"}
+	if err := testTools.NewMailer(&SendGridProvider{APIKey: "key", Client: client}).Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 || bodies[0] == "" || bodies[1] != bodies[0] {
+		t.Errorf("expected the request to be retried whole, got %d requests", requests)
+	}
+	out := testTools.Metrics.String()
+	for _, line := range []string{`toolkit_remote_requests_total{code="2xx"} 1`, `toolkit_remote_requests_total{code="5xx"} 1`} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected metrics to contain %q, got:\n%s", line, out)
+		}
+	}
+
+	testTools.OutboundPolicy = &OutboundPolicy{}
+	mailer := testTools.NewMailer(&MailgunProvider{Domain: "mg.example.com", APIKey: "key", BaseURL: "http://127.0.0.1:1"})
+	if err := mailer.Send(context.Background(), msg); !errors.Is(err, ErrPrivateAddress) {
+		t.Error("expected the outbound policy to refuse the request, got", err)
+	}
+}
+
+func TestMailer_Enqueue(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	var sent []string
+
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+	mailer := testTools.NewMailer(MailProviderFunc(func(ctx context.Context, msg *Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if msg.Subject == "fails once" && attempts == 1 {
+			return errors.New("temporary failure")
+		}
+		if msg.Subject == "always fails" {
+			return errors.New("rejected")
+		}
+		sent = append(sent, msg.Subject)
+		return nil
+	}))
+	mailer.From = "noreply@example.com"
+	mailer.Retry = RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond}
+
+	if err := mailer.Enqueue(Message{To: []string{"a@example.com"}, Text: "hi"}); err == nil {
+		t.Error("expected an error before Start")
+	}
+
+	mailer.Start(1, 10)
+	for _, subject := range []string{"fails once", "always fails"} {
+		if err := mailer.Enqueue(Message{To: []string{"a@example.com"}, Subject: subject, Text: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mailer.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(sent, ",") != "fails once" {
+		t.Error("wrong messages sent", sent)
+	}
+	if !logger.contains("WARN retrying email") || !logger.contains("ERROR email could not be sent") {
+		t.Error("expected the failures to be logged, got", logger.messages)
+	}
+}
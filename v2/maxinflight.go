@@ -0,0 +1,145 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ErrOverloaded is sent by the MaxInFlight middleware, with a 503 status code, to the requests it sheds.
+var ErrOverloaded = errors.New("the server is too busy, try again later")
+
+// MaxInFlightOptions is the type used to configure the MaxInFlight middleware.
+type MaxInFlightOptions struct {
+	// Limit is the number of requests handled at once. Zero means no limit but those of Routes.
+	Limit int
+	// Routes limits the requests handled at once for some routes, such as uploads, on top of Limit,
+	// keyed by path prefix, such as "/uploads/", optionally after a method, as in "POST /uploads/".
+	// The longest matching prefix wins. A negative limit exempts the route, such as a health check,
+	// from every limit.
+	Routes map[string]int
+	// QueueTimeout is how long a request waits for a free slot before it is shed. Defaults to 100
+	// milliseconds; a negative value sheds requests at once.
+	QueueTimeout time.Duration
+	// MaxQueue, if set, is the number of requests which may wait for a slot at once; further requests
+	// are shed at once.
+	MaxQueue int
+	// RetryAfter is the delay sent in the Retry-After header of shed requests. Defaults to one second.
+	RetryAfter time.Duration
+}
+
+// MaxInFlight returns middleware which limits how many requests are handled at once, in all and per
+// route, so that a burst of requests, such as large uploads, can't exhaust the memory of the server.
+// Requests over the limit wait briefly for a slot, then are shed with a 503 JSON error and a
+// Retry-After header. Requests whose client goes away while they wait get no response.
+func (t *Tools) MaxInFlight(opts MaxInFlightOptions) func(http.Handler) http.Handler {
+	if opts.QueueTimeout == 0 {
+		opts.QueueTimeout = 100 * time.Millisecond
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = time.Second
+	}
+
+	var global chan struct{}
+	if opts.Limit > 0 {
+		global = make(chan struct{}, opts.Limit)
+	}
+	routes := make(map[string]chan struct{}, len(opts.Routes))
+	for route, limit := range opts.Routes {
+		if limit > 0 {
+			routes[route] = make(chan struct{}, limit)
+		}
+	}
+	var waiting atomic.Int64
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, longest := "", -1
+			for candidate := range opts.Routes {
+				if score, ok := matchRoute(r, candidate); ok && score > longest {
+					route, longest = candidate, score
+				}
+			}
+			if longest >= 0 && opts.Routes[route] < 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// the route slot is taken first, so that requests waiting for it don't hold a global slot
+			slots := make([]chan struct{}, 0, 2)
+			if routeSlots := routes[route]; longest >= 0 && routeSlots != nil {
+				slots = append(slots, routeSlots)
+			}
+			if global != nil {
+				slots = append(slots, global)
+			}
+
+			var deadline <-chan time.Time
+			acquired := 0
+			defer func() {
+				for _, s := range slots[:acquired] {
+					<-s
+				}
+			}()
+			for _, s := range slots {
+				select {
+				case s <- struct{}{}:
+					acquired++
+					continue
+				default:
+				}
+
+				if opts.QueueTimeout < 0 || (opts.MaxQueue > 0 && waiting.Load() >= int64(opts.MaxQueue)) {
+					t.shed(w, r, opts)
+					return
+				}
+				if deadline == nil {
+					timer := time.NewTimer(opts.QueueTimeout)
+					defer timer.Stop()
+					deadline = timer.C
+				}
+				switch waitForSlot(r.Context(), s, deadline, &waiting) {
+				case nil:
+					acquired++
+				case errQueueTimeout:
+					t.shed(w, r, opts)
+					return
+				default:
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// errQueueTimeout is returned by waitForSlot when no slot was free in time.
+var errQueueTimeout = errors.New("no free slot in time")
+
+// waitForSlot waits for a free slot in slots, until deadline, when it returns errQueueTimeout,
+// or until ctx is done, when it returns its error. waiting counts the requests waiting.
+func waitForSlot(ctx context.Context, slots chan struct{}, deadline <-chan time.Time, waiting *atomic.Int64) error {
+	waiting.Add(1)
+	defer waiting.Add(-1)
+
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-deadline:
+		return errQueueTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shed refuses r with ErrOverloaded.
+func (t *Tools) shed(w http.ResponseWriter, r *http.Request, opts MaxInFlightOptions) {
+	t.logger().Warn("request shed", "method", r.Method, "path", r.URL.Path)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(opts.RetryAfter.Seconds()))))
+	_ = t.ErrorJSON(w, ErrOverloaded, http.StatusServiceUnavailable)
+}
@@ -0,0 +1,118 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// blockingHandler returns a handler which signals entered when a request comes in, then waits for
+// release before responding, unless the path is /fast or /health.
+func blockingHandler(entered chan<- string, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fast" && r.URL.Path != "/health" {
+			entered <- r.URL.Path
+			<-release
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func TestTools_MaxInFlight(t *testing.T) {
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+	entered := make(chan string, 10)
+	release := make(chan struct{})
+	handler := testTools.MaxInFlight(MaxInFlightOptions{
+		Limit:        2,
+		Routes:       map[string]int{"POST /uploads/": 1, "/health": -1},
+		QueueTimeout: 50 * time.Millisecond,
+		RetryAfter:   1500 * time.Millisecond,
+	})(blockingHandler(entered, release))
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+	background := func(method, path string) <-chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() { done <- serve(method, path) }()
+		return done
+	}
+
+	upload := background("POST", "/uploads/a")
+	<-entered
+
+	// the upload route is full, but not the server
+	rr := serve("POST", "/uploads/b")
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected a 503 with Retry-After 2, got %d, %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if !logger.contains("WARN request shed") {
+		t.Error("expected the shed request to be logged")
+	}
+	if rr = serve("GET", "/fast"); rr.Code != http.StatusNoContent {
+		t.Errorf("expected another route to be served, got %d", rr.Code)
+	}
+
+	// the server is full, but the health check is exempt
+	other := background("GET", "/reports")
+	<-entered
+	if rr = serve("GET", "/fast"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected a 503 once the server is full, got %d", rr.Code)
+	}
+	if rr = serve("GET", "/health"); rr.Code != http.StatusNoContent {
+		t.Errorf("expected the exempt route to be served, got %d", rr.Code)
+	}
+
+	// a request waiting in the queue gets the slot freed in time
+	waiting := background("GET", "/fast")
+	time.Sleep(5 * time.Millisecond)
+	release <- struct{}{}
+	if rr = <-waiting; rr.Code != http.StatusNoContent {
+		t.Errorf("expected the queued request to be served, got %d", rr.Code)
+	}
+
+	close(release)
+	for _, done := range []<-chan *httptest.ResponseRecorder{upload, other} {
+		if rr = <-done; rr.Code != http.StatusNoContent {
+			t.Errorf("expected 204, got %d", rr.Code)
+		}
+	}
+}
+
+func TestTools_MaxInFlight_Queue(t *testing.T) {
+	var testTools Tools
+	entered := make(chan string, 10)
+	release := make(chan struct{})
+	handler := testTools.MaxInFlight(MaxInFlightOptions{Limit: 1, MaxQueue: 1, QueueTimeout: time.Second})(blockingHandler(entered, release))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+	<-entered
+
+	// a client going away while it waits gets no response
+	ctx, cancel := context.WithCancel(context.Background())
+	gone := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/fast", nil).WithContext(ctx))
+		gone <- rr
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// the queue is full
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/fast", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected a 503 with a full queue, got %d", rr.Code)
+	}
+
+	cancel()
+	if rr = <-gone; rr.Body.Len() != 0 {
+		t.Errorf("expected no response to a canceled request, got %q", rr.Body.String())
+	}
+	close(release)
+}
@@ -0,0 +1,336 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnsupportedMedia is returned by a MediaProber for files whose format it can't read.
+	ErrUnsupportedMedia = errors.New("unsupported media format")
+	// ErrMediaTooLong is returned by uploads refused because audio or video lasts longer than Tools.MaxMediaDuration.
+	ErrMediaTooLong = errors.New("the media file is too long")
+	// ErrVideoTooLarge is returned by uploads refused because a video has more pixels than Tools.MaxVideoPixels.
+	ErrVideoTooLarge = errors.New("the video resolution is too high")
+)
+
+// MediaInfo describes an audio or video file.
+type MediaInfo struct {
+	Duration time.Duration
+	// VideoCodec is the codec of the first video stream, such as "h264" or "avc1", or "" if there is none.
+	VideoCodec string
+	// AudioCodec is the codec of the first audio stream, such as "aac" or "mp4a", or "" if there is none.
+	AudioCodec string
+	// Width and Height are the dimensions of the first video stream.
+	Width, Height int
+}
+
+// MediaProber is the interface implemented by the ways to read the MediaInfo of the audio and video
+// files uploaded with UploadFiles.
+type MediaProber interface {
+	// ProbeMedia returns the MediaInfo of the file at path, or ErrUnsupportedMedia if it can't read its format.
+	ProbeMedia(ctx context.Context, path string) (*MediaInfo, error)
+}
+
+// FFProbe is a MediaProber running ffprobe, which reads about any format, but has to be installed.
+type FFProbe struct {
+	// Path is the ffprobe executable. Defaults to ffprobe, looked up in PATH.
+	Path string
+}
+
+// ProbeMedia implements MediaProber.
+func (p FFProbe) ProbeMedia(ctx context.Context, path string) (*MediaInfo, error) {
+	command := p.Path
+	if command == "" {
+		command = "ffprobe"
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", "--", path)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if stderr.Len() > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedMedia, strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+	return parseFFProbe(output)
+}
+
+// parseFFProbe returns the MediaInfo in the JSON output of ffprobe.
+func parseFFProbe(output []byte) (*MediaInfo, error) {
+	var probe struct {
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+			Duration  string `json:"duration"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, err
+	}
+
+	info := &MediaInfo{}
+	duration := probe.Format.Duration
+	for _, stream := range probe.Streams {
+		switch {
+		case stream.CodecType == "video" && info.VideoCodec == "":
+			info.VideoCodec, info.Width, info.Height = stream.CodecName, stream.Width, stream.Height
+		case stream.CodecType == "audio" && info.AudioCodec == "":
+			info.AudioCodec = stream.CodecName
+		default:
+			continue
+		}
+		if duration == "" {
+			duration = stream.Duration
+		}
+	}
+	if info.VideoCodec == "" && info.AudioCodec == "" {
+		return nil, ErrUnsupportedMedia
+	}
+
+	if seconds, err := strconv.ParseFloat(duration, 64); err == nil {
+		info.Duration = time.Duration(seconds * float64(time.Second))
+	}
+	return info, nil
+}
+
+// NativeMediaProber is a MediaProber reading the headers of MP4 and QuickTime (mp4, m4a, m4v, mov,
+// 3gp) and WAV files itself, without any external program. Codecs are the sample entry types of the
+// tracks, such as "avc1", "hvc1" or "mp4a", and "pcm" for uncompressed WAV files.
+type NativeMediaProber struct{}
+
+// ProbeMedia implements MediaProber.
+func (NativeMediaProber) ProbeMedia(ctx context.Context, path string) (*MediaInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 12)
+	if _, err = f.ReadAt(header, 0); err != nil {
+		return nil, ErrUnsupportedMedia
+	}
+	switch {
+	case string(header[4:8]) == "ftyp":
+		return probeMP4(f, stat.Size())
+	case string(header[:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return probeWAV(f, stat.Size())
+	}
+	return nil, ErrUnsupportedMedia
+}
+
+// maxMP4MovieBox limits how much of the moov box of an MP4 file is read, as it is kept in memory.
+const maxMP4MovieBox = 64 * 1024 * 1024
+
+// mp4Box is a box, or atom, of an MP4 file: its type and content.
+type mp4Box struct {
+	kind    string
+	content []byte
+}
+
+// mp4Boxes returns the boxes which data is made of.
+func mp4Boxes(data []byte) []mp4Box {
+	var boxes []mp4Box
+	for len(data) >= 8 {
+		size, header := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		kind := string(data[4:8])
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return boxes
+			}
+			size, header = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return boxes
+		}
+		boxes = append(boxes, mp4Box{kind: kind, content: data[header:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+// mp4Child returns the content of the first box of kind within data, or nil.
+func mp4Child(data []byte, kind string) []byte {
+	for _, box := range mp4Boxes(data) {
+		if box.kind == kind {
+			return box.content
+		}
+	}
+	return nil
+}
+
+// probeMP4 reads the MediaInfo of the MP4 or QuickTime file in r, of size bytes, from its moov box.
+func probeMP4(r io.ReaderAt, size int64) (*MediaInfo, error) {
+	// top level boxes are read one header at a time, since mdat, holding the media, can be huge
+	var moov []byte
+	for offset := int64(0); offset+8 <= size; {
+		header := make([]byte, 16)
+		n, err := r.ReadAt(header, offset)
+		if n < 8 {
+			return nil, err
+		}
+		boxSize, headerSize := int64(binary.BigEndian.Uint32(header)), int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = size - offset
+		case 1:
+			if n < 16 {
+				return nil, ErrUnsupportedMedia
+			}
+			boxSize, headerSize = int64(binary.BigEndian.Uint64(header[8:])), 16
+		}
+		if boxSize < headerSize || offset+boxSize > size {
+			return nil, ErrUnsupportedMedia
+		}
+
+		if string(header[4:8]) == "moov" {
+			if boxSize-headerSize > maxMP4MovieBox {
+				return nil, ErrUnsupportedMedia
+			}
+			moov = make([]byte, boxSize-headerSize)
+			if _, err = r.ReadAt(moov, offset+headerSize); err != nil {
+				return nil, err
+			}
+			break
+		}
+		offset += boxSize
+	}
+	if moov == nil {
+		return nil, ErrUnsupportedMedia
+	}
+
+	info := &MediaInfo{}
+	if mvhd := mp4Child(moov, "mvhd"); len(mvhd) >= 32 {
+		var timescale, duration uint64
+		if mvhd[0] == 1 {
+			timescale, duration = uint64(binary.BigEndian.Uint32(mvhd[20:])), binary.BigEndian.Uint64(mvhd[24:])
+		} else {
+			timescale, duration = uint64(binary.BigEndian.Uint32(mvhd[12:])), uint64(binary.BigEndian.Uint32(mvhd[16:]))
+		}
+		if timescale > 0 {
+			info.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+		}
+	}
+
+	for _, trak := range mp4Boxes(moov) {
+		if trak.kind != "trak" {
+			continue
+		}
+		mdia := mp4Child(trak.content, "mdia")
+		hdlr := mp4Child(mdia, "hdlr")
+		stsd := mp4Child(mp4Child(mp4Child(mdia, "minf"), "stbl"), "stsd")
+		if len(hdlr) < 12 || len(stsd) < 16 {
+			continue
+		}
+		codec := strings.TrimSpace(string(stsd[12:16]))
+
+		switch string(hdlr[8:12]) {
+		case "vide":
+			if info.VideoCodec != "" {
+				continue
+			}
+			info.VideoCodec = codec
+			// the last 8 bytes of tkhd are the width and height, as 16.16 fixed point numbers
+			if tkhd := mp4Child(trak.content, "tkhd"); len(tkhd) >= 84 {
+				info.Width = int(binary.BigEndian.Uint32(tkhd[len(tkhd)-8:]) >> 16)
+				info.Height = int(binary.BigEndian.Uint32(tkhd[len(tkhd)-4:]) >> 16)
+			}
+		case "soun":
+			if info.AudioCodec == "" {
+				info.AudioCodec = codec
+			}
+		}
+	}
+	if info.VideoCodec == "" && info.AudioCodec == "" {
+		return nil, ErrUnsupportedMedia
+	}
+	return info, nil
+}
+
+// probeWAV reads the MediaInfo of the WAV file in r, of size bytes, from its fmt and data chunks.
+func probeWAV(r io.ReaderAt, size int64) (*MediaInfo, error) {
+	info := &MediaInfo{}
+	var byteRate uint32
+	for offset := int64(12); offset+8 <= size; {
+		header := make([]byte, 8)
+		if _, err := r.ReadAt(header, offset); err != nil {
+			return nil, err
+		}
+		chunkSize := int64(binary.LittleEndian.Uint32(header[4:]))
+
+		switch string(header[:4]) {
+		case "fmt ":
+			format := make([]byte, 16)
+			if _, err := r.ReadAt(format, offset+8); err != nil {
+				return nil, ErrUnsupportedMedia
+			}
+			if code := binary.LittleEndian.Uint16(format); code == 1 {
+				info.AudioCodec = "pcm"
+			} else {
+				info.AudioCodec = fmt.Sprintf("wav format %d", code)
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:])
+		case "data":
+			if byteRate == 0 {
+				return nil, ErrUnsupportedMedia
+			}
+			// a streamed file may not know its length, and record it as 0 or 0xffffffff
+			if chunkSize == 0 || chunkSize == 0xffffffff || offset+8+chunkSize > size {
+				chunkSize = size - offset - 8
+			}
+			info.Duration = time.Duration(float64(chunkSize) / float64(byteRate) * float64(time.Second))
+			return info, nil
+		}
+		// chunks are padded to an even size
+		offset += 8 + chunkSize + chunkSize%2
+	}
+	return nil, ErrUnsupportedMedia
+}
+
+// checkMedia reads the MediaInfo of the uploaded audio or video file at path with Tools.MediaProber,
+// and checks it against Tools.MaxMediaDuration and Tools.MaxVideoPixels. Files whose format the
+// prober doesn't support are refused, or pass with no MediaInfo if Tools.AllowUnprobedMedia is set.
+func (t *Tools) checkMedia(ctx context.Context, path string) (*MediaInfo, error) {
+	info, err := t.MediaProber.ProbeMedia(ctx, path)
+	if errors.Is(err, ErrUnsupportedMedia) && t.AllowUnprobedMedia {
+		t.logger().Debug("media not probed", "path", path, "err", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if t.MaxMediaDuration > 0 && info.Duration > t.MaxMediaDuration {
+		return info, ErrMediaTooLong
+	}
+	if t.MaxVideoPixels > 0 && int64(info.Width)*int64(info.Height) > t.MaxVideoPixels {
+		return info, ErrVideoTooLarge
+	}
+	return info, nil
+}
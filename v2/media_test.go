@@ -0,0 +1,175 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// box builds an MP4 box of kind holding content.
+func box(kind string, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(8+len(body)))
+	copy(header[4:], kind)
+	return append(header, body...)
+}
+
+// testTrack builds an MP4 track with handler, such as "vide", and codec, such as "avc1".
+func testTrack(handler, codec string, width, height uint32) []byte {
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], width<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], height<<16)
+
+	hdlr := make([]byte, 24)
+	copy(hdlr[8:], handler)
+
+	stsd := make([]byte, 16)
+	binary.BigEndian.PutUint32(stsd[4:], 1)
+	binary.BigEndian.PutUint32(stsd[8:], 8)
+	copy(stsd[12:], codec)
+
+	return box("trak", box("tkhd", tkhd), box("mdia", box("hdlr", hdlr), box("minf", box("stbl", box("stsd", stsd)))))
+}
+
+// testMP4 builds an MP4 file of duration, with an H.264 video track and an AAC audio track.
+func testMP4(duration time.Duration, width, height uint32) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], uint32(duration.Milliseconds()))
+
+	ftyp := box("ftyp", []byte("isom\x00\x00\x02\x00isomavc1"))
+	mdat := box("mdat", make([]byte, 1024))
+	moov := box("moov", box("mvhd", mvhd), testTrack("vide", "avc1", width, height), testTrack("soun", "mp4a", 0, 0))
+	return bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+}
+
+// testWAV builds a 16-bit mono PCM WAV file of duration, at 8kHz.
+func testWAV(duration time.Duration) []byte {
+	data := make([]byte, int(duration.Seconds()*16000))
+	fmtChunk := make([]byte, 16)
+	binary.LittleEndian.PutUint16(fmtChunk, 1)
+	binary.LittleEndian.PutUint16(fmtChunk[2:], 1)
+	binary.LittleEndian.PutUint32(fmtChunk[4:], 8000)
+	binary.LittleEndian.PutUint32(fmtChunk[8:], 16000)
+	binary.LittleEndian.PutUint16(fmtChunk[12:], 2)
+	binary.LittleEndian.PutUint16(fmtChunk[14:], 16)
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(4+8+16+8+len(data)))
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(16))
+	buf.Write(fmtChunk)
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestNativeMediaProber(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		data     []byte
+		expected MediaInfo
+		err      error
+	}{
+		{name: "clip.mp4", data: testMP4(90*time.Second, 1920, 1080), expected: MediaInfo{Duration: 90 * time.Second, VideoCodec: "avc1", AudioCodec: "mp4a", Width: 1920, Height: 1080}},
+		{name: "voice.wav", data: testWAV(3 * time.Second), expected: MediaInfo{Duration: 3 * time.Second, AudioCodec: "pcm"}},
+		{name: "notes.txt", data: []byte("hello, world"), err: ErrUnsupportedMedia},
+		{name: "truncated.mp4", data: testMP4(time.Second, 640, 480)[:100], err: ErrUnsupportedMedia},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		if err := os.WriteFile(path, test.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := NativeMediaProber{}.ProbeMedia(context.Background(), path)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+			continue
+		}
+		if err == nil && *info != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, *info)
+		}
+	}
+}
+
+func TestFFProbe(t *testing.T) {
+	info, err := parseFFProbe([]byte(`{
+		"streams": [
+			{"codec_type": "video", "codec_name": "h264", "width": 1280, "height": 720},
+			{"codec_type": "audio", "codec_name": "aac"},
+			{"codec_type": "subtitle", "codec_name": "mov_text"}
+		],
+		"format": {"duration": "12.500000"}
+	}`))
+	expected := MediaInfo{Duration: 12500 * time.Millisecond, VideoCodec: "h264", AudioCodec: "aac", Width: 1280, Height: 720}
+	if err != nil || *info != expected {
+		t.Errorf("expected %+v, got %+v (%v)", expected, info, err)
+	}
+
+	if _, err = parseFFProbe([]byte(`{"streams": [], "format": {}}`)); !errors.Is(err, ErrUnsupportedMedia) {
+		t.Error("expected ErrUnsupportedMedia, got", err)
+	}
+
+	if _, err = (FFProbe{Path: filepath.Join(t.TempDir(), "no-ffprobe")}).ProbeMedia(context.Background(), "clip.mp4"); err == nil {
+		t.Error("expected an error for a missing ffprobe")
+	}
+}
+
+func TestTools_UploadFilesMedia(t *testing.T) {
+	for _, e := range []struct {
+		name     string
+		data     []byte
+		unprobed bool
+		errorIs  error
+	}{
+		{name: "short.mp4", data: testMP4(30*time.Second, 1280, 720)},
+		{name: "long.mp4", data: testMP4(5*time.Minute, 1280, 720), errorIs: ErrMediaTooLong},
+		{name: "4k.mp4", data: testMP4(30*time.Second, 3840, 2160), errorIs: ErrVideoTooLarge},
+		{name: "long.wav", data: testWAV(2 * time.Minute), errorIs: ErrMediaTooLong},
+		{name: "truncated.mp4", data: testMP4(30*time.Second, 1280, 720)[:100], errorIs: ErrUnsupportedMedia},
+		{name: "allowed.mp4", data: testMP4(30*time.Second, 1280, 720)[:100], unprobed: true},
+	} {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, _ := writer.CreateFormFile("file", e.name)
+		_, _ = part.Write(e.data)
+		_ = writer.Close()
+
+		request := httptest.NewRequest("POST", "/", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+
+		testTools := Tools{MediaProber: NativeMediaProber{}, MaxMediaDuration: time.Minute, MaxVideoPixels: 1920 * 1080, AllowUnprobedMedia: e.unprobed}
+		uploadDir := t.TempDir()
+		files, err := testTools.UploadFiles(request, uploadDir, false)
+		if !errors.Is(err, e.errorIs) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.errorIs, err)
+			continue
+		}
+		if err != nil {
+			if _, statErr := os.Stat(filepath.Join(uploadDir, e.name)); !os.IsNotExist(statErr) {
+				t.Errorf("%s: expected the refused file to be removed", e.name)
+			}
+			continue
+		}
+		if e.unprobed {
+			if files[0].Media != nil {
+				t.Errorf("%s: expected no media info, got %+v", e.name, files[0].Media)
+			}
+			continue
+		}
+		if files[0].Media == nil || files[0].Media.Width != 1280 || files[0].Media.Duration != 30*time.Second {
+			t.Errorf("%s: wrong media info %+v", e.name, files[0].Media)
+		}
+	}
+}
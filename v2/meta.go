@@ -0,0 +1,127 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// MetaFunc returns a value for the meta of the JSON responses sent by WriteJSON and ErrorJSON, such as
+// the request id or the server time, or nil to leave it out. r is the request being answered, found
+// when MetaMiddleware wraps the handler, and nil otherwise; data is what is being sent.
+type MetaFunc func(r *http.Request, data any) any
+
+// MetaRequestID is a MetaFunc returning the request id set by the RequestID middleware, which must run
+// before MetaMiddleware.
+func MetaRequestID(r *http.Request, data any) any {
+	if r == nil {
+		return nil
+	}
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		return id
+	}
+	return nil
+}
+
+// MetaServerTime is a MetaFunc returning the current time, in UTC, formatted as RFC 3339.
+func MetaServerTime(r *http.Request, data any) any {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// MetaAPIVersion returns a MetaFunc returning the API version of the request, as VersionFromRequest
+// finds it with opts.
+func MetaAPIVersion(opts ...VersionOptions) MetaFunc {
+	return func(r *http.Request, data any) any {
+		if r == nil {
+			return nil
+		}
+		if version := VersionFromRequest(r, opts...); version != "" {
+			return version
+		}
+		return nil
+	}
+}
+
+// MetaPagination is a MetaFunc returning the pagination information of a PaginatedResponse, for clients
+// which read it from the meta of every response.
+func MetaPagination(r *http.Request, data any) any {
+	switch response := data.(type) {
+	case PaginatedResponse:
+		return response.Pagination
+	case *PaginatedResponse:
+		if response != nil {
+			return response.Pagination
+		}
+	}
+	return nil
+}
+
+// MetaMiddleware is middleware which makes the request available to the functions of Tools.ResponseMeta,
+// when WriteJSON and ErrorJSON answer it.
+func (t *Tools) MetaMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := NewResponseWriter(w)
+		rw.request = r
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// addMeta adds the values of the functions of Tools.ResponseMeta to out, the JSON encoding of data sent
+// to w, under a meta key. Objects get the key added, unless they have one already; anything else is sent
+// under a data key next to it.
+func (t *Tools) addMeta(w http.ResponseWriter, data any, out []byte) ([]byte, error) {
+	r := requestOf(w)
+	meta := make(map[string]any, len(t.ResponseMeta))
+	for key, fn := range t.ResponseMeta {
+		if value := fn(r, data); value != nil {
+			meta[key] = value
+		}
+	}
+	if len(meta) == 0 {
+		return out, nil
+	}
+
+	encoded, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	var object map[string]json.RawMessage
+	if !bytes.HasPrefix(out, []byte("{")) || json.Unmarshal(out, &object) != nil {
+		return json.Marshal(struct {
+			Data json.RawMessage `json:"data"`
+			Meta json.RawMessage `json:"meta"`
+		}{out, encoded})
+	}
+	if _, ok := object["meta"]; ok {
+		return out, nil
+	}
+
+	// the key is added at the end, keeping the order of the fields of structs
+	withMeta := make([]byte, 0, len(out)+len(encoded)+9)
+	withMeta = append(withMeta, out[:len(out)-1]...)
+	if len(object) > 0 {
+		withMeta = append(withMeta, ',')
+	}
+	withMeta = append(withMeta, `"meta":`...)
+	withMeta = append(withMeta, encoded...)
+	return append(withMeta, '}'), nil
+}
+
+// requestOf returns the request stored by MetaMiddleware in w, or in the writers it wraps, or nil.
+func requestOf(w http.ResponseWriter) *http.Request {
+	for {
+		switch writer := w.(type) {
+		case *ResponseWriter:
+			if writer.request != nil {
+				return writer.request
+			}
+			w = writer.ResponseWriter
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTools_ResponseMeta(t *testing.T) {
+	testTools := Tools{ResponseMeta: map[string]MetaFunc{
+		"request_id": MetaRequestID,
+		"version":    MetaAPIVersion(),
+		"pagination": MetaPagination,
+		"static":     func(r *http.Request, data any) any { return 1 },
+	}}
+
+	tests := []struct {
+		name     string
+		data     any
+		expected string
+	}{
+		{name: "struct", data: struct {
+			B int `json:"b"`
+			A int `json:"a"`
+		}{1, 2}, expected: `{"b":1,"a":2,"meta":{"request_id":"abc","static":1,"version":"2"}}`},
+		{name: "empty object", data: map[string]int{}, expected: `{"meta":{"request_id":"abc","static":1,"version":"2"}}`},
+		{name: "own meta", data: map[string]int{"meta": 1}, expected: `{"meta":1}`},
+		{name: "array", data: []int{1, 2}, expected: `{"data":[1,2],"meta":{"request_id":"abc","static":1,"version":"2"}}`},
+		{name: "paginated", data: PaginatedResponse{Data: []int{}, Pagination: Pagination{PerPage: 10}},
+			expected: `{"data":[],"pagination":{"per_page":10},"meta":{"pagination":{"per_page":10},"request_id":"abc","static":1,"version":"2"}}`},
+	}
+	for _, test := range tests {
+		handler := testTools.RequestID(testTools.MetaMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = testTools.WriteJSON(w, http.StatusOK, test.data)
+		})))
+
+		request := httptest.NewRequest("GET", "/v2/users", nil)
+		request.Header.Set("X-Request-ID", "abc")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, request)
+		if rr.Body.String() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, rr.Body.String())
+		}
+	}
+
+	// errors get the meta too, and functions needing the request leave it out without the middleware
+	rr := httptest.NewRecorder()
+	_ = testTools.ErrorJSON(rr, errors.New("boom"))
+	if expected := `{"error":true,"message":"boom","meta":{"static":1}}`; rr.Body.String() != expected {
+		t.Errorf("expected %s, got %s", expected, rr.Body.String())
+	}
+}
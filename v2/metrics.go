@@ -0,0 +1,238 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the request duration histogram.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics collects request, upload and remote call metrics, and exposes them in the Prometheus text format.
+// The zero value is ready to use.
+type Metrics struct {
+	mu sync.Mutex
+
+	requests        map[[2]string]uint64 // keyed by method and status class
+	inFlight        int64
+	durationBuckets []uint64
+	durationSum     float64
+	durationCount   uint64
+
+	uploadedFiles uint64
+	uploadedBytes uint64
+	uploadErrors  uint64
+
+	remoteCalls  map[string]uint64 // keyed by status class
+	remoteErrors uint64
+}
+
+// NewMetrics returns an empty Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:        make(map[[2]string]uint64),
+		durationBuckets: make([]uint64, len(durationBuckets)),
+		remoteCalls:     make(map[string]uint64),
+	}
+}
+
+// init allocates the counters of a zero Metrics. It must be called with m.mu held.
+func (m *Metrics) init() {
+	if m.requests == nil {
+		m.requests = make(map[[2]string]uint64)
+	}
+	if m.durationBuckets == nil {
+		m.durationBuckets = make([]uint64, len(durationBuckets))
+	}
+	if m.remoteCalls == nil {
+		m.remoteCalls = make(map[string]uint64)
+	}
+}
+
+// MetricsMiddleware is middleware which records the number, duration and status class of requests in Tools.Metrics,
+// which is created if it isn't set yet.
+func (t *Tools) MetricsMiddleware(next http.Handler) http.Handler {
+	m := t.ensureMetrics()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.inFlight++
+		m.mu.Unlock()
+
+		start := time.Now()
+		rw := NewResponseWriter(w)
+		defer func() {
+			m.recordRequest(r.Method, rw.Status(), time.Since(start))
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// MetricsHandler returns a handler, for /metrics, which exposes Tools.Metrics in the Prometheus text format.
+func (t *Tools) MetricsHandler() http.Handler {
+	m := t.ensureMetrics()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write([]byte(m.String()))
+	})
+}
+
+// ensureMetrics returns Tools.Metrics, creating it if it isn't set yet, under a lock, as middleware may
+// be built while other requests are served.
+func (t *Tools) ensureMetrics() *Metrics {
+	t.metricsMu.Lock()
+	defer t.metricsMu.Unlock()
+	if t.Metrics == nil {
+		t.Metrics = NewMetrics()
+	}
+	return t.Metrics
+}
+
+// metrics returns Tools.Metrics, or nil if it isn't set, read under the lock of ensureMetrics.
+func (t *Tools) metrics() *Metrics {
+	t.metricsMu.Lock()
+	defer t.metricsMu.Unlock()
+	return t.Metrics
+}
+
+// String returns the metrics in the Prometheus text exposition format.
+func (m *Metrics) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	var b strings.Builder
+
+	b.WriteString("# HELP http_requests_total Total number of HTTP requests handled.\n")
+	b.WriteString("# TYPE http_requests_total counter\n")
+	keys := make([][2]string, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1]
+	})
+	for _, key := range keys {
+		fmt.Fprintf(&b, "http_requests_total{method=%q,code=%q} %d\n", key[0], key[1], m.requests[key])
+	}
+
+	b.WriteString("# HELP http_requests_in_flight Number of HTTP requests currently being handled.\n")
+	b.WriteString("# TYPE http_requests_in_flight gauge\n")
+	fmt.Fprintf(&b, "http_requests_in_flight %d\n", m.inFlight)
+
+	b.WriteString("# HELP http_request_duration_seconds Duration of HTTP requests.\n")
+	b.WriteString("# TYPE http_request_duration_seconds histogram\n")
+	var cumulative uint64
+	for i, bound := range durationBuckets {
+		cumulative += m.durationBuckets[i]
+		fmt.Fprintf(&b, "http_request_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(&b, "http_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.durationCount)
+	fmt.Fprintf(&b, "http_request_duration_seconds_sum %s\n", strconv.FormatFloat(m.durationSum, 'g', -1, 64))
+	fmt.Fprintf(&b, "http_request_duration_seconds_count %d\n", m.durationCount)
+
+	b.WriteString("# HELP toolkit_uploaded_files_total Total number of files uploaded with UploadFiles.\n")
+	b.WriteString("# TYPE toolkit_uploaded_files_total counter\n")
+	fmt.Fprintf(&b, "toolkit_uploaded_files_total %d\n", m.uploadedFiles)
+	b.WriteString("# HELP toolkit_uploaded_bytes_total Total number of bytes uploaded with UploadFiles.\n")
+	b.WriteString("# TYPE toolkit_uploaded_bytes_total counter\n")
+	fmt.Fprintf(&b, "toolkit_uploaded_bytes_total %d\n", m.uploadedBytes)
+	b.WriteString("# HELP toolkit_upload_errors_total Total number of failed calls to UploadFiles.\n")
+	b.WriteString("# TYPE toolkit_upload_errors_total counter\n")
+	fmt.Fprintf(&b, "toolkit_upload_errors_total %d\n", m.uploadErrors)
+
+	b.WriteString("# HELP toolkit_remote_requests_total Total number of remote calls which received a response.\n")
+	b.WriteString("# TYPE toolkit_remote_requests_total counter\n")
+	classes := make([]string, 0, len(m.remoteCalls))
+	for class := range m.remoteCalls {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		fmt.Fprintf(&b, "toolkit_remote_requests_total{code=%q} %d\n", class, m.remoteCalls[class])
+	}
+	b.WriteString("# HELP toolkit_remote_request_errors_total Total number of remote calls which failed without a response.\n")
+	b.WriteString("# TYPE toolkit_remote_request_errors_total counter\n")
+	fmt.Fprintf(&b, "toolkit_remote_request_errors_total %d\n", m.remoteErrors)
+
+	return b.String()
+}
+
+// recordRequest records a handled request.
+func (m *Metrics) recordRequest(method string, status int, duration time.Duration) {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		// keep the number of series bounded, whatever clients send
+		method = "OTHER"
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	m.inFlight--
+	m.requests[[2]string{method, statusClass(status)}]++
+
+	seconds := duration.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			m.durationBuckets[i]++
+			break
+		}
+	}
+	m.durationSum += seconds
+	m.durationCount++
+}
+
+// recordUpload records the outcome of a call to UploadFiles. It does nothing on a nil Metrics.
+func (m *Metrics) recordUpload(files []*UploadedFile, err error) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, f := range files {
+		if f != nil {
+			m.uploadedFiles++
+			m.uploadedBytes += uint64(f.FileSize)
+		}
+	}
+	if err != nil {
+		m.uploadErrors++
+	}
+}
+
+// recordRemoteCall records the outcome of a call to a remote service. It does nothing on a nil Metrics.
+func (m *Metrics) recordRemoteCall(res *http.Response, err error) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	if err != nil || res == nil {
+		m.remoteErrors++
+		return
+	}
+	m.remoteCalls[statusClass(res.StatusCode)]++
+}
+
+// statusClass returns the class of an HTTP status code, such as 2xx.
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,137 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTools_MetricsMiddleware(t *testing.T) {
+	var testTools Tools
+
+	handler := testTools.MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	for _, path := range []string{"/", "/", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/", nil))
+
+	rr := httptest.NewRecorder()
+	testTools.MetricsHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	out := rr.Body.String()
+
+	expected := []string{
+		`http_requests_total{method="GET",code="2xx"} 2`,
+		`http_requests_total{method="GET",code="4xx"} 1`,
+		`http_requests_total{method="OTHER",code="2xx"} 1`,
+		`http_request_duration_seconds_bucket{le="+Inf"} 4`,
+		`http_request_duration_seconds_count 4`,
+		`http_requests_in_flight 0`,
+		"# TYPE http_request_duration_seconds histogram",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected metrics to contain %q, got:\n%s", line, out)
+		}
+	}
+}
+
+func TestTools_MetricsConcurrent(t *testing.T) {
+	var testTools Tools
+	var wg sync.WaitGroup
+	handlers := make([]http.Handler, 8)
+	for i := range handlers {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			handlers[i] = testTools.MetricsMiddleware(http.NotFoundHandler())
+		}(i)
+		go func() {
+			defer wg.Done()
+			testTools.metrics().recordUpload(nil, errors.New("failed"))
+		}()
+	}
+	wg.Wait()
+
+	// whichever built it first, every middleware records into the same Metrics
+	for _, handler := range handlers {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if out := testTools.metrics().String(); !strings.Contains(out, `http_requests_total{method="GET",code="4xx"} 8`+"\n") {
+		t.Errorf("expected 8 requests, got:\n%s", out)
+	}
+}
+
+func TestTools_MetricsRemoteCalls(t *testing.T) {
+	testTools := Tools{Metrics: NewMetrics()}
+
+	ok := NewTestClient(func(req *http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("ok")), Header: make(http.Header)}
+	})
+	failing := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})}
+
+	_, _, _ = testTools.PushJSONToRemote("http://example.com", "data", ok)
+	_, _, _ = testTools.PushJSONToRemote("http://example.com", "data", failing)
+
+	out := testTools.Metrics.String()
+	for _, line := range []string{`toolkit_remote_requests_total{code="2xx"} 1`, "toolkit_remote_request_errors_total 1"} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected metrics to contain %q, got:\n%s", line, out)
+		}
+	}
+}
+
+func TestMetrics_ZeroValue(t *testing.T) {
+	testTools := Tools{Metrics: &Metrics{}}
+	handler := testTools.MetricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	ok := NewTestClient(func(req *http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("ok")), Header: make(http.Header)}
+	})
+	_, _, _ = testTools.PushJSONToRemote("http://example.com", "data", ok)
+
+	out := testTools.Metrics.String()
+	for _, line := range []string{`http_requests_total{method="GET",code="2xx"} 1`, `toolkit_remote_requests_total{code="2xx"} 1`} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected metrics to contain %q, got:\n%s", line, out)
+		}
+	}
+}
+
+func TestMetrics_RecordUpload(t *testing.T) {
+	m := NewMetrics()
+	m.recordUpload([]*UploadedFile{{FileSize: 100}, {FileSize: 50}}, nil)
+	m.recordUpload(nil, errors.New("too big"))
+
+	out := m.String()
+	for _, line := range []string{"toolkit_uploaded_files_total 2", "toolkit_uploaded_bytes_total 150", "toolkit_upload_errors_total 1"} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected metrics to contain %q, got:\n%s", line, out)
+		}
+	}
+
+	// recording on nil metrics is a no-op
+	var none *Metrics
+	none.recordUpload(nil, nil)
+	none.recordRemoteCall(nil, nil)
+}
+
+// roundTripperFunc is an http.RoundTripper which can also fail.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
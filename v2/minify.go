@@ -0,0 +1,437 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MinifyOptions is the type used to configure the Minify middleware.
+type MinifyOptions struct {
+	// HTML, CSS and JS turn on the minification of responses of each type. All of them are minified when
+	// none is set.
+	HTML, CSS, JS bool
+}
+
+// Minify returns middleware which minifies HTML, CSS and JavaScript responses, as found by their
+// Content-Type, with MinifyHTML, MinifyCSS and MinifyJS. Only 200 responses to requests other than HEAD
+// are minified: they are buffered until the handler returns, and lose their ETag and Accept-Ranges
+// headers, which describe the original body. Others, such as partial responses, and responses which are
+// already encoded, such as gzipped ones, are passed on as they are written.
+func (t *Tools) Minify(opts ...MinifyOptions) func(http.Handler) http.Handler {
+	var options MinifyOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if !options.HTML && !options.CSS && !options.JS {
+		options = MinifyOptions{HTML: true, CSS: true, JS: true}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mw := &minifyWriter{ResponseWriter: w, options: options, head: r.Method == http.MethodHead}
+			next.ServeHTTP(mw, r)
+			mw.finish()
+		})
+	}
+}
+
+// minifyWriter decides, when the status code of a response is written, whether it is minified: the
+// body of those which are is buffered, and the others are written through.
+type minifyWriter struct {
+	http.ResponseWriter
+	options MinifyOptions
+	head    bool
+	minify  func(string) string
+	status  int
+	decided bool
+	body    bytes.Buffer
+}
+
+func (mw *minifyWriter) WriteHeader(status int) {
+	if mw.decided {
+		return
+	}
+	mw.decided = true
+	mw.status = status
+
+	header := mw.Header()
+	if header.Get("Content-Encoding") == "" && status == http.StatusOK && !mw.head {
+		mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+		switch {
+		case mw.options.HTML && mediaType == "text/html":
+			mw.minify = MinifyHTML
+		case mw.options.CSS && mediaType == "text/css":
+			mw.minify = MinifyCSS
+		case mw.options.JS && (mediaType == "text/javascript" || mediaType == "application/javascript"):
+			mw.minify = MinifyJS
+		}
+	}
+	if mw.minify == nil {
+		mw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (mw *minifyWriter) Write(b []byte) (int, error) {
+	if !mw.decided {
+		// as net/http does, responses without a Content-Type get one from their first bytes
+		if mw.Header().Get("Content-Type") == "" {
+			mw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		mw.WriteHeader(http.StatusOK)
+	}
+	if mw.minify != nil {
+		return mw.body.Write(b)
+	}
+	return mw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, for responses which are not minified.
+func (mw *minifyWriter) Flush() {
+	if mw.minify != nil {
+		return
+	}
+	if flusher, ok := mw.ResponseWriter.(http.Flusher); ok {
+		if !mw.decided {
+			mw.WriteHeader(http.StatusOK)
+		}
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, if the wrapped writer does.
+func (mw *minifyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := mw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer doesn't support hijacking")
+	}
+	mw.decided = true
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (mw *minifyWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+// finish writes the minified response, if it was buffered.
+func (mw *minifyWriter) finish() {
+	if mw.minify == nil {
+		return
+	}
+	minified := mw.minify(mw.body.String())
+	header := mw.Header()
+	header.Del("ETag")
+	header.Del("Accept-Ranges")
+	header.Set("Content-Length", strconv.Itoa(len(minified)))
+	mw.ResponseWriter.WriteHeader(mw.status)
+	_, _ = mw.ResponseWriter.Write([]byte(minified))
+}
+
+// MinifyHTML returns the HTML document s with its comments removed, other than conditional comments,
+// and its runs of whitespace collapsed into single spaces, except in pre and textarea elements. The
+// contents of style and script elements are minified with MinifyCSS and MinifyJS.
+func MinifyHTML(s string) string {
+	var out strings.Builder
+	out.Grow(len(s))
+	space := false
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case strings.HasPrefix(s[i:], "<!--"):
+			end := strings.Index(s[i+4:], "-->")
+			if end < 0 {
+				out.WriteString(s[i:])
+				return out.String()
+			}
+			if strings.HasPrefix(s[i:], "<!--[if") || strings.HasPrefix(s[i:], "<!--<![endif]") {
+				out.WriteString(s[i : i+4+end+3])
+			}
+			i += 4 + end + 3
+		case c == '<' && i+1 < len(s) && (s[i+1] == '/' || s[i+1] == '!' || s[i+1] >= 'a' && s[i+1] <= 'z' || s[i+1] >= 'A' && s[i+1] <= 'Z'):
+			tag := htmlTagEnd(s, i)
+			out.WriteString(collapseTagWhitespace(s[i:tag]))
+			name := htmlTagName(s[i:tag])
+			i = tag
+			if name != "pre" && name != "textarea" && name != "script" && name != "style" {
+				break
+			}
+
+			closing := strings.Index(strings.ToLower(s[i:]), "</"+name)
+			if closing < 0 {
+				closing = len(s) - i
+			}
+			content := s[i : i+closing]
+			switch name {
+			case "style":
+				content = MinifyCSS(content)
+			case "script":
+				if scriptIsJS(s[:i]) {
+					content = MinifyJS(content)
+				}
+			}
+			out.WriteString(content)
+			i += closing
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			if !space {
+				out.WriteByte(' ')
+				space = true
+			}
+			i++
+			continue
+		default:
+			out.WriteByte(c)
+			i++
+		}
+		space = false
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// htmlTagEnd returns the index after the end of the tag starting at i in s, skipping over quoted
+// attribute values.
+func htmlTagEnd(s string, i int) int {
+	var quote byte
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case quote != 0:
+			if s[j] == quote {
+				quote = 0
+			}
+		case s[j] == '"' || s[j] == '\'':
+			quote = s[j]
+		case s[j] == '>':
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// htmlTagName returns the lowercased name of the opening tag tag, or "" for other tags.
+func htmlTagName(tag string) string {
+	name := strings.TrimPrefix(tag, "<")
+	if end := strings.IndexAny(name, " \t\n\r\f/>"); end >= 0 {
+		name = name[:end]
+	}
+	return strings.ToLower(name)
+}
+
+// collapseTagWhitespace collapses the runs of whitespace of the tag tag, outside its quoted attribute
+// values, into single spaces.
+func collapseTagWhitespace(tag string) string {
+	var out strings.Builder
+	var quote byte
+	space := false
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		if quote == 0 && (c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f') {
+			if !space {
+				out.WriteByte(' ')
+				space = true
+			}
+			continue
+		}
+		space = false
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		}
+		out.WriteByte(c)
+	}
+	collapsed := out.String()
+	if strings.HasSuffix(collapsed, " >") {
+		collapsed = collapsed[:len(collapsed)-2] + ">"
+	}
+	return collapsed
+}
+
+// scriptIsJS reports whether the script element whose opening tag ends before is JavaScript, rather
+// than data such as JSON or a template.
+func scriptIsJS(before string) bool {
+	tag := strings.ToLower(before[strings.LastIndex(before, "<"):])
+	i := strings.Index(tag, "type=")
+	if i < 0 {
+		return true
+	}
+	value := strings.Trim(strings.Fields(tag[i+5:] + " ")[0], `"'>`)
+	return value == "" || value == "module" || strings.Contains(value, "javascript") || strings.Contains(value, "ecmascript")
+}
+
+// MinifyCSS returns the stylesheet s without its comments, with its runs of whitespace collapsed, and
+// the whitespace around braces, semicolons, commas and after colons removed, as well as the last
+// semicolon of each block. Strings are left as they are.
+func MinifyCSS(s string) string {
+	out := make([]byte, 0, len(s))
+	space := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\'':
+			end := quotedEnd(s, i)
+			out = append(out, s[i:end]...)
+			i = end - 1
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				i = len(s)
+			} else {
+				i += 2 + end + 1
+			}
+			space = true
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			space = true
+			continue
+		default:
+			if space && len(out) > 0 && strings.IndexByte("{};,:>", out[len(out)-1]) < 0 && strings.IndexByte("{};,>", c) < 0 {
+				out = append(out, ' ')
+			}
+			if c == '}' && len(out) > 0 && out[len(out)-1] == ';' {
+				out = out[:len(out)-1]
+			}
+			out = append(out, c)
+		}
+		space = false
+	}
+	return string(out)
+}
+
+// MinifyJS returns the script s without its comments, with its lines trimmed, its runs of spaces
+// collapsed, and its blank lines removed. Line breaks are kept, so that automatic semicolon insertion
+// works as before, as are strings, template literals and regular expressions.
+func MinifyJS(s string) string {
+	out := make([]byte, 0, len(s))
+	space := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			if space {
+				out = append(out, ' ')
+			}
+			end := quotedEnd(s, i)
+			out = append(out, s[i:end]...)
+			i = end - 1
+		case c == '/' && i+1 < len(s) && s[i+1] == '/':
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				i = len(s)
+			} else {
+				i += end - 1
+			}
+			continue
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				i = len(s)
+			} else {
+				i += 2 + end + 1
+			}
+			space = len(out) > 0 && out[len(out)-1] != '\n'
+			continue
+		case c == '/' && jsRegexAllowed(out):
+			if space {
+				out = append(out, ' ')
+			}
+			end := regexEnd(s, i)
+			out = append(out, s[i:end]...)
+			i = end - 1
+		case c == '\n' || c == '\r':
+			// spaces are only written before what follows them, so lines never end with any
+			if len(out) > 0 && out[len(out)-1] != '\n' {
+				out = append(out, '\n')
+			}
+			space = false
+			continue
+		case c == ' ' || c == '\t':
+			if len(out) > 0 && out[len(out)-1] != '\n' {
+				space = true
+			}
+			continue
+		default:
+			if space {
+				out = append(out, ' ')
+			}
+			out = append(out, c)
+		}
+		space = false
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// jsRegexAllowed reports whether a slash after the script written so far, out, starts a regular
+// expression rather than a division: after an operator, a punctuator or a keyword such as return.
+func jsRegexAllowed(out []byte) bool {
+	end := len(out)
+	for end > 0 && (out[end-1] == ' ' || out[end-1] == '\n') {
+		end--
+	}
+	if end == 0 {
+		return true
+	}
+	start := end
+	for start > 0 && isJSIdentByte(out[start-1]) {
+		start--
+	}
+	switch string(out[start:end]) {
+	case "return", "typeof", "case", "do", "else", "in", "of", "new", "delete", "void", "throw", "instanceof", "yield", "await":
+		return true
+	}
+	return strings.IndexByte("(,=:[!&|?{};+-*%<>~^", out[end-1]) >= 0
+}
+
+// isJSIdentByte reports whether c may be part of a JavaScript identifier.
+func isJSIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$'
+}
+
+// quotedEnd returns the index after the end of the string starting with the quote at i in s.
+func quotedEnd(s string, i int) int {
+	quote := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case quote:
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// regexEnd returns the index after the end of the regular expression literal, with its flags,
+// starting at i in s.
+func regexEnd(s string, i int) int {
+	inClass := false
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '\n':
+			return j
+		case '/':
+			if !inClass {
+				j++
+				for j < len(s) && isJSIdentByte(s[j]) {
+					j++
+				}
+				return j
+			}
+		}
+	}
+	return len(s)
+}
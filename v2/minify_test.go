@@ -0,0 +1,139 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMinifyHTML(t *testing.T) {
+	tests := []struct {
+		name, in, expected string
+	}{
+		{name: "whitespace", in: "<div>\n    <p>Hello,\n\t  world</p>\n</div>\n", expected: "<div> <p>Hello, world</p> </div>"},
+		{name: "comments", in: "<p>a<!-- note -->b</p><!--[if IE]><p>IE</p><![endif]-->", expected: "<p>ab</p><!--[if IE]><p>IE</p><![endif]-->"},
+		{name: "attributes", in: "<a   href=\"/a  b\"\n  title='x  y' >link</a>", expected: "<a href=\"/a  b\" title='x  y'>link</a>"},
+		{name: "pre", in: "<pre>\n  keep\n    this\n</pre>  <textarea> as  is </textarea>", expected: "<pre>\n  keep\n    this\n</pre> <textarea> as  is </textarea>"},
+		{name: "style", in: "<style>\n  body {\n    color: red;\n  }\n</style>", expected: "<style>body{color:red}</style>"},
+		{name: "script", in: "<script>\n  // greet\n  alert(  'a  b'  );\n</script>", expected: "<script>alert( 'a  b' );</script>"},
+		{name: "json script", in: "<script type=\"application/json\">{\n  \"a\": 1\n}</script>", expected: "<script type=\"application/json\">{\n  \"a\": 1\n}</script>"},
+		{name: "less than", in: "<p>1 < 2 and  3 > 2</p>", expected: "<p>1 < 2 and 3 > 2</p>"},
+	}
+	for _, test := range tests {
+		if minified := MinifyHTML(test.in); minified != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, minified)
+		}
+	}
+}
+
+func TestMinifyCSS(t *testing.T) {
+	tests := []struct {
+		in, expected string
+	}{
+		{in: "/* reset */\nbody ,  html {\n  margin : 0 ;\n  padding: 0;\n}\n", expected: "body,html{margin :0;padding:0}"},
+		{in: "a > b:hover { width: calc(100% - 2px); }", expected: "a>b:hover{width:calc(100% - 2px)}"},
+		{in: "p::before { content: \"a  /* b */  ;\" }", expected: "p::before{content:\"a  /* b */  ;\"}"},
+		{in: "@media (max-width: 600px) {\n  .a .b { color: red }\n}", expected: "@media (max-width:600px){.a .b{color:red}}"},
+	}
+	for _, test := range tests {
+		if minified := MinifyCSS(test.in); minified != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.in, test.expected, minified)
+		}
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	tests := []struct {
+		in, expected string
+	}{
+		{in: "// comment\nvar a = 1;   /* block\n comment */\n\n\n  var b = a / 2 // half\n", expected: "var a = 1;\nvar b = a / 2"},
+		{in: "const s = \"a // not a comment\", t = `x  ${y}  /* z */`", expected: "const s = \"a // not a comment\", t = `x  ${y}  /* z */`"},
+		{in: "if (/\\/\\/ [a/b]/.test(x)) return /'/g", expected: "if (/\\/\\/ [a/b]/.test(x)) return /'/g"},
+		{in: "let a = b\n  (c)", expected: "let a = b\n(c)"},
+	}
+	for _, test := range tests {
+		if minified := MinifyJS(test.in); minified != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.in, test.expected, minified)
+		}
+	}
+}
+
+func TestTools_Minify(t *testing.T) {
+	var testTools Tools
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", "18")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "<p>\n  a  \n")
+		fmt.Fprint(w, "  b</p>\n")
+	})
+	mux.HandleFunc("/sniffed", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>\n\n<body>x</body></html>")
+	})
+	mux.HandleFunc("/created", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, "<p>  x  </p>")
+	})
+	mux.HandleFunc("/partial", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Range", "bytes 0-5/20")
+		w.WriteHeader(http.StatusPartialContent)
+		fmt.Fprint(w, "<p>  x")
+	})
+	mux.HandleFunc("/app.css", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		fmt.Fprint(w, "a { color: red; }")
+	})
+	mux.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSON(w, http.StatusOK, map[string]string{"a": "b  c"})
+	})
+	mux.HandleFunc("/gzipped", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		fmt.Fprint(w, "<p>  x  </p>")
+	})
+	handler := testTools.Minify(MinifyOptions{HTML: true})(mux)
+
+	tests := []struct {
+		path     string
+		status   int
+		expected string
+	}{
+		{path: "/page", status: http.StatusOK, expected: "<p> a b</p>"},
+		{path: "/created", status: http.StatusCreated, expected: "<p>  x  </p>"},
+		{path: "/partial", status: http.StatusPartialContent, expected: "<p>  x"},
+		{path: "/sniffed", status: http.StatusOK, expected: "<html> <body>x</body></html>"},
+		{path: "/app.css", status: http.StatusOK, expected: "a { color: red; }"},
+		{path: "/data", status: http.StatusOK, expected: `{"a":"b  c"}`},
+		{path: "/gzipped", status: http.StatusOK, expected: "<p>  x  </p>"},
+	}
+	for _, test := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", test.path, nil))
+		if rr.Code != test.status || rr.Body.String() != test.expected {
+			t.Errorf("%s: expected %d %q, got %d %q", test.path, test.status, test.expected, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/page", nil))
+	if rr.Header().Get("ETag") != "" || rr.Header().Get("Accept-Ranges") != "" || rr.Header().Get("Content-Length") != "11" {
+		t.Errorf("expected the headers of the original body to be dropped, got %v", rr.Header())
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("HEAD", "/page", nil))
+	if rr.Header().Get("ETag") != `"v1"` || rr.Header().Get("Content-Length") != "18" {
+		t.Errorf("expected HEAD responses to be left alone, got %v", rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	testTools.Minify()(mux).ServeHTTP(rr, httptest.NewRequest("GET", "/app.css", nil))
+	if rr.Body.String() != "a{color:red}" || rr.Header().Get("Content-Length") != "12" {
+		t.Errorf("wrong stylesheet %q, length %s", rr.Body.String(), rr.Header().Get("Content-Length"))
+	}
+}
@@ -0,0 +1,366 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// ErrInvalidMMDB is returned by OpenMMDB and NewMMDB for files which are not valid MaxMind DB files.
+var ErrInvalidMMDB = errors.New("invalid MaxMind DB file")
+
+// mmdbMetadataMarker precedes the metadata at the end of a MaxMind DB file.
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// MMDB is a GeoIP reading a MaxMind DB file, such as GeoLite2-City.mmdb or GeoLite2-Country.mmdb, or
+// the free databases of DB-IP, held in memory.
+type MMDB struct {
+	data       []byte
+	tree       []byte
+	dataStart  int
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+	dbType     string
+}
+
+// OpenMMDB reads the MaxMind DB file at path.
+func OpenMMDB(path string) (*MMDB, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewMMDB(data)
+}
+
+// NewMMDB returns an MMDB reading the MaxMind DB file held in data, such as one embedded in the binary.
+func NewMMDB(data []byte) (*MMDB, error) {
+	i := bytes.LastIndex(data, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: no metadata", ErrInvalidMMDB)
+	}
+	metadataStart := i + len(mmdbMetadataMarker)
+	decoder := mmdbDecoder{data: data[metadataStart:]}
+	value, _, err := decoder.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	metadata, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidMMDB)
+	}
+
+	db := &MMDB{data: data}
+	db.nodeCount = mmdbUint(metadata["node_count"])
+	db.recordSize = mmdbUint(metadata["record_size"])
+	db.ipVersion = mmdbUint(metadata["ip_version"])
+	db.dbType, _ = metadata["database_type"].(string)
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("%w: record size %d", ErrInvalidMMDB, db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: IP version %d", ErrInvalidMMDB, db.ipVersion)
+	}
+
+	treeSize := int(db.nodeCount * db.recordSize / 4)
+	// the search tree is followed by 16 zero bytes, then the data section
+	if treeSize+16 > i {
+		return nil, fmt.Errorf("%w: search tree past the end of the file", ErrInvalidMMDB)
+	}
+	db.tree = data[:treeSize]
+	db.dataStart = treeSize + 16
+
+	// IPv4 addresses are found under ::/96 in IPv6 databases
+	if db.ipVersion == 6 {
+		for bit := 0; bit < 96 && db.ipv4Start < db.nodeCount; bit++ {
+			db.ipv4Start = db.record(db.ipv4Start, 0)
+		}
+	}
+	return db, nil
+}
+
+// DatabaseType returns the type of the database, such as GeoLite2-City.
+func (db *MMDB) DatabaseType() string {
+	return db.dbType
+}
+
+// Lookup returns the location of ip, read from the country, subdivisions, city, location and
+// postal fields of its record, or an error wrapping ErrNotFound if the database has no record for it.
+func (db *MMDB) Lookup(ctx context.Context, ip string) (*GeoLocation, error) {
+	record, err := db.Record(ip)
+	if err != nil {
+		return nil, err
+	}
+	return geoLocationFromRecord(record), nil
+}
+
+// Record returns the whole record of ip, as nested maps and slices, for fields Lookup doesn't read,
+// such as those of ASN or connection type databases. It returns an error wrapping ErrNotFound if the
+// database has no record for ip.
+func (db *MMDB) Record(ip string) (map[string]any, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, fmt.Errorf("invalid IP address %q", ip)
+	}
+
+	node := uint(0)
+	bits := parsed.To16()
+	if v4 := parsed.To4(); v4 != nil {
+		bits = v4
+		node = db.ipv4Start
+	} else if db.ipVersion == 4 {
+		return nil, fmt.Errorf("IP address %s: %w", ip, ErrNotFound)
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-i%8)) & 1
+		node = db.record(node, bit)
+	}
+	if node <= db.nodeCount {
+		return nil, fmt.Errorf("IP address %s: %w", ip, ErrNotFound)
+	}
+
+	offset := int(node-db.nodeCount) - 16
+	decoder := mmdbDecoder{data: db.data[db.dataStart:]}
+	value, _, err := decoder.decode(offset, 0)
+	if err != nil {
+		return nil, err
+	}
+	record, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: record is not a map", ErrInvalidMMDB)
+	}
+	return record, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (db *MMDB) record(node, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(db.tree[node*8+bit*4:]))
+	}
+}
+
+// geoLocationFromRecord reads a location from a record of a MaxMind or DB-IP city or country database.
+func geoLocationFromRecord(record map[string]any) *GeoLocation {
+	location := &GeoLocation{}
+	if country, ok := record["country"].(map[string]any); ok {
+		location.Country, _ = country["iso_code"].(string)
+		location.CountryName = mmdbName(country)
+	}
+	if subdivisions, ok := record["subdivisions"].([]any); ok && len(subdivisions) > 0 {
+		if region, ok := subdivisions[0].(map[string]any); ok {
+			location.Region, _ = region["iso_code"].(string)
+			location.RegionName = mmdbName(region)
+		}
+	}
+	if city, ok := record["city"].(map[string]any); ok {
+		location.City = mmdbName(city)
+	}
+	if postal, ok := record["postal"].(map[string]any); ok {
+		location.PostalCode, _ = postal["code"].(string)
+	}
+	if loc, ok := record["location"].(map[string]any); ok {
+		location.Latitude, _ = loc["latitude"].(float64)
+		location.Longitude, _ = loc["longitude"].(float64)
+		location.TimeZone, _ = loc["time_zone"].(string)
+	}
+	return location
+}
+
+// mmdbName returns the English name of a country, subdivision or city record.
+func mmdbName(record map[string]any) string {
+	names, _ := record["names"].(map[string]any)
+	name, _ := names["en"].(string)
+	return name
+}
+
+// mmdbUint returns value, an unsigned integer of any size, as a uint.
+func mmdbUint(value any) uint {
+	switch v := value.(type) {
+	case uint16:
+		return uint(v)
+	case uint32:
+		return uint(v)
+	case uint64:
+		return uint(v)
+	}
+	return 0
+}
+
+// mmdbDecoder decodes the values of the data section of a MaxMind DB file.
+type mmdbDecoder struct {
+	data []byte
+}
+
+// mmdb data types
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// decode returns the value at offset, and the offset following it. Maps are decoded as
+// map[string]any, arrays as []any, and integers as the smallest type holding them, with uint128
+// as *big.Int.
+func (d *mmdbDecoder) decode(offset, depth int) (any, int, error) {
+	if depth > 32 {
+		return nil, 0, fmt.Errorf("%w: data nested too deeply", ErrInvalidMMDB)
+	}
+	if offset < 0 || offset >= len(d.data) {
+		return nil, 0, fmt.Errorf("%w: offset %d out of range", ErrInvalidMMDB, offset)
+	}
+
+	control := d.data[offset]
+	offset++
+	kind := int(control >> 5)
+
+	if kind == mmdbPointer {
+		size := int(control>>3) & 3
+		if offset+size+1 > len(d.data) {
+			return nil, 0, fmt.Errorf("%w: pointer out of range", ErrInvalidMMDB)
+		}
+		b := d.data[offset : offset+size+1]
+		var pointer int
+		switch size {
+		case 0:
+			pointer = int(control&7)<<8 | int(b[0])
+		case 1:
+			pointer = (int(control&7)<<16 | int(b[0])<<8 | int(b[1])) + 2048
+		case 2:
+			pointer = (int(control&7)<<24 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])) + 526336
+		default:
+			pointer = int(binary.BigEndian.Uint32(b))
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, offset + size + 1, err
+	}
+
+	if kind == mmdbExtended {
+		if offset >= len(d.data) {
+			return nil, 0, fmt.Errorf("%w: truncated data", ErrInvalidMMDB)
+		}
+		kind = 7 + int(d.data[offset])
+		offset++
+	}
+
+	size := int(control & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > len(d.data) {
+			return nil, 0, fmt.Errorf("%w: truncated data", ErrInvalidMMDB)
+		}
+		extra := 0
+		for _, b := range d.data[offset : offset+n] {
+			extra = extra<<8 | int(b)
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + extra
+		case 2:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	switch kind {
+	case mmdbMap:
+		m := make(map[string]any, size)
+		for i := 0; i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", ErrInvalidMMDB)
+			}
+			if m[name], offset, err = d.decode(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]any, size)
+		for i := range a {
+			var err error
+			if a[i], offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > len(d.data) {
+		return nil, 0, fmt.Errorf("%w: truncated data", ErrInvalidMMDB)
+	}
+	b := d.data[offset : offset+size]
+	offset += size
+
+	switch kind {
+	case mmdbString:
+		return string(b), offset, nil
+	case mmdbBytes:
+		return append([]byte(nil), b...), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: double of %d bytes", ErrInvalidMMDB, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: float of %d bytes", ErrInvalidMMDB, size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbInt32:
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		switch kind {
+		case mmdbUint16:
+			return uint16(n), offset, nil
+		case mmdbUint32:
+			return uint32(n), offset, nil
+		case mmdbInt32:
+			return int32(uint32(n)), offset, nil
+		}
+		return n, offset, nil
+	case mmdbUint128:
+		return new(big.Int).SetBytes(b), offset, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unknown data type %d", ErrInvalidMMDB, kind)
+}
@@ -0,0 +1,241 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mmdbPointerTo is a value written as a pointer to the data at its offset.
+type mmdbPointerTo int
+
+// encodeMMDBValue appends value to data in the MaxMind DB data format.
+func encodeMMDBValue(data []byte, value any) []byte {
+	control := func(kind, size int) {
+		head := []byte{0}
+		if kind < 8 {
+			head[0] = byte(kind << 5)
+		} else {
+			head = append(head, byte(kind-7))
+		}
+		switch {
+		case size < 29:
+			head[0] |= byte(size)
+		case size < 285:
+			head[0] |= 29
+			head = append(head, byte(size-29))
+		default:
+			head[0] |= 30
+			head = append(head, byte((size-285)>>8), byte(size-285))
+		}
+		data = append(data, head...)
+	}
+
+	switch v := value.(type) {
+	case mmdbPointerTo:
+		data = append(data, byte(mmdbPointer<<5|int(v)>>8&7), byte(v))
+	case string:
+		control(mmdbString, len(v))
+		data = append(data, v...)
+	case float64:
+		control(mmdbDouble, 8)
+		data = binary.BigEndian.AppendUint64(data, math.Float64bits(v))
+	case uint16:
+		control(mmdbUint16, 2)
+		data = binary.BigEndian.AppendUint16(data, v)
+	case uint32:
+		control(mmdbUint32, 4)
+		data = binary.BigEndian.AppendUint32(data, v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		control(mmdbBool, size)
+	case []any:
+		control(mmdbArray, len(v))
+		for _, item := range v {
+			data = encodeMMDBValue(data, item)
+		}
+	case map[string]any:
+		control(mmdbMap, len(v))
+		for key, item := range v {
+			data = encodeMMDBValue(data, key)
+			data = encodeMMDBValue(data, item)
+		}
+	}
+	return data
+}
+
+// buildMMDB returns a MaxMind DB file with records of recordSize bits, holding records for
+// networks, each an IPv6 CIDR block, at the data offset given. data is the data section.
+func buildMMDB(t *testing.T, recordSize int, networks map[string]int, data []byte) []byte {
+	t.Helper()
+
+	// records are indexes of nodes, -1 for empty ones, or data offsets, encoded as -2 - offset
+	nodes := [][2]int{{-1, -1}}
+	for cidr, offset := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := network.Mask.Size()
+		ip := network.IP.To16()
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-i%8)) & 1
+			if i == ones-1 {
+				nodes[node][bit] = -2 - offset
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{-1, -1})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	nodeCount := len(nodes)
+	value := func(record int) uint32 {
+		switch {
+		case record == -1:
+			return uint32(nodeCount)
+		case record < -1:
+			return uint32(nodeCount + 16 + (-2 - record))
+		}
+		return uint32(record)
+	}
+
+	var file []byte
+	for _, node := range nodes {
+		left, right := value(node[0]), value(node[1])
+		switch recordSize {
+		case 24:
+			file = append(file, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			file = append(file, byte(left>>16), byte(left>>8), byte(left), byte(left>>24)<<4|byte(right>>24), byte(right>>16), byte(right>>8), byte(right))
+		case 32:
+			file = binary.BigEndian.AppendUint32(file, left)
+			file = binary.BigEndian.AppendUint32(file, right)
+		}
+	}
+	file = append(file, make([]byte, 16)...)
+	file = append(file, data...)
+	file = append(file, mmdbMetadataMarker...)
+	return encodeMMDBValue(file, map[string]any{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+		"ip_version":                  uint16(6),
+		"database_type":               "Test-City",
+		"binary_format_major_version": uint16(2),
+	})
+}
+
+// testMMDB returns a city database locating 81.2.69.0/24 in London, and 2a02:ec0::/32 in Paris.
+func testMMDB(t *testing.T, recordSize int) []byte {
+	t.Helper()
+	london := map[string]any{
+		"country":      map[string]any{"iso_code": "GB", "names": map[string]any{"en": "United Kingdom", "fr": "Royaume-Uni"}},
+		"subdivisions": []any{map[string]any{"iso_code": "ENG", "names": map[string]any{"en": "England"}}},
+		"city":         map[string]any{"names": map[string]any{"en": "London"}},
+		"postal":       map[string]any{"code": "EC1A"},
+		"location":     map[string]any{"latitude": 51.5142, "longitude": -0.0931, "time_zone": "Europe/London"},
+		"is_eu":        false,
+	}
+	data := encodeMMDBValue(nil, london)
+	paris := len(data)
+	// the name of the country is shared through a pointer
+	data = encodeMMDBValue(data, "France")
+	data = encodeMMDBValue(data, map[string]any{
+		"country": map[string]any{"iso_code": "FR", "names": map[string]any{"en": mmdbPointerTo(paris)}},
+	})
+	return buildMMDB(t, recordSize, map[string]int{
+		"::81.2.69.0/120": 0,
+		"2a02:ec0::/32":   paris + 7,
+	}, data)
+}
+
+func TestMMDB_Lookup(t *testing.T) {
+	for _, recordSize := range []int{24, 28, 32} {
+		db, err := NewMMDB(testMMDB(t, recordSize))
+		if err != nil {
+			t.Fatalf("%d bits: %v", recordSize, err)
+		}
+		if db.DatabaseType() != "Test-City" {
+			t.Errorf("%d bits: wrong database type %q", recordSize, db.DatabaseType())
+		}
+
+		location, err := db.Lookup(context.Background(), "81.2.69.160")
+		if err != nil {
+			t.Fatalf("%d bits: %v", recordSize, err)
+		}
+		expected := GeoLocation{
+			Country: "GB", CountryName: "United Kingdom", Region: "ENG", RegionName: "England", City: "London",
+			PostalCode: "EC1A", Latitude: 51.5142, Longitude: -0.0931, TimeZone: "Europe/London",
+		}
+		if *location != expected {
+			t.Errorf("%d bits: expected %+v, got %+v", recordSize, expected, *location)
+		}
+
+		location, err = db.Lookup(context.Background(), "2a02:ec0:1::1")
+		if err != nil || location.Country != "FR" || location.CountryName != "France" {
+			t.Errorf("%d bits: expected France, got %+v, %v", recordSize, location, err)
+		}
+
+		for _, ip := range []string{"81.2.70.1", "8.8.8.8", "2001:4860::1"} {
+			if _, err = db.Lookup(context.Background(), ip); !errors.Is(err, ErrNotFound) {
+				t.Errorf("%d bits: expected ErrNotFound for %s, got %v", recordSize, ip, err)
+			}
+		}
+		if _, err = db.Lookup(context.Background(), "not an ip"); err == nil {
+			t.Errorf("%d bits: expected an error for an invalid address", recordSize)
+		}
+	}
+}
+
+func TestMMDB_Record(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, testMMDB(t, 24), 0600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenMMDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := db.Record("81.2.69.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record["is_eu"] != false {
+		t.Errorf("expected is_eu to be false, got %v", record["is_eu"])
+	}
+	names := record["country"].(map[string]any)["names"].(map[string]any)
+	if names["fr"] != "Royaume-Uni" {
+		t.Errorf("wrong French name %v", names["fr"])
+	}
+}
+
+func TestNewMMDB_Invalid(t *testing.T) {
+	valid := testMMDB(t, 24)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "no metadata", data: valid[:bytes.LastIndex(valid, mmdbMetadataMarker)]},
+		{name: "truncated metadata", data: valid[:len(valid)-10]},
+		{name: "bad record size", data: bytes.Replace(valid, []byte("record_size\xa2\x00\x18"), []byte("record_size\xa2\x00\x19"), 1)},
+	}
+	for _, test := range tests {
+		if _, err := NewMMDB(test.data); !errors.Is(err, ErrInvalidMMDB) {
+			t.Errorf("%s: expected ErrInvalidMMDB, got %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidMoney is returned when an amount of money can't be parsed, or has more decimals than its currency.
+	ErrInvalidMoney = errors.New("invalid amount of money")
+	// ErrCurrencyMismatch is returned by arithmetic on amounts of money in different currencies.
+	ErrCurrencyMismatch = errors.New("currencies do not match")
+	// ErrMoneyOverflow is returned when the result of arithmetic on money is too large to be held.
+	ErrMoneyOverflow = errors.New("amount of money overflows")
+)
+
+// Money is an amount of money, held in the minor unit of its currency, such as cents, so that prices
+// are never rounded as floats are. It is sent and read as JSON as {"amount":"12.34","currency":"USD"}.
+type Money struct {
+	// Amount is the amount in the minor unit of Currency, such as 1234 for 12.34 USD.
+	Amount int64
+	// Currency is the ISO 4217 code of the currency, such as USD.
+	Currency string
+}
+
+// currencyDecimals are the currencies whose minor unit isn't a hundredth; the others have two decimals.
+var currencyDecimals = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0, "RWF": 0,
+	"UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// currencySymbols are the symbols Format uses; other currencies are shown with their code.
+var currencySymbols = map[string]string{
+	"EUR": "€", "GBP": "£", "IDR": "Rp", "INR": "₹", "JPY": "¥", "KRW": "₩", "USD": "$",
+}
+
+// moneyLocale is how amounts of money are written in a language.
+type moneyLocale struct {
+	decimal, group string
+	symbolAfter    bool
+}
+
+// moneyLocales are the locales known to Format and ParseMoney, by language.
+var moneyLocales = map[string]moneyLocale{
+	"en": {decimal: ".", group: ","},
+	"ja": {decimal: ".", group: ","},
+	"id": {decimal: ",", group: "."},
+	"de": {decimal: ",", group: ".", symbolAfter: true},
+	"es": {decimal: ",", group: ".", symbolAfter: true},
+	"it": {decimal: ",", group: ".", symbolAfter: true},
+	"fr": {decimal: ",", group: "\u202f", symbolAfter: true},
+}
+
+// NewMoney returns amount, in the minor unit of currency, as Money.
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// ParseMoney parses a decimal amount of currency, such as "1,234.56" or "-12", as written in locale, such
+// as "de" or "fr-CA", or in English if none is given. The symbol or code of currency may come before or
+// after the amount. Amounts with more decimals than currency has are refused rather than rounded.
+func ParseMoney(s, currency string, locale ...string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	loc := findMoneyLocale(locale)
+
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = strings.TrimSpace(s[1:])
+	}
+	for _, marker := range []string{currency, currencySymbols[currency]} {
+		if marker != "" {
+			s = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(s, marker), marker))
+		}
+	}
+	if !negative && strings.HasPrefix(s, "-") {
+		negative = true
+		s = strings.TrimSpace(s[1:])
+	}
+
+	whole, fraction, _ := strings.Cut(s, loc.decimal)
+	decimals := Money{Currency: currency}.decimals()
+	if whole == "" || len(fraction) > decimals || strings.HasPrefix(whole, loc.group) || strings.HasSuffix(whole, loc.group) {
+		return Money{}, ErrInvalidMoney
+	}
+	if loc.group == "\u202f" {
+		// other spaces are also written between groups
+		whole = strings.NewReplacer(" ", "", "\u00a0", "").Replace(whole)
+	}
+	whole = strings.ReplaceAll(whole, loc.group, "")
+	digits := whole + fraction + strings.Repeat("0", decimals-len(fraction))
+
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Money{}, ErrInvalidMoney
+		}
+	}
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, ErrMoneyOverflow
+	}
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// findMoneyLocale returns the locale named by the first of names, by its language, or English.
+func findMoneyLocale(names []string) moneyLocale {
+	if len(names) > 0 {
+		name := strings.ToLower(names[0])
+		if loc, ok := moneyLocales[name]; ok {
+			return loc
+		}
+		if i := strings.IndexAny(name, "-_"); i > 0 {
+			if loc, ok := moneyLocales[name[:i]]; ok {
+				return loc
+			}
+		}
+	}
+	return moneyLocales["en"]
+}
+
+// decimals returns the number of decimals of the currency of m.
+func (m Money) decimals() int {
+	if d, ok := currencyDecimals[m.Currency]; ok {
+		return d
+	}
+	return 2
+}
+
+// IsZero reports whether m is zero.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Add returns m plus o, which must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	sum := m.Amount + o.Amount
+	if (sum > m.Amount) != (o.Amount > 0) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Sub returns m minus o, which must be in the same currency.
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, ErrMoneyOverflow
+	}
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// Mul returns m multiplied by n, such as the price of n items.
+func (m Money) Mul(n int64) (Money, error) {
+	if m.Amount == 0 || n == 0 {
+		return Money{Currency: m.Currency}, nil
+	}
+	product := m.Amount * n
+	if product/n != m.Amount || (m.Amount == -1 && n == math.MinInt64) || (n == -1 && m.Amount == math.MinInt64) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Allocate splits m into parts in proportion to ratios, such as 1, 1, 1 for three equal shares, without
+// losing any of its minor units: the remainder is spread over the first parts, one unit each.
+func (m Money) Allocate(ratios ...int) []Money {
+	total := int64(0)
+	for _, ratio := range ratios {
+		total += int64(ratio)
+	}
+
+	parts := make([]Money, len(ratios))
+	if total <= 0 {
+		return parts
+	}
+
+	remainder := m.Amount
+	for i, ratio := range ratios {
+		share := m.Amount / total * int64(ratio)
+		share += m.Amount % total * int64(ratio) / total
+		parts[i] = Money{Amount: share, Currency: m.Currency}
+		remainder -= share
+	}
+
+	unit := int64(1)
+	if remainder < 0 {
+		unit = -1
+	}
+	for i := 0; remainder != 0; i = (i + 1) % len(parts) {
+		if ratios[i] > 0 {
+			parts[i].Amount += unit
+			remainder -= unit
+		}
+	}
+	return parts
+}
+
+// decimalString returns the amount of m as a decimal, with group between groups of three digits.
+func (m Money) decimalString(decimal, group string) string {
+	amount := m.Amount
+	sign := ""
+	digits := strconv.FormatInt(amount, 10)
+	if amount < 0 {
+		sign = "-"
+		digits = digits[1:]
+	}
+
+	decimals := m.decimals()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-decimals], digits[len(digits)-decimals:]
+
+	whole = groupThousands(whole, group)
+
+	if fraction == "" {
+		return sign + whole
+	}
+	return sign + whole + decimal + fraction
+}
+
+// groupThousands returns the digits of whole with group between groups of three digits.
+func groupThousands(whole, group string) string {
+	if group == "" {
+		return whole
+	}
+	var b strings.Builder
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(group)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// String returns m as its decimal amount and currency code, such as "1234.56 USD".
+func (m Money) String() string {
+	return m.decimalString(".", "") + " " + m.Currency
+}
+
+// Format returns m as it is written in locale, such as "de" or "en-GB", or in English if none is given,
+// with the symbol of its currency where it has a common one: "$1,234.56", "1.234,56 €" or "CHF 12.00".
+// The symbol is separated from the amount by a no-break space, and French groups by a narrow one.
+func (m Money) Format(locale ...string) string {
+	loc := findMoneyLocale(locale)
+	amount := m.decimalString(loc.decimal, loc.group)
+
+	symbol, ok := currencySymbols[m.Currency]
+	if !ok {
+		symbol = m.Currency
+	}
+
+	if loc.symbolAfter {
+		return amount + "\u00a0" + symbol
+	}
+	if !ok {
+		symbol += "\u00a0"
+	}
+	if strings.HasPrefix(amount, "-") {
+		return "-" + symbol + amount[1:]
+	}
+	return symbol + amount
+}
+
+// moneyJSON is how Money is sent as JSON: its amount is a string, so that clients don't read it as a float.
+type moneyJSON struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m Money) MarshalJSON() ([]byte, error) {
+	amount, _ := json.Marshal(m.decimalString(".", ""))
+	return json.Marshal(moneyJSON{Amount: amount, Currency: m.Currency})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The amount may be a string or a number, which is read
+// without going through a float.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var payload moneyJSON
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	amount := string(payload.Amount)
+	if strings.HasPrefix(amount, `"`) {
+		if err := json.Unmarshal(payload.Amount, &amount); err != nil {
+			return err
+		}
+	}
+	if payload.Currency == "" || strings.ContainsAny(amount, "eE") {
+		return ErrInvalidMoney
+	}
+
+	parsed, err := ParseMoney(amount, payload.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
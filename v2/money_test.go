@@ -0,0 +1,144 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+var parseMoneyTests = []struct {
+	input    string
+	currency string
+	locale   string
+	amount   int64
+	err      error
+}{
+	{input: "12.34", currency: "USD", amount: 1234},
+	{input: "1,234.5", currency: "usd", amount: 123450},
+	{input: "$1,234.56", currency: "USD", amount: 123456},
+	{input: "-$0.05", currency: "USD", amount: -5},
+	{input: "12 USD", currency: "USD", amount: 1200},
+	{input: "1.234,56 €", currency: "EUR", locale: "de-DE", amount: 123456},
+	{input: "1 234,56 €", currency: "EUR", locale: "fr", amount: 123456},
+	{input: "1\u202f234,56\u00a0€", currency: "EUR", locale: "fr", amount: 123456},
+	{input: "Rp1.500", currency: "IDR", locale: "id", amount: 150000},
+	{input: "¥1,500", currency: "JPY", amount: 1500},
+	{input: "1.250", currency: "KWD", amount: 1250},
+	{input: "1.234", currency: "USD", err: ErrInvalidMoney},
+	{input: "1.5", currency: "JPY", err: ErrInvalidMoney},
+	{input: "12.3e4", currency: "USD", err: ErrInvalidMoney},
+	{input: "", currency: "USD", err: ErrInvalidMoney},
+	{input: ",100", currency: "USD", err: ErrInvalidMoney},
+	{input: "abc", currency: "USD", err: ErrInvalidMoney},
+	{input: "99999999999999999999", currency: "USD", err: ErrMoneyOverflow},
+}
+
+func TestParseMoney(t *testing.T) {
+	for _, e := range parseMoneyTests {
+		m, err := ParseMoney(e.input, e.currency, e.locale)
+		if !errors.Is(err, e.err) {
+			t.Errorf("%q: expected error %v, got %v", e.input, e.err, err)
+			continue
+		}
+		if err == nil && m.Amount != e.amount {
+			t.Errorf("%q: expected %d, got %d", e.input, e.amount, m.Amount)
+		}
+	}
+}
+
+var formatMoneyTests = []struct {
+	m        Money
+	locale   string
+	expected string
+}{
+	{m: NewMoney(123456, "USD"), expected: "$1,234.56"},
+	{m: NewMoney(-5, "USD"), expected: "-$0.05"},
+	{m: NewMoney(123456789, "EUR"), locale: "de", expected: "1.234.567,89\u00a0€"},
+	{m: NewMoney(123456, "EUR"), locale: "fr-FR", expected: "1\u202f234,56\u00a0€"},
+	{m: NewMoney(1200, "CHF"), expected: "CHF\u00a012.00"},
+	{m: NewMoney(1500, "JPY"), locale: "ja", expected: "¥1,500"},
+	{m: NewMoney(1250, "KWD"), locale: "xx", expected: "KWD\u00a01.250"},
+}
+
+func TestMoney_Format(t *testing.T) {
+	for _, e := range formatMoneyTests {
+		if out := e.m.Format(e.locale); out != e.expected {
+			t.Errorf("expected %q, got %q", e.expected, out)
+		}
+	}
+
+	if s := NewMoney(-123456, "USD").String(); s != "-1234.56 USD" {
+		t.Error("wrong string", s)
+	}
+}
+
+func TestMoney_Arithmetic(t *testing.T) {
+	a, b := NewMoney(1050, "USD"), NewMoney(250, "USD")
+
+	if sum, err := a.Add(b); err != nil || sum.Amount != 1300 {
+		t.Error("wrong sum", sum, err)
+	}
+	if diff, err := b.Sub(a); err != nil || diff.Amount != -800 {
+		t.Error("wrong difference", diff, err)
+	}
+	if product, err := a.Mul(3); err != nil || product.Amount != 3150 {
+		t.Error("wrong product", product, err)
+	}
+
+	if _, err := a.Add(NewMoney(1, "EUR")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Error("expected ErrCurrencyMismatch, got", err)
+	}
+	if _, err := NewMoney(math.MaxInt64, "USD").Add(NewMoney(1, "USD")); !errors.Is(err, ErrMoneyOverflow) {
+		t.Error("expected ErrMoneyOverflow, got", err)
+	}
+	if _, err := NewMoney(math.MinInt64, "USD").Sub(NewMoney(1, "USD")); !errors.Is(err, ErrMoneyOverflow) {
+		t.Error("expected ErrMoneyOverflow, got", err)
+	}
+	if _, err := NewMoney(math.MaxInt64/2, "USD").Mul(3); !errors.Is(err, ErrMoneyOverflow) {
+		t.Error("expected ErrMoneyOverflow, got", err)
+	}
+}
+
+func TestMoney_Allocate(t *testing.T) {
+	amounts := func(parts []Money) []int64 {
+		var out []int64
+		for _, p := range parts {
+			out = append(out, p.Amount)
+		}
+		return out
+	}
+
+	if parts := NewMoney(100, "USD").Allocate(1, 1, 1); !reflect.DeepEqual(amounts(parts), []int64{34, 33, 33}) {
+		t.Error("wrong allocation", parts)
+	}
+	if parts := NewMoney(-5, "USD").Allocate(3, 7); !reflect.DeepEqual(amounts(parts), []int64{-2, -3}) {
+		t.Error("wrong allocation", parts)
+	}
+	if parts := NewMoney(10, "USD").Allocate(0, 1); !reflect.DeepEqual(amounts(parts), []int64{0, 10}) {
+		t.Error("wrong allocation", parts)
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	out, err := json.Marshal(struct {
+		Price Money `json:"price"`
+	}{NewMoney(-1999, "USD")})
+	if err != nil || string(out) != `{"price":{"amount":"-19.99","currency":"USD"}}` {
+		t.Fatal("wrong JSON", string(out), err)
+	}
+
+	var m Money
+	for _, input := range []string{`{"amount":"19.99","currency":"USD"}`, `{"amount":19.99,"currency":"USD"}`} {
+		if err = json.Unmarshal([]byte(input), &m); err != nil || m != NewMoney(1999, "USD") {
+			t.Error("wrong money", input, m, err)
+		}
+	}
+
+	for _, input := range []string{`{"amount":1.999,"currency":"USD"}`, `{"amount":1e3,"currency":"USD"}`, `{"amount":"1"}`} {
+		if err = json.Unmarshal([]byte(input), &m); err == nil {
+			t.Error("expected an error for", input)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package toolkit
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// formNameEscaper escapes the names of multipart form fields.
+var formNameEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", "")
+
+// multipartPart is a field or a file of a MultipartRequest.
+type multipartPart struct {
+	field    string
+	value    string
+	path     string
+	fileName string
+	reader   io.Reader
+	isFile   bool
+}
+
+// MultipartRequest builds a multipart/form-data request, as sent by a browser form with files, whose
+// body is streamed as it is sent, rather than held in memory:
+//
+//	request, err := toolkit.NewMultipartRequest("https://api.example.com/documents").
+//		AddField("title", "Report").
+//		AddFile("file", "./report.pdf").
+//		Build()
+type MultipartRequest struct {
+	url    string
+	method string
+	header http.Header
+	parts  []multipartPart
+}
+
+// NewMultipartRequest returns a MultipartRequest posting to url.
+func NewMultipartRequest(url string) *MultipartRequest {
+	return &MultipartRequest{url: url, method: http.MethodPost, header: make(http.Header)}
+}
+
+// Method sets the method of the request, POST by default.
+func (m *MultipartRequest) Method(method string) *MultipartRequest {
+	m.method = method
+	return m
+}
+
+// Header sets a header of the request.
+func (m *MultipartRequest) Header(name, value string) *MultipartRequest {
+	m.header.Set(name, value)
+	return m
+}
+
+// AddField adds a form field.
+func (m *MultipartRequest) AddField(name, value string) *MultipartRequest {
+	m.parts = append(m.parts, multipartPart{field: name, value: value})
+	return m
+}
+
+// AddFile adds the file at path, under its base name, as the form field called field. Its content type
+// is guessed from its extension. The file is opened when the body is sent.
+func (m *MultipartRequest) AddFile(field, path string) *MultipartRequest {
+	m.parts = append(m.parts, multipartPart{field: field, path: path, fileName: filepath.Base(path), isFile: true})
+	return m
+}
+
+// AddReader adds the content read from r, as a file called fileName, as the form field called field.
+// As r can only be read once, a request with readers can't be sent again, such as to retry it.
+func (m *MultipartRequest) AddReader(field, fileName string, r io.Reader) *MultipartRequest {
+	m.parts = append(m.parts, multipartPart{field: field, fileName: fileName, reader: r, isFile: true})
+	return m
+}
+
+// Build returns the request. The files added with AddFile must exist. Unless readers were added with
+// AddReader, the request's GetBody is set, so that it can be sent again, such as on redirects.
+func (m *MultipartRequest) Build() (*http.Request, error) {
+	rereadable := true
+	for _, part := range m.parts {
+		if part.path != "" {
+			if _, err := os.Stat(part.path); err != nil {
+				return nil, err
+			}
+		}
+		if part.reader != nil {
+			rereadable = false
+		}
+	}
+
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	request, err := http.NewRequest(m.method, m.url, m.body(boundary))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range m.header {
+		request.Header[name] = append([]string(nil), values...)
+	}
+	request.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	if rereadable {
+		request.GetBody = func() (io.ReadCloser, error) {
+			return m.body(boundary), nil
+		}
+	}
+	return request, nil
+}
+
+// body returns the body of the request, written in the background as it is read.
+func (m *MultipartRequest) body(boundary string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		writer := multipart.NewWriter(pw)
+		_ = writer.SetBoundary(boundary)
+		for _, part := range m.parts {
+			if err := writeMultipartPart(writer, part); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+	return pr
+}
+
+// writeMultipartPart writes part with writer.
+func writeMultipartPart(writer *multipart.Writer, part multipartPart) error {
+	name := fmt.Sprintf(`form-data; name="%s"`, formNameEscaper.Replace(part.field))
+	if !part.isFile {
+		w, err := writer.CreatePart(textproto.MIMEHeader{"Content-Disposition": {name}})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, part.value)
+		return err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(part.fileName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {contentDisposition(name, part.fileName)},
+		"Content-Type":        {contentType},
+	})
+	if err != nil {
+		return err
+	}
+
+	r := part.reader
+	if part.path != "" {
+		f, err := os.Open(part.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
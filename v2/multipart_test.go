@@ -0,0 +1,67 @@
+package toolkit
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMultipartRequest(t *testing.T) {
+	request, err := NewMultipartRequest("https://api.example.com/documents").
+		Method("PUT").
+		Header("X-Test", "1").
+		AddField("title", "Report").
+		AddFile("image", "./testdata/img.png").
+		AddReader("notes", "notes é.txt", strings.NewReader("hello")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Method != "PUT" || request.Header.Get("X-Test") != "1" || request.GetBody != nil {
+		t.Errorf("wrong request %s %v", request.Method, request.Header)
+	}
+
+	if err = request.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if request.FormValue("title") != "Report" {
+		t.Errorf("wrong field %q", request.FormValue("title"))
+	}
+
+	image := request.MultipartForm.File["image"][0]
+	info, _ := os.Stat("./testdata/img.png")
+	if image.Filename != "img.png" || image.Size != info.Size() || image.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("wrong file %s %d %s", image.Filename, image.Size, image.Header.Get("Content-Type"))
+	}
+
+	notes := request.MultipartForm.File["notes"][0]
+	f, _ := notes.Open()
+	content, _ := io.ReadAll(f)
+	f.Close()
+	if notes.Filename != "notes é.txt" || string(content) != "hello" {
+		t.Errorf("wrong file %s %q", notes.Filename, content)
+	}
+}
+
+func TestMultipartRequest_GetBody(t *testing.T) {
+	builder := NewMultipartRequest("https://api.example.com/documents").AddField("a", "1").AddFile("image", "./testdata/img.png")
+	request, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := io.ReadAll(request.Body)
+	body, err := request.GetBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := io.ReadAll(body)
+	if len(first) == 0 || string(first) != string(second) {
+		t.Error("expected GetBody to return the same body again")
+	}
+
+	if _, err = builder.AddFile("missing", "./testdata/missing.png").Build(); !os.IsNotExist(err) {
+		t.Error("expected an error for a missing file, got", err)
+	}
+}
@@ -0,0 +1,265 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth2Token is an access token obtained from an OAuth2 authorization server.
+type OAuth2Token struct {
+	AccessToken string
+	TokenType   string
+	// Expiry is when the token expires. Zero means it doesn't.
+	Expiry time.Time
+}
+
+// TokenSource is the interface implemented by the providers of the tokens sent to remote services.
+type TokenSource interface {
+	Token(ctx context.Context) (*OAuth2Token, error)
+}
+
+// OAuth2Error is an error response from an OAuth2 token endpoint.
+type OAuth2Error struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+// Error returns the error code and description.
+func (e *OAuth2Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oauth2: %s: %s", e.Code, e.Description)
+	}
+	return fmt.Sprintf("oauth2: %s (status %d)", e.Code, e.StatusCode)
+}
+
+// ClientCredentialsOptions is the type used to configure a ClientCredentialsTokenSource.
+type ClientCredentialsOptions struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Params are sent to the token endpoint along with the standard parameters, such as an audience.
+	Params url.Values
+	// AuthInParams sends the client id and secret as form parameters, rather than with HTTP Basic authentication,
+	// for servers which don't support the latter.
+	AuthInParams bool
+	// RefreshBefore is how long before its expiry a token is replaced. Defaults to one minute.
+	RefreshBefore time.Duration
+	// Client is used to call the token endpoint. Defaults to an http.Client with a 30 second timeout.
+	Client *http.Client
+}
+
+// ClientCredentialsTokenSource is a TokenSource getting tokens with the OAuth2 client credentials grant,
+// for service to service calls. A token is reused until shortly before it expires.
+type ClientCredentialsTokenSource struct {
+	options ClientCredentialsOptions
+
+	mu    sync.Mutex
+	token *OAuth2Token
+	now   func() time.Time
+}
+
+// NewClientCredentialsTokenSource returns a ClientCredentialsTokenSource configured with opts.
+func NewClientCredentialsTokenSource(opts ClientCredentialsOptions) *ClientCredentialsTokenSource {
+	if opts.RefreshBefore == 0 {
+		opts.RefreshBefore = time.Minute
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &ClientCredentialsTokenSource{options: opts, now: time.Now}
+}
+
+// Token returns the current token, getting a new one if there is none yet, or it is about to expire.
+// Concurrent calls wait for a single request to the token endpoint.
+func (s *ClientCredentialsTokenSource) Token(ctx context.Context) (*OAuth2Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && (s.token.Expiry.IsZero() || s.now().Add(s.options.RefreshBefore).Before(s.token.Expiry)) {
+		return s.token, nil
+	}
+
+	token, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// Invalidate discards the current token, so that the next call to Token gets a new one, such as after
+// a remote service rejected it.
+func (s *ClientCredentialsTokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = nil
+}
+
+// Client returns a copy of base (or of a client with a 30 second timeout, if nil) sending the tokens of s
+// in the Authorization header of every request.
+func (s *ClientCredentialsTokenSource) Client(base *http.Client) *http.Client {
+	c := http.Client{Timeout: 30 * time.Second}
+	if base != nil {
+		c = *base
+	}
+
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	c.Transport = tokenTransport{base: transport, source: s}
+	return &c
+}
+
+// fetch requests a new token from the token endpoint.
+func (s *ClientCredentialsTokenSource) fetch(ctx context.Context) (*OAuth2Token, error) {
+	params := url.Values{}
+	for key, values := range s.options.Params {
+		params[key] = values
+	}
+	params.Set("grant_type", "client_credentials")
+	if len(s.options.Scopes) > 0 {
+		params.Set("scope", strings.Join(s.options.Scopes, " "))
+	}
+	if s.options.AuthInParams {
+		params.Set("client_id", s.options.ClientID)
+		params.Set("client_secret", s.options.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.options.TokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !s.options.AuthInParams {
+		req.SetBasicAuth(url.QueryEscape(s.options.ClientID), url.QueryEscape(s.options.ClientSecret))
+	}
+
+	requested := s.now()
+	res, err := s.options.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.Unmarshal(body, &payload); err != nil && res.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("oauth2: invalid token response: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK || payload.Error != "" {
+		code := payload.Error
+		if code == "" {
+			code = http.StatusText(res.StatusCode)
+		}
+		return nil, &OAuth2Error{StatusCode: res.StatusCode, Code: code, Description: payload.ErrorDescription}
+	}
+	if payload.AccessToken == "" {
+		return nil, fmt.Errorf("oauth2: the token response has no access token")
+	}
+
+	token := &OAuth2Token{AccessToken: payload.AccessToken, TokenType: payload.TokenType}
+	if token.TokenType == "" {
+		token.TokenType = "Bearer"
+	}
+	if payload.ExpiresIn > 0 {
+		token.Expiry = requested.Add(time.Duration(payload.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// tokenTransport is an http.RoundTripper adding the tokens of a TokenSource to requests.
+type tokenTransport struct {
+	base   http.RoundTripper
+	source TokenSource
+}
+
+// RoundTrip sets the Authorization header on a copy of req, and sends it.
+func (t tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", authorizationHeader(token))
+	return t.base.RoundTrip(req)
+}
+
+// authorizeRemote sets the Authorization header of req with a token from Tools.RemoteTokenSource, if set
+// and the URL of req is under one of Tools.RemoteTokenURLs.
+func (t *Tools) authorizeRemote(req *http.Request) error {
+	if t.RemoteTokenSource == nil || !remoteTokenAllowed(req.URL, t.RemoteTokenURLs) {
+		return nil
+	}
+	return t.setRemoteToken(req)
+}
+
+// authorizesRemote reports whether authorizeRemote sets the Authorization header of requests to uri.
+func (t *Tools) authorizesRemote(uri string) bool {
+	if t.RemoteTokenSource == nil {
+		return false
+	}
+	u, err := url.Parse(uri)
+	return err == nil && remoteTokenAllowed(u, t.RemoteTokenURLs)
+}
+
+// remoteTokenAllowed reports whether u is under one of prefixes, with the same scheme and host, and a
+// path starting with theirs.
+func remoteTokenAllowed(u *url.URL, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		p, err := url.Parse(prefix)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(u.Scheme, p.Scheme) && strings.EqualFold(u.Host, p.Host) && strings.HasPrefix(u.Path, p.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// setRemoteToken sets the Authorization header of req with a token from Tools.RemoteTokenSource, if set,
+// whatever its URL.
+func (t *Tools) setRemoteToken(req *http.Request) error {
+	if t.RemoteTokenSource == nil {
+		return nil
+	}
+
+	token, err := t.RemoteTokenSource.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorizationHeader(token))
+	return nil
+}
+
+// authorizationHeader returns the Authorization header value for token.
+func authorizationHeader(token *OAuth2Token) string {
+	tokenType := token.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + token.AccessToken
+}
@@ -0,0 +1,125 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientCredentialsTokenSource(t *testing.T) {
+	requests := 0
+	tokenClient := NewTestClient(func(req *http.Request) *http.Response {
+		requests++
+		id, secret, _ := req.BasicAuth()
+		_ = req.ParseForm()
+		if id != "client" || secret != "s%3Acret" {
+			t.Error("wrong client credentials", id, secret)
+		}
+		if req.PostForm.Get("grant_type") != "client_credentials" || req.PostForm.Get("scope") != "read write" || req.PostForm.Get("audience") != "api" {
+			t.Error("wrong parameters", req.PostForm)
+		}
+		body := `{"access_token":"token` + string(rune('0'+requests)) + `","token_type":"bearer","expires_in":3600}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: make(http.Header)}
+	})
+
+	source := NewClientCredentialsTokenSource(ClientCredentialsOptions{
+		TokenURL:     "https://auth.example.com/token",
+		ClientID:     "client",
+		ClientSecret: "s:cret",
+		Scopes:       []string{"read", "write"},
+		Params:       map[string][]string{"audience": {"api"}},
+		Client:       tokenClient,
+	})
+	now := time.Now()
+	source.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		token, err := source.Token(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != "token1" {
+			t.Error("wrong token", token.AccessToken)
+		}
+	}
+	if requests != 1 {
+		t.Error("expected the token to be cached, made", requests, "requests")
+	}
+
+	// refreshed shortly before it expires
+	now = now.Add(3600*time.Second - 30*time.Second)
+	if token, _ := source.Token(ctx); token.AccessToken != "token2" {
+		t.Error("expected a new token, got", token.AccessToken)
+	}
+
+	source.Invalidate()
+	if token, _ := source.Token(ctx); token.AccessToken != "token3" {
+		t.Error("expected a new token after Invalidate, got", token.AccessToken)
+	}
+
+	// injected into the remote calls
+	var authorization string
+	remote := NewTestClient(func(req *http.Request) *http.Response {
+		authorization = req.Header.Get("Authorization")
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}")), Header: make(http.Header)}
+	})
+
+	testTools := Tools{RemoteTokenSource: source, RemoteTokenURLs: []string{"https://api.example.com/v1/"}}
+	if _, _, err := testTools.PushJSONToRemote("https://api.example.com/v1/orders", struct{}{}, remote); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Bearer token3" {
+		t.Error("wrong Authorization header", authorization)
+	}
+
+	// the token is only sent under RemoteTokenURLs
+	for _, uri := range []string{
+		"https://hooks.example.net/v1/",
+		"http://api.example.com/v1/orders",
+		"https://api.example.com/v2/orders",
+		"https://api.example.com.evil.test/v1/",
+	} {
+		authorization = ""
+		if _, _, err := testTools.PushJSONToRemote(uri, struct{}{}, remote); err != nil {
+			t.Fatal(err)
+		}
+		if authorization != "" {
+			t.Errorf("expected no token to be sent to %s, got %q", uri, authorization)
+		}
+	}
+	testTools.RemoteTokenURLs = nil
+	if _, _, err := testTools.PushJSONToRemote("https://api.example.com/v1/orders", struct{}{}, remote); err != nil || authorization != "" {
+		t.Errorf("expected no token to be sent without RemoteTokenURLs, got %q, %v", authorization, err)
+	}
+
+	authorization = ""
+	if _, err := source.Client(remote).Get("https://api.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Bearer token3" {
+		t.Error("wrong Authorization header from Client", authorization)
+	}
+}
+
+func TestClientCredentialsTokenSource_Error(t *testing.T) {
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		body := `{"error":"invalid_client","error_description":"unknown client"}`
+		return &http.Response{StatusCode: http.StatusUnauthorized, Body: io.NopCloser(strings.NewReader(body)), Header: make(http.Header)}
+	})
+
+	source := NewClientCredentialsTokenSource(ClientCredentialsOptions{TokenURL: "https://auth.example.com/token", Client: client})
+	_, err := source.Token(context.Background())
+
+	var oauthErr *OAuth2Error
+	if !errors.As(err, &oauthErr) {
+		t.Fatal("expected an OAuth2Error, got", err)
+	}
+	if oauthErr.Code != "invalid_client" || oauthErr.StatusCode != http.StatusUnauthorized {
+		t.Error("wrong error", oauthErr)
+	}
+}
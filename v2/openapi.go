@@ -0,0 +1,271 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrOpenAPIYAML is returned by NewOpenAPI in development for specs which aren't JSON, as responses are
+// only validated against JSON specs.
+var ErrOpenAPIYAML = errors.New("responses can only be validated against a JSON OpenAPI spec")
+
+// OpenAPIOptions is the type used to configure an OpenAPI.
+type OpenAPIOptions struct {
+	// Development makes WriteJSON validate responses against the spec, answering those which don't
+	// conform with a 500 status code and the violations, so that contract drift is caught early.
+	Development bool
+	// BasePath is the prefix of request paths which the paths of the spec don't include, such as /api/v1.
+	BasePath string
+	// SwaggerUIURL is where SwaggerUIHandler loads the Swagger UI assets from.
+	// Defaults to https://unpkg.com/swagger-ui-dist@5.
+	SwaggerUIURL string
+}
+
+// OpenAPI is the type used to serve an OpenAPI document, and to check responses against it.
+type OpenAPI struct {
+	spec        []byte
+	contentType string
+	options     OpenAPIOptions
+	tools       *Tools
+
+	document   map[string]any
+	schemas    *JSONSchema
+	operations []openAPIOperation
+}
+
+// openAPIOperation is a path of the spec, split into segments, along with its operations by method.
+type openAPIOperation struct {
+	segments []string
+	methods  map[string]any
+}
+
+// NewOpenAPI returns an OpenAPI for spec, a JSON or YAML OpenAPI document, usually embedded in the
+// binary with go:embed. Response schemas are compiled right away, so that errors in them are found on
+// startup. They are JSON Schemas, as in OpenAPI 3.1; the nullable keyword of OpenAPI 3.0 is understood.
+func (t *Tools) NewOpenAPI(spec []byte, opts ...OpenAPIOptions) (*OpenAPI, error) {
+	var options OpenAPIOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.SwaggerUIURL == "" {
+		options.SwaggerUIURL = "https://unpkg.com/swagger-ui-dist@5"
+	}
+	options.BasePath = strings.TrimSuffix(options.BasePath, "/")
+
+	o := &OpenAPI{spec: spec, contentType: "application/yaml", options: options, tools: t}
+
+	dec := json.NewDecoder(bytes.NewReader(spec))
+	dec.UseNumber()
+	if err := dec.Decode(&o.document); err != nil {
+		if options.Development {
+			return nil, ErrOpenAPIYAML
+		}
+		return o, nil
+	}
+	o.contentType = "application/json"
+
+	o.schemas = &JSONSchema{root: o.document, patterns: map[string]*regexp.Regexp{}}
+	paths, _ := o.document["paths"].(map[string]any)
+	for p, item := range paths {
+		methods, _ := item.(map[string]any)
+		o.operations = append(o.operations, openAPIOperation{segments: strings.Split(strings.Trim(p, "/"), "/"), methods: methods})
+
+		for _, operation := range methods {
+			op, _ := operation.(map[string]any)
+			responses, _ := op["responses"].(map[string]any)
+			for status := range responses {
+				if schema := o.responseSchema(responses, status); schema != nil {
+					if err := o.schemas.compile(schema); err != nil {
+						return nil, fmt.Errorf("%s %s: %w", p, status, err)
+					}
+				}
+			}
+		}
+	}
+
+	// the most specific paths first, so that /users/me wins over /users/{id}
+	sort.SliceStable(o.operations, func(i, j int) bool {
+		return literalSegments(o.operations[i].segments) > literalSegments(o.operations[j].segments)
+	})
+	return o, nil
+}
+
+// literalSegments returns how many of segments aren't templated, as {id} is.
+func literalSegments(segments []string) int {
+	n := 0
+	for _, s := range segments {
+		if !strings.HasPrefix(s, "{") {
+			n++
+		}
+	}
+	return n
+}
+
+// SpecHandler returns a handler serving the OpenAPI document.
+func (o *OpenAPI) SpecHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", o.contentType)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(o.spec))
+	})
+}
+
+// swaggerUITemplate is the page served by SwaggerUIHandler.
+var swaggerUITemplate = template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>API documentation</title>
+<link rel="stylesheet" href="{{.Assets}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.Assets}}/swagger-ui-bundle.js" crossorigin></script>
+<script>
+window.onload = function () {
+	window.ui = SwaggerUIBundle({url: {{.SpecURL}}, dom_id: "#swagger-ui"});
+};
+</script>
+</body>
+</html>
+`))
+
+// SwaggerUIHandler returns a handler serving Swagger UI for the document served at specURL, usually by
+// SpecHandler. The Swagger UI assets are loaded from OpenAPIOptions.SwaggerUIURL.
+func (o *OpenAPI) SwaggerUIHandler(specURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var page bytes.Buffer
+		err := swaggerUITemplate.Execute(&page, struct{ Assets, SpecURL string }{o.options.SwaggerUIURL, specURL})
+		if err != nil {
+			_ = o.tools.ErrorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = page.WriteTo(w)
+	})
+}
+
+// WriteJSON writes data as JSON with status, as Tools.WriteJSON does. In development, the response is
+// first validated against the schema the spec gives for the operation of r and status; a response which
+// doesn't conform, or isn't described by the spec, is logged and answered with a 500 status code and
+// the violations instead.
+func (o *OpenAPI) WriteJSON(w http.ResponseWriter, r *http.Request, status int, data any, headers ...http.Header) error {
+	if !o.options.Development {
+		return o.tools.WriteJSON(w, status, data, headers...)
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	errs, err := o.ValidateResponse(r, status, body)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		o.tools.logger().Error("response does not match OpenAPI spec", "method", r.Method, "path", r.URL.Path,
+			"status", status, "err", errs)
+		return o.tools.ErrorJSON(w, errs, http.StatusInternalServerError)
+	}
+	return o.tools.WriteJSON(w, status, data, headers...)
+}
+
+// ValidateResponse validates body, a JSON response sent with status to r, against the spec, such as in
+// tests. Operations and statuses the spec doesn't describe are reported under "response".
+func (o *OpenAPI) ValidateResponse(r *http.Request, status int, body []byte) (ValidationErrors, error) {
+	if o.schemas == nil {
+		return nil, ErrOpenAPIYAML
+	}
+
+	operation := o.findOperation(r)
+	if operation == nil {
+		return ValidationErrors{"response": {r.Method + " " + r.URL.Path + " is not described by the spec"}}, nil
+	}
+
+	responses, _ := operation["responses"].(map[string]any)
+	code := strconv.Itoa(status)
+	key := ""
+	for _, candidate := range []string{code, code[:1] + "XX", "default"} {
+		if _, ok := responses[candidate]; ok {
+			key = candidate
+			break
+		}
+	}
+	if key == "" {
+		return ValidationErrors{"response": {"status " + code + " is not described by the spec"}}, nil
+	}
+
+	schema := o.responseSchema(responses, key)
+	if schema == nil {
+		return ValidationErrors{}, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	errs := ValidationErrors{}
+	o.schemas.validate(schema, value, "", errs, 0)
+	return errs, nil
+}
+
+// findOperation returns the operation of the spec for the method and path of r, or nil.
+func (o *OpenAPI) findOperation(r *http.Request) map[string]any {
+	p := strings.TrimPrefix(r.URL.Path, o.options.BasePath)
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+
+	for _, candidate := range o.operations {
+		if len(candidate.segments) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, s := range candidate.segments {
+			if !strings.HasPrefix(s, "{") && s != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			operation, _ := candidate.methods[strings.ToLower(r.Method)].(map[string]any)
+			if operation != nil {
+				return operation
+			}
+		}
+	}
+	return nil
+}
+
+// responseSchema returns the schema of the JSON content of the response for status in responses,
+// following a reference to the components of the spec, or nil if it has none.
+func (o *OpenAPI) responseSchema(responses map[string]any, status string) any {
+	response, _ := responses[status].(map[string]any)
+	if ref, ok := response["$ref"].(string); ok {
+		target, err := o.schemas.resolve(ref)
+		if err != nil {
+			return nil
+		}
+		response, _ = target.(map[string]any)
+	}
+
+	content, _ := response["content"].(map[string]any)
+	for mediaType, media := range content {
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			if m, ok := media.(map[string]any); ok {
+				return m["schema"]
+			}
+		}
+	}
+	return nil
+}
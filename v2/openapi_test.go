@@ -0,0 +1,154 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var testOpenAPISpec = []byte(`{
+	"openapi": "3.0.3",
+	"info": {"title": "Users", "version": "1.0.0"},
+	"paths": {
+		"/users/{id}": {
+			"get": {
+				"responses": {
+					"200": {"description": "a user", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+					"404": {"$ref": "#/components/responses/Error"}
+				}
+			}
+		},
+		"/users/me": {
+			"get": {
+				"responses": {
+					"200": {"description": "the current user", "content": {"application/json": {"schema": {"type": "string"}}}}
+				}
+			}
+		},
+		"/users": {
+			"delete": {"responses": {"204": {"description": "deleted"}}}
+		}
+	},
+	"components": {
+		"schemas": {
+			"User": {
+				"type": "object",
+				"required": ["id", "name"],
+				"properties": {
+					"id": {"type": "integer"},
+					"name": {"type": "string"},
+					"nickname": {"type": "string", "nullable": true}
+				}
+			}
+		},
+		"responses": {
+			"Error": {"description": "an error", "content": {"application/json": {"schema": {"type": "object", "required": ["message"]}}}}
+		}
+	}
+}`)
+
+func TestOpenAPI_ValidateResponse(t *testing.T) {
+	var testTools Tools
+	api, err := testTools.NewOpenAPI(testOpenAPISpec, OpenAPIOptions{BasePath: "/api/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, path string
+		status       int
+		body         string
+		field        string
+	}{
+		{"GET", "/api/users/1", 200, `{"id":1,"name":"Jane","nickname":null}`, ""},
+		{"GET", "/api/users/1", 200, `{"id":"1","name":"Jane"}`, "id"},
+		{"GET", "/api/users/1", 200, `{"id":1}`, "name"},
+		{"GET", "/api/users/me", 200, `"jane"`, ""},
+		{"GET", "/api/users/1", 404, `{"message":"not found"}`, ""},
+		{"GET", "/api/users/1", 404, `{}`, "message"},
+		{"GET", "/api/users/1", 500, `{}`, "response"},
+		{"POST", "/api/users/1", 200, `{}`, "response"},
+		{"GET", "/api/orders", 200, `{}`, "response"},
+		{"DELETE", "/api/users", 204, `null`, ""},
+	}
+	for _, test := range tests {
+		errs, err := api.ValidateResponse(httptest.NewRequest(test.method, test.path, nil), test.status, []byte(test.body))
+		if err != nil {
+			t.Errorf("%s %s: %v", test.method, test.path, err)
+			continue
+		}
+		if (test.field == "" && len(errs) > 0) || (test.field != "" && errs.Get(test.field) == "") {
+			t.Errorf("%s %s %d %s: expected an error for %q, got %v", test.method, test.path, test.status, test.body, test.field, errs)
+		}
+	}
+}
+
+func TestOpenAPI_WriteJSON(t *testing.T) {
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+
+	production, _ := testTools.NewOpenAPI(testOpenAPISpec)
+	development, err := testTools.NewOpenAPI(testOpenAPISpec, OpenAPIOptions{Development: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrong := map[string]any{"id": "1"}
+
+	rr := httptest.NewRecorder()
+	_ = production.WriteJSON(rr, httptest.NewRequest("GET", "/users/1", nil), http.StatusOK, wrong)
+	if rr.Code != http.StatusOK {
+		t.Error("expected responses not to be checked in production, got", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	_ = development.WriteJSON(rr, httptest.NewRequest("GET", "/users/1", nil), http.StatusOK, wrong)
+	var payload JSONResponse
+	if rr.Code != http.StatusInternalServerError || json.Unmarshal(rr.Body.Bytes(), &payload) != nil || payload.Data == nil {
+		t.Error("expected the violations with a 500 status code", rr.Code, rr.Body.String())
+	}
+	if !logger.contains("ERROR response does not match OpenAPI spec") {
+		t.Error("expected the violations to be logged")
+	}
+
+	rr = httptest.NewRecorder()
+	_ = development.WriteJSON(rr, httptest.NewRequest("GET", "/users/1", nil), http.StatusOK, map[string]any{"id": 1, "name": "Jane"})
+	if rr.Code != http.StatusOK {
+		t.Error("expected a valid response to be sent, got", rr.Code, rr.Body.String())
+	}
+
+	if _, err = testTools.NewOpenAPI([]byte("openapi: 3.1.0\n"), OpenAPIOptions{Development: true}); !errors.Is(err, ErrOpenAPIYAML) {
+		t.Error("expected ErrOpenAPIYAML, got", err)
+	}
+	if _, err = testTools.NewOpenAPI([]byte(`{"paths":{"/a":{"get":{"responses":{"200":{"content":{"application/json":{"schema":{"$ref":"#/nowhere"}}}}}}}}}`)); !errors.Is(err, ErrInvalidSchema) {
+		t.Error("expected ErrInvalidSchema, got", err)
+	}
+}
+
+func TestOpenAPI_Handlers(t *testing.T) {
+	var testTools Tools
+	api, _ := testTools.NewOpenAPI(testOpenAPISpec)
+
+	rr := httptest.NewRecorder()
+	api.SpecHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" || rr.Body.String() != string(testOpenAPISpec) {
+		t.Error("wrong spec response", rr.Code, rr.Header())
+	}
+
+	yaml, _ := testTools.NewOpenAPI([]byte("openapi: 3.1.0\n"))
+	rr = httptest.NewRecorder()
+	yaml.SpecHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/openapi.yaml", nil))
+	if rr.Header().Get("Content-Type") != "application/yaml" {
+		t.Error("wrong content type", rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	api.SwaggerUIHandler("/openapi.json?v=\"1\"").ServeHTTP(rr, httptest.NewRequest("GET", "/docs", nil))
+	body := rr.Body.String()
+	if !strings.Contains(body, "https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js") || !strings.Contains(body, `url: "/openapi.json?v=\"1\""`) {
+		t.Error("wrong Swagger UI page", body)
+	}
+}
@@ -0,0 +1,254 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrURLNotAllowed is returned for URLs whose scheme or host an OutboundPolicy doesn't allow.
+var ErrURLNotAllowed = errors.New("the URL is not allowed")
+
+// deniedNets are the ranges outbound requests never reach, unless an OutboundPolicy allows them:
+// those of IsPrivateIP, along with shared (carrier-grade NAT), reserved, documentation, benchmarking
+// and multicast ranges. Cloud metadata services, such as 169.254.169.254, 100.100.100.200 and
+// fd00:ec2::254, are within them.
+var deniedNets = parseCIDRs([]string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+})
+
+// OutboundPolicy is the type used to configure which URLs ValidateOutboundURL, and the remote calls
+// of Tools, allow. The zero value allows http and https URLs leading to public internet addresses.
+type OutboundPolicy struct {
+	// Schemes are the URL schemes allowed. Defaults to http and https.
+	Schemes []string
+	// AllowedHosts, if set, are the only hosts allowed. An entry starting with a dot, such as
+	// .example.com, allows every subdomain of the name.
+	AllowedHosts []string
+	// AllowedCIDRs are ranges allowed although they are not public, such as that of an internal
+	// service. Each entry may be a CIDR block or a single address.
+	AllowedCIDRs []string
+	// DeniedCIDRs are ranges refused on top of those which are not public.
+	DeniedCIDRs []string
+	// Resolver looks host names up. Defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+}
+
+// ValidateOutboundURL checks that rawURL, such as a webhook or an avatar URL supplied by a user, is
+// allowed by policy, so that the server can't be made to reach its own network or a cloud metadata
+// service. Host names are resolved, and every address they resolve to must be a public internet
+// address, or else ErrPrivateAddress is returned; schemes and hosts which are not allowed return
+// ErrURLNotAllowed.
+//
+// Names may resolve differently by the time the request is made, so the client making it should
+// also use the transport of OutboundPolicy.Client, which checks the addresses it connects to.
+func ValidateOutboundURL(rawURL string, policy OutboundPolicy) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	if err = policy.checkURL(u); err != nil {
+		return err
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !policy.allowsIP(ip) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+		}
+		return nil
+	}
+
+	resolver := policy.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !policy.allowsIP(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrPrivateAddress, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// Client returns a client which only connects to the addresses policy allows, checked once names
+// are resolved, so that DNS can't lead it elsewhere, and which only follows redirects to URLs policy
+// allows. It ignores proxies. Each call creates a new transport, with its own pool of connections, so
+// the client should be kept and reused.
+func (p OutboundPolicy) Client() *http.Client {
+	return &http.Client{
+		Transport: p.transport(),
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("too many redirects")
+			}
+			return p.checkURL(r.URL)
+		},
+	}
+}
+
+// checkURL returns ErrURLNotAllowed if the scheme or the host of u is not allowed, leaving the
+// addresses of the host to be checked.
+func (p OutboundPolicy) checkURL(u *url.URL) error {
+	schemes := p.Schemes
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+	allowed := false
+	for _, scheme := range schemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: scheme %q", ErrURLNotAllowed, u.Scheme)
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return fmt.Errorf("%w: no host", ErrURLNotAllowed)
+	}
+	// names such as 2130706433 or 0x7f.1 are read as addresses by some resolvers
+	if net.ParseIP(host) == nil && isNumericHost(host) {
+		return fmt.Errorf("%w: host %q", ErrURLNotAllowed, host)
+	}
+	if len(p.AllowedHosts) == 0 {
+		return nil
+	}
+	for _, allowedHost := range p.AllowedHosts {
+		allowedHost = strings.ToLower(allowedHost)
+		if host == allowedHost || (strings.HasPrefix(allowedHost, ".") && strings.HasSuffix(host, allowedHost)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %q", ErrURLNotAllowed, host)
+}
+
+// allowsIP reports whether policy allows connecting to ip.
+func (p OutboundPolicy) allowsIP(ip net.IP) bool {
+	address := ip.String()
+	if ipInNets(address, parseCIDRs(p.AllowedCIDRs)) {
+		return true
+	}
+	return !ipInNets(address, deniedNets) && !ipInNets(address, parseCIDRs(p.DeniedCIDRs))
+}
+
+// transport returns a transport which only connects to the addresses policy allows, and which
+// ignores proxies.
+func (p OutboundPolicy) transport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !p.allowsIP(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+			}
+			return nil
+		},
+	}
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+}
+
+// isNumericHost reports whether the last label of host is a decimal or 0x hexadecimal number, which
+// no top-level domain is.
+func isNumericHost(host string) bool {
+	label := host[strings.LastIndexByte(host, '.')+1:]
+	digits := "0123456789"
+	if strings.HasPrefix(label, "0x") {
+		label, digits = label[2:], "0123456789abcdef"
+	}
+	return label != "" && strings.Trim(label, digits) == ""
+}
+
+// outboundClient returns client, or, if t.OutboundPolicy is set, a client which only connects to the
+// addresses it allows in place of a default one.
+func (t *Tools) outboundClient(client []*http.Client) *http.Client {
+	if len(client) > 0 {
+		return client[0]
+	}
+	if t.OutboundPolicy != nil {
+		return t.policyClient()
+	}
+	return &http.Client{}
+}
+
+// timeoutClient returns a client with timeout, which follows Tools.OutboundPolicy, if set, as the default
+// client of the features sending requests to URLs of their own.
+func (t *Tools) timeoutClient(timeout time.Duration) *http.Client {
+	client := http.Client{}
+	if t.OutboundPolicy != nil {
+		client = *t.policyClient()
+	}
+	client.Timeout = timeout
+	return &client
+}
+
+// policyClient returns the client of t.OutboundPolicy, or of the zero OutboundPolicy if it is not set,
+// which is created once per policy, so that its connections are reused rather than leaked with a new
+// transport on every call.
+func (t *Tools) policyClient() *http.Client {
+	t.outboundMu.Lock()
+	defer t.outboundMu.Unlock()
+	if t.outboundHTTP == nil || t.outboundFor != t.OutboundPolicy {
+		var policy OutboundPolicy
+		if t.OutboundPolicy != nil {
+			policy = *t.OutboundPolicy
+		}
+		t.outboundFor, t.outboundHTTP = t.OutboundPolicy, policy.Client()
+	}
+	return t.outboundHTTP
+}
+
+// checkOutbound validates uri with t.OutboundPolicy, if set, logging refused URLs.
+func (t *Tools) checkOutbound(uri string) error {
+	if t.OutboundPolicy == nil {
+		return nil
+	}
+	if err := ValidateOutboundURL(uri, *t.OutboundPolicy); err != nil {
+		t.logger().Warn("outbound request refused", "url", uri, "err", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestValidateOutboundURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		policy OutboundPolicy
+		err    error
+	}{
+		{name: "public", url: "https://93.184.216.34/hook"},
+		{name: "loopback", url: "http://127.0.0.1:8080/", err: ErrPrivateAddress},
+		{name: "localhost", url: "http://localhost/", err: ErrPrivateAddress},
+		{name: "private", url: "http://10.1.2.3/", err: ErrPrivateAddress},
+		{name: "metadata", url: "http://169.254.169.254/latest/meta-data/", err: ErrPrivateAddress},
+		{name: "shared", url: "http://100.100.100.200/", err: ErrPrivateAddress},
+		{name: "ipv6 loopback", url: "http://[::1]/", err: ErrPrivateAddress},
+		{name: "ipv4 mapped", url: "http://[::ffff:127.0.0.1]/", err: ErrPrivateAddress},
+		{name: "unique local", url: "http://[fd00:ec2::254]/", err: ErrPrivateAddress},
+		{name: "decimal host", url: "http://2130706433/", err: ErrURLNotAllowed},
+		{name: "hex host", url: "http://0x7f.1/", err: ErrURLNotAllowed},
+		{name: "scheme", url: "file:///etc/passwd", err: ErrURLNotAllowed},
+		{name: "gopher", url: "gopher://93.184.216.34/", err: ErrURLNotAllowed},
+		{name: "no host", url: "http:///path", err: ErrURLNotAllowed},
+		{name: "host not allowed", url: "https://93.184.216.34/", policy: OutboundPolicy{AllowedHosts: []string{".example.com"}}, err: ErrURLNotAllowed},
+		{name: "allowed cidr", url: "http://10.1.2.3/", policy: OutboundPolicy{AllowedCIDRs: []string{"10.1.0.0/16"}}},
+		{name: "denied cidr", url: "https://93.184.216.34/", policy: OutboundPolicy{DeniedCIDRs: []string{"93.184.216.0/24"}}, err: ErrPrivateAddress},
+		{name: "scheme allowed", url: "ftp://93.184.216.34/", policy: OutboundPolicy{Schemes: []string{"ftp"}}},
+	}
+	for _, test := range tests {
+		if err := ValidateOutboundURL(test.url, test.policy); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+
+	check := func(policy OutboundPolicy, host string) error {
+		u, _ := url.Parse("https://" + host + "/")
+		return policy.checkURL(u)
+	}
+	policy := OutboundPolicy{AllowedHosts: []string{"example.com", ".example.org"}}
+	for _, host := range []string{"example.com", "EXAMPLE.com.", "api.example.org"} {
+		if err := check(policy, host); err != nil {
+			t.Errorf("expected %s to be allowed, got %v", host, err)
+		}
+	}
+	for _, host := range []string{"api.example.com", "example.org", "notexample.org"} {
+		if err := check(policy, host); !errors.Is(err, ErrURLNotAllowed) {
+			t.Errorf("expected %s not to be allowed, got %v", host, err)
+		}
+	}
+}
+
+func TestTools_OutboundPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://localhost/", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger, OutboundPolicy: &OutboundPolicy{}}
+	if _, _, err := testTools.PushJSONToRemote(server.URL, map[string]int{"a": 1}); !errors.Is(err, ErrPrivateAddress) {
+		t.Error("expected ErrPrivateAddress, got", err)
+	}
+	var target struct{ OK bool }
+	if _, err := testTools.GetJSONFromRemote(server.URL, &target); !errors.Is(err, ErrPrivateAddress) {
+		t.Error("expected ErrPrivateAddress, got", err)
+	}
+	if !logger.contains("WARN outbound request refused") {
+		t.Error("expected the refused request to be logged")
+	}
+	if testTools.outboundClient(nil) != testTools.outboundClient(nil) {
+		t.Error("expected the client of the policy to be reused")
+	}
+
+	// the server's address is allowed, but not the name it redirects to
+	first := testTools.outboundClient(nil)
+	testTools.OutboundPolicy = &OutboundPolicy{AllowedCIDRs: []string{"127.0.0.1"}, AllowedHosts: []string{"127.0.0.1"}}
+	if testTools.outboundClient(nil) == first {
+		t.Error("expected a new client for a new policy")
+	}
+	if _, err := testTools.GetJSONFromRemote(server.URL, &target); err != nil || !target.OK {
+		t.Errorf("expected the allowed request to succeed, got %v", err)
+	}
+	if _, _, err := testTools.PushJSONToRemote(server.URL+"/redirect", nil); !errors.Is(err, ErrURLNotAllowed) {
+		t.Error("expected the redirect to be refused, got", err)
+	}
+}
@@ -0,0 +1,242 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrPrivateAddress is returned for URLs which lead to addresses which are not public internet
+	// addresses, such as those of the local network or of cloud metadata services.
+	ErrPrivateAddress = errors.New("the URL does not lead to a public internet address")
+	// ErrNotHTML is returned by FetchPageMetadata for pages which are not HTML documents.
+	ErrNotHTML = errors.New("the page is not an HTML document")
+)
+
+// PageMetadata is what FetchPageMetadata finds about a page, for link previews.
+type PageMetadata struct {
+	// URL is the URL of the page, after redirects.
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Image is the URL of the image of the page, from og:image or twitter:image.
+	Image    string `json:"image,omitempty"`
+	SiteName string `json:"site_name,omitempty"`
+	// Favicon is the URL of the icon of the site, /favicon.ico if the page names none.
+	Favicon string `json:"favicon,omitempty"`
+	// CanonicalURL is the URL the page names as its own, or URL.
+	CanonicalURL string `json:"canonical_url"`
+}
+
+// PageMetadataOptions is the type used to configure FetchPageMetadata.
+type PageMetadataOptions struct {
+	// MaxSize is the largest number of bytes of the page read. Defaults to 1MB.
+	MaxSize int64
+	// Timeout is how long fetching the page may take, redirects included. Defaults to 10 seconds.
+	Timeout time.Duration
+	// UserAgent is the User-Agent header sent. Defaults to "Mozilla/5.0 (compatible; toolkit link preview)".
+	UserAgent string
+	// Client, if set, is the client used instead of one which only connects to public internet
+	// addresses. It is meant for tests.
+	Client *http.Client
+}
+
+// FetchPageMetadata downloads the page at rawURL, such as a link pasted in a message, and returns its
+// title, description, image, favicon and canonical URL, from its Open Graph and Twitter card tags, or
+// else its standard ones. Only http and https URLs are fetched, redirects included, and only from public
+// internet addresses, checked once their names are resolved, or ErrPrivateAddress is returned, so that
+// users can't make the server reach its own network. Tools.OutboundPolicy, if set, is followed instead,
+// such as to allow some hosts only. Pages which are not HTML return ErrNotHTML.
+func (t *Tools) FetchPageMetadata(ctx context.Context, rawURL string, opts ...PageMetadataOptions) (*PageMetadata, error) {
+	var options PageMetadataOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.MaxSize <= 0 {
+		options.MaxSize = 1024 * 1024 // 1MB
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+	if options.UserAgent == "" {
+		options.UserAgent = "Mozilla/5.0 (compatible; toolkit link preview)"
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid page URL %q", rawURL)
+	}
+	var policy OutboundPolicy
+	if t.OutboundPolicy != nil {
+		policy = *t.OutboundPolicy
+	}
+	if err = policy.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	client := options.Client
+	if client == nil {
+		client = t.policyClient()
+	}
+	limited := *client
+	limited.Timeout = options.Timeout
+	limited.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		if r.URL.Scheme != "http" && r.URL.Scheme != "https" {
+			return fmt.Errorf("invalid redirect to %q", r.URL)
+		}
+		return policy.checkURL(r.URL)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", options.UserAgent)
+	request.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	response, err := limited.Do(request)
+	if err != nil {
+		if errors.Is(err, ErrPrivateAddress) {
+			t.logger().Warn("page on a private address not fetched", "url", rawURL)
+			return nil, ErrPrivateAddress
+		}
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("fetching %s: status %d", rawURL, response.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, options.MaxSize))
+	if err != nil {
+		return nil, err
+	}
+	return parsePageMetadata(string(body), response.Request.URL), nil
+}
+
+// parsePageMetadata returns the metadata found in the head of the HTML document doc, served at base.
+func parsePageMetadata(doc string, base *url.URL) *PageMetadata {
+	var title, canonical, icon, shortcutIcon, touchIcon string
+	meta := make(map[string]string)
+
+	for {
+		i := strings.IndexByte(doc, '<')
+		if i < 0 {
+			break
+		}
+		doc = doc[i:]
+		if strings.HasPrefix(doc, "<!--") {
+			doc = skipPast(doc, "-->")
+			continue
+		}
+		if strings.HasPrefix(doc, "</") || strings.HasPrefix(doc, "<!") || strings.HasPrefix(doc, "<?") {
+			doc = skipPast(doc, ">")
+			continue
+		}
+
+		tag, rest, ok := parseHTMLTag(doc[1:])
+		if !ok {
+			doc = doc[1:]
+			continue
+		}
+		doc = rest
+
+		attrs := make(map[string]string, len(tag.attrs))
+		for _, attr := range tag.attrs {
+			attrs[attr.name] = attr.value
+		}
+
+		switch tag.name {
+		case "body":
+			doc = ""
+		case "title":
+			end := strings.Index(strings.ToLower(doc), "</title")
+			if end < 0 {
+				end = len(doc)
+			}
+			if title == "" {
+				title = NormalizeWhitespace(html.UnescapeString(doc[:end]))
+			}
+			doc = doc[end:]
+		case "script", "style", "noscript", "template":
+			doc = skipPastEndTag(doc, tag.name)
+		case "base":
+			if href, err := base.Parse(attrs["href"]); err == nil && attrs["href"] != "" {
+				base = href
+			}
+		case "meta":
+			key := strings.ToLower(attrs["property"])
+			if key == "" {
+				key = strings.ToLower(attrs["name"])
+			}
+			if _, seen := meta[key]; key != "" && !seen {
+				meta[key] = strings.TrimSpace(attrs["content"])
+			}
+		case "link":
+			href := strings.TrimSpace(attrs["href"])
+			for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+				switch rel {
+				case "canonical":
+					canonical = firstNonEmpty(canonical, href)
+				case "icon":
+					icon = firstNonEmpty(icon, href)
+				case "shortcut":
+					shortcutIcon = firstNonEmpty(shortcutIcon, href)
+				case "apple-touch-icon":
+					touchIcon = firstNonEmpty(touchIcon, href)
+				}
+			}
+		}
+	}
+
+	resolve := func(ref string) string {
+		if ref == "" {
+			return ""
+		}
+		u, err := base.Parse(ref)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return ""
+		}
+		return u.String()
+	}
+
+	metadata := &PageMetadata{
+		URL:          base.String(),
+		Title:        firstNonEmpty(meta["og:title"], meta["twitter:title"], title),
+		Description:  firstNonEmpty(meta["og:description"], meta["description"], meta["twitter:description"]),
+		Image:        resolve(firstNonEmpty(meta["og:image:secure_url"], meta["og:image"], meta["og:image:url"], meta["twitter:image"], meta["twitter:image:src"])),
+		SiteName:     meta["og:site_name"],
+		Favicon:      resolve(firstNonEmpty(icon, shortcutIcon, touchIcon, "/favicon.ico")),
+		CanonicalURL: resolve(firstNonEmpty(canonical, meta["og:url"])),
+	}
+	if metadata.CanonicalURL == "" {
+		metadata.CanonicalURL = metadata.URL
+	}
+	return metadata
+}
+
+// firstNonEmpty returns the first of values which is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTools_FetchPageMetadata(t *testing.T) {
+	pages := map[string]string{
+		"https://example.com/og": `<!doctype html><html><head>
+			<title>Plain &amp; simple</title>
+			<meta property="og:title" content="Open Graph title">
+			<meta name="description" content="A description">
+			<meta property="og:image" content="/images/cover.png">
+			<meta property="og:site_name" content="Example">
+			<link rel="shortcut icon" href="/static/favicon.png">
+			<link rel="canonical" href="https://example.com/articles/1">
+			<script>var title = "<title>not this</title>";</script>
+			</head><body><meta property="og:description" content="ignored"></body></html>`,
+		"https://example.com/plain": `<html><head><!-- <title>not this</title> --><title>
+			Just a   title</title><base href="https://cdn.example.com/">
+			<meta name="twitter:image" content="img.jpg"></head></html>`,
+	}
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		if req.URL.Path == "/redirect" {
+			return &http.Response{StatusCode: http.StatusFound, Header: http.Header{"Location": {"/og"}}, Body: io.NopCloser(strings.NewReader("")), Request: req}
+		}
+		page, ok := pages[req.URL.String()]
+		if !ok {
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"application/pdf"}}, Body: io.NopCloser(strings.NewReader("%PDF")), Request: req}
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"text/html; charset=utf-8"}}, Body: io.NopCloser(bytes.NewBufferString(page)), Request: req}
+	})
+
+	var testTools Tools
+	metadata, err := testTools.FetchPageMetadata(context.Background(), "https://example.com/redirect", PageMetadataOptions{Client: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := PageMetadata{
+		URL:          "https://example.com/og",
+		Title:        "Open Graph title",
+		Description:  "A description",
+		Image:        "https://example.com/images/cover.png",
+		SiteName:     "Example",
+		Favicon:      "https://example.com/static/favicon.png",
+		CanonicalURL: "https://example.com/articles/1",
+	}
+	if *metadata != expected {
+		t.Errorf("expected %+v, got %+v", expected, *metadata)
+	}
+
+	metadata, err = testTools.FetchPageMetadata(context.Background(), "https://example.com/plain", PageMetadataOptions{Client: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = PageMetadata{
+		URL:          "https://cdn.example.com/",
+		Title:        "Just a title",
+		Image:        "https://cdn.example.com/img.jpg",
+		Favicon:      "https://cdn.example.com/favicon.ico",
+		CanonicalURL: "https://cdn.example.com/",
+	}
+	if *metadata != expected {
+		t.Errorf("expected %+v, got %+v", expected, *metadata)
+	}
+
+	if _, err = testTools.FetchPageMetadata(context.Background(), "https://example.com/file.pdf", PageMetadataOptions{Client: client}); !errors.Is(err, ErrNotHTML) {
+		t.Error("expected ErrNotHTML, got", err)
+	}
+	if _, err = testTools.FetchPageMetadata(context.Background(), "file:///etc/passwd"); err == nil {
+		t.Error("expected an error for a file URL")
+	}
+}
+
+func TestTools_FetchPageMetadata_PrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<title>internal</title>"))
+	}))
+	defer server.Close()
+
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+	if _, err := testTools.FetchPageMetadata(context.Background(), server.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Error("expected ErrPrivateAddress, got", err)
+	}
+	if !logger.contains("WARN page on a private address not fetched") {
+		t.Error("expected the refused fetch to be logged")
+	}
+
+	// the default client, and its connections, are kept for the next fetches
+	client := testTools.policyClient()
+	_, _ = testTools.FetchPageMetadata(context.Background(), server.URL)
+	if testTools.policyClient() != client {
+		t.Error("expected the default client to be reused")
+	}
+}
@@ -0,0 +1,220 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned by DecodeCursor when a cursor is malformed or has been tampered with.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Paginator is the type used to read pagination parameters from requests.
+// Clients may use page and per_page, limit and offset, or an opaque cursor.
+type Paginator struct {
+	// DefaultPerPage is the page size used when none is requested. Defaults to 20.
+	DefaultPerPage int
+	// MaxPerPage is the largest page size a client may request. Defaults to 100.
+	MaxPerPage int
+}
+
+// Page describes the slice of results requested by a client.
+type Page struct {
+	Page    int
+	PerPage int
+	Offset  int
+	Cursor  string
+
+	useOffset bool
+	url       url.URL
+}
+
+// Pagination is the pagination information sent along with a page of results.
+type Pagination struct {
+	Total   int    `json:"total,omitempty"`
+	Page    int    `json:"page,omitempty"`
+	PerPage int    `json:"per_page"`
+	Pages   int    `json:"pages,omitempty"`
+	Next    string `json:"next,omitempty"`
+	Prev    string `json:"prev,omitempty"`
+}
+
+// PaginatedResponse is the standard envelope for a page of results, ready to be sent with WriteJSON.
+type PaginatedResponse struct {
+	Data       any        `json:"data"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// Parse reads the pagination parameters of r, clamping them to sensible values.
+// An error is only returned when a parameter is not a number.
+func (p *Paginator) Parse(r *http.Request) (*Page, error) {
+	defaultPerPage, maxPerPage := p.DefaultPerPage, p.MaxPerPage
+	if maxPerPage <= 0 {
+		maxPerPage = 100
+	}
+	if defaultPerPage <= 0 {
+		defaultPerPage = 20
+	}
+	if defaultPerPage > maxPerPage {
+		defaultPerPage = maxPerPage
+	}
+
+	q := NewQuery(r)
+	page := &Page{url: *r.URL}
+
+	_, hasLimit := q.Values["limit"]
+	_, hasOffset := q.Values["offset"]
+	page.useOffset = hasLimit || hasOffset
+
+	if page.useOffset {
+		page.PerPage = q.Int("limit", defaultPerPage)
+		page.Offset = q.Int("offset", 0)
+	} else {
+		page.PerPage = q.Int("per_page", defaultPerPage)
+		page.Page = q.Int("page", 1)
+	}
+	page.Cursor = q.String("cursor", "")
+
+	if err := q.Err(); err != nil {
+		return nil, err
+	}
+
+	if page.PerPage <= 0 {
+		page.PerPage = defaultPerPage
+	}
+	if page.PerPage > maxPerPage {
+		page.PerPage = maxPerPage
+	}
+
+	if page.useOffset {
+		if page.Offset < 0 {
+			page.Offset = 0
+		}
+		page.Page = page.Offset/page.PerPage + 1
+	} else {
+		if page.Page < 1 {
+			page.Page = 1
+		}
+		page.Offset = (page.Page - 1) * page.PerPage
+	}
+
+	return page, nil
+}
+
+// Limit returns the maximum number of results to fetch, which is the page size.
+func (pg *Page) Limit() int {
+	return pg.PerPage
+}
+
+// Result wraps data, one page out of total results, in a PaginatedResponse with links to the next and previous pages.
+func (pg *Page) Result(data any, total int) PaginatedResponse {
+	pagination := Pagination{
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+		Pages:   (total + pg.PerPage - 1) / pg.PerPage,
+	}
+
+	if pg.Offset+pg.PerPage < total {
+		pagination.Next = pg.link(pg.Offset+pg.PerPage, pg.Page+1)
+	}
+	if pg.Offset > 0 {
+		prevOffset := pg.Offset - pg.PerPage
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		pagination.Prev = pg.link(prevOffset, pg.Page-1)
+	}
+
+	return PaginatedResponse{Data: data, Pagination: pagination}
+}
+
+// CursorResult wraps data in a PaginatedResponse for cursor based pagination, where nextCursor identifies
+// the following page. An empty nextCursor means this is the last page.
+func (pg *Page) CursorResult(data any, nextCursor string) PaginatedResponse {
+	pagination := Pagination{PerPage: pg.PerPage}
+
+	if nextCursor != "" {
+		u := pg.url
+		values := u.Query()
+		values.Set("cursor", nextCursor)
+		values.Del("page")
+		values.Del("offset")
+		u.RawQuery = values.Encode()
+		pagination.Next = u.RequestURI()
+	}
+
+	return PaginatedResponse{Data: data, Pagination: pagination}
+}
+
+// link returns the request URI for another page, in the same style (offset or page) as the current request.
+func (pg *Page) link(offset, page int) string {
+	u := pg.url
+	values := u.Query()
+	if pg.useOffset {
+		values.Set("offset", strconv.Itoa(offset))
+		values.Set("limit", strconv.Itoa(pg.PerPage))
+	} else {
+		values.Set("page", strconv.Itoa(page))
+		values.Set("per_page", strconv.Itoa(pg.PerPage))
+	}
+	u.RawQuery = values.Encode()
+	return u.RequestURI()
+}
+
+// EncodeCursor turns data, typically the sort key of the last row of a page, into an opaque cursor for keyset pagination.
+// The cursor is signed with Tools.CursorKey, so that clients can neither forge nor modify it.
+func (t *Tools) EncodeCursor(data any) (string, error) {
+	if len(t.CursorKey) == 0 {
+		return "", errors.New("no cursor key set")
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(t.signCursor(encoded)), nil
+}
+
+// DecodeCursor verifies a cursor created by EncodeCursor, and decodes its content into data.
+// It returns ErrInvalidCursor if the cursor is malformed or its signature doesn't match.
+func (t *Tools) DecodeCursor(token string, data any) error {
+	if len(t.CursorKey) == 0 {
+		return errors.New("no cursor key set")
+	}
+
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return ErrInvalidCursor
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, t.signCursor(encoded)) {
+		return ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	if err = json.Unmarshal(payload, data); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// signCursor returns the HMAC-SHA256 of an encoded cursor payload.
+func (t *Tools) signCursor(encoded string) []byte {
+	mac := hmac.New(sha256.New, t.CursorKey)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,129 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var paginatorTests = []struct {
+	name            string
+	url             string
+	expectedPage    int
+	expectedPerPage int
+	expectedOffset  int
+	errorExpected   bool
+}{
+	{name: "defaults", url: "/items", expectedPage: 1, expectedPerPage: 20, expectedOffset: 0},
+	{name: "page", url: "/items?page=3&per_page=10", expectedPage: 3, expectedPerPage: 10, expectedOffset: 20},
+	{name: "clamped per page", url: "/items?page=2&per_page=1000", expectedPage: 2, expectedPerPage: 50, expectedOffset: 50},
+	{name: "negative page", url: "/items?page=-4", expectedPage: 1, expectedPerPage: 20, expectedOffset: 0},
+	{name: "limit and offset", url: "/items?limit=10&offset=35", expectedPage: 4, expectedPerPage: 10, expectedOffset: 35},
+	{name: "invalid page", url: "/items?page=abc", errorExpected: true},
+}
+
+func TestPaginator_Parse(t *testing.T) {
+	paginator := Paginator{MaxPerPage: 50}
+
+	for _, test := range paginatorTests {
+		page, err := paginator.Parse(httptest.NewRequest("GET", test.url, nil))
+		if test.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected, but none received", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", test.name, err)
+			continue
+		}
+
+		if page.Page != test.expectedPage || page.PerPage != test.expectedPerPage || page.Offset != test.expectedOffset {
+			t.Errorf("%s: expected page %d, per page %d, offset %d but got %d, %d, %d", test.name,
+				test.expectedPage, test.expectedPerPage, test.expectedOffset, page.Page, page.PerPage, page.Offset)
+		}
+	}
+}
+
+func TestPage_Result(t *testing.T) {
+	var paginator Paginator
+
+	page, _ := paginator.Parse(httptest.NewRequest("GET", "/items?page=2&per_page=10&sort=name", nil))
+	result := page.Result([]int{1, 2, 3}, 45)
+
+	if result.Pagination.Pages != 5 || result.Pagination.Total != 45 {
+		t.Errorf("wrong pagination %+v", result.Pagination)
+	}
+	if result.Pagination.Next != "/items?page=3&per_page=10&sort=name" {
+		t.Error("wrong next link", result.Pagination.Next)
+	}
+	if result.Pagination.Prev != "/items?page=1&per_page=10&sort=name" {
+		t.Error("wrong prev link", result.Pagination.Prev)
+	}
+
+	page, _ = paginator.Parse(httptest.NewRequest("GET", "/items?limit=10&offset=40", nil))
+	result = page.Result(nil, 45)
+	if result.Pagination.Next != "" {
+		t.Error("expected no next link on the last page, but got", result.Pagination.Next)
+	}
+	if result.Pagination.Prev != "/items?limit=10&offset=30" {
+		t.Error("wrong prev link", result.Pagination.Prev)
+	}
+}
+
+func TestPage_CursorResult(t *testing.T) {
+	var paginator Paginator
+
+	page, _ := paginator.Parse(httptest.NewRequest("GET", "/items?cursor=abc&per_page=5", nil))
+	if page.Cursor != "abc" {
+		t.Error("wrong cursor", page.Cursor)
+	}
+
+	result := page.CursorResult(nil, "def")
+	if result.Pagination.Next != "/items?cursor=def&per_page=5" {
+		t.Error("wrong next link", result.Pagination.Next)
+	}
+
+	if result = page.CursorResult(nil, ""); result.Pagination.Next != "" {
+		t.Error("expected no next link, but got", result.Pagination.Next)
+	}
+}
+
+func TestTools_EncodeDecodeCursor(t *testing.T) {
+	testTools := Tools{CursorKey: []byte("a very secret key")}
+
+	type position struct {
+		ID        int    `json:"id"`
+		CreatedAt string `json:"created_at"`
+	}
+
+	cursor, err := testTools.EncodeCursor(position{ID: 42, CreatedAt: "2022-10-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded position
+	if err = testTools.DecodeCursor(cursor, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ID != 42 || decoded.CreatedAt != "2022-10-01" {
+		t.Errorf("wrong cursor decoded %+v", decoded)
+	}
+
+	// tampering with the payload is detected
+	forged, _ := (&Tools{CursorKey: []byte("another key")}).EncodeCursor(position{ID: 1})
+	payload, _, _ := strings.Cut(forged, ".")
+	_, signature, _ := strings.Cut(cursor, ".")
+
+	for _, bad := range []string{payload + "." + signature, forged, "garbage", ""} {
+		if err = testTools.DecodeCursor(bad, &decoded); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("expected ErrInvalidCursor for %q, but got %v", bad, err)
+		}
+	}
+
+	var noKey Tools
+	if _, err = noKey.EncodeCursor(1); err == nil {
+		t.Error("error expected without a cursor key, but none received")
+	}
+}
@@ -0,0 +1,69 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// JSONFields is the set of keys present in a JSON body, as returned by ReadJSONPartial. The keys of
+// nested objects are joined to their parent's with dots, such as address.city.
+type JSONFields map[string]bool
+
+// Has reports whether the key name was present in the body, even if it was null or a zero value.
+func (f JSONFields) Has(name string) bool {
+	return f[name]
+}
+
+// Names returns the keys present in the body, sorted.
+func (f JSONFields) Names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadJSONPartial is ReadJSON, also returning the keys present in the body, so that handlers applying
+// partial updates can tell a field which was omitted from one which was set to its zero value:
+//
+//	fields, err := tools.ReadJSONPartial(w, r, &input)
+//	if fields.Has("nickname") {
+//		// set the nickname column, even to an empty string
+//	}
+func (t *Tools) ReadJSONPartial(w http.ResponseWriter, r *http.Request, data any) (JSONFields, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, t.maxJSONSize())
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if tooLarge := asBodyTooLarge(err); tooLarge != nil {
+			err = tooLarge
+		}
+		t.logger().Debug("invalid JSON body", "method", r.Method, "path", r.URL.Path, "err", err)
+		return nil, err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err = t.ReadJSON(w, r, data); err != nil {
+		return nil, err
+	}
+
+	fields := make(JSONFields)
+	collectJSONFields(body, "", fields)
+	return fields, nil
+}
+
+// collectJSONFields adds the keys of the JSON object raw, and of the objects nested in it, to fields,
+// prefixed with prefix.
+func collectJSONFields(raw []byte, prefix string, fields JSONFields) {
+	var object map[string]json.RawMessage
+	if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) || json.Unmarshal(raw, &object) != nil {
+		return
+	}
+	for key, value := range object {
+		fields[prefix+key] = true
+		collectJSONFields(value, prefix+key+".", fields)
+	}
+}
@@ -0,0 +1,46 @@
+package toolkit
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTools_ReadJSONPartial(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+		Zip  string `json:"zip"`
+	}
+	type input struct {
+		Name     string   `json:"name"`
+		Nickname *string  `json:"nickname"`
+		Age      int      `json:"age"`
+		Address  address  `json:"address"`
+		Tags     []string `json:"tags"`
+	}
+
+	var testTools Tools
+	request := httptest.NewRequest("PATCH", "/", strings.NewReader(`{"nickname": null, "age": 0, "address": {"city": ""}, "tags": [{"x": 1}]}`))
+	var data input
+	if _, err := testTools.ReadJSONPartial(httptest.NewRecorder(), request, &data); err == nil {
+		t.Fatal("expected the error of ReadJSON for a wrong type")
+	}
+
+	request = httptest.NewRequest("PATCH", "/", strings.NewReader(`{"nickname": null, "age": 0, "address": {"city": ""}, "tags": []}`))
+	fields, err := testTools.ReadJSONPartial(httptest.NewRecorder(), request, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fields.Names(), ","); got != "address,address.city,age,nickname,tags" {
+		t.Error("wrong fields", got)
+	}
+	if !fields.Has("age") || fields.Has("name") || fields.Has("address.zip") {
+		t.Errorf("wrong fields %v", fields)
+	}
+
+	testTools.MaxJSONSize = 8
+	request = httptest.NewRequest("PATCH", "/", strings.NewReader(`{"name": "too long"}`))
+	if _, err = testTools.ReadJSONPartial(httptest.NewRecorder(), request, &data); err == nil || !strings.Contains(err.Error(), "8 bytes") {
+		t.Error("expected a body too large error, got", err)
+	}
+}
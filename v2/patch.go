@@ -0,0 +1,440 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPatch is returned for patches which are not valid, or can't be applied to the document,
+	// such as those naming paths which don't exist, or giving fields values of the wrong type.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrPatchTestFailed is returned when a test operation of a JSON Patch fails.
+	ErrPatchTestFailed = errors.New("patch test failed")
+	// ErrUnsupportedPatch is returned by ReadPatch for bodies which are neither JSON Patch nor JSON Merge
+	// Patch documents.
+	ErrUnsupportedPatch = errors.New("unsupported patch media type")
+)
+
+// jsonPatchOperation is an operation of a JSON Patch document.
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyJSONPatch applies patch, a JSON Patch document (RFC 6902), to the JSON document doc, and returns
+// the patched document. No part of the patch is applied when any of its operations fails: those naming
+// paths which don't exist return ErrInvalidPatch, and failed test operations ErrPatchTestFailed.
+func ApplyJSONPatch(doc []byte, patch []byte) ([]byte, error) {
+	var operations []jsonPatchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	root, err := decodeJSONValue(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, operation := range operations {
+		if root, err = applyPatchOperation(root, operation); err != nil {
+			if errors.Is(err, ErrPatchTestFailed) {
+				return nil, fmt.Errorf("%w: operation %d", err, i)
+			}
+			return nil, fmt.Errorf("%w: operation %d: %v", ErrInvalidPatch, i, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+// ApplyMergePatch applies patch, a JSON Merge Patch document (RFC 7396), to the JSON document doc, and
+// returns the patched document: the fields of patch replace those of doc, recursively for objects, and
+// the fields set to null are removed.
+func ApplyMergePatch(doc []byte, patch []byte) ([]byte, error) {
+	root, err := decodeJSONValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	merge, err := decodeJSONValue(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return json.Marshal(mergePatch(root, merge))
+}
+
+// ReadPatch applies the patch in the body of r to data, a pointer to the current state of a resource,
+// for PATCH endpoints. Bodies of type application/json-patch+json are JSON Patch documents, and those of
+// type application/merge-patch+json or application/json, JSON Merge Patch documents; others return
+// ErrUnsupportedPatch. The patched document must fit data, as ReadJSON requires of bodies, or
+// ErrInvalidPatch is returned and data is left unchanged.
+func (t *Tools) ReadPatch(w http.ResponseWriter, r *http.Request, data any) error {
+	err := t.readPatch(w, r, data)
+	if err != nil {
+		t.logger().Debug("invalid patch", "method", r.Method, "path", r.URL.Path, "err", err)
+	}
+	return err
+}
+
+// readPatch does the work for ReadPatch.
+func (t *Tools) readPatch(w http.ResponseWriter, r *http.Request, data any) error {
+	target := reflect.ValueOf(data)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return errors.New("the data of a patch must be a non-nil pointer")
+	}
+
+	apply := ApplyMergePatch
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json-patch+json":
+		apply = ApplyJSONPatch
+	case "application/merge-patch+json", "application/json", "":
+	default:
+		return ErrUnsupportedPatch
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, t.maxJSONSize())
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		if tooLarge := asBodyTooLarge(err); tooLarge != nil {
+			return tooLarge
+		}
+		return err
+	}
+
+	doc, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	patched, err := apply(doc, patch)
+	if err != nil {
+		return err
+	}
+
+	result := reflect.New(target.Elem().Type())
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	if !t.AllowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err = dec.Decode(result.Interface()); err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+			return fmt.Errorf("%w: incorrect JSON type for field %q", ErrInvalidPatch, unmarshalTypeError.Field)
+		case strings.HasPrefix(err.Error(), "json: unknown field"):
+			return fmt.Errorf("%w: unknown key %s", ErrInvalidPatch, strings.TrimPrefix(err.Error(), "json: unknown field "))
+		default:
+			return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+	}
+
+	target.Elem().Set(result.Elem())
+	return nil
+}
+
+// decodeJSONValue decodes the single JSON value b, keeping numbers as json.Number so that they are not
+// rounded.
+func decodeJSONValue(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("JSON document must contain only one value")
+	}
+	return value, nil
+}
+
+// applyPatchOperation applies operation to root, and returns the new root.
+func applyPatchOperation(root any, operation jsonPatchOperation) (any, error) {
+	if operation.Path == nil {
+		return nil, errors.New("missing path")
+	}
+	path, err := parseJSONPointer(*operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, fmt.Errorf("missing value for %s", operation.Op)
+		}
+		if value, err = decodeJSONValue(operation.Value); err != nil {
+			return nil, err
+		}
+	case "move", "copy":
+		if operation.From == nil {
+			return nil, fmt.Errorf("missing from for %s", operation.Op)
+		}
+		from, err := parseJSONPointer(*operation.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = jsonPointerGet(root, from); err != nil {
+			return nil, err
+		}
+		if operation.Op == "move" {
+			if strings.HasPrefix(*operation.Path, *operation.From+"/") {
+				return nil, errors.New("can't move a value into itself")
+			}
+			if root, _, err = jsonPointerRemove(root, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = copyJSONValue(value)
+		}
+	}
+
+	switch operation.Op {
+	case "add", "move", "copy":
+		return jsonPointerAdd(root, path, value)
+	case "remove":
+		root, _, err = jsonPointerRemove(root, path)
+		return root, err
+	case "replace":
+		if root, _, err = jsonPointerRemove(root, path); err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(root, path, value)
+	case "test":
+		current, err := jsonPointerGet(root, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equalJSONValues(current, value) {
+			return nil, fmt.Errorf("%w: %s", ErrPatchTestFailed, *operation.Path)
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", operation.Op)
+}
+
+// parseJSONPointer returns the reference tokens of the JSON Pointer (RFC 6901) pointer.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for i, token := range tokens {
+		tokens[i] = unescape.Replace(token)
+	}
+	return tokens, nil
+}
+
+// jsonArrayIndex returns the index of token in an array of n values, which may be n itself, for "-",
+// when end is true.
+func jsonArrayIndex(token string, n int, end bool) (int, error) {
+	if token == "-" && end {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || token != strconv.Itoa(i) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > n || i == n && !end {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+// jsonPointerGet returns the value of node at path.
+func jsonPointerGet(node any, path []string) (any, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]any:
+			value, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("key %q doesn't exist", token)
+			}
+			node = value
+		case []any:
+			i, err := jsonArrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("%q is not in an object or array", token)
+		}
+	}
+	return node, nil
+}
+
+// jsonPointerAdd adds value to node at path, and returns the new node.
+func jsonPointerAdd(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+
+	switch n := node.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("key %q doesn't exist", token)
+		}
+		child, err := jsonPointerAdd(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+	case []any:
+		i, err := jsonArrayIndex(token, len(n), len(path) == 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 1 {
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		if n[i], err = jsonPointerAdd(n[i], path[1:], value); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("%q is not in an object or array", token)
+}
+
+// jsonPointerRemove removes the value of node at path, and returns the new node and the value removed.
+func jsonPointerRemove(node any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, node, nil
+	}
+	token := path[0]
+
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("key %q doesn't exist", token)
+		}
+		if len(path) == 1 {
+			delete(n, token)
+			return n, child, nil
+		}
+		child, removed, err := jsonPointerRemove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = child
+		return n, removed, nil
+	case []any:
+		i, err := jsonArrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(path) == 1 {
+			removed := n[i]
+			return append(n[:i], n[i+1:]...), removed, nil
+		}
+		child, removed, err := jsonPointerRemove(n[i], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[i] = child
+		return n, removed, nil
+	}
+	return nil, nil, fmt.Errorf("%q is not in an object or array", token)
+}
+
+// copyJSONValue returns a deep copy of the decoded JSON value v.
+func copyJSONValue(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(value))
+		for k, item := range value {
+			c[k] = copyJSONValue(item)
+		}
+		return c
+	case []any:
+		c := make([]any, len(value))
+		for i, item := range value {
+			c[i] = copyJSONValue(item)
+		}
+		return c
+	}
+	return v
+}
+
+// equalJSONValues reports whether the decoded JSON values a and b are equal, with numbers compared by
+// value, so that 1 equals 1.0.
+func equalJSONValues(a, b any) bool {
+	switch x := a.(type) {
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, item := range x {
+			other, ok := y[k]
+			if !ok || !equalJSONValues(item, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalJSONValues(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, okx := new(big.Float).SetString(x.String())
+		fy, oky := new(big.Float).SetString(y.String())
+		return okx && oky && fx.Cmp(fy) == 0
+	}
+	return a == b
+}
+
+// mergePatch applies the decoded JSON Merge Patch patch to target, and returns the result.
+func mergePatch(target, patch any) any {
+	fields, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	object, ok := target.(map[string]any)
+	if !ok {
+		object = make(map[string]any)
+	}
+	for key, value := range fields {
+		if value == nil {
+			delete(object, key)
+		} else {
+			object[key] = mergePatch(object[key], value)
+		}
+	}
+	return object
+}
@@ -0,0 +1,120 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	doc := `{"name":"Ann","tags":["a","b"],"address":{"city":"Paris"},"id":12345678901234567890}`
+
+	tests := []struct {
+		name     string
+		patch    string
+		expected string
+		err      error
+	}{
+		{name: "add", patch: `[{"op":"add","path":"/age","value":30}]`, expected: `{"address":{"city":"Paris"},"age":30,"id":12345678901234567890,"name":"Ann","tags":["a","b"]}`},
+		{name: "append", patch: `[{"op":"add","path":"/tags/-","value":"c"},{"op":"add","path":"/tags/0","value":"z"}]`, expected: `{"address":{"city":"Paris"},"id":12345678901234567890,"name":"Ann","tags":["z","a","b","c"]}`},
+		{name: "remove", patch: `[{"op":"remove","path":"/tags/0"},{"op":"remove","path":"/address"}]`, expected: `{"id":12345678901234567890,"name":"Ann","tags":["b"]}`},
+		{name: "replace", patch: `[{"op":"replace","path":"/address/city","value":"Lyon"}]`, expected: `{"address":{"city":"Lyon"},"id":12345678901234567890,"name":"Ann","tags":["a","b"]}`},
+		{name: "move", patch: `[{"op":"move","from":"/address/city","path":"/city"}]`, expected: `{"address":{},"city":"Paris","id":12345678901234567890,"name":"Ann","tags":["a","b"]}`},
+		{name: "copy", patch: `[{"op":"copy","from":"/tags","path":"/labels"},{"op":"remove","path":"/tags/1"}]`, expected: `{"address":{"city":"Paris"},"id":12345678901234567890,"labels":["a","b"],"name":"Ann","tags":["a"]}`},
+		{name: "test", patch: `[{"op":"test","path":"/address","value":{"city":"Paris"}},{"op":"test","path":"/id","value":1.2345678901234567890e19}]`, expected: `{"address":{"city":"Paris"},"id":12345678901234567890,"name":"Ann","tags":["a","b"]}`},
+		{name: "escaped", patch: `[{"op":"add","path":"/a~1b~0c","value":null}]`, expected: `{"a/b~c":null,"address":{"city":"Paris"},"id":12345678901234567890,"name":"Ann","tags":["a","b"]}`},
+		{name: "failed test", patch: `[{"op":"replace","path":"/name","value":"Bob"},{"op":"test","path":"/name","value":"Ann"}]`, err: ErrPatchTestFailed},
+		{name: "missing path", patch: `[{"op":"replace","path":"/missing","value":1}]`, err: ErrInvalidPatch},
+		{name: "index out of range", patch: `[{"op":"add","path":"/tags/3","value":"x"}]`, err: ErrInvalidPatch},
+		{name: "leading zero", patch: `[{"op":"remove","path":"/tags/01"}]`, err: ErrInvalidPatch},
+		{name: "missing value", patch: `[{"op":"add","path":"/age"}]`, err: ErrInvalidPatch},
+		{name: "move into itself", patch: `[{"op":"move","from":"/address","path":"/address/home"}]`, err: ErrInvalidPatch},
+		{name: "unknown operation", patch: `[{"op":"merge","path":"/name"}]`, err: ErrInvalidPatch},
+		{name: "not a patch", patch: `{"op":"add"}`, err: ErrInvalidPatch},
+	}
+	for _, test := range tests {
+		patched, err := ApplyJSONPatch([]byte(doc), []byte(test.patch))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+			continue
+		}
+		if err == nil && string(patched) != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, patched)
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, expected string
+	}{
+		{doc: `{"a":"b"}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+		{doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, expected: `{"b":"c"}`},
+		{doc: `{"a":{"b":"c","d":"e"}}`, patch: `{"a":{"d":null,"f":1}}`, expected: `{"a":{"b":"c","f":1}}`},
+		{doc: `{"a":["b"]}`, patch: `{"a":["c","d"]}`, expected: `{"a":["c","d"]}`},
+		{doc: `["a"]`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+		{doc: `{"a":"b"}`, patch: `["c"]`, expected: `["c"]`},
+	}
+	for _, test := range tests {
+		patched, err := ApplyMergePatch([]byte(test.doc), []byte(test.patch))
+		if err != nil || string(patched) != test.expected {
+			t.Errorf("%s with %s: expected %s, got %s %v", test.doc, test.patch, test.expected, patched, err)
+		}
+	}
+
+	if _, err := ApplyMergePatch([]byte(`{}`), []byte(`{`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Error("expected ErrInvalidPatch, got", err)
+	}
+}
+
+func TestTools_ReadPatch(t *testing.T) {
+	type user struct {
+		Name string   `json:"name"`
+		Age  int      `json:"age"`
+		Tags []string `json:"tags"`
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expected    user
+		err         error
+	}{
+		{name: "merge patch", contentType: "application/merge-patch+json", body: `{"age":31,"tags":null}`, expected: user{Name: "Ann", Age: 31}},
+		{name: "plain json", contentType: "application/json", body: `{"name":"Bob"}`, expected: user{Name: "Bob", Age: 30, Tags: []string{"a"}}},
+		{name: "json patch", contentType: "application/json-patch+json; charset=utf-8", body: `[{"op":"add","path":"/tags/-","value":"b"}]`, expected: user{Name: "Ann", Age: 30, Tags: []string{"a", "b"}}},
+		{name: "wrong type", contentType: "application/merge-patch+json", body: `{"age":"old"}`, err: ErrInvalidPatch},
+		{name: "unknown field", contentType: "application/merge-patch+json", body: `{"email":"ann@example.com"}`, err: ErrInvalidPatch},
+		{name: "failed test", contentType: "application/json-patch+json", body: `[{"op":"test","path":"/age","value":40}]`, err: ErrPatchTestFailed},
+		{name: "unsupported", contentType: "text/plain", body: `age=31`, err: ErrUnsupportedPatch},
+	}
+
+	var testTools Tools
+	for _, test := range tests {
+		current := user{Name: "Ann", Age: 30, Tags: []string{"a"}}
+		request := httptest.NewRequest("PATCH", "/users/1", strings.NewReader(test.body))
+		request.Header.Set("Content-Type", test.contentType)
+
+		err := testTools.ReadPatch(httptest.NewRecorder(), request, &current)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+			continue
+		}
+		if err != nil {
+			if current.Name != "Ann" || current.Age != 30 || len(current.Tags) != 1 {
+				t.Errorf("%s: expected the data to be unchanged, got %+v", test.name, current)
+			}
+			continue
+		}
+		if current.Name != test.expected.Name || current.Age != test.expected.Age || strings.Join(current.Tags, ",") != strings.Join(test.expected.Tags, ",") {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, current)
+		}
+	}
+
+	if status, _ := testTools.ErrorStatus(ErrUnsupportedPatch); status != http.StatusUnsupportedMediaType {
+		t.Error("expected 415, got", status)
+	}
+}
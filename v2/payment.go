@@ -0,0 +1,163 @@
+package toolkit
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CardBrand is the brand of a payment card, as told by DetectCardBrand.
+type CardBrand string
+
+// The card brands DetectCardBrand knows.
+const (
+	CardVisa       CardBrand = "visa"
+	CardMastercard CardBrand = "mastercard"
+	CardAmex       CardBrand = "amex"
+	CardDiscover   CardBrand = "discover"
+	CardDiners     CardBrand = "diners"
+	CardJCB        CardBrand = "jcb"
+	CardUnionPay   CardBrand = "unionpay"
+)
+
+// cardBrands are the number prefixes and lengths of each card brand. Prefixes are ranges of the
+// leading digits, checked in order.
+var cardBrands = []struct {
+	brand    CardBrand
+	prefixes [][2]int
+	lengths  []int
+}{
+	{CardAmex, [][2]int{{34, 34}, {37, 37}}, []int{15}},
+	{CardDiners, [][2]int{{300, 305}, {36, 36}, {38, 39}}, []int{14, 15, 16, 17, 18, 19}},
+	{CardJCB, [][2]int{{3528, 3589}}, []int{16, 17, 18, 19}},
+	{CardVisa, [][2]int{{4, 4}}, []int{13, 16, 19}},
+	{CardMastercard, [][2]int{{51, 55}, {2221, 2720}}, []int{16}},
+	{CardDiscover, [][2]int{{6011, 6011}, {644, 649}, {65, 65}}, []int{16, 17, 18, 19}},
+	{CardUnionPay, [][2]int{{62, 62}}, []int{16, 17, 18, 19}},
+}
+
+// ibanLengths are the lengths of the IBANs of each country, from the SWIFT IBAN registry.
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22, "BH": 22, "BR": 29,
+	"BY": 28, "CH": 21, "CR": 22, "CY": 28, "CZ": 24, "DE": 22, "DK": 18, "DO": 28, "EE": 20, "EG": 29,
+	"ES": 24, "FI": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18, "GR": 27, "GT": 28,
+	"HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23, "IS": 26, "IT": 27, "JO": 30, "KW": 30, "KZ": 20,
+	"LB": 28, "LC": 32, "LI": 21, "LT": 20, "LU": 20, "LV": 21, "LY": 25, "MC": 27, "MD": 24, "ME": 22,
+	"MK": 19, "MR": 27, "MT": 31, "MU": 30, "NL": 18, "NO": 15, "PK": 24, "PL": 28, "PS": 29, "PT": 25,
+	"QA": 29, "RO": 24, "RS": 22, "SA": 24, "SC": 31, "SD": 18, "SE": 24, "SI": 19, "SK": 24, "SM": 27,
+	"ST": 25, "SV": 28, "TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20,
+}
+
+// stripSeparators removes the spaces and dashes people type within card numbers and IBANs.
+func stripSeparators(s string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(s)
+}
+
+// LuhnValid reports whether number, made of digits and optionally spaces or dashes, passes the
+// Luhn checksum, as card numbers do.
+func LuhnValid(number string) bool {
+	number = stripSeparators(number)
+	if len(number) < 2 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// DetectCardBrand returns the brand of the card number, from its leading digits and length, or an empty
+// CardBrand if it is unknown. It doesn't check the number with LuhnValid.
+func DetectCardBrand(number string) CardBrand {
+	number = stripSeparators(number)
+	if strings.Trim(number, "0123456789") != "" {
+		return ""
+	}
+	for _, b := range cardBrands {
+		if !containsInt(b.lengths, len(number)) {
+			continue
+		}
+		for _, prefix := range b.prefixes {
+			digits := len(strconv.Itoa(prefix[0]))
+			if len(number) < digits {
+				continue
+			}
+			if lead, err := strconv.Atoi(number[:digits]); err == nil && lead >= prefix[0] && lead <= prefix[1] {
+				return b.brand
+			}
+		}
+	}
+	return ""
+}
+
+// IsValidIBAN reports whether iban, optionally with spaces, is an International Bank Account Number
+// with the length of its country and a valid checksum.
+func IsValidIBAN(iban string) bool {
+	iban = strings.ToUpper(stripSeparators(iban))
+	if len(iban) < 4 || ibanLengths[iban[:2]] != len(iban) {
+		return false
+	}
+
+	// move the country and check digits to the end, turn letters into numbers, and compute mod 97
+	// a digit at a time, as the number is too large for an int
+	rem := 0
+	for _, c := range iban[4:] + iban[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			rem = (rem*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			rem = (rem*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
+
+// containsInt reports whether list contains n.
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCardNumber checks that field holds a payment card number which passes the Luhn checksum and,
+// if brands are given, is of one of them.
+func (v *Validator) IsCardNumber(field string, brands ...CardBrand) {
+	v.Custom(field, func(value string) bool {
+		if !LuhnValid(value) || len(stripSeparators(value)) < 12 {
+			return false
+		}
+		if len(brands) == 0 {
+			return true
+		}
+		brand := DetectCardBrand(value)
+		for _, b := range brands {
+			if brand == b {
+				return true
+			}
+		}
+		return false
+	}, "invalid card number")
+}
+
+// IsIBAN checks that field holds a valid International Bank Account Number.
+func (v *Validator) IsIBAN(field string) {
+	v.Custom(field, IsValidIBAN, "invalid IBAN")
+}
@@ -0,0 +1,79 @@
+package toolkit
+
+import (
+	"net/url"
+	"testing"
+)
+
+var cardTests = []struct {
+	number string
+	luhn   bool
+	brand  CardBrand
+}{
+	{"4111 1111 1111 1111", true, CardVisa},
+	{"4111-1111-1111-1112", false, CardVisa},
+	{"5555555555554444", true, CardMastercard},
+	{"2223003122003222", true, CardMastercard},
+	{"378282246310005", true, CardAmex},
+	{"6011111111111117", true, CardDiscover},
+	{"30569309025904", true, CardDiners},
+	{"3530111333300000", true, CardJCB},
+	{"6200000000000005", true, CardUnionPay},
+	{"1234567812345670", true, ""},
+	{"4111 1111 1111 111a", false, ""},
+	{"0", false, ""},
+}
+
+func TestCards(t *testing.T) {
+	for _, e := range cardTests {
+		if LuhnValid(e.number) != e.luhn {
+			t.Errorf("%s: expected Luhn check to be %t", e.number, e.luhn)
+		}
+		if brand := DetectCardBrand(e.number); brand != e.brand {
+			t.Errorf("%s: expected brand %q, got %q", e.number, e.brand, brand)
+		}
+	}
+}
+
+var ibanTests = []struct {
+	iban     string
+	expected bool
+}{
+	{"GB82 WEST 1234 5698 7654 32", true},
+	{"gb82west12345698765432", true},
+	{"DE89370400440532013000", true},
+	{"FR1420041010050500013M02606", true},
+	{"NO9386011117947", true},
+	{"GB82WEST12345698765431", false},
+	{"GB82WEST1234569876543", false},
+	{"ZZ82WEST12345698765432", false},
+	{"GB82WEST1234569876543!", false},
+	{"GB", false},
+}
+
+func TestIsValidIBAN(t *testing.T) {
+	for _, e := range ibanTests {
+		if IsValidIBAN(e.iban) != e.expected {
+			t.Errorf("%s: expected %t", e.iban, e.expected)
+		}
+	}
+}
+
+func TestValidator_PaymentRules(t *testing.T) {
+	v := NewValidatorFromValues(url.Values{
+		"card":    {"4111 1111 1111 1111"},
+		"amex":    {"378282246310005"},
+		"bad":     {"4111 1111 1111 1112"},
+		"iban":    {"DE89 3704 0044 0532 0130 00"},
+		"badiban": {"DE89 3704 0044 0532 0130 01"},
+	})
+	v.IsCardNumber("card")
+	v.IsCardNumber("amex", CardVisa, CardMastercard)
+	v.IsCardNumber("bad")
+	v.IsIBAN("iban")
+	v.IsIBAN("badiban")
+
+	if len(v.Errors) != 3 || v.Errors.Get("amex") == "" || v.Errors.Get("bad") == "" || v.Errors.Get("badiban") == "" {
+		t.Error("wrong errors", v.Errors)
+	}
+}
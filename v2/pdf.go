@@ -0,0 +1,133 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// ErrInvalidPDF is returned by InspectPDF for files which aren't PDF documents.
+	ErrInvalidPDF = errors.New("the file is not a valid PDF")
+	// ErrUnsafePDF is returned by uploads refused because a PDF contains JavaScript or launch actions.
+	ErrUnsafePDF = errors.New("the PDF contains JavaScript or launch actions")
+)
+
+// PDFInfo describes a PDF document inspected by InspectPDF.
+type PDFInfo struct {
+	// Version is the version in the header, such as "1.7".
+	Version string
+	// Pages is the number of pages, or zero if they couldn't be counted.
+	Pages int
+	Size  int64
+	// Encrypted is set for documents protected with a password or permissions.
+	Encrypted bool
+	// JavaScript is set when the document contains JavaScript, which viewers may run.
+	JavaScript bool
+	// Launch is set when the document contains actions launching other applications or files.
+	Launch bool
+	// OpenAction is set when the document runs an action, such as going to a URL, when it is opened.
+	OpenAction bool
+	// EmbeddedFiles is set when the document carries other files.
+	EmbeddedFiles bool
+}
+
+// Safe reports whether the document has neither JavaScript nor launch actions.
+func (info *PDFInfo) Safe() bool {
+	return !info.JavaScript && !info.Launch
+}
+
+var (
+	pdfHeader     = regexp.MustCompile(`%PDF-(\d\.\d)`)
+	pdfName       = regexp.MustCompile(`/[^\s/<>\[\]()%{}]+`)
+	pdfPageObject = regexp.MustCompile(`/Type\s*/Page[\s/>\]]`)
+	pdfPageCount  = regexp.MustCompile(`/Type\s*/Pages[^>]*?/Count\s+(\d+)|/Count\s+(\d+)[^>]*?/Type\s*/Pages`)
+)
+
+// InspectPDF reads the PDF document in r, checks that it has a PDF header and trailer, and reports its
+// page count and whether it contains active content. The checks are heuristics working on the raw file:
+// they find names written in clear or escaped (such as /J#61vaScript), but not those inside compressed
+// object streams, so they are a first line of defense rather than a guarantee.
+func (t *Tools) InspectPDF(r io.Reader) (*PDFInfo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// the header must be within the first 1024 bytes, and the end of file marker within the last 1024
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	match := pdfHeader.FindSubmatch(head)
+	if match == nil {
+		return nil, ErrInvalidPDF
+	}
+	tail := data
+	if len(tail) > 1024 {
+		tail = tail[len(tail)-1024:]
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return nil, ErrInvalidPDF
+	}
+
+	info := &PDFInfo{Version: string(match[1]), Size: int64(len(data))}
+
+	// decode the #xx escapes of names, which are used to hide them from scanners like this one
+	normalized := pdfName.ReplaceAllFunc(data, func(name []byte) []byte {
+		if !bytes.Contains(name, []byte("#")) {
+			return name
+		}
+		return decodePDFName(name)
+	})
+
+	for _, name := range pdfName.FindAll(normalized, -1) {
+		switch string(name) {
+		case "/JavaScript", "/JS":
+			info.JavaScript = true
+		case "/Launch":
+			info.Launch = true
+		case "/OpenAction", "/AA":
+			info.OpenAction = true
+		case "/EmbeddedFile", "/EmbeddedFiles":
+			info.EmbeddedFiles = true
+		case "/Encrypt":
+			info.Encrypted = true
+		}
+	}
+
+	info.Pages = len(pdfPageObject.FindAll(normalized, -1))
+	if info.Pages == 0 {
+		// the page objects may be compressed; fall back on the count of the page tree root
+		for _, m := range pdfPageCount.FindAllSubmatch(normalized, -1) {
+			count := m[1]
+			if count == nil {
+				count = m[2]
+			}
+			if n, err := strconv.Atoi(string(count)); err == nil && n > info.Pages {
+				info.Pages = n
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// decodePDFName decodes the #xx escapes in a PDF name.
+func decodePDFName(name []byte) []byte {
+	out := make([]byte, 0, len(name))
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if b, err := hex.DecodeString(string(name[i+1 : i+3])); err == nil {
+				out = append(out, b[0])
+				i += 2
+				continue
+			}
+		}
+		out = append(out, name[i])
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testPDF returns a minimal PDF document with the given extra catalog entries and pages.
+func testPDF(catalog string, pages int) string {
+	var b strings.Builder
+	b.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	b.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R " + catalog + " >>\nendobj\n")
+	b.WriteString("2 0 obj\n<< /Type /Pages /Kids [] /Count " + string(rune('0'+pages)) + " >>\nendobj\n")
+	for i := 0; i < pages; i++ {
+		b.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>\nendobj\n")
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.String()
+}
+
+var inspectPDFTests = []struct {
+	name       string
+	pdf        string
+	errorIs    error
+	pages      int
+	safe       bool
+	openAction bool
+}{
+	{name: "plain", pdf: testPDF("", 3), pages: 3, safe: true},
+	{name: "javascript", pdf: testPDF("/OpenAction << /S /JavaScript /JS (app.alert(1)) >>", 1), pages: 1, openAction: true},
+	{name: "escaped javascript", pdf: testPDF("/Names << /J#61vaScript 5 0 R >>", 1), pages: 1},
+	{name: "launch", pdf: testPDF("/OpenAction << /S /Launch /F (cmd.exe) >>", 1), pages: 1, openAction: true},
+	{name: "compressed pages", pdf: strings.ReplaceAll(testPDF("", 2), "/Type /Page /Parent", "/Parent"), pages: 2, safe: true},
+	{name: "not a pdf", pdf: "hello world %%EOF", errorIs: ErrInvalidPDF},
+	{name: "truncated", pdf: strings.TrimSuffix(testPDF("", 1), "%%EOF\n"), errorIs: ErrInvalidPDF},
+}
+
+func TestTools_InspectPDF(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range inspectPDFTests {
+		info, err := testTools.InspectPDF(strings.NewReader(e.pdf))
+		if e.errorIs != nil {
+			if !errors.Is(err, e.errorIs) {
+				t.Errorf("%s: expected %v, got %v", e.name, e.errorIs, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+
+		if info.Version != "1.7" || info.Size != int64(len(e.pdf)) {
+			t.Errorf("%s: wrong version or size %q %d", e.name, info.Version, info.Size)
+		}
+		if info.Pages != e.pages {
+			t.Errorf("%s: expected %d pages, got %d", e.name, e.pages, info.Pages)
+		}
+		if info.Safe() != e.safe {
+			t.Errorf("%s: expected safe to be %v, got %+v", e.name, e.safe, info)
+		}
+		if info.OpenAction != e.openAction {
+			t.Errorf("%s: expected open action to be %v", e.name, e.openAction)
+		}
+	}
+}
+
+func TestTools_UploadFilesInspectPDFs(t *testing.T) {
+	for _, e := range []struct {
+		pdf     string
+		errorIs error
+	}{
+		{pdf: testPDF("", 1)},
+		{pdf: testPDF("/OpenAction << /S /JavaScript /JS (x) >>", 1), errorIs: ErrUnsafePDF},
+	} {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, _ := writer.CreateFormFile("file", "doc.pdf")
+		part.Write([]byte(e.pdf))
+		writer.Close()
+
+		request := httptest.NewRequest("POST", "/", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+
+		testTools := Tools{InspectPDFs: true, AllowedFileTypes: []string{"application/pdf"}}
+		uploadDir := t.TempDir()
+
+		_, err := testTools.UploadFiles(request, uploadDir)
+		if !errors.Is(err, e.errorIs) {
+			t.Errorf("expected %v, got %v", e.errorIs, err)
+		}
+		if entries, _ := os.ReadDir(uploadDir); (len(entries) == 0) != (e.errorIs != nil) {
+			t.Error("wrong number of files written", len(entries))
+		}
+	}
+}
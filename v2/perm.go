@@ -0,0 +1,47 @@
+package toolkit
+
+import (
+	"io/fs"
+	"os"
+)
+
+// FileOwner is the user and group the files and directories created by the toolkit are given, with
+// Tools.FileOwner. An ID of -1 leaves it unchanged.
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+// dirPerm returns the permissions of the directories the toolkit creates.
+func (t *Tools) dirPerm() fs.FileMode {
+	if t.DirPerm != 0 {
+		return t.DirPerm
+	}
+	return 0755
+}
+
+// filePerm returns the permissions of the files the toolkit creates, or def if Tools.FilePerm is not set.
+func (t *Tools) filePerm(def fs.FileMode) fs.FileMode {
+	if t.FilePerm != 0 {
+		return t.FilePerm
+	}
+	return def
+}
+
+// applyFileMode gives the file, or directory, at path the permissions set in Tools.FilePerm, or
+// Tools.DirPerm, regardless of the umask, and the owner set in Tools.FileOwner.
+func (t *Tools) applyFileMode(path string, isDir bool) error {
+	perm := t.FilePerm
+	if isDir {
+		perm = t.DirPerm
+	}
+	if perm != 0 {
+		if err := os.Chmod(path, perm); err != nil {
+			return err
+		}
+	}
+	if t.FileOwner != nil {
+		return chown(path, t.FileOwner.UID, t.FileOwner.GID)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package toolkit
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+)
+
+func TestTools_FilePerm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permissions are not available on Windows")
+	}
+
+	// permissions wider than the usual umask allows are applied as is
+	testTools := Tools{DirPerm: 0770, FilePerm: 0660, FileOwner: &FileOwner{UID: os.Getuid(), GID: -1}}
+	root := t.TempDir()
+
+	uploadDir := filepath.Join(root, "uploads", "2024")
+	request, err := NewMultipartRequest("/").AddFile("file", "./testdata/img.png").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadedFile, err := testTools.UploadOneFile(request, uploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	if err = testTools.CreateZip(&archive, fstest.MapFS{"docs/a.txt": {Data: []byte("a")}}); err != nil {
+		t.Fatal(err)
+	}
+	extractDir := filepath.Join(root, "extracted")
+	if err = testTools.ExtractZip(&archive, extractDir); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		perm fs.FileMode
+	}{
+		{path: uploadDir, perm: 0770},
+		{path: filepath.Join(uploadDir, uploadedFile.NewFileName), perm: 0660},
+		{path: filepath.Join(extractDir, "docs"), perm: 0770},
+		{path: filepath.Join(extractDir, "docs", "a.txt"), perm: 0660},
+	}
+	for _, test := range tests {
+		info, err := os.Stat(test.path)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if info.Mode().Perm() != test.perm {
+			t.Errorf("%s: expected %v, got %v", test.path, test.perm, info.Mode().Perm())
+		}
+	}
+
+	// by default, the umask decides, as it did before FilePerm
+	var defaults Tools
+	if defaults.filePerm(0666) != 0666 || defaults.dirPerm() != 0755 {
+		t.Errorf("wrong default permissions %v, %v", defaults.filePerm(0666), defaults.dirPerm())
+	}
+}
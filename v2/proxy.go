@@ -0,0 +1,114 @@
+package toolkit
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwardingHeaders are the headers proxies use to pass on what the client asked for.
+var forwardingHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "X-Real-IP"}
+
+// ProxyHeaders is middleware which applies the forwarding headers of requests coming from one of
+// Tools.TrustedProxies: r.RemoteAddr becomes the client address found by RealIP, r.Host the host the
+// client asked for, and r.URL.Scheme its scheme, from the Forwarded header or the X-Forwarded-Proto and
+// X-Forwarded-Host headers. The forwarding headers of other requests are removed, so that handlers
+// reading them can't be fooled by clients setting them.
+func (t *Tools) ProxyHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remote = r.RemoteAddr
+		}
+
+		r = r.Clone(r.Context())
+		if !CIDRMatch(remote, t.TrustedProxies...) {
+			for _, header := range forwardingHeaders {
+				r.Header.Del(header)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r.RemoteAddr = net.JoinHostPort(t.RealIP(r), "0")
+
+		proto, host := forwardedParam(r.Header.Values("Forwarded"), "proto"), forwardedParam(r.Header.Values("Forwarded"), "host")
+		if proto == "" {
+			proto = firstHeaderValue(r.Header.Get("X-Forwarded-Proto"))
+		}
+		if host == "" {
+			host = firstHeaderValue(r.Header.Get("X-Forwarded-Host"))
+		}
+		if proto = strings.ToLower(proto); proto == "http" || proto == "https" {
+			r.URL.Scheme = proto
+		}
+		if host != "" {
+			r.Host = host
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedParam returns the value of key in the first element of RFC 7239 Forwarded headers, which
+// describes the request of the client.
+func forwardedParam(headers []string, key string) string {
+	if len(headers) == 0 {
+		return ""
+	}
+	element, _, _ := strings.Cut(headers[0], ",")
+	for _, pair := range strings.Split(element, ";") {
+		k, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if found && strings.EqualFold(k, key) {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return ""
+}
+
+// firstHeaderValue returns the first of the comma separated values of a header.
+func firstHeaderValue(header string) string {
+	value, _, _ := strings.Cut(header, ",")
+	return strings.TrimSpace(value)
+}
+
+// AllowHosts returns middleware which refuses requests whose Host header isn't one of hosts, with a 400
+// JSON error, as links built from the Host header, such as in password reset emails, can otherwise
+// point anywhere. Hosts may include a port, which must then match, and may start with *. to allow any
+// subdomain, as in *.example.com. Use it after ProxyHeaders when behind a proxy.
+func (t *Tools) AllowHosts(hosts ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hostAllowed(r.Host, hosts) {
+				t.logger().Warn("host not allowed", "host", r.Host, "path", r.URL.Path, "ip", t.RealIP(r))
+				_ = t.ErrorJSON(w, errors.New("invalid host"), http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hostAllowed reports whether host, as found in a Host header, matches any of the patterns in allowed.
+func hostAllowed(host string, allowed []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	name := stripPort(host)
+
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		candidate := name
+		if _, _, err := net.SplitHostPort(pattern); err == nil {
+			candidate = host
+		}
+
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(candidate, pattern[1:]) && len(candidate) > len(pattern)-1 {
+				return true
+			}
+		} else if candidate == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var proxyHeadersTests = []struct {
+	name       string
+	remoteAddr string
+	headers    map[string]string
+	remote     string
+	host       string
+	scheme     string
+}{
+	{name: "untrusted", remoteAddr: "203.0.113.7:5555", headers: map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Host": "evil.com"}, remote: "203.0.113.7:5555", host: "example.com"},
+	{name: "x-forwarded", remoteAddr: "10.0.0.2:80", headers: map[string]string{"X-Forwarded-For": "198.51.100.9", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "api.example.com, proxy.local"}, remote: "198.51.100.9:0", host: "api.example.com", scheme: "https"},
+	{name: "forwarded", remoteAddr: "10.0.0.2:80", headers: map[string]string{"Forwarded": `for=192.0.2.60;proto=https;host="shop.example.com", for=10.0.0.9`}, remote: "192.0.2.60:0", host: "shop.example.com", scheme: "https"},
+	{name: "bad proto", remoteAddr: "10.0.0.2:80", headers: map[string]string{"X-Forwarded-Proto": "javascript"}, remote: "10.0.0.2:0", host: "example.com"},
+}
+
+func TestTools_ProxyHeaders(t *testing.T) {
+	testTools := Tools{TrustedProxies: []string{"10.0.0.0/8"}}
+
+	for _, test := range proxyHeadersTests {
+		var seen *http.Request
+		handler := testTools.ProxyHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = r
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = "example.com"
+		req.RemoteAddr = test.remoteAddr
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if seen.RemoteAddr != test.remote || seen.Host != test.host || seen.URL.Scheme != test.scheme {
+			t.Errorf("%s: wrong request %s %s %q", test.name, seen.RemoteAddr, seen.Host, seen.URL.Scheme)
+		}
+		if test.name == "untrusted" && (seen.Header.Get("X-Forwarded-For") != "" || seen.Header.Get("X-Forwarded-Host") != "") {
+			t.Errorf("%s: expected the forwarding headers to be removed, got %v", test.name, seen.Header)
+		}
+		if req.Host != "example.com" {
+			t.Errorf("%s: expected the original request to be left alone", test.name)
+		}
+	}
+}
+
+var allowHostsTests = []struct {
+	host    string
+	allowed bool
+}{
+	{host: "example.com", allowed: true},
+	{host: "EXAMPLE.com:8080", allowed: true},
+	{host: "example.com.", allowed: true},
+	{host: "api.example.com", allowed: true},
+	{host: "a.b.example.com", allowed: true},
+	{host: "localhost:3000", allowed: true},
+	{host: "localhost:4000", allowed: false},
+	{host: "notexample.com", allowed: false},
+	{host: "evil.com", allowed: false},
+	{host: "", allowed: false},
+}
+
+func TestTools_AllowHosts(t *testing.T) {
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+	handler := testTools.AllowHosts("example.com", "*.example.com", "localhost:3000")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, test := range allowHostsTests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = test.host
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if (rr.Code == http.StatusOK) != test.allowed {
+			t.Errorf("%q: expected allowed to be %t, got %d", test.host, test.allowed, rr.Code)
+		}
+	}
+	if !logger.contains("WARN host not allowed") {
+		t.Error("expected refused hosts to be logged")
+	}
+}
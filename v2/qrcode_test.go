@@ -0,0 +1,100 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQRCodeTables(t *testing.T) {
+	// data codewords at error correction level M, from ISO/IEC 18004 table 7
+	for version, expected := range map[int]int{1: 16, 2: 28, 3: 44, 4: 64, 5: 86, 10: 216, 20: 669, 40: 2334} {
+		if n := qrNumDataCodewords(version); n != expected {
+			t.Errorf("version %d: expected %d data codewords, got %d", version, expected, n)
+		}
+	}
+
+	for version, expected := range map[int][]int{1: nil, 2: {6, 18}, 7: {6, 22, 38}, 32: {6, 34, 60, 86, 112, 138}, 40: {6, 30, 58, 86, 114, 142, 170}} {
+		qr := &qrCode{version: version, size: version*4 + 17}
+		if positions := qr.alignmentPatternPositions(); !reflect.DeepEqual(positions, expected) {
+			t.Errorf("version %d: wrong alignment patterns %v", version, positions)
+		}
+	}
+
+	if bits := qrFormatBits(0); bits != 0x5412 {
+		t.Errorf("wrong format bits %015b", bits)
+	}
+	if bits := qrVersionBits(7); bits != 0x07C94 {
+		t.Errorf("wrong version bits %018b", bits)
+	}
+}
+
+func TestQRCodeReedSolomon(t *testing.T) {
+	// the example of ISO/IEC 18004 annex I: "01234567" as a version 1-M symbol
+	data := []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	expected := []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55}
+
+	if ecc := qrReedSolomonRemainder(data, qrReedSolomonDivisor(10)); !bytes.Equal(ecc, expected) {
+		t.Errorf("wrong error correction codewords % X", ecc)
+	}
+}
+
+func TestGenerateQRCode(t *testing.T) {
+	out, err := GenerateQRCode("otpauth://totp/Example:alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example", 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 256, 256) {
+		t.Error("wrong size", img.Bounds())
+	}
+
+	// 86 bytes need version 5 (37 modules), drawn 5 pixels per module after a 4 module quiet zone
+	isDark := func(x, y int) bool {
+		return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y < 128
+	}
+	offset := (256 - 37*5) / 2
+	if isDark(offset-1, offset-1) || !isDark(offset, offset) || !isDark(offset+36*5, offset) || !isDark(offset, offset+36*5) {
+		t.Error("expected finder patterns in three corners, within a light quiet zone")
+	}
+	if isDark(offset+36*5, offset+36*5) && isDark(offset+35*5, offset+36*5) && isDark(offset+36*5, offset+35*5) {
+		t.Error("the bottom right corner must not hold a finder pattern")
+	}
+
+	if _, err = GenerateQRCode(strings.Repeat("x", 3000), 256); !errors.Is(err, ErrQRCodeTooLong) {
+		t.Error("expected ErrQRCodeTooLong, got", err)
+	}
+}
+
+func TestTools_QRCodeHandler(t *testing.T) {
+	var testTools Tools
+	handler := testTools.QRCodeHandler(128, func(r *http.Request) (string, error) {
+		if r.URL.Query().Get("code") == "" {
+			return "", errors.New("missing code")
+		}
+		return "https://example.com/s/" + r.URL.Query().Get("code"), nil
+	})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/qr?code=abc", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/png" || rr.Header().Get("Cache-Control") != "no-store" {
+		t.Error("wrong response", rr.Code, rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/qr", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Error("expected a JSON error, got", rr.Code)
+	}
+}
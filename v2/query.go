@@ -0,0 +1,132 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query is the type used to read typed values from a request's query string.
+// Values which can't be parsed are reported in Errors, and the default is returned instead,
+// so that all problems can be sent back to the client at once with ErrorJSON(w, q.Err()).
+type Query struct {
+	Values url.Values
+	Errors ValidationErrors
+	// Location is the time zone of the times and dates which don't give one. Defaults to UTC.
+	Location *time.Location
+}
+
+// NewQuery returns a Query for the query string of r.
+func NewQuery(r *http.Request) *Query {
+	return &Query{
+		Values: r.URL.Query(),
+		Errors: ValidationErrors{},
+	}
+}
+
+// Err returns the errors found so far, or nil if every value could be parsed.
+func (q *Query) Err() error {
+	if len(q.Errors) == 0 {
+		return nil
+	}
+	return q.Errors
+}
+
+// String returns the value of key, or def if it is not set.
+func (q *Query) String(key, def string) string {
+	if value := q.Values.Get(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// Int returns the value of key as an int, or def if it is not set or invalid.
+func (q *Query) Int(key string, def int) int {
+	value := q.Values.Get(key)
+	if value == "" {
+		return def
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		q.Errors.Add(key, "must be an integer value")
+		return def
+	}
+	return i
+}
+
+// Bool returns the value of key as a bool, or def if it is not set or invalid.
+// Besides the values accepted by strconv.ParseBool, yes/no and on/off are understood.
+func (q *Query) Bool(key string, def bool) bool {
+	value := q.Values.Get(key)
+	if value == "" {
+		return def
+	}
+
+	switch strings.ToLower(value) {
+	case "yes", "on":
+		return true
+	case "no", "off":
+		return false
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		q.Errors.Add(key, "must be a boolean value")
+		return def
+	}
+	return b
+}
+
+// Time returns the value of key as a time, or def if it is not set or invalid.
+// Any format accepted by ParseTimeFlexible is, such as RFC 3339 timestamps and plain dates (2006-01-02),
+// which are taken in Location.
+func (q *Query) Time(key string, def time.Time) time.Time {
+	value := q.Values.Get(key)
+	if value == "" {
+		return def
+	}
+
+	tm, err := ParseTimeFlexible(value, q.Location)
+	if err != nil {
+		q.Errors.Add(key, "must be a date (2006-01-02) or RFC 3339 time")
+		return def
+	}
+	return tm
+}
+
+// TimeRange returns the values of fromKey and toKey as times, for filters such as ?from=2022-10-01&to=2022-10-31.
+// When to is a plain date, the end of that day is returned, so that the whole day is included. Unset
+// or invalid values are returned as zero times, and a range which ends before it starts is reported.
+func (q *Query) TimeRange(fromKey, toKey string) (from, to time.Time) {
+	from = q.Time(fromKey, time.Time{})
+	to = q.Time(toKey, time.Time{})
+	if !to.IsZero() && isDateOnly(q.Values.Get(toKey)) {
+		to = EndOfDay(to)
+	}
+
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		q.Errors.Add(toKey, "must not be before "+fromKey)
+	}
+	return from, to
+}
+
+// StringSlice returns the values of key, or def if it is not set. Values may be given as a comma
+// separated list, by repeating the key, or both: ?tags=a,b&tags=c returns [a b c].
+func (q *Query) StringSlice(key string, def []string) []string {
+	var values []string
+	for _, value := range q.Values[key] {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return def
+	}
+	return values
+}
@@ -0,0 +1,79 @@
+package toolkit
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?page=3&active=yes&since=2022-10-01&until=2022-10-02T15:04:05Z&tags=a,b&tags=c&name=jack", nil)
+	q := NewQuery(req)
+
+	if page := q.Int("page", 1); page != 3 {
+		t.Errorf("wrong page; expected 3 but got %d", page)
+	}
+	if perPage := q.Int("per_page", 20); perPage != 20 {
+		t.Errorf("wrong per_page default; expected 20 but got %d", perPage)
+	}
+	if active := q.Bool("active", false); !active {
+		t.Error("expected active to be true")
+	}
+	if since := q.Time("since", time.Time{}); !since.Equal(time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("wrong since", since)
+	}
+	if until := q.Time("until", time.Time{}); !until.Equal(time.Date(2022, 10, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Error("wrong until", until)
+	}
+	if tags := q.StringSlice("tags", nil); !reflect.DeepEqual(tags, []string{"a", "b", "c"}) {
+		t.Error("wrong tags", tags)
+	}
+	if name := q.String("name", ""); name != "jack" {
+		t.Error("wrong name", name)
+	}
+
+	if err := q.Err(); err != nil {
+		t.Error("no error expected, but got", err)
+	}
+}
+
+func TestQuery_Errors(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?page=two&active=maybe&since=yesterday", nil)
+	q := NewQuery(req)
+
+	if page := q.Int("page", 1); page != 1 {
+		t.Errorf("expected default page on error, but got %d", page)
+	}
+	q.Bool("active", false)
+	q.Time("since", time.Time{})
+
+	if q.Err() == nil {
+		t.Fatal("error expected, but none received")
+	}
+	for _, key := range []string{"page", "active", "since"} {
+		if q.Errors.Get(key) == "" {
+			t.Errorf("expected an error for %s", key)
+		}
+	}
+}
+
+func TestQuery_TimeRange(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database", err)
+	}
+
+	q := NewQuery(httptest.NewRequest("GET", "/?from=2022-10-01&to=2022-10-31", nil))
+	q.Location = paris
+	from, to := q.TimeRange("from", "to")
+	if !from.Equal(time.Date(2022, 10, 1, 0, 0, 0, 0, paris)) || !to.Equal(time.Date(2022, 10, 31, 23, 59, 59, 999999999, paris)) {
+		t.Error("wrong range", from, to)
+	}
+
+	q = NewQuery(httptest.NewRequest("GET", "/?from=2022-10-01T10:00:00Z&to=2022-10-01T09:00:00Z", nil))
+	q.TimeRange("from", "to")
+	if q.Errors.Get("to") == "" {
+		t.Error("expected an error for a range ending before it starts")
+	}
+}
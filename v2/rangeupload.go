@@ -0,0 +1,224 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidContentRange is returned by AppendUpload for Content-Range headers it can't parse, or
+	// which the body doesn't match.
+	ErrInvalidContentRange = errors.New("invalid Content-Range header")
+	// ErrUploadOffsetMismatch is returned by AppendUpload for parts which don't start where the file
+	// received so far ends. Clients should ask for the offset, and resume from there.
+	ErrUploadOffsetMismatch = errors.New("the part does not start at the end of the upload")
+	// ErrUploadInProgress is returned by AppendUpload while another part of the same file is received.
+	ErrUploadInProgress = errors.New("another part of the upload is being received")
+)
+
+// RangeUpload is the state of a file uploaded in parts with AppendUpload, ready to be sent with WriteJSON.
+type RangeUpload struct {
+	// Path is the path of the file, which holds it once it is complete.
+	Path string `json:"-"`
+	// Received is the number of bytes received so far, the offset of the next part.
+	Received int64 `json:"received"`
+	// Size is the size of the file, or -1 while the client hasn't told it.
+	Size     int64 `json:"size"`
+	Complete bool  `json:"complete"`
+}
+
+// AppendUpload receives a part of the file uploaded to path, from a PUT request with a Content-Range
+// header, such as bytes 0-1048575/5000000, for clients resuming uploads where they stopped. Parts are
+// appended to path.part, which is moved to path when the last byte is received; they must start where
+// the file received so far ends, or ErrUploadOffsetMismatch is returned. A request for bytes */5000000,
+// without a body, only returns how much was received, and one without Content-Range uploads the whole
+// file at once. The bytes received before a request fails are kept, so that clients can resume after
+// them. Files larger than Tools.MaxFileSize, or 1GB, are refused. Once complete, the file goes through
+// the checks of UploadFiles, from Tools.AllowedFileTypes to Tools.MediaProber, and is deleted if it
+// fails them.
+func (t *Tools) AppendUpload(w http.ResponseWriter, r *http.Request, path string) (*RangeUpload, error) {
+	upload := &RangeUpload{Path: path, Size: -1}
+	start, end := int64(0), int64(-1)
+	if header := r.Header.Get("Content-Range"); header != "" {
+		var err error
+		if start, end, upload.Size, err = parseContentRange(header); err != nil {
+			return nil, err
+		}
+	}
+
+	maxSize := t.MaxFileSize
+	if maxSize <= 0 {
+		maxSize = 1024 * 1024 * 1024 // 1GB
+	}
+	if upload.Size > maxSize || end >= maxSize {
+		return nil, errors.New("the uploaded file is too big")
+	}
+
+	t.rangeUploadMu.Lock()
+	if t.rangeUploads[path] {
+		t.rangeUploadMu.Unlock()
+		return nil, ErrUploadInProgress
+	}
+	if t.rangeUploads == nil {
+		t.rangeUploads = make(map[string]bool)
+	}
+	t.rangeUploads[path] = true
+	t.rangeUploadMu.Unlock()
+	defer func() {
+		t.rangeUploadMu.Lock()
+		delete(t.rangeUploads, path)
+		t.rangeUploadMu.Unlock()
+	}()
+
+	partName := path + ".part"
+	info, err := os.Stat(partName)
+	switch {
+	case err == nil:
+		upload.Received = info.Size()
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	// a status request, for bytes */size
+	if start < 0 {
+		if upload.Received == 0 && upload.Size >= 0 {
+			if _, err = os.Stat(path); err == nil {
+				upload.Received, upload.Complete = upload.Size, true
+			}
+		}
+		return upload, nil
+	}
+
+	whole := r.Header.Get("Content-Range") == ""
+	flags := os.O_RDWR | os.O_CREATE | os.O_APPEND
+	length := end - start + 1
+	if whole {
+		// a whole file replaces any part received before
+		flags |= os.O_TRUNC
+		upload.Received = 0
+		length = maxSize
+	} else if start != upload.Received {
+		return upload, ErrUploadOffsetMismatch
+	}
+
+	if err = t.CreateDirIfNotExist(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	if err = t.checkFreeDiskSpace(filepath.Dir(path), length); err != nil {
+		return nil, err
+	}
+
+	created := upload.Received == 0
+	f, err := os.OpenFile(partName, flags, t.filePerm(0666))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if created {
+		if err = t.applyFileMode(partName, false); err != nil {
+			return nil, err
+		}
+	}
+
+	n, err := t.copyUpload(f, io.LimitReader(r.Body, length))
+	upload.Received += n
+	if err != nil {
+		return upload, err
+	}
+	var extra [1]byte
+	if m, _ := io.ReadFull(r.Body, extra[:]); m > 0 {
+		// the body is longer than its range, or the file too big: none of it is kept
+		upload.Received -= n
+		if whole {
+			f.Close()
+			os.Remove(partName)
+			return upload, errors.New("the uploaded file is too big")
+		}
+		if err = f.Truncate(upload.Received); err != nil {
+			return upload, err
+		}
+		return upload, ErrInvalidContentRange
+	}
+	if whole {
+		upload.Size = upload.Received
+	} else if n != length {
+		return upload, ErrInvalidContentRange
+	}
+
+	if upload.Received != upload.Size {
+		if t.SyncWrites {
+			return upload, f.Sync()
+		}
+		return upload, nil
+	}
+	if err = t.checkCompleteUpload(r.Context(), f); err != nil {
+		f.Close()
+		os.Remove(partName)
+		upload.Received = 0
+		return upload, err
+	}
+	if err = t.commitFile(f, path); err != nil {
+		return upload, err
+	}
+	upload.Complete = true
+	return upload, nil
+}
+
+// checkCompleteUpload runs the checks of UploadFiles on f, an upload which was just completed.
+func (t *Tools) checkCompleteUpload(ctx context.Context, f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	fileType, err := t.checkUpload(f, info.Size())
+	if err != nil {
+		return err
+	}
+	if t.MediaProber != nil && (strings.HasPrefix(fileType, "video/") || strings.HasPrefix(fileType, "audio/")) {
+		_, err = t.checkMedia(ctx, f.Name())
+	}
+	return err
+}
+
+// parseContentRange returns the first and last bytes, and the size, of the Content-Range header of a
+// request, such as bytes 0-499/1000, with -1 for an unknown size (bytes 0-499/*), and a first byte of -1
+// for requests for the status of an upload (bytes */1000).
+func parseContentRange(header string) (start, end, size int64, err error) {
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, 0, ErrInvalidContentRange
+	}
+	byteRange, total, ok := strings.Cut(strings.TrimPrefix(header, "bytes "), "/")
+	if !ok {
+		return 0, 0, 0, ErrInvalidContentRange
+	}
+
+	size = -1
+	if total != "*" {
+		if size, err = strconv.ParseInt(total, 10, 64); err != nil || size < 0 {
+			return 0, 0, 0, ErrInvalidContentRange
+		}
+	}
+	if byteRange == "*" {
+		return -1, -1, size, nil
+	}
+
+	first, last, ok := strings.Cut(byteRange, "-")
+	if !ok {
+		return 0, 0, 0, ErrInvalidContentRange
+	}
+	start, err1 := strconv.ParseInt(first, 10, 64)
+	end, err2 := strconv.ParseInt(last, 10, 64)
+	if err1 != nil || err2 != nil || start < 0 || end < start || size >= 0 && end >= size {
+		return 0, 0, 0, ErrInvalidContentRange
+	}
+	return start, end, size, nil
+}
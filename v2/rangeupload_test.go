@@ -0,0 +1,122 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header           string
+		start, end, size int64
+		valid            bool
+	}{
+		{header: "bytes 0-499/1000", start: 0, end: 499, size: 1000, valid: true},
+		{header: "bytes 500-999/*", start: 500, end: 999, size: -1, valid: true},
+		{header: "bytes */1000", start: -1, end: -1, size: 1000, valid: true},
+		{header: "bytes 0-1000/1000"},
+		{header: "bytes 10-5/100"},
+		{header: "bytes 0-5"},
+		{header: "items 0-5/10"},
+		{header: "bytes -5/10"},
+	}
+	for _, test := range tests {
+		start, end, size, err := parseContentRange(test.header)
+		if !test.valid {
+			if !errors.Is(err, ErrInvalidContentRange) {
+				t.Errorf("%s: expected ErrInvalidContentRange, got %v", test.header, err)
+			}
+			continue
+		}
+		if err != nil || start != test.start || end != test.end || size != test.size {
+			t.Errorf("%s: wrong range %d-%d/%d %v", test.header, start, end, size, err)
+		}
+	}
+}
+
+func TestTools_AppendUpload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "uploads", "video.bin")
+	content := "0123456789abcdefghij"
+
+	var testTools Tools
+	put := func(contentRange, body string) (*RangeUpload, error) {
+		request := httptest.NewRequest("PUT", "/uploads/video.bin", strings.NewReader(body))
+		if contentRange != "" {
+			request.Header.Set("Content-Range", contentRange)
+		}
+		return testTools.AppendUpload(httptest.NewRecorder(), request, path)
+	}
+
+	upload, err := put("bytes 0-7/20", content[:8])
+	if err != nil || upload.Received != 8 || upload.Complete {
+		t.Fatalf("wrong first part %+v %v", upload, err)
+	}
+
+	// a part which doesn't start at the offset is refused, and the client can ask where to resume
+	if upload, err = put("bytes 10-19/20", content[10:]); !errors.Is(err, ErrUploadOffsetMismatch) || upload.Received != 8 {
+		t.Errorf("expected ErrUploadOffsetMismatch at 8, got %+v %v", upload, err)
+	}
+	if upload, err = put("bytes */20", ""); err != nil || upload.Received != 8 || upload.Size != 20 {
+		t.Errorf("wrong status %+v %v", upload, err)
+	}
+
+	// a part longer than its range is not kept, a shorter one is
+	if _, err = put("bytes 8-9/20", content[8:12]); !errors.Is(err, ErrInvalidContentRange) {
+		t.Error("expected ErrInvalidContentRange, got", err)
+	}
+	if upload, err = put("bytes 8-13/20", content[8:12]); !errors.Is(err, ErrInvalidContentRange) || upload.Received != 12 {
+		t.Errorf("expected the short part to be kept, got %+v %v", upload, err)
+	}
+
+	if upload, err = put("bytes 12-19/20", content[12:]); err != nil || !upload.Complete || upload.Received != 20 {
+		t.Fatalf("wrong last part %+v %v", upload, err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != content {
+		t.Errorf("wrong file %q", b)
+	}
+	if _, err = os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Error("expected the partial file to be gone")
+	}
+	if upload, err = put("bytes */20", ""); err != nil || !upload.Complete {
+		t.Errorf("expected a complete upload, got %+v %v", upload, err)
+	}
+
+	// without Content-Range, the whole file is uploaded at once
+	if upload, err = put("", "whole"); err != nil || !upload.Complete || upload.Size != 5 {
+		t.Errorf("wrong whole upload %+v %v", upload, err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "whole" {
+		t.Errorf("wrong file %q", b)
+	}
+
+	testTools.MaxFileSize = 10
+	if _, err = put("bytes 0-9/20", content[:10]); err == nil {
+		t.Error("expected an error for a file too big")
+	}
+	if _, err = put("", content); err == nil {
+		t.Error("expected an error for a whole file too big")
+	}
+	if _, err = os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Error("expected a whole file too big not to be kept")
+	}
+
+	// once complete, the file goes through the checks of UploadFiles
+	testTools = Tools{AllowedFileTypes: []string{"image"}}
+	path = filepath.Join(dir, "uploads", "avatar.png")
+	if upload, err = put("bytes 0-9/20", content[:10]); err != nil || upload.Received != 10 {
+		t.Fatalf("wrong first part %+v %v", upload, err)
+	}
+	if upload, err = put("bytes 10-19/20", content[10:]); err == nil || upload.Complete || upload.Received != 0 {
+		t.Errorf("expected a file of the wrong type to be refused, got %+v %v", upload, err)
+	}
+	for _, name := range []string{path, path + ".part"} {
+		if _, err = os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be deleted", name)
+		}
+	}
+}
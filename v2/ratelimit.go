@@ -0,0 +1,216 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitResult is the outcome of recording a request against a rate limit.
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// RateLimitStore is the interface implemented by the stores holding rate limit counters.
+// The in-memory MemoryRateLimitStore suits a single server; a shared store, such as Redis,
+// lets several servers enforce one limit together.
+type RateLimitStore interface {
+	// Hit records a request for key, and reports whether it is within limit requests per window.
+	Hit(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+// RateLimitOptions is the type used to configure the RateLimit middleware.
+type RateLimitOptions struct {
+	// Requests is the number of requests permitted per Window for each key.
+	Requests int
+	Window   time.Duration
+	// KeyFunc returns the key requests are counted under. Defaults to the client IP address found by RealIP.
+	KeyFunc func(r *http.Request) string
+	// Store holds the counters. Defaults to a CacheRateLimitStore if Tools.Cache is a CounterCache,
+	// or a new MemoryRateLimitStore otherwise.
+	Store RateLimitStore
+}
+
+// RateLimit returns middleware which limits each key, by default each client IP address, to opts.Requests
+// requests per opts.Window. Requests over the limit are refused with a 429 JSON error and a Retry-After header.
+// If the store fails, the error is logged and requests are let through, rather than taking the whole API down.
+func (t *Tools) RateLimit(opts RateLimitOptions) func(http.Handler) http.Handler {
+	if opts.KeyFunc == nil {
+		opts.KeyFunc = t.RealIP
+	}
+	if opts.Store == nil {
+		if counters, ok := t.Cache.(CounterCache); ok {
+			opts.Store = NewCacheRateLimitStore(counters)
+		} else {
+			opts.Store = NewMemoryRateLimitStore()
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := opts.KeyFunc(r)
+			result, err := opts.Store.Hit(r.Context(), key, opts.Requests, opts.Window)
+			if err != nil {
+				t.logger().Error("rate limit store error", "err", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(opts.Requests))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+
+			if !result.Allowed {
+				t.logger().Debug("rate limit exceeded", "key", key, "path", r.URL.Path)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+				_ = t.ErrorJSON(w, errors.New("rate limit exceeded"), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimitByIP is a RateLimitOptions.KeyFunc which counts requests per connecting IP address.
+// Behind a reverse proxy, use Tools.RealIP instead.
+func RateLimitByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RateLimitByHeader returns a RateLimitOptions.KeyFunc which counts requests per value of the header name,
+// such as an API key, falling back to the client IP address when the header is missing.
+func RateLimitByHeader(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if value := r.Header.Get(name); value != "" {
+			return name + ":" + value
+		}
+		return RateLimitByIP(r)
+	}
+}
+
+// MemoryRateLimitStore is a RateLimitStore which keeps its counters in memory, using a sliding window:
+// the count of the previous window is weighted by how much of it still overlaps the sliding window,
+// which smooths out the bursts a fixed window allows at its edges.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// rateWindow holds the counters of one key.
+type rateWindow struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+// NewMemoryRateLimitStore returns an empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		windows: make(map[string]*rateWindow),
+		now:     time.Now,
+	}
+}
+
+// Hit records a request for key, and reports whether it is within limit requests per window.
+func (s *MemoryRateLimitStore) Hit(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	if window <= 0 {
+		return RateLimitResult{}, errors.New("rate limit window must be positive")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now, window)
+
+	w, ok := s.windows[key]
+	if !ok {
+		w = &rateWindow{start: now.Truncate(window)}
+		s.windows[key] = w
+	}
+
+	// move the window forward, carrying the last count over if it was the window just before this one
+	if elapsed := now.Sub(w.start); elapsed >= window {
+		if elapsed < 2*window {
+			w.previous = w.current
+		} else {
+			w.previous = 0
+		}
+		w.current = 0
+		w.start = now.Truncate(window)
+	}
+
+	overlap := 1 - float64(now.Sub(w.start))/float64(window)
+	count := float64(w.previous)*overlap + float64(w.current)
+
+	if count+1 > float64(limit) {
+		// wait until enough of the previous window has slid out, or the current window ends
+		retryAfter := w.start.Add(window).Sub(now)
+		if w.previous > 0 && float64(w.current)+1 <= float64(limit) {
+			needed := (count + 1 - float64(limit)) / float64(w.previous)
+			retryAfter = time.Duration(needed * float64(window))
+		}
+		return RateLimitResult{Allowed: false, Remaining: 0, RetryAfter: retryAfter}, nil
+	}
+
+	w.current++
+	return RateLimitResult{Allowed: true, Remaining: int(float64(limit) - count - 1)}, nil
+}
+
+// sweep forgets keys which haven't been seen for two windows, at most once per window.
+func (s *MemoryRateLimitStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	s.lastSweep = now
+
+	for key, w := range s.windows {
+		if now.Sub(w.start) >= 2*window {
+			delete(s.windows, key)
+		}
+	}
+}
+
+// CacheRateLimitStore is a RateLimitStore which keeps its counters in a CounterCache, such as a cache
+// shared by several servers. It uses fixed windows, which only need one counter per key and window.
+type CacheRateLimitStore struct {
+	cache CounterCache
+	now   func() time.Time
+}
+
+// NewCacheRateLimitStore returns a CacheRateLimitStore keeping its counters in cache.
+func NewCacheRateLimitStore(cache CounterCache) *CacheRateLimitStore {
+	return &CacheRateLimitStore{cache: cache, now: time.Now}
+}
+
+// Hit records a request for key, and reports whether it is within limit requests per window.
+func (s *CacheRateLimitStore) Hit(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	if window <= 0 {
+		return RateLimitResult{}, errors.New("rate limit window must be positive")
+	}
+
+	now := s.now()
+	start := now.Truncate(window)
+	count, err := s.cache.Increment(ctx, "ratelimit:"+key+":"+strconv.FormatInt(start.UnixNano(), 10), window)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	if count > int64(limit) {
+		return RateLimitResult{Allowed: false, Remaining: 0, RetryAfter: start.Add(window).Sub(now)}, nil
+	}
+	return RateLimitResult{Allowed: true, Remaining: limit - int(count)}, nil
+}
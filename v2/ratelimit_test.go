@@ -0,0 +1,124 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		result, _ := store.Hit(ctx, "key", 3, time.Minute)
+		if !result.Allowed {
+			t.Fatalf("request %d should be allowed", i+1)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("request %d: wrong remaining count %d", i+1, result.Remaining)
+		}
+	}
+
+	result, _ := store.Hit(ctx, "key", 3, time.Minute)
+	if result.Allowed {
+		t.Error("fourth request should be refused")
+	}
+	if result.RetryAfter != time.Minute {
+		t.Errorf("wrong retry after %s", result.RetryAfter)
+	}
+
+	// other keys have their own limit
+	if result, _ = store.Hit(ctx, "other", 3, time.Minute); !result.Allowed {
+		t.Error("request for another key should be allowed")
+	}
+
+	// half way through the next window, half of the previous window's requests still count
+	now = now.Add(90 * time.Second)
+	if result, _ = store.Hit(ctx, "key", 3, time.Minute); !result.Allowed {
+		t.Error("request should be allowed once the window has slid")
+	}
+	if result, _ = store.Hit(ctx, "key", 3, time.Minute); result.Allowed {
+		t.Error("request should be refused while the previous window still counts")
+	}
+
+	// long after, everything is forgotten
+	now = now.Add(10 * time.Minute)
+	if result, _ = store.Hit(ctx, "key", 3, time.Minute); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("expected a fresh window, got %+v", result)
+	}
+	if len(store.windows) != 1 {
+		t.Errorf("expected stale keys to be swept, but %d remain", len(store.windows))
+	}
+}
+
+// failingStore is a RateLimitStore which always fails.
+type failingStore struct{}
+
+func (failingStore) Hit(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store unavailable")
+}
+
+func TestTools_RateLimit(t *testing.T) {
+	var testTools Tools
+
+	handler := testTools.RateLimit(RateLimitOptions{Requests: 2, Window: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	expected := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i, status := range expected {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if rr.Code != status {
+			t.Errorf("request %d: wrong status code; expected %d but got %d", i+1, status, rr.Code)
+		}
+		if status == http.StatusTooManyRequests && rr.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+	}
+
+	// a different client is not affected
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("wrong status code for another client; expected 200 but got %d", rr.Code)
+	}
+}
+
+func TestTools_RateLimitByHeader(t *testing.T) {
+	var testTools Tools
+
+	handler := testTools.RateLimit(RateLimitOptions{Requests: 1, Window: time.Minute, KeyFunc: RateLimitByHeader("X-API-Key")})(http.NotFoundHandler())
+
+	for _, key := range []string{"one", "two"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", key)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code == http.StatusTooManyRequests {
+			t.Errorf("api key %s should have its own limit", key)
+		}
+	}
+}
+
+func TestTools_RateLimitStoreFailure(t *testing.T) {
+	testTools := Tools{ErrorLog: discardLog}
+
+	handler := testTools.RateLimit(RateLimitOptions{Requests: 1, Window: time.Minute, Store: failingStore{}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("requests should be let through when the store fails, but got %d", rr.Code)
+	}
+}
@@ -0,0 +1,38 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover is middleware which recovers from panics in the next handler. The panic and its stack trace
+// are logged to Tools.Logger, and the client receives a generic 500 JSON error, so that no internal
+// details leak out and the connection isn't dropped silently. If the handler had already started its
+// response, only the panic is logged.
+func (t *Tools) Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := NewResponseWriter(w)
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// http.ErrAbortHandler is used on purpose to abort a response, so let the server deal with it
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			t.logger().Error("panic serving request", "method", r.Method, "path", r.URL.Path,
+				"request_id", RequestIDFromContext(r.Context()), "panic", err, "stack", string(debug.Stack()))
+
+			if rw.Written() {
+				return
+			}
+			w.Header().Set("Connection", "close")
+			_ = t.ErrorJSON(rw, errors.New(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
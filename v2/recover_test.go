@@ -0,0 +1,97 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTools_Recover(t *testing.T) {
+	var logged bytes.Buffer
+	testTools := Tools{ErrorLog: log.New(&logged, "", 0)}
+
+	handler := testTools.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something went badly wrong")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/boom", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("wrong status code returned; expected 500, but got %d", rr.Code)
+	}
+
+	var payload JSONResponse
+	if err := json.NewDecoder(rr.Body).Decode(&payload); err != nil {
+		t.Fatal("received error when decoding JSON", err)
+	}
+	if !payload.Error || strings.Contains(payload.Message, "badly wrong") {
+		t.Errorf("wrong payload %+v", payload)
+	}
+
+	if !strings.Contains(logged.String(), "something went badly wrong") || !strings.Contains(logged.String(), "goroutine") {
+		t.Error("expected the panic and stack trace to be logged, but got", logged.String())
+	}
+}
+
+func TestTools_RecoverAbortHandler(t *testing.T) {
+	testTools := Tools{ErrorLog: discardLog}
+
+	handler := testTools.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Error("expected http.ErrAbortHandler to be re-panicked, but got", err)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestTools_ErrorJSONProblemDetails(t *testing.T) {
+	testTools := Tools{UseProblemDetails: true}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.ErrorJSON(rr, ValidationErrors{"name": {"this field cannot be blank"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.Header().Get("Content-Type") != "application/problem+json" {
+		t.Error("wrong content type", rr.Header().Get("Content-Type"))
+	}
+
+	var problem ProblemDetails
+	if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+		t.Fatal("received error when decoding JSON", err)
+	}
+	if problem.Status != http.StatusUnprocessableEntity || problem.Title != "Unprocessable Entity" || problem.Errors.Get("name") == "" {
+		t.Errorf("wrong problem details %+v", problem)
+	}
+}
+
+// discardLog is a logger for tests which expect errors to be logged, but don't check them.
+var discardLog = log.New(io.Discard, "", 0)
+
+func TestTools_RecoverAfterWrite(t *testing.T) {
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+	handler := testTools.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("boom")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "partial" {
+		t.Errorf("expected the partial response only, got %d %s", rr.Code, rr.Body)
+	}
+	if !logger.contains("ERROR panic serving request") {
+		t.Error("expected the panic to be logged")
+	}
+}
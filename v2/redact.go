@@ -0,0 +1,190 @@
+package toolkit
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Redacted is the value Redact gives to the string fields tagged `redact:"true"`.
+const Redacted = "[REDACTED]"
+
+// MaskEmail masks the local part of an email address but its first character, such as "j*******@example.com".
+func MaskEmail(email string) string {
+	local, domain, found := strings.Cut(email, "@")
+	if !found || local == "" {
+		return maskRunes(email, 0)
+	}
+	first := []rune(local)[0]
+	return string(first) + strings.Repeat("*", len([]rune(local))-1) + "@" + domain
+}
+
+// MaskPhone masks the digits of a phone number but the last four, keeping its formatting,
+// such as "+* ***-***-4567".
+func MaskPhone(phone string) string {
+	return maskDigits(phone, 4)
+}
+
+// MaskCard masks the digits of a payment card number but the last four, keeping its formatting,
+// such as "**** **** **** 1111".
+func MaskCard(number string) string {
+	return maskDigits(number, 4)
+}
+
+// maskDigits replaces the digits of s with asterisks, but the last keep ones.
+func maskDigits(s string, keep int) string {
+	digits := 0
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			digits--
+			if digits >= keep {
+				r = '*'
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// maskRunes replaces the runes of s with asterisks, but the first keep ones.
+func maskRunes(s string, keep int) string {
+	runes := []rune(s)
+	for i := keep; i < len(runes); i++ {
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+// Redact returns a copy of v in which the struct fields tagged with redact are blanked, so that v can be
+// logged, audited or sent with WriteJSON without leaking personal data. Structs are found within pointers,
+// slices, arrays, maps and interfaces. The tag value chooses how a field is blanked:
+//
+//	Password string `redact:"true"`  // "[REDACTED]" for strings, the zero value for other types
+//	Email    string `redact:"email"` // masked with MaskEmail
+//	Phone    string `redact:"phone"` // masked with MaskPhone
+//	Card     string `redact:"card"`  // masked with MaskCard
+//
+// tags names the struct tags read, such as "redact" and "pii" for data shared with a library tagging
+// its own fields; it defaults to "redact". Unexported fields are copied as they are.
+func Redact(v any, tags ...string) any {
+	if v == nil {
+		return nil
+	}
+	if len(tags) == 0 {
+		tags = []string{"redact"}
+	}
+	return redactValue(reflect.ValueOf(v), tags, 0).Interface()
+}
+
+// redactMaxDepth bounds how deep Redact goes, so that cyclic data doesn't recurse forever. Deeper values
+// are zeroed rather than copied, as Redact can't tell what they hold.
+const redactMaxDepth = 32
+
+// redactValue returns a redacted copy of v.
+func redactValue(v reflect.Value, tags []string, depth int) reflect.Value {
+	if depth > redactMaxDepth {
+		return reflect.Zero(v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(redactValue(v.Elem(), tags, depth+1))
+		return out
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(redactValue(v.Elem(), tags, depth+1))
+		return out
+
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if tag, ok := redactTag(field.Tag, tags); ok {
+				out.Field(i).Set(redactField(v.Field(i), tag))
+				continue
+			}
+			out.Field(i).Set(redactValue(v.Field(i), tags, depth+1))
+		}
+		return out
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redactValue(v.Index(i), tags, depth+1))
+		}
+		return out
+
+	case reflect.Array:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redactValue(v.Index(i), tags, depth+1))
+		}
+		return out
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), redactValue(iter.Value(), tags, depth+1))
+		}
+		return out
+	}
+
+	return v
+}
+
+// redactTag returns the value of the first of tags set on a field, unless it is "false" or "-".
+func redactTag(st reflect.StructTag, tags []string) (string, bool) {
+	for _, name := range tags {
+		if tag, ok := st.Lookup(name); ok {
+			return tag, tag != "false" && tag != "-"
+		}
+	}
+	return "", false
+}
+
+// redactField returns the blanked value of a field tagged `redact:"tag"`.
+func redactField(v reflect.Value, tag string) reflect.Value {
+	if v.Kind() == reflect.String {
+		out := reflect.New(v.Type()).Elem()
+		switch tag {
+		case "email":
+			out.SetString(MaskEmail(v.String()))
+		case "phone":
+			out.SetString(MaskPhone(v.String()))
+		case "card":
+			out.SetString(MaskCard(v.String()))
+		default:
+			if v.String() != "" {
+				out.SetString(Redacted)
+			}
+		}
+		return out
+	}
+	return reflect.Zero(v.Type())
+}
@@ -0,0 +1,152 @@
+package toolkit
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+var maskTests = []struct {
+	name     string
+	mask     func(string) string
+	input    string
+	expected string
+}{
+	{name: "email", mask: MaskEmail, input: "john.doe@example.com", expected: "j*******@example.com"},
+	{name: "short email", mask: MaskEmail, input: "j@example.com", expected: "j@example.com"},
+	{name: "not an email", mask: MaskEmail, input: "john", expected: "****"},
+	{name: "phone", mask: MaskPhone, input: "+1 555-123-4567", expected: "+* ***-***-4567"},
+	{name: "short phone", mask: MaskPhone, input: "123", expected: "123"},
+	{name: "card", mask: MaskCard, input: "4111 1111 1111 1111", expected: "**** **** **** 1111"},
+	{name: "card without spaces", mask: MaskCard, input: "4111111111111111", expected: "************1111"},
+}
+
+func TestMask(t *testing.T) {
+	for _, e := range maskTests {
+		if result := e.mask(e.input); result != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, result)
+		}
+	}
+}
+
+type redactAddress struct {
+	Street string `redact:"true"`
+	City   string
+}
+
+type redactUser struct {
+	Name     string
+	Password string `redact:"true"`
+	Email    string `redact:"email"`
+	Phone    string `redact:"phone"`
+	Card     string `redact:"card"`
+	PIN      int    `redact:"true"`
+	Empty    string `redact:"true"`
+	Address  *redactAddress
+	Previous []redactAddress
+	Extra    map[string]any
+	secret   string
+}
+
+func TestRedact(t *testing.T) {
+	user := &redactUser{
+		Name:     "John",
+		Password: "hunter2",
+		Email:    "john@example.com",
+		Phone:    "555-123-4567",
+		Card:     "4111111111111111",
+		PIN:      1234,
+		Address:  &redactAddress{Street: "1 Main St", City: "Springfield"},
+		Previous: []redactAddress{{Street: "2 Elm St", City: "Shelbyville"}},
+		Extra:    map[string]any{"billing": redactAddress{Street: "3 Oak St", City: "Ogdenville"}, "plain": "kept"},
+		secret:   "copied",
+	}
+
+	redacted := Redact(user).(*redactUser)
+
+	expected := &redactUser{
+		Name:     "John",
+		Password: Redacted,
+		Email:    "j***@example.com",
+		Phone:    "***-***-4567",
+		Card:     "************1111",
+		Address:  &redactAddress{Street: Redacted, City: "Springfield"},
+		Previous: []redactAddress{{Street: Redacted, City: "Shelbyville"}},
+		Extra:    map[string]any{"billing": redactAddress{Street: Redacted, City: "Ogdenville"}, "plain": "kept"},
+		secret:   "copied",
+	}
+	if !reflect.DeepEqual(redacted, expected) {
+		t.Errorf("wrong result\n got %+v\nwant %+v", redacted, expected)
+	}
+
+	// the original is untouched
+	if user.Password != "hunter2" || user.Address.Street != "1 Main St" || user.Extra["billing"].(redactAddress).Street != "3 Oak St" {
+		t.Error("Redact must not modify its argument")
+	}
+
+	if Redact(nil) != nil || Redact("plain") != "plain" {
+		t.Error("values without structs must be returned as they are")
+	}
+}
+
+func TestRedact_Cycle(t *testing.T) {
+	type node struct {
+		Secret string `redact:"true"`
+		Next   *node
+	}
+	cycle := &node{Secret: "hunter2"}
+	cycle.Next = cycle
+
+	depth := 0
+	for n := Redact(cycle).(*node); n != nil; n = n.Next {
+		if n.Secret == "hunter2" || n == cycle {
+			t.Fatalf("expected every copied node to be redacted or zeroed, got %q at depth %d", n.Secret, depth)
+		}
+		depth++
+	}
+	if depth == 0 || depth > redactMaxDepth {
+		t.Errorf("expected the copy to end at the depth limit, got %d nodes", depth)
+	}
+}
+
+func TestRedact_Tags(t *testing.T) {
+	type account struct {
+		Login    string
+		Token    string `pii:"true"`
+		Password string `redact:"true"`
+		Email    string `pii:"email" redact:"false"`
+	}
+	original := account{Login: "john", Token: "tok_123", Password: "hunter2", Email: "john@example.com"}
+
+	tests := []struct {
+		name     string
+		tags     []string
+		expected account
+	}{
+		{name: "default", expected: account{Login: "john", Token: "tok_123", Password: Redacted, Email: "john@example.com"}},
+		{name: "pii", tags: []string{"pii"}, expected: account{Login: "john", Token: Redacted, Password: "hunter2", Email: "j***@example.com"}},
+		{name: "both", tags: []string{"redact", "pii"}, expected: account{Login: "john", Token: Redacted, Password: Redacted, Email: "john@example.com"}},
+	}
+	for _, test := range tests {
+		if redacted := Redact(original, test.tags...).(account); redacted != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, redacted)
+		}
+	}
+}
+
+func TestAuditLogger_Redact(t *testing.T) {
+	var logged AuditEvent
+	var testTools Tools
+	audit := testTools.NewAuditLogger(AuditSinkFunc(func(ctx context.Context, event AuditEvent) error {
+		logged = event
+		return nil
+	}))
+
+	_ = audit.Log(context.Background(), AuditEvent{
+		Action:   "user.update",
+		Metadata: map[string]any{"user": redactUser{Name: "John", Password: "hunter2"}},
+	})
+	if user := logged.Metadata["user"].(redactUser); user.Password != Redacted || user.Name != "John" {
+		t.Error("expected the metadata to be redacted, got", user)
+	}
+}
@@ -0,0 +1,380 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisOptions is the type used to configure NewRedisCache.
+type RedisOptions struct {
+	// Addr is the host:port of the Redis server. Defaults to localhost:6379.
+	Addr     string
+	Username string
+	Password string
+	DB       int
+	// Namespace is prepended to every key, so that several applications can share a server.
+	Namespace string
+	// DialTimeout defaults to 5 seconds.
+	DialTimeout time.Duration
+	// Timeout applies to each command whose context has no deadline. Defaults to 5 seconds.
+	Timeout time.Duration
+	// MaxIdleConns is the number of connections kept open for reuse. Defaults to 10.
+	MaxIdleConns int
+	// TLSConfig, if set, is used to connect to the server over TLS.
+	TLSConfig *tls.Config
+}
+
+// RedisError is an error reply sent by the Redis server.
+type RedisError string
+
+func (e RedisError) Error() string { return string(e) }
+
+// RedisCache is a CounterCache and Locker backed by a Redis server, speaking the RESP protocol directly.
+type RedisCache struct {
+	opts RedisOptions
+	idle chan *redisConn
+}
+
+// redisConn is a connection to the Redis server.
+type redisConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// NewRedisCache returns a RedisCache using the server described by opts. Connections are opened on demand.
+func NewRedisCache(opts RedisOptions) *RedisCache {
+	if opts.Addr == "" {
+		opts.Addr = "localhost:6379"
+	}
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = 10
+	}
+	opts.DialTimeout = durationOr(opts.DialTimeout, 5*time.Second)
+	opts.Timeout = durationOr(opts.Timeout, 5*time.Second)
+
+	return &RedisCache{opts: opts, idle: make(chan *redisConn, opts.MaxIdleConns)}
+}
+
+// Get returns the value stored under key, or ErrCacheMiss if there is none.
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := c.Do(ctx, "GET", c.key(key))
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrCacheMiss
+	}
+	return reply.([]byte), nil
+}
+
+// GetMulti returns the values stored under keys, fetched with a single MGET. Keys without a value are left out.
+func (c *RedisCache) GetMulti(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+
+	args := make([]string, 0, len(keys)+1)
+	args = append(args, "MGET")
+	for _, key := range keys {
+		args = append(args, c.key(key))
+	}
+
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range reply.([]any) {
+		if value != nil {
+			values[keys[i]] = value.([]byte)
+		}
+	}
+	return values, nil
+}
+
+// Set stores value under key for ttl. A zero ttl means the value doesn't expire.
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", c.key(key), string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", redisMillis(ttl))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// redisMillis formats ttl in milliseconds for PX and PEXPIRE, rounding up, so that a ttl shorter than
+// a millisecond doesn't become 0, which Redis refuses or reads as no expiry.
+func redisMillis(ttl time.Duration) string {
+	if ttl <= 0 {
+		return "0"
+	}
+	return strconv.FormatInt(int64((ttl+time.Millisecond-1)/time.Millisecond), 10)
+}
+
+// Delete removes the value stored under key, if any.
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	_, err := c.Do(ctx, "DEL", c.key(key))
+	return err
+}
+
+// Flush removes every key in the namespace. Without a namespace, the whole database is emptied.
+func (c *RedisCache) Flush(ctx context.Context) error {
+	if c.opts.Namespace == "" {
+		_, err := c.Do(ctx, "FLUSHDB")
+		return err
+	}
+
+	cursor := "0"
+	for {
+		reply, err := c.Do(ctx, "SCAN", cursor, "MATCH", c.opts.Namespace+"*", "COUNT", "1000")
+		if err != nil {
+			return err
+		}
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return errors.New("unexpected SCAN reply")
+		}
+
+		cursor = string(page[0].([]byte))
+		keys := page[1].([]any)
+		if len(keys) > 0 {
+			args := []string{"DEL"}
+			for _, key := range keys {
+				args = append(args, string(key.([]byte)))
+			}
+			if _, err = c.Do(ctx, args...); err != nil {
+				return err
+			}
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// redisIncrementScript increments a counter, setting its expiry when it is created, in one atomic step.
+const redisIncrementScript = `local n = redis.call("INCR", KEYS[1])
+if n == 1 and tonumber(ARGV[1]) > 0 then redis.call("PEXPIRE", KEYS[1], ARGV[1]) end
+return n`
+
+// Increment adds one to the counter stored under key, creating it with a value of one, expiring
+// after ttl, if it doesn't exist, and returns the new value.
+func (c *RedisCache) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	reply, err := c.Do(ctx, "EVAL", redisIncrementScript, "1", c.key(key), redisMillis(ttl))
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, errors.New("unexpected INCR reply")
+	}
+	return n, nil
+}
+
+// redisUnlockScript deletes a lock only if it still holds our token, so that a lock which expired
+// and was taken by someone else isn't released by mistake.
+const redisUnlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end
+return 0`
+
+// TryLock acquires the lock called key for ttl, with SET NX PX, or returns ErrLockNotAcquired if it is held
+// elsewhere. The returned function releases the lock; otherwise, it expires after ttl.
+func (c *RedisCache) TryLock(ctx context.Context, key string, ttl time.Duration) (func() error, error) {
+	var token [16]byte
+	if _, err := rand.Read(token[:]); err != nil {
+		return nil, err
+	}
+	value := hex.EncodeToString(token[:])
+	lockKey := c.key("lock:" + key)
+
+	reply, err := c.Do(ctx, "SET", lockKey, value, "NX", "PX", redisMillis(ttl))
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrLockNotAcquired
+	}
+
+	return func() error {
+		_, err := c.Do(context.Background(), "EVAL", redisUnlockScript, "1", lockKey, value)
+		return err
+	}, nil
+}
+
+// Do sends a command to the server, and returns its reply: nil, a string for status replies,
+// an int64, a []byte, or a []any of those. Error replies are returned as a RedisError.
+func (c *RedisCache) Do(ctx context.Context, args ...string) (any, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(c.opts.Timeout)
+	}
+	if err = conn.conn.SetDeadline(deadline); err != nil {
+		conn.conn.Close()
+		return nil, err
+	}
+
+	reply, err := conn.do(args...)
+	c.release(conn, err)
+	return reply, err
+}
+
+// Close closes the idle connections.
+func (c *RedisCache) Close() error {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// key returns key within the namespace.
+func (c *RedisCache) key(key string) string {
+	return c.opts.Namespace + key
+}
+
+// conn returns an idle connection, or opens a new one.
+func (c *RedisCache) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: c.opts.DialTimeout}
+	var netConn net.Conn
+	var err error
+	if c.opts.TLSConfig != nil {
+		netConn, err = (&tls.Dialer{NetDialer: dialer, Config: c.opts.TLSConfig}).DialContext(ctx, "tcp", c.opts.Addr)
+	} else {
+		netConn, err = dialer.DialContext(ctx, "tcp", c.opts.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{conn: netConn, br: bufio.NewReader(netConn)}
+	_ = netConn.SetDeadline(time.Now().Add(c.opts.Timeout))
+
+	if c.opts.Password != "" {
+		args := []string{"AUTH", c.opts.Password}
+		if c.opts.Username != "" {
+			args = []string{"AUTH", c.opts.Username, c.opts.Password}
+		}
+		if _, err = conn.do(args...); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+	if c.opts.DB != 0 {
+		if _, err = conn.do("SELECT", strconv.Itoa(c.opts.DB)); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// release returns conn to the idle connections, unless err shows the connection can't be reused.
+func (c *RedisCache) release(conn *redisConn, err error) {
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		conn.conn.Close()
+		return
+	}
+
+	select {
+	case c.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+// do writes a command, and reads its reply.
+func (rc *redisConn) do(args ...string) (any, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(rc.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readRESP(rc.br)
+}
+
+// readRESP reads a single RESP reply from br.
+func readRESP(br *bufio.Reader) (any, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, errors.New("malformed redis reply")
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, RedisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < -1 {
+			return nil, errors.New("malformed redis bulk string length")
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(br, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < -1 {
+			return nil, errors.New("malformed redis array length")
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			// an error inside an array is a value, not a failure of the whole reply
+			item, err := readRESP(br)
+			var redisErr RedisError
+			if err != nil && !errors.As(err, &redisErr) {
+				return nil, err
+			}
+			if err != nil {
+				item = redisErr
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown redis reply type %q", kind)
+	}
+}
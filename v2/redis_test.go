@@ -0,0 +1,285 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a tiny in-memory Redis server, understanding just the commands RedisCache sends.
+type fakeRedis struct {
+	mu       sync.Mutex
+	data     map[string]string
+	expires  map[string]time.Time
+	commands []string
+	ln       net.Listener
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{data: map[string]string{}, expires: map[string]time.Time{}, ln: ln}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for {
+		reply, err := readRESP(br)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]any) {
+			args = append(args, string(arg.([]byte)))
+		}
+		if _, err = io.WriteString(conn, s.handle(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeRedis) get(key string) (string, bool) {
+	if exp, ok := s.expires[key]; ok && time.Now().After(exp) {
+		delete(s.data, key)
+		delete(s.expires, key)
+	}
+	v, ok := s.data[key]
+	return v, ok
+}
+
+func bulk(v string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v) }
+
+func (s *fakeRedis) handle(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, strings.Join(args, " "))
+
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		if args[len(args)-1] != "secret" {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		if v, ok := s.get(args[1]); ok {
+			return bulk(v)
+		}
+		return "$-1\r\n"
+	case "MGET":
+		out := fmt.Sprintf("*%d\r\n", len(args)-1)
+		for _, key := range args[1:] {
+			if v, ok := s.get(key); ok {
+				out += bulk(v)
+			} else {
+				out += "$-1\r\n"
+			}
+		}
+		return out
+	case "SET":
+		key, value := args[1], args[2]
+		nx := false
+		var ttl time.Duration
+		for i := 3; i < len(args); i++ {
+			switch args[i] {
+			case "NX":
+				nx = true
+			case "PX":
+				ms, _ := strconv.Atoi(args[i+1])
+				ttl = time.Duration(ms) * time.Millisecond
+				i++
+			}
+		}
+		if _, exists := s.get(key); nx && exists {
+			return "$-1\r\n"
+		}
+		s.data[key] = value
+		delete(s.expires, key)
+		if ttl > 0 {
+			s.expires[key] = time.Now().Add(ttl)
+		}
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := s.data[key]; ok {
+				delete(s.data, key)
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "SCAN":
+		prefix := strings.TrimSuffix(args[3], "*")
+		var keys []string
+		for key := range s.data {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, bulk(key))
+			}
+		}
+		return fmt.Sprintf("*2\r\n%s*%d\r\n%s", bulk("0"), len(keys), strings.Join(keys, ""))
+	case "EVAL":
+		switch args[1] {
+		case redisIncrementScript:
+			v, _ := s.get(args[3])
+			n, _ := strconv.Atoi(v)
+			n++
+			s.data[args[3]] = strconv.Itoa(n)
+			if ms, _ := strconv.Atoi(args[4]); n == 1 && ms > 0 {
+				s.expires[args[3]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			return fmt.Sprintf(":%d\r\n", n)
+		case redisUnlockScript:
+			if v, ok := s.get(args[3]); ok && v == args[4] {
+				delete(s.data, args[3])
+				return ":1\r\n"
+			}
+			return ":0\r\n"
+		}
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func TestRedisCache(t *testing.T) {
+	server := newFakeRedis(t)
+	cache := NewRedisCache(RedisOptions{Addr: server.ln.Addr().String(), Password: "secret", DB: 2, Namespace: "app:"})
+	defer cache.Close()
+	ctx := context.Background()
+
+	if _, err := cache.Get(ctx, "missing"); !errors.Is(err, ErrCacheMiss) {
+		t.Error("expected ErrCacheMiss, got", err)
+	}
+
+	if err := cache.Set(ctx, "greeting", []byte("hello\r\nworld"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := cache.Get(ctx, "greeting"); err != nil || string(v) != "hello\r\nworld" {
+		t.Errorf("wrong value %q %v", v, err)
+	}
+
+	_ = cache.Set(ctx, "other", []byte("2"), 0)
+	_ = cache.Set(ctx, "brief", []byte("3"), 500*time.Microsecond)
+	values, err := cache.GetMulti(ctx, "greeting", "missing", "other")
+	if err != nil || len(values) != 2 || string(values["other"]) != "2" {
+		t.Errorf("wrong GetMulti result %q %v", values, err)
+	}
+
+	for i := int64(1); i <= 2; i++ {
+		if n, err := cache.Increment(ctx, "hits", time.Minute); err != nil || n != i {
+			t.Errorf("expected %d, got %d %v", i, n, err)
+		}
+	}
+
+	server.mu.Lock()
+	server.data["unrelated"] = "kept"
+	server.mu.Unlock()
+
+	if err = cache.Delete(ctx, "other"); err != nil {
+		t.Error(err)
+	}
+	if err = cache.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.data) != 1 || server.data["unrelated"] != "kept" {
+		t.Error("Flush must only remove keys in the namespace", server.data)
+	}
+	if server.commands[0] != "AUTH secret" || server.commands[1] != "SELECT 2" {
+		t.Error("expected the connection to authenticate and select the database", server.commands[:2])
+	}
+	auths := 0
+	for _, command := range server.commands {
+		if strings.HasPrefix(command, "AUTH") {
+			auths++
+		}
+		if strings.HasPrefix(command, "SET app:brief") && command != "SET app:brief 3 PX 1" {
+			t.Error("expected a ttl below a millisecond to be rounded up, got", command)
+		}
+	}
+	if auths != 1 {
+		t.Error("expected the connection to be reused, but it authenticated", auths, "times")
+	}
+}
+
+func TestRedisCache_Errors(t *testing.T) {
+	server := newFakeRedis(t)
+
+	cache := NewRedisCache(RedisOptions{Addr: server.ln.Addr().String(), Password: "wrong"})
+	var redisErr RedisError
+	if _, err := cache.Get(context.Background(), "key"); !errors.As(err, &redisErr) || !strings.HasPrefix(string(redisErr), "WRONGPASS") {
+		t.Error("expected the AUTH error, got", err)
+	}
+
+	cache = NewRedisCache(RedisOptions{Addr: server.ln.Addr().String()})
+	if _, err := cache.Do(context.Background(), "BOGUS"); !errors.As(err, &redisErr) {
+		t.Error("expected a RedisError, got", err)
+	}
+	// an error reply leaves the connection usable
+	if _, err := cache.Do(context.Background(), "GET", "key"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRedisCache_TryLock(t *testing.T) {
+	server := newFakeRedis(t)
+	cache := NewRedisCache(RedisOptions{Addr: server.ln.Addr().String()})
+	ctx := context.Background()
+
+	unlock, err := cache.TryLock(ctx, "report", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cache.TryLock(ctx, "report", time.Minute); !errors.Is(err, ErrLockNotAcquired) {
+		t.Error("expected ErrLockNotAcquired, got", err)
+	}
+
+	if err = unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cache.TryLock(ctx, "report", time.Minute); err != nil {
+		t.Error("expected the released lock to be free, got", err)
+	}
+}
+
+func TestRedisCache_RateLimit(t *testing.T) {
+	server := newFakeRedis(t)
+	store := NewCacheRateLimitStore(NewRedisCache(RedisOptions{Addr: server.ln.Addr().String()}))
+
+	var results []bool
+	for i := 0; i < 3; i++ {
+		result, err := store.Hit(context.Background(), "1.2.3.4", 2, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result.Allowed)
+	}
+	if !results[0] || !results[1] || results[2] {
+		t.Error("wrong results", results)
+	}
+}
@@ -0,0 +1,203 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// remoteCacheRetention is how long a response with an ETag or Last-Modified header is kept, once stale,
+// to revalidate it with a conditional request.
+const remoteCacheRetention = 24 * time.Hour
+
+// remoteCacheEntry is a response cached by GetJSONFromRemote.
+type remoteCacheEntry struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Expires      time.Time `json:"expires"`
+	Body         []byte    `json:"body"`
+}
+
+// GetJSONFromRemote gets uri and decodes its JSON response into target, if the status code is 2xx,
+// and returns the status code. Failed requests are retried according to Tools.RemoteRetry, if set.
+// The final parameter, client, is optional. If none is specified, we use the standard http.Client,
+// or one which follows Tools.OutboundPolicy, if set.
+//
+// Responses are cached in Tools.Cache for as long as their Cache-Control max-age or Expires header allow,
+// and a response with an ETag or Last-Modified header is then revalidated with If-None-Match and
+// If-Modified-Since, so that an unchanged response isn't downloaded again. Responses marked no-store
+// or private are never cached, nor those to requests authorized with Tools.RemoteTokenSource, which
+// are always sent: the cache is shared by every caller, so responses to a client adding credentials of
+// its own must be marked private too. Responses larger than Tools.MaxJSONSize are refused.
+func (t *Tools) GetJSONFromRemote(uri string, target any, client ...*http.Client) (int, error) {
+	return t.getJSONFromRemote(context.Background(), uri, target, client)
+}
+
+// getJSONFromRemote is GetJSONFromRemote, with its requests and their retries bound to ctx.
+func (t *Tools) getJSONFromRemote(ctx context.Context, uri string, target any, client []*http.Client) (int, error) {
+	if err := t.checkOutbound(uri); err != nil {
+		return 0, err
+	}
+	httpClient := t.outboundClient(client)
+
+	cache := t.cache()
+	key := "remote:" + uri
+
+	// the key doesn't tell callers apart, so responses to their credentials are kept out of the cache
+	var entry *remoteCacheEntry
+	shared := !t.authorizesRemote(uri)
+	if shared {
+		cached, err := cache.Get(ctx, key)
+		if err == nil {
+			entry = &remoteCacheEntry{}
+			if err = json.Unmarshal(cached, entry); err != nil {
+				entry = nil
+			}
+		} else if !errors.Is(err, ErrCacheMiss) {
+			t.logger().Warn("cache error", "key", key, "err", err)
+		}
+	}
+
+	if entry != nil && time.Now().Before(entry.Expires) {
+		return http.StatusOK, decodeRemoteJSON(entry.Body, target)
+	}
+
+	var response *http.Response
+	err := t.retryRemote(ctx, uri, func() error {
+		request, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+		if err != nil {
+			return Permanent(err)
+		}
+		request.Header.Set("Accept", "application/json")
+		if err = t.authorizeRemote(request); err != nil {
+			return err
+		}
+		if entry != nil {
+			if entry.ETag != "" {
+				request.Header.Set("If-None-Match", entry.ETag)
+			}
+			if entry.LastModified != "" {
+				request.Header.Set("If-Modified-Since", entry.LastModified)
+			}
+		}
+
+		response, err = httpClient.Do(request)
+		t.metrics().recordRemoteCall(response, err)
+		if err != nil {
+			return err
+		}
+		if retryableStatus(response.StatusCode) {
+			response.Body.Close()
+			return errRetryableStatus
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRetryableStatus) {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified && entry != nil {
+		entry.Expires = remoteCacheExpiry(response.Header)
+		t.storeRemoteResponse(ctx, key, entry)
+		return http.StatusOK, decodeRemoteJSON(entry.Body, target)
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, nil
+	}
+	maxSize := t.maxJSONSize()
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxSize+1))
+	if err != nil {
+		return response.StatusCode, err
+	}
+	if int64(len(body)) > maxSize {
+		return response.StatusCode, fmt.Errorf("the response of %s is larger than %d bytes", uri, maxSize)
+	}
+
+	cacheControl := response.Header.Get("Cache-Control")
+	if shared && response.StatusCode == http.StatusOK && !headerHasDirective(cacheControl, "no-store") && !headerHasDirective(cacheControl, "private") {
+		t.storeRemoteResponse(ctx, key, &remoteCacheEntry{
+			ETag:         response.Header.Get("ETag"),
+			LastModified: response.Header.Get("Last-Modified"),
+			Expires:      remoteCacheExpiry(response.Header),
+			Body:         body,
+		})
+	}
+
+	return response.StatusCode, decodeRemoteJSON(body, target)
+}
+
+// storeRemoteResponse caches entry under key, if it is still fresh or can be revalidated.
+func (t *Tools) storeRemoteResponse(ctx context.Context, key string, entry *remoteCacheEntry) {
+	ttl := time.Until(entry.Expires)
+	if entry.ETag != "" || entry.LastModified != "" {
+		if ttl < 0 {
+			ttl = 0
+		}
+		ttl += remoteCacheRetention
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	out, err := json.Marshal(entry)
+	if err == nil {
+		err = t.cache().Set(ctx, key, out, ttl)
+	}
+	if err != nil {
+		t.logger().Warn("cache error", "key", key, "err", err)
+	}
+}
+
+// remoteCacheExpiry returns until when a response with header is fresh: the time given by the max-age
+// directive of Cache-Control, or else by the Expires header. Responses marked no-cache are stale right away.
+func remoteCacheExpiry(header http.Header) time.Time {
+	now := time.Now()
+	cacheControl := header.Get("Cache-Control")
+	if headerHasDirective(cacheControl, "no-cache") {
+		return now
+	}
+
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || seconds < 0 {
+				return now
+			}
+			return now.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		return expires
+	}
+	return now
+}
+
+// headerHasDirective reports whether the Cache-Control header value contains directive.
+func headerHasDirective(header, directive string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(candidate), "=")
+		if strings.EqualFold(name, directive) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeRemoteJSON decodes body into target, unless either is empty.
+func decodeRemoteJSON(body []byte, target any) error {
+	if target == nil || len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, target)
+}
@@ -0,0 +1,115 @@
+package toolkit
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTools_GetJSONFromRemote(t *testing.T) {
+	requests := 0
+	var conditional []string
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		requests++
+		header := make(http.Header)
+
+		switch req.URL.Path {
+		case "/fresh":
+			header.Set("Cache-Control", "max-age=60")
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"name":"fresh"}`)), Header: header}
+		case "/etag":
+			header.Set("Cache-Control", "no-cache")
+			header.Set("ETag", `"v1"`)
+			if req.Header.Get("If-None-Match") == `"v1"` {
+				conditional = append(conditional, req.URL.Path)
+				return &http.Response{StatusCode: http.StatusNotModified, Body: io.NopCloser(strings.NewReader("")), Header: header}
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"name":"etag"}`)), Header: header}
+		case "/private":
+			header.Set("Cache-Control", "private, max-age=60")
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"name":"private"}`)), Header: header}
+		case "/large":
+			header.Set("Cache-Control", "max-age=60")
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"name":"` + strings.Repeat("x", 100) + `"}`)), Header: header}
+		case "/no-store":
+			header.Set("Cache-Control", "no-store, max-age=60")
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"name":"no-store"}`)), Header: header}
+		default:
+			return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader(`{"error":true}`)), Header: header}
+		}
+	})
+
+	var testTools Tools
+	get := func(path string) (string, int) {
+		var data struct {
+			Name string `json:"name"`
+		}
+		status, err := testTools.GetJSONFromRemote("http://example.com"+path, &data, client)
+		if err != nil {
+			t.Fatal(path, err)
+		}
+		return data.Name, status
+	}
+
+	for i := 0; i < 2; i++ {
+		if name, status := get("/fresh"); name != "fresh" || status != http.StatusOK {
+			t.Error("wrong response", name, status)
+		}
+	}
+	if requests != 1 {
+		t.Error("a fresh response must be served from the cache, made", requests, "requests")
+	}
+
+	requests = 0
+	for i := 0; i < 2; i++ {
+		if name, _ := get("/etag"); name != "etag" {
+			t.Error("wrong response", name)
+		}
+	}
+	if requests != 2 || len(conditional) != 1 {
+		t.Error("expected the second request to be revalidated, made", requests, "requests", conditional)
+	}
+
+	requests = 0
+	get("/no-store")
+	get("/no-store")
+	if requests != 2 {
+		t.Error("no-store responses must not be cached, made", requests, "requests")
+	}
+
+	if name, status := get("/missing"); name != "" || status != http.StatusNotFound {
+		t.Error("wrong response for an error status", name, status)
+	}
+	requests = 0
+	get("/private")
+	get("/private")
+	if requests != 2 {
+		t.Error("private responses must not be cached, made", requests, "requests")
+	}
+
+	testTools.MaxJSONSize = 50
+	if _, err := testTools.GetJSONFromRemote("http://example.com/large", nil, client); err == nil || !strings.Contains(err.Error(), "larger than 50 bytes") {
+		t.Error("expected a response larger than MaxJSONSize to be refused, got", err)
+	}
+	testTools.MaxJSONSize = 0
+
+	// responses to authorized requests are neither cached nor served from the cache
+	testTools.RemoteTokenSource = &staticTokenSource{token: &OAuth2Token{AccessToken: "secret"}}
+	testTools.RemoteTokenURLs = []string{"http://example.com/"}
+	requests = 0
+	for i := 0; i < 2; i++ {
+		if name, _ := get("/fresh"); name != "fresh" {
+			t.Error("wrong response", name)
+		}
+	}
+	if requests != 2 {
+		t.Error("authorized requests must not use the cache, made", requests, "requests")
+	}
+	testTools.RemoteTokenSource = nil
+	requests = 0
+	get("/fresh")
+	if requests != 0 {
+		t.Error("expected the response cached before to be served, made", requests, "requests")
+	}
+}
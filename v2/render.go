@@ -0,0 +1,206 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// ErrTemplateNotFound is returned when rendering a page which has no template.
+var ErrTemplateNotFound = errors.New("template not found")
+
+// RendererOptions is the type used to configure a Renderer.
+type RendererOptions struct {
+	// Layout is the name of the template executed to render a page, when the page's templates define it,
+	// so that a layout can wrap pages defining blocks such as "title" and "content". Defaults to "layout".
+	Layout string
+	// Funcs are added to the templates' functions.
+	Funcs map[string]any
+	// Development parses the templates again on every render, so that changes show up without a restart.
+	// Otherwise, each page is parsed once and cached.
+	Development bool
+}
+
+// Renderer renders the templates found in an fs.FS, such as os.DirFS("templates") or an embed.FS.
+// A page called "users/show" is the file users/show.html, parsed with html/template, or users/show.txt,
+// parsed with text/template (for plain text email bodies, for instance). Every page is parsed along with
+// all the files with the same extension in the layouts and partials directories.
+type Renderer struct {
+	fsys    fs.FS
+	options RendererOptions
+	tools   *Tools
+
+	mu    sync.RWMutex
+	pages map[string]executor
+}
+
+// executor is the part of html/template and text/template used to render a page.
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// NewRenderer returns a Renderer for the templates in fsys. Outside of development, all the pages are
+// parsed right away, so that template errors are found on startup.
+func (t *Tools) NewRenderer(fsys fs.FS, opts ...RendererOptions) (*Renderer, error) {
+	var options RendererOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.Layout == "" {
+		options.Layout = "layout"
+	}
+
+	r := &Renderer{fsys: fsys, options: options, tools: t, pages: make(map[string]executor)}
+	if options.Development {
+		return r, nil
+	}
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || isSharedTemplate(p) {
+			return err
+		}
+		ext := path.Ext(p)
+		if ext != ".html" && ext != ".txt" {
+			return nil
+		}
+		page, err := r.parse(strings.TrimSuffix(p, ext), ext)
+		if err != nil {
+			return err
+		}
+		r.pages[p] = page
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Render renders page with data, and writes it with the given status code. The page is rendered before
+// anything is written, so that a failed render can still be answered with an error.
+func (r *Renderer) Render(w http.ResponseWriter, status int, page string, data any) error {
+	var buf bytes.Buffer
+	ext, err := r.execute(&buf, page, data)
+	if err != nil {
+		r.tools.logger().Error("template rendering failed", "page", page, "err", err)
+		return err
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		contentType := "text/html; charset=utf-8"
+		if ext == ".txt" {
+			contentType = "text/plain; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(status)
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// RenderString renders page with data, and returns the result, such as an email body.
+func (r *Renderer) RenderString(page string, data any) (string, error) {
+	var buf bytes.Buffer
+	if _, err := r.execute(&buf, page, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// execute renders page to w, and returns the extension of the page's file.
+func (r *Renderer) execute(w io.Writer, page string, data any) (string, error) {
+	page = strings.TrimPrefix(path.Clean("/"+page), "/")
+
+	for _, ext := range []string{".html", ".txt"} {
+		tmpl, err := r.lookup(page, ext)
+		if errors.Is(err, ErrTemplateNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return ext, tmpl.Execute(w, data)
+	}
+	return "", fmt.Errorf("%w: %s", ErrTemplateNotFound, page)
+}
+
+// lookup returns the template for page in the file with extension ext, from the cache or freshly parsed.
+func (r *Renderer) lookup(page, ext string) (executor, error) {
+	if r.options.Development {
+		return r.parse(page, ext)
+	}
+
+	r.mu.RLock()
+	tmpl, ok := r.pages[page+ext]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, ErrTemplateNotFound
+	}
+	return tmpl, nil
+}
+
+// parse parses the file for page, with extension ext, along with the layouts and partials.
+func (r *Renderer) parse(page, ext string) (executor, error) {
+	if isSharedTemplate(page + ext) {
+		return nil, ErrTemplateNotFound
+	}
+	src, err := fs.ReadFile(r.fsys, page+ext)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []string
+	for _, dir := range []string{"layouts", "partials"} {
+		matches, err := fs.Glob(r.fsys, dir+"/*"+ext)
+		if err != nil {
+			return nil, err
+		}
+		shared = append(shared, matches...)
+	}
+
+	if ext == ".txt" {
+		tmpl := texttemplate.New(page).Funcs(r.options.Funcs)
+		if len(shared) > 0 {
+			if _, err = tmpl.ParseFS(r.fsys, shared...); err != nil {
+				return nil, err
+			}
+		}
+		if _, err = tmpl.New(page + ext).Parse(string(src)); err != nil {
+			return nil, fmt.Errorf("%s: %w", page+ext, err)
+		}
+		if layout := tmpl.Lookup(r.options.Layout); layout != nil {
+			return layout, nil
+		}
+		return tmpl.Lookup(page + ext), nil
+	}
+
+	tmpl := htmltemplate.New(page).Funcs(r.options.Funcs)
+	if len(shared) > 0 {
+		if _, err = tmpl.ParseFS(r.fsys, shared...); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = tmpl.New(page + ext).Parse(string(src)); err != nil {
+		return nil, fmt.Errorf("%s: %w", page+ext, err)
+	}
+	if layout := tmpl.Lookup(r.options.Layout); layout != nil {
+		return layout, nil
+	}
+	return tmpl.Lookup(page + ext), nil
+}
+
+// isSharedTemplate reports whether the file at p is a layout or a partial, rather than a page.
+func isSharedTemplate(p string) bool {
+	return strings.HasPrefix(p, "layouts/") || strings.HasPrefix(p, "partials/")
+}
@@ -0,0 +1,87 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func testTemplates() fstest.MapFS {
+	return fstest.MapFS{
+		"layouts/base.html":   {Data: []byte(`{{define "layout"}}<title>{{template "title" .}}</title>{{template "content" .}}{{end}}`)},
+		"partials/user.html":  {Data: []byte(`{{define "user"}}<b>{{.}}</b>{{end}}`)},
+		"users/show.html":     {Data: []byte(`{{define "title"}}{{.Name | upper}}{{end}}{{define "content"}}{{template "user" .Name}}{{end}}`)},
+		"emails/welcome.txt":  {Data: []byte(`Hello {{.Name}} <3`)},
+		"broken/partial.html": {Data: []byte(`{{define "title"}}{{end}}{{define "content"}}{{template "missing"}}{{end}}`)},
+	}
+}
+
+func TestRenderer_Render(t *testing.T) {
+	var testTools Tools
+	renderer, err := testTools.NewRenderer(testTemplates(), RendererOptions{Funcs: map[string]any{"upper": strings.ToUpper}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	if err = renderer.Render(rr, http.StatusCreated, "users/show", map[string]string{"Name": "<ann>"}); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusCreated || rr.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Error("wrong response", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if rr.Body.String() != "<title>&lt;ANN&gt;</title><b>&lt;ann&gt;</b>" {
+		t.Error("wrong body", rr.Body.String())
+	}
+
+	// text templates are not escaped
+	body, err := renderer.RenderString("emails/welcome", map[string]string{"Name": "Ann"})
+	if err != nil || body != "Hello Ann <3" {
+		t.Errorf("wrong text %q %v", body, err)
+	}
+
+	if _, err = renderer.RenderString("missing", nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Error("expected ErrTemplateNotFound, got", err)
+	}
+	if _, err = renderer.RenderString("layouts/base", nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Error("layouts must not be rendered as pages, got", err)
+	}
+
+	// a failed render writes nothing
+	rr = httptest.NewRecorder()
+	if err = renderer.Render(rr, http.StatusOK, "broken/partial", nil); err == nil {
+		t.Error("expected an error")
+	}
+	if rr.Body.Len() != 0 {
+		t.Error("a failed render must not write anything")
+	}
+}
+
+func TestRenderer_Development(t *testing.T) {
+	templates := fstest.MapFS{"home.html": {Data: []byte(`v1`)}}
+
+	var testTools Tools
+	cached, err := testTools.NewRenderer(templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	development, _ := testTools.NewRenderer(templates, RendererOptions{Development: true})
+
+	templates["home.html"] = &fstest.MapFile{Data: []byte(`v2`)}
+
+	if s, _ := cached.RenderString("home", nil); s != "v1" {
+		t.Error("templates must be cached outside of development, got", s)
+	}
+	if s, _ := development.RenderString("home", nil); s != "v2" {
+		t.Error("templates must be reloaded in development, got", s)
+	}
+
+	// parse errors are found on startup
+	templates["bad.html"] = &fstest.MapFile{Data: []byte(`{{if}}`)}
+	if _, err = testTools.NewRenderer(templates); err == nil {
+		t.Error("expected a parse error")
+	}
+}
@@ -0,0 +1,83 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net/http"
+	"time"
+)
+
+const requestIDContextKey contextKey = "requestID"
+
+// crockfordBase32 is the alphabet used to encode ULIDs.
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a new Universally Unique Lexicographically Sortable Identifier: a 26 character string,
+// made of a millisecond timestamp followed by 80 random bits, which sorts in order of creation.
+func NewULID() string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		// crypto/rand never fails on supported platforms; fall back to a timestamp only id just in case
+		for i := 6; i < len(id); i++ {
+			id[i] = 0
+		}
+	}
+
+	// 128 bits are encoded as 26 characters of 5 bits each, the first one only holding 3 bits
+	out := make([]byte, 26)
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// RequestID is middleware which makes sure every request has an id, taken from the X-Request-ID
+// header (or Tools.RequestIDHeader) if the client sent a sensible one, and generated with NewULID otherwise.
+// The id is stored in the request context, where RequestIDFromContext finds it, and set on the response,
+// where ErrorJSON picks it up to include in error messages. The headers of the request are left as sent.
+func (t *Tools) RequestID(next http.Handler) http.Handler {
+	header := t.requestIDHeader()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(header)
+		if !validRequestID(id) {
+			id = NewULID()
+		}
+
+		w.Header().Set(header, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey, id)))
+	})
+}
+
+// RequestIDFromContext returns the request id stored in ctx by the RequestID middleware,
+// or an empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// validRequestID reports whether an id sent by a client is safe to reuse, in logs and response headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDHeader returns the name of the header holding request ids.
+func (t *Tools) requestIDHeader() string {
+	if t.RequestIDHeader != "" {
+		return t.RequestIDHeader
+	}
+	return "X-Request-ID"
+}
@@ -0,0 +1,89 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewULID(t *testing.T) {
+	first := NewULID()
+	time.Sleep(2 * time.Millisecond)
+	second := NewULID()
+
+	if len(first) != 26 || len(second) != 26 {
+		t.Fatalf("wrong ULID length: %s, %s", first, second)
+	}
+	if first >= second {
+		t.Errorf("expected ULIDs to sort in order of creation: %s, %s", first, second)
+	}
+	for _, c := range first {
+		if !containsRune(crockfordBase32, c) {
+			t.Errorf("invalid character %q in ULID %s", c, first)
+		}
+	}
+	if NewULID() == NewULID() {
+		t.Error("expected ULIDs to be unique")
+	}
+}
+
+// containsRune reports whether s contains r.
+func containsRune(s string, r rune) bool {
+	for _, c := range s {
+		if c == r {
+			return true
+		}
+	}
+	return false
+}
+
+var requestIDTests = []struct {
+	name     string
+	incoming string
+	reused   bool
+}{
+	{name: "generated", incoming: "", reused: false},
+	{name: "reused", incoming: "abc-123", reused: true},
+	{name: "unsafe", incoming: "abc\r\nX-Injected: 1", reused: false},
+}
+
+func TestTools_RequestID(t *testing.T) {
+	var testTools Tools
+
+	for _, test := range requestIDTests {
+		var fromContext string
+		handler := testTools.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fromContext = RequestIDFromContext(r.Context())
+			_ = testTools.ErrorJSON(w, errors.New("oops"))
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.incoming != "" {
+			req.Header["X-Request-Id"] = []string{test.incoming}
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		id := rr.Header().Get("X-Request-ID")
+		if id == "" || id != fromContext {
+			t.Errorf("%s: request id in header (%q) and context (%q) should match", test.name, id, fromContext)
+		}
+		if req.Header.Get("X-Request-ID") != test.incoming {
+			t.Errorf("%s: expected the request headers to be left alone, got %q", test.name, req.Header.Get("X-Request-ID"))
+		}
+		if (id == test.incoming) != test.reused {
+			t.Errorf("%s: expected incoming id reused to be %t, got %q", test.name, test.reused, id)
+		}
+
+		var payload JSONResponse
+		if err := json.NewDecoder(rr.Body).Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.RequestID != id {
+			t.Errorf("%s: expected request id %q in error JSON, got %q", test.name, id, payload.RequestID)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package toolkit
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter is an http.ResponseWriter tracking the status code and the number of bytes written, for
+// middleware which logs or measures responses. WriteJSON and ErrorJSON find it, through the Unwrap
+// methods of other wrappers, and do nothing but log a warning once a response was written, instead of
+// writing a second status code. It passes Flush and Hijack on to the writer it wraps.
+type ResponseWriter struct {
+	http.ResponseWriter
+	status   int
+	written  int64
+	hijacked bool
+	// request is the request being answered, set by MetaMiddleware.
+	request *http.Request
+}
+
+// NewResponseWriter returns a ResponseWriter wrapping w, or w itself if it already is one.
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	if rw, ok := w.(*ResponseWriter); ok {
+		return rw
+	}
+	return &ResponseWriter{ResponseWriter: w}
+}
+
+// Status returns the status code written, or 0 if none was written yet.
+func (rw *ResponseWriter) Status() int {
+	return rw.status
+}
+
+// BytesWritten returns the number of bytes of the body written.
+func (rw *ResponseWriter) BytesWritten() int64 {
+	return rw.written
+}
+
+// Written reports whether the status code was written, or the connection hijacked, after which the
+// response can't be changed anymore.
+func (rw *ResponseWriter) Written() bool {
+	return rw.status != 0 || rw.hijacked
+}
+
+// WriteHeader writes the status code, unless one was written already.
+func (rw *ResponseWriter) WriteHeader(status int) {
+	if rw.Written() {
+		return
+	}
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes b, with an implicit 200 status code when none was written yet.
+func (rw *ResponseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 && !rw.hijacked {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.written += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, if the wrapped writer does.
+func (rw *ResponseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, if the wrapped writer does.
+func (rw *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer doesn't support hijacking")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err == nil {
+		rw.hijacked = true
+	}
+	return conn, buf, err
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// responseWritten reports whether the response of w was written already, if w is, or wraps, a
+// ResponseWriter.
+func responseWritten(w http.ResponseWriter) bool {
+	for {
+		switch writer := w.(type) {
+		case *ResponseWriter:
+			return writer.Written()
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// unwrappingWriter is a wrapper of another package, exposing the writer it wraps.
+type unwrappingWriter struct {
+	http.ResponseWriter
+}
+
+func (u unwrappingWriter) Unwrap() http.ResponseWriter {
+	return u.ResponseWriter
+}
+
+func TestResponseWriter(t *testing.T) {
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+
+	rr := httptest.NewRecorder()
+	rw := NewResponseWriter(rr)
+	if NewResponseWriter(rw) != rw {
+		t.Error("expected a ResponseWriter not to be wrapped twice")
+	}
+	if rw.Written() {
+		t.Error("expected nothing to be written yet")
+	}
+
+	if err := testTools.WriteJSON(unwrappingWriter{rw}, http.StatusCreated, map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if rw.Status() != http.StatusCreated || rw.BytesWritten() != int64(len(`{"id":1}`)) {
+		t.Errorf("wrong status %d or size %d", rw.Status(), rw.BytesWritten())
+	}
+
+	// the handler fails after writing its response
+	if err := testTools.ErrorJSON(unwrappingWriter{rw}, errors.New("too late")); err != nil {
+		t.Fatal(err)
+	}
+	rw.WriteHeader(http.StatusInternalServerError)
+	if rr.Code != http.StatusCreated || rr.Body.String() != `{"id":1}` {
+		t.Errorf("expected the first response only, got %d %s", rr.Code, rr.Body)
+	}
+	if !logger.contains("WARN response already written, error not sent") {
+		t.Error("expected a warning")
+	}
+}
+
+func TestResponseWriter_Hijack(t *testing.T) {
+	var testTools Tools
+	var hijackErr, jsonErr error
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		rw := NewResponseWriter(w)
+		conn, _, err := rw.Hijack()
+		if hijackErr = err; err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("HTTP/1.1 204 No Content\r\n\r\n"))
+		jsonErr = testTools.WriteJSON(rw, http.StatusOK, "ignored")
+	}))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	// the client may get the response before the handler returns
+	<-done
+	if hijackErr != nil || jsonErr != nil || response.StatusCode != http.StatusNoContent {
+		t.Errorf("expected the hijacked response, got %d (%v, %v)", response.StatusCode, hijackErr, jsonErr)
+	}
+
+	if _, _, err = NewResponseWriter(httptest.NewRecorder()).Hijack(); err == nil {
+		t.Error("expected an error when the writer can't be hijacked")
+	}
+}
@@ -0,0 +1,141 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy is the type used to configure Retry.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of calls, including the first one. Zero means no limit other than
+	// MaxElapsedTime; if both are zero, 3 attempts are made.
+	MaxAttempts int
+	// InitialInterval is the delay before the first retry. Defaults to 100ms.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between two attempts. Defaults to 10 seconds.
+	MaxInterval time.Duration
+	// Multiplier is the factor by which the delay grows after each attempt. Defaults to 2.
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction of it; 0.2 gives delays within ±20%.
+	// Zero means no jitter.
+	Jitter float64
+	// MaxElapsedTime, if set, stops retrying once the next attempt would start later than this after the first.
+	MaxElapsedTime time.Duration
+	// Retryable reports whether an operation failing with err should be tried again. By default,
+	// every error is retried, except those wrapped with Permanent.
+	Retryable func(err error) bool
+	// OnRetry, if set, is called before waiting delay to make another attempt, after attempt failed with err.
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// permanentError wraps an error which must not be retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that Retry gives up immediately, returning err.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Retry calls fn until it succeeds, it fails with an error which can't be retried, the attempts or time allowed
+// by policy run out, or ctx is done. Delays between attempts grow exponentially. The last error is returned.
+func Retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts == 0 && policy.MaxElapsedTime == 0 {
+		maxAttempts = 3
+	}
+	interval := durationOr(policy.InitialInterval, 100*time.Millisecond)
+	maxInterval := durationOr(policy.MaxInterval, 10*time.Second)
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if ctx.Err() != nil || !policy.retryable(err) || (maxAttempts > 0 && attempt >= maxAttempts) {
+			return err
+		}
+
+		delay := interval
+		if policy.Jitter > 0 {
+			delta := policy.Jitter * float64(delay)
+			delay = time.Duration(float64(delay) - delta + rand.Float64()*2*delta)
+		}
+		if policy.MaxElapsedTime > 0 && time.Since(start)+delay > policy.MaxElapsedTime {
+			return err
+		}
+
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-timer.C:
+		}
+
+		interval = time.Duration(float64(interval) * multiplier)
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// retryable reports whether err should be retried under the policy.
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return true
+}
+
+// errRetryableStatus is returned to Retry when a remote service answers with a status code worth retrying.
+var errRetryableStatus = errors.New("retryable status code")
+
+// retryRemote calls fn, the attempt at a remote call to uri, retrying it according to Tools.RemoteRetry if set,
+// until ctx is done.
+// Retries are logged, as well as passed on to the policy's own OnRetry.
+func (t *Tools) retryRemote(ctx context.Context, uri string, fn func() error) error {
+	policy := RetryPolicy{MaxAttempts: 1}
+	if t.RemoteRetry != nil {
+		policy = *t.RemoteRetry
+	}
+
+	onRetry := policy.OnRetry
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		t.logger().Warn("retrying remote call", "url", uri, "attempt", attempt, "delay", delay, "err", err)
+		if onRetry != nil {
+			onRetry(attempt, err, delay)
+		}
+	}
+	return Retry(ctx, policy, fn)
+}
+
+// retryableStatus reports whether a request answered with status may succeed if sent again.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
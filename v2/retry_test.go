@@ -0,0 +1,148 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var errTemporary = errors.New("temporary failure")
+
+var retryTests = []struct {
+	name          string
+	policy        RetryPolicy
+	failures      int
+	err           error
+	expectedCalls int
+	errorExpected bool
+}{
+	{name: "succeeds first time", policy: RetryPolicy{}, failures: 0, err: errTemporary, expectedCalls: 1},
+	{name: "succeeds after retries", policy: RetryPolicy{MaxAttempts: 5}, failures: 3, err: errTemporary, expectedCalls: 4},
+	{name: "default attempts", policy: RetryPolicy{}, failures: 10, err: errTemporary, expectedCalls: 3, errorExpected: true},
+	{name: "permanent", policy: RetryPolicy{MaxAttempts: 5}, failures: 10, err: Permanent(errTemporary), expectedCalls: 1, errorExpected: true},
+	{
+		name:          "not retryable",
+		policy:        RetryPolicy{MaxAttempts: 5, Retryable: func(err error) bool { return !errors.Is(err, errTemporary) }},
+		failures:      10,
+		err:           errTemporary,
+		expectedCalls: 1,
+		errorExpected: true,
+	},
+	{
+		name:          "max elapsed time",
+		policy:        RetryPolicy{InitialInterval: 20 * time.Millisecond, MaxElapsedTime: 50 * time.Millisecond},
+		failures:      100,
+		err:           errTemporary,
+		expectedCalls: 2,
+		errorExpected: true,
+	},
+}
+
+func TestRetry(t *testing.T) {
+	for _, e := range retryTests {
+		if e.policy.InitialInterval == 0 {
+			e.policy.InitialInterval = time.Millisecond
+		}
+
+		calls := 0
+		err := Retry(context.Background(), e.policy, func() error {
+			calls++
+			if calls <= e.failures {
+				return e.err
+			}
+			return nil
+		})
+
+		if calls != e.expectedCalls {
+			t.Errorf("%s: expected %d calls but got %d", e.name, e.expectedCalls, calls)
+		}
+		if e.errorExpected && !errors.Is(err, errTemporary) {
+			t.Errorf("%s: expected the last error, got %v", e.name, err)
+		}
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			t.Errorf("%s: the permanent wrapper was not removed", e.name)
+		}
+	}
+}
+
+func TestRetry_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 4, InitialInterval: 10 * time.Millisecond, MaxInterval: 25 * time.Millisecond, Jitter: 0.1}
+
+	var times []time.Time
+	_ = Retry(context.Background(), policy, func() error {
+		times = append(times, time.Now())
+		return errTemporary
+	})
+
+	// delays of about 10ms, 20ms, then 25ms rather than 40ms
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond}
+	for i, want := range expected {
+		got := times[i+1].Sub(times[i])
+		if got < want*8/10 || got > want*3 {
+			t.Errorf("delay %d: expected about %s but got %s", i, want, got)
+		}
+	}
+}
+
+func TestRetry_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := Retry(ctx, RetryPolicy{MaxAttempts: 10, InitialInterval: time.Second}, func() error { return errTemporary })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected a context error, got", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("Retry did not stop waiting when the context was done")
+	}
+}
+
+func TestTools_PushJSONToRemoteRetry(t *testing.T) {
+	calls := 0
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		calls++
+		body, _ := io.ReadAll(req.Body)
+		if string(body) != `{"bar":"bar"}` {
+			t.Errorf("attempt %d: wrong body %q", calls, body)
+		}
+
+		status := http.StatusOK
+		if calls < 3 {
+			status = http.StatusServiceUnavailable
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(bytes.NewBufferString("ok")),
+			Header:     make(http.Header),
+		}
+	})
+
+	testTools := Tools{RemoteRetry: &RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}}
+	foo := struct {
+		Bar string `json:"bar"`
+	}{Bar: "bar"}
+
+	_, status, err := testTools.PushJSONToRemote("http://example.com/some/path", foo, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK || calls != 3 {
+		t.Errorf("expected success after 3 attempts, got status %d after %d", status, calls)
+	}
+
+	// once the attempts run out, the last response is returned
+	calls = -10
+	_, status, err = testTools.PushJSONToRemote("http://example.com/some/path", foo, client)
+	if err != nil || status != http.StatusServiceUnavailable {
+		t.Errorf("expected the final 503 response, got %d %v", status, err)
+	}
+}
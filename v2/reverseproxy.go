@@ -0,0 +1,186 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// ErrUpstreamResponseTooLarge is the error behind the 502 sent by ReverseProxy for responses larger than
+// ReverseProxyOptions.MaxResponseSize.
+var ErrUpstreamResponseTooLarge = errors.New("upstream response too large")
+
+// ReverseProxyOptions is the type used to configure ReverseProxy.
+type ReverseProxyOptions struct {
+	// StripPrefix is removed from the path of requests before it is appended to the path of the target,
+	// such as /api/users, for the prefix /api, to https://users.internal/v1/users.
+	StripPrefix string
+	// Rewrite, if set, is called last with every outgoing request, to change it further.
+	Rewrite func(r *http.Request)
+	// Headers are set on every outgoing request, replacing those sent by the client.
+	Headers http.Header
+	// Authorize sends a token from Tools.RemoteTokenSource with every outgoing request, as for remote calls,
+	// whether or not the target is one of Tools.RemoteTokenURLs.
+	Authorize bool
+	// PreserveHost keeps the Host header of the incoming request, instead of the host of the target.
+	PreserveHost bool
+	// MaxResponseSize is the largest response body the target may send, in bytes. Responses announcing
+	// a larger body are answered with a 502; larger bodies without a Content-Length are cut off. Zero
+	// means no limit.
+	MaxResponseSize int64
+	// Transport is used to send outgoing requests. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// ReverseProxy returns a handler forwarding requests to target, a URL such as https://users.internal/v1,
+// with httputil.ReverseProxy, for gateway-style services. The request id set by the RequestID middleware
+// is forwarded in Tools.RequestIDHeader, and calls are counted in Tools.Metrics as remote calls.
+//
+// Errors reaching the target are logged, and sent to the client with ErrorJSON: a 504 when it timed out,
+// and a 502 otherwise, without the details of the error.
+func (t *Tools) ReverseProxy(target string, opts ...ReverseProxyOptions) (http.Handler, error) {
+	var options ReverseProxyOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if targetURL.Scheme == "" || targetURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy target %q", target)
+	}
+
+	transport := options.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			rewriteProxyURL(r.URL, targetURL, options.StripPrefix)
+			if !options.PreserveHost {
+				r.Host = targetURL.Host
+			}
+			for name, values := range options.Headers {
+				r.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+			}
+			if id := RequestIDFromContext(r.Context()); id != "" {
+				r.Header.Set(t.requestIDHeader(), id)
+			}
+			if options.Rewrite != nil {
+				options.Rewrite(r)
+			}
+		},
+		Transport: &proxyTransport{tools: t, authorize: options.Authorize, next: transport},
+		ModifyResponse: func(response *http.Response) error {
+			if options.MaxResponseSize <= 0 {
+				return nil
+			}
+			if response.ContentLength > options.MaxResponseSize {
+				return ErrUpstreamResponseTooLarge
+			}
+			response.Body = &limitedBody{
+				Reader: io.LimitReader(response.Body, options.MaxResponseSize+1),
+				Closer: response.Body,
+				limit:  options.MaxResponseSize,
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if errors.Is(err, context.Canceled) {
+				// the client went away
+				return
+			}
+			t.logger().Warn("proxy error", "target", target, "path", r.URL.Path, "err", err)
+
+			var netErr net.Error
+			switch {
+			case errors.Is(err, ErrUpstreamResponseTooLarge):
+				_ = t.ErrorJSON(w, err, http.StatusBadGateway)
+			case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout():
+				_ = t.ErrorJSON(w, errors.New("the upstream service timed out"), http.StatusGatewayTimeout)
+			default:
+				_ = t.ErrorJSON(w, errors.New("the upstream service is unavailable"), http.StatusBadGateway)
+			}
+		},
+	}
+	return proxy, nil
+}
+
+// rewriteProxyURL points u, the URL of an incoming request, to target, without prefix.
+func rewriteProxyURL(u *url.URL, target *url.URL, prefix string) {
+	path, rawPath := u.Path, u.RawPath
+	if prefix != "" {
+		path = strings.TrimPrefix(path, prefix)
+		rawPath = strings.TrimPrefix(rawPath, prefix)
+	}
+
+	u.Scheme = target.Scheme
+	u.Host = target.Host
+	u.Path = joinURLPath(target.Path, path)
+	if rawPath != "" {
+		u.RawPath = joinURLPath(target.EscapedPath(), rawPath)
+	}
+	if target.RawQuery == "" || u.RawQuery == "" {
+		u.RawQuery = target.RawQuery + u.RawQuery
+	} else {
+		u.RawQuery = target.RawQuery + "&" + u.RawQuery
+	}
+}
+
+// joinURLPath joins base and path with a single slash.
+func joinURLPath(base, path string) string {
+	if path == "" {
+		if base == "" {
+			return "/"
+		}
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// proxyTransport is the http.RoundTripper of ReverseProxy, authorizing requests and recording metrics.
+type proxyTransport struct {
+	tools     *Tools
+	authorize bool
+	next      http.RoundTripper
+}
+
+func (p *proxyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if p.authorize {
+		// a RoundTripper must not modify the request it is given
+		r = r.Clone(r.Context())
+		if err := p.tools.setRemoteToken(r); err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := p.next.RoundTrip(r)
+	p.tools.metrics().recordRemoteCall(response, err)
+	return response, err
+}
+
+// limitedBody is a response body failing with ErrUpstreamResponseTooLarge past limit bytes.
+type limitedBody struct {
+	io.Reader
+	io.Closer
+	limit int64
+	read  int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return n - int(b.read-b.limit), ErrUpstreamResponseTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,114 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTools_ReverseProxy(t *testing.T) {
+	var mu sync.Mutex
+	var last *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		last = r
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/v1/large":
+			_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+		case "/v1/stream":
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+		case "/v1/slow":
+			time.Sleep(100 * time.Millisecond)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer upstream.Close()
+
+	testTools := Tools{RemoteTokenSource: &staticTokenSource{token: &OAuth2Token{AccessToken: "secret"}}}
+	proxy, err := testTools.ReverseProxy(upstream.URL+"/v1?key=1", ReverseProxyOptions{
+		StripPrefix:     "/api",
+		Headers:         http.Header{"X-Gateway": {"toolkit"}},
+		Authorize:       true,
+		MaxResponseSize: 50,
+		Transport:       &http.Transport{ResponseHeaderTimeout: 50 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := testTools.RequestID(proxy)
+
+	request := httptest.NewRequest("GET", "/api/users/7?fields=name", nil)
+	request.Header.Set("X-Request-ID", "abc-123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, request)
+	if rr.Code != http.StatusOK || rr.Body.String() != "ok" {
+		t.Fatalf("expected the upstream response, got %d %s", rr.Code, rr.Body)
+	}
+	mu.Lock()
+	seen := last
+	mu.Unlock()
+	if seen.URL.Path != "/v1/users/7" || seen.URL.RawQuery != "key=1&fields=name" {
+		t.Errorf("wrong upstream URL %s", seen.URL)
+	}
+	if seen.Host != strings.TrimPrefix(upstream.URL, "http://") {
+		t.Errorf("expected the host of the target, got %s", seen.Host)
+	}
+	if seen.Header.Get("X-Gateway") != "toolkit" || seen.Header.Get("Authorization") != "Bearer secret" || seen.Header.Get("X-Request-ID") != "abc-123" {
+		t.Errorf("wrong upstream headers %v", seen.Header)
+	}
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{path: "/api/large", expected: http.StatusBadGateway},
+		{path: "/api/slow", expected: http.StatusGatewayTimeout},
+	}
+	for _, test := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", test.path, nil))
+		var payload JSONResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &payload)
+		if rr.Code != test.expected || !payload.Error || payload.RequestID == "" {
+			t.Errorf("%s: expected %d, got %d %s", test.path, test.expected, rr.Code, rr.Body)
+		}
+	}
+
+	// a body without a Content-Length is cut off at the limit
+	rr = httptest.NewRecorder()
+	func() {
+		defer func() { _ = recover() }()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/stream", nil))
+	}()
+	if rr.Body.Len() > 50 {
+		t.Errorf("expected the body to be cut off, got %d bytes", rr.Body.Len())
+	}
+
+	down, _ := testTools.ReverseProxy("http://127.0.0.1:1")
+	rr = httptest.NewRecorder()
+	down.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil).WithContext(context.Background()))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("expected 502, got %d", rr.Code)
+	}
+
+	if _, err = testTools.ReverseProxy("/relative"); err == nil {
+		t.Error("expected an error for a target without a host")
+	}
+}
+
+// staticTokenSource is a TokenSource always returning the same token.
+type staticTokenSource struct {
+	token *OAuth2Token
+}
+
+func (s *staticTokenSource) Token(ctx context.Context) (*OAuth2Token, error) {
+	return s.token, nil
+}
@@ -0,0 +1,303 @@
+package toolkit
+
+import (
+	"html"
+	"strings"
+)
+
+// HTMLPolicy is the type used to configure what SanitizeHTML keeps.
+type HTMLPolicy struct {
+	// Tags maps the tags which are kept to the attributes they may have.
+	Tags map[string][]string
+	// GlobalAttributes are attributes any kept tag may have, such as title.
+	GlobalAttributes []string
+	// URLSchemes are the schemes allowed in URL attributes, such as href and src; relative URLs are
+	// always allowed. Defaults to http, https and mailto.
+	URLSchemes []string
+	// LinkRel, if set, is the rel attribute given to every a tag, such as "nofollow noopener".
+	LinkRel string
+}
+
+// DefaultHTMLPolicy returns the policy used by SanitizeHTML when none is given, which keeps the tags of
+// rich text editors: paragraphs, headings, emphasis, lists, quotes, code, tables, links and images.
+func DefaultHTMLPolicy() HTMLPolicy {
+	tags := map[string][]string{
+		"a":   {"href"},
+		"img": {"src", "alt", "width", "height"},
+		"ol":  {"start"},
+		"td":  {"colspan", "rowspan"},
+		"th":  {"colspan", "rowspan", "scope"},
+	}
+	for _, tag := range strings.Fields("p br hr b strong i em u s strike del ins sub sup small mark h1 h2 h3 h4 h5 h6 " +
+		"ul li dl dt dd blockquote q cite code pre kbd abbr span div table thead tbody tfoot tr caption figure figcaption") {
+		tags[tag] = nil
+	}
+	return HTMLPolicy{
+		Tags:             tags,
+		GlobalAttributes: []string{"title"},
+		LinkRel:          "nofollow noopener",
+	}
+}
+
+// htmlVoidTags are the tags which have no content, and no end tag.
+var htmlVoidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// htmlDroppedTags are the tags whose content is removed along with them, as it is code or isn't meant to be shown.
+var htmlDroppedTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "noscript": true, "template": true,
+	"textarea": true, "title": true, "xmp": true, "noembed": true, "noframes": true, "svg": true, "math": true,
+}
+
+// htmlURLAttributes are the attributes holding URLs, whose scheme is checked.
+var htmlURLAttributes = map[string]bool{
+	"href": true, "src": true, "cite": true, "action": true, "formaction": true, "poster": true, "background": true,
+}
+
+// SanitizeHTML returns input with only the tags and attributes allowed by policy, or DefaultHTMLPolicy if
+// none is given, so that rich text received from users can be stored and served again safely. Scripts,
+// styles and the like are removed along with their content; other tags which aren't allowed are removed,
+// but their content is kept. Event handler attributes, such as onclick, and URLs with schemes such as
+// javascript: are always removed. The result is well formed: text is escaped, and tags are closed.
+func SanitizeHTML(input string, policy ...HTMLPolicy) string {
+	p := DefaultHTMLPolicy()
+	if len(policy) > 0 {
+		p = policy[0]
+	}
+	if len(p.URLSchemes) == 0 {
+		p.URLSchemes = []string{"http", "https", "mailto"}
+	}
+
+	var out strings.Builder
+	var open []string
+
+	tokenizeHTML(input, func(text string) {
+		out.WriteString(html.EscapeString(text))
+	}, func(tag htmlTag, end bool) {
+		if end {
+			// close the tags opened since the matching start tag, if it was kept
+			for j := len(open) - 1; j >= 0; j-- {
+				if open[j] == tag.name {
+					for k := len(open) - 1; k >= j; k-- {
+						out.WriteString("</" + open[k] + ">")
+					}
+					open = open[:j]
+					break
+				}
+			}
+			return
+		}
+
+		allowed, ok := p.Tags[tag.name]
+		if !ok {
+			return
+		}
+
+		out.WriteString("<" + tag.name)
+		for _, attr := range tag.attrs {
+			if strings.HasPrefix(attr.name, "on") || (tag.name == "a" && attr.name == "rel" && p.LinkRel != "") {
+				continue
+			}
+			if !containsString(allowed, attr.name) && !containsString(p.GlobalAttributes, attr.name) {
+				continue
+			}
+			if htmlURLAttributes[attr.name] && !allowedURL(attr.value, p.URLSchemes) {
+				continue
+			}
+			out.WriteString(" " + attr.name + `="` + html.EscapeString(attr.value) + `"`)
+		}
+		if tag.name == "a" && p.LinkRel != "" {
+			out.WriteString(` rel="` + html.EscapeString(p.LinkRel) + `"`)
+		}
+		out.WriteString(">")
+
+		if !htmlVoidTags[tag.name] {
+			open = append(open, tag.name)
+		}
+	})
+
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+	return out.String()
+}
+
+// tokenizeHTML calls text with the text of input, its entities decoded, and tag with its start and end
+// tags, in order. Comments, doctypes and the htmlDroppedTags, along with their content, are skipped.
+func tokenizeHTML(input string, text func(string), tag func(tag htmlTag, end bool)) {
+	for len(input) > 0 {
+		i := strings.IndexByte(input, '<')
+		if i < 0 {
+			text(html.UnescapeString(input))
+			return
+		}
+		if i > 0 {
+			text(html.UnescapeString(input[:i]))
+		}
+		input = input[i:]
+
+		switch {
+		case strings.HasPrefix(input, "<!--"):
+			input = skipPast(input, "-->")
+
+		case strings.HasPrefix(input, "<!") || strings.HasPrefix(input, "<?"):
+			input = skipPast(input, ">")
+
+		default:
+			end := strings.HasPrefix(input, "</")
+			name := input[1:]
+			if end {
+				name = input[2:]
+			}
+
+			t, rest, ok := parseHTMLTag(name)
+			if !ok {
+				// a lone "<" is text
+				text("<")
+				input = input[1:]
+				continue
+			}
+			input = rest
+
+			switch {
+			case t.name == "":
+			case htmlDroppedTags[t.name]:
+				if !end && !htmlVoidTags[t.name] && !t.selfClosing {
+					input = skipPastEndTag(input, t.name)
+				}
+			default:
+				tag(t, end)
+			}
+		}
+	}
+}
+
+// htmlTag is a tag read by parseHTMLTag.
+type htmlTag struct {
+	name        string
+	attrs       []htmlAttribute
+	selfClosing bool
+}
+
+// htmlAttribute is an attribute of an htmlTag, with its entities decoded.
+type htmlAttribute struct {
+	name, value string
+}
+
+// parseHTMLTag parses the tag at the start of s, just after its "<" or "</", and returns it along with
+// the rest of s. ok is false when s doesn't start with a tag name. When s ends within the tag, the tag
+// returned has no name, so that it is dropped.
+func parseHTMLTag(s string) (tag htmlTag, rest string, ok bool) {
+	i := 0
+	for i < len(s) && (isASCIILetter(s[i]) || (i > 0 && (isASCIIDigit(s[i]) || s[i] == '-' || s[i] == ':'))) {
+		i++
+	}
+	if i == 0 {
+		return tag, s, false
+	}
+	tag.name = strings.ToLower(s[:i])
+	s = s[i:]
+
+	for {
+		s = strings.TrimLeft(s, " \t\n\r\f")
+		if s == "" {
+			return htmlTag{}, "", true
+		}
+		switch s[0] {
+		case '>':
+			return tag, s[1:], true
+		case '/':
+			tag.selfClosing = true
+			s = s[1:]
+			continue
+		}
+		tag.selfClosing = false
+
+		// the attribute name, then its value, if any
+		j := 1
+		for j < len(s) && !strings.ContainsRune(" \t\n\r\f/>=", rune(s[j])) {
+			j++
+		}
+		attr := htmlAttribute{name: strings.ToLower(s[:j])}
+		s = strings.TrimLeft(s[j:], " \t\n\r\f")
+
+		if strings.HasPrefix(s, "=") {
+			s = strings.TrimLeft(s[1:], " \t\n\r\f")
+			if s != "" && (s[0] == '"' || s[0] == '\'') {
+				end := strings.IndexByte(s[1:], s[0])
+				if end < 0 {
+					return htmlTag{}, "", true
+				}
+				attr.value = s[1 : end+1]
+				s = s[end+2:]
+			} else {
+				end := strings.IndexAny(s, " \t\n\r\f>")
+				if end < 0 {
+					end = len(s)
+				}
+				attr.value = s[:end]
+				s = s[end:]
+			}
+		}
+
+		attr.value = html.UnescapeString(attr.value)
+		tag.attrs = append(tag.attrs, attr)
+	}
+}
+
+// skipPast returns what follows the first occurrence of marker in s, or an empty string if there is none.
+func skipPast(s, marker string) string {
+	if i := strings.Index(s, marker); i >= 0 {
+		return s[i+len(marker):]
+	}
+	return ""
+}
+
+// skipPastEndTag returns what follows the end tag of name in s, or an empty string if there is none.
+func skipPastEndTag(s, name string) string {
+	lower := strings.ToLower(s)
+	for offset := 0; ; {
+		i := strings.Index(lower[offset:], "</"+name)
+		if i < 0 {
+			return ""
+		}
+		end := offset + i + 2 + len(name)
+		if end == len(s) || strings.ContainsRune(" \t\n\r\f/>", rune(s[end])) {
+			return skipPast(s[end:], ">")
+		}
+		offset = end
+	}
+}
+
+// allowedURL reports whether the URL u is relative, or has one of schemes.
+func allowedURL(u string, schemes []string) bool {
+	// browsers ignore control characters and spaces in schemes, as in "java\tscript:"
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, u)
+
+	i := strings.IndexAny(cleaned, ":/?#")
+	if i < 0 || cleaned[i] != ':' {
+		return true
+	}
+	scheme := strings.ToLower(cleaned[:i])
+	return containsString(schemes, scheme)
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCIILetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isASCIIDigit(c byte) bool  { return c >= '0' && c <= '9' }
@@ -0,0 +1,57 @@
+package toolkit
+
+import "testing"
+
+var sanitizeHTMLTests = []struct {
+	name     string
+	input    string
+	expected string
+}{
+	{name: "plain text", input: "Hello, world", expected: "Hello, world"},
+	{name: "escaped text", input: "1 < 2 & 3 > 2", expected: "1 &lt; 2 &amp; 3 &gt; 2"},
+	{name: "entities", input: "caf&eacute; &amp; &lt;b&gt;", expected: "café &amp; &lt;b&gt;"},
+	{name: "allowed tags", input: "<p>Hello <b>bold</b> and <EM>em</EM></p>", expected: "<p>Hello <b>bold</b> and <em>em</em></p>"},
+	{name: "script", input: "<p>hi<script>alert(1)</script></p>", expected: "<p>hi</p>"},
+	{name: "script end tag case", input: "a<SCRIPT type=x>alert('</p>')</Script >b", expected: "ab"},
+	{name: "unclosed script", input: "a<script>alert(1)", expected: "a"},
+	{name: "style", input: "<style>p{color:red}</style>text", expected: "text"},
+	{name: "svg", input: "<svg><script>alert(1)</script></svg>ok", expected: "ok"},
+	{name: "event handler", input: `<p onclick="alert(1)" title="t">x</p>`, expected: `<p title="t">x</p>`},
+	{name: "unknown tag keeps content", input: "<font color=red>red</font>", expected: "red"},
+	{name: "unknown attribute", input: `<b style="color:red" class=x>b</b>`, expected: "<b>b</b>"},
+	{name: "link", input: `<a href="https://example.com/?a=1&amp;b=2">x</a>`, expected: `<a href="https://example.com/?a=1&amp;b=2" rel="nofollow noopener">x</a>`},
+	{name: "link rel replaced", input: `<a href="/about" rel="opener">x</a>`, expected: `<a href="/about" rel="nofollow noopener">x</a>`},
+	{name: "javascript URL", input: `<a href="javascript:alert(1)">x</a>`, expected: `<a rel="nofollow noopener">x</a>`},
+	{name: "obfuscated javascript URL", input: `<a href="JaVa&#x09;Script&colon;alert(1)">x</a>`, expected: `<a rel="nofollow noopener">x</a>`},
+	{name: "data URL", input: `<img src="data:image/svg+xml,<svg/onload=alert(1)>" alt="a">`, expected: `<img alt="a">`},
+	{name: "image", input: `<img src="/a.png" alt='a "b"' onerror=alert(1) />`, expected: `<img src="/a.png" alt="a &#34;b&#34;">`},
+	{name: "unquoted attribute", input: `<td colspan=2>x</td>`, expected: `<td colspan="2">x</td>`},
+	{name: "comment", input: "a<!-- <script>alert(1)</script> -->b", expected: "ab"},
+	{name: "doctype", input: "<!DOCTYPE html><p>x</p>", expected: "<p>x</p>"},
+	{name: "unclosed tags", input: "<ul><li>one<li>two", expected: "<ul><li>one<li>two</li></li></ul>"},
+	{name: "stray end tag", input: "x</p></div>", expected: "x"},
+	{name: "misnested tags", input: "<b><i>x</b>y</i>", expected: "<b><i>x</i></b>y"},
+	{name: "lone angle bracket", input: "a < b and a <3", expected: "a &lt; b and a &lt;3"},
+	{name: "unterminated tag", input: `a<img src="x`, expected: "a"},
+}
+
+func TestSanitizeHTML(t *testing.T) {
+	for _, e := range sanitizeHTMLTests {
+		if out := SanitizeHTML(e.input); out != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, out)
+		}
+	}
+}
+
+func TestSanitizeHTML_Policy(t *testing.T) {
+	policy := HTMLPolicy{
+		Tags:       map[string][]string{"a": {"href"}, "b": nil},
+		URLSchemes: []string{"https"},
+	}
+
+	out := SanitizeHTML(`<p><b>x</b> <a href="http://example.com" title="t">a</a> <a href="https://example.com">b</a></p>`, policy)
+	expected := `<b>x</b> <a>a</a> <a href="https://example.com">b</a>`
+	if out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
@@ -0,0 +1,331 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLockNotAcquired is returned by Locker.TryLock when the lock is held elsewhere.
+var ErrLockNotAcquired = errors.New("lock not acquired")
+
+// Locker is the interface implemented by distributed locks, such as RedisCache.
+type Locker interface {
+	// TryLock acquires the lock called key for ttl, or returns ErrLockNotAcquired if it is held elsewhere.
+	// The returned function releases the lock early.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func() error, err error)
+}
+
+// Scheduler runs jobs periodically in the background, such as removing old temporary files or rotating keys.
+// A job never overlaps with itself: if it is still running when it is due again, that run is skipped.
+type Scheduler struct {
+	// Jitter, if set, delays each run by a random duration up to Jitter, so that several instances
+	// of an application don't all run the same job at the same moment.
+	Jitter time.Duration
+	// Logger is where job errors and panics are logged. Defaults to warnings and errors only, written
+	// to ErrorLog.
+	Logger Logger
+	// ErrorLog is used by the default Logger. Defaults to log.Default().
+	ErrorLog *log.Logger
+	// Locker, if set, makes sure that when several instances of an application run the same jobs,
+	// each run happens on a single instance: a run takes a lock held until the job is next due.
+	// Jobs are told apart by the order they were scheduled in, which must be the same everywhere.
+	Locker Locker
+
+	mu   sync.Mutex
+	jobs []*scheduledJob
+}
+
+// scheduledJob is a job, along with the function computing when it should next run.
+type scheduledJob struct {
+	id      int
+	name    string
+	next    func(after time.Time) time.Time
+	fn      func(ctx context.Context) error
+	running atomic.Bool
+}
+
+// NewScheduler returns a Scheduler without any jobs.
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Every schedules fn to run every interval, the first time one interval after Run is called.
+// Jobs must be scheduled before calling Run.
+func (s *Scheduler) Every(interval time.Duration, fn func(ctx context.Context) error) {
+	if interval <= 0 {
+		panic("toolkit: non-positive interval for Scheduler.Every")
+	}
+
+	s.add(&scheduledJob{
+		name: "every " + interval.String(),
+		next: func(after time.Time) time.Time { return after.Add(interval) },
+		fn:   fn,
+	})
+}
+
+// Cron schedules fn according to the standard five field cron expression (minute, hour, day of month,
+// month and day of week), in local time. Fields accept *, numbers, ranges (1-5), steps (*/15) and lists (1,15).
+// Jobs must be scheduled before calling Run.
+func (s *Scheduler) Cron(expr string, fn func(ctx context.Context) error) error {
+	schedule, err := parseCron(expr)
+	if err != nil {
+		return err
+	}
+
+	s.add(&scheduledJob{name: expr, next: schedule.next, fn: fn})
+	return nil
+}
+
+// add registers job with the scheduler.
+func (s *Scheduler) add(job *scheduledJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.id = len(s.jobs)
+	s.jobs = append(s.jobs, job)
+}
+
+// Run runs the scheduled jobs until ctx is done, then waits for the jobs still running to return.
+// The context passed to jobs is cancelled along with ctx, so that long jobs can stop early.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	jobs := append([]*scheduledJob(nil), s.jobs...)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *scheduledJob) {
+			defer wg.Done()
+			s.schedule(ctx, job, &wg)
+		}(job)
+	}
+	wg.Wait()
+}
+
+// schedule starts job each time it is due, until ctx is done.
+func (s *Scheduler) schedule(ctx context.Context, job *scheduledJob, wg *sync.WaitGroup) {
+	for {
+		next := job.next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		delay := time.Until(next)
+		if s.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(s.Jitter)))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if !job.running.CompareAndSwap(false, true) {
+			// the previous run hasn't finished yet
+			continue
+		}
+		if !s.lock(ctx, job) {
+			job.running.Store(false)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer job.running.Store(false)
+			s.run(ctx, job)
+		}()
+	}
+}
+
+// lock reports whether this instance should run job now, taking the job's lock if there is a Locker.
+// The lock isn't released when the run ends, but expires when the job is next due, so that instances
+// whose timers fire a little later don't run the job again.
+func (s *Scheduler) lock(ctx context.Context, job *scheduledJob) bool {
+	if s.Locker == nil {
+		return true
+	}
+
+	now := time.Now()
+	next := job.next(now)
+	if next.IsZero() {
+		next = now.Add(time.Minute)
+	}
+
+	_, err := s.Locker.TryLock(ctx, "scheduler:job"+strconv.Itoa(job.id), next.Sub(now))
+	if err != nil && !errors.Is(err, ErrLockNotAcquired) {
+		s.logger().Warn("scheduled job could not take its lock", "job", job.name, "err", err)
+	}
+	return err == nil
+}
+
+// run calls the job's function, logging any error or panic.
+func (s *Scheduler) run(ctx context.Context, job *scheduledJob) {
+	defer func() {
+		if err := recover(); err != nil {
+			s.logger().Error("scheduled job panicked", "job", job.name, "panic", err)
+		}
+	}()
+
+	if err := job.fn(ctx); err != nil {
+		s.logger().Error("scheduled job failed", "job", job.name, "err", err)
+	}
+}
+
+// logger returns the Logger errors should be written to.
+func (s *Scheduler) logger() Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return NewStdLogger(s.errorLog(), false)
+}
+
+// errorLog returns the *log.Logger of the default Logger.
+func (s *Scheduler) errorLog() *log.Logger {
+	if s.ErrorLog != nil {
+		return s.ErrorLog
+	}
+	return log.Default()
+}
+
+// cronSchedule holds the values matched by each field of a cron expression, as bit sets.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record whether the day fields are *, since a day matches if either
+	// restricted day field matches.
+	domAny, dowAny bool
+}
+
+// cronFields are the bounds of the five fields of a cron expression.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// parseCron parses a five field cron expression.
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %s: %w", expr, cronFields[i].name, err)
+		}
+		sets[i] = set
+	}
+
+	return &cronSchedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and steps between min and max.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", from)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", to)
+				}
+			} else if hasStep {
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q is out of range", part)
+		}
+		for v := start; v <= end; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// next returns the first time after after matching the schedule, or the zero time if there is none
+// within the next five years (for instance, for the 30th of February).
+func (c *cronSchedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		year, month, day := t.Date()
+		loc := t.Location()
+
+		switch {
+		case c.month&(1<<uint(month)) == 0:
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches the day of month and day of week fields.
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
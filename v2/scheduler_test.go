@@ -0,0 +1,154 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler_Every(t *testing.T) {
+	// the ErrorLog of the default Logger gets job errors, when no Logger is set
+	var errorLog bytes.Buffer
+	scheduler := NewScheduler()
+	scheduler.ErrorLog = log.New(&errorLog, "", 0)
+
+	var runs, concurrent, maxConcurrent atomic.Int32
+	scheduler.Every(10*time.Millisecond, func(ctx context.Context) error {
+		runs.Add(1)
+		if n := concurrent.Add(1); n > maxConcurrent.Load() {
+			maxConcurrent.Store(n)
+		}
+		defer concurrent.Add(-1)
+
+		// a run lasting longer than the interval must not overlap with the next one
+		select {
+		case <-time.After(35 * time.Millisecond):
+		case <-ctx.Done():
+		}
+		return errors.New("logged, but otherwise ignored")
+	})
+
+	var panics atomic.Int32
+	scheduler.Every(10*time.Millisecond, func(ctx context.Context) error {
+		panics.Add(1)
+		panic("recovered")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	scheduler.Run(ctx)
+
+	if runs.Load() < 2 {
+		t.Error("expected the job to run several times, but it ran", runs.Load())
+	}
+	if maxConcurrent.Load() != 1 {
+		t.Error("runs of the job overlapped")
+	}
+	if panics.Load() < 2 {
+		t.Error("a panicking job stopped being scheduled")
+	}
+	if concurrent.Load() != 0 {
+		t.Error("Run returned before the running jobs finished")
+	}
+	if !strings.Contains(errorLog.String(), "ERROR scheduled job failed") || !strings.Contains(errorLog.String(), "ERROR scheduled job panicked") {
+		t.Errorf("expected job errors in ErrorLog, got %q", errorLog.String())
+	}
+}
+
+var cronNextTests = []struct {
+	expr     string
+	after    string
+	expected string
+}{
+	{expr: "* * * * *", after: "2024-03-10T10:15:30Z", expected: "2024-03-10T10:16:00Z"},
+	{expr: "*/15 * * * *", after: "2024-03-10T10:15:00Z", expected: "2024-03-10T10:30:00Z"},
+	{expr: "0 3 * * *", after: "2024-03-10T10:15:00Z", expected: "2024-03-11T03:00:00Z"},
+	{expr: "30 9 1 * *", after: "2024-12-02T00:00:00Z", expected: "2025-01-01T09:30:00Z"},
+	{expr: "0 0 * * 1-5", after: "2024-03-08T12:00:00Z", expected: "2024-03-11T00:00:00Z"},
+	{expr: "0 12 13 * 5", after: "2024-03-10T00:00:00Z", expected: "2024-03-13T12:00:00Z"},
+	{expr: "0 0 29 2 *", after: "2024-03-01T00:00:00Z", expected: "2028-02-29T00:00:00Z"},
+	{expr: "0 0 30 2 *", after: "2024-03-01T00:00:00Z", expected: ""},
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	for _, e := range cronNextTests {
+		schedule, err := parseCron(e.expr)
+		if err != nil {
+			t.Errorf("%s: %v", e.expr, err)
+			continue
+		}
+
+		after, _ := time.Parse(time.RFC3339, e.after)
+		next := schedule.next(after)
+
+		got := ""
+		if !next.IsZero() {
+			got = next.Format(time.RFC3339)
+		}
+		if got != e.expected {
+			t.Errorf("%s after %s: expected %q but got %q", e.expr, e.after, e.expected, got)
+		}
+	}
+}
+
+func TestScheduler_CronInvalid(t *testing.T) {
+	scheduler := NewScheduler()
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * * * 7", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if err := scheduler.Cron(expr, func(ctx context.Context) error { return nil }); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+// memoryLocker is a Locker shared by the schedulers of a test, standing in for Redis.
+type memoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]time.Time
+}
+
+func (l *memoryLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (func() error, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until, ok := l.locks[key]; ok && time.Now().Before(until) {
+		return nil, ErrLockNotAcquired
+	}
+	l.locks[key] = time.Now().Add(ttl)
+	return func() error { return nil }, nil
+}
+
+func TestScheduler_Locker(t *testing.T) {
+	locker := &memoryLocker{locks: map[string]time.Time{}}
+
+	var runs atomic.Int32
+	ctx, cancel := context.WithTimeout(context.Background(), 130*time.Millisecond)
+	defer cancel()
+
+	// three instances of the same application, each running the job every 50ms
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		scheduler := NewScheduler()
+		scheduler.Locker = locker
+		scheduler.Every(50*time.Millisecond, func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduler.Run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if runs.Load() != 2 {
+		t.Error("expected the job to run once per interval across instances, but it ran", runs.Load(), "times")
+	}
+}
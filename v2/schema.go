@@ -0,0 +1,680 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidSchema is returned for JSON schemas which can't be parsed, or have references which can't be resolved.
+var ErrInvalidSchema = errors.New("invalid JSON schema")
+
+// JSONSchema is a compiled JSON Schema, which validates decoded JSON values. It supports the validation
+// keywords of draft 2020-12, along with local references ($ref to "#/$defs/..."), and checks the formats
+// email, date-time, date, time, uri, uuid, hostname, ipv4 and ipv6. Unknown keywords, and the
+// unevaluated* keywords, are ignored.
+type JSONSchema struct {
+	root     any
+	patterns map[string]*regexp.Regexp
+}
+
+// compiledSchemas caches the schemas compiled by ReadJSONWithSchema, by their text.
+var compiledSchemas sync.Map
+
+// CompileJSONSchema parses schema, compiling its patterns and checking its references, so that it can
+// validate many values.
+func CompileJSONSchema(schema []byte) (*JSONSchema, error) {
+	dec := json.NewDecoder(bytes.NewReader(schema))
+	dec.UseNumber()
+
+	var root any
+	if err := dec.Decode(&root); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSchema, err)
+	}
+
+	s := &JSONSchema{root: root, patterns: map[string]*regexp.Regexp{}}
+	if err := s.compile(root); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// compile walks the subschemas of node, compiling their patterns and resolving their references.
+func (s *JSONSchema) compile(node any) error {
+	schema, ok := node.(map[string]any)
+	if !ok {
+		if _, isBool := node.(bool); isBool {
+			return nil
+		}
+		return fmt.Errorf("%w: a schema must be an object or a boolean", ErrInvalidSchema)
+	}
+
+	addPattern := func(pattern string) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidSchema, err)
+		}
+		s.patterns[pattern] = re
+		return nil
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		if err := addPattern(pattern); err != nil {
+			return err
+		}
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		if _, err := s.resolve(ref); err != nil {
+			return err
+		}
+	}
+
+	for _, keyword := range []string{"additionalProperties", "contains", "not", "if", "then", "else", "propertyNames"} {
+		if sub, ok := schema[keyword]; ok {
+			if err := s.compile(sub); err != nil {
+				return err
+			}
+		}
+	}
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf", "prefixItems", "items"} {
+		switch sub := schema[keyword].(type) {
+		case []any:
+			for _, item := range sub {
+				if err := s.compile(item); err != nil {
+					return err
+				}
+			}
+		case nil:
+		default:
+			if err := s.compile(sub); err != nil {
+				return err
+			}
+		}
+	}
+	for _, keyword := range []string{"properties", "patternProperties", "$defs", "definitions", "dependentSchemas"} {
+		subs, _ := schema[keyword].(map[string]any)
+		for key, sub := range subs {
+			if keyword == "patternProperties" {
+				if err := addPattern(key); err != nil {
+					return err
+				}
+			}
+			if err := s.compile(sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve returns the subschema ref points to, which must be within the schema.
+func (s *JSONSchema) resolve(ref string) (any, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("%w: only local references are supported, not %q", ErrInvalidSchema, ref)
+	}
+
+	node := s.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token, _ = url.PathUnescape(token)
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+		switch n := node.(type) {
+		case map[string]any:
+			node = n[token]
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("%w: cannot resolve %q", ErrInvalidSchema, ref)
+			}
+			node = n[i]
+		default:
+			node = nil
+		}
+		if node == nil {
+			return nil, fmt.Errorf("%w: cannot resolve %q", ErrInvalidSchema, ref)
+		}
+	}
+	return node, nil
+}
+
+// Validate validates value, as decoded from JSON with json.Decoder.UseNumber, against the schema, and
+// returns the violations by the path of the value they are about, such as "items[1].price", or "body"
+// for the value itself. Values decoded without UseNumber are validated too, with float64 precision.
+func (s *JSONSchema) Validate(value any) ValidationErrors {
+	errs := ValidationErrors{}
+	s.validate(s.root, value, "", errs, 0)
+	return errs
+}
+
+// ValidateJSON validates the JSON document data against the schema.
+func (s *JSONSchema) ValidateJSON(data []byte) (ValidationErrors, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return s.Validate(value), nil
+}
+
+// schemaMaxDepth bounds how deep references are followed, so that a schema referring to itself
+// without consuming the value doesn't recurse forever.
+const schemaMaxDepth = 64
+
+// validate adds the violations of value against node, found at path, to errs.
+func (s *JSONSchema) validate(node, value any, path string, errs ValidationErrors, depth int) {
+	if depth > schemaMaxDepth {
+		errs.Add(schemaPathName(path), "exceeds the depth the schema allows")
+		return
+	}
+
+	schema, ok := node.(map[string]any)
+	if !ok {
+		if allowed, _ := node.(bool); !allowed {
+			errs.Add(schemaPathName(path), "is not allowed")
+		}
+		return
+	}
+	field := schemaPathName(path)
+
+	if ref, ok := schema["$ref"].(string); ok {
+		if target, err := s.resolve(ref); err == nil {
+			s.validate(target, value, path, errs, depth+1)
+		}
+	}
+
+	// nullable is how OpenAPI 3.0 schemas allow null
+	if types, ok := schema["type"]; ok && !schemaTypeMatches(types, value) && !(value == nil && schema["nullable"] == true) {
+		errs.Add(field, "must be of type "+schemaTypeList(types))
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, candidate := range enum {
+			if jsonEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs.Add(field, "must be one of: "+schemaValueList(enum))
+		}
+	}
+	if constant, ok := schema["const"]; ok && !jsonEqual(constant, value) {
+		errs.Add(field, "must be "+schemaValueList([]any{constant}))
+	}
+
+	switch v := value.(type) {
+	case string:
+		s.validateString(schema, v, field, errs)
+	case json.Number, float64:
+		validateNumber(schema, jsonRat(v), field, errs)
+	case map[string]any:
+		s.validateObject(schema, v, path, errs, depth)
+	case []any:
+		s.validateArray(schema, v, path, errs, depth)
+	}
+
+	// combinations
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			s.validate(sub, value, path, errs, depth+1)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if s.matches(sub, value, path, depth) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			errs.Add(field, "must match at least one of the allowed schemas")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matched := 0
+		for _, sub := range oneOf {
+			if s.matches(sub, value, path, depth) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			errs.Add(field, "must match exactly one of the allowed schemas")
+		}
+	}
+	if not, ok := schema["not"]; ok && s.matches(not, value, path, depth) {
+		errs.Add(field, "must not match the disallowed schema")
+	}
+	if condition, ok := schema["if"]; ok {
+		if s.matches(condition, value, path, depth) {
+			if then, ok := schema["then"]; ok {
+				s.validate(then, value, path, errs, depth+1)
+			}
+		} else if otherwise, ok := schema["else"]; ok {
+			s.validate(otherwise, value, path, errs, depth+1)
+		}
+	}
+}
+
+// matches reports whether value is valid against node.
+func (s *JSONSchema) matches(node, value any, path string, depth int) bool {
+	errs := ValidationErrors{}
+	s.validate(node, value, path, errs, depth+1)
+	return len(errs) == 0
+}
+
+// validateString adds the violations of the string keywords of schema.
+func (s *JSONSchema) validateString(schema map[string]any, value, field string, errs ValidationErrors) {
+	length := utf8.RuneCountInString(value)
+	if n, ok := schemaInt(schema["minLength"]); ok && length < n {
+		errs.Add(field, fmt.Sprintf("must be at least %d characters long", n))
+	}
+	if n, ok := schemaInt(schema["maxLength"]); ok && length > n {
+		errs.Add(field, fmt.Sprintf("must be at most %d characters long", n))
+	}
+	if pattern, ok := schema["pattern"].(string); ok && !s.patterns[pattern].MatchString(value) {
+		errs.Add(field, "has an invalid format")
+	}
+	if format, ok := schema["format"].(string); ok && !validFormat(format, value) {
+		errs.Add(field, "must be a valid "+format)
+	}
+}
+
+// validateNumber adds the violations of the numeric keywords of schema.
+func validateNumber(schema map[string]any, value *big.Rat, field string, errs ValidationErrors) {
+	if value == nil {
+		return
+	}
+	check := func(keyword string, fails func(cmp int) bool, message string) {
+		if bound := jsonRat(schema[keyword]); bound != nil && fails(value.Cmp(bound)) {
+			errs.Add(field, message+" "+bound.RatString())
+		}
+	}
+	check("minimum", func(cmp int) bool { return cmp < 0 }, "must be at least")
+	check("maximum", func(cmp int) bool { return cmp > 0 }, "must be at most")
+	check("exclusiveMinimum", func(cmp int) bool { return cmp <= 0 }, "must be greater than")
+	check("exclusiveMaximum", func(cmp int) bool { return cmp >= 0 }, "must be less than")
+
+	if multiple := jsonRat(schema["multipleOf"]); multiple != nil && multiple.Sign() > 0 {
+		if !new(big.Rat).Quo(value, multiple).IsInt() {
+			errs.Add(field, "must be a multiple of "+multiple.FloatString(decimalsOf(multiple)))
+		}
+	}
+}
+
+// validateObject adds the violations of the object keywords of schema.
+func (s *JSONSchema) validateObject(schema map[string]any, value map[string]any, path string, errs ValidationErrors, depth int) {
+	field := schemaPathName(path)
+
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := value[key]; !present {
+					errs.Add(schemaPathName(joinSchemaPath(path, key)), "is required")
+				}
+			}
+		}
+	}
+	if dependent, ok := schema["dependentRequired"].(map[string]any); ok {
+		for key, names := range dependent {
+			if _, present := value[key]; !present {
+				continue
+			}
+			list, _ := names.([]any)
+			for _, name := range list {
+				if other, ok := name.(string); ok {
+					if _, present := value[other]; !present {
+						errs.Add(schemaPathName(joinSchemaPath(path, other)), "is required when "+key+" is present")
+					}
+				}
+			}
+		}
+	}
+	if n, ok := schemaInt(schema["minProperties"]); ok && len(value) < n {
+		errs.Add(field, fmt.Sprintf("must have at least %d properties", n))
+	}
+	if n, ok := schemaInt(schema["maxProperties"]); ok && len(value) > n {
+		errs.Add(field, fmt.Sprintf("must have at most %d properties", n))
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	patternProperties, _ := schema["patternProperties"].(map[string]any)
+	dependentSchemas, _ := schema["dependentSchemas"].(map[string]any)
+	additional, hasAdditional := schema["additionalProperties"]
+	propertyNames, hasPropertyNames := schema["propertyNames"]
+
+	// sorted, so that violations are found in a stable order
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		child := joinSchemaPath(path, key)
+		evaluated := false
+
+		if sub, ok := properties[key]; ok {
+			s.validate(sub, value[key], child, errs, depth+1)
+			evaluated = true
+		}
+		for pattern, sub := range patternProperties {
+			if s.patterns[pattern].MatchString(key) {
+				s.validate(sub, value[key], child, errs, depth+1)
+				evaluated = true
+			}
+		}
+		if !evaluated && hasAdditional {
+			if allowed, isBool := additional.(bool); isBool && !allowed {
+				errs.Add(schemaPathName(child), "is not allowed")
+			} else {
+				s.validate(additional, value[key], child, errs, depth+1)
+			}
+		}
+		if hasPropertyNames && !s.matches(propertyNames, key, child, depth) {
+			errs.Add(schemaPathName(child), "has an invalid name")
+		}
+		if sub, ok := dependentSchemas[key]; ok {
+			s.validate(sub, value, path, errs, depth+1)
+		}
+	}
+}
+
+// validateArray adds the violations of the array keywords of schema.
+func (s *JSONSchema) validateArray(schema map[string]any, value []any, path string, errs ValidationErrors, depth int) {
+	field := schemaPathName(path)
+
+	if n, ok := schemaInt(schema["minItems"]); ok && len(value) < n {
+		errs.Add(field, fmt.Sprintf("must have at least %d items", n))
+	}
+	if n, ok := schemaInt(schema["maxItems"]); ok && len(value) > n {
+		errs.Add(field, fmt.Sprintf("must have at most %d items", n))
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+	outer:
+		for i := range value {
+			for j := 0; j < i; j++ {
+				if jsonEqual(value[i], value[j]) {
+					errs.Add(field, "must not contain duplicate items")
+					break outer
+				}
+			}
+		}
+	}
+
+	// prefixItems, or items as an array in earlier drafts, validate the first items; items the rest
+	prefix, _ := schema["prefixItems"].([]any)
+	rest, hasRest := schema["items"]
+	if list, ok := rest.([]any); ok {
+		prefix = list
+		rest, hasRest = schema["additionalItems"]
+	}
+	for i, item := range value {
+		child := path + "[" + strconv.Itoa(i) + "]"
+		switch {
+		case i < len(prefix):
+			s.validate(prefix[i], item, child, errs, depth+1)
+		case hasRest:
+			if allowed, isBool := rest.(bool); isBool && !allowed {
+				errs.Add(schemaPathName(child), "is not allowed")
+			} else {
+				s.validate(rest, item, child, errs, depth+1)
+			}
+		}
+	}
+
+	if contains, ok := schema["contains"]; ok {
+		count := 0
+		for i, item := range value {
+			if s.matches(contains, item, path+"["+strconv.Itoa(i)+"]", depth) {
+				count++
+			}
+		}
+		min, hasMin := schemaInt(schema["minContains"])
+		if !hasMin {
+			min = 1
+		}
+		if count < min {
+			errs.Add(field, fmt.Sprintf("must contain at least %d matching items", min))
+		}
+		if max, ok := schemaInt(schema["maxContains"]); ok && count > max {
+			errs.Add(field, fmt.Sprintf("must contain at most %d matching items", max))
+		}
+	}
+}
+
+// uuidRegex matches UUIDs, of any version.
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// hostnameRegex matches host names (RFC 1123).
+var hostnameRegex = regexp.MustCompile(`^(?i:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?)(?:\.(?i:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?))*$`)
+
+// validFormat reports whether value has format. Unknown formats are always valid.
+func validFormat(format, value string) bool {
+	switch format {
+	case "email":
+		return IsValidEmail(value)
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", value)
+		return err == nil
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+	case "uuid":
+		return uuidRegex.MatchString(value)
+	case "hostname":
+		return len(value) <= 253 && hostnameRegex.MatchString(value)
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && !strings.Contains(value, ":")
+	case "ipv6":
+		return net.ParseIP(value) != nil && strings.Contains(value, ":")
+	}
+	return true
+}
+
+// schemaTypeMatches reports whether value is of types, a type name or a list of them.
+func schemaTypeMatches(types, value any) bool {
+	names, ok := types.([]any)
+	if !ok {
+		names = []any{types}
+	}
+
+	for _, name := range names {
+		switch name {
+		case "null":
+			if value == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := value.(bool); ok {
+				return true
+			}
+		case "string":
+			if _, ok := value.(string); ok {
+				return true
+			}
+		case "object":
+			if _, ok := value.(map[string]any); ok {
+				return true
+			}
+		case "array":
+			if _, ok := value.([]any); ok {
+				return true
+			}
+		case "number":
+			if jsonRat(value) != nil {
+				return true
+			}
+		case "integer":
+			if r := jsonRat(value); r != nil && r.IsInt() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// schemaTypeList returns types, a type name or a list of them, for error messages.
+func schemaTypeList(types any) string {
+	names, ok := types.([]any)
+	if !ok {
+		return fmt.Sprint(types)
+	}
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprint(name))
+	}
+	return strings.Join(parts, " or ")
+}
+
+// schemaValueList returns values, as JSON, for error messages.
+func schemaValueList(values []any) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		out, _ := json.Marshal(v)
+		parts = append(parts, string(out))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// schemaInt returns the value of a keyword which is a non-negative integer.
+func schemaInt(v any) (int, bool) {
+	r := jsonRat(v)
+	if r == nil || !r.IsInt() || !r.Num().IsInt64() {
+		return 0, false
+	}
+	return int(r.Num().Int64()), true
+}
+
+// jsonRat returns the exact value of a JSON number, or nil if v isn't one.
+func jsonRat(v any) *big.Rat {
+	switch n := v.(type) {
+	case json.Number:
+		r, ok := new(big.Rat).SetString(n.String())
+		if !ok {
+			return nil
+		}
+		return r
+	case float64:
+		return new(big.Rat).SetFloat64(n)
+	}
+	return nil
+}
+
+// decimalsOf returns how many decimals are needed to write r, up to 20.
+func decimalsOf(r *big.Rat) int {
+	for d := 0; d < 20; d++ {
+		scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d)), nil)))
+		if scaled.IsInt() {
+			return d
+		}
+	}
+	return 20
+}
+
+// jsonEqual reports whether the decoded JSON values a and b are equal, comparing numbers by value.
+func jsonEqual(a, b any) bool {
+	if ra, rb := jsonRat(a), jsonRat(b); ra != nil || rb != nil {
+		return ra != nil && rb != nil && ra.Cmp(rb) == 0
+	}
+
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, value := range av {
+			other, ok := bv[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// joinSchemaPath returns the path of the property key of the object at path.
+func joinSchemaPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// schemaPathName returns path as a ValidationErrors field, naming the whole document "body".
+func schemaPathName(path string) string {
+	if path == "" {
+		return "body"
+	}
+	return path
+}
+
+// ReadJSONWithSchema reads the JSON body of r, as ReadJSON does, after validating it against the JSON
+// Schema schema. When the body doesn't conform, the violations are returned as ValidationErrors, by the
+// path of the value they are about, so that ErrorJSON sends them with a 422 status code. Schemas are
+// compiled once, and kept for later requests.
+func (t *Tools) ReadJSONWithSchema(w http.ResponseWriter, r *http.Request, schema []byte, data any) error {
+	compiled, ok := compiledSchemas.Load(string(schema))
+	if !ok {
+		s, err := CompileJSONSchema(schema)
+		if err != nil {
+			return err
+		}
+		compiled, _ = compiledSchemas.LoadOrStore(string(schema), s)
+	}
+
+	maxBytes := t.maxJSONSize()
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(http.MaxBytesReader(w, r.Body, maxBytes)); err != nil {
+		if tooLarge := asBodyTooLarge(err); tooLarge != nil {
+			return tooLarge
+		}
+		return err
+	}
+	r.Body.Close()
+
+	// badly-formed bodies are left to ReadJSON, which describes what is wrong with them
+	if errs, err := compiled.(*JSONSchema).ValidateJSON(body.Bytes()); err == nil && len(errs) > 0 {
+		t.logger().Debug("JSON body does not match schema", "method", r.Method, "path", r.URL.Path, "err", errs)
+		return errs
+	}
+
+	r.Body = io.NopCloser(&body)
+	return t.ReadJSON(w, r, data)
+}
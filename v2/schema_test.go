@@ -0,0 +1,198 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var orderSchema = []byte(`{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["email", "items"],
+	"additionalProperties": false,
+	"properties": {
+		"email": {"type": "string", "format": "email"},
+		"note": {"type": ["string", "null"], "maxLength": 10},
+		"coupon": {"type": "string", "pattern": "^[A-Z]{4}[0-9]{2}$"},
+		"items": {
+			"type": "array",
+			"minItems": 1,
+			"uniqueItems": true,
+			"items": {"$ref": "#/$defs/item"}
+		},
+		"shipping": {"enum": ["standard", "express"]}
+	},
+	"$defs": {
+		"item": {
+			"type": "object",
+			"required": ["sku", "quantity", "price"],
+			"properties": {
+				"sku": {"type": "string", "minLength": 3},
+				"quantity": {"type": "integer", "minimum": 1, "maximum": 100},
+				"price": {"type": "number", "exclusiveMinimum": 0, "multipleOf": 0.01}
+			}
+		}
+	}
+}`)
+
+var jsonSchemaTests = []struct {
+	name     string
+	document string
+	errors   ValidationErrors
+}{
+	{
+		name:     "valid",
+		document: `{"email":"jane@example.com","note":null,"coupon":"SAVE10","items":[{"sku":"abc","quantity":2,"price":19.99}],"shipping":"express"}`,
+		errors:   ValidationErrors{},
+	},
+	{
+		name:     "missing properties",
+		document: `{}`,
+		errors:   ValidationErrors{"email": {"is required"}, "items": {"is required"}},
+	},
+	{
+		name:     "wrong root type",
+		document: `[]`,
+		errors:   ValidationErrors{"body": {"must be of type object"}},
+	},
+	{
+		name:     "nested violations",
+		document: `{"email":"jane","items":[{"sku":"ab","quantity":1.5,"price":0.001}],"extra":1}`,
+		errors: ValidationErrors{
+			"email":             {"must be a valid email"},
+			"extra":             {"is not allowed"},
+			"items[0].sku":      {"must be at least 3 characters long"},
+			"items[0].quantity": {"must be of type integer"},
+			"items[0].price":    {"must be a multiple of 0.01"},
+		},
+	},
+	{
+		name:     "strings and enums",
+		document: `{"email":"jane@example.com","note":"far too long a note","coupon":"save10","items":[{"sku":"abc","quantity":101,"price":0}],"shipping":"drone"}`,
+		errors: ValidationErrors{
+			"note":              {"must be at most 10 characters long"},
+			"coupon":            {"has an invalid format"},
+			"items[0].quantity": {"must be at most 100"},
+			"items[0].price":    {"must be greater than 0"},
+			"shipping":          {`must be one of: "standard", "express"`},
+		},
+	},
+	{
+		name:     "unique items",
+		document: `{"email":"jane@example.com","items":[{"sku":"abc","quantity":1,"price":1},{"price":1.0,"quantity":1,"sku":"abc"}]}`,
+		errors:   ValidationErrors{"items": {"must not contain duplicate items"}},
+	},
+}
+
+func TestJSONSchema_Validate(t *testing.T) {
+	schema, err := CompileJSONSchema(orderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range jsonSchemaTests {
+		errs, err := schema.ValidateJSON([]byte(e.document))
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(errs, e.errors) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.errors, errs)
+		}
+	}
+}
+
+var jsonSchemaCombinationTests = []struct {
+	name     string
+	schema   string
+	document string
+	valid    bool
+}{
+	{name: "anyOf", schema: `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, document: `3`, valid: true},
+	{name: "anyOf fails", schema: `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, document: `3.5`, valid: false},
+	{name: "oneOf", schema: `{"oneOf":[{"minimum":5},{"maximum":2}]}`, document: `7`, valid: true},
+	{name: "oneOf both", schema: `{"oneOf":[{"minimum":5},{"maximum":10}]}`, document: `7`, valid: false},
+	{name: "allOf", schema: `{"allOf":[{"minLength":2},{"maxLength":3}]}`, document: `"abcd"`, valid: false},
+	{name: "not", schema: `{"not":{"type":"null"}}`, document: `null`, valid: false},
+	{name: "if then", schema: `{"if":{"properties":{"country":{"const":"US"}}},"then":{"required":["zip"]},"else":{"required":["postcode"]}}`, document: `{"country":"US","postcode":"x"}`, valid: false},
+	{name: "if else", schema: `{"if":{"properties":{"country":{"const":"US"}}},"then":{"required":["zip"]},"else":{"required":["postcode"]}}`, document: `{"country":"FR","postcode":"x"}`, valid: true},
+	{name: "prefixItems", schema: `{"prefixItems":[{"type":"number"},{"type":"string"}],"items":false}`, document: `[1,"a"]`, valid: true},
+	{name: "prefixItems extra", schema: `{"prefixItems":[{"type":"number"},{"type":"string"}],"items":false}`, document: `[1,"a",true]`, valid: false},
+	{name: "contains", schema: `{"contains":{"const":"admin"},"maxContains":1}`, document: `["user","admin"]`, valid: true},
+	{name: "contains none", schema: `{"contains":{"const":"admin"}}`, document: `["user"]`, valid: false},
+	{name: "patternProperties", schema: `{"patternProperties":{"^x-":{"type":"string"}},"additionalProperties":false}`, document: `{"x-a":"1"}`, valid: true},
+	{name: "patternProperties fails", schema: `{"patternProperties":{"^x-":{"type":"string"}},"additionalProperties":false}`, document: `{"x-a":1}`, valid: false},
+	{name: "dependentRequired", schema: `{"dependentRequired":{"card":["cvc"]}}`, document: `{"card":"4111"}`, valid: false},
+	{name: "propertyNames", schema: `{"propertyNames":{"maxLength":3}}`, document: `{"long":1}`, valid: false},
+	{name: "recursive ref", schema: `{"type":"object","properties":{"children":{"type":"array","items":{"$ref":"#"}}},"required":["name"]}`, document: `{"name":"a","children":[{"name":"b","children":[{}]}]}`, valid: false},
+	{name: "big integers", schema: `{"maximum":9007199254740993}`, document: `9007199254740994`, valid: false},
+	{name: "false schema", schema: `false`, document: `1`, valid: false},
+}
+
+func TestJSONSchema_Combinations(t *testing.T) {
+	for _, e := range jsonSchemaCombinationTests {
+		schema, err := CompileJSONSchema([]byte(e.schema))
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		errs, err := schema.ValidateJSON([]byte(e.document))
+		if err != nil || (len(errs) == 0) != e.valid {
+			t.Errorf("%s: expected valid to be %t, got %v (%v)", e.name, e.valid, errs, err)
+		}
+	}
+}
+
+func TestCompileJSONSchema_Errors(t *testing.T) {
+	for _, schema := range []string{`{`, `{"pattern":"("}`, `{"$ref":"https://example.com/schema"}`, `{"$ref":"#/$defs/missing"}`, `{"properties":{"a":3}}`} {
+		if _, err := CompileJSONSchema([]byte(schema)); !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("%s: expected ErrInvalidSchema, got %v", schema, err)
+		}
+	}
+}
+
+func TestTools_ReadJSONWithSchema(t *testing.T) {
+	var testTools Tools
+
+	type order struct {
+		Email string `json:"email"`
+		Items []struct {
+			SKU      string  `json:"sku"`
+			Quantity int     `json:"quantity"`
+			Price    float64 `json:"price"`
+		} `json:"items"`
+	}
+
+	var o order
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"email":"jane@example.com","items":[{"sku":"abc","quantity":2,"price":19.99}]}`))
+	if err := testTools.ReadJSONWithSchema(httptest.NewRecorder(), req, orderSchema, &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Email != "jane@example.com" || len(o.Items) != 1 || o.Items[0].Quantity != 2 {
+		t.Error("wrong order", o)
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`{"email":"jane","items":[]}`))
+	err := testTools.ReadJSONWithSchema(httptest.NewRecorder(), req, orderSchema, &o)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || errs.Get("email") == "" || errs.Get("items") == "" {
+		t.Fatal("expected validation errors, got", err)
+	}
+
+	rr := httptest.NewRecorder()
+	_ = testTools.ErrorJSON(rr, err)
+	var payload JSONResponse
+	if rr.Code != http.StatusUnprocessableEntity || json.Unmarshal(rr.Body.Bytes(), &payload) != nil {
+		t.Error("expected a 422 response", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`{"email":`))
+	if err = testTools.ReadJSONWithSchema(httptest.NewRecorder(), req, orderSchema, &o); err == nil || !strings.Contains(err.Error(), "badly-formed") {
+		t.Error("expected ReadJSON's error for badly-formed JSON, got", err)
+	}
+}
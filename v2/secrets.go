@@ -0,0 +1,223 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSecretNotFound is returned by Secrets.Get when a provider has no secret of that name.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// Secrets is the interface implemented by secret providers: environment variables, files such as Docker
+// secrets, or, through SecretsFunc, a secret manager like Vault or AWS SSM.
+type Secrets interface {
+	// Get returns the secret called name, or ErrSecretNotFound.
+	Get(ctx context.Context, name string) ([]byte, error)
+}
+
+// SecretsFunc is an adapter to use a function, such as a call to a secret manager's API, as Secrets.
+type SecretsFunc func(ctx context.Context, name string) ([]byte, error)
+
+// Get calls f(ctx, name).
+func (f SecretsFunc) Get(ctx context.Context, name string) ([]byte, error) {
+	return f(ctx, name)
+}
+
+// EnvSecrets reads secrets from environment variables called Prefix followed by the secret's name.
+// If that variable isn't set but the same name followed by _FILE is, the secret is read from the file
+// it points to instead, a common convention for Docker images.
+type EnvSecrets struct {
+	Prefix string
+}
+
+// Get returns the secret called name.
+func (e EnvSecrets) Get(ctx context.Context, name string) ([]byte, error) {
+	key := e.Prefix + name
+	if value, ok := os.LookupEnv(key); ok {
+		return []byte(value), nil
+	}
+	if file, ok := os.LookupEnv(key + "_FILE"); ok {
+		return readSecretFile(file)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
+
+// FileSecrets reads each secret from the file of the same name in Dir, which defaults to /run/secrets
+// where Docker and Kubernetes mount them. A single trailing newline is removed.
+type FileSecrets struct {
+	Dir string
+}
+
+// Get returns the secret called name.
+func (f FileSecrets) Get(ctx context.Context, name string) ([]byte, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid secret name %q", name)
+	}
+
+	dir := f.Dir
+	if dir == "" {
+		dir = "/run/secrets"
+	}
+	return readSecretFile(filepath.Join(dir, name))
+}
+
+// readSecretFile reads the secret in the file at path, without its trailing newline.
+func readSecretFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, filepath.Base(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	return bytes.TrimSuffix(data, []byte("\r")), nil
+}
+
+// ChainSecrets returns Secrets which asks each provider in turn, returning the first secret found.
+func ChainSecrets(providers ...Secrets) Secrets {
+	return SecretsFunc(func(ctx context.Context, name string) ([]byte, error) {
+		for _, provider := range providers {
+			value, err := provider.Get(ctx, name)
+			if !errors.Is(err, ErrSecretNotFound) {
+				return value, err
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	})
+}
+
+// CachedSecrets keeps the secrets read from a slower provider, such as a secret manager, for TTL.
+// When a secret is read again and its value has changed, the functions registered with OnRotate are called,
+// so that keys can be rotated without restarting.
+type CachedSecrets struct {
+	provider Secrets
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]cachedSecret
+	callbacks map[string][]func(value []byte)
+}
+
+// cachedSecret is a secret held by CachedSecrets.
+type cachedSecret struct {
+	value   []byte
+	fetched time.Time
+}
+
+// NewCachedSecrets returns CachedSecrets reading from provider, keeping secrets for ttl.
+func NewCachedSecrets(provider Secrets, ttl time.Duration) *CachedSecrets {
+	return &CachedSecrets{
+		provider:  provider,
+		ttl:       ttl,
+		entries:   make(map[string]cachedSecret),
+		callbacks: make(map[string][]func(value []byte)),
+	}
+}
+
+// Get returns the secret called name, from the cache while it is fresh.
+func (c *CachedSecrets) Get(ctx context.Context, name string) ([]byte, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+
+	if ok && time.Since(entry.fetched) < c.ttl {
+		return entry.value, nil
+	}
+	return c.fetch(ctx, name)
+}
+
+// OnRotate registers fn to be called with the new value whenever the secret called name changes.
+func (c *CachedSecrets) OnRotate(name string, fn func(value []byte)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.callbacks[name] = append(c.callbacks[name], fn)
+}
+
+// Refresh reads again every secret read so far, calling the OnRotate functions of those which changed.
+// It can be run periodically with a Scheduler.
+func (c *CachedSecrets) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.entries))
+	for name := range c.entries {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+
+	for _, name := range names {
+		if _, err := c.fetch(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch reads the secret called name from the provider, and caches it.
+func (c *CachedSecrets) fetch(ctx context.Context, name string) ([]byte, error) {
+	value, err := c.provider.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	previous, seen := c.entries[name]
+	c.entries[name] = cachedSecret{value: value, fetched: time.Now()}
+	callbacks := c.callbacks[name]
+	c.mu.Unlock()
+
+	if seen && !bytes.Equal(previous.value, value) {
+		for _, fn := range callbacks {
+			fn(value)
+		}
+	}
+	return value, nil
+}
+
+// SecretNames names the secrets holding the keys used by the toolkit. Empty names are skipped.
+type SecretNames struct {
+	CookieKey string
+	CursorKey string
+	// JWTSecret holds an HS256 secret.
+	JWTSecret string
+}
+
+// LoadSecrets sets Tools.CookieKey, Tools.CursorKey and the HS256 key of Tools.JWTKeys from the secrets
+// named in names. Loading a new JWT secret keeps the previous one after it, to verify tokens it signed
+// while they are still in use. It is meant to be called at startup, before serving requests.
+func (t *Tools) LoadSecrets(ctx context.Context, secrets Secrets, names SecretNames) error {
+	if names.CookieKey != "" {
+		value, err := secrets.Get(ctx, names.CookieKey)
+		if err != nil {
+			return err
+		}
+		t.CookieKey = value
+	}
+
+	if names.CursorKey != "" {
+		value, err := secrets.Get(ctx, names.CursorKey)
+		if err != nil {
+			return err
+		}
+		t.CursorKey = value
+	}
+
+	if names.JWTSecret != "" {
+		value, err := secrets.Get(ctx, names.JWTSecret)
+		if err != nil {
+			return err
+		}
+		if len(t.JWTKeys) == 0 || t.JWTKeys[0].Algorithm != HS256 || !bytes.Equal(t.JWTKeys[0].Secret, value) {
+			t.JWTKeys = append([]JWTKey{{Algorithm: HS256, Secret: value}}, t.JWTKeys...)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnvSecrets(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"db_password": "from-file\n"})
+
+	t.Setenv("APP_API_TOKEN", "from-env")
+	t.Setenv("APP_DB_PASSWORD_FILE", filepath.Join(dir, "db_password"))
+
+	secrets := EnvSecrets{Prefix: "APP_"}
+	ctx := context.Background()
+
+	if v, err := secrets.Get(ctx, "API_TOKEN"); err != nil || string(v) != "from-env" {
+		t.Errorf("wrong secret %q %v", v, err)
+	}
+	if v, err := secrets.Get(ctx, "DB_PASSWORD"); err != nil || string(v) != "from-file" {
+		t.Errorf("wrong secret from _FILE %q %v", v, err)
+	}
+	if _, err := secrets.Get(ctx, "MISSING"); !errors.Is(err, ErrSecretNotFound) {
+		t.Error("expected ErrSecretNotFound, got", err)
+	}
+}
+
+func TestFileSecrets(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"jwt_secret": "s3cr3t\r\n"})
+
+	secrets := FileSecrets{Dir: dir}
+	ctx := context.Background()
+
+	if v, err := secrets.Get(ctx, "jwt_secret"); err != nil || string(v) != "s3cr3t" {
+		t.Errorf("wrong secret %q %v", v, err)
+	}
+	if _, err := secrets.Get(ctx, "missing"); !errors.Is(err, ErrSecretNotFound) {
+		t.Error("expected ErrSecretNotFound, got", err)
+	}
+	if _, err := secrets.Get(ctx, "../etc/passwd"); err == nil || errors.Is(err, ErrSecretNotFound) {
+		t.Error("expected an invalid name error, got", err)
+	}
+}
+
+func TestChainSecrets(t *testing.T) {
+	failing := SecretsFunc(func(ctx context.Context, name string) ([]byte, error) {
+		if name == "broken" {
+			return nil, errors.New("vault sealed")
+		}
+		return nil, ErrSecretNotFound
+	})
+	t.Setenv("CHAINED", "value")
+
+	secrets := ChainSecrets(failing, EnvSecrets{})
+	if v, err := secrets.Get(context.Background(), "CHAINED"); err != nil || string(v) != "value" {
+		t.Errorf("wrong secret %q %v", v, err)
+	}
+	if _, err := secrets.Get(context.Background(), "broken"); err == nil || errors.Is(err, ErrSecretNotFound) {
+		t.Error("expected the provider error to stop the chain, got", err)
+	}
+}
+
+func TestCachedSecrets(t *testing.T) {
+	calls := 0
+	value := "v1"
+	provider := SecretsFunc(func(ctx context.Context, name string) ([]byte, error) {
+		calls++
+		return []byte(value), nil
+	})
+
+	secrets := NewCachedSecrets(provider, time.Hour)
+	var rotated []string
+	secrets.OnRotate("key", func(v []byte) { rotated = append(rotated, string(v)) })
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if v, _ := secrets.Get(ctx, "key"); string(v) != "v1" {
+			t.Error("wrong value", string(v))
+		}
+	}
+	if calls != 1 {
+		t.Error("expected the secret to be cached, but the provider was called", calls, "times")
+	}
+
+	_ = secrets.Refresh(ctx)
+	if len(rotated) != 0 {
+		t.Error("unchanged secrets must not trigger rotation")
+	}
+
+	value = "v2"
+	if err := secrets.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 1 || rotated[0] != "v2" {
+		t.Error("expected a rotation to v2, got", rotated)
+	}
+	if v, _ := secrets.Get(ctx, "key"); string(v) != "v2" {
+		t.Error("wrong value after rotation", string(v))
+	}
+}
+
+func TestTools_LoadSecrets(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"cookie_key": "0123456789abcdef0123456789abcdef",
+		"jwt_secret": "first",
+	})
+
+	var testTools Tools
+	names := SecretNames{CookieKey: "cookie_key", JWTSecret: "jwt_secret"}
+	if err := testTools.LoadSecrets(context.Background(), FileSecrets{Dir: dir}, names); err != nil {
+		t.Fatal(err)
+	}
+	if string(testTools.CookieKey) != "0123456789abcdef0123456789abcdef" {
+		t.Error("wrong cookie key")
+	}
+
+	token, err := testTools.GenerateJWT(JWTClaims{"sub": "42"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// after rotation, new tokens use the new secret, and old tokens still verify
+	writeTestFiles(t, dir, map[string]string{"jwt_secret": "second"})
+	if err = testTools.LoadSecrets(context.Background(), FileSecrets{Dir: dir}, names); err != nil {
+		t.Fatal(err)
+	}
+	if len(testTools.JWTKeys) != 2 || string(testTools.JWTKeys[0].Secret) != "second" {
+		t.Error("wrong keys after rotation", len(testTools.JWTKeys))
+	}
+	if _, err = testTools.ParseJWT(token); err != nil {
+		t.Error("a token signed with the previous secret no longer verifies:", err)
+	}
+
+	if err = testTools.LoadSecrets(context.Background(), FileSecrets{Dir: dir}, SecretNames{CursorKey: "missing"}); !errors.Is(err, ErrSecretNotFound) {
+		t.Error("expected ErrSecretNotFound, got", err)
+	}
+}
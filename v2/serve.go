@@ -0,0 +1,147 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ServeOptions is the type used to configure Serve. Zero values are replaced with sensible defaults.
+type ServeOptions struct {
+	// Addr is the address to listen on. Defaults to :8080, or :443 when serving TLS.
+	Addr string
+
+	ReadTimeout       time.Duration // defaults to 15 seconds
+	ReadHeaderTimeout time.Duration // defaults to 5 seconds
+	WriteTimeout      time.Duration // defaults to 30 seconds
+	IdleTimeout       time.Duration // defaults to 2 minutes
+
+	// ShutdownTimeout is how long in-flight requests are given to finish once shutting down. Defaults to 30 seconds.
+	ShutdownTimeout time.Duration
+
+	// TLSCertFile and TLSKeyFile, if set, make the server use HTTPS.
+	TLSCertFile string
+	TLSKeyFile  string
+	// RedirectAddr, if set when serving TLS, is the address of a second listener redirecting HTTP requests to HTTPS.
+	RedirectAddr string
+}
+
+// Serve runs an HTTP server for handler, configured with opts, until the process receives SIGINT or SIGTERM.
+// It then stops accepting connections and waits up to opts.ShutdownTimeout for in-flight requests to complete.
+// Serve returns nil after a clean shutdown.
+func (t *Tools) Serve(handler http.Handler, opts ServeOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tls := opts.TLSCertFile != "" || opts.TLSKeyFile != ""
+	if opts.Addr == "" {
+		opts.Addr = ":8080"
+		if tls {
+			opts.Addr = ":443"
+		}
+	}
+
+	ln, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return err
+	}
+
+	var redirectLn net.Listener
+	if tls && opts.RedirectAddr != "" {
+		if redirectLn, err = net.Listen("tcp", opts.RedirectAddr); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+
+	return t.serve(ctx, handler, opts, ln, redirectLn)
+}
+
+// serve does the work for Serve, on listeners which are already open, until ctx is cancelled.
+func (t *Tools) serve(ctx context.Context, handler http.Handler, opts ServeOptions, ln, redirectLn net.Listener) error {
+	srv := &http.Server{
+		Handler:           handler,
+		ReadTimeout:       durationOr(opts.ReadTimeout, 15*time.Second),
+		ReadHeaderTimeout: durationOr(opts.ReadHeaderTimeout, 5*time.Second),
+		WriteTimeout:      durationOr(opts.WriteTimeout, 30*time.Second),
+		IdleTimeout:       durationOr(opts.IdleTimeout, 2*time.Minute),
+		ErrorLog:          t.errorLog(),
+	}
+	servers := []*http.Server{srv}
+
+	errs := make(chan error, 2)
+	go func() {
+		if opts.TLSCertFile != "" || opts.TLSKeyFile != "" {
+			errs <- srv.ServeTLS(ln, opts.TLSCertFile, opts.TLSKeyFile)
+		} else {
+			errs <- srv.Serve(ln)
+		}
+	}()
+
+	if redirectLn != nil {
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		redirect := &http.Server{
+			Handler:           httpsRedirect(port),
+			ReadHeaderTimeout: 5 * time.Second,
+			ErrorLog:          t.errorLog(),
+		}
+		servers = append(servers, redirect)
+		go func() {
+			errs <- redirect.Serve(redirectLn)
+		}()
+	}
+
+	select {
+	case err := <-errs:
+		// a server stopped on its own, so take the other one down too
+		for _, s := range servers {
+			s.Close()
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), durationOr(opts.ShutdownTimeout, 30*time.Second))
+	defer cancel()
+
+	var shutdownErr error
+	for _, s := range servers {
+		if err := s.Shutdown(shutdownCtx); err != nil && shutdownErr == nil {
+			shutdownErr = err
+		}
+	}
+
+	for range servers {
+		if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) && shutdownErr == nil {
+			shutdownErr = err
+		}
+	}
+	return shutdownErr
+}
+
+// httpsRedirect returns a handler permanently redirecting every request to the same URL over HTTPS, on tlsPort.
+func httpsRedirect(tlsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// durationOr returns d, or def if d is not set.
+func durationOr(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,83 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTools_ServeGracefulShutdown(t *testing.T) {
+	testTools := Tools{ErrorLog: discardLog}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- testTools.serve(ctx, handler, ServeOptions{ShutdownTimeout: 5 * time.Second}, ln, nil)
+	}()
+
+	// start a slow request, then shut down while it is in flight
+	body := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	cancel()
+
+	if got := <-body; got != "done" {
+		t.Error("in-flight request was not drained:", got)
+	}
+	if err = <-served; err != nil {
+		t.Error("expected a clean shutdown, but got", err)
+	}
+
+	if _, err = http.Get("http://" + ln.Addr().String()); err == nil {
+		t.Error("expected the server to be stopped")
+	}
+}
+
+var httpsRedirectTests = []struct {
+	port     string
+	target   string
+	expected string
+}{
+	{port: "443", target: "http://example.com/path?q=1", expected: "https://example.com/path?q=1"},
+	{port: "8443", target: "http://example.com:8080/path", expected: "https://example.com:8443/path"},
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	for _, test := range httpsRedirectTests {
+		rr := httptest.NewRecorder()
+		httpsRedirect(test.port).ServeHTTP(rr, httptest.NewRequest("GET", test.target, nil))
+
+		if rr.Code != http.StatusPermanentRedirect {
+			t.Errorf("%s: wrong status code %d", test.target, rr.Code)
+		}
+		if got := rr.Header().Get("Location"); got != test.expected {
+			t.Errorf("%s: expected redirect to %s but got %s", test.target, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package toolkit
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidCookie is returned when a signed or encrypted cookie has been tampered with, or can't be decoded.
+	ErrInvalidCookie = errors.New("invalid cookie value")
+	// ErrCookieTooLong is returned when a cookie would be larger than the 4096 bytes browsers are required to support.
+	ErrCookieTooLong = errors.New("cookie value too long")
+)
+
+// SetSignedCookie sets cookie, after signing its value with an HMAC derived from Tools.CookieKey.
+// The value remains readable by the client, but any change to it is detected by GetSignedCookie.
+func (t *Tools) SetSignedCookie(w http.ResponseWriter, cookie *http.Cookie) error {
+	key, err := t.cookieSubkey("signing")
+	if err != nil {
+		return err
+	}
+
+	signed := *cookie
+	signed.Value = base64.RawURLEncoding.EncodeToString([]byte(cookie.Value)) + "." +
+		base64.RawURLEncoding.EncodeToString(signCookie(key, cookie.Name, cookie.Value))
+	return writeCookie(w, &signed)
+}
+
+// GetSignedCookie returns the value of the cookie called name set by SetSignedCookie.
+// It returns http.ErrNoCookie if there is no such cookie, and ErrInvalidCookie if its signature doesn't match.
+func (t *Tools) GetSignedCookie(r *http.Request, name string) (string, error) {
+	key, err := t.cookieSubkey("signing")
+	if err != nil {
+		return "", err
+	}
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+
+	encodedValue, encodedSignature, found := strings.Cut(cookie.Value, ".")
+	if !found {
+		return "", ErrInvalidCookie
+	}
+	value, err := base64.RawURLEncoding.DecodeString(encodedValue)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, signCookie(key, name, string(value))) {
+		return "", ErrInvalidCookie
+	}
+
+	return string(value), nil
+}
+
+// SetEncryptedCookie sets cookie, after encrypting its value with AES-GCM using a key derived from Tools.CookieKey.
+// The cookie's name is authenticated along with its value, so a value can't be moved to another cookie.
+func (t *Tools) SetEncryptedCookie(w http.ResponseWriter, cookie *http.Cookie) error {
+	gcm, err := t.cookieCipher()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	encrypted := *cookie
+	encrypted.Value = base64.RawURLEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(cookie.Value), []byte(cookie.Name)))
+	return writeCookie(w, &encrypted)
+}
+
+// GetEncryptedCookie returns the decrypted value of the cookie called name set by SetEncryptedCookie.
+// It returns http.ErrNoCookie if there is no such cookie, and ErrInvalidCookie if it can't be decrypted.
+func (t *Tools) GetEncryptedCookie(r *http.Request, name string) (string, error) {
+	gcm, err := t.cookieCipher()
+	if err != nil {
+		return "", err
+	}
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", ErrInvalidCookie
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	return string(plaintext), nil
+}
+
+// cookieSubkey derives a key for the given purpose from Tools.CookieKey,
+// so that the same secret is never used directly for both signing and encryption.
+func (t *Tools) cookieSubkey(purpose string) ([]byte, error) {
+	if len(t.CookieKey) < 32 {
+		return nil, errors.New("cookie key must be at least 32 bytes long")
+	}
+	mac := hmac.New(sha256.New, t.CookieKey)
+	mac.Write([]byte("toolkit cookie " + purpose))
+	return mac.Sum(nil), nil
+}
+
+// cookieCipher returns the AES-GCM cipher used for encrypted cookies.
+func (t *Tools) cookieCipher() (cipher.AEAD, error) {
+	key, err := t.cookieSubkey("encryption")
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// signCookie returns the HMAC of a cookie's name and value.
+func signCookie(key []byte, name, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "=" + value))
+	return mac.Sum(nil)
+}
+
+// writeCookie sets cookie, unless it is too long for browsers to store.
+func writeCookie(w http.ResponseWriter, cookie *http.Cookie) error {
+	if len(cookie.String()) > 4096 {
+		return ErrCookieTooLong
+	}
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// SessionToken is a random token for stateful authentication. The plaintext is sent to the client,
+// while only its hash is stored server-side, so a leaked database can't be used to hijack sessions.
+type SessionToken struct {
+	Plaintext string
+	Hash      []byte
+	Expiry    time.Time
+}
+
+// Expired reports whether the token's expiry has passed.
+func (st *SessionToken) Expired() bool {
+	return !time.Now().Before(st.Expiry)
+}
+
+// CreateSessionToken returns a new random session token which expires after ttl.
+func (t *Tools) CreateSessionToken(ttl time.Duration) (*SessionToken, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+	return &SessionToken{
+		Plaintext: plaintext,
+		Hash:      HashToken(plaintext),
+		Expiry:    time.Now().Add(ttl),
+	}, nil
+}
+
+// HashToken returns the SHA-256 hash of a token's plaintext, to look up the stored session it belongs to.
+func HashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
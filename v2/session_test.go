@@ -0,0 +1,120 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var cookieKey = []byte("0123456789abcdef0123456789abcdef")
+
+// replayCookie returns a request carrying the cookie set in rr, optionally with a modified value.
+func replayCookie(rr *httptest.ResponseRecorder, modify func(string) string) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, c := range rr.Result().Cookies() {
+		if modify != nil {
+			c.Value = modify(c.Value)
+		}
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func TestTools_SignedCookie(t *testing.T) {
+	testTools := Tools{CookieKey: cookieKey}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.SetSignedCookie(rr, &http.Cookie{Name: "user", Value: "jack sparrow", HttpOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := testTools.GetSignedCookie(replayCookie(rr, nil), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "jack sparrow" {
+		t.Error("wrong cookie value", value)
+	}
+
+	tampered := replayCookie(rr, func(v string) string { return "YWRtaW4" + v[strings.Index(v, "."):] })
+	if _, err = testTools.GetSignedCookie(tampered, "user"); !errors.Is(err, ErrInvalidCookie) {
+		t.Error("expected ErrInvalidCookie, but got", err)
+	}
+
+	if _, err = testTools.GetSignedCookie(httptest.NewRequest("GET", "/", nil), "user"); !errors.Is(err, http.ErrNoCookie) {
+		t.Error("expected http.ErrNoCookie, but got", err)
+	}
+}
+
+func TestTools_EncryptedCookie(t *testing.T) {
+	testTools := Tools{CookieKey: cookieKey}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.SetEncryptedCookie(rr, &http.Cookie{Name: "session", Value: "secret data"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(rr.Header().Get("Set-Cookie"), "secret") {
+		t.Error("cookie value was not encrypted")
+	}
+
+	value, err := testTools.GetEncryptedCookie(replayCookie(rr, nil), "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "secret data" {
+		t.Error("wrong cookie value", value)
+	}
+
+	tampered := replayCookie(rr, func(v string) string { return v[:len(v)-2] + "AA" })
+	if _, err = testTools.GetEncryptedCookie(tampered, "session"); !errors.Is(err, ErrInvalidCookie) {
+		t.Error("expected ErrInvalidCookie, but got", err)
+	}
+
+	// a value encrypted for one cookie can't be used for another
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "other", Value: rr.Result().Cookies()[0].Value})
+	if _, err = testTools.GetEncryptedCookie(req, "other"); !errors.Is(err, ErrInvalidCookie) {
+		t.Error("expected ErrInvalidCookie, but got", err)
+	}
+
+	if err = testTools.SetEncryptedCookie(httptest.NewRecorder(), &http.Cookie{Name: "big", Value: strings.Repeat("x", 4096)}); !errors.Is(err, ErrCookieTooLong) {
+		t.Error("expected ErrCookieTooLong, but got", err)
+	}
+
+	var noKey Tools
+	if err = noKey.SetEncryptedCookie(httptest.NewRecorder(), &http.Cookie{Name: "session", Value: "x"}); err == nil {
+		t.Error("error expected without a cookie key, but none received")
+	}
+}
+
+func TestTools_CreateSessionToken(t *testing.T) {
+	var testTools Tools
+
+	token, err := testTools.CreateSessionToken(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(token.Plaintext) != 32 {
+		t.Errorf("wrong token length; expected 32 but got %d", len(token.Plaintext))
+	}
+	if !bytes.Equal(HashToken(token.Plaintext), token.Hash) {
+		t.Error("hash does not match plaintext")
+	}
+	if token.Expired() {
+		t.Error("token should not be expired")
+	}
+
+	other, _ := testTools.CreateSessionToken(-time.Second)
+	if other.Plaintext == token.Plaintext {
+		t.Error("expected tokens to be unique")
+	}
+	if !other.Expired() {
+		t.Error("token should be expired")
+	}
+}
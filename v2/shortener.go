@@ -0,0 +1,298 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidShortLink is returned by Shorten and ShortenAs for URLs which are not absolute http or https
+// URLs, and for codes which are not made of letters, digits, dashes and underscores.
+var ErrInvalidShortLink = errors.New("the link or its short code is not valid")
+
+// shortCodeSource are the characters of generated short codes, leaving out those easily mistaken for
+// one another, such as 0 and O, or 1 and l.
+const shortCodeSource = "23456789abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// shortCodePattern is what codes given to ShortenAs must look like.
+var shortCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ShortLink is a short code leading to a URL.
+type ShortLink struct {
+	Code    string    `json:"code"`
+	URL     string    `json:"url"`
+	Created time.Time `json:"created"`
+	// Expires is when the link stops working. The zero time means never.
+	Expires time.Time `json:"expires"`
+	// Hits is the number of times the link was followed.
+	Hits int64 `json:"hits"`
+}
+
+// expired reports whether the link has expired at now.
+func (l *ShortLink) expired(now time.Time) bool {
+	return !l.Expires.IsZero() && !now.Before(l.Expires)
+}
+
+// ttl returns how long the link has left to live, or zero if it doesn't expire.
+func (l *ShortLink) ttl() time.Duration {
+	if l.Expires.IsZero() {
+		return 0
+	}
+	if ttl := time.Until(l.Expires); ttl > 0 {
+		return ttl
+	}
+	// the link has just expired, and is gone almost at once
+	return time.Millisecond
+}
+
+// ShortLinkStore is the interface implemented by the stores of short links. Implement it to keep links
+// in a database, with a unique index on their code.
+type ShortLinkStore interface {
+	// Create stores link, or returns an error wrapping ErrConflict if its code is taken.
+	Create(ctx context.Context, link ShortLink) error
+	// Get returns the link stored under code, or an error wrapping ErrNotFound if there is none.
+	Get(ctx context.Context, code string) (*ShortLink, error)
+	// Hit adds one to the hits of the link stored under code.
+	Hit(ctx context.Context, code string) error
+	// Delete removes the link stored under code, if any.
+	Delete(ctx context.Context, code string) error
+}
+
+// CacheShortLinkStore is a ShortLinkStore keeping links in a Cache, such as a RedisCache or a FileCache
+// to share them between instances, until they expire. Hits are counted atomically in a CounterCache.
+type CacheShortLinkStore struct {
+	Cache Cache
+	mu    sync.Mutex
+}
+
+// Create stores link, or returns an error wrapping ErrConflict if its code is taken.
+func (s *CacheShortLinkStore) Create(ctx context.Context, link ShortLink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a Locker, such as a RedisCache, keeps other instances from taking the code at the same time
+	if locker, ok := s.Cache.(Locker); ok {
+		unlock, err := locker.TryLock(ctx, "shortlink-lock:"+link.Code, 5*time.Second)
+		if errors.Is(err, ErrLockNotAcquired) {
+			return fmt.Errorf("short code %q: %w", link.Code, ErrConflict)
+		}
+		if err != nil {
+			return err
+		}
+		defer func() { _ = unlock() }()
+	}
+
+	if _, err := s.Cache.Get(ctx, "shortlink:"+link.Code); err == nil {
+		return fmt.Errorf("short code %q: %w", link.Code, ErrConflict)
+	} else if !errors.Is(err, ErrCacheMiss) {
+		return err
+	}
+	return s.set(ctx, &link)
+}
+
+// Get returns the link stored under code, or an error wrapping ErrNotFound if there is none.
+func (s *CacheShortLinkStore) Get(ctx context.Context, code string) (*ShortLink, error) {
+	link, err := s.get(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.Cache.(CounterCache); ok {
+		hits, err := s.Cache.Get(ctx, "shortlink-hits:"+code)
+		if err == nil {
+			link.Hits, _ = strconv.ParseInt(string(hits), 10, 64)
+		} else if !errors.Is(err, ErrCacheMiss) {
+			return nil, err
+		}
+	}
+	return link, nil
+}
+
+// Hit adds one to the hits of the link stored under code.
+func (s *CacheShortLinkStore) Hit(ctx context.Context, code string) error {
+	if counter, ok := s.Cache.(CounterCache); ok {
+		link, err := s.get(ctx, code)
+		if err != nil {
+			return err
+		}
+		_, err = counter.Increment(ctx, "shortlink-hits:"+code, link.ttl())
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, err := s.get(ctx, code)
+	if err != nil {
+		return err
+	}
+	link.Hits++
+	return s.set(ctx, link)
+}
+
+// Delete removes the link stored under code, if any.
+func (s *CacheShortLinkStore) Delete(ctx context.Context, code string) error {
+	if err := s.Cache.Delete(ctx, "shortlink:"+code); err != nil {
+		return err
+	}
+	return s.Cache.Delete(ctx, "shortlink-hits:"+code)
+}
+
+// get returns the link stored under code, without its hits if they are counted apart.
+func (s *CacheShortLinkStore) get(ctx context.Context, code string) (*ShortLink, error) {
+	value, err := s.Cache.Get(ctx, "shortlink:"+code)
+	if errors.Is(err, ErrCacheMiss) {
+		return nil, fmt.Errorf("short code %q: %w", code, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var link ShortLink
+	if err = json.Unmarshal(value, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// set stores link until it expires.
+func (s *CacheShortLinkStore) set(ctx context.Context, link *ShortLink) error {
+	value, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	return s.Cache.Set(ctx, "shortlink:"+link.Code, value, link.ttl())
+}
+
+// ShortenerOptions is the type used to configure NewShortener.
+type ShortenerOptions struct {
+	// Store keeps the links. Defaults to a CacheShortLinkStore using Tools.Cache.
+	Store ShortLinkStore
+	// CodeLength is the length of generated codes. Defaults to 7, which allows about 10^12 codes.
+	CodeLength int
+	// TTL is how long links work. Zero means forever.
+	TTL time.Duration
+	// BaseURL, if set, is the URL the handler of the shortener is served at, such as https://example.com/s,
+	// which Link builds short URLs with.
+	BaseURL string
+}
+
+// Shortener creates short links, and redirects to their URLs when they are followed.
+type Shortener struct {
+	tools   *Tools
+	options ShortenerOptions
+}
+
+// NewShortener returns a Shortener configured by opts.
+func (t *Tools) NewShortener(opts ...ShortenerOptions) *Shortener {
+	var options ShortenerOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.Store == nil {
+		options.Store = &CacheShortLinkStore{Cache: t.cache()}
+	}
+	if options.CodeLength <= 0 {
+		options.CodeLength = 7
+	}
+	options.BaseURL = strings.TrimSuffix(options.BaseURL, "/")
+	return &Shortener{tools: t, options: options}
+}
+
+// Shorten creates a link to target under a random code. Codes which are taken are replaced by new
+// ones, a few times, before an error wrapping ErrConflict is returned.
+func (s *Shortener) Shorten(ctx context.Context, target string) (*ShortLink, error) {
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		var code string
+		if code, err = randomString(s.options.CodeLength, shortCodeSource); err != nil {
+			return nil, err
+		}
+		var link *ShortLink
+		if link, err = s.create(ctx, code, target); err == nil {
+			return link, nil
+		}
+		if !errors.Is(err, ErrConflict) {
+			return nil, err
+		}
+		s.tools.logger().Debug("short code taken, trying another", "code", code)
+	}
+	return nil, err
+}
+
+// ShortenAs creates a link to target under code, chosen by the user, or returns an error wrapping
+// ErrConflict if it is taken.
+func (s *Shortener) ShortenAs(ctx context.Context, code, target string) (*ShortLink, error) {
+	if !shortCodePattern.MatchString(code) {
+		return nil, fmt.Errorf("%w: code %q", ErrInvalidShortLink, code)
+	}
+	return s.create(ctx, code, target)
+}
+
+// Resolve returns the link stored under code, or an error wrapping ErrNotFound if there is none, or
+// it has expired.
+func (s *Shortener) Resolve(ctx context.Context, code string) (*ShortLink, error) {
+	link, err := s.options.Store.Get(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if link.expired(time.Now()) {
+		return nil, fmt.Errorf("short code %q: %w", code, ErrNotFound)
+	}
+	return link, nil
+}
+
+// Delete removes the link stored under code, if any.
+func (s *Shortener) Delete(ctx context.Context, code string) error {
+	return s.options.Store.Delete(ctx, code)
+}
+
+// Link returns the short URL of code, under BaseURL.
+func (s *Shortener) Link(code string) string {
+	return s.options.BaseURL + "/" + url.PathEscape(code)
+}
+
+// ServeHTTP redirects GET and HEAD requests to the URL of the code in the last segment of their path,
+// counting a hit, with a 302 status so that browsers don't cache the redirect and every visit is
+// counted. Unknown and expired codes get a JSON 404 error.
+func (s *Shortener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		_ = s.tools.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	code := path.Base(r.URL.Path)
+	link, err := s.Resolve(r.Context(), code)
+	if err != nil {
+		_ = s.tools.HandleError(w, err)
+		return
+	}
+	if err = s.options.Store.Hit(r.Context(), code); err != nil {
+		s.tools.logger().Warn("short link hit not counted", "code", code, "err", err)
+	}
+	http.Redirect(w, r, link.URL, http.StatusFound)
+}
+
+// create stores a link to target under code.
+func (s *Shortener) create(ctx context.Context, code, target string) (*ShortLink, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: URL %q", ErrInvalidShortLink, target)
+	}
+
+	link := ShortLink{Code: code, URL: u.String(), Created: time.Now().UTC()}
+	if s.options.TTL > 0 {
+		link.Expires = link.Created.Add(s.options.TTL)
+	}
+	if err = s.options.Store.Create(ctx, link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
@@ -0,0 +1,147 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// conflictingStore is a ShortLinkStore which refuses the first codes it is given.
+type conflictingStore struct {
+	ShortLinkStore
+	conflicts int
+}
+
+func (s *conflictingStore) Create(ctx context.Context, link ShortLink) error {
+	if s.conflicts > 0 {
+		s.conflicts--
+		return ErrConflict
+	}
+	return s.ShortLinkStore.Create(ctx, link)
+}
+
+func TestTools_NewShortener(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		cache Cache
+	}{
+		{name: "counter cache", cache: NewMemoryCache(100)},
+		// hiding Increment makes the store count hits in the links themselves
+		{name: "plain cache", cache: struct{ Cache }{NewMemoryCache(100)}},
+	}
+	for _, test := range tests {
+		testTools := Tools{Cache: test.cache}
+		shortener := testTools.NewShortener(ShortenerOptions{BaseURL: "https://sho.rt/s/"})
+
+		link, err := shortener.Shorten(ctx, "https://example.com/a/long/path?q=1")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(link.Code) != 7 || strings.Trim(link.Code, shortCodeSource) != "" {
+			t.Errorf("%s: wrong code %q", test.name, link.Code)
+		}
+		if shortener.Link(link.Code) != "https://sho.rt/s/"+link.Code {
+			t.Errorf("%s: wrong link %s", test.name, shortener.Link(link.Code))
+		}
+
+		for i := 0; i < 2; i++ {
+			rr := httptest.NewRecorder()
+			shortener.ServeHTTP(rr, httptest.NewRequest("GET", "/s/"+link.Code, nil))
+			if rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://example.com/a/long/path?q=1" {
+				t.Errorf("%s: expected a redirect, got %d to %q", test.name, rr.Code, rr.Header().Get("Location"))
+			}
+		}
+		resolved, err := shortener.Resolve(ctx, link.Code)
+		if err != nil || resolved.Hits != 2 {
+			t.Errorf("%s: expected 2 hits, got %+v, %v", test.name, resolved, err)
+		}
+
+		if err = shortener.Delete(ctx, link.Code); err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		shortener.ServeHTTP(rr, httptest.NewRequest("GET", "/s/"+link.Code, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404 for a deleted link, got %d", test.name, rr.Code)
+		}
+	}
+}
+
+func TestShortener_ShortenAs(t *testing.T) {
+	ctx := context.Background()
+	var testTools Tools
+	shortener := testTools.NewShortener()
+
+	if _, err := shortener.ShortenAs(ctx, "launch-2026", "https://example.com/launch"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shortener.ShortenAs(ctx, "launch-2026", "https://example.com/other"); !errors.Is(err, ErrConflict) {
+		t.Error("expected ErrConflict for a taken code, got", err)
+	}
+
+	tests := []struct {
+		name   string
+		code   string
+		target string
+	}{
+		{name: "bad code", code: "a/b", target: "https://example.com/"},
+		{name: "empty code", code: "", target: "https://example.com/"},
+		{name: "relative URL", code: "rel", target: "/login"},
+		{name: "javascript", code: "js", target: "javascript:alert(1)"},
+	}
+	for _, test := range tests {
+		if _, err := shortener.ShortenAs(ctx, test.code, test.target); !errors.Is(err, ErrInvalidShortLink) {
+			t.Errorf("%s: expected ErrInvalidShortLink, got %v", test.name, err)
+		}
+	}
+}
+
+func TestShortener_Expiry(t *testing.T) {
+	ctx := context.Background()
+	var testTools Tools
+	shortener := testTools.NewShortener(ShortenerOptions{TTL: 20 * time.Millisecond})
+
+	link, err := shortener.Shorten(ctx, "https://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !link.Expires.Equal(link.Created.Add(20 * time.Millisecond)) {
+		t.Errorf("wrong expiry %v", link.Expires)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err = shortener.Resolve(ctx, link.Code); !errors.Is(err, ErrNotFound) {
+		t.Error("expected ErrNotFound for an expired link, got", err)
+	}
+}
+
+func TestShortener_Collisions(t *testing.T) {
+	ctx := context.Background()
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+	store := &conflictingStore{ShortLinkStore: &CacheShortLinkStore{Cache: NewMemoryCache(10)}, conflicts: 2}
+	shortener := testTools.NewShortener(ShortenerOptions{Store: store})
+
+	if _, err := shortener.Shorten(ctx, "https://example.com/"); err != nil {
+		t.Fatal("expected taken codes to be replaced, got", err)
+	}
+	if !logger.contains("DEBUG short code taken, trying another") {
+		t.Error("expected the collision to be logged")
+	}
+
+	store.conflicts = 5
+	if _, err := shortener.Shorten(ctx, "https://example.com/"); !errors.Is(err, ErrConflict) {
+		t.Error("expected ErrConflict after 5 collisions, got", err)
+	}
+
+	rr := httptest.NewRecorder()
+	shortener.ServeHTTP(rr, httptest.NewRequest("POST", "/abc", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Singleflight is the type used to run an operation once for concurrent callers asking for the same key,
+// such as the same remote GET or thumbnail, sharing its result between them. The zero value is ready to use.
+type Singleflight struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall is an operation in flight; done is closed once value and err are set.
+type flightCall struct {
+	done    chan struct{}
+	value   any
+	err     error
+	waiters int
+}
+
+// Do runs fn and returns its result, unless a call for key is already in flight, in which case it waits
+// for that call and returns its result instead; shared reports whether the result went to several callers.
+// Callers which wait give up when ctx is done, leaving the call running for the others. If fn panics,
+// the callers waiting for it get an error, and the panic goes on in the caller running it.
+func (g *Singleflight) Do(ctx context.Context, key string, fn func() (any, error)) (value any, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		call.waiters++
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.value, call.err, true
+		case <-ctx.Done():
+			return nil, ctx.Err(), false
+		}
+	}
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		if g.calls[key] == call {
+			delete(g.calls, key)
+		}
+		shared = call.waiters > 0
+		g.mu.Unlock()
+
+		if p := recover(); p != nil {
+			call.err = fmt.Errorf("panic in shared call: %v", p)
+			close(call.done)
+			panic(p)
+		}
+		close(call.done)
+	}()
+
+	call.value, call.err = fn()
+	return call.value, call.err, false
+}
+
+// Forget makes the next call for key run its function, rather than wait for the one in flight.
+func (g *Singleflight) Forget(key string) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+}
+
+// DeduplicateOptions is the type used to configure the Deduplicate middleware.
+type DeduplicateOptions struct {
+	// KeyFunc returns the key identical requests share, or "" for requests which must not be shared.
+	// Defaults to the method and URL of GET and HEAD requests, along with their Authorization and Cookie
+	// headers, so that responses are never shared between users.
+	KeyFunc func(r *http.Request) string
+}
+
+// dedupeKey is the default DeduplicateOptions.KeyFunc.
+func dedupeKey(r *http.Request) string {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return ""
+	}
+	return r.Method + " " + r.URL.String() + "\x00" + r.Header.Get("Authorization") + "\x00" + r.Header.Get("Cookie")
+}
+
+// recordedResponse is a response buffered by the Deduplicate middleware, so that it can be replayed.
+type recordedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	// limit, if set, is the largest body recorded; exceeded is set once a write goes beyond it.
+	limit    int64
+	exceeded bool
+}
+
+func (rec *recordedResponse) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recordedResponse) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *recordedResponse) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if rec.limit > 0 && int64(rec.body.Len()+len(b)) > rec.limit {
+		rec.exceeded = true
+		return 0, errors.New("response too large")
+	}
+	return rec.body.Write(b)
+}
+
+// replay writes the recorded response to w.
+func (rec *recordedResponse) replay(w http.ResponseWriter) {
+	for name, values := range rec.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(rec.body.Bytes())
+}
+
+// Deduplicate returns middleware which handles concurrent identical requests, as found by opts.KeyFunc,
+// once: the first one is handled, and its response, buffered, is sent to all of them. It suits expensive
+// read-only endpoints, which a burst of clients may ask for at the same time. Requests which stop waiting,
+// as their client went away, are answered with nothing.
+func (t *Tools) Deduplicate(opts DeduplicateOptions) func(http.Handler) http.Handler {
+	if opts.KeyFunc == nil {
+		opts.KeyFunc = dedupeKey
+	}
+	var group Singleflight
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := opts.KeyFunc(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			value, err, shared := group.Do(r.Context(), key, func() (any, error) {
+				rec := &recordedResponse{header: make(http.Header)}
+				next.ServeHTTP(rec, r)
+				return rec, nil
+			})
+			if err != nil {
+				return
+			}
+			if shared {
+				t.logger().Debug("request deduplicated", "method", r.Method, "path", r.URL.Path)
+			}
+			value.(*recordedResponse).replay(w)
+		})
+	}
+}
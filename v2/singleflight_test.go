@@ -0,0 +1,150 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleflight_Do(t *testing.T) {
+	var group Singleflight
+	var calls int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([]any, 5)
+	shared := make([]bool, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, shared[i] = group.Do(context.Background(), "thumb", func() (any, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "done", nil
+			})
+		}(i)
+	}
+
+	// let every caller join the call in flight before it finishes
+	for {
+		group.mu.Lock()
+		waiters := 0
+		if call := group.calls["thumb"]; call != nil {
+			waiters = call.waiters
+		}
+		group.mu.Unlock()
+		if waiters == 4 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected the function to run once, it ran %d times", calls)
+	}
+	for i := range results {
+		if results[i] != "done" || !shared[i] {
+			t.Errorf("caller %d: wrong result %v, shared %t", i, results[i], shared[i])
+		}
+	}
+
+	value, err, isShared := group.Do(context.Background(), "thumb", func() (any, error) { return nil, errors.New("failed") })
+	if value != nil || err == nil || isShared {
+		t.Error("expected a new call once the first finished", value, err, isShared)
+	}
+}
+
+func TestSingleflight_Do_Cancel(t *testing.T) {
+	var group Singleflight
+	release := make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{})
+	go group.Do(context.Background(), "slow", func() (any, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err, _ := group.Do(ctx, "slow", func() (any, error) { return nil, nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected the waiting caller to give up, got", err)
+	}
+
+	group.Forget("slow")
+	if value, _, _ := group.Do(context.Background(), "slow", func() (any, error) { return "fresh", nil }); value != "fresh" {
+		t.Error("expected Forget to start a new call, got", value)
+	}
+}
+
+func TestSingleflight_Do_Panic(t *testing.T) {
+	var group Singleflight
+	defer func() {
+		if recover() == nil {
+			t.Error("expected the panic to go on in the caller")
+		}
+		if _, err, _ := group.Do(context.Background(), "boom", func() (any, error) { return 1, nil }); err != nil {
+			t.Error("expected the key to be released after a panic, got", err)
+		}
+	}()
+	_, _, _ = group.Do(context.Background(), "boom", func() (any, error) { panic("boom") })
+}
+
+func TestTools_Deduplicate(t *testing.T) {
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+
+	var calls int32
+	release := make(chan struct{})
+	handler := testTools.Deduplicate(DeduplicateOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Method == http.MethodGet {
+			<-release
+		}
+		w.Header().Set("X-Report", "monthly")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("report"))
+	}))
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, 3)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rr *httptest.ResponseRecorder) {
+			defer wg.Done()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", "/report?month=5", nil))
+		}(recorders[i])
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected the handler to run once, it ran %d times", calls)
+	}
+	for i, rr := range recorders {
+		if rr.Code != http.StatusAccepted || rr.Header().Get("X-Report") != "monthly" || rr.Body.String() != "report" {
+			t.Errorf("response %d: wrong response %d %v %q", i, rr.Code, rr.Header(), rr.Body.String())
+		}
+	}
+	if !logger.contains("DEBUG request deduplicated") {
+		t.Error("expected the deduplicated requests to be logged")
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/report", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/report", nil))
+	if calls != 3 {
+		t.Errorf("expected POST requests not to be deduplicated, the handler ran %d times", calls)
+	}
+}
@@ -0,0 +1,284 @@
+package toolkit
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sitemapChangeFreqs are the values of SitemapURL.ChangeFreq allowed by the sitemap protocol.
+var sitemapChangeFreqs = map[string]bool{
+	"always": true, "hourly": true, "daily": true, "weekly": true, "monthly": true, "yearly": true, "never": true,
+}
+
+// SitemapURL is a page listed in a Sitemap.
+type SitemapURL struct {
+	// Loc is the URL of the page, or its path, such as /posts/hello-world, which is resolved against
+	// Sitemap.BaseURL.
+	Loc string
+	// LastMod, if set, is when the page last changed.
+	LastMod time.Time
+	// ChangeFreq, if set, is how often the page changes: always, hourly, daily, weekly, monthly, yearly or never.
+	ChangeFreq string
+	// Priority, if set, is the priority of the page relative to the other pages of the site, from 0.0 to 1.0.
+	Priority float64
+}
+
+// Sitemap builds the sitemap of a site (sitemaps.org), split into several files listed by a sitemap
+// index once it holds more URLs than a file may. It serves them as a handler, at the root of the site:
+// sitemap.xml, with the URLs or the index, and sitemap-1.xml, sitemap-2.xml and so on, each also
+// gzipped when .gz is added to its name.
+type Sitemap struct {
+	// BaseURL is the URL of the site, such as https://example.com.
+	BaseURL string
+	// MaxURLs is the number of URLs per file. Defaults to 50,000, the largest number allowed.
+	MaxURLs int
+
+	mu   sync.RWMutex
+	urls []SitemapURL
+}
+
+// NewSitemap returns an empty Sitemap for the site at baseURL.
+func NewSitemap(baseURL string) *Sitemap {
+	return &Sitemap{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// AddURL adds the page u to the sitemap. An error is returned for an invalid ChangeFreq or Priority.
+func (s *Sitemap) AddURL(u SitemapURL) error {
+	if u.Loc == "" {
+		return errors.New("sitemap URL without a location")
+	}
+	if u.ChangeFreq != "" && !sitemapChangeFreqs[u.ChangeFreq] {
+		return fmt.Errorf("invalid sitemap change frequency %q", u.ChangeFreq)
+	}
+	if u.Priority < 0 || u.Priority > 1 {
+		return fmt.Errorf("invalid sitemap priority %v", u.Priority)
+	}
+	if strings.HasPrefix(u.Loc, "/") {
+		u.Loc = strings.TrimSuffix(s.BaseURL, "/") + u.Loc
+	}
+
+	s.mu.Lock()
+	s.urls = append(s.urls, u)
+	s.mu.Unlock()
+	return nil
+}
+
+// Files returns the number of files the URLs are split into, 1 if they all fit in sitemap.xml.
+func (s *Sitemap) Files() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.files()
+}
+
+// files returns the number of files of the sitemap, with s.mu held.
+func (s *Sitemap) files() int {
+	if n := (len(s.urls) + s.maxURLs() - 1) / s.maxURLs(); n > 1 {
+		return n
+	}
+	return 1
+}
+
+// maxURLs returns the number of URLs per file.
+func (s *Sitemap) maxURLs() int {
+	if s.MaxURLs > 0 && s.MaxURLs < 50000 {
+		return s.MaxURLs
+	}
+	return 50000
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name        `xml:"urlset"`
+	XMLNS   string          `xml:"xmlns,attr"`
+	URLs    []sitemapURLXML `xml:"url"`
+}
+
+type sitemapURLXML struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name          `xml:"sitemapindex"`
+	XMLNS    string            `xml:"xmlns,attr"`
+	Sitemaps []sitemapIndexURL `xml:"sitemap"`
+}
+
+type sitemapIndexURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// WriteXML writes file n of the sitemap to w: 0 is sitemap.xml, which lists the URLs if they fit in
+// one file, or the other files otherwise, and 1 to Files() are those files.
+func (s *Sitemap) WriteXML(w io.Writer, n int) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files := s.files()
+	if n < 0 || n > files || n > 0 && files == 1 {
+		return fmt.Errorf("sitemap file %d doesn't exist", n)
+	}
+
+	var doc any
+	if n == 0 && files > 1 {
+		index := sitemapIndex{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+		for i := 1; i <= files; i++ {
+			entry := sitemapIndexURL{Loc: s.BaseURL + "/sitemap-" + strconv.Itoa(i) + ".xml.gz"}
+			if lastMod := latestSitemapMod(s.part(i)); !lastMod.IsZero() {
+				entry.LastMod = lastMod.UTC().Format(time.RFC3339)
+			}
+			index.Sitemaps = append(index.Sitemaps, entry)
+		}
+		doc = index
+	} else {
+		set := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+		for _, u := range s.part(n) {
+			entry := sitemapURLXML{Loc: u.Loc, ChangeFreq: u.ChangeFreq}
+			if !u.LastMod.IsZero() {
+				entry.LastMod = u.LastMod.UTC().Format(time.RFC3339)
+			}
+			if u.Priority > 0 {
+				entry.Priority = strconv.FormatFloat(u.Priority, 'f', 1, 64)
+			}
+			set.URLs = append(set.URLs, entry)
+		}
+		doc = set
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(doc)
+}
+
+// part returns the URLs of file n, all of them for 0, with s.mu held.
+func (s *Sitemap) part(n int) []SitemapURL {
+	if n == 0 {
+		return s.urls
+	}
+	start := (n - 1) * s.maxURLs()
+	end := start + s.maxURLs()
+	if end > len(s.urls) {
+		end = len(s.urls)
+	}
+	return s.urls[start:end]
+}
+
+// latestSitemapMod returns the latest LastMod of urls.
+func latestSitemapMod(urls []SitemapURL) time.Time {
+	var latest time.Time
+	for _, u := range urls {
+		if u.LastMod.After(latest) {
+			latest = u.LastMod
+		}
+	}
+	return latest
+}
+
+// ServeHTTP implements http.Handler, serving the files of the sitemap, by the base name of the path.
+func (s *Sitemap) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	gzipped := strings.HasSuffix(name, ".gz")
+	name = strings.TrimSuffix(name, ".gz")
+
+	n := 0
+	if name != "sitemap.xml" {
+		if !strings.HasPrefix(name, "sitemap-") || !strings.HasSuffix(name, ".xml") {
+			http.NotFound(w, r)
+			return
+		}
+		var err error
+		n, err = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "sitemap-"), ".xml"))
+		if files := s.Files(); err != nil || n < 1 || n > files || files == 1 {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	if gzipped {
+		w.Header().Set("Content-Type", "application/gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		_ = s.WriteXML(gz, n)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	_ = s.WriteXML(w, n)
+}
+
+// RobotsGroup is a group of rules of a robots.txt file, for some crawlers.
+type RobotsGroup struct {
+	// UserAgents are the crawlers the rules are for. Defaults to all of them (*).
+	UserAgents []string
+	// Allow and Disallow are the paths crawlers may, and may not, visit, such as /admin/.
+	Allow    []string
+	Disallow []string
+	// CrawlDelay, if set, asks crawlers to wait as long between requests.
+	CrawlDelay time.Duration
+}
+
+// Robots builds a robots.txt file. Without any group, it lets every crawler visit everything.
+type Robots struct {
+	Groups []RobotsGroup
+	// Sitemaps are the URLs of the sitemaps of the site, such as https://example.com/sitemap.xml.
+	Sitemaps []string
+}
+
+// String returns the content of the robots.txt file.
+func (rb Robots) String() string {
+	var b strings.Builder
+	groups := rb.Groups
+	if len(groups) == 0 {
+		groups = []RobotsGroup{{}}
+	}
+
+	for i, group := range groups {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		agents := group.UserAgents
+		if len(agents) == 0 {
+			agents = []string{"*"}
+		}
+		for _, agent := range agents {
+			b.WriteString("User-agent: " + agent + "\n")
+		}
+		for _, p := range group.Allow {
+			b.WriteString("Allow: " + p + "\n")
+		}
+		for _, p := range group.Disallow {
+			b.WriteString("Disallow: " + p + "\n")
+		}
+		if len(group.Allow) == 0 && len(group.Disallow) == 0 {
+			b.WriteString("Disallow:\n")
+		}
+		if group.CrawlDelay > 0 {
+			b.WriteString("Crawl-delay: " + strconv.FormatFloat(group.CrawlDelay.Seconds(), 'f', -1, 64) + "\n")
+		}
+	}
+
+	if len(rb.Sitemaps) > 0 {
+		b.WriteString("\n")
+		for _, sitemap := range rb.Sitemaps {
+			b.WriteString("Sitemap: " + sitemap + "\n")
+		}
+	}
+	return b.String()
+}
+
+// ServeHTTP implements http.Handler, serving the robots.txt file.
+func (rb Robots) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, rb.String())
+}
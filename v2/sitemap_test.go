@@ -0,0 +1,112 @@
+package toolkit
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSitemap(t *testing.T) {
+	sitemap := NewSitemap("https://example.com/")
+	lastMod := time.Date(2024, time.March, 5, 10, 0, 0, 0, time.UTC)
+	if err := sitemap.AddURL(SitemapURL{Loc: "/posts/hello", LastMod: lastMod, ChangeFreq: "weekly", Priority: 0.8}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sitemap.AddURL(SitemapURL{Loc: "https://example.com/about?a=1&b=2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []SitemapURL{{}, {Loc: "/a", ChangeFreq: "sometimes"}, {Loc: "/a", Priority: 1.5}}
+	for _, u := range invalid {
+		if err := sitemap.AddURL(u); err == nil {
+			t.Errorf("expected an error for %+v", u)
+		}
+	}
+
+	var b strings.Builder
+	if err := sitemap.WriteXML(&b, 0); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` +
+		`<url><loc>https://example.com/posts/hello</loc><lastmod>2024-03-05T10:00:00Z</lastmod><changefreq>weekly</changefreq><priority>0.8</priority></url>` +
+		`<url><loc>https://example.com/about?a=1&amp;b=2</loc></url></urlset>`
+	if b.String() != expected {
+		t.Errorf("wrong sitemap\n%s", b.String())
+	}
+	if err := sitemap.WriteXML(io.Discard, 1); err == nil {
+		t.Error("expected an error for a file which doesn't exist")
+	}
+}
+
+func TestSitemap_Index(t *testing.T) {
+	sitemap := NewSitemap("https://example.com")
+	sitemap.MaxURLs = 2
+	for i := 0; i < 5; i++ {
+		_ = sitemap.AddURL(SitemapURL{Loc: fmt.Sprintf("/posts/%d", i), LastMod: time.Date(2024, time.January, i+1, 0, 0, 0, 0, time.UTC)})
+	}
+	if sitemap.Files() != 3 {
+		t.Fatal("expected 3 files, got", sitemap.Files())
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		sitemap.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	rr := get("/sitemap.xml")
+	if !strings.Contains(rr.Body.String(), "<sitemapindex") ||
+		!strings.Contains(rr.Body.String(), "<sitemap><loc>https://example.com/sitemap-3.xml.gz</loc><lastmod>2024-01-05T00:00:00Z</lastmod></sitemap>") {
+		t.Errorf("wrong index\n%s", rr.Body.String())
+	}
+
+	rr = get("/sitemap-2.xml")
+	if rr.Header().Get("Content-Type") != "application/xml; charset=utf-8" || strings.Count(rr.Body.String(), "<url>") != 2 || !strings.Contains(rr.Body.String(), "/posts/3") {
+		t.Errorf("wrong file\n%s", rr.Body.String())
+	}
+
+	rr = get("/sitemap-3.xml.gz")
+	gz, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(gz)
+	if rr.Header().Get("Content-Type") != "application/gzip" || strings.Count(string(body), "<url>") != 1 {
+		t.Errorf("wrong gzipped file\n%s", body)
+	}
+
+	for _, path := range []string{"/sitemap-0.xml", "/sitemap-4.xml", "/sitemap-x.xml", "/other.xml"} {
+		if rr = get(path); rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestRobots(t *testing.T) {
+	if robots := (Robots{}).String(); robots != "User-agent: *\nDisallow:\n" {
+		t.Errorf("wrong default robots.txt %q", robots)
+	}
+
+	robots := Robots{
+		Groups: []RobotsGroup{
+			{Disallow: []string{"/admin/", "/api/"}, Allow: []string{"/api/docs"}},
+			{UserAgents: []string{"BadBot", "WorseBot"}, Disallow: []string{"/"}, CrawlDelay: 1500 * time.Millisecond},
+		},
+		Sitemaps: []string{"https://example.com/sitemap.xml"},
+	}
+	expected := "User-agent: *\nAllow: /api/docs\nDisallow: /admin/\nDisallow: /api/\n\n" +
+		"User-agent: BadBot\nUser-agent: WorseBot\nDisallow: /\nCrawl-delay: 1.5\n\n" +
+		"Sitemap: https://example.com/sitemap.xml\n"
+
+	rr := httptest.NewRecorder()
+	robots.ServeHTTP(rr, httptest.NewRequest("GET", "/robots.txt", nil))
+	if rr.Body.String() != expected || rr.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("wrong robots.txt\n%s", rr.Body.String())
+	}
+}
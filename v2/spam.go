@@ -0,0 +1,184 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormTimestamp returns a token recording when a form was rendered, signed with a key derived from
+// Tools.CookieKey, to put in a hidden field and check with Validator.MinSubmitTime when it comes back.
+func (t *Tools) FormTimestamp() (string, error) {
+	key, err := t.cookieSubkey("form timestamp")
+	if err != nil {
+		return "", err
+	}
+	stamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	return stamp + "." + base64.RawURLEncoding.EncodeToString(signCookie(key, "form", stamp)), nil
+}
+
+// formTimestamp returns when the form whose FormTimestamp token is token was rendered.
+func (t *Tools) formTimestamp(token string) (time.Time, bool) {
+	key, err := t.cookieSubkey("form timestamp")
+	if err != nil {
+		return time.Time{}, false
+	}
+	stamp, signature, found := strings.Cut(token, ".")
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if !found || err != nil || !hmac.Equal(mac, signCookie(key, "form", stamp)) {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+// Honeypot checks that field, a form field hidden from people with CSS, was left empty, as only bots
+// fill it in. Give it a tempting name, such as "website", and autocomplete="off".
+func (v *Validator) Honeypot(field string) {
+	v.Check(v.Data.Get(field) == "", field, "this field must be left empty")
+}
+
+// MinSubmitTime checks that field holds a token from t.FormTimestamp created at least min before, as
+// people take a few seconds to fill in a form, while bots submit it at once. Unlike other rules, it
+// fails when field is empty.
+func (v *Validator) MinSubmitTime(t *Tools, field string, min time.Duration) {
+	rendered, ok := t.formTimestamp(v.Data.Get(field))
+	if !ok {
+		v.Errors.Add(field, "the form is invalid, please reload the page")
+		return
+	}
+	v.Check(time.Since(rendered) >= min, field, "the form was submitted too quickly, please try again")
+}
+
+// CaptchaVerifier is the interface implemented by captcha services, which check the response token
+// a client got by solving a captcha.
+type CaptchaVerifier interface {
+	// VerifyCaptcha reports whether token is a valid response, solved by the client at remoteIP, which may be empty.
+	VerifyCaptcha(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// CaptchaOptions is the type used to configure the verification of captchas with HCaptcha or ReCAPTCHA.
+type CaptchaOptions struct {
+	// MinScore is the lowest reCAPTCHA v3 (or hCaptcha Enterprise) score accepted, from 0 (a bot) to 1.
+	// Zero means scores aren't checked.
+	MinScore float64
+	// Hostname, if set, is the host name the captcha must have been solved on.
+	Hostname string
+	// VerifyURL overrides the verification endpoint of the service, such as to use a compatible one.
+	VerifyURL string
+	// Client is the HTTP client used to reach the service. Defaults to one with a 10 second timeout.
+	Client *http.Client
+}
+
+// remoteCaptcha is a CaptchaVerifier calling the siteverify endpoint of hCaptcha or reCAPTCHA.
+type remoteCaptcha struct {
+	tools   *Tools
+	secret  string
+	options CaptchaOptions
+}
+
+// HCaptcha returns a CaptchaVerifier checking hCaptcha responses, posted as the h-captcha-response
+// field, with secret, the secret key of the site.
+func (t *Tools) HCaptcha(secret string, opts ...CaptchaOptions) CaptchaVerifier {
+	return t.newRemoteCaptcha("https://api.hcaptcha.com/siteverify", secret, opts)
+}
+
+// ReCAPTCHA returns a CaptchaVerifier checking Google reCAPTCHA responses, posted as the
+// g-recaptcha-response field, with secret, the secret key of the site.
+func (t *Tools) ReCAPTCHA(secret string, opts ...CaptchaOptions) CaptchaVerifier {
+	return t.newRemoteCaptcha("https://www.google.com/recaptcha/api/siteverify", secret, opts)
+}
+
+// newRemoteCaptcha returns a remoteCaptcha for the service whose siteverify endpoint is verifyURL.
+func (t *Tools) newRemoteCaptcha(verifyURL, secret string, opts []CaptchaOptions) *remoteCaptcha {
+	var options CaptchaOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.VerifyURL == "" {
+		options.VerifyURL = verifyURL
+	}
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &remoteCaptcha{tools: t, secret: secret, options: options}
+}
+
+// VerifyCaptcha implements CaptchaVerifier. Failed requests are retried according to Tools.RemoteRetry, if set.
+func (c *remoteCaptcha) VerifyCaptcha(ctx context.Context, token, remoteIP string) (bool, error) {
+	form := url.Values{"secret": {c.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		Score      *float64 `json:"score"`
+		Hostname   string   `json:"hostname"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	err := c.tools.retryRemote(ctx, c.options.VerifyURL, func() error {
+		request, err := http.NewRequestWithContext(ctx, "POST", c.options.VerifyURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return Permanent(err)
+		}
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		response, err := c.options.Client.Do(request)
+		c.tools.metrics().recordRemoteCall(response, err)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		if retryableStatus(response.StatusCode) {
+			return errRetryableStatus
+		}
+		if response.StatusCode != http.StatusOK {
+			return Permanent(errors.New("captcha verification failed with status " + strconv.Itoa(response.StatusCode)))
+		}
+		return Permanent(json.NewDecoder(response.Body).Decode(&result))
+	})
+	if err != nil {
+		c.tools.logger().Error("captcha verification failed", "url", c.options.VerifyURL, "err", err)
+		return false, err
+	}
+
+	if !result.Success {
+		c.tools.logger().Debug("captcha rejected", "errors", strings.Join(result.ErrorCodes, ","))
+		return false, nil
+	}
+	if c.options.Hostname != "" && !strings.EqualFold(result.Hostname, c.options.Hostname) {
+		return false, nil
+	}
+	if c.options.MinScore > 0 && (result.Score == nil || *result.Score < c.options.MinScore) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// Captcha checks that field holds a captcha response which verifier accepts; remoteIP, such as found
+// by RealIP, may be empty. Unlike other rules, it fails when field is empty. Responses which can't be
+// verified, as the service can't be reached, are refused.
+func (v *Validator) Captcha(ctx context.Context, verifier CaptchaVerifier, field, remoteIP string) {
+	token := v.Data.Get(field)
+	if token == "" {
+		v.Errors.Add(field, "please complete the captcha")
+		return
+	}
+	ok, err := verifier.VerifyCaptcha(ctx, token, remoteIP)
+	if err != nil {
+		v.Errors.Add(field, "the captcha could not be verified, please try again")
+		return
+	}
+	v.Check(ok, field, "the captcha was not solved correctly, please try again")
+}
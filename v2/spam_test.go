@@ -0,0 +1,111 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestValidator_Honeypot(t *testing.T) {
+	v := NewValidatorFromValues(url.Values{"website": {""}})
+	v.Honeypot("website")
+	if !v.Valid() {
+		t.Error("expected an empty honeypot to pass", v.Errors)
+	}
+
+	v = NewValidatorFromValues(url.Values{"website": {"http://spam.example.com"}})
+	v.Honeypot("website")
+	if v.Errors.Get("website") == "" {
+		t.Error("expected a filled in honeypot to fail")
+	}
+}
+
+func TestValidator_MinSubmitTime(t *testing.T) {
+	testTools := Tools{CookieKey: []byte("0123456789abcdef0123456789abcdef")}
+
+	token, err := testTools.FormTimestamp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewValidatorFromValues(url.Values{"ts": {token}})
+	v.MinSubmitTime(&testTools, "ts", time.Minute)
+	if v.Errors.Get("ts") != "the form was submitted too quickly, please try again" {
+		t.Error("expected a fresh form to be refused, got", v.Errors)
+	}
+
+	v = NewValidatorFromValues(url.Values{"ts": {token}})
+	v.MinSubmitTime(&testTools, "ts", 0)
+	if !v.Valid() {
+		t.Error("expected the form to pass", v.Errors)
+	}
+
+	// a token whose time was moved back, to look older than it is
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).UnixMilli(), 10) + token[len(strconv.FormatInt(time.Now().UnixMilli(), 10)):]
+	for _, forged := range []string{"", "123", old} {
+		v = NewValidatorFromValues(url.Values{"ts": {forged}})
+		v.MinSubmitTime(&testTools, "ts", time.Second)
+		if v.Errors.Get("ts") != "the form is invalid, please reload the page" {
+			t.Errorf("%q: expected the token to be refused, got %v", forged, v.Errors)
+		}
+	}
+
+	var noKey Tools
+	if _, err = noKey.FormTimestamp(); err == nil {
+		t.Error("expected an error without a cookie key")
+	}
+}
+
+func TestValidator_Captcha(t *testing.T) {
+	var received url.Values
+	status := http.StatusOK
+	reply := map[string]any{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		received = r.PostForm
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(reply)
+	}))
+	defer server.Close()
+
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+	verifier := testTools.ReCAPTCHA("s3cret", CaptchaOptions{VerifyURL: server.URL, MinScore: 0.5, Hostname: "example.com"})
+
+	tests := []struct {
+		name    string
+		reply   map[string]any
+		status  int
+		message string
+	}{
+		{name: "valid", reply: map[string]any{"success": true, "score": 0.9, "hostname": "example.com"}, status: http.StatusOK},
+		{name: "low score", reply: map[string]any{"success": true, "score": 0.1, "hostname": "example.com"}, status: http.StatusOK, message: "the captcha was not solved correctly, please try again"},
+		{name: "wrong host", reply: map[string]any{"success": true, "score": 0.9, "hostname": "evil.com"}, status: http.StatusOK, message: "the captcha was not solved correctly, please try again"},
+		{name: "rejected", reply: map[string]any{"success": false, "error-codes": []string{"invalid-input-response"}}, status: http.StatusOK, message: "the captcha was not solved correctly, please try again"},
+		{name: "unavailable", status: http.StatusServiceUnavailable, message: "the captcha could not be verified, please try again"},
+	}
+	for _, test := range tests {
+		reply, status = test.reply, test.status
+		v := NewValidatorFromValues(url.Values{"g-recaptcha-response": {"token"}})
+		v.Captcha(context.Background(), verifier, "g-recaptcha-response", "198.51.100.9")
+		if v.Errors.Get("g-recaptcha-response") != test.message {
+			t.Errorf("%s: expected %q, got %v", test.name, test.message, v.Errors)
+		}
+	}
+	if received.Get("secret") != "s3cret" || received.Get("response") != "token" || received.Get("remoteip") != "198.51.100.9" {
+		t.Error("wrong verification request", received)
+	}
+	if !logger.contains("ERROR captcha verification failed") {
+		t.Error("expected the failed verification to be logged")
+	}
+
+	v := NewValidatorFromValues(url.Values{})
+	v.Captcha(context.Background(), testTools.HCaptcha("s3cret", CaptchaOptions{VerifyURL: server.URL}), "h-captcha-response", "")
+	if v.Errors.Get("h-captcha-response") != "please complete the captcha" {
+		t.Error("expected a missing response to fail, got", v.Errors)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package toolkit
+
+// syncDir does nothing on this platform, where directories can't be synced, so only files are.
+func syncDir(dir string) error {
+	return nil
+}
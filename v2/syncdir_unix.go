@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package toolkit
+
+import "os"
+
+// syncDir flushes the entries of the directory dir to disk, such as a file renamed into it.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -0,0 +1,185 @@
+package toolkit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	toolsContextKey  contextKey = "tools"
+	tenantContextKey contextKey = "tenant"
+)
+
+// ToolsRegistry holds a Tools per tenant of a multi-tenant application, such as one per host or per
+// API key, with its own limits, such as MaxFileSize, AllowedFileTypes, MinFreeDiskSpace or MaxJSONSize,
+// and finds the one of each request.
+type ToolsRegistry struct {
+	// New, if set, creates the Tools of tenants which were not registered, such as from their
+	// settings in a database, usually starting from Tools.Clone. It is called once per tenant, and
+	// again after a failure or Remove, with a context carrying the values of the request which needed
+	// it, but which is not canceled with it, as other requests wait for the same call. Return an error
+	// wrapping ErrNotFound for unknown tenants.
+	New func(ctx context.Context, tenant string) (*Tools, error)
+
+	base    *Tools
+	tenant  func(r *http.Request) string
+	mu      sync.RWMutex
+	tools   map[string]*Tools
+	version uint64
+	flights Singleflight
+}
+
+// NewToolsRegistry returns a ToolsRegistry finding the tenant of requests with tenant, such as
+// TenantByHost, TenantByHeader or TenantByAPIKey. Requests of no tenant, and of tenants which are
+// neither registered nor created by New, are handled with t.
+func (t *Tools) NewToolsRegistry(tenant func(r *http.Request) string) *ToolsRegistry {
+	return &ToolsRegistry{base: t, tenant: tenant, tools: make(map[string]*Tools)}
+}
+
+// Register sets the Tools of tenant, replacing any being created by New.
+func (reg *ToolsRegistry) Register(tenant string, t *Tools) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.tools[tenant] = t
+	reg.version++
+}
+
+// Remove removes the Tools of tenant, such as when its settings change, so that New creates it again.
+// Tools being created by New when it is called are not kept either.
+func (reg *ToolsRegistry) Remove(tenant string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	delete(reg.tools, tenant)
+	reg.version++
+	reg.flights.Forget(tenant)
+}
+
+// Get returns the Tools of tenant: the one registered, or else the one created by New, or else the
+// Tools the registry was created from.
+func (reg *ToolsRegistry) Get(ctx context.Context, tenant string) (*Tools, error) {
+	if tenant == "" {
+		return reg.base, nil
+	}
+	reg.mu.RLock()
+	t, ok := reg.tools[tenant]
+	reg.mu.RUnlock()
+	if ok {
+		return t, nil
+	}
+	if reg.New == nil {
+		return reg.base, nil
+	}
+
+	value, err, _ := reg.flights.Do(ctx, tenant, func() (any, error) {
+		reg.mu.RLock()
+		version := reg.version
+		reg.mu.RUnlock()
+
+		t, err := reg.New(detachedContext{ctx}, tenant)
+		if err != nil {
+			return nil, err
+		}
+		// if tools were registered or removed meanwhile, these may be stale, and are not kept
+		reg.mu.Lock()
+		if reg.version == version {
+			reg.tools[tenant] = t
+		}
+		reg.mu.Unlock()
+		// the tenant may be a secret, such as an API key, so it is not logged
+		reg.base.logger().Debug("tenant tools created")
+		return t, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*Tools), nil
+}
+
+// Middleware stores the tenant of each request, and its Tools, in the request context, where
+// TenantFromContext and ToolsFromContext find them, so that handlers use the limits of the tenant,
+// as in ToolsFromContext(r.Context()).UploadFiles(r, dir). Requests for which New fails get the
+// matching JSON error, such as a 404 for ErrNotFound.
+func (reg *ToolsRegistry) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := reg.tenant(r)
+		t, err := reg.Get(r.Context(), tenant)
+		if err != nil {
+			_ = reg.base.HandleError(w, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), tenantContextKey, tenant)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, toolsContextKey, t)))
+	})
+}
+
+// detachedContext is a context with the values of its parent, but never done, for work shared by
+// several requests which must not end with the first one.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// ToolsFromContext returns the Tools stored in ctx by ToolsRegistry.Middleware, or nil if there is none.
+func ToolsFromContext(ctx context.Context) *Tools {
+	t, _ := ctx.Value(toolsContextKey).(*Tools)
+	return t
+}
+
+// TenantFromContext returns the tenant stored in ctx by ToolsRegistry.Middleware, or an empty string
+// if there is none.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey).(string)
+	return tenant
+}
+
+// TenantByHost finds the tenant of a request from its host, lowercased and without its port, such as
+// acme.example.com. Behind a proxy, use the ProxyHeaders middleware so that the host is the one the
+// client asked for.
+func TenantByHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// TenantByHeader returns a function finding the tenant of a request from the header name, such as
+// X-Tenant-ID.
+func TenantByHeader(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// TenantByAPIKey finds the tenant of a request from the API key stored by the APIKey middleware, which
+// must run first.
+func TenantByAPIKey(r *http.Request) string {
+	return APIKeyFromContext(r.Context())
+}
+
+// Clone returns a new Tools with the settings of t, its exported fields and the errors registered with
+// RegisterError, but none of its other internal state, such as download slots, for a tenant to change
+// some of them. Fields holding references, such as Cache, Logger or Messages, are shared with t.
+func (t *Tools) Clone() *Tools {
+	clone := &Tools{}
+	src, dst := reflect.ValueOf(t).Elem(), reflect.ValueOf(clone).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if src.Type().Field(i).IsExported() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+
+	t.errorMu.RLock()
+	clone.errorMappings = append([]errorMapping(nil), t.errorMappings...)
+	t.errorMu.RUnlock()
+	return clone
+}
@@ -0,0 +1,185 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTools_NewToolsRegistry(t *testing.T) {
+	base := &Tools{MaxFileSize: 1024, MaxJSONSize: 100, AllowedFileTypes: []string{"image"}}
+	registry := base.NewToolsRegistry(TenantByHost)
+
+	acme := base.Clone()
+	acme.MaxFileSize = 10 * 1024 * 1024
+	registry.Register("acme.example.com", acme)
+
+	var mu sync.Mutex
+	created := make(map[string]int)
+	registry.New = func(ctx context.Context, tenant string) (*Tools, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		created[tenant]++
+		if !strings.HasSuffix(tenant, ".example.com") {
+			return nil, fmt.Errorf("tenant %q: %w", tenant, ErrNotFound)
+		}
+		tools := base.Clone()
+		tools.MaxJSONSize = 10
+		return tools, nil
+	}
+
+	var tenant string
+	var tools *Tools
+	handler := registry.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, tools = TenantFromContext(r.Context()), ToolsFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name        string
+		host        string
+		tenant      string
+		maxFileSize int64
+		maxJSONSize int64
+		status      int
+	}{
+		{name: "registered", host: "ACME.example.com:443", tenant: "acme.example.com", maxFileSize: 10 * 1024 * 1024, maxJSONSize: 100, status: http.StatusOK},
+		{name: "created", host: "globex.example.com", tenant: "globex.example.com", maxFileSize: 1024, maxJSONSize: 10, status: http.StatusOK},
+		{name: "created again", host: "globex.example.com", tenant: "globex.example.com", maxFileSize: 1024, maxJSONSize: 10, status: http.StatusOK},
+		{name: "unknown", host: "evil.test", status: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		tenant, tools = "", nil
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Host = test.host
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, request)
+
+		if rr.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", test.name, test.status, rr.Code)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		if tenant != test.tenant || tools == nil || tools.MaxFileSize != test.maxFileSize || tools.MaxJSONSize != test.maxJSONSize {
+			t.Errorf("%s: wrong tools for %q: %+v", test.name, tenant, tools)
+		}
+	}
+	if created["globex.example.com"] != 1 {
+		t.Errorf("expected the tools of a tenant to be created once, got %d", created["globex.example.com"])
+	}
+
+	registry.Remove("globex.example.com")
+	if _, err := registry.Get(context.Background(), "globex.example.com"); err != nil || created["globex.example.com"] != 2 {
+		t.Errorf("expected removed tools to be created again, got %d, %v", created["globex.example.com"], err)
+	}
+	if got, err := registry.Get(context.Background(), ""); got != base || err != nil {
+		t.Error("expected requests without a tenant to get the base tools")
+	}
+}
+
+func TestToolsRegistry_Concurrent(t *testing.T) {
+	base := &Tools{}
+	registry := base.NewToolsRegistry(TenantByHeader("X-Tenant-ID"))
+	var mu sync.Mutex
+	var calls int
+	release := make(chan struct{})
+	registry.New = func(ctx context.Context, tenant string) (*Tools, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		<-release
+		return base.Clone(), nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*Tools, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = registry.Get(context.Background(), "acme")
+		}(i)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls == 0 || calls > len(results) {
+		t.Fatalf("wrong number of calls %d", calls)
+	}
+	// whoever created the tools, every caller ends up with the registered ones
+	registered, _ := registry.Get(context.Background(), "acme")
+	if registered == nil || registered == base {
+		t.Fatal("expected the tools of the tenant to be registered")
+	}
+}
+
+func TestToolsRegistry_RemoveWhileCreating(t *testing.T) {
+	var logs bytes.Buffer
+	base := &Tools{Logger: NewStdLogger(log.New(&logs, "", 0), true)}
+	registry := base.NewToolsRegistry(TenantByAPIKey)
+	started, release := make(chan struct{}), make(chan struct{})
+	var canceled bool
+	registry.New = func(ctx context.Context, tenant string) (*Tools, error) {
+		close(started)
+		<-release
+		canceled = ctx.Err() != nil
+		return base.Clone(), nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan *Tools)
+	go func() {
+		tools, _ := registry.Get(ctx, "sk_live_secret")
+		done <- tools
+	}()
+	<-started
+	cancel()
+	registry.Remove("sk_live_secret")
+	close(release)
+	if tools := <-done; tools == nil {
+		t.Fatal("expected the tools to be created")
+	}
+	if canceled {
+		t.Error("expected New to be called with a context which the request doesn't cancel")
+	}
+
+	registry.mu.RLock()
+	_, kept := registry.tools["sk_live_secret"]
+	registry.mu.RUnlock()
+	if kept {
+		t.Error("expected the tools created before Remove not to be kept")
+	}
+	if !strings.Contains(logs.String(), "tenant tools created") || strings.Contains(logs.String(), "sk_live_secret") {
+		t.Errorf("expected the tenant not to be logged, got %q", logs.String())
+	}
+}
+
+func TestTools_Clone(t *testing.T) {
+	cache := NewMemoryCache(10)
+	original := &Tools{MaxFileSize: 5, AllowedFileTypes: []string{"image"}, Cache: cache, MaxConcurrentDownloads: 1}
+	errQuota := errors.New("quota exceeded")
+	original.RegisterError(errQuota, http.StatusTooManyRequests)
+
+	clone := original.Clone()
+	clone.MaxFileSize = 10
+	if original.MaxFileSize != 5 || clone.AllowedFileTypes[0] != "image" || clone.Cache != cache || clone.MaxConcurrentDownloads != 1 {
+		t.Errorf("wrong clone %+v", clone)
+	}
+	if status, _ := clone.ErrorStatus(errQuota); status != http.StatusTooManyRequests {
+		t.Errorf("expected registered errors to be cloned, got %d", status)
+	}
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Tenant-ID", "acme")
+	if tenant := TenantByHeader("X-Tenant-ID")(request); tenant != "acme" {
+		t.Errorf("wrong tenant %q", tenant)
+	}
+}
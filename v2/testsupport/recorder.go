@@ -0,0 +1,185 @@
+package testsupport
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// RecordEnv is the environment variable which, set to any value, makes recorders created by NewRecorder
+// record the interactions with the real services, and update their golden files, instead of replaying them.
+const RecordEnv = "TESTSUPPORT_RECORD"
+
+// Interaction is a request and its response, as stored in golden files.
+type Interaction struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody string      `json:"request_body,omitempty"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        string      `json:"body,omitempty"`
+	// Base64 is set when the bodies aren't text, and are stored encoded in base64.
+	Base64 bool `json:"base64,omitempty"`
+}
+
+// Recorder is an http.RoundTripper which records requests to remote services, and their responses, in a
+// golden file, then replays them, so that tests don't depend on the services being reachable. Requests are
+// matched by method, URL and body, each recorded interaction being replayed once, in order. The headers of
+// requests, which may hold credentials, aren't recorded.
+type Recorder struct {
+	// Recording is true when the recorder forwards requests to Transport and records them.
+	Recording bool
+	// Transport sends the requests which are recorded. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+
+	path         string
+	mu           sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+}
+
+// NewRecorder returns a Recorder replaying the interactions of the golden file at path, such as
+// testdata/payments.json, failing t if it can't be read. When the environment variable named by RecordEnv
+// is set, it records them instead, and writes the golden file once the test is done.
+func NewRecorder(t testing.TB, path string) *Recorder {
+	t.Helper()
+
+	r := &Recorder{path: path, Recording: os.Getenv(RecordEnv) != ""}
+	if r.Recording {
+		t.Cleanup(func() {
+			if err := r.Save(); err != nil {
+				t.Error(err)
+			}
+		})
+		return r
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden file missing, run the test with %s=1 to record it: %v", RecordEnv, err)
+	}
+	if err = json.Unmarshal(content, &r.interactions); err != nil {
+		t.Fatalf("invalid golden file %s: %v", path, err)
+	}
+	r.replayed = make([]bool, len(r.interactions))
+	return r
+}
+
+// Client returns an http.Client sending its requests through r.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if req.Body != nil {
+		var err error
+		if requestBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	if r.Recording {
+		return r.record(req, requestBody)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.interactions {
+		if r.replayed[i] || interaction.Method != req.Method || interaction.URL != req.URL.String() {
+			continue
+		}
+		if body, err := interaction.decode(interaction.RequestBody); err != nil || !bytes.Equal(body, requestBody) {
+			continue
+		}
+
+		body, err := interaction.decode(interaction.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.replayed[i] = true
+		return &http.Response{
+			StatusCode:    interaction.Status,
+			Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("testsupport: no recorded response for %s %s", req.Method, req.URL)
+}
+
+// record sends req, whose body was read into requestBody, and records its response.
+func (r *Recorder) record(req *http.Request, requestBody []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	// a RoundTripper must not modify the request it is given
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(requestBody))
+	response, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := Interaction{Method: req.Method, URL: req.URL.String(), Status: response.StatusCode, Header: response.Header.Clone()}
+	interaction.Header.Del("Date")
+	if utf8.Valid(requestBody) && utf8.Valid(body) {
+		interaction.RequestBody, interaction.Body = string(requestBody), string(body)
+	} else {
+		interaction.Base64 = true
+		interaction.RequestBody = base64.StdEncoding.EncodeToString(requestBody)
+		interaction.Body = base64.StdEncoding.EncodeToString(body)
+	}
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.mu.Unlock()
+	return response, nil
+}
+
+// decode returns a body of the interaction.
+func (i Interaction) decode(body string) ([]byte, error) {
+	if i.Base64 {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
+
+// Save writes the recorded interactions to the golden file. It is called by NewRecorder once the test
+// is done when recording.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	content, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(content, '\n'), 0644)
+}
@@ -0,0 +1,71 @@
+package testsupport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		if r.URL.Path == "/binary" {
+			_, _ = w.Write([]byte{0xff, 0x00})
+			return
+		}
+		_, _ = w.Write([]byte(r.Method + " " + string(body)))
+	}))
+	path := filepath.Join(t.TempDir(), "golden.json")
+
+	// record, the golden file being written once the subtest is done
+	t.Run("record", func(t *testing.T) {
+		t.Setenv(RecordEnv, "1")
+		client := NewRecorder(t, path).Client()
+		for _, body := range []string{"first", "second"} {
+			response, err := client.Post(server.URL+"/echo", "text/plain", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+		}
+		response, err := client.Get(server.URL + "/binary")
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	})
+	server.Close()
+
+	// replay, without the server
+	client := NewRecorder(t, path).Client()
+	for _, body := range []string{"second", "first"} {
+		response, err := client.Post(server.URL+"/echo", "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK || string(content) != "POST "+body || response.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("wrong replayed response %d %q", response.StatusCode, content)
+		}
+	}
+
+	response, err := client.Get(server.URL + "/binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(content) != "\xff\x00" {
+		t.Errorf("wrong binary body %q", content)
+	}
+
+	// every interaction is replayed once
+	if _, err = client.Post(server.URL+"/echo", "text/plain", strings.NewReader("first")); err == nil {
+		t.Error("expected an error for a request which wasn't recorded")
+	}
+}
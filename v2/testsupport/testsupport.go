@@ -0,0 +1,163 @@
+// Package testsupport holds helpers for testing HTTP code built with the toolkit: stubbing or recording
+// the responses of remote services, building multipart upload requests, and checking JSON responses.
+// It only depends on the standard library, so that any package, the toolkit included, can use it in
+// its tests.
+package testsupport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// RoundTripFunc is an http.RoundTripper returning the response of a function, to stub remote services.
+type RoundTripFunc func(r *http.Request) *http.Response
+
+// RoundTrip implements http.RoundTripper.
+func (f RoundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r), nil
+}
+
+// NewClient returns an http.Client whose requests are answered by f.
+func NewClient(f RoundTripFunc) *http.Client {
+	return &http.Client{Transport: f}
+}
+
+// NewResponse returns a response with the given status code and body, for a RoundTripFunc. A body
+// which isn't a string or a []byte is encoded as JSON.
+func NewResponse(status int, body any) *http.Response {
+	var content []byte
+	header := make(http.Header)
+	switch body := body.(type) {
+	case nil:
+	case string:
+		content = []byte(body)
+	case []byte:
+		content = body
+	default:
+		content, _ = json.Marshal(body)
+		header.Set("Content-Type", "application/json")
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(content)),
+		ContentLength: int64(len(content)),
+	}
+}
+
+// File is a file of a multipart request built by NewUploadRequest.
+type File struct {
+	// Field is the name of the form field.
+	Field string
+	// Name is the name of the file. Defaults to the base name of Path.
+	Name string
+	// ContentType defaults to application/octet-stream.
+	ContentType string
+	// Content is the content of the file, unless Path is set, in which case the file is read from disk.
+	Content []byte
+	Path    string
+}
+
+// quoteEscaper escapes the quoted strings of Content-Disposition headers.
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// NewUploadRequest returns a POST request to target with a multipart/form-data body holding fields and
+// files, as sent by a browser, failing t if a file can't be read.
+func NewUploadRequest(t testing.TB, target string, fields map[string]string, files ...File) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range files {
+		content := file.Content
+		if file.Path != "" {
+			var err error
+			if content, err = os.ReadFile(file.Path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		name := file.Name
+		if name == "" {
+			name = filepath.Base(file.Path)
+		}
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(file.Field), quoteEscaper.Replace(name)))
+		header.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = part.Write(content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, target, &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	return request
+}
+
+// DecodeJSON decodes the body of response into target, failing t if it isn't valid JSON.
+func DecodeJSON(t testing.TB, response *httptest.ResponseRecorder, target any) {
+	t.Helper()
+	if err := json.Unmarshal(response.Body.Bytes(), target); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", response.Body.String(), err)
+	}
+}
+
+// AssertJSON checks that response has the given status code and a JSON body equal to expected, which is
+// either a JSON document, as a string or a []byte, or a value encoded to JSON. Documents are compared by
+// value, so that the order of keys and spacing don't matter.
+func AssertJSON(t testing.TB, response *httptest.ResponseRecorder, status int, expected any) {
+	t.Helper()
+	if response.Code != status {
+		t.Errorf("expected status %d, got %d: %s", status, response.Code, response.Body.String())
+	}
+
+	var want []byte
+	switch expected := expected.(type) {
+	case string:
+		want = []byte(expected)
+	case []byte:
+		want = expected
+	default:
+		var err error
+		if want, err = json.Marshal(expected); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !JSONEqual(response.Body.Bytes(), want) {
+		t.Errorf("expected JSON %s, got %s", want, response.Body.String())
+	}
+}
+
+// JSONEqual reports whether a and b are valid JSON documents holding the same value.
+func JSONEqual(a, b []byte) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
@@ -0,0 +1,81 @@
+package testsupport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewClient(t *testing.T) {
+	client := NewClient(func(r *http.Request) *http.Response {
+		return NewResponse(http.StatusCreated, map[string]string{"path": r.URL.Path})
+	})
+
+	response, err := client.Get("https://api.example.com/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusCreated || string(body) != `{"path":"/users"}` || response.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("wrong response %d %s", response.StatusCode, body)
+	}
+}
+
+func TestNewUploadRequest(t *testing.T) {
+	request := NewUploadRequest(t, "/upload", map[string]string{"title": "Report"},
+		File{Field: "file", Name: `a "quoted".txt`, ContentType: "text/plain", Content: []byte("hello")},
+		File{Field: "file", Path: "testsupport.go"},
+	)
+
+	if err := request.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if request.FormValue("title") != "Report" {
+		t.Errorf("wrong field %q", request.FormValue("title"))
+	}
+	files := request.MultipartForm.File["file"]
+	if len(files) != 2 || files[0].Filename != `a "quoted".txt` || files[0].Size != 5 || files[1].Filename != "testsupport.go" {
+		t.Fatalf("wrong files %+v", files)
+	}
+	if files[0].Header.Get("Content-Type") != "text/plain" || files[1].Header.Get("Content-Type") != "application/octet-stream" {
+		t.Error("wrong content types")
+	}
+}
+
+func TestAssertJSON(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.WriteHeader(http.StatusOK)
+	_, _ = rr.WriteString(`{"b": [1, 2], "a": "x"}`)
+
+	AssertJSON(t, rr, http.StatusOK, `{"a":"x","b":[1,2]}`)
+	AssertJSON(t, rr, http.StatusOK, map[string]any{"a": "x", "b": []int{1, 2}})
+
+	var payload struct{ A string }
+	DecodeJSON(t, rr, &payload)
+	if payload.A != "x" {
+		t.Errorf("wrong payload %+v", payload)
+	}
+
+	// a failing assertion is reported to the test
+	failing := &failingTB{TB: t}
+	AssertJSON(failing, rr, http.StatusCreated, `{"a":"y"}`)
+	if failing.errors != 2 {
+		t.Errorf("expected the status and the body to be reported, got %d errors", failing.errors)
+	}
+
+	if JSONEqual([]byte(`{"a":1}`), []byte(`not json`)) {
+		t.Error("expected invalid JSON not to be equal")
+	}
+}
+
+// failingTB is a testing.TB counting the errors reported to it, instead of failing the test.
+type failingTB struct {
+	testing.TB
+	errors int
+}
+
+func (f *failingTB) Helper() {}
+
+func (f *failingTB) Errorf(format string, args ...any) { f.errors++ }
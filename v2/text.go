@@ -0,0 +1,112 @@
+package toolkit
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ellipsis is appended to the text shortened by TruncateRunes, TruncateWords and Excerpt.
+const Ellipsis = "…"
+
+// htmlBlockTags are the tags StripTags replaces with a space, so that the words on either side of them
+// aren't joined.
+var htmlBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true, "div": true,
+	"dl": true, "dt": true, "figcaption": true, "figure": true, "footer": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true, "main": true,
+	"nav": true, "ol": true, "p": true, "pre": true, "section": true, "table": true, "td": true, "th": true,
+	"tr": true, "ul": true,
+}
+
+// TruncateRunes shortens s to at most n runes, the ellipsis included, if it is longer than that.
+func TruncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	return trimBeforeEllipsis(string([]rune(s)[:n-1])) + Ellipsis
+}
+
+// TruncateWords shortens s to its first n words, followed by an ellipsis, if it has more than that.
+// The spacing between the words kept is left as it is.
+func TruncateWords(s string, n int) string {
+	words := 0
+	inWord := false
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			inWord = false
+			continue
+		}
+		if !inWord {
+			if words == n {
+				return trimBeforeEllipsis(s[:i]) + Ellipsis
+			}
+			words++
+			inWord = true
+		}
+	}
+	return s
+}
+
+// NormalizeWhitespace replaces each run of whitespace in s, including newlines and tabs, with a single
+// space, and trims it.
+func NormalizeWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// StripTags returns the text of the HTML document or fragment s, without its tags and comments, and with
+// its entities decoded. Scripts and styles are removed along with their content, and block tags such as
+// p and br are replaced with a space.
+func StripTags(s string) string {
+	var out strings.Builder
+	separate := false
+
+	tokenizeHTML(s, func(text string) {
+		if separate && out.Len() > 0 {
+			out.WriteByte(' ')
+		}
+		separate = false
+		out.WriteString(text)
+	}, func(tag htmlTag, end bool) {
+		if htmlBlockTags[tag.name] {
+			separate = true
+		}
+	})
+	return out.String()
+}
+
+// Excerpt returns the text of the HTML s, with its whitespace normalized, shortened to at most n runes
+// at a word boundary, the ellipsis included. It suits previews of rich text, such as in listings and
+// the descriptions of pages.
+func Excerpt(s string, n int) string {
+	text := NormalizeWhitespace(StripTags(s))
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	if n <= 0 {
+		return ""
+	}
+
+	cut := runes[:n-1]
+	if !unicode.IsSpace(runes[n-1]) {
+		// don't end within a word, unless it is the only one
+		for i := len(cut) - 1; i > 0; i-- {
+			if unicode.IsSpace(cut[i]) {
+				cut = cut[:i]
+				break
+			}
+		}
+	}
+	return trimBeforeEllipsis(string(cut)) + Ellipsis
+}
+
+// trimBeforeEllipsis trims the spaces and punctuation an ellipsis shouldn't follow from the end of s.
+func trimBeforeEllipsis(s string) string {
+	return strings.TrimRightFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(",;:-.", r)
+	})
+}
@@ -0,0 +1,75 @@
+package toolkit
+
+import "testing"
+
+var truncateTests = []struct {
+	name  string
+	s     string
+	n     int
+	runes string
+	words string
+}{
+	{name: "short", s: "hello world", n: 20, runes: "hello world", words: "hello world"},
+	{name: "exact", s: "hello", n: 5, runes: "hello", words: "hello"},
+	{name: "long", s: "hello, wide world", n: 7, runes: "hello…", words: "hello, wide world"},
+	{name: "unicode", s: "héllo wörld ünïcode", n: 2, runes: "h…", words: "héllo wörld…"},
+	{name: "spacing kept", s: "one  two\tthree four", n: 3, runes: "on…", words: "one  two\tthree…"},
+	{name: "zero", s: "hello", n: 0, runes: "", words: "…"},
+}
+
+func TestTruncate(t *testing.T) {
+	for _, e := range truncateTests {
+		if out := TruncateRunes(e.s, e.n); out != e.runes {
+			t.Errorf("%s: TruncateRunes: expected %q, got %q", e.name, e.runes, out)
+		}
+		if out := TruncateWords(e.s, e.n); out != e.words {
+			t.Errorf("%s: TruncateWords: expected %q, got %q", e.name, e.words, out)
+		}
+	}
+}
+
+func TestNormalizeWhitespace(t *testing.T) {
+	if out := NormalizeWhitespace("  one\t two\n\nthree  "); out != "one two three" {
+		t.Errorf("wrong result %q", out)
+	}
+}
+
+var stripTagsTests = []struct {
+	name     string
+	input    string
+	expected string
+}{
+	{name: "inline tags", input: "<p>Hello <b>bold</b> world</p>", expected: "Hello bold world"},
+	{name: "block tags", input: "<p>one</p><p>two</p>three<br>four", expected: "one two three four"},
+	{name: "entities", input: "caf&eacute; &amp; &lt;tea&gt;", expected: "café & <tea>"},
+	{name: "script", input: "a<script>alert('<p>')</script>b<!-- c -->", expected: "ab"},
+	{name: "lone angle bracket", input: "a < b", expected: "a < b"},
+}
+
+func TestStripTags(t *testing.T) {
+	for _, e := range stripTagsTests {
+		if out := StripTags(e.input); out != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, out)
+		}
+	}
+}
+
+var excerptTests = []struct {
+	name     string
+	input    string
+	n        int
+	expected string
+}{
+	{name: "short", input: "<p>Hello <b>world</b></p>", n: 20, expected: "Hello world"},
+	{name: "word boundary", input: "<h1>Title</h1><p>The quick brown fox jumps</p>", n: 20, expected: "Title The quick…"},
+	{name: "punctuation", input: "<p>First, second and third</p>", n: 10, expected: "First…"},
+	{name: "single long word", input: "Supercalifragilistic", n: 6, expected: "Super…"},
+}
+
+func TestExcerpt(t *testing.T) {
+	for _, e := range excerptTests {
+		if out := Excerpt(e.input, e.n); out != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, out)
+		}
+	}
+}
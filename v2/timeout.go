@@ -0,0 +1,91 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// timeoutWriter buffers the response of a handler run by the Timeout middleware, until it either
+// finishes or runs out of time; writes once ctx is done fail with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	ctx      context.Context
+	mu       sync.Mutex
+	rec      recordedResponse
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.rec.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.timedOut {
+		tw.rec.WriteHeader(status)
+	}
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.ctx.Err() != nil {
+		return 0, http.ErrHandlerTimeout
+	}
+	return tw.rec.Write(b)
+}
+
+// Timeout returns middleware which gives the next handler d to respond. Its request context is canceled
+// once d has passed, and the client receives a 504 JSON error, rather than the plain text of
+// http.TimeoutHandler. The response is buffered until the handler returns, so it shouldn't be used for
+// streaming responses. A panic in the handler goes on in the goroutine serving the request, along with
+// its stack trace, so that the Recover middleware handles it.
+func (t *Tools) Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{ctx: ctx, rec: recordedResponse{header: make(http.Header)}}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						if p != http.ErrAbortHandler {
+							p = fmt.Sprintf("%v\n%s", p, debug.Stack())
+						}
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.rec.replay(w)
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					t.logger().Warn("request timed out", "method", r.Method, "path", r.URL.Path,
+						"request_id", RequestIDFromContext(ctx), "timeout", d.String())
+					_ = t.ErrorJSON(w, errors.New("the request took too long to complete"), http.StatusGatewayTimeout)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_Timeout(t *testing.T) {
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+
+	canceled := make(chan bool, 1)
+	handler := testTools.Timeout(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fast" {
+			w.Header().Set("X-Fast", "yes")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("created"))
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			canceled <- true
+		case <-time.After(time.Second):
+			canceled <- false
+		}
+		if _, err := w.Write([]byte("late")); err != http.ErrHandlerTimeout {
+			t.Error("expected writes after the timeout to fail, got", err)
+		}
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/fast", nil))
+	if rr.Code != http.StatusCreated || rr.Header().Get("X-Fast") != "yes" || rr.Body.String() != "created" {
+		t.Error("wrong response", rr.Code, rr.Header(), rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/slow", nil))
+	var payload JSONResponse
+	if rr.Code != http.StatusGatewayTimeout || json.Unmarshal(rr.Body.Bytes(), &payload) != nil || !payload.Error {
+		t.Error("expected a 504 JSON error, got", rr.Code, rr.Body.String())
+	}
+	if !<-canceled {
+		t.Error("expected the handler's context to be canceled")
+	}
+	if !logger.contains("WARN request timed out") {
+		t.Error("expected the timeout to be logged")
+	}
+}
+
+func TestTools_Timeout_Panic(t *testing.T) {
+	var testTools Tools
+	handler := testTools.Recover(testTools.Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler failed")
+	})))
+
+	logger := &recordingLogger{}
+	testTools.Logger = logger
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Error("expected the panic to reach Recover, got", rr.Code)
+	}
+	if !logger.contains("ERROR panic serving request") || strings.Contains(rr.Body.String(), "handler failed") {
+		t.Error("expected the panic to be logged and not sent", rr.Body.String())
+	}
+}
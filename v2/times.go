@@ -0,0 +1,132 @@
+package toolkit
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidTime is returned by ParseTimeFlexible for values in none of the formats it knows.
+var ErrInvalidTime = errors.New("unrecognized time format")
+
+// zonedLayouts are the layouts ParseTimeFlexible tries first, which carry their time zone.
+var zonedLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.RFC822Z,
+	time.RFC822,
+}
+
+// localLayouts are the layouts ParseTimeFlexible tries next, whose time zone is the one given to it.
+var localLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	"20060102",
+	"2 Jan 2006",
+	"2 January 2006",
+	"02-Jan-2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"Jan 2 2006",
+	"January 2 2006",
+}
+
+// ParseTimeFlexible parses s in any of the formats clients commonly send: RFC 3339 and other ISO 8601
+// timestamps, the formats of HTTP and email headers, plain dates such as "2006-01-02" or "Jan 2, 2006",
+// and Unix timestamps in seconds or milliseconds. Times which don't carry a time zone are taken in loc,
+// or in UTC if none is given. Formats where the day and month could be swapped, such as 01/02/2006,
+// are refused rather than guessed.
+func ParseTimeFlexible(s string, loc ...*time.Location) (time.Time, error) {
+	location := time.UTC
+	if len(loc) > 0 && loc[0] != nil {
+		location = loc[0]
+	}
+
+	s = strings.TrimSpace(s)
+	for _, layout := range zonedLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, s, location); err == nil {
+			return t, nil
+		}
+	}
+
+	// Unix timestamps, in seconds or milliseconds; shorter numbers are more likely to be mistakes
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch len(strings.TrimPrefix(s, "-")) {
+		case 9, 10:
+			return time.Unix(n, 0).In(location), nil
+		case 12, 13:
+			return time.UnixMilli(n).In(location), nil
+		}
+	}
+
+	return time.Time{}, ErrInvalidTime
+}
+
+// isDateOnly reports whether s, as accepted by ParseTimeFlexible, is a date without a time of day.
+func isDateOnly(s string) bool {
+	s = strings.TrimSpace(s)
+	for _, layout := range localLayouts {
+		if strings.Contains(layout, "15") {
+			continue
+		}
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// StartOfDay returns midnight at the start of the day of t, in the location of t.
+func StartOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// EndOfDay returns the last nanosecond of the day of t, in the location of t, so that a filter on
+// t <= EndOfDay(to) includes the whole of the day to. Days which are longer or shorter because of
+// daylight saving time are handled.
+func EndOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond)
+}
+
+// locations caches the locations loaded by InTimezone, which time.LoadLocation reads from disk.
+var locations sync.Map
+
+// InTimezone returns t in the IANA time zone tz, such as "Europe/Paris", or an error if tz is unknown.
+func InTimezone(t time.Time, tz string) (time.Time, error) {
+	if loc, ok := locations.Load(tz); ok {
+		return t.In(loc.(*time.Location)), nil
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.Time{}, err
+	}
+	locations.Store(tz, loc)
+	return t.In(loc), nil
+}
+
+// IsTime checks that field holds a time or date, in any of the formats ParseTimeFlexible accepts.
+func (v *Validator) IsTime(field string) {
+	v.Custom(field, func(value string) bool {
+		_, err := ParseTimeFlexible(value)
+		return err == nil
+	}, "this field must be a date or time")
+}
@@ -0,0 +1,76 @@
+package toolkit
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+var parseTimeFlexibleTests = []struct {
+	input    string
+	expected time.Time
+}{
+	{"2022-10-02T15:04:05Z", time.Date(2022, 10, 2, 15, 4, 5, 0, time.UTC)},
+	{"2022-10-02T15:04:05.123+02:00", time.Date(2022, 10, 2, 13, 4, 5, 123000000, time.UTC)},
+	{"2022-10-02T15:04:05+0200", time.Date(2022, 10, 2, 13, 4, 5, 0, time.UTC)},
+	{"2022-10-02 15:04:05", time.Date(2022, 10, 2, 15, 4, 5, 0, time.UTC)},
+	{"2022-10-02T15:04", time.Date(2022, 10, 2, 15, 4, 0, 0, time.UTC)},
+	{" 2022-10-02 ", time.Date(2022, 10, 2, 0, 0, 0, 0, time.UTC)},
+	{"2022/10/02", time.Date(2022, 10, 2, 0, 0, 0, 0, time.UTC)},
+	{"20221002", time.Date(2022, 10, 2, 0, 0, 0, 0, time.UTC)},
+	{"2 Oct 2022", time.Date(2022, 10, 2, 0, 0, 0, 0, time.UTC)},
+	{"October 2, 2022", time.Date(2022, 10, 2, 0, 0, 0, 0, time.UTC)},
+	{"Sun, 02 Oct 2022 15:04:05 GMT", time.Date(2022, 10, 2, 15, 4, 5, 0, time.UTC)},
+	{"1664723045", time.Date(2022, 10, 2, 15, 4, 5, 0, time.UTC)},
+	{"1664723045123", time.Date(2022, 10, 2, 15, 4, 5, 123000000, time.UTC)},
+}
+
+func TestParseTimeFlexible(t *testing.T) {
+	for _, e := range parseTimeFlexibleTests {
+		tm, err := ParseTimeFlexible(e.input)
+		if err != nil || !tm.Equal(e.expected) {
+			t.Errorf("%q: expected %s, got %s (%v)", e.input, e.expected, tm, err)
+		}
+	}
+
+	for _, input := range []string{"", "yesterday", "01/02/2022", "2022-13-01", "12345"} {
+		if _, err := ParseTimeFlexible(input); !errors.Is(err, ErrInvalidTime) {
+			t.Errorf("%q: expected ErrInvalidTime, got %v", input, err)
+		}
+	}
+}
+
+func TestTimezones(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database", err)
+	}
+
+	tm, err := ParseTimeFlexible("2022-03-13", ny)
+	if err != nil || !tm.Equal(time.Date(2022, 3, 13, 5, 0, 0, 0, time.UTC)) {
+		t.Fatal("expected a date in New York", tm, err)
+	}
+
+	// the 13th of March 2022 is 23 hours long in New York
+	if start, end := StartOfDay(tm.Add(15*time.Hour)), EndOfDay(tm); !start.Equal(tm) || end.Sub(start) != 23*time.Hour-time.Nanosecond {
+		t.Error("wrong day bounds", start, end)
+	}
+
+	paris, err := InTimezone(tm, "Europe/Paris")
+	if err != nil || paris.Hour() != 6 || paris.Location().String() != "Europe/Paris" {
+		t.Error("wrong time in Paris", paris, err)
+	}
+	if _, err = InTimezone(tm, "Nowhere/Land"); err == nil {
+		t.Error("expected an error for an unknown time zone")
+	}
+}
+
+func TestValidator_IsTime(t *testing.T) {
+	v := NewValidatorFromValues(url.Values{"ok": {"2022-10-02"}, "bad": {"soon"}})
+	v.IsTime("ok")
+	v.IsTime("bad")
+	if len(v.Errors) != 1 || v.Errors.Get("bad") == "" {
+		t.Error("wrong errors", v.Errors)
+	}
+}
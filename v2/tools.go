@@ -1,50 +1,250 @@
 package toolkit
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
 	"io"
+	"io/fs"
+	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/alftirta/toolkit/v2/images"
 )
 
 const randomStringSource string = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_+"
 
+// ErrEmptyFile is returned by UploadFiles for empty files when Tools.RejectEmptyFiles is set.
+var ErrEmptyFile = errors.New("the uploaded file is empty")
+
+// contextKey is the type used for the keys of values the toolkit stores in a request context.
+type contextKey string
+
 // Tools is the type used to instantiate this module.
 // Any variable of this type will have access too all the methods with the receiver *Tools.
 type Tools struct {
-	MaxFileSize        int64
+	MaxFileSize int64
+	// RejectEmptyFiles makes UploadFiles refuse empty files with ErrEmptyFile.
+	RejectEmptyFiles bool
+	// AllowedFileTypes, if set, lists the content types UploadFiles accepts, as found by DetectFileType.
+	// Entries may be wildcards, such as video/*, or the aliases image, video, audio, font, text, document
+	// and archive.
 	AllowedFileTypes   []string
 	MaxJSONSize        int64
 	AllowUnknownFields bool
+
+	// MaxDownloadRate limits, in bytes per second, how fast a single download is sent. Zero means unlimited.
+	MaxDownloadRate int64
+	// MaxConcurrentDownloads limits how many downloads are served at once; further downloads wait for a free slot.
+	// Zero means unlimited.
+	MaxConcurrentDownloads int
+
+	// MinFreeDiskSpace, if set, is the number of bytes which must remain free on the upload volume
+	// after writing an uploaded file; otherwise UploadFiles fails with ErrInsufficientStorage.
+	MinFreeDiskSpace int64
+	// UploadBufferSize is the size, in bytes, of the buffers UploadFiles copies files with, which are
+	// pooled across uploads. Defaults to 32kB.
+	UploadBufferSize int
+	// SyncWrites makes UploadFiles flush uploaded files, and the directory they are written to, to disk
+	// before returning, so that they survive a power failure, at the cost of slower uploads. Files are
+	// always written under a temporary name first, and renamed once complete, so that a crash can't
+	// leave a truncated file behind under the name of an upload.
+	SyncWrites bool
+
+	// DirPerm is the permissions of the directories created by CreateDirIfNotExist, and so by UploadFiles
+	// and the archive extraction methods. Defaults to 0755, less the umask; when set, it is applied as is.
+	DirPerm fs.FileMode
+	// FilePerm is the permissions of the files written by UploadFiles and the archive extraction methods.
+	// Defaults to 0666 for uploads and 0644 for extracted files, less the umask; when set, it is applied
+	// as is.
+	FilePerm fs.FileMode
+	// FileOwner, if set, is the user and group given to those files and directories, on Linux, macOS and
+	// FreeBSD, which usually requires running as root.
+	FileOwner *FileOwner
+
+	// ImageProcessing, if set, is applied to the PNG, JPEG and GIF images uploaded with UploadFiles,
+	// such as to resize photos or convert them to another format, before they are saved. WebP is
+	// encoded losslessly, unless another encoder is registered with images.RegisterEncoder.
+	ImageProcessing *images.Options
+	// MaxImagePixels, if set, is the largest width times height of uploaded images. Larger images are refused
+	// with images.ErrTooManyPixels, by reading their header only, before anything decodes them.
+	// It also applies to ImageProcessing, which otherwise defaults to images.DefaultMaxPixels.
+	MaxImagePixels int64
+
+	// InspectPDFs makes UploadFiles check uploaded PDF documents with InspectPDF, refusing those which
+	// are invalid, with ErrInvalidPDF, or contain JavaScript or launch actions, with ErrUnsafePDF.
+	InspectPDFs bool
+	// InspectArchives makes UploadFiles check uploaded zip, tar and tar.gz archives with InspectArchive,
+	// refusing those with more than MaxArchiveFiles entries or expanding beyond MaxArchiveSize, with the
+	// errors of ExtractZip, and those containing illegal paths or other archives, with ErrArchiveIllegalPath
+	// or ErrArchiveNested.
+	InspectArchives bool
+
+	// MediaProber, if set, reads the duration, codecs and resolution of the audio and video files
+	// uploaded with UploadFiles, into UploadedFile.Media; use NativeMediaProber, or FFProbe. Files whose
+	// format it can't read are refused with ErrUnsupportedMedia, unless AllowUnprobedMedia is set.
+	MediaProber MediaProber
+	// AllowUnprobedMedia accepts the audio and video files whose format MediaProber can't read, without
+	// UploadedFile.Media, and so without checking MaxMediaDuration and MaxVideoPixels.
+	AllowUnprobedMedia bool
+	// MaxMediaDuration, if set, is the longest audio or video upload accepted when MediaProber is set.
+	// Longer files are refused with ErrMediaTooLong.
+	MaxMediaDuration time.Duration
+	// MaxVideoPixels, if set, is the largest width times height of video uploads accepted when
+	// MediaProber is set. Larger videos are refused with ErrVideoTooLarge.
+	MaxVideoPixels int64
+
+	// MaxArchiveSize limits, in bytes, how much data may be extracted from an archive. Defaults to 1GB.
+	MaxArchiveSize int64
+	// MaxArchiveFiles limits how many entries may be extracted from an archive. Defaults to 10000.
+	MaxArchiveFiles int
+
+	// CursorKey is the secret used to sign pagination cursors created with EncodeCursor.
+	CursorKey []byte
+
+	// JWTKeys are the keys used by GenerateJWT and ParseJWT. The first key signs new tokens;
+	// all of them are used to verify tokens, so that keys can be rotated.
+	JWTKeys []JWTKey
+	// JWTIssuer, if set, is added to new tokens as the iss claim, and required of parsed tokens.
+	JWTIssuer string
+
+	// CookieKey is the secret, of at least 32 bytes, used to sign and encrypt cookies.
+	CookieKey []byte
+
+	// Messages, if set, holds the translations of the messages sent by ErrorJSON and WriteJSON, by code,
+	// such as those of CodedError, in the locale picked by the Locale middleware.
+	Messages *Messages
+
+	// ResponseMeta, if set, adds metadata to the JSON responses sent by WriteJSON and ErrorJSON, under a
+	// meta key, with the value of each function by name, such as:
+	//
+	//	ResponseMeta: map[string]MetaFunc{"request_id": MetaRequestID, "time": MetaServerTime}
+	//
+	// Functions which need the request find it when MetaMiddleware wraps the handler.
+	ResponseMeta map[string]MetaFunc
+
+	// UseProblemDetails makes ErrorJSON send errors as RFC 7807 problem details (application/problem+json).
+	UseProblemDetails bool
+	// Logger is where the toolkit logs what it does, such as recovered panics, failed uploads or retried
+	// remote calls. Defaults to warnings and errors only, written to ErrorLog.
+	Logger Logger
+	// ErrorLog is used by the HTTP server run by Serve, and by the default Logger. Defaults to the standard logger.
+	ErrorLog *log.Logger
+
+	// RequestIDHeader is the header used by the RequestID middleware. Defaults to X-Request-ID.
+	RequestIDHeader string
+
+	// TrustedProxies lists the addresses, or CIDR blocks, of the reverse proxies whose forwarding headers
+	// RealIP believes.
+	TrustedProxies []string
+
+	// RouteParams, if set, is how RouteParam reads path parameters, such as chi.URLParam.
+	// Defaults to PathValue.
+	RouteParams RouteParamFunc
+
+	// RemoteRetry, if set, makes PushJSONToRemote and GetJSONFromRemote retry requests which fail with
+	// a network error, a 429 or a 5xx status code.
+	RemoteRetry *RetryPolicy
+	// RemoteTokenSource, if set, provides the bearer token PushJSONToRemote and GetJSONFromRemote send
+	// in the Authorization header, to the URLs of RemoteTokenURLs only.
+	RemoteTokenSource TokenSource
+	// RemoteTokenURLs are the URLs, such as https://api.example.com/v1/, under which remote calls get the
+	// token of RemoteTokenSource: a URL matches if it has the same scheme and host, and its path starts
+	// with theirs. Other calls, such as to webhooks supplied by users, are sent without it. When empty,
+	// the token is sent to none.
+	RemoteTokenURLs []string
+	// OutboundPolicy, if set, makes PushJSONToRemote, GetJSONFromRemote and FetchPageMetadata refuse
+	// URLs it doesn't allow, checked with ValidateOutboundURL, for services which call URLs supplied
+	// by users. Their default clients then also only connect to the addresses it allows; they are
+	// created once for the policy, so replace it with a new one rather than change it in place.
+	OutboundPolicy *OutboundPolicy
+
+	// Cache is used by WriteJSONCached and GetJSONFromRemote, and by RateLimit to hold its counters if it
+	// is a CounterCache. WriteJSONCached and GetJSONFromRemote set it to a MemoryCache if it is nil.
+	Cache Cache
+
+	// Metrics, if set, collects metrics about requests (through MetricsMiddleware), uploads and remote calls.
+	Metrics *Metrics
+
+	downloadMu    sync.Mutex
+	downloadSlots chan struct{}
+	cacheMu       sync.Mutex
+	errorMu       sync.RWMutex
+	errorMappings []errorMapping
+	rangeUploadMu sync.Mutex
+	rangeUploads  map[string]bool
+	metricsMu     sync.Mutex
+	outboundMu    sync.Mutex
+	outboundFor   *OutboundPolicy
+	outboundHTTP  *http.Client
 }
 
 // RandomString returns a string of random characters of length n,
 // using randomStringSource as the source for the string.
+//
+// Characters are picked from bytes read from crypto/rand in one go, each byte keeping as many bits as
+// needed to index randomStringSource, and those which fall past its end being rejected, so that every
+// character is equally likely.
 func (t *Tools) RandomString(n int) string {
-	s, r := make([]rune, n), []rune(randomStringSource)
-	for i := range s {
-		p, err := rand.Prime(rand.Reader, len(r))
-		if err != nil {
-			return "RandomString Error"
+	s, err := randomString(n, randomStringSource)
+	if err != nil {
+		return "RandomString Error"
+	}
+	return s
+}
+
+// randomString returns a string of n characters picked at random from source, as RandomString does.
+func randomString(n int, source string) (string, error) {
+	if n <= 0 {
+		return "", nil
+	}
+
+	mask := byte(1)
+	for int(mask) < len(source)-1 {
+		mask = mask<<1 | 1
+	}
+
+	s := make([]byte, 0, n)
+	// rejected bytes are rare, so a little more than n bytes are usually enough
+	buf := make([]byte, n+n/4+8)
+	for len(s) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if i := int(b & mask); i < len(source) {
+				s = append(s, source[i])
+				if len(s) == n {
+					break
+				}
+			}
 		}
-		x, y := p.Uint64(), uint64(len(r))
-		s[i] = r[x%y]
 	}
-	return string(s)
+	return string(s), nil
 }
 
+// processableImageTypes are the detected content types of the uploads ImageProcessing applies to.
+var processableImageTypes = map[string]bool{"image/png": true, "image/jpeg": true, "image/gif": true}
+
 // UploadedFile is a struct used to save information about an uploaded file.
 type UploadedFile struct {
 	NewFileName      string
 	OriginalFileName string
 	FileSize         int64
+	// Media describes audio and video files, when Tools.MediaProber is set and can read their format.
+	Media *MediaInfo
 }
 
 // UploadFiles uploads one or more files to a specified directory,
@@ -54,6 +254,22 @@ type UploadedFile struct {
 // If the optional last parameter is set to true, then we will not rename the files,
 // but will use the original file names.
 func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) ([]*UploadedFile, error) {
+	uploadedFiles, err := t.uploadFiles(r, uploadDir, rename...)
+	t.metrics().recordUpload(uploadedFiles, err)
+
+	if err != nil {
+		t.logger().Warn("upload failed", "dir", uploadDir, "err", err)
+	} else {
+		for _, file := range uploadedFiles {
+			t.logger().Debug("file uploaded", "dir", uploadDir, "file", file.NewFileName,
+				"original", file.OriginalFileName, "size", file.FileSize)
+		}
+	}
+	return uploadedFiles, err
+}
+
+// uploadFiles does the work for UploadFiles.
+func (t *Tools) uploadFiles(r *http.Request, uploadDir string, rename ...bool) ([]*UploadedFile, error) {
 	renameFile := true
 	if len(rename) > 0 {
 		renameFile = rename[0]
@@ -72,6 +288,9 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 	}
 
 	if err = r.ParseMultipartForm(t.MaxFileSize); err != nil {
+		if tooLarge := asBodyTooLarge(err); tooLarge != nil {
+			return nil, tooLarge
+		}
 		return nil, errors.New("the uploaded file is too big")
 	}
 
@@ -85,34 +304,8 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 				}
 				defer inFile.Close()
 
-				// look at the first 512 bytes of the file in order to figure out what it is
-				buff := make([]byte, 512)
-
-				// get the first 512 bytes of the file
-				if _, err = inFile.Read(buff); err != nil {
-					return nil, err
-				}
-
-				// check to see if the file type is permitted
-				allowed := false
-				fileType := http.DetectContentType(buff) // "image/jpeg" || "image/png" || "image/gif" || etc.
-
-				if len(t.AllowedFileTypes) > 0 {
-					for _, allowedFileType := range t.AllowedFileTypes {
-						if strings.EqualFold(fileType, allowedFileType) {
-							allowed = true
-							break
-						}
-					}
-				} else {
-					allowed = true
-				}
-
-				if !allowed {
-					return nil, errors.New("the uploaded file type is not permitted")
-				}
-
-				if _, err = inFile.Seek(0, 0); err != nil {
+				fileType, err := t.checkUpload(inFile, fileHeader.Size)
+				if err != nil {
 					return nil, err
 				}
 
@@ -124,19 +317,66 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 
 				uploadedFile.OriginalFileName = fileHeader.Filename
 
-				var outFile *os.File
-				defer outFile.Close()
+				processImage := t.ImageProcessing != nil && processableImageTypes[fileType]
+				if processImage && t.ImageProcessing.Format != "" {
+					ext := filepath.Ext(uploadedFile.NewFileName)
+					uploadedFile.NewFileName = strings.TrimSuffix(uploadedFile.NewFileName, ext) + t.ImageProcessing.Format.Extension()
+				}
 
-				if outFile, err = os.Create(filepath.Join(uploadDir, uploadedFile.NewFileName)); err != nil {
+				// make sure there is room for the file before writing anything
+				if err = t.checkFreeDiskSpace(uploadDir, fileHeader.Size); err != nil {
 					return nil, err
 				}
 
-				if fileSize, err := io.Copy(outFile, inFile); err != nil {
+				// the file is written under a temporary name, then renamed, so that a crash mid-copy can't
+				// leave a truncated file under the name of the upload
+				finalName := filepath.Join(uploadDir, uploadedFile.NewFileName)
+				tmpName := filepath.Join(uploadDir, ".upload-"+NewULID()+filepath.Ext(uploadedFile.NewFileName))
+				outFile, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_EXCL, t.filePerm(0666))
+				if err != nil {
+					return nil, err
+				}
+				committed := false
+				defer func() {
+					outFile.Close()
+					if !committed {
+						os.Remove(tmpName)
+					}
+				}()
+
+				if processImage {
+					options := *t.ImageProcessing
+					if options.MaxPixels == 0 {
+						options.MaxPixels = t.MaxImagePixels
+					}
+					if _, err = images.Process(inFile, outFile, options); err != nil {
+						return nil, err
+					}
+					info, err := outFile.Stat()
+					if err != nil {
+						return nil, err
+					}
+					uploadedFile.FileSize = info.Size()
+				} else if fileSize, err := t.copyUpload(outFile, inFile); err != nil {
 					return nil, err
 				} else {
 					uploadedFile.FileSize = fileSize
 				}
 
+				if t.MediaProber != nil && (strings.HasPrefix(fileType, "video/") || strings.HasPrefix(fileType, "audio/")) {
+					if uploadedFile.Media, err = t.checkMedia(r.Context(), tmpName); err != nil {
+						return nil, err
+					}
+				}
+
+				if err = t.applyFileMode(tmpName, false); err != nil {
+					return nil, err
+				}
+				if err = t.commitFile(outFile, finalName); err != nil {
+					return nil, err
+				}
+				committed = true
+
 				uploadedFiles = append(uploadedFiles, &uploadedFile)
 				return uploadedFiles, err
 			}(uploadedFiles)
@@ -149,6 +389,126 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 	return uploadedFiles, err
 }
 
+// checkUpload runs the checks of Tools on the uploaded file f, of size bytes, before it is kept: its type
+// against AllowedFileTypes, and, as set, the dimensions of images, the contents of PDFs and archives. It
+// returns the file type, with f back at its start.
+func (t *Tools) checkUpload(f interface {
+	io.ReadSeeker
+	io.ReaderAt
+}, size int64) (string, error) {
+	// look at the first 512 bytes of the file in order to figure out what it is; smaller
+	// files, and a single Read, can return fewer
+	buff := make([]byte, 512)
+	n, err := io.ReadFull(f, buff)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	buff = buff[:n]
+
+	if n == 0 && t.RejectEmptyFiles {
+		return "", ErrEmptyFile
+	}
+
+	// check to see if the file type is permitted
+	fileType, err := DetectFileType(f, size) // "image/jpeg" || "video/mp4" || etc.
+	if err != nil {
+		return "", err
+	}
+
+	if len(t.AllowedFileTypes) > 0 && !fileTypeAllowed(fileType, t.AllowedFileTypes) {
+		return "", errors.New("the uploaded file type is not permitted")
+	}
+
+	if _, err = f.Seek(0, 0); err != nil {
+		return "", err
+	}
+
+	// refuse images with huge dimensions before anything decodes them
+	if t.MaxImagePixels > 0 && strings.HasPrefix(fileType, "image/") {
+		_, _, err = images.CheckPixels(f, t.MaxImagePixels)
+		if err != nil && !errors.Is(err, image.ErrFormat) {
+			return "", err
+		}
+		if _, err = f.Seek(0, 0); err != nil {
+			return "", err
+		}
+	}
+
+	if t.InspectPDFs && fileType == "application/pdf" {
+		info, err := t.InspectPDF(f)
+		if err != nil {
+			return "", err
+		}
+		if !info.Safe() {
+			return "", ErrUnsafePDF
+		}
+		if _, err = f.Seek(0, 0); err != nil {
+			return "", err
+		}
+	}
+
+	// refuse archive bombs before anyone extracts them
+	if t.InspectArchives && archiveFormat(buff) != "" {
+		info, err := t.InspectArchive(f, size)
+		if err != nil {
+			return "", err
+		}
+		if len(info.IllegalPaths) > 0 {
+			return "", ErrArchiveIllegalPath
+		}
+		if len(info.Nested) > 0 {
+			return "", ErrArchiveNested
+		}
+	}
+	return fileType, nil
+}
+
+// commitFile moves f, a temporary file which was just written, to name, after syncing it to disk if
+// Tools.SyncWrites is set, as well as the directory afterwards, so that the rename is durable too.
+func (t *Tools) commitFile(f *os.File, name string) error {
+	if t.SyncWrites {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return err
+	}
+	if t.SyncWrites {
+		return syncDir(filepath.Dir(name))
+	}
+	return nil
+}
+
+// uploadBufferPool holds the buffers of copyUpload, as *[]byte.
+var uploadBufferPool sync.Pool
+
+// copyUpload copies src, an uploaded file, to dst, with a buffer of Tools.UploadBufferSize bytes from
+// uploadBufferPool, rather than a new buffer for every file.
+func (t *Tools) copyUpload(dst *os.File, src io.Reader) (int64, error) {
+	// parts stored on disk by ParseMultipartForm are copied by the kernel, without any buffer
+	if f, ok := src.(*os.File); ok {
+		return io.Copy(dst, f)
+	}
+
+	size := t.UploadBufferSize
+	if size <= 0 {
+		size = 32 * 1024
+	}
+	buf, _ := uploadBufferPool.Get().(*[]byte)
+	if buf == nil || cap(*buf) < size {
+		b := make([]byte, size)
+		buf = &b
+	}
+	defer uploadBufferPool.Put(buf)
+
+	// hiding dst's ReadFrom method makes io.CopyBuffer use the buffer
+	return io.CopyBuffer(struct{ io.Writer }{dst}, src, (*buf)[:size])
+}
+
 // UploadOneFile is just a convenience method that calls UploadFiles, but expects only one file to be in the upload.
 func (t *Tools) UploadOneFile(r *http.Request, uploadDir string, rename ...bool) (*UploadedFile, error) {
 	renameFile := true
@@ -162,13 +522,14 @@ func (t *Tools) UploadOneFile(r *http.Request, uploadDir string, rename ...bool)
 	return files[0], err
 }
 
-// CreateDirIfNotExist creates a directory, and all necessary parents, if it does not exist.
+// CreateDirIfNotExist creates a directory, and all necessary parents, if it does not exist, with the
+// permissions of Tools.DirPerm, and the owner of Tools.FileOwner.
 func (t *Tools) CreateDirIfNotExist(path string) error {
-	const mode = 0755 // fs.FileMode
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		if err := os.MkdirAll(path, mode); err != nil {
+		if err := os.MkdirAll(path, t.dirPerm()); err != nil {
 			return err
 		}
+		return t.applyFileMode(path, true)
 	}
 	return nil
 }
@@ -189,24 +550,323 @@ func (t *Tools) Slugify(s string) (string, error) {
 // DownloadStaticFile downloads a file, and tries to force the browser
 // to avoid displaying it in the browser window by setting content disposition.
 // It also allows specification of the display name.
-func (t *Tools) DownloadStaticFile(w http.ResponseWriter, r *http.Request, filePath, displayName string) {
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", displayName))
+// If the optional last parameter is set to true, then the file is served inline,
+// so that browsers may preview it (e.g. PDFs and images) instead of saving it.
+func (t *Tools) DownloadStaticFile(w http.ResponseWriter, r *http.Request, filePath, displayName string, inline ...bool) {
+	w, release, ok := t.limitDownload(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	w.Header().Set("Content-Disposition", contentDisposition(dispositionType(inline), displayName))
 	http.ServeFile(w, r, filePath)
 }
 
+// DownloadStaticFileFS works like DownloadStaticFile, but serves the file at path from fsys,
+// so that files embedded with go:embed, or held in any other fs.FS, can be downloaded
+// using the same content disposition logic.
+// If the optional last parameter is set to true, then the file is served inline.
+func (t *Tools) DownloadStaticFileFS(w http.ResponseWriter, r *http.Request, fsys fs.FS, path, displayName string, inline ...bool) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	// http.ServeContent needs to seek, which not every fs.File supports
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	t.ServeContentFrom(w, r, info.Name(), info.ModTime(), content, displayName, inline...)
+}
+
+// ServeContentFrom serves the content read from rs, with the same content disposition logic as DownloadStaticFile.
+// It makes it possible to stream content which does not live on local disk, such as S3 objects or database blobs,
+// with full support for range requests and conditional requests. The name is used to determine the content type
+// when it is not already set, and modtime (which may be the zero time) for Last-Modified handling.
+// If the optional last parameter is set to true, then the content is served inline.
+func (t *Tools) ServeContentFrom(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, rs io.ReadSeeker, displayName string, inline ...bool) {
+	w, release, ok := t.limitDownload(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	w.Header().Set("Content-Disposition", contentDisposition(dispositionType(inline), displayName))
+	http.ServeContent(w, r, name, modtime, rs)
+}
+
+// DownloadZip streams a zip archive containing files to the client, without building the archive on disk first.
+// Each file is stored in the archive under its base name, and zipName is used as the download's display name.
+// Since the archive is streamed, an error part way through can no longer be reported to the client;
+// it is returned instead, so that it can at least be logged.
+func (t *Tools) DownloadZip(w http.ResponseWriter, r *http.Request, files []string, zipName string) error {
+	return t.downloadZip(w, r, files, zipName, func(name string) (fs.File, error) {
+		return os.Open(name)
+	})
+}
+
+// DownloadZipFS works like DownloadZip, but reads the files at paths from fsys.
+func (t *Tools) DownloadZipFS(w http.ResponseWriter, r *http.Request, fsys fs.FS, paths []string, zipName string) error {
+	return t.downloadZip(w, r, paths, zipName, fsys.Open)
+}
+
+// downloadZip does the work for DownloadZip and DownloadZipFS, using open to access each file.
+func (t *Tools) downloadZip(w http.ResponseWriter, r *http.Request, files []string, zipName string, open func(string) (fs.File, error)) error {
+	// make sure every file is there before anything is sent, since we can't change the status code afterwards
+	for _, file := range files {
+		f, err := open(file)
+		if err != nil {
+			http.NotFound(w, r)
+			return err
+		}
+		info, err := f.Stat()
+		f.Close()
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return fmt.Errorf("%s is not a file", file)
+		}
+	}
+
+	w, release, ok := t.limitDownload(w, r)
+	if !ok {
+		return r.Context().Err()
+	}
+	defer release()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", zipName))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	used := make(map[string]bool)
+	for _, file := range files {
+		if err := func() error {
+			f, err := open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			info, err := f.Stat()
+			if err != nil {
+				return err
+			}
+
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			header.Name = uniqueZipName(used, path.Base(filepath.ToSlash(file)))
+			header.Method = zip.Deflate
+
+			entry, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(entry, f)
+			return err
+		}(); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// uniqueZipName returns name, or name with a " (n)" suffix if it has already been used in the archive.
+func uniqueZipName(used map[string]bool, name string) string {
+	candidate := name
+	ext := path.Ext(name)
+	for i := 2; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// limitDownload applies MaxConcurrentDownloads and MaxDownloadRate to a download.
+// It returns the writer the file should be served through, and a function which must be called
+// to release the download slot once done. If the request is cancelled while waiting for a slot,
+// ok is false and nothing should be written.
+func (t *Tools) limitDownload(w http.ResponseWriter, r *http.Request) (tw http.ResponseWriter, release func(), ok bool) {
+	release = func() {}
+
+	if t.MaxConcurrentDownloads > 0 {
+		t.downloadMu.Lock()
+		if t.downloadSlots == nil {
+			t.downloadSlots = make(chan struct{}, t.MaxConcurrentDownloads)
+		}
+		slots := t.downloadSlots
+		t.downloadMu.Unlock()
+
+		select {
+		case slots <- struct{}{}:
+			release = func() { <-slots }
+		case <-r.Context().Done():
+			return nil, release, false
+		}
+	}
+
+	if t.MaxDownloadRate > 0 {
+		w = &throttledWriter{ResponseWriter: w, rate: t.MaxDownloadRate, done: r.Context().Done()}
+	}
+
+	return w, release, true
+}
+
+// throttledWriter is an http.ResponseWriter which writes no more than rate bytes per second.
+type throttledWriter struct {
+	http.ResponseWriter
+	rate    int64
+	done    <-chan struct{}
+	start   time.Time
+	written int64
+}
+
+// Write sends p in small chunks, sleeping between them whenever the writer is ahead of its rate.
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	if tw.start.IsZero() {
+		tw.start = time.Now()
+	}
+
+	// send roughly a tenth of a second worth of data at a time, so the rate stays smooth
+	chunk := int(tw.rate / 10)
+	if chunk < 1 {
+		chunk = 1
+	}
+
+	total := 0
+	for len(p) > 0 {
+		size := chunk
+		if size > len(p) {
+			size = len(p)
+		}
+
+		n, err := tw.ResponseWriter.Write(p[:size])
+		total += n
+		tw.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[size:]
+
+		expected := time.Duration(float64(tw.written) / float64(tw.rate) * float64(time.Second))
+		if wait := expected - time.Since(tw.start); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-tw.done:
+				timer.Stop()
+				return total, errors.New("download cancelled")
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// dispositionType returns the Content-Disposition type to use, given the optional inline parameter of the download methods.
+func dispositionType(inline []bool) string {
+	if len(inline) > 0 && inline[0] {
+		return "inline"
+	}
+	return "attachment"
+}
+
+// contentDisposition builds a Content-Disposition header value of the given type for fileName.
+// Plain ASCII names are sent as a quoted filename parameter; any other name also gets
+// an RFC 5987 encoded filename* parameter, with an ASCII fallback for older clients.
+func contentDisposition(disposition, fileName string) string {
+	var fallback strings.Builder
+	ascii := true
+	for _, c := range fileName {
+		switch {
+		case c < 0x20 || c == 0x7f:
+			// control characters are never valid in a header value
+			ascii = false
+		case c > 0x7f:
+			ascii = false
+			fallback.WriteByte('_')
+		case c == '"' || c == '\\':
+			fallback.WriteByte('\\')
+			fallback.WriteRune(c)
+		default:
+			fallback.WriteRune(c)
+		}
+	}
+
+	if ascii {
+		return fmt.Sprintf("%s; filename=\"%s\"", disposition, fallback.String())
+	}
+	return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", disposition, fallback.String(), encodeRFC5987(fileName))
+}
+
+// encodeRFC5987 percent-encodes s as an RFC 5987 ext-value, leaving only attr-char unescaped.
+func encodeRFC5987(s string) string {
+	const attrChars = "!#$&+-.^_`|~"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte(attrChars, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
 // JSONResponse is the type used for sending JSON around.
 type JSONResponse struct {
 	Error   bool   `json:"error"`
 	Message string `json:"message"`
-	Data    any    `json:"data,omitempty"`
+	// Code is a stable code for the message, such as "order.not_found", which WriteJSON translates the
+	// message for, from Tools.Messages.
+	Code      string `json:"code,omitempty"`
+	Data      any    `json:"data,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ProblemDetails is the type used for sending errors as RFC 7807 problem details,
+// when Tools.UseProblemDetails is set.
+type ProblemDetails struct {
+	Type      string           `json:"type"`
+	Title     string           `json:"title"`
+	Status    int              `json:"status"`
+	Detail    string           `json:"detail,omitempty"`
+	Code      string           `json:"code,omitempty"`
+	Errors    ValidationErrors `json:"errors,omitempty"`
+	RequestID string           `json:"request_id,omitempty"`
 }
 
 // ReadJSON tries to read the body of a request and converts from json into a go data variable.
 func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data any) error {
-	var maxBytes int64 = 1024 * 1024 // 1MB
-	if t.MaxJSONSize != 0 {
-		maxBytes = t.MaxJSONSize
+	err := t.readJSON(w, r, data)
+	if err != nil {
+		t.logger().Debug("invalid JSON body", "method", r.Method, "path", r.URL.Path, "err", err)
 	}
+	return err
+}
+
+// readJSON does the work for ReadJSON.
+func (t *Tools) readJSON(w http.ResponseWriter, r *http.Request, data any) error {
+	maxBytes := t.maxJSONSize()
 
 	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 	dec := json.NewDecoder(r.Body)
@@ -239,8 +899,8 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data any) error
 		case strings.HasPrefix(err.Error(), "json: unknown field"):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown fifeld")
 			return fmt.Errorf("body contains unknown key %s", fieldName)
-		case err.Error() == "http: request body too large":
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		case asBodyTooLarge(err) != nil:
+			return asBodyTooLarge(err)
 		default:
 			return err
 		}
@@ -253,20 +913,62 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data any) error
 	return nil
 }
 
+// maxJSONSize returns the largest JSON body ReadJSON reads, Tools.MaxJSONSize or 1MB.
+func (t *Tools) maxJSONSize() int64 {
+	if t.MaxJSONSize != 0 {
+		return t.MaxJSONSize
+	}
+	return 1024 * 1024 // 1MB
+}
+
 // WriteJSON takes a response status code and arbitrary data and writes json to the client.
+// If w is, or wraps, a ResponseWriter whose response was written already, it only logs a warning.
+// The message of a JSONResponse with a Code is translated from Tools.Messages, if set, to the
+// Content-Language of the response, as set by the Locale middleware.
+// The values of Tools.ResponseMeta, if set, are added under a meta key.
 func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data any, headers ...http.Header) error {
+	switch payload := data.(type) {
+	case JSONResponse:
+		t.translateResponse(w, &payload, nil)
+		data = payload
+	case *JSONResponse:
+		if payload != nil && payload.Code != "" {
+			translated := *payload
+			t.translateResponse(w, &translated, nil)
+			data = translated
+		}
+	}
+	return t.writeJSON(w, status, data, headers...)
+}
+
+// writeJSON is WriteJSON, without translating messages.
+func (t *Tools) writeJSON(w http.ResponseWriter, status int, data any, headers ...http.Header) error {
+	if responseWritten(w) {
+		t.logger().Warn("response already written, JSON not sent", "status", status)
+		return nil
+	}
+
 	out, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
+	if len(t.ResponseMeta) > 0 {
+		if out, err = t.addMeta(w, data, out); err != nil {
+			return err
+		}
+	}
 
+	contentType := "application/json"
 	if len(headers) > 0 {
 		for k, v := range headers[0] {
 			w.Header()[k] = v
 		}
+		if ct := headers[0].Get("Content-Type"); ct != "" {
+			contentType = ct
+		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(status)
 
 	if _, err := w.Write(out); err != nil {
@@ -277,45 +979,132 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data any, headers .
 }
 
 // ErrorJSON takes an error, and optionally a status code, and generates and sends a JSON error message.
+// If err is a ValidationErrors, the per-field messages are sent as data, and the default status code is 422.
+// If Tools.UseProblemDetails is set, the error is sent as RFC 7807 problem details instead.
+// The request id set by the RequestID middleware, if any, is included so that errors can be traced in the logs.
+// The code of a CodedError is included too, and its message translated, as WriteJSON does.
 func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error {
-	statusCode := http.StatusBadRequest
-	if len(status) > 0 {
-		statusCode = status[0]
+	if responseWritten(w) {
+		t.logger().Warn("response already written, error not sent", "err", err)
+		return nil
 	}
 
+	statusCode := http.StatusBadRequest
+
 	var payload JSONResponse
 	payload.Error = true
 	payload.Message = err.Error()
+	payload.RequestID = w.Header().Get(t.requestIDHeader())
+
+	var validationErrors ValidationErrors
+	if errors.As(err, &validationErrors) {
+		statusCode = http.StatusUnprocessableEntity
+		payload.Message = "validation failed"
+		payload.Data = validationErrors
+	}
+	if errors.Is(err, ErrBodyTooLarge) || asBodyTooLarge(err) != nil {
+		statusCode = http.StatusRequestEntityTooLarge
+	}
+
+	var coded *CodedError
+	if errors.As(err, &coded) {
+		payload.Code = coded.Code
+		t.translateResponse(w, &payload, coded.Params)
+	}
 
-	return t.WriteJSON(w, statusCode, payload)
+	if len(status) > 0 {
+		statusCode = status[0]
+	}
+
+	if t.UseProblemDetails {
+		problem := ProblemDetails{
+			Type:      "about:blank",
+			Title:     http.StatusText(statusCode),
+			Status:    statusCode,
+			Detail:    payload.Message,
+			Code:      payload.Code,
+			Errors:    validationErrors,
+			RequestID: payload.RequestID,
+		}
+		headers := make(http.Header)
+		headers.Set("Content-Type", "application/problem+json")
+		return t.writeJSON(w, statusCode, problem, headers)
+	}
+
+	return t.writeJSON(w, statusCode, payload)
+}
+
+// sendRemote sends the request made by newRequest to uri, which is checked against Tools.OutboundPolicy,
+// with a token from Tools.RemoteTokenSource, retrying it according to Tools.RemoteRetry and recording
+// every attempt in Tools.Metrics. newRequest is called for each attempt, so that bodies are sent whole
+// again. The response of the last attempt is returned, its body closed already if its status could be
+// retried, and so is the first error which can't be.
+func (t *Tools) sendRemote(ctx context.Context, uri string, client []*http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	if err := t.checkOutbound(uri); err != nil {
+		return nil, err
+	}
+	httpClient := t.outboundClient(client)
+
+	var response *http.Response
+	err := t.retryRemote(ctx, uri, func() error {
+		request, err := newRequest()
+		if err != nil {
+			return Permanent(err)
+		}
+		if err = t.authorizeRemote(request); err != nil {
+			return err
+		}
+
+		// call the remote uri
+		response, err = httpClient.Do(request)
+		t.metrics().recordRemoteCall(response, err)
+		if err != nil {
+			return err
+		}
+		if retryableStatus(response.StatusCode) {
+			response.Body.Close()
+			return errRetryableStatus
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRetryableStatus) {
+		return nil, err
+	}
+	return response, nil
+}
+
+// WriteValidationErrors sends the per-field validation errors to the client, as JSON, with a 422 status code.
+func (t *Tools) WriteValidationErrors(w http.ResponseWriter, errs ValidationErrors) error {
+	return t.ErrorJSON(w, errs, http.StatusUnprocessableEntity)
 }
 
 // PushJSONToRemote posts arbitrary data to some URL as JSON,
 // and returns the response, status code, and error if any.
+// Failed requests are retried according to Tools.RemoteRetry, if set.
 // The final parameter, client, is optional.
-// If none is specified, we use the standard http.Client.
+// If none is specified, we use the standard http.Client,
+// or one which follows Tools.OutboundPolicy, if set.
 func (t *Tools) PushJSONToRemote(uri string, data any, client ...*http.Client) (*http.Response, int, error) {
+	return t.pushJSONToRemote(context.Background(), uri, data, client)
+}
+
+// pushJSONToRemote is PushJSONToRemote, with requests and retries ending with ctx.
+func (t *Tools) pushJSONToRemote(ctx context.Context, uri string, data any, client []*http.Client) (*http.Response, int, error) {
 	// create json
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	// check for custom http client
-	httpClient := &http.Client{}
-	if len(client) > 0 {
-		httpClient = client[0]
-	}
-
-	// build the request and set the header
-	request, err := http.NewRequest("POST", uri, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, 0, err
-	}
-	request.Header.Set("Content-Type", "application/json")
-
-	// call the remote uri
-	response, err := httpClient.Do(request)
+	response, err := t.sendRemote(ctx, uri, client, func() (*http.Request, error) {
+		// build the request and set the header
+		request, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		return request, nil
+	})
 	if err != nil {
 		return nil, 0, err
 	}
@@ -1,19 +1,30 @@
 package toolkit
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"image"
+	"image/gif"
 	"image/png"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/alftirta/toolkit/v2/images"
 )
 
 type RoundTripFunc func(req *http.Request) *http.Response
@@ -53,6 +64,51 @@ func TestTools_RandomString(t *testing.T) {
 	if len(s) != 10 {
 		t.Error("wrong length of random string")
 	}
+	if testTools.RandomString(0) != "" {
+		t.Error("expected an empty string")
+	}
+
+	// every character of the source comes up, about as often as the others
+	counts := make(map[rune]int)
+	for _, c := range testTools.RandomString(64000) {
+		if !strings.ContainsRune(randomStringSource, c) {
+			t.Fatalf("unexpected character %q", c)
+		}
+		counts[c]++
+	}
+	for _, c := range randomStringSource {
+		if counts[c] < 700 || counts[c] > 1300 {
+			t.Errorf("expected about 1000 %q, got %d", c, counts[c])
+		}
+	}
+}
+
+// randomStringPrime is the former implementation of RandomString, drawing a prime per character, kept
+// to compare their speed.
+func randomStringPrime(n int) string {
+	s, r := make([]rune, n), []rune(randomStringSource)
+	for i := range s {
+		p, err := rand.Prime(rand.Reader, len(r))
+		if err != nil {
+			return "RandomString Error"
+		}
+		x, y := p.Uint64(), uint64(len(r))
+		s[i] = r[x%y]
+	}
+	return string(s)
+}
+
+func BenchmarkTools_RandomString(b *testing.B) {
+	var testTools Tools
+	for i := 0; i < b.N; i++ {
+		testTools.RandomString(25)
+	}
+}
+
+func BenchmarkRandomStringPrime(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		randomStringPrime(25)
+	}
 }
 
 var uploadTests = []struct {
@@ -147,6 +203,191 @@ func TestTools_UploadFiles(t *testing.T) {
 	}
 }
 
+func TestTools_UploadFilesInsufficientStorage(t *testing.T) {
+	if _, err := freeDiskSpace("./testdata"); err != nil {
+		t.Skip("free disk space is not available:", err)
+	}
+
+	request, err := NewMultipartRequest("/").AddFile("file", "./testdata/img.png").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testTools := Tools{MinFreeDiskSpace: 1 << 62}
+
+	if _, err := testTools.UploadFiles(request, "./testdata/uploads"); !errors.Is(err, ErrInsufficientStorage) {
+		t.Error("expected ErrInsufficientStorage, but got", err)
+	}
+
+	entries, _ := os.ReadDir("./testdata/uploads")
+	if len(entries) != 0 {
+		t.Error("expected no file to be written")
+	}
+}
+
+func TestTools_UploadFilesImageProcessing(t *testing.T) {
+	request, err := NewMultipartRequest("/").AddFile("file", "./testdata/img.png").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testTools := Tools{ImageProcessing: &images.Options{Width: 16, Format: images.JPEG}}
+	uploadDir := t.TempDir()
+
+	uploadedFiles, err := testTools.UploadFiles(request, uploadDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploadedFiles[0].NewFileName != "img.jpg" {
+		t.Error("expected the extension to match the new format, got", uploadedFiles[0].NewFileName)
+	}
+
+	f, err := os.Open(filepath.Join(uploadDir, "img.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	config, format, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || config.Width != 16 {
+		t.Error("the image was not processed", format, config.Width)
+	}
+	if info, _ := f.Stat(); info.Size() != uploadedFiles[0].FileSize {
+		t.Error("wrong file size", uploadedFiles[0].FileSize)
+	}
+}
+
+func TestTools_UploadFilesMaxImagePixels(t *testing.T) {
+	// a 1x1 GIF declaring 60000x60000 pixels
+	var bomb bytes.Buffer
+	if err := gif.Encode(&bomb, image.NewGray(image.Rect(0, 0, 1, 1)), nil); err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint16(bomb.Bytes()[6:], 60000)
+	binary.LittleEndian.PutUint16(bomb.Bytes()[8:], 60000)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", "bomb.gif")
+	part.Write(bomb.Bytes())
+	writer.Close()
+
+	request := httptest.NewRequest("POST", "/", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	testTools := Tools{MaxImagePixels: 10_000_000}
+	uploadDir := t.TempDir()
+
+	if _, err := testTools.UploadFiles(request, uploadDir); !errors.Is(err, images.ErrTooManyPixels) {
+		t.Error("expected images.ErrTooManyPixels, got", err)
+	}
+	if entries, _ := os.ReadDir(uploadDir); len(entries) != 0 {
+		t.Error("expected no file to be written")
+	}
+}
+
+func TestTools_copyUpload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	testTools := Tools{UploadBufferSize: 7}
+
+	for i := 0; i < 2; i++ {
+		out, err := os.Create(filepath.Join(t.TempDir(), "out"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a reader without WriteTo, as the parts ParseMultipartForm keeps in memory
+		n, err := testTools.copyUpload(out, struct{ io.Reader }{bytes.NewReader(content)})
+		out.Close()
+		if err != nil || n != int64(len(content)) {
+			t.Fatalf("expected %d bytes, got %d (%v)", len(content), n, err)
+		}
+		if written, _ := os.ReadFile(out.Name()); !bytes.Equal(written, content) {
+			t.Error("wrong content written")
+		}
+	}
+}
+
+func BenchmarkTools_copyUpload(b *testing.B) {
+	var testTools Tools
+	content := bytes.Repeat([]byte("x"), 100*1024)
+	out, err := os.Create(filepath.Join(b.TempDir(), "out"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer out.Close()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = out.Seek(0, 0)
+		if _, err := testTools.copyUpload(out, struct{ io.Reader }{bytes.NewReader(content)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTools_UploadFilesSmall(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		reject  bool
+		err     error
+	}{
+		{name: "small", content: "hello"},
+		// an empty zip archive, which is inspected
+		{name: "small zip", content: "PK\x05\x06" + strings.Repeat("\x00", 18)},
+		{name: "empty", content: ""},
+		{name: "empty refused", content: "", reject: true, err: ErrEmptyFile},
+	}
+
+	for _, test := range tests {
+		request, err := NewMultipartRequest("/").AddReader("file", "file.bin", strings.NewReader(test.content)).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testTools := Tools{RejectEmptyFiles: test.reject, InspectArchives: true}
+		uploadedFiles, err := testTools.UploadFiles(request, t.TempDir())
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+			continue
+		}
+		if err == nil && uploadedFiles[0].FileSize != int64(len(test.content)) {
+			t.Errorf("%s: wrong size %d", test.name, uploadedFiles[0].FileSize)
+		}
+	}
+}
+
+func TestTools_UploadFilesAtomic(t *testing.T) {
+	uploadDir := t.TempDir()
+	testTools := Tools{SyncWrites: true, ImageProcessing: &images.Options{Width: 16}}
+
+	request, err := NewMultipartRequest("/").AddFile("file", "./testdata/img.png").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadedFiles, err := testTools.UploadFiles(request, uploadDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a PNG which can't be decoded fails once its temporary file is written
+	request, err = NewMultipartRequest("/").AddReader("file", "broken.png", strings.NewReader("\x89PNG\r\n\x1a\nbroken")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = testTools.UploadFiles(request, uploadDir, false); err == nil {
+		t.Error("expected an error for a broken image")
+	}
+
+	entries, _ := os.ReadDir(uploadDir)
+	if len(entries) != 1 || entries[0].Name() != uploadedFiles[0].NewFileName {
+		t.Errorf("expected only %s to be left, got %v", uploadedFiles[0].NewFileName, entries)
+	}
+}
+
 func TestTools_UploadOneFile(t *testing.T) {
 	// set up a pipe to avoid buffering
 	pr, pw := io.Pipe()
@@ -290,6 +531,252 @@ func TestTools_DownloadStaticFile(t *testing.T) {
 	}
 }
 
+func TestTools_DownloadStaticFileInline(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/arbitrary-endpoint", nil)
+
+	var testTool Tools
+	testTool.DownloadStaticFile(rec, req, "./testdata/pic.jpg", "puppy.jpg", true)
+
+	res := rec.Result()
+	defer res.Body.Close()
+
+	if res.Header.Get("Content-Disposition") != "inline; filename=\"puppy.jpg\"" {
+		t.Error("wrong content disposition", res.Header.Get("Content-Disposition"))
+	}
+}
+
+func TestTools_DownloadStaticFileFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/report.pdf": &fstest.MapFile{Data: []byte("%PDF-1.4 not really a pdf")},
+	}
+
+	var testTool Tools
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/arbitrary-endpoint", nil)
+	testTool.DownloadStaticFileFS(rec, req, os.DirFS("./testdata"), "pic.jpg", "puppy.jpg")
+
+	res := rec.Result()
+	defer res.Body.Close()
+
+	if res.Header.Get("Content-Length") != "98827" {
+		t.Error("wrong content length of", res.Header.Get("Content-Length"))
+	}
+
+	if res.Header.Get("Content-Disposition") != "attachment; filename=\"puppy.jpg\"" {
+		t.Error("wrong content disposition")
+	}
+
+	rec = httptest.NewRecorder()
+	testTool.DownloadStaticFileFS(rec, req, fsys, "docs/report.pdf", "report.pdf", true)
+
+	if rec.Header().Get("Content-Disposition") != "inline; filename=\"report.pdf\"" {
+		t.Error("wrong content disposition", rec.Header().Get("Content-Disposition"))
+	}
+
+	if rec.Body.String() != "%PDF-1.4 not really a pdf" {
+		t.Error("wrong body served", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	testTool.DownloadStaticFileFS(rec, req, fsys, "docs/missing.pdf", "missing.pdf")
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("wrong status code returned; expected 404, but got %d", rec.Code)
+	}
+}
+
+func TestTools_DownloadStaticFileThrottled(t *testing.T) {
+	fsys := fstest.MapFS{
+		"data.bin": &fstest.MapFile{Data: bytes.Repeat([]byte("a"), 300)},
+	}
+
+	testTool := Tools{MaxDownloadRate: 1000}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/arbitrary-endpoint", nil)
+
+	start := time.Now()
+	testTool.DownloadStaticFileFS(rec, req, fsys, "data.bin", "data.bin")
+	elapsed := time.Since(start)
+
+	if rec.Body.Len() != 300 {
+		t.Errorf("wrong number of bytes sent; expected 300 but got %d", rec.Body.Len())
+	}
+
+	if elapsed < 250*time.Millisecond {
+		t.Errorf("download was not throttled; took %s", elapsed)
+	}
+}
+
+func TestTools_DownloadStaticFileConcurrency(t *testing.T) {
+	testTool := Tools{MaxConcurrentDownloads: 1}
+
+	// take the only download slot
+	req := httptest.NewRequest("GET", "/arbitrary-endpoint", nil)
+	_, release, ok := testTool.limitDownload(httptest.NewRecorder(), req)
+	if !ok {
+		t.Fatal("expected to get a download slot")
+	}
+
+	// a second download waits until its request is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	rec := httptest.NewRecorder()
+	testTool.DownloadStaticFile(rec, req.WithContext(ctx), "./testdata/pic.jpg", "puppy.jpg")
+	if rec.Body.Len() != 0 {
+		t.Error("expected nothing to be written while all slots are taken")
+	}
+
+	// once released, downloads proceed again
+	release()
+
+	rec = httptest.NewRecorder()
+	testTool.DownloadStaticFile(rec, req, "./testdata/pic.jpg", "puppy.jpg")
+	if rec.Body.Len() != 98827 {
+		t.Errorf("wrong number of bytes sent; expected 98827 but got %d", rec.Body.Len())
+	}
+}
+
+func TestTools_DownloadZip(t *testing.T) {
+	var testTool Tools
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/arbitrary-endpoint", nil)
+
+	if err := testTool.DownloadZip(rec, req, []string{"./testdata/pic.jpg", "./testdata/img.png", "./testdata/pic.jpg"}, "images.zip"); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Header().Get("Content-Type") != "application/zip" {
+		t.Error("wrong content type", rec.Header().Get("Content-Type"))
+	}
+
+	if rec.Header().Get("Content-Disposition") != "attachment; filename=\"images.zip\"" {
+		t.Error("wrong content disposition", rec.Header().Get("Content-Disposition"))
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal("error reading zip", err)
+	}
+
+	expected := []string{"pic.jpg", "img.png", "pic (2).jpg"}
+	if len(zr.File) != len(expected) {
+		t.Fatalf("wrong number of files in zip; expected %d but got %d", len(expected), len(zr.File))
+	}
+	for i, f := range zr.File {
+		if f.Name != expected[i] {
+			t.Errorf("wrong file name in zip; expected %s but got %s", expected[i], f.Name)
+		}
+	}
+	if zr.File[0].UncompressedSize64 != 98827 {
+		t.Error("wrong size of pic.jpg in zip", zr.File[0].UncompressedSize64)
+	}
+}
+
+func TestTools_DownloadZipFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/one.txt": &fstest.MapFile{Data: []byte("one")},
+		"b/two.txt": &fstest.MapFile{Data: []byte("two")},
+	}
+
+	var testTool Tools
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/arbitrary-endpoint", nil)
+
+	if err := testTool.DownloadZipFS(rec, req, fsys, []string{"a/one.txt", "b/two.txt"}, "all.zip"); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal("error reading zip", err)
+	}
+
+	for i, expected := range []string{"one", "two"} {
+		f, err := zr.File[i].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(f)
+		f.Close()
+		if string(content) != expected {
+			t.Errorf("wrong content in zip; expected %s but got %s", expected, content)
+		}
+	}
+
+	// a missing file is reported before anything is streamed
+	rec = httptest.NewRecorder()
+	if err := testTool.DownloadZipFS(rec, req, fsys, []string{"a/one.txt", "c/missing.txt"}, "all.zip"); err == nil {
+		t.Error("error expected for missing file, but none received")
+	}
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("wrong status code returned; expected 404, but got %d", rec.Code)
+	}
+}
+
+func TestTools_ServeContentFrom(t *testing.T) {
+	var testTool Tools
+
+	modtime := time.Date(2022, time.October, 1, 12, 0, 0, 0, time.UTC)
+	content := strings.NewReader("0123456789")
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/arbitrary-endpoint", nil)
+	req.Header.Set("Range", "bytes=2-5")
+
+	testTool.ServeContentFrom(rec, req, "numbers.txt", modtime, content, "numbers.txt")
+
+	if rec.Code != http.StatusPartialContent {
+		t.Errorf("wrong status code returned; expected 206, but got %d", rec.Code)
+	}
+
+	if rec.Body.String() != "2345" {
+		t.Error("wrong range served", rec.Body.String())
+	}
+
+	if rec.Header().Get("Content-Disposition") != "attachment; filename=\"numbers.txt\"" {
+		t.Error("wrong content disposition", rec.Header().Get("Content-Disposition"))
+	}
+
+	// conditional requests are honoured
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/arbitrary-endpoint", nil)
+	req.Header.Set("If-Modified-Since", modtime.Format(http.TimeFormat))
+
+	testTool.ServeContentFrom(rec, req, "numbers.txt", modtime, content, "numbers.txt", true)
+
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("wrong status code returned; expected 304, but got %d", rec.Code)
+	}
+}
+
+var contentDispositionTests = []struct {
+	name        string
+	disposition string
+	fileName    string
+	expected    string
+}{
+	{name: "plain", disposition: "attachment", fileName: "puppy.jpg", expected: `attachment; filename="puppy.jpg"`},
+	{name: "inline", disposition: "inline", fileName: "report.pdf", expected: `inline; filename="report.pdf"`},
+	{name: "quotes", disposition: "attachment", fileName: `my "best" pic.jpg`, expected: `attachment; filename="my \"best\" pic.jpg"`},
+	{name: "unicode", disposition: "attachment", fileName: "café €.jpg", expected: `attachment; filename="caf_ _.jpg"; filename*=UTF-8''caf%C3%A9%20%E2%82%AC.jpg`},
+	{name: "control characters", disposition: "attachment", fileName: "a\nb.txt", expected: `attachment; filename="ab.txt"; filename*=UTF-8''a%0Ab.txt`},
+}
+
+func TestContentDisposition(t *testing.T) {
+	for _, test := range contentDispositionTests {
+		if got := contentDisposition(test.disposition, test.fileName); got != test.expected {
+			t.Errorf("%s: expected %s but got %s", test.name, test.expected, got)
+		}
+	}
+}
+
 var readJSONTests = []struct {
 	name               string
 	json               string
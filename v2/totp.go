@@ -0,0 +1,110 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The parameters of the TOTP codes, which are those authenticator apps expect by default (RFC 6238).
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+)
+
+// ErrInvalidTOTPSecret is returned for TOTP secrets which aren't base32 encoded.
+var ErrInvalidTOTPSecret = errors.New("invalid TOTP secret")
+
+// totpEncoding is the base32 encoding of TOTP secrets, without padding.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random secret for TOTP two-factor authentication, base32 encoded
+// as authenticator apps expect.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPProvisioningURI returns the otpauth:// URI enrolling secret in an authenticator app for account,
+// such as a user's email address, at issuer, your service's name. It is usually shown as a QR code,
+// with GenerateQRCode.
+func TOTPProvisioningURI(secret, issuer, account string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// GenerateTOTP returns the TOTP code for secret at time at.
+func GenerateTOTP(secret string, at time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, uint64(at.Unix())/uint64(totpPeriod.Seconds())), nil
+}
+
+// ValidateTOTP reports whether code is the TOTP code for secret now, or within skew periods of 30 seconds
+// before or after now, to allow for clock drift and slow typing. A skew of 1 is usual.
+// Callers should also refuse a code which was already used, to prevent replays.
+func ValidateTOTP(code, secret string, skew int) (bool, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return false, err
+	}
+
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != totpDigits {
+		return false, nil
+	}
+
+	counter := time.Now().Unix() / int64(totpPeriod.Seconds())
+	valid := false
+	for i := -int64(skew); i <= int64(skew); i++ {
+		// compare every candidate, so that the time taken doesn't tell which one matched
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, uint64(counter+i))), []byte(code)) == 1 {
+			valid = true
+		}
+	}
+	return valid, nil
+}
+
+// decodeTOTPSecret decodes a base32 secret, ignoring case, spaces and padding.
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "="))
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidTOTPSecret
+	}
+	return key, nil
+}
+
+// totpCode returns the code for key and counter, as computed by HOTP (RFC 4226).
+func totpCode(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
@@ -0,0 +1,83 @@
+package toolkit
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// the secret of the RFC 6238 test vectors, "12345678901234567890", base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+var totpTests = []struct {
+	unix int64
+	code string
+}{
+	{unix: 59, code: "287082"},
+	{unix: 1111111109, code: "081804"},
+	{unix: 1111111111, code: "050471"},
+	{unix: 1234567890, code: "005924"},
+	{unix: 2000000000, code: "279037"},
+}
+
+func TestGenerateTOTP(t *testing.T) {
+	for _, e := range totpTests {
+		code, err := GenerateTOTP(rfc6238Secret, time.Unix(e.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != e.code {
+			t.Errorf("at %d: expected %s, got %s", e.unix, e.code, code)
+		}
+	}
+
+	if _, err := GenerateTOTP("not base32!", time.Now()); !errors.Is(err, ErrInvalidTOTPSecret) {
+		t.Error("expected ErrInvalidTOTPSecret, got", err)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Error("wrong secret length", len(secret))
+	}
+
+	current, _ := GenerateTOTP(secret, time.Now())
+	previous, _ := GenerateTOTP(secret, time.Now().Add(-30*time.Second))
+	old, _ := GenerateTOTP(secret, time.Now().Add(-5*time.Minute))
+
+	if ok, _ := ValidateTOTP(current, secret, 0); !ok {
+		t.Error("the current code must be valid")
+	}
+	if ok, _ := ValidateTOTP(current[:3]+" "+current[3:], secret, 0); !ok {
+		t.Error("spaces must be ignored")
+	}
+	if ok, _ := ValidateTOTP(previous, secret, 1); !ok {
+		t.Error("the previous code must be valid with a skew of 1")
+	}
+	if ok, _ := ValidateTOTP(old, secret, 1); ok && old != current && old != previous {
+		t.Error("an old code must not be valid")
+	}
+	if ok, _ := ValidateTOTP("12345", secret, 1); ok {
+		t.Error("a short code must not be valid")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("JBSWY3DPEHPK3PXP", "Example Co", "alice@example.com")
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Example Co:alice@example.com" {
+		t.Error("wrong URI", uri)
+	}
+	if q := u.Query(); q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Example Co" || q.Get("digits") != "6" {
+		t.Error("wrong parameters", u.RawQuery)
+	}
+}
@@ -0,0 +1,79 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// JoinURL appends the path segments parts to base, escaping each of them, so that a part such as
+// "a/b?c" stays a single segment rather than changing the path or adding a query string.
+// The query string and fragment of base are kept. Empty parts are skipped, and "." and ".." parts,
+// which would climb out of the path of base, are refused.
+func JoinURL(base string, parts ...string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	escaped := u.EscapedPath()
+	for _, part := range parts {
+		if part == "." || part == ".." {
+			return "", fmt.Errorf("invalid path segment %q", part)
+		}
+		if part != "" {
+			escaped = strings.TrimRight(escaped, "/") + "/" + url.PathEscape(part)
+		}
+	}
+	if u.Path, err = url.PathUnescape(escaped); err != nil {
+		return "", err
+	}
+	u.RawPath = escaped
+	return u.String(), nil
+}
+
+// AddQueryParams returns rawURL with params added to its query string, replacing the values of keys it
+// already has.
+func AddQueryParams(rawURL string, params map[string]string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// RouteParamFunc returns the value of the path parameter name of a request, as captured by a router.
+// chi.URLParam can be used as one directly; for gorilla/mux, use MapRouteParams(mux.Vars).
+type RouteParamFunc func(r *http.Request, name string) string
+
+// MapRouteParams returns a RouteParamFunc for routers returning all the parameters of a request as a map,
+// such as mux.Vars from gorilla/mux.
+func MapRouteParams(vars func(r *http.Request) map[string]string) RouteParamFunc {
+	return func(r *http.Request, name string) string {
+		return vars(r)[name]
+	}
+}
+
+// PathValue returns the path parameter name of r matched by a pattern of http.ServeMux, on Go 1.22 and later,
+// and an empty string on older versions.
+func PathValue(r *http.Request, name string) string {
+	if pv, ok := any(r).(interface{ PathValue(string) string }); ok {
+		return pv.PathValue(name)
+	}
+	return ""
+}
+
+// RouteParam returns the path parameter name of r, with Tools.RouteParams, or PathValue if it isn't set.
+func (t *Tools) RouteParam(r *http.Request, name string) string {
+	if t.RouteParams != nil {
+		return t.RouteParams(r, name)
+	}
+	return PathValue(r, name)
+}
@@ -0,0 +1,77 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var joinURLTests = []struct {
+	name     string
+	base     string
+	parts    []string
+	expected string
+}{
+	{name: "simple", base: "https://api.example.com", parts: []string{"users", "42"}, expected: "https://api.example.com/users/42"},
+	{name: "trailing slash", base: "https://api.example.com/v1/", parts: []string{"users"}, expected: "https://api.example.com/v1/users"},
+	{name: "escaped part", base: "https://api.example.com", parts: []string{"files", "a/b?c d"}, expected: "https://api.example.com/files/a%2Fb%3Fc%20d"},
+	{name: "keeps query", base: "https://api.example.com/v1?key=1", parts: []string{"users"}, expected: "https://api.example.com/v1/users?key=1"},
+	{name: "empty parts", base: "https://api.example.com/v1", parts: []string{"", "users", ""}, expected: "https://api.example.com/v1/users"},
+	{name: "no parts", base: "https://api.example.com/v1/", expected: "https://api.example.com/v1/"},
+	{name: "relative", base: "/api", parts: []string{"users"}, expected: "/api/users"},
+}
+
+func TestJoinURL(t *testing.T) {
+	for _, e := range joinURLTests {
+		result, err := JoinURL(e.base, e.parts...)
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if result != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, result)
+		}
+	}
+
+	if _, err := JoinURL("http://[::1", "x"); err == nil {
+		t.Error("expected an error for an invalid base")
+	}
+	for _, part := range []string{".", ".."} {
+		if _, err := JoinURL("https://api.example.com/v1/users", part, "admin"); err == nil {
+			t.Errorf("expected an error for a %q part", part)
+		}
+	}
+	if result, err := JoinURL("https://api.example.com", "...", ".env"); err != nil || result != "https://api.example.com/.../.env" {
+		t.Errorf("expected other dotted parts to be kept, got %q, %v", result, err)
+	}
+}
+
+func TestAddQueryParams(t *testing.T) {
+	result, err := AddQueryParams("https://example.com/search?q=old&page=1#top", map[string]string{"q": "a&b", "limit": "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "https://example.com/search?limit=10&page=1&q=a%26b#top" {
+		t.Error("wrong URL", result)
+	}
+}
+
+func TestTools_RouteParam(t *testing.T) {
+	req := httptest.NewRequest("GET", "/users/42", nil)
+
+	var testTools Tools
+	testTools.RouteParams = MapRouteParams(func(r *http.Request) map[string]string {
+		return map[string]string{"id": "42"}
+	})
+	if id := testTools.RouteParam(req, "id"); id != "42" {
+		t.Error("wrong param", id)
+	}
+	if missing := testTools.RouteParam(req, "missing"); missing != "" {
+		t.Error("expected an empty string, got", missing)
+	}
+
+	testTools.RouteParams = func(r *http.Request, name string) string { return "from-router" }
+	if v := testTools.RouteParam(req, "id"); v != "from-router" {
+		t.Error("wrong param", v)
+	}
+}
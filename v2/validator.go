@@ -0,0 +1,165 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)+$`)
+
+// ValidationErrors holds the validation error messages for each field.
+// It implements the error interface, so it can be returned, and passed to ErrorJSON, like any other error.
+type ValidationErrors map[string][]string
+
+// Add adds an error message for field.
+func (e ValidationErrors) Add(field, message string) {
+	e[field] = append(e[field], message)
+}
+
+// Get returns the first error message for field, or an empty string if there is none.
+func (e ValidationErrors) Get(field string) string {
+	if messages := e[field]; len(messages) > 0 {
+		return messages[0]
+	}
+	return ""
+}
+
+// Error returns all error messages on a single line, sorted by field name.
+func (e ValidationErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, fmt.Sprintf("%s: %s", field, strings.Join(e[field], ", ")))
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// Validator is the type used to validate submitted form data.
+// Each rule adds an error message to Errors for every field which fails it.
+// Apart from Required, rules only look at fields which have a value, so optional fields may be left empty.
+type Validator struct {
+	Data   url.Values
+	Errors ValidationErrors
+}
+
+// NewValidator returns a Validator for the form data (query string and body) of r.
+func NewValidator(r *http.Request) *Validator {
+	// a body which can't be parsed simply leaves the form empty, which Required will report
+	_ = r.ParseForm()
+	return NewValidatorFromValues(r.Form)
+}
+
+// NewValidatorFromValues returns a Validator for data, e.g. values assembled from a JSON body read with ReadJSON.
+func NewValidatorFromValues(data url.Values) *Validator {
+	if data == nil {
+		data = url.Values{}
+	}
+	return &Validator{
+		Data:   data,
+		Errors: ValidationErrors{},
+	}
+}
+
+// Valid returns true if no rule has failed.
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// Err returns the validation errors as an error, or nil if no rule has failed.
+func (v *Validator) Err() error {
+	if v.Valid() {
+		return nil
+	}
+	return v.Errors
+}
+
+// Check adds message to field's errors if ok is false. It is the building block for custom rules.
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.Errors.Add(field, message)
+	}
+}
+
+// Custom runs the rule fn on the value of field, adding message to its errors if fn returns false.
+func (v *Validator) Custom(field string, fn func(value string) bool, message string) {
+	if value := v.Data.Get(field); value != "" {
+		v.Check(fn(value), field, message)
+	}
+}
+
+// Required checks that every one of fields has a non-blank value.
+func (v *Validator) Required(fields ...string) {
+	for _, field := range fields {
+		v.Check(strings.TrimSpace(v.Data.Get(field)) != "", field, "this field cannot be blank")
+	}
+}
+
+// MinLength checks that field is at least n characters long.
+func (v *Validator) MinLength(field string, n int) {
+	v.Custom(field, func(value string) bool {
+		return utf8.RuneCountInString(value) >= n
+	}, fmt.Sprintf("this field must be at least %d characters long", n))
+}
+
+// MaxLength checks that field is at most n characters long.
+func (v *Validator) MaxLength(field string, n int) {
+	v.Custom(field, func(value string) bool {
+		return utf8.RuneCountInString(value) <= n
+	}, fmt.Sprintf("this field must be at most %d characters long", n))
+}
+
+// IsEmail checks that field holds a syntactically valid email address.
+func (v *Validator) IsEmail(field string) {
+	v.Custom(field, IsValidEmail, "invalid email address")
+}
+
+// IsDeliverableEmail checks that field holds a valid email address whose domain can receive mail,
+// as looked up with CheckEmailMX. Addresses whose lookup fails are let through.
+func (v *Validator) IsDeliverableEmail(ctx context.Context, t *Tools, field string) {
+	value := v.Data.Get(field)
+	if value == "" {
+		return
+	}
+	if !IsValidEmail(value) {
+		v.Errors.Add(field, "invalid email address")
+		return
+	}
+	ok, err := t.CheckEmailMX(ctx, value)
+	v.Check(ok || err != nil, field, "this email address cannot receive mail")
+}
+
+// IsURL checks that field holds an absolute http or https URL.
+func (v *Validator) IsURL(field string) {
+	v.Custom(field, func(value string) bool {
+		u, err := url.ParseRequestURI(value)
+		return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	}, "invalid URL")
+}
+
+// Matches checks that field matches the regular expression re.
+func (v *Validator) Matches(field string, re *regexp.Regexp) {
+	v.Custom(field, re.MatchString, "this field has an invalid format")
+}
+
+// In checks that field holds one of the permitted values.
+func (v *Validator) In(field string, permitted ...string) {
+	v.Custom(field, func(value string) bool {
+		for _, p := range permitted {
+			if value == p {
+				return true
+			}
+		}
+		return false
+	}, fmt.Sprintf("this field must be one of: %s", strings.Join(permitted, ", ")))
+}
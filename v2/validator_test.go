@@ -0,0 +1,112 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var validatorTests = []struct {
+	name     string
+	value    string
+	rule     func(v *Validator)
+	expected bool
+}{
+	{name: "required present", value: "x", rule: func(v *Validator) { v.Required("field") }, expected: true},
+	{name: "required missing", value: "", rule: func(v *Validator) { v.Required("field") }, expected: false},
+	{name: "required blank", value: "   ", rule: func(v *Validator) { v.Required("field") }, expected: false},
+	{name: "min length ok", value: "abcd", rule: func(v *Validator) { v.MinLength("field", 4) }, expected: true},
+	{name: "min length short", value: "abc", rule: func(v *Validator) { v.MinLength("field", 4) }, expected: false},
+	{name: "min length counts runes", value: "日本語", rule: func(v *Validator) { v.MinLength("field", 3) }, expected: true},
+	{name: "min length empty is optional", value: "", rule: func(v *Validator) { v.MinLength("field", 4) }, expected: true},
+	{name: "max length ok", value: "abc", rule: func(v *Validator) { v.MaxLength("field", 3) }, expected: true},
+	{name: "max length long", value: "abcd", rule: func(v *Validator) { v.MaxLength("field", 3) }, expected: false},
+	{name: "email ok", value: "me@here.com", rule: func(v *Validator) { v.IsEmail("field") }, expected: true},
+	{name: "email bad", value: "me@here", rule: func(v *Validator) { v.IsEmail("field") }, expected: false},
+	{name: "email no at", value: "me.here.com", rule: func(v *Validator) { v.IsEmail("field") }, expected: false},
+	{name: "url ok", value: "https://example.com/path?q=1", rule: func(v *Validator) { v.IsURL("field") }, expected: true},
+	{name: "url bad scheme", value: "ftp://example.com", rule: func(v *Validator) { v.IsURL("field") }, expected: false},
+	{name: "url relative", value: "/path", rule: func(v *Validator) { v.IsURL("field") }, expected: false},
+	{name: "matches ok", value: "AB-123", rule: func(v *Validator) { v.Matches("field", regexp.MustCompile(`^[A-Z]{2}-\d+$`)) }, expected: true},
+	{name: "matches bad", value: "ab-123", rule: func(v *Validator) { v.Matches("field", regexp.MustCompile(`^[A-Z]{2}-\d+$`)) }, expected: false},
+	{name: "in ok", value: "red", rule: func(v *Validator) { v.In("field", "red", "green") }, expected: true},
+	{name: "in bad", value: "blue", rule: func(v *Validator) { v.In("field", "red", "green") }, expected: false},
+	{name: "custom ok", value: "even", rule: func(v *Validator) { v.Custom("field", func(s string) bool { return len(s)%2 == 0 }, "odd") }, expected: true},
+	{name: "custom bad", value: "odd", rule: func(v *Validator) { v.Custom("field", func(s string) bool { return len(s)%2 == 0 }, "odd") }, expected: false},
+}
+
+func TestValidator_Rules(t *testing.T) {
+	for _, test := range validatorTests {
+		v := NewValidatorFromValues(url.Values{"field": {test.value}})
+		test.rule(v)
+		if v.Valid() != test.expected {
+			t.Errorf("%s: expected valid to be %t but got %t (%v)", test.name, test.expected, v.Valid(), v.Errors)
+		}
+		if !test.expected && v.Errors.Get("field") == "" {
+			t.Errorf("%s: expected an error message for field", test.name)
+		}
+	}
+}
+
+func TestNewValidator(t *testing.T) {
+	form := url.Values{"name": {"Jack"}, "email": {"not an email"}}
+	req := httptest.NewRequest("POST", "/?page=2", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	v := NewValidator(req)
+	v.Required("name", "email", "page", "missing")
+	v.IsEmail("email")
+
+	if v.Valid() {
+		t.Fatal("expected form to be invalid")
+	}
+	if len(v.Errors) != 2 {
+		t.Errorf("expected errors for 2 fields, but got %v", v.Errors)
+	}
+	if v.Errors.Get("missing") == "" || v.Errors.Get("email") == "" {
+		t.Errorf("expected errors for missing and email, but got %v", v.Errors)
+	}
+	if v.Err() == nil {
+		t.Error("expected Err to return an error")
+	}
+}
+
+func TestTools_WriteValidationErrors(t *testing.T) {
+	var testTools Tools
+
+	v := NewValidatorFromValues(nil)
+	v.Required("name")
+
+	rr := httptest.NewRecorder()
+	if err := testTools.ErrorJSON(rr, v.Err()); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("wrong status code returned; expected 422, but got %d", rr.Code)
+	}
+
+	var payload struct {
+		Error   bool                `json:"error"`
+		Message string              `json:"message"`
+		Data    map[string][]string `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&payload); err != nil {
+		t.Fatal("received error when decoding JSON", err)
+	}
+	if !payload.Error || len(payload.Data["name"]) != 1 {
+		t.Errorf("wrong payload %+v", payload)
+	}
+
+	rr = httptest.NewRecorder()
+	if err := testTools.WriteValidationErrors(rr, v.Errors); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("wrong status code returned; expected 422, but got %d", rr.Code)
+	}
+}
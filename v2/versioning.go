@@ -0,0 +1,221 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const apiVersionContextKey contextKey = "apiVersion"
+
+// versionRegex matches versions, with an optional leading v, such as v2, 2 or 1.1.
+var versionRegex = regexp.MustCompile(`^[vV]?(\d+(?:\.\d+)?)$`)
+
+// VersionOptions is the type used to configure how the API version of a request is found.
+type VersionOptions struct {
+	// Header is the request header which may name the version. Defaults to API-Version.
+	Header string
+	// Vendor is the vendor tree of the media types of the Accept header which may name the version, as
+	// "example" in application/vnd.example.v2+json or application/vnd.example+json; version=2.
+	Vendor string
+	// Default is the version of requests which name none.
+	Default string
+}
+
+// VersionFromRequest returns the API version r asks for, without its leading v, such as "2". It is
+// found, in order, in the first segment of the path (/v2/users), the vendor media types of the Accept
+// header, and the version header, or is the default. Requests routed by a VersionRouter return the
+// version it routed them with.
+func VersionFromRequest(r *http.Request, opts ...VersionOptions) string {
+	if version, ok := r.Context().Value(apiVersionContextKey).(string); ok {
+		return version
+	}
+
+	var options VersionOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if version, _ := versionFromPath(r.URL.Path); version != "" {
+		return version
+	}
+	if version := versionFromAccept(r.Header.Values("Accept"), options.Vendor); version != "" {
+		return version
+	}
+
+	header := options.Header
+	if header == "" {
+		header = "API-Version"
+	}
+	if m := versionRegex.FindStringSubmatch(strings.TrimSpace(r.Header.Get(header))); m != nil {
+		return m[1]
+	}
+	return options.Default
+}
+
+// versionFromPath returns the version named by the first segment of p, and the rest of p.
+func versionFromPath(p string) (version, rest string) {
+	segment, rest, _ := strings.Cut(strings.TrimPrefix(p, "/"), "/")
+	if !strings.HasPrefix(segment, "v") && !strings.HasPrefix(segment, "V") {
+		return "", p
+	}
+	if m := versionRegex.FindStringSubmatch(segment); m != nil {
+		return m[1], "/" + rest
+	}
+	return "", p
+}
+
+// versionFromAccept returns the version named by the vendor media types of the Accept headers.
+func versionFromAccept(accept []string, vendor string) string {
+	if vendor == "" {
+		return ""
+	}
+	prefix := "application/vnd." + strings.ToLower(vendor)
+
+	for _, header := range accept {
+		for _, part := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(part)
+			if err != nil || !strings.HasPrefix(mediaType, prefix) {
+				continue
+			}
+
+			// application/vnd.example.v2+json, or application/vnd.example+json; version=2
+			rest := strings.TrimPrefix(mediaType, prefix)
+			if strings.HasPrefix(rest, ".") {
+				name, _, _ := strings.Cut(rest[1:], "+")
+				if m := versionRegex.FindStringSubmatch(name); m != nil {
+					return m[1]
+				}
+			}
+			if m := versionRegex.FindStringSubmatch(params["version"]); m != nil {
+				return m[1]
+			}
+		}
+	}
+	return ""
+}
+
+// Deprecation describes when an API version was deprecated, and when it stops working.
+type Deprecation struct {
+	// Date is when the version was deprecated. If zero, the version is simply marked as deprecated.
+	Date time.Time
+	// Sunset, if set, is when the version will stop working.
+	Sunset time.Time
+	// Link, if set, is the URL of documentation about the deprecation, such as a migration guide.
+	Link string
+}
+
+// VersionRouter is an http.Handler which passes requests to the handler of the API version they ask
+// for, as found by VersionFromRequest. Responses of deprecated versions carry the Deprecation
+// (RFC 9745) and Sunset (RFC 8594) headers.
+type VersionRouter struct {
+	options      VersionOptions
+	tools        *Tools
+	handlers     map[string]http.Handler
+	deprecations map[string]Deprecation
+}
+
+// NewVersionRouter returns an empty VersionRouter; register handlers with Handle.
+func (t *Tools) NewVersionRouter(opts ...VersionOptions) *VersionRouter {
+	var options VersionOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	return &VersionRouter{
+		options:      options,
+		tools:        t,
+		handlers:     make(map[string]http.Handler),
+		deprecations: make(map[string]Deprecation),
+	}
+}
+
+// normalizeVersion removes the leading v of version.
+func normalizeVersion(version string) string {
+	if m := versionRegex.FindStringSubmatch(version); m != nil {
+		return m[1]
+	}
+	return version
+}
+
+// Handle registers handler for version, such as "2" or "v2".
+func (vr *VersionRouter) Handle(version string, handler http.Handler) {
+	vr.handlers[normalizeVersion(version)] = handler
+}
+
+// HandleFunc registers the handler function fn for version.
+func (vr *VersionRouter) HandleFunc(version string, fn func(http.ResponseWriter, *http.Request)) {
+	vr.Handle(version, http.HandlerFunc(fn))
+}
+
+// Deprecate marks version as deprecated.
+func (vr *VersionRouter) Deprecate(version string, d Deprecation) {
+	vr.deprecations[normalizeVersion(version)] = d
+}
+
+// ServeHTTP implements http.Handler. When the version is in the path, it is removed from the path the
+// handler sees, as http.StripPrefix does. Requests for versions with no handler are answered with a
+// JSON error and a 400 status code, or 410 if their version's sunset has passed.
+func (vr *VersionRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	version := VersionFromRequest(r, vr.options)
+
+	header := vr.options.Header
+	if header == "" {
+		header = "API-Version"
+	}
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", header)
+
+	d, deprecated := vr.deprecations[version]
+	if deprecated {
+		if d.Date.IsZero() {
+			w.Header().Set("Deprecation", "true")
+		} else {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(d.Date.Unix(), 10))
+		}
+		if !d.Sunset.IsZero() {
+			w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.Link != "" {
+			w.Header().Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+		}
+	}
+
+	handler, ok := vr.handlers[version]
+	if !ok || (deprecated && !d.Sunset.IsZero() && time.Now().After(d.Sunset)) {
+		status := http.StatusBadRequest
+		err := fmt.Errorf("unsupported API version %q; supported versions are %s", version, strings.Join(vr.versions(), ", "))
+		if ok {
+			status = http.StatusGone
+			err = fmt.Errorf("API version %q is no longer available", version)
+		}
+		if version == "" {
+			err = errors.New("an API version is required; supported versions are " + strings.Join(vr.versions(), ", "))
+		}
+		_ = vr.tools.ErrorJSON(w, err, status)
+		return
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), apiVersionContextKey, version))
+	if pathVersion, rest := versionFromPath(r.URL.Path); pathVersion == version {
+		u := *r.URL
+		u.Path, u.RawPath = rest, ""
+		r.URL = &u
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// versions returns the versions with a handler, sorted.
+func (vr *VersionRouter) versions() []string {
+	versions := make([]string, 0, len(vr.handlers))
+	for version := range vr.handlers {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
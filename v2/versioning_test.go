@@ -0,0 +1,90 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var versionFromRequestTests = []struct {
+	name     string
+	path     string
+	headers  map[string]string
+	expected string
+}{
+	{name: "path", path: "/v2/users", expected: "2"},
+	{name: "path minor", path: "/V1.1/users", expected: "1.1"},
+	{name: "path not a version", path: "/videos/1", expected: "1"},
+	{name: "accept vendor tree", path: "/users", headers: map[string]string{"Accept": "text/html, application/vnd.example.v3+json"}, expected: "3"},
+	{name: "accept version parameter", path: "/users", headers: map[string]string{"Accept": "application/vnd.example+json; version=4"}, expected: "4"},
+	{name: "accept other vendor", path: "/users", headers: map[string]string{"Accept": "application/vnd.other.v3+json"}, expected: "1"},
+	{name: "header", path: "/users", headers: map[string]string{"API-Version": "v5"}, expected: "5"},
+	{name: "invalid header", path: "/users", headers: map[string]string{"API-Version": "latest"}, expected: "1"},
+	{name: "path wins", path: "/v2/users", headers: map[string]string{"API-Version": "5"}, expected: "2"},
+	{name: "default", path: "/users", expected: "1"},
+}
+
+func TestVersionFromRequest(t *testing.T) {
+	for _, e := range versionFromRequestTests {
+		req := httptest.NewRequest("GET", e.path, nil)
+		for k, v := range e.headers {
+			req.Header.Set(k, v)
+		}
+		if version := VersionFromRequest(req, VersionOptions{Vendor: "example", Default: "1"}); version != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, version)
+		}
+	}
+}
+
+func TestVersionRouter(t *testing.T) {
+	var testTools Tools
+	router := testTools.NewVersionRouter(VersionOptions{Default: "2"})
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(VersionFromRequest(r) + " " + r.URL.Path))
+	}
+	router.HandleFunc("v1", handler)
+	router.HandleFunc("2", handler)
+	router.HandleFunc("3", handler)
+
+	deprecated := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Now().Add(24 * time.Hour)
+	router.Deprecate("1", Deprecation{Date: deprecated, Sunset: sunset, Link: "https://example.com/migrate"})
+	router.Deprecate("3", Deprecation{Sunset: time.Now().Add(-time.Hour)})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/users/7", nil))
+	if rr.Body.String() != "1 /users/7" {
+		t.Error("wrong response", rr.Body.String())
+	}
+	if rr.Header().Get("Deprecation") != "@1704067200" || rr.Header().Get("Sunset") != sunset.UTC().Format(http.TimeFormat) ||
+		rr.Header().Get("Link") != `<https://example.com/migrate>; rel="deprecation"` {
+		t.Error("wrong deprecation headers", rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/users/7", nil))
+	if rr.Body.String() != "2 /users/7" || rr.Header().Get("Deprecation") != "" {
+		t.Error("expected the default version, without deprecation headers", rr.Body.String(), rr.Header())
+	}
+	if vary := rr.Header().Values("Vary"); len(vary) != 2 {
+		t.Error("expected Vary headers", vary)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v3/users", nil))
+	if rr.Code != http.StatusGone || rr.Header().Get("Deprecation") != "true" {
+		t.Error("expected a 410 after the sunset", rr.Code, rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v9/users", nil))
+	var payload JSONResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &payload)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(payload.Message, "1, 2, 3") {
+		t.Error("expected a 400 listing the supported versions", rr.Code, payload.Message)
+	}
+}
@@ -0,0 +1,123 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Watcher polls a JSON endpoint, such as remote configuration, and calls a function whenever its content
+// changes. The endpoint is fetched with GetJSONFromRemote, so that requests carry If-None-Match and
+// If-Modified-Since when the endpoint sends an ETag or Last-Modified header, and an unchanged document
+// isn't downloaded again. Note that a document is only fetched again once it is stale, according to its
+// Cache-Control or Expires header, however often it is polled.
+type Watcher struct {
+	uri       string
+	interval  time.Duration
+	client    []*http.Client
+	valueType reflect.Type
+	onChange  func(value any)
+	tools     *Tools
+
+	mu    sync.RWMutex
+	body  []byte
+	value any
+}
+
+// NewWatcher returns a Watcher polling uri every interval, once started, and decoding the document into
+// a new value of the type of target, such as Config{}, which onChange receives as a pointer, such as a
+// *Config, whenever the document changes. The final parameter, client, is optional, as for
+// GetJSONFromRemote.
+func (t *Tools) NewWatcher(uri string, interval time.Duration, target any, onChange func(value any), client ...*http.Client) *Watcher {
+	valueType := reflect.TypeOf(target)
+	if valueType == nil {
+		valueType = reflect.TypeOf(json.RawMessage{})
+	}
+	if valueType.Kind() == reflect.Pointer {
+		valueType = valueType.Elem()
+	}
+	return &Watcher{
+		uri:       uri,
+		interval:  interval,
+		client:    client,
+		valueType: valueType,
+		onChange:  onChange,
+		tools:     t,
+	}
+}
+
+// Start checks the document, then goes on checking it every interval in the background until ctx is
+// done. The error of the first check, if any, is returned; later errors are logged, the last value
+// being kept. An interval which is not positive returns an error, without checking anything.
+func (w *Watcher) Start(ctx context.Context) error {
+	if w.interval <= 0 {
+		return fmt.Errorf("invalid watch interval %v", w.interval)
+	}
+	_, err := w.Check()
+
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := w.Check(); err != nil {
+					w.tools.logger().Warn("watched document not refreshed", "uri", w.uri, "err", err)
+				}
+			}
+		}
+	}()
+
+	return err
+}
+
+// Check fetches the document once, and reports whether it changed, in which case onChange has been
+// called with its new value. The first successful check always counts as a change.
+func (w *Watcher) Check() (bool, error) {
+	var body json.RawMessage
+	status, err := w.tools.GetJSONFromRemote(w.uri, &body, w.client...)
+	if err != nil {
+		return false, err
+	}
+	if status < 200 || status > 299 {
+		return false, fmt.Errorf("watched endpoint returned status %d", status)
+	}
+
+	w.mu.RLock()
+	unchanged := w.value != nil && bytes.Equal(w.body, body)
+	w.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	value := reflect.New(w.valueType).Interface()
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, value); err != nil {
+			return false, fmt.Errorf("invalid watched document: %w", err)
+		}
+	}
+
+	w.mu.Lock()
+	w.body, w.value = body, value
+	w.mu.Unlock()
+
+	if w.onChange != nil {
+		w.onChange(value)
+	}
+	return true, nil
+}
+
+// Value returns the last value of the document, as given to onChange, or nil before the first
+// successful check.
+func (w *Watcher) Value() any {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.value
+}
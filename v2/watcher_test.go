@@ -0,0 +1,70 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	type config struct {
+		Version int `json:"version"`
+	}
+
+	var version, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"v%d"`, version.Load())
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"version": %d}`, version.Load())
+	}))
+	defer server.Close()
+
+	var testTools Tools
+	changes := make(chan int, 10)
+	watcher := testTools.NewWatcher(server.URL, time.Hour, config{}, func(value any) {
+		changes <- value.(*config).Version
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := watcher.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v := <-changes; v != 0 {
+		t.Errorf("expected version 0, got %d", v)
+	}
+
+	if changed, err := watcher.Check(); err != nil || changed {
+		t.Errorf("expected no change, got %v (%v)", changed, err)
+	}
+	if notModified.Load() != 1 {
+		t.Error("expected the document to be revalidated with If-None-Match")
+	}
+
+	version.Store(1)
+	if changed, err := watcher.Check(); err != nil || !changed {
+		t.Errorf("expected a change, got %v (%v)", changed, err)
+	}
+	if v := <-changes; v != 1 || watcher.Value().(*config).Version != 1 {
+		t.Errorf("expected version 1, got %d", v)
+	}
+
+	failing := testTools.NewWatcher("http://127.0.0.1:1/config", time.Hour, config{}, nil)
+	if err := failing.Start(ctx); err == nil || failing.Value() != nil {
+		t.Error("expected the error of the first check")
+	}
+	if err := testTools.NewWatcher("http://127.0.0.1:1/config", 0, config{}, nil).Start(ctx); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+}
@@ -0,0 +1,435 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidWebhookSignature is returned by VerifyWebhookSignature for requests which weren't signed
+	// with any of the secrets.
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	// ErrWebhookExpired is returned by VerifyWebhookSignature for requests signed too long ago, which
+	// may be replayed.
+	ErrWebhookExpired = errors.New("webhook timestamp outside the tolerance")
+)
+
+// the headers of webhook requests
+const (
+	webhookIDHeader        = "Webhook-Id"
+	webhookSignatureHeader = "Webhook-Signature"
+)
+
+// WebhookEvent is the body of the requests sent by a WebhookDispatcher.
+type WebhookEvent struct {
+	// ID is the same for every attempt at delivering the event, so that receivers can ignore duplicates.
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Created time.Time       `json:"created"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// WebhookEndpoint is a URL events are delivered to.
+type WebhookEndpoint struct {
+	URL string
+	// Secret is the key requests to the endpoint are signed with.
+	Secret string
+	// Events are the types of events delivered to the endpoint. Empty means all of them.
+	Events []string
+}
+
+// WebhookAttempt is an attempt at delivering an event to an endpoint.
+type WebhookAttempt struct {
+	EventID  string
+	Event    string
+	URL      string
+	Attempt  int
+	Time     time.Time
+	Duration time.Duration
+	// Status is the status code of the response, or 0 if none was received.
+	Status int
+	// Error is why the attempt failed, if it did.
+	Error string
+}
+
+// WebhookDispatcher delivers events to webhook endpoints, as JSON posted with PushJSONToRemote, and
+// signed with the secret of each endpoint. The Webhook-Signature header holds the time of the attempt and
+// an HMAC-SHA256 of that time and the body, as t=1700000000,v1=<hex>, which VerifyWebhookSignature checks.
+type WebhookDispatcher struct {
+	// Retry is how failed deliveries are retried, on top of Tools.RemoteRetry. Requests answered with a
+	// 4xx status code other than 408 and 429 aren't retried. Defaults to 5 attempts, 1 second apart at
+	// first, then up to 5 minutes apart.
+	Retry RetryPolicy
+	// Client is the client requests are sent with. Defaults to one with a 30 second timeout, which
+	// follows Tools.OutboundPolicy, if set, to the addresses it connects to and the redirects it follows.
+	Client *http.Client
+	// OnAttempt, if set, is called after every attempt, such as to store the history of deliveries.
+	OnAttempt func(attempt WebhookAttempt)
+	// HistorySize is the number of attempts kept for Attempts. Defaults to 100.
+	HistorySize int
+
+	tools *Tools
+
+	mu        sync.Mutex
+	endpoints []WebhookEndpoint
+	history   []WebhookAttempt
+}
+
+// NewWebhookDispatcher returns a WebhookDispatcher delivering events to endpoints.
+func (t *Tools) NewWebhookDispatcher(endpoints ...WebhookEndpoint) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		Retry:     RetryPolicy{MaxAttempts: 5, InitialInterval: time.Second, MaxInterval: 5 * time.Minute, Jitter: 0.2},
+		tools:     t,
+		endpoints: endpoints,
+	}
+}
+
+// AddEndpoint adds an endpoint events are delivered to.
+func (d *WebhookDispatcher) AddEndpoint(endpoint WebhookEndpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.endpoints = append(d.endpoints, endpoint)
+}
+
+// Attempts returns the latest delivery attempts, oldest first.
+func (d *WebhookDispatcher) Attempts() []WebhookAttempt {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]WebhookAttempt(nil), d.history...)
+}
+
+// Dispatch delivers the event of the given type, with data, to the endpoints subscribed to it, at the same
+// time, retrying failed deliveries, and returns once they are all done, or ctx is done. The error, if any,
+// lists the endpoints the event couldn't be delivered to.
+func (d *WebhookDispatcher) Dispatch(ctx context.Context, event string, data any) (*WebhookEvent, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	webhookEvent := &WebhookEvent{ID: NewULID(), Type: event, Created: time.Now().UTC(), Data: payload}
+
+	d.mu.Lock()
+	var endpoints []WebhookEndpoint
+	for _, endpoint := range d.endpoints {
+		if endpoint.subscribed(event) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	d.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(endpoints))
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint WebhookEndpoint) {
+			defer wg.Done()
+			errs[i] = d.deliver(ctx, webhookEvent, endpoint)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", endpoints[i].URL, err))
+		}
+	}
+	if len(failed) > 0 {
+		return webhookEvent, fmt.Errorf("webhook delivery failed: %s", strings.Join(failed, "; "))
+	}
+	return webhookEvent, nil
+}
+
+// subscribed reports whether the endpoint receives events of type event.
+func (e WebhookEndpoint) subscribed(event string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, subscribed := range e.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver delivers event to endpoint, with retries.
+func (d *WebhookDispatcher) deliver(ctx context.Context, event *WebhookEvent, endpoint WebhookEndpoint) error {
+	client := d.Client
+	if client == nil {
+		// the URLs of endpoints are often given by users, so the policy is checked as requests are sent
+		client = d.tools.timeoutClient(30 * time.Second)
+	}
+	signed := *client
+	signed.Transport = &webhookSigner{secret: endpoint.Secret, id: event.ID, next: client.Transport}
+
+	attempt := 0
+	return Retry(ctx, d.Retry, func() error {
+		attempt++
+		start := time.Now()
+		_, status, err := d.tools.pushJSONToRemote(ctx, endpoint.URL, event, []*http.Client{&signed})
+		if err == nil && (status < 200 || status > 299) {
+			err = fmt.Errorf("status %d", status)
+			if status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests {
+				err = Permanent(err)
+			}
+		}
+
+		record := WebhookAttempt{
+			EventID: event.ID, Event: event.Type, URL: endpoint.URL, Attempt: attempt,
+			Time: start, Duration: time.Since(start), Status: status,
+		}
+		if err != nil {
+			record.Error = err.Error()
+			d.tools.logger().Warn("webhook delivery failed", "url", endpoint.URL, "event", event.Type, "attempt", attempt, "err", err)
+		}
+		d.record(record)
+		return err
+	})
+}
+
+// record adds attempt to the history, and passes it to OnAttempt.
+func (d *WebhookDispatcher) record(attempt WebhookAttempt) {
+	size := d.HistorySize
+	if size <= 0 {
+		size = 100
+	}
+
+	d.mu.Lock()
+	d.history = append(d.history, attempt)
+	if len(d.history) > size {
+		d.history = append(d.history[:0], d.history[len(d.history)-size:]...)
+	}
+	d.mu.Unlock()
+
+	if d.OnAttempt != nil {
+		d.OnAttempt(attempt)
+	}
+}
+
+// webhookSigner is an http.RoundTripper signing the requests it sends with secret.
+type webhookSigner struct {
+	secret string
+	id     string
+	next   http.RoundTripper
+}
+
+func (s *webhookSigner) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+	}
+
+	// a RoundTripper must not modify the request it is given
+	r = r.Clone(r.Context())
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.Header.Set(webhookIDHeader, s.id)
+	r.Header.Set(webhookSignatureHeader, SignWebhook(s.secret, time.Now(), body))
+
+	next := s.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(r)
+}
+
+// SignWebhook returns the Webhook-Signature header of a request with body, signed at t with secret.
+func SignWebhook(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + webhookSignature(secret, timestamp, body)
+}
+
+// webhookSignature returns the hex encoded HMAC-SHA256 of timestamp and body, with secret.
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks header, the Webhook-Signature header of a request with body, as sent by a
+// WebhookDispatcher, against secrets, several of which may be given while a secret is being rotated. It
+// returns ErrWebhookExpired if the request was signed more than tolerance ago, or in the future, so that
+// a captured request can't be replayed later; zero means 5 minutes.
+func VerifyWebhookSignature(header string, body []byte, tolerance time.Duration, secrets ...string) error {
+	if tolerance <= 0 {
+		tolerance = 5 * time.Minute
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidWebhookSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrWebhookExpired
+	}
+
+	for _, secret := range secrets {
+		expected := webhookSignature(secret, timestamp, body)
+		for _, signature := range signatures {
+			if hmac.Equal([]byte(expected), []byte(signature)) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidWebhookSignature
+}
+
+// WebhookReceiverOptions is the type used to configure a WebhookReceiver.
+type WebhookReceiverOptions struct {
+	// Secrets are the secrets requests may be signed with; several may be given while one is rotated.
+	Secrets []string
+	// Tolerance is how old a signature may be, as for VerifyWebhookSignature. Defaults to 5 minutes.
+	Tolerance time.Duration
+	// MaxBodySize is the largest request body, in bytes. Defaults to 1MB.
+	MaxBodySize int64
+	// DedupeTTL is how long the IDs of the events handled are kept in Tools.Cache, so that an event
+	// delivered again, such as after a timeout, is only handled once. Defaults to 24 hours.
+	DedupeTTL time.Duration
+}
+
+// WebhookHandler handles an event received by a WebhookReceiver, whose data has been decoded into a
+// pointer to a new value of the type given to WebhookReceiver.On.
+type WebhookHandler func(ctx context.Context, event *WebhookEvent, data any) error
+
+// webhookRoute is a handler registered with WebhookReceiver.On, with the type its data is decoded into.
+type webhookRoute struct {
+	dataType reflect.Type
+	handler  WebhookHandler
+}
+
+// WebhookReceiver is an http.Handler receiving the webhooks sent by a WebhookDispatcher: it checks their
+// size and signature, refusing replayed requests, decodes the data of each event for its handler, and
+// skips events it has already handled.
+//
+// Events are acknowledged with a 204 once handled, or if no handler is registered for their type; errors
+// returned by handlers are logged, and answered with a 500, so that the sender tries again later.
+type WebhookReceiver struct {
+	opts     WebhookReceiverOptions
+	tools    *Tools
+	mu       sync.RWMutex
+	handlers map[string]webhookRoute
+}
+
+// NewWebhookReceiver returns a WebhookReceiver without any handlers.
+func (t *Tools) NewWebhookReceiver(opts WebhookReceiverOptions) *WebhookReceiver {
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1024 * 1024
+	}
+	if opts.DedupeTTL <= 0 {
+		opts.DedupeTTL = 24 * time.Hour
+	}
+	return &WebhookReceiver{opts: opts, tools: t, handlers: make(map[string]webhookRoute)}
+}
+
+// On registers handler for the events of type event, whose data is decoded into a new value of the type
+// of data, such as OrderPaid{}, which handler receives as a pointer, such as a *OrderPaid.
+func (wr *WebhookReceiver) On(event string, data any, handler WebhookHandler) {
+	dataType := reflect.TypeOf(data)
+	if dataType == nil {
+		dataType = reflect.TypeOf(json.RawMessage{})
+	}
+	if dataType.Kind() == reflect.Pointer {
+		dataType = dataType.Elem()
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	wr.handlers[event] = webhookRoute{dataType: dataType, handler: handler}
+}
+
+// ServeHTTP implements http.Handler.
+func (wr *WebhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t := wr.tools
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		_ = t.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, wr.opts.MaxBodySize))
+	if err != nil {
+		if tooLarge := asBodyTooLarge(err); tooLarge != nil {
+			err = tooLarge
+		}
+		_ = t.ErrorJSON(w, err)
+		return
+	}
+
+	if err = VerifyWebhookSignature(r.Header.Get(webhookSignatureHeader), body, wr.opts.Tolerance, wr.opts.Secrets...); err != nil {
+		t.logger().Warn("webhook refused", "path", r.URL.Path, "err", err)
+		_ = t.ErrorJSON(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	var event WebhookEvent
+	if err = json.Unmarshal(body, &event); err != nil || event.ID == "" || event.Type == "" {
+		_ = t.ErrorJSON(w, errors.New("invalid webhook event"))
+		return
+	}
+
+	ctx := r.Context()
+	key := "webhook:" + event.ID
+	if _, err = t.cache().Get(ctx, key); err == nil {
+		t.logger().Debug("duplicate webhook ignored", "id", event.ID, "event", event.Type)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	wr.mu.RLock()
+	route, ok := wr.handlers[event.Type]
+	wr.mu.RUnlock()
+	if !ok {
+		t.logger().Debug("unhandled webhook ignored", "id", event.ID, "event", event.Type)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	data := reflect.New(route.dataType)
+	if len(event.Data) > 0 {
+		if err = json.Unmarshal(event.Data, data.Interface()); err != nil {
+			_ = t.ErrorJSON(w, fmt.Errorf("invalid data for %s event: %v", event.Type, err))
+			return
+		}
+	}
+
+	if err = route.handler(ctx, &event, data.Interface()); err != nil {
+		t.logger().Error("webhook handler failed", "id", event.ID, "event", event.Type, "err", err)
+		_ = t.ErrorJSON(w, errors.New("the webhook could not be processed"), http.StatusInternalServerError)
+		return
+	}
+
+	if err = t.cache().Set(ctx, key, []byte{1}, wr.opts.DedupeTTL); err != nil {
+		t.logger().Warn("cache error", "key", key, "err", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
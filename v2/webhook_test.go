@@ -0,0 +1,230 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookDispatcher(t *testing.T) {
+	var calls atomic.Int32
+	var received WebhookEvent
+	var ids []string
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := VerifyWebhookSignature(r.Header.Get("Webhook-Signature"), body, 0, "good secret"); err != nil {
+			t.Error(err)
+		}
+		ids = append(ids, r.Header.Get("Webhook-Id"))
+		// the first two attempts fail
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.Unmarshal(body, &received)
+	}))
+	defer good.Close()
+
+	var rejected atomic.Int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rejected.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer bad.Close()
+
+	var unsubscribed atomic.Int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		unsubscribed.Add(1)
+	}))
+	defer other.Close()
+
+	var testTools Tools
+	dispatcher := testTools.NewWebhookDispatcher(
+		WebhookEndpoint{URL: good.URL, Secret: "good secret"},
+		WebhookEndpoint{URL: bad.URL, Secret: "bad secret", Events: []string{"order.paid"}},
+	)
+	dispatcher.AddEndpoint(WebhookEndpoint{URL: other.URL, Events: []string{"order.refunded"}})
+	dispatcher.Retry.InitialInterval = time.Millisecond
+	var recorded atomic.Int32
+	dispatcher.OnAttempt = func(attempt WebhookAttempt) { recorded.Add(1) }
+
+	event, err := dispatcher.Dispatch(context.Background(), "order.paid", map[string]any{"order": 42})
+	if err == nil || !strings.Contains(err.Error(), bad.URL) || strings.Contains(err.Error(), good.URL) {
+		t.Errorf("expected the delivery to %s to fail, got %v", bad.URL, err)
+	}
+
+	if received.ID != event.ID || received.Type != "order.paid" || string(received.Data) != `{"order":42}` {
+		t.Errorf("wrong event received %+v", received)
+	}
+	if len(ids) != 3 || ids[0] != event.ID || ids[2] != event.ID {
+		t.Errorf("expected every attempt to carry the event ID, got %v", ids)
+	}
+	if rejected.Load() != 1 {
+		t.Errorf("expected a 400 not to be retried, got %d attempts", rejected.Load())
+	}
+	if unsubscribed.Load() != 0 {
+		t.Error("expected the event not to be sent to an endpoint not subscribed to it")
+	}
+
+	attempts := dispatcher.Attempts()
+	if len(attempts) != 4 || recorded.Load() != 4 {
+		t.Fatalf("expected 4 attempts, got %d, %d recorded", len(attempts), recorded.Load())
+	}
+	last := attempts[len(attempts)-1]
+	if last.URL != good.URL || last.Attempt != 3 || last.Status != http.StatusOK || last.Error != "" {
+		t.Errorf("wrong last attempt %+v", last)
+	}
+}
+
+func TestWebhookDispatcher_Outbound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "http://localhost/", http.StatusFound)
+		case "/slow":
+			// the server only notices the client going away once the body is read
+			_, _ = io.Copy(io.Discard, r.Body)
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	// the server's address is allowed, but not the name it redirects to
+	testTools := Tools{ErrorLog: discardLog, OutboundPolicy: &OutboundPolicy{AllowedCIDRs: []string{"127.0.0.1"}, AllowedHosts: []string{"127.0.0.1"}}}
+	dispatcher := testTools.NewWebhookDispatcher(WebhookEndpoint{URL: server.URL + "/redirect", Secret: "secret"})
+	dispatcher.Retry.MaxAttempts = 1
+	if _, err := dispatcher.Dispatch(context.Background(), "order.paid", nil); err == nil || !strings.Contains(err.Error(), ErrURLNotAllowed.Error()) {
+		t.Error("expected the redirect to be refused, got", err)
+	}
+
+	// the context of Dispatch ends attempts under way, and the retries of Tools.RemoteRetry
+	testTools.RemoteRetry = &RetryPolicy{MaxAttempts: 5, InitialInterval: time.Second}
+	dispatcher = testTools.NewWebhookDispatcher(WebhookEndpoint{URL: server.URL + "/slow", Secret: "secret"})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := dispatcher.Dispatch(ctx, "order.paid", nil); err == nil {
+		t.Error("expected the delivery to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the delivery to end with its context, took %v", elapsed)
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		header  string
+		secrets []string
+		err     error
+	}{
+		{name: "valid", header: SignWebhook("secret", now, body), secrets: []string{"secret"}},
+		{name: "rotated", header: SignWebhook("new", now, body), secrets: []string{"old", "new"}},
+		{name: "wrong secret", header: SignWebhook("other", now, body), secrets: []string{"secret"}, err: ErrInvalidWebhookSignature},
+		{name: "expired", header: SignWebhook("secret", now.Add(-time.Hour), body), secrets: []string{"secret"}, err: ErrWebhookExpired},
+		{name: "future", header: SignWebhook("secret", now.Add(time.Hour), body), secrets: []string{"secret"}, err: ErrWebhookExpired},
+		{name: "missing", header: "", secrets: []string{"secret"}, err: ErrInvalidWebhookSignature},
+		{name: "no signature", header: "t=" + SignWebhook("secret", now, body)[2:12], secrets: []string{"secret"}, err: ErrInvalidWebhookSignature},
+	}
+	for _, test := range tests {
+		if err := VerifyWebhookSignature(test.header, body, 0, test.secrets...); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+
+	if err := VerifyWebhookSignature(SignWebhook("secret", now, body), []byte(`{"id":"2"}`), 0, "secret"); err == nil {
+		t.Error("expected an error for a modified body")
+	}
+}
+
+func TestWebhookReceiver(t *testing.T) {
+	type orderPaid struct {
+		Order int `json:"order"`
+	}
+
+	logger := &recordingLogger{}
+	testTools := Tools{Logger: logger}
+	receiver := testTools.NewWebhookReceiver(WebhookReceiverOptions{Secrets: []string{"secret"}, MaxBodySize: 1024})
+
+	var handled []int
+	var fail bool
+	receiver.On("order.paid", orderPaid{}, func(ctx context.Context, event *WebhookEvent, data any) error {
+		if fail {
+			return errors.New("database unavailable")
+		}
+		handled = append(handled, data.(*orderPaid).Order)
+		return nil
+	})
+
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	dispatcher := testTools.NewWebhookDispatcher(WebhookEndpoint{URL: server.URL, Secret: "secret"})
+	dispatcher.Retry.MaxAttempts = 1
+	if _, err := dispatcher.Dispatch(context.Background(), "order.paid", orderPaid{Order: 42}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dispatcher.Dispatch(context.Background(), "order.shipped", orderPaid{Order: 43}); err != nil {
+		t.Error("expected an unhandled event to be acknowledged, got", err)
+	}
+	if !logger.contains("DEBUG unhandled webhook ignored") {
+		t.Error("expected the unhandled event to be logged")
+	}
+
+	// the same event delivered again is only handled once
+	body := []byte(`{"id":"01","type":"order.paid","data":{"order":7}}`)
+	send := func(body []byte, secret string) int {
+		request := httptest.NewRequest("POST", "/", strings.NewReader(string(body)))
+		request.Header.Set("Webhook-Signature", SignWebhook(secret, time.Now(), body))
+		rr := httptest.NewRecorder()
+		receiver.ServeHTTP(rr, request)
+		return rr.Code
+	}
+
+	fail = true
+	if code := send(body, "secret"); code != http.StatusInternalServerError {
+		t.Errorf("expected 500 when the handler fails, got %d", code)
+	}
+	fail = false
+	for i := 0; i < 2; i++ {
+		if code := send(body, "secret"); code != http.StatusNoContent {
+			t.Errorf("expected 204, got %d", code)
+		}
+	}
+	if len(handled) != 2 || handled[0] != 42 || handled[1] != 7 {
+		t.Errorf("wrong events handled %v", handled)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		secret   string
+		expected int
+	}{
+		{name: "bad signature", body: `{"id":"02","type":"order.paid"}`, secret: "other", expected: http.StatusUnauthorized},
+		{name: "too large", body: `{"id":"03","type":"order.paid","data":"` + strings.Repeat("x", 1024) + `"}`, secret: "secret", expected: http.StatusRequestEntityTooLarge},
+		{name: "not an event", body: `[]`, secret: "secret", expected: http.StatusBadRequest},
+		{name: "invalid data", body: `{"id":"04","type":"order.paid","data":{"order":"seven"}}`, secret: "secret", expected: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if code := send([]byte(test.body), test.secret); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.name, test.expected, code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	receiver.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rr.Code)
+	}
+}
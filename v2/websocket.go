@@ -0,0 +1,429 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The WebSocket message types.
+const (
+	WebSocketText   = 1
+	WebSocketBinary = 2
+
+	wsContinuation = 0
+	wsClose        = 8
+	wsPing         = 9
+	wsPong         = 10
+)
+
+// websocketGUID is the magic value used to compute Sec-WebSocket-Accept (RFC 6455, section 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// ErrWebSocketClosed is returned when reading from a WebSocket connection which the other side has closed.
+	ErrWebSocketClosed = errors.New("websocket connection closed")
+	// ErrWebSocketMessageTooLarge is returned when a received message exceeds WebSocketOptions.MaxMessageSize.
+	ErrWebSocketMessageTooLarge = errors.New("websocket message too large")
+	// errWebSocketProtocol is returned when the client breaks the WebSocket protocol.
+	errWebSocketProtocol = errors.New("websocket protocol error")
+)
+
+// WebSocketOptions is the type used to configure UpgradeWebSocket.
+type WebSocketOptions struct {
+	// PingInterval is how often pings are sent to keep the connection alive. A connection from which
+	// nothing has been received for two intervals is considered dead. Defaults to 30 seconds.
+	PingInterval time.Duration
+	// MaxMessageSize is the largest message, in bytes, which will be read. Defaults to 1MB.
+	MaxMessageSize int64
+	// CheckOrigin reports whether a request's Origin is permitted. By default, only requests without
+	// an Origin header, or from the same host, are permitted, to prevent cross-site WebSocket hijacking.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// WebSocketConn is a server side WebSocket connection. Reads must come from a single goroutine,
+// but writes may be made from several.
+type WebSocketConn struct {
+	conn           net.Conn
+	br             *bufio.Reader
+	tools          *Tools
+	maxMessageSize int64
+	pingInterval   time.Duration
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// UpgradeWebSocket upgrades the HTTP connection of r to the WebSocket protocol. If the request isn't
+// a valid WebSocket handshake, a JSON error is sent and an error returned. The connection is kept alive
+// with pings until it is closed.
+func (t *Tools) UpgradeWebSocket(w http.ResponseWriter, r *http.Request, opts ...WebSocketOptions) (*WebSocketConn, error) {
+	var options WebSocketOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.CheckOrigin == nil {
+		options.CheckOrigin = sameOrigin
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet:
+		err := errors.New("websocket handshake must use GET")
+		_ = t.ErrorJSON(w, err, http.StatusMethodNotAllowed)
+		return nil, err
+	case !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket"):
+		err := errors.New("not a websocket handshake")
+		_ = t.ErrorJSON(w, err, http.StatusBadRequest)
+		return nil, err
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		err := errors.New("unsupported websocket version")
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		_ = t.ErrorJSON(w, err, http.StatusUpgradeRequired)
+		return nil, err
+	case key == "":
+		err := errors.New("missing Sec-WebSocket-Key")
+		_ = t.ErrorJSON(w, err, http.StatusBadRequest)
+		return nil, err
+	case !options.CheckOrigin(r):
+		err := errors.New("websocket origin not allowed")
+		_ = t.ErrorJSON(w, err, http.StatusForbidden)
+		return nil, err
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		err := errors.New("the response writer does not support hijacking")
+		_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+		return nil, err
+	}
+
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	handshake := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n"
+	if _, err = conn.Write([]byte(handshake)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ws := &WebSocketConn{
+		conn:           conn,
+		br:             brw.Reader,
+		tools:          t,
+		maxMessageSize: options.MaxMessageSize,
+		pingInterval:   durationOr(options.PingInterval, 30*time.Second),
+		done:           make(chan struct{}),
+	}
+	if ws.maxMessageSize <= 0 {
+		ws.maxMessageSize = 1024 * 1024 // 1MB
+	}
+
+	go ws.keepalive()
+	return ws, nil
+}
+
+// ReadMessage reads the next text or binary message, answering pings and handling close frames on the way.
+// It returns ErrWebSocketClosed once the other side has closed the connection.
+func (c *WebSocketConn) ReadMessage() (messageType int, data []byte, err error) {
+	var message bytes.Buffer
+	for {
+		// any frame, pongs included, shows the other side is still alive
+		if err = c.conn.SetReadDeadline(time.Now().Add(2 * c.pingInterval)); err != nil {
+			return 0, nil, err
+		}
+
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			if errors.Is(err, ErrWebSocketMessageTooLarge) {
+				c.closeWithCode(1009)
+			} else if errors.Is(err, errWebSocketProtocol) {
+				c.closeWithCode(1002)
+			}
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case wsPing:
+			if err = c.writeFrame(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			code := uint16(1000)
+			if len(payload) >= 2 {
+				code = binary.BigEndian.Uint16(payload)
+			}
+			c.closeWithCode(code)
+			return 0, nil, ErrWebSocketClosed
+		case WebSocketText, WebSocketBinary:
+			if messageType != 0 {
+				c.closeWithCode(1002)
+				return 0, nil, errWebSocketProtocol
+			}
+			messageType = int(opcode)
+		case wsContinuation:
+			if messageType == 0 {
+				c.closeWithCode(1002)
+				return 0, nil, errWebSocketProtocol
+			}
+		default:
+			c.closeWithCode(1002)
+			return 0, nil, errWebSocketProtocol
+		}
+
+		if int64(message.Len()+len(payload)) > c.maxMessageSize {
+			c.closeWithCode(1009)
+			return 0, nil, ErrWebSocketMessageTooLarge
+		}
+		message.Write(payload)
+
+		if fin {
+			return messageType, message.Bytes(), nil
+		}
+	}
+}
+
+// WriteMessage sends data as a single message of the given type (WebSocketText or WebSocketBinary).
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != WebSocketText && messageType != WebSocketBinary {
+		return fmt.Errorf("invalid websocket message type %d", messageType)
+	}
+	return c.writeFrame(byte(messageType), data)
+}
+
+// ReadJSON reads the next message, and decodes it from JSON into data, with the same rules as Tools.ReadJSON
+// regarding unknown fields.
+func (c *WebSocketConn) ReadJSON(data any) error {
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(message))
+	if !c.tools.AllowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(data)
+}
+
+// WriteJSON sends data, encoded as JSON, as a text message.
+func (c *WebSocketConn) WriteJSON(data any) error {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(WebSocketText, out)
+}
+
+// Close sends a normal closure frame, and closes the connection.
+func (c *WebSocketConn) Close() error {
+	c.closeWithCode(1000)
+	return nil
+}
+
+// closeWithCode sends a close frame with code, unless the connection is already closed, and closes it.
+func (c *WebSocketConn) closeWithCode(code uint16) {
+	c.closeOnce.Do(func() {
+		payload := make([]byte, 2)
+		binary.BigEndian.PutUint16(payload, code)
+		_ = c.writeFrame(wsClose, payload)
+
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// keepalive pings the other side every pingInterval until the connection is closed.
+func (c *WebSocketConn) keepalive() {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.writeFrame(wsPing, nil); err != nil {
+				c.closeWithCode(1001)
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// readFrame reads a single frame from the client, which must be masked.
+func (c *WebSocketConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[0]&0x70 != 0 || header[1]&0x80 == 0 {
+		// no extensions are negotiated, and clients must always mask their frames
+		return false, 0, nil, errWebSocketProtocol
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if opcode >= wsClose && (length > 125 || !fin) {
+		return false, 0, nil, errWebSocketProtocol
+	}
+	if length > uint64(c.maxMessageSize) {
+		return false, 0, nil, ErrWebSocketMessageTooLarge
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends payload as a single, unmasked, frame.
+func (c *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	header := []byte{0x80 | opcode, 0}
+	switch length := len(payload); {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(append(header, payload...))
+	return err
+}
+
+// sameOrigin reports whether r has no Origin header, or one matching its Host.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// headerContainsToken reports whether the comma separated header name contains token, ignoring case.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WebSocketHub keeps track of a set of WebSocket connections, to broadcast messages to all of them.
+type WebSocketHub struct {
+	mu    sync.Mutex
+	conns map[*WebSocketConn]struct{}
+}
+
+// NewWebSocketHub returns an empty WebSocketHub.
+func NewWebSocketHub() *WebSocketHub {
+	return &WebSocketHub{conns: make(map[*WebSocketConn]struct{})}
+}
+
+// Add adds conn to the hub.
+func (h *WebSocketHub) Add(conn *WebSocketConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns[conn] = struct{}{}
+}
+
+// Remove removes conn from the hub.
+func (h *WebSocketHub) Remove(conn *WebSocketConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, conn)
+}
+
+// Len returns the number of connections in the hub.
+func (h *WebSocketHub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.conns)
+}
+
+// Broadcast sends data, encoded as JSON, to every connection in the hub.
+// Connections which can't be written to are closed and removed.
+func (h *WebSocketHub) Broadcast(data any) error {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	conns := make([]*WebSocketConn, 0, len(h.conns))
+	for conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.mu.Unlock()
+
+	for _, conn := range conns {
+		if err := conn.writeFrame(WebSocketText, out); err != nil {
+			conn.Close()
+			h.Remove(conn)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package toolkit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testWebSocketClient is a bare bones WebSocket client, masking its frames as browsers do.
+type testWebSocketClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dialTestWebSocket performs the WebSocket handshake against the test server, and returns the response.
+func dialTestWebSocket(t *testing.T, server *httptest.Server, header http.Header) (*testWebSocketClient, *http.Response) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req, _ := http.NewRequest("GET", server.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err = req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testWebSocketClient{conn: conn, br: br}, res
+}
+
+func (c *testWebSocketClient) writeFrame(fin bool, opcode byte, payload []byte) error {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	header := []byte{first, 0x80 | byte(len(payload))}
+	mask := []byte{1, 2, 3, 4}
+	masked := make([]byte, len(payload))
+	for i := range payload {
+		masked[i] = payload[i] ^ mask[i%4]
+	}
+	_, err := c.conn.Write(append(append(header, mask...), masked...))
+	return err
+}
+
+func (c *testWebSocketClient) readFrame() (opcode byte, payload []byte, err error) {
+	_ = c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var header [2]byte
+	if _, err = io.ReadFull(c.br, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload = make([]byte, length)
+	_, err = io.ReadFull(c.br, payload)
+	return header[0] & 0x0f, payload, err
+}
+
+func TestTools_UpgradeWebSocket(t *testing.T) {
+	var testTools Tools
+
+	type message struct {
+		Text string `json:"text"`
+	}
+
+	serverErr := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := testTools.UpgradeWebSocket(w, r, WebSocketOptions{MaxMessageSize: 1024})
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// echo messages back until the client goes away
+		for {
+			var msg message
+			if err := conn.ReadJSON(&msg); err != nil {
+				serverErr <- err
+				return
+			}
+			if err := conn.WriteJSON(message{Text: strings.ToUpper(msg.Text)}); err != nil {
+				serverErr <- err
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, res := dialTestWebSocket(t, server, nil)
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("wrong status code; expected 101 but got %d", res.StatusCode)
+	}
+	if res.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Error("wrong Sec-WebSocket-Accept header", res.Header.Get("Sec-WebSocket-Accept"))
+	}
+
+	// a fragmented message, interleaved with a ping which must be answered
+	_ = client.writeFrame(false, WebSocketText, []byte(`{"text":`))
+	_ = client.writeFrame(true, wsPing, []byte("ping"))
+	_ = client.writeFrame(true, wsContinuation, []byte(`"hello"}`))
+
+	opcode, payload, err := client.readFrame()
+	if err != nil || opcode != wsPong || string(payload) != "ping" {
+		t.Fatalf("expected a pong, got opcode %d %q %v", opcode, payload, err)
+	}
+
+	opcode, payload, err = client.readFrame()
+	if err != nil || opcode != WebSocketText || string(payload) != `{"text":"HELLO"}` {
+		t.Fatalf("wrong echo, got opcode %d %q %v", opcode, payload, err)
+	}
+
+	_ = client.writeFrame(true, wsClose, []byte{0x03, 0xe8})
+	opcode, payload, err = client.readFrame()
+	if err != nil || opcode != wsClose || binary.BigEndian.Uint16(payload) != 1000 {
+		t.Errorf("expected the close frame to be echoed, got opcode %d %v %v", opcode, payload, err)
+	}
+
+	if err := <-serverErr; !errors.Is(err, ErrWebSocketClosed) {
+		t.Error("expected ErrWebSocketClosed, got", err)
+	}
+}
+
+var websocketHandshakeTests = []struct {
+	name       string
+	header     http.Header
+	statusCode int
+}{
+	{name: "wrong version", header: http.Header{"Sec-Websocket-Version": {"8"}}, statusCode: http.StatusUpgradeRequired},
+	{name: "no upgrade", header: http.Header{"Upgrade": {"h2c"}}, statusCode: http.StatusBadRequest},
+	{name: "cross origin", header: http.Header{"Origin": {"https://evil.example.com"}}, statusCode: http.StatusForbidden},
+}
+
+func TestTools_UpgradeWebSocketRejected(t *testing.T) {
+	var testTools Tools
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := testTools.UpgradeWebSocket(w, r); err == nil {
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+
+	for _, e := range websocketHandshakeTests {
+		_, res := dialTestWebSocket(t, server, e.header)
+		if res.StatusCode != e.statusCode {
+			t.Errorf("%s: wrong status code; expected %d but got %d", e.name, e.statusCode, res.StatusCode)
+		}
+	}
+}
+
+func TestWebSocketConn_MaxMessageSize(t *testing.T) {
+	var testTools Tools
+
+	serverErr := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := testTools.UpgradeWebSocket(w, r, WebSocketOptions{MaxMessageSize: 8})
+		if err != nil {
+			return
+		}
+		_, _, err = conn.ReadMessage()
+		serverErr <- err
+	}))
+	defer server.Close()
+
+	client, _ := dialTestWebSocket(t, server, nil)
+	_ = client.writeFrame(false, WebSocketText, []byte("12345"))
+	_ = client.writeFrame(true, wsContinuation, []byte("67890"))
+
+	if err := <-serverErr; !errors.Is(err, ErrWebSocketMessageTooLarge) {
+		t.Error("expected ErrWebSocketMessageTooLarge, got", err)
+	}
+	opcode, payload, _ := client.readFrame()
+	if opcode != wsClose || len(payload) < 2 || binary.BigEndian.Uint16(payload) != 1009 {
+		t.Errorf("expected a 1009 close frame, got opcode %d %v", opcode, payload)
+	}
+}
+
+func TestWebSocketConn_Keepalive(t *testing.T) {
+	var testTools Tools
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := testTools.UpgradeWebSocket(w, r, WebSocketOptions{PingInterval: 20 * time.Millisecond})
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _, _ = conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	client, _ := dialTestWebSocket(t, server, nil)
+	opcode, _, err := client.readFrame()
+	if err != nil || opcode != wsPing {
+		t.Errorf("expected a ping, got opcode %d %v", opcode, err)
+	}
+}
+
+func TestWebSocketHub_Broadcast(t *testing.T) {
+	var testTools Tools
+	hub := NewWebSocketHub()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := testTools.UpgradeWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		hub.Add(conn)
+		defer hub.Remove(conn)
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	clients := []*testWebSocketClient{}
+	for i := 0; i < 3; i++ {
+		client, _ := dialTestWebSocket(t, server, nil)
+		clients = append(clients, client)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Len() != 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if hub.Len() != 3 {
+		t.Fatal("expected 3 connections in the hub, got", hub.Len())
+	}
+
+	if err := hub.Broadcast(map[string]string{"event": "deploy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, client := range clients {
+		opcode, payload, err := client.readFrame()
+		if err != nil || opcode != WebSocketText || string(payload) != `{"event":"deploy"}` {
+			t.Errorf("client %d: wrong broadcast, got opcode %d %q %v", i, opcode, payload, err)
+		}
+	}
+}
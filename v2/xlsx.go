@@ -0,0 +1,573 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidXLSX is returned by ImportXLSX for files which aren't Excel workbooks it can read.
+var ErrInvalidXLSX = errors.New("invalid XLSX file")
+
+// XLSXSheet is a worksheet written by WriteXLSX.
+type XLSXSheet struct {
+	// Name is the name of the sheet tab, of at most 31 characters. Defaults to Sheet1, Sheet2…
+	Name string
+	// Header, if set, is written in bold as the first row.
+	Header []string
+	// Rows are the rows of cells. Cells may be strings, bools, numbers, time.Time, which are shown as
+	// dates, or as dates and times when they aren't at midnight, nil, for an empty cell, or any other
+	// value, written as fmt.Sprint formats it.
+	Rows [][]any
+}
+
+// NewXLSXSheet returns a sheet called name for rows, a slice of structs or of pointers to structs,
+// with a header row. Columns are the fields, named by their csv tag, as for ImportCSV, or their name.
+func NewXLSXSheet(name string, rows any) (XLSXSheet, error) {
+	sheet := XLSXSheet{Name: name}
+
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		return sheet, errors.New("rows must be a slice of structs")
+	}
+	elemType := v.Type().Elem()
+	if elemType.Kind() == reflect.Pointer {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return sheet, errors.New("rows must be a slice of structs")
+	}
+
+	var fields []int
+	sheet.Header, fields = csvFields(elemType)
+	for i := 0; i < v.Len(); i++ {
+		sheet.Rows = append(sheet.Rows, csvValues(v.Index(i), fields))
+	}
+	return sheet, nil
+}
+
+// xlsxEpoch is day zero of Excel serial dates.
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// the cell styles of xlsxStyles
+const (
+	xlsxStyleDate     = 1
+	xlsxStyleDateTime = 2
+	xlsxStyleHeader   = 3
+)
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`</cellXfs></styleSheet>`
+
+// WriteXLSX writes an Excel workbook (.xlsx) with sheets to w. Only values are written, with no formulas,
+// so cells starting with = are shown as they are, and can't inject formulas as they may in CSV files.
+func WriteXLSX(w io.Writer, sheets []XLSXSheet) error {
+	if len(sheets) == 0 {
+		sheets = []XLSXSheet{{}}
+	}
+
+	zw := zip.NewWriter(w)
+	write := func(name, content string) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, content)
+		return err
+	}
+
+	var overrides, workbook, rels strings.Builder
+	used := make(map[string]bool)
+	for i := range sheets {
+		name := xlsxSheetName(sheets[i].Name, i+1)
+		if used[strings.ToLower(name)] {
+			return fmt.Errorf("duplicate sheet name %q", name)
+		}
+		used[strings.ToLower(name)] = true
+
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			overrides.String() + `</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` + workbook.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels.String() +
+			fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(sheets)+1) +
+			`</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		if err := write(part.name, part.content); err != nil {
+			return err
+		}
+	}
+
+	for i, sheet := range sheets {
+		f, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if err = writeXLSXSheet(f, sheet); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// xlsxSheetName returns name, made valid as the name of sheet n.
+func xlsxSheetName(name string, n int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return ' '
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if utf8.RuneCountInString(name) > 31 {
+		name = string([]rune(name)[:31])
+	}
+	if name == "" {
+		name = "Sheet" + strconv.Itoa(n)
+	}
+	return name
+}
+
+// writeXLSXSheet writes the worksheet XML of sheet to w.
+func writeXLSXSheet(w io.Writer, sheet XLSXSheet) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	rows := sheet.Rows
+	if sheet.Header != nil {
+		header := make([]any, len(sheet.Header))
+		for i, h := range sheet.Header {
+			header[i] = h
+		}
+		rows = append([][]any{header}, rows...)
+	}
+
+	for i, row := range rows {
+		n := i + 1
+		fmt.Fprintf(bw, `<row r="%d">`, n)
+		for j, value := range row {
+			ref := xlsxColumn(j) + strconv.Itoa(n)
+			style := ""
+			if sheet.Header != nil && i == 0 {
+				style = fmt.Sprintf(` s="%d"`, xlsxStyleHeader)
+			}
+
+			switch v := value.(type) {
+			case nil:
+			case bool:
+				b := 0
+				if v {
+					b = 1
+				}
+				fmt.Fprintf(bw, `<c r="%s" t="b"%s><v>%d</v></c>`, ref, style, b)
+			case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+				fmt.Fprintf(bw, `<c r="%s"%s><v>%d</v></c>`, ref, style, v)
+			case float32:
+				fmt.Fprintf(bw, `<c r="%s"%s><v>%s</v></c>`, ref, style, strconv.FormatFloat(float64(v), 'g', -1, 32))
+			case float64:
+				if math.IsNaN(v) || math.IsInf(v, 0) {
+					fmt.Fprintf(bw, `<c r="%s" t="inlineStr"%s><is><t>%v</t></is></c>`, ref, style, v)
+					break
+				}
+				fmt.Fprintf(bw, `<c r="%s"%s><v>%s</v></c>`, ref, style, strconv.FormatFloat(v, 'g', -1, 64))
+			case time.Time:
+				if v.IsZero() {
+					break
+				}
+				s := xlsxStyleDateTime
+				if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 {
+					s = xlsxStyleDate
+				}
+				fmt.Fprintf(bw, `<c r="%s" s="%d"><v>%s</v></c>`, ref, s, strconv.FormatFloat(xlsxSerial(v), 'f', -1, 64))
+			default:
+				fmt.Fprintf(bw, `<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(fmt.Sprint(v)))
+			}
+		}
+		bw.WriteString(`</row>`)
+	}
+
+	bw.WriteString(`</sheetData></worksheet>`)
+	return bw.Flush()
+}
+
+// xlsxColumn returns the letters of the column with index i, counting from 0: A, B… Z, AA…
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxColumnIndex returns the index of the column of the cell reference ref, such as C12, or -1.
+func xlsxColumnIndex(ref string) int {
+	i := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		i = i*26 + int(r-'A'+1)
+	}
+	return i - 1
+}
+
+// xlsxSerial returns t, as shown by its clock, as an Excel serial date.
+func xlsxSerial(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return wall.Sub(xlsxEpoch).Hours() / 24
+}
+
+// xmlEscape escapes s for XML text and attributes, dropping the characters XML can't hold.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	s = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r != 0xfffe && r != 0xffff) {
+			return r
+		}
+		return -1
+	}, s)
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// ImportXLSX reads the first sheet of the Excel workbook (.xlsx) in r, of size bytes, whose first row
+// is a header, into dst, as ImportCSV does, with the same options, but for Comma; rows are numbered as
+// Excel shows them. Dates are read as times.
+func ImportXLSX(r io.ReaderAt, size int64, dst any, opts ...CSVOptions) (*CSVImportReport, error) {
+	var options CSVOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if options.MaxRows == 0 {
+		options.MaxRows = 10000
+	}
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+
+	slice, elemType, isPointer, err := structSlice(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidXLSX, err)
+	}
+	book := &xlsxWorkbook{files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		book.files[f.Name] = f
+	}
+
+	sheet, err := book.firstSheet()
+	if err != nil {
+		return nil, err
+	}
+	if err = book.readSharedStrings(); err != nil {
+		return nil, err
+	}
+	if err = book.readStyles(); err != nil {
+		return nil, err
+	}
+
+	rc, err := sheet.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidXLSX, err)
+	}
+	defer rc.Close()
+
+	sr := &xlsxSheetReader{book: book, dec: xml.NewDecoder(rc), loc: options.Location}
+	report, err := importRecords(sr.next, slice, elemType, isPointer, options)
+	if errors.Is(err, ErrInvalidCSV) {
+		err = fmt.Errorf("%w: %v", ErrInvalidXLSX, strings.TrimPrefix(err.Error(), ErrInvalidCSV.Error()+": "))
+	}
+	return report, err
+}
+
+// maxXLSXPart limits how much of the shared strings and styles of a workbook is read, as they are
+// kept in memory.
+const maxXLSXPart = 64 * 1024 * 1024
+
+// xlsxWorkbook is an Excel workbook read by ImportXLSX.
+type xlsxWorkbook struct {
+	files   map[string]*zip.File
+	strings []string
+	// dateStyles are the indexes of the cell styles showing dates
+	dateStyles map[int]bool
+}
+
+// decode decodes the XML part called name into v, reporting whether it exists.
+func (b *xlsxWorkbook) decode(name string, v any) (bool, error) {
+	f, ok := b.files[name]
+	if !ok {
+		return false, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return true, fmt.Errorf("%w: %v", ErrInvalidXLSX, err)
+	}
+	defer rc.Close()
+	if err = xml.NewDecoder(io.LimitReader(rc, maxXLSXPart)).Decode(v); err != nil {
+		return true, fmt.Errorf("%w: %s: %v", ErrInvalidXLSX, name, err)
+	}
+	return true, nil
+}
+
+// firstSheet returns the part of the first worksheet.
+func (b *xlsxWorkbook) firstSheet() (*zip.File, error) {
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if ok, err := b.decode("xl/workbook.xml", &workbook); err != nil || !ok || len(workbook.Sheets) == 0 {
+		if err == nil {
+			err = fmt.Errorf("%w: no worksheet", ErrInvalidXLSX)
+		}
+		return nil, err
+	}
+	if _, err := b.decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		target := path.Join("xl", rel.Target)
+		if strings.HasPrefix(rel.Target, "/") {
+			target = strings.TrimPrefix(rel.Target, "/")
+		}
+		if f, ok := b.files[target]; ok {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no worksheet", ErrInvalidXLSX)
+}
+
+// readSharedStrings reads the strings table most string cells refer to.
+func (b *xlsxWorkbook) readSharedStrings() error {
+	var table struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if _, err := b.decode("xl/sharedStrings.xml", &table); err != nil {
+		return err
+	}
+	for _, item := range table.Items {
+		text := item.Text
+		for _, run := range item.Runs {
+			text += run.Text
+		}
+		b.strings = append(b.strings, text)
+	}
+	return nil
+}
+
+// readStyles finds the cell styles which show numbers as dates.
+func (b *xlsxWorkbook) readStyles() error {
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if _, err := b.decode("xl/styles.xml", &styles); err != nil {
+		return err
+	}
+
+	dateFormats := make(map[int]bool)
+	for id := 14; id <= 22; id++ {
+		dateFormats[id] = true
+	}
+	for _, id := range []int{45, 46, 47} {
+		dateFormats[id] = true
+	}
+	for _, format := range styles.NumFmts {
+		dateFormats[format.ID] = isDateFormat(format.Code)
+	}
+
+	b.dateStyles = make(map[int]bool)
+	for i, xf := range styles.CellXfs {
+		if dateFormats[xf.NumFmtID] {
+			b.dateStyles[i] = true
+		}
+	}
+	return nil
+}
+
+// isDateFormat reports whether the number format code shows dates or times, ignoring its quoted and
+// bracketed parts, such as colors.
+func isDateFormat(code string) bool {
+	quoted, bracketed := false, false
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '\\':
+			i++
+		case c == '[':
+			bracketed = true
+		case c == ']':
+			bracketed = false
+		case bracketed:
+		case strings.IndexByte("ymdhsYMDHS", c) >= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// xlsxSheetReader reads the rows of a worksheet one at a time.
+type xlsxSheetReader struct {
+	book *xlsxWorkbook
+	dec  *xml.Decoder
+	loc  *time.Location
+	row  int
+}
+
+// xlsxCell is a cell of a worksheet.
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  int    `xml:"s,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"is"`
+}
+
+// next returns the next row of the sheet, and its number, or io.EOF.
+func (sr *xlsxSheetReader) next() (int, []string, error) {
+	for {
+		token, err := sr.dec.Token()
+		if err != nil {
+			if err != io.EOF {
+				err = fmt.Errorf("%w: %v", ErrInvalidXLSX, err)
+			}
+			return 0, nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row struct {
+			Number int        `xml:"r,attr"`
+			Cells  []xlsxCell `xml:"c"`
+		}
+		if err = sr.dec.DecodeElement(&row, &start); err != nil {
+			return 0, nil, fmt.Errorf("%w: %v", ErrInvalidXLSX, err)
+		}
+		if row.Number == 0 {
+			row.Number = sr.row + 1
+		}
+		sr.row = row.Number
+
+		var record []string
+		for i, cell := range row.Cells {
+			column := i
+			if cell.Ref != "" {
+				column = xlsxColumnIndex(cell.Ref)
+			}
+			if column < 0 || column > 16383 {
+				return 0, nil, fmt.Errorf("%w: invalid cell reference %q", ErrInvalidXLSX, cell.Ref)
+			}
+			for len(record) <= column {
+				record = append(record, "")
+			}
+			record[column] = sr.cellValue(cell)
+		}
+		return row.Number, record, nil
+	}
+}
+
+// cellValue returns the value of cell as text, times being formatted as RFC 3339.
+func (sr *xlsxSheetReader) cellValue(cell xlsxCell) string {
+	switch cell.Type {
+	case "s":
+		i, err := strconv.Atoi(cell.Value)
+		if err != nil || i < 0 || i >= len(sr.book.strings) {
+			return ""
+		}
+		return sr.book.strings[i]
+	case "inlineStr":
+		text := cell.Inline.Text
+		for _, run := range cell.Inline.Runs {
+			text += run.Text
+		}
+		return text
+	case "b":
+		if cell.Value == "1" {
+			return "true"
+		}
+		return "false"
+	case "", "n":
+		if !sr.book.dateStyles[cell.Style] {
+			return cell.Value
+		}
+		serial, err := strconv.ParseFloat(cell.Value, 64)
+		if err != nil {
+			return cell.Value
+		}
+		t := xlsxEpoch.Add(time.Duration(math.Round(serial*86400)) * time.Second)
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, sr.loc)
+		if serial == math.Trunc(serial) {
+			return t.Format("2006-01-02")
+		}
+		return t.Format(time.RFC3339)
+	}
+	return cell.Value
+}
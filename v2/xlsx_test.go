@@ -0,0 +1,119 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteXLSX_ImportXLSX(t *testing.T) {
+	score := 9.5
+	contacts := []csvContact{
+		{Email: "jane@example.com", Name: "Jane <Doe> & co", Age: 34, Active: true, Joined: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Score: &score, Country: "FR"},
+		{Email: "bob@example.com", Name: "=HYPERLINK(\"x\")", Age: 51, Joined: time.Date(2023, 12, 31, 18, 30, 0, 0, time.UTC)},
+	}
+	sheet, err := NewXLSXSheet("Contacts", contacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedHeader := []string{"email", "full name", "age", "active", "joined", "score", "Country", "reminder"}
+	if strings.Join(sheet.Header, "|") != strings.Join(expectedHeader, "|") {
+		t.Errorf("expected header %v, got %v", expectedHeader, sheet.Header)
+	}
+	// a row with an error is reported with the number Excel shows
+	sheet.Rows = append(sheet.Rows, []any{"", "No Email", 20})
+
+	var buf bytes.Buffer
+	if err = WriteXLSX(&buf, []XLSXSheet{sheet, {Name: "Other", Rows: [][]any{{"not imported"}}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var imported []csvContact
+	report, err := ImportXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()), &imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Rows != 3 || report.Imported != 2 || len(report.Errors) != 1 || report.Errors[0] != (CSVRowError{Row: 4, Column: "email", Message: "is required"}) {
+		t.Fatalf("wrong report %+v", report)
+	}
+	for i := range contacts {
+		if imported[i].Email != contacts[i].Email || imported[i].Name != contacts[i].Name || imported[i].Age != contacts[i].Age ||
+			imported[i].Active != contacts[i].Active || !imported[i].Joined.Equal(contacts[i].Joined) || imported[i].Country != contacts[i].Country {
+			t.Errorf("expected %+v, got %+v", contacts[i], imported[i])
+		}
+	}
+	if imported[0].Score == nil || *imported[0].Score != 9.5 || imported[1].Score != nil {
+		t.Errorf("wrong scores %v, %v", imported[0].Score, imported[1].Score)
+	}
+}
+
+// testXLSX builds a workbook as Excel writes it, with shared strings and a custom date format.
+func testXLSX(sheet string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Data" sheetId="3" r:id="rId7"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId7" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<si><t>email</t></si><si><t>joined</t></si><si><r><t>jane@</t></r><r><rPr><b/></rPr><t>example.com</t></r></si><si><t>age</t></si></sst>`,
+		"xl/styles.xml": `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<numFmts count="2"><numFmt numFmtId="165" formatCode="[$-409]d\-mmm\-yy;@"/><numFmt numFmtId="166" formatCode="&quot;day&quot; 0"/></numFmts>` +
+			`<cellXfs count="3"><xf numFmtId="0"/><xf numFmtId="165"/><xf numFmtId="166"/></cellXfs></styleSheet>`,
+		"xl/worksheets/data.xml": sheet,
+	}
+	for name, content := range parts {
+		f, _ := zw.Create(name)
+		_, _ = io.WriteString(f, content)
+	}
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func TestImportXLSX_Excel(t *testing.T) {
+	data := testXLSX(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+		`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c><c r="D1" t="s"><v>3</v></c></row>` +
+		`<row r="3"><c r="A3" t="s"><v>2</v></c><c r="C3" s="1"><v>45352</v></c><c r="D3" s="2"><v>34</v></c></row>` +
+		`</sheetData></worksheet>`)
+
+	var contacts []csvContact
+	report, err := ImportXLSX(bytes.NewReader(data), int64(len(data)), &contacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 1 || contacts[0].Email != "jane@example.com" || contacts[0].Age != 34 ||
+		!contacts[0].Joined.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong import %+v, %+v", report, contacts)
+	}
+}
+
+func TestImportXLSX_Errors(t *testing.T) {
+	var contacts []csvContact
+
+	if _, err := ImportXLSX(strings.NewReader("email\n"), 6, &contacts); !errors.Is(err, ErrInvalidXLSX) {
+		t.Error("expected ErrInvalidXLSX for a CSV file, got", err)
+	}
+
+	data := testXLSX(`<worksheet><sheetData><row r="1"><c r="A1" t="s"><v>3</v></c></row></sheetData></worksheet>`)
+	if _, err := ImportXLSX(bytes.NewReader(data), int64(len(data)), &contacts); !errors.Is(err, ErrInvalidXLSX) {
+		t.Error("expected ErrInvalidXLSX for a missing column, got", err)
+	}
+
+	data = testXLSX(`<worksheet><sheetData><row r="1"><c r="A1" t="s"><v>0</v></c></row><row><c><v>1</v>`)
+	if _, err := ImportXLSX(bytes.NewReader(data), int64(len(data)), &contacts); !errors.Is(err, ErrInvalidXLSX) {
+		t.Error("expected ErrInvalidXLSX for a truncated sheet, got", err)
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for i, expected := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA"} {
+		if column := xlsxColumn(i); column != expected || xlsxColumnIndex(column+"12") != i {
+			t.Errorf("%d: expected %s, got %s", i, expected, column)
+		}
+	}
+}